@@ -0,0 +1,708 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	// Embedded so IANA time zone names work without a system time zone database
+	_ "time/tzdata"
+
+	"golang.org/x/oauth2/google"
+
+	"krupesh.faldu/internal/delivery"
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/repository"
+	"krupesh.faldu/internal/usecase"
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// dependencies wires repositories and use cases together for the CLI
+type dependencies struct {
+	// limiter paces the API calls of every client built in the run, so that together they stay
+	// within the quotas
+	limiter     *repository.RateLimiter
+	limiterOnce sync.Once
+	// metrics counts the API usage of every client built in the run
+	metrics *repository.Metrics
+	// tracer records the operations of the run when OpenTelemetry tracing is configured
+	tracer *repository.OTLPTracer
+}
+
+// LoadConfig reads the config file selected with --config and the GPM_* environment variables
+func (d *dependencies) LoadConfig(opts delivery.GlobalOptions) (domain.Config, error) {
+	return repository.LoadConfig(opts.ConfigPath, os.Getenv)
+}
+
+// LoadConfigFile reads the config file selected with --config, leaving out the GPM_* variables
+func (d *dependencies) LoadConfigFile(opts delivery.GlobalOptions) (domain.Config, error) {
+	return repository.LoadConfigFile(opts.ConfigPath, os.Getenv)
+}
+
+// SaveConfig writes config to the file LoadConfig reads
+func (d *dependencies) SaveConfig(opts delivery.GlobalOptions, config domain.Config) (string, error) {
+	return repository.SaveConfig(opts.ConfigPath, os.Getenv, config)
+}
+
+// ConfigSchema describes the YAML config file read by LoadConfig
+func (d *dependencies) ConfigSchema() map[string]any {
+	return repository.ConfigSchema()
+}
+
+// ProfileUseCase builds the profile use case over the configured directory
+func (d *dependencies) ProfileUseCase(opts delivery.GlobalOptions) (*usecase.ProfileUseCase, error) {
+	profileRepo := repository.NewFileProfileRepositoryWithOptions(opts.Config.Dir, repository.ProfileOptions{
+		CredentialsPath: opts.Config.CredentialsPath,
+		TokenPath:       opts.Config.TokenPath,
+	})
+	profileUseCase := usecase.NewProfileUseCase(profileRepo)
+	profileUseCase.SetLogger(opts.Logger)
+	return profileUseCase, nil
+}
+
+// OAuthUseCase builds the OAuth use case for the selected profile
+func (d *dependencies) OAuthUseCase(opts delivery.GlobalOptions) (*usecase.OAuthUseCase, error) {
+	oauthService, err := d.oauthService(opts)
+	if err != nil {
+		return nil, err
+	}
+	oauthUseCase := usecase.NewOAuthUseCase(oauthService)
+	oauthUseCase.SetLogger(opts.Logger)
+	oauthUseCase.SetExitHooks(opts.ExitHooks())
+	return oauthUseCase, nil
+}
+
+// AlbumUseCase builds the album use case with an authenticated HTTP client for the selected profile
+func (d *dependencies) AlbumUseCase(opts delivery.GlobalOptions) (*usecase.AlbumUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	albumRepo := d.albumRepository(client, opts)
+	albumUseCase := usecase.NewAlbumUseCase(albumRepo)
+	albumUseCase.SetLogger(opts.Logger)
+	albumUseCase.SetTracer(d.tracer)
+	return albumUseCase, nil
+}
+
+// SharingUseCase builds the sharing use case with an authenticated HTTP client for the selected profile
+func (d *dependencies) SharingUseCase(opts delivery.GlobalOptions) (*usecase.SharingUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	shortener, err := urlShortener(opts.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	sharingRepo := repository.NewGooglePhotosSharingRepository(client, d.photosOptions(opts))
+	sharingUseCase := usecase.NewSharingUseCase(sharingRepo)
+	sharingUseCase.SetLogger(opts.Logger)
+	if shortener != nil {
+		sharingUseCase.SetURLShortener(shortener)
+	}
+	return sharingUseCase, nil
+}
+
+// urlShortener builds the optional shortener for share links from the shortener settings of the
+// config; it returns nil when none is configured
+func urlShortener(config domain.Config) (domain.URLShortener, error) {
+	if config.Shortener == "" {
+		return nil, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return repository.NewURLShortener(client, config.Shortener, config.ShortenerURL, config.ShortenerAPIKey)
+}
+
+// UploadUseCase builds the upload use case with an authenticated HTTP client for the selected profile
+func (d *dependencies) UploadUseCase(opts delivery.GlobalOptions) (*usecase.UploadUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resumable upload sessions are kept per profile so an interrupted upload can continue on the next run
+	mediaOpts := d.photosOptions(opts)
+	mediaOpts.UploadSessions = repository.NewFileUploadSessionStore(filepath.Join(profile.CacheDir, "uploads"))
+
+	mediaRepo := d.mediaItemRepository(client, mediaOpts, opts)
+	albumRepo := d.albumRepository(client, opts)
+	uploadUseCase := usecase.NewUploadUseCase(mediaRepo, albumRepo)
+	uploadUseCase.SetExifRepository(localIndex(profile, opts.Logger))
+	// Thumbnails of uploaded photos go where the gallery and contact sheets look for them
+	uploadUseCase.SetThumbnails(repository.NewImageThumbnailer(), repository.NewFileThumbnailCache(filepath.Join(profile.CacheDir, "thumbnails")))
+	uploadUseCase.SetThroughputStore(throughputStore(profile))
+	uploadUseCase.SetProgress(opts.Progress)
+	uploadUseCase.SetLogger(opts.Logger)
+	uploadUseCase.SetTracer(d.tracer)
+	uploadUseCase.SetExitHooks(opts.ExitHooks())
+	return uploadUseCase, nil
+}
+
+// WatchUseCase builds the upload use case for watching a folder, recording uploaded files in the
+// selected profile's local index
+func (d *dependencies) WatchUseCase(opts delivery.GlobalOptions) (*usecase.UploadUseCase, error) {
+	uploadUseCase, err := d.UploadUseCase(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadUseCase.SetUploadedFiles(localIndex(profile, opts.Logger))
+	return uploadUseCase, nil
+}
+
+// FolderNotifier reports the changes below dir through the file system notifications of the OS
+func (d *dependencies) FolderNotifier(opts delivery.GlobalOptions, dir string) (domain.FolderNotifier, error) {
+	return repository.NewFSNotifyFolderNotifier(dir, opts.Logger)
+}
+
+// DownloadUseCase builds the download use case with an authenticated HTTP client for the selected profile
+func (d *dependencies) DownloadUseCase(opts delivery.GlobalOptions) (*usecase.DownloadUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	downloadUseCase := usecase.NewDownloadUseCase(mediaRepo)
+	downloadUseCase.SetAlbumRepository(d.albumRepository(client, opts))
+	downloadUseCase.SetThroughputStore(throughputStore(profile))
+	downloadUseCase.SetProgress(opts.Progress)
+	downloadUseCase.SetLogger(opts.Logger)
+	downloadUseCase.SetTracer(d.tracer)
+	downloadUseCase.SetExitHooks(opts.ExitHooks())
+	return downloadUseCase, nil
+}
+
+// DescribeUseCase builds the use case editing media item descriptions for the selected profile
+func (d *dependencies) DescribeUseCase(opts delivery.GlobalOptions) (*usecase.DescribeUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	describeUseCase := usecase.NewDescribeUseCase(mediaRepo)
+	describeUseCase.SetLogger(opts.Logger)
+	describeUseCase.SetTracer(d.tracer)
+	return describeUseCase, nil
+}
+
+// DaemonUseCase builds the daemon use case, keeping the status of its jobs in the selected
+// profile's cache
+func (d *dependencies) DaemonUseCase(opts delivery.GlobalOptions) (*usecase.DaemonUseCase, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	daemonUseCase := usecase.NewDaemonUseCase(repository.NewFileJobStatusStore(filepath.Join(profile.CacheDir, "jobs.json")))
+	daemonUseCase.SetLogger(opts.Logger)
+	return daemonUseCase, nil
+}
+
+// ListenControlSocket shares the selected profile's local index over daemon.sock in its cache
+func (d *dependencies) ListenControlSocket(opts delivery.GlobalOptions) (io.Closer, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	index := repository.NewSharedIndexRepository(filepath.Join(profile.CacheDir, "index.db"))
+	control, err := repository.ListenControlSocket(controlSocketPath(profile), repository.NewControlHandler(index))
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger.Info("Sharing the local index over the control socket", "socket", controlSocketPath(profile))
+	return control, nil
+}
+
+// BackupUseCase builds the backup use case copying the selected profile's library to target: an
+// s3:// or gs:// URL of a bucket and prefix, or a local directory
+func (d *dependencies) BackupUseCase(opts delivery.GlobalOptions, target string) (*usecase.BackupUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	backupTarget, err := newBackupTarget(target, opts.ExitHooks())
+	if err != nil {
+		return nil, err
+	}
+
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	backupUseCase := usecase.NewBackupUseCase(mediaRepo, backupTarget)
+	backupUseCase.SetThroughputStore(throughputStore(profile))
+	backupUseCase.SetProgress(opts.Progress)
+	backupUseCase.SetLogger(opts.Logger)
+	backupUseCase.SetTracer(d.tracer)
+	return backupUseCase, nil
+}
+
+// newBackupTarget builds the backup target of target, cleaning up the copies in flight with exit.
+// S3 buckets take their credentials from the AWS_* environment variables, GCS buckets from the
+// application default credentials.
+func newBackupTarget(target string, exit domain.ExitHooks) (domain.BackupTarget, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found {
+		return repository.NewLocalBackupTarget(target, exit), nil
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	switch scheme {
+	case "file":
+		return repository.NewLocalBackupTarget(rest, exit), nil
+	case "s3":
+		return repository.NewS3BackupTarget(&http.Client{}, repository.S3OptionsFromEnv(bucket, prefix, os.Getenv), exit)
+	case "gs":
+		client, err := google.DefaultClient(context.Background(), repository.GCSScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google Cloud credentials: %v", err)
+		}
+		return repository.NewGCSBackupTarget(client, repository.GCSOptions{Bucket: bucket, Prefix: prefix})
+	}
+	return nil, fmt.Errorf("%w: unknown backup target %q, expected s3://, gs:// or a directory", domain.ErrInvalidArgument, target)
+}
+
+// IndexUseCase builds the index use case over the selected profile's local index database
+func (d *dependencies) IndexUseCase(opts delivery.GlobalOptions) (*usecase.IndexUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := indexRepository(profile, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	albumRepo := d.albumRepository(client, opts)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	indexUseCase := usecase.NewIndexUseCase(albumRepo, mediaRepo, index)
+	indexUseCase.SetLogger(opts.Logger)
+	indexUseCase.SetTracer(d.tracer)
+	return indexUseCase, nil
+}
+
+// SyncUseCase builds the sync use case over the selected profile's local index and sync state
+func (d *dependencies) SyncUseCase(opts delivery.GlobalOptions) (*usecase.SyncUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := indexRepository(profile, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	state := repository.NewFileSyncStateStore(filepath.Join(profile.CacheDir, "sync.json"))
+	albumRepo := d.albumRepository(client, opts)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	syncUseCase := usecase.NewSyncUseCase(albumRepo, mediaRepo, index, state)
+	syncUseCase.SetThroughputStore(throughputStore(profile))
+	syncUseCase.SetProgress(opts.Progress)
+	syncUseCase.SetLogger(opts.Logger)
+	syncUseCase.SetTracer(d.tracer)
+	return syncUseCase, nil
+}
+
+// DedupeUseCase builds the dedupe use case over the selected profile's local index
+func (d *dependencies) DedupeUseCase(opts delivery.GlobalOptions) (*usecase.DedupeUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := indexRepository(profile, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	albumRepo := d.albumRepository(client, opts)
+	dedupeUseCase := usecase.NewDedupeUseCase(index, mediaRepo, albumRepo)
+	dedupeUseCase.SetImageHashRepository(index)
+	dedupeUseCase.SetLogger(opts.Logger)
+	return dedupeUseCase, nil
+}
+
+// MagicUseCase builds the magic album use case for the selected profile with the rules in rulesPath
+func (d *dependencies) MagicUseCase(opts delivery.GlobalOptions, rulesPath string) (*usecase.MagicUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := repository.NewFileMagicRuleRepository(rulesPath)
+	albumRepo := d.albumRepository(client, opts)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	magicUseCase := usecase.NewMagicUseCase(rules, albumRepo, mediaRepo)
+	magicUseCase.SetExifRepository(localIndex(profile, opts.Logger))
+	magicUseCase.SetLogger(opts.Logger)
+	return magicUseCase, nil
+}
+
+// ContactSheetUseCase builds the contact sheet use case with the selected profile's thumbnail cache
+func (d *dependencies) ContactSheetUseCase(opts delivery.GlobalOptions) (*usecase.ContactSheetUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs := repository.NewFileThumbnailCache(filepath.Join(profile.CacheDir, "thumbnails"))
+	albumRepo := d.albumRepository(client, opts)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	contactSheetUseCase := usecase.NewContactSheetUseCase(albumRepo, mediaRepo, thumbs)
+	contactSheetUseCase.SetLogger(opts.Logger)
+	return contactSheetUseCase, nil
+}
+
+// GalleryUseCase builds the web gallery use case, sharing the thumbnail cache of contact sheets
+func (d *dependencies) GalleryUseCase(opts delivery.GlobalOptions) (*usecase.GalleryUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbs := repository.NewFileThumbnailCache(filepath.Join(profile.CacheDir, "thumbnails"))
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	galleryUseCase := usecase.NewGalleryUseCase(mediaRepo, thumbs)
+	galleryUseCase.SetLogger(opts.Logger)
+	return galleryUseCase, nil
+}
+
+// LayoutUseCase builds the calendar and photo book use case for the selected profile
+func (d *dependencies) LayoutUseCase(opts delivery.GlobalOptions) (*usecase.LayoutUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	albumRepo := d.albumRepository(client, opts)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	layoutUseCase := usecase.NewLayoutUseCase(albumRepo, mediaRepo)
+	layoutUseCase.SetLogger(opts.Logger)
+	return layoutUseCase, nil
+}
+
+// ReelUseCase builds the highlight reel use case for the selected profile, assembling with ffmpegPath
+func (d *dependencies) ReelUseCase(opts delivery.GlobalOptions, ffmpegPath string) (*usecase.ReelUseCase, error) {
+	client, err := d.photosClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	assembler := repository.NewFFmpegReelAssembler(ffmpegPath)
+	mediaRepo := d.mediaItemRepository(client, d.photosOptions(opts), opts)
+	albumRepo := d.albumRepository(client, opts)
+	reelUseCase := usecase.NewReelUseCase(mediaRepo, albumRepo, assembler)
+	reelUseCase.SetLogger(opts.Logger)
+	reelUseCase.SetExitHooks(opts.ExitHooks())
+	return reelUseCase, nil
+}
+
+// ThumbnailUseCase builds the use case making thumbnails of local photos; it needs no login
+func (d *dependencies) ThumbnailUseCase(opts delivery.GlobalOptions, vipsPath string) (*usecase.ThumbnailUseCase, error) {
+	thumbnailer := repository.NewImageThumbnailer()
+	if vipsPath != "" {
+		thumbnailer = repository.NewVipsThumbnailer(vipsPath)
+	}
+	thumbnailUseCase := usecase.NewThumbnailUseCase(thumbnailer)
+	thumbnailUseCase.SetLogger(opts.Logger)
+	return thumbnailUseCase, nil
+}
+
+// OCRUseCase builds the use case reading text into the selected profile's local index; it needs no login
+func (d *dependencies) OCRUseCase(opts delivery.GlobalOptions, tesseractPath, lang string) (*usecase.OCRUseCase, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ocrUseCase := usecase.NewOCRUseCase(repository.NewTesseractRecognizer(tesseractPath, lang), localIndex(profile, opts.Logger))
+	ocrUseCase.SetLogger(opts.Logger)
+	return ocrUseCase, nil
+}
+
+// AccountUseCase builds the account use case for the selected profile
+func (d *dependencies) AccountUseCase(opts delivery.GlobalOptions) (*usecase.AccountUseCase, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthService, err := repository.NewOAuthRepositoryWithOptions(*profile, oauthOptions(opts, transport))
+	if err != nil {
+		return nil, err
+	}
+
+	// The token being inspected is passed explicitly, so the client must not add its own
+	client := &http.Client{Transport: d.apiTransport(transport, opts), Timeout: opts.Config.HTTPTimeout}
+	accountRepo := repository.NewGoogleAccountRepository(client, d.photosOptions(opts))
+	accountUseCase := usecase.NewAccountUseCase(oauthService, accountRepo, profile.Name)
+	accountUseCase.SetLogger(opts.Logger)
+	return accountUseCase, nil
+}
+
+// photosClient builds an HTTP client authorized with the selected profile's token that logs its API calls
+func (d *dependencies) photosClient(opts delivery.GlobalOptions) (*http.Client, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := gphotos.NewAuth(profile.CredentialsPath, profile.TokenPath, gphotos.AuthOptions{
+		Scopes:       opts.Config.Scopes,
+		CallbackAddr: opts.Config.CallbackAddr,
+		HTTPTimeout:  opts.Config.HTTPTimeout,
+		Transport:    transport,
+		Logger:       opts.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := auth.HTTPClient(context.Background())
+	if errors.Is(err, gphotos.ErrNotLoggedIn) {
+		return nil, fmt.Errorf("%w, run 'auth login' first", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// API calls are logged and counted once they got past the rate limit
+	client.Transport = d.apiTransport(client.Transport, opts)
+	client.Transport = repository.NewRateLimitTransport(client.Transport, d.rateLimiter(opts), opts.Logger)
+	return client, nil
+}
+
+// apiTransport counts and traces the API calls sent through next and logs them: in full with
+// --debug-http, else summarized in --verbose logs and transcripts
+func (d *dependencies) apiTransport(next http.RoundTripper, opts delivery.GlobalOptions) http.RoundTripper {
+	if opts.DebugHTTP {
+		next = repository.NewDebugTransport(next, opts.Logger, opts.DebugHTTPBodies)
+	} else {
+		next = repository.NewLoggingTransport(next, opts.Logger)
+	}
+	next = repository.NewTracingTransport(next, d.tracer)
+	return repository.NewMetricsTransport(next, d.metrics)
+}
+
+// Metrics returns the API usage counted in the run so far
+func (d *dependencies) Metrics() domain.Metrics {
+	return d.metrics
+}
+
+// PushMetrics sends the API usage of the run to the Pushgateway of the config
+func (d *dependencies) PushMetrics(opts delivery.GlobalOptions) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return repository.PushMetrics(client, opts.Config.MetricsPushURL, opts.Config.MetricsJob, d.metrics)
+}
+
+// StartTrace begins the trace of the run of command when the OTEL_* environment variables name
+// an OTLP endpoint to export it to
+func (d *dependencies) StartTrace(opts delivery.GlobalOptions, command string) (domain.Span, error) {
+	tracingOpts, enabled, err := repository.TracingOptionsFromEnv(os.Getenv)
+	if err != nil || !enabled {
+		return domain.NopTracer{}, err
+	}
+	d.tracer = repository.NewOTLPTracer(&http.Client{Timeout: 10 * time.Second}, tracingOpts)
+	return d.tracer.StartRun("gpm "+command, "gpm.command", command), nil
+}
+
+// FlushTraces exports the spans of the run not sent yet
+func (d *dependencies) FlushTraces() error {
+	return d.tracer.Flush()
+}
+
+// rateLimiter returns the limiter shared by every client of the run, created on first use with
+// the configured rate
+func (d *dependencies) rateLimiter(opts delivery.GlobalOptions) *repository.RateLimiter {
+	d.limiterOnce.Do(func() {
+		d.limiter = repository.NewRateLimiter(opts.Config.MaxRPS, opts.Config.Burst)
+		d.limiter.SetMetrics(d.metrics)
+	})
+	return d.limiter
+}
+
+// photosOptions maps global flags to Google Photos repository options
+func (d *dependencies) photosOptions(opts delivery.GlobalOptions) repository.GooglePhotosOptions {
+	return repository.GooglePhotosOptions{
+		StrictDecoding: opts.StrictDecoding,
+		Logger:         opts.Logger,
+		Metrics:        d.metrics,
+	}
+}
+
+// albumRepository builds the album repository calling the API with client, which refuses changes
+// to the read-only albums of the config
+func (d *dependencies) albumRepository(client *http.Client, opts delivery.GlobalOptions) domain.AlbumRepository {
+	repo := repository.NewGooglePhotosRepositoryWithOptions(client, d.photosOptions(opts))
+	return repository.NewReadOnlyAlbumRepository(repo, opts.Config.ReadOnlyAlbums)
+}
+
+// mediaItemRepository builds the media item repository calling the API with client and
+// mediaOpts, which refuses to add uploads to the read-only albums of the config
+func (d *dependencies) mediaItemRepository(client *http.Client, mediaOpts repository.GooglePhotosOptions, opts delivery.GlobalOptions) domain.MediaItemRepository {
+	repo := repository.NewGooglePhotosMediaItemRepository(client, mediaOpts)
+	return repository.NewReadOnlyMediaItemRepository(repo, opts.Config.ReadOnlyAlbums)
+}
+
+// indexRepository returns the profile's local index, through the running daemon when one answers
+// on the control socket and from the database file otherwise
+func indexRepository(profile *domain.Profile, logger *slog.Logger) (repository.LocalIndex, error) {
+	indexPath := filepath.Join(profile.CacheDir, "index.db")
+	if index, ok := repository.ConnectControlSocket(controlSocketPath(profile), indexPath); ok {
+		logger.Debug("Using the local index of the running daemon")
+		return index, nil
+	}
+	return repository.NewBoltIndexRepository(indexPath)
+}
+
+// localIndex returns the uploaded files, recognized text and EXIF data kept beside the profile's
+// local index, through the running daemon when one answers on the control socket. Otherwise the
+// database is opened for each call only, so a command running for long, such as watch, does not
+// keep the others from it.
+func localIndex(profile *domain.Profile, logger *slog.Logger) repository.LocalIndex {
+	indexPath := filepath.Join(profile.CacheDir, "index.db")
+	if index, ok := repository.ConnectControlSocket(controlSocketPath(profile), indexPath); ok {
+		logger.Debug("Using the local index of the running daemon")
+		return index
+	}
+	return repository.NewSharedIndexRepository(indexPath)
+}
+
+// controlSocketPath is where the daemon of the profile listens for the commands sharing its index
+func controlSocketPath(profile *domain.Profile) string {
+	return filepath.Join(profile.CacheDir, "daemon.sock")
+}
+
+// throughputStore keeps the speed of downloads and uploads in the profile's cache, for the
+// remaining time of resumed jobs
+func throughputStore(profile *domain.Profile) domain.ThroughputStore {
+	return repository.NewFileThroughputStore(filepath.Join(profile.CacheDir, "throughput.json"))
+}
+
+// httpTransport builds the transport Google requests go out through, with the configured
+// connection timeouts and proxy
+func httpTransport(opts delivery.GlobalOptions) (http.RoundTripper, error) {
+	return repository.NewHTTPTransport(repository.TransportOptions{
+		DialTimeout:         opts.Config.DialTimeout,
+		TLSHandshakeTimeout: opts.Config.TLSTimeout,
+		Proxy:               opts.Config.Proxy,
+	})
+}
+
+// oauthOptions maps the configured scopes and callback address to OAuth repository options
+// sending token requests through transport
+func oauthOptions(opts delivery.GlobalOptions, transport http.RoundTripper) repository.OAuthOptions {
+	return repository.OAuthOptions{
+		Scopes:       opts.Config.Scopes,
+		CallbackAddr: opts.Config.CallbackAddr,
+		Transport:    transport,
+	}
+}
+
+// oauthService resolves the selected profile and builds its OAuth service
+func (d *dependencies) oauthService(opts delivery.GlobalOptions) (domain.OAuthService, error) {
+	profile, err := d.profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := httpTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewOAuthRepositoryWithOptions(*profile, oauthOptions(opts, transport))
+}
+
+// profile resolves the profile selected with --profile, falling back to the active one
+func (d *dependencies) profile(opts delivery.GlobalOptions) (*domain.Profile, error) {
+	profileUseCase, err := d.ProfileUseCase(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return profileUseCase.ResolveProfile(opts.Profile)
+}
+
+func main() {
+	cli := delivery.NewCLI(&dependencies{metrics: repository.NewMetrics()}, os.Stdout, os.Stderr)
+	os.Exit(cli.Run(os.Args[1:]))
+}
@@ -0,0 +1,562 @@
+package delivery
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+const (
+	// defaultThumbnailSize is the width and height of thumbnails when no size is given; uploads
+	// keep thumbnails of this size
+	defaultThumbnailSize = usecase.DefaultThumbnailSize
+	// defaultSearchLimit is the number of media items /media/search returns when no limit is given
+	defaultSearchLimit = 100
+	// maxSearchLimit caps the limit of /media/search
+	maxSearchLimit = 1000
+)
+
+// DefaultMaxUploadSize is the largest body of a POST /upload request when no other is given
+const DefaultMaxUploadSize = 4 << 30
+
+// APIServerOptions configures an APIServer
+type APIServerOptions struct {
+	// Token must be sent as "Authorization: Bearer TOKEN" with every request
+	Token string
+	// AllowOrigin lets a web front end served from this origin call the API; empty allows none
+	AllowOrigin string
+	// Upload configures uploads; the album fields are taken from each request instead
+	Upload usecase.UploadOptions
+	// MaxUploadSize is the largest body of an upload request in bytes, larger ones are answered
+	// with 413; 0 means DefaultMaxUploadSize
+	MaxUploadSize int64
+	// Metrics is served from /metrics for Prometheus; nil serves none
+	Metrics domain.Metrics
+	// Theme changes the look and layout of the web gallery; nil keeps the built-in one
+	Theme *GalleryTheme
+	// Index answers /media/search from memory; nil opens the local index for every request
+	Index *usecase.SessionIndex
+	// Exit shuts the server down and removes the files of uploads in flight as the run ends; nil
+	// leaves it to Serve and the requests
+	Exit domain.ExitHooks
+}
+
+// APIServer serves the use cases as JSON endpoints, for web front ends:
+//
+//	GET  /albums?pageSize=N&pageToken=TOKEN  a page of albums
+//	POST /albums                             {"title": "..."} creates an album
+//	GET  /albums/{id}                        a single album
+//	GET  /albums/{id}/media?pageSize=N&pageToken=TOKEN
+//	                                         a page of the media items in an album
+//	GET  /media/{id}/thumbnail?size=N        a square thumbnail, proxied so base URLs stay private
+//	GET  /media/search?album=ID&filename=TEXT&type=photo|video&sort=newest|oldest|filename&limit=N&offset=N
+//	                                         media items in the local index, newest first by default
+//	POST /upload                             multipart files, optionally with album or albumId
+//	GET  /metrics                            API usage in the Prometheus text format
+//
+// Failures are answered with {"error": "..."} and a status that matches the kind of failure;
+// failures of use cases also carry the code and hint of the error catalog.
+// The web gallery is served from /ui/ without a token; it asks for one to call the API.
+type APIServer struct {
+	albumUseCase   *usecase.AlbumUseCase
+	uploadUseCase  *usecase.UploadUseCase
+	galleryUseCase *usecase.GalleryUseCase
+	// indexUseCase opens the local index for one request, so the CLI can update it meanwhile
+	indexUseCase func() (*usecase.IndexUseCase, error)
+	opts         APIServerOptions
+	logger       *slog.Logger
+}
+
+// NewAPIServer creates a new instance of APIServer
+func NewAPIServer(albumUseCase *usecase.AlbumUseCase, uploadUseCase *usecase.UploadUseCase, galleryUseCase *usecase.GalleryUseCase, indexUseCase func() (*usecase.IndexUseCase, error), opts APIServerOptions) *APIServer {
+	return &APIServer{
+		albumUseCase:   albumUseCase,
+		uploadUseCase:  uploadUseCase,
+		galleryUseCase: galleryUseCase,
+		indexUseCase:   indexUseCase,
+		opts:           opts,
+		logger:         slog.Default(),
+	}
+}
+
+// SetLogger replaces the logger requests are logged to
+func (s *APIServer) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// Handler returns the routes wrapped in the request logging, CORS and authentication middleware;
+// only the web gallery's static files are served without a token
+func (s *APIServer) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /albums", s.handleListAlbums)
+	api.HandleFunc("POST /albums", s.handleCreateAlbum)
+	api.HandleFunc("GET /albums/{id}", s.handleGetAlbum)
+	api.HandleFunc("GET /albums/{id}/media", s.handleListAlbumMedia)
+	api.HandleFunc("GET /media/search", s.handleSearchMedia)
+	api.HandleFunc("GET /media/{id}/thumbnail", s.handleThumbnail)
+	api.HandleFunc("POST /upload", s.handleUpload)
+	if s.opts.Metrics != nil {
+		api.HandleFunc("GET /metrics", s.handleMetrics)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.requireToken(api))
+	mux.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	mux.Handle("GET /ui/", galleryHandler(s.opts.Theme))
+
+	return s.logRequests(s.allowOrigin(mux))
+}
+
+// Serve answers requests on l until ctx is cancelled, then stops accepting connections and
+// waits for the requests in flight to finish, for domain.ExitTimeout at most
+func (s *APIServer) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+	shutdown := domain.OnExit(s.opts.Exit, "shut down the API server", srv.Shutdown)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	select {
+	case err := <-served:
+		shutdown()
+		return err
+	case <-ctx.Done():
+	}
+	s.logger.Info("Shutting down, waiting for requests in flight")
+	return shutdown()
+}
+
+// handleListAlbums answers GET /albums with a page of albums
+func (s *APIServer) handleListAlbums(w http.ResponseWriter, r *http.Request) {
+	req, err := pageRequest(r, domain.MaxAlbumPageSize)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := s.albumUseCase.ListAlbums(r.Context(), req)
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Albums        []domain.Album `json:"albums"`
+		NextPageToken string         `json:"nextPageToken,omitempty"`
+	}{Albums: emptyIfNil(page.Items), NextPageToken: page.NextPageToken})
+}
+
+// handleCreateAlbum answers POST /albums with the album created for the title in the body
+func (s *APIServer) handleCreateAlbum(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("expected {\"title\": \"...\"}: %v", err))
+		return
+	}
+	if strings.TrimSpace(body.Title) == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("title is required"))
+		return
+	}
+
+	album, err := s.albumUseCase.CreateAlbum(r.Context(), strings.TrimSpace(body.Title))
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, album)
+}
+
+// handleGetAlbum answers GET /albums/{id}
+func (s *APIServer) handleGetAlbum(w http.ResponseWriter, r *http.Request) {
+	album, err := s.albumUseCase.GetAlbumByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, album)
+}
+
+// handleListAlbumMedia answers GET /albums/{id}/media with a page of the media items in an album
+func (s *APIServer) handleListAlbumMedia(w http.ResponseWriter, r *http.Request) {
+	req, err := pageRequest(r, domain.MaxMediaItemPageSize)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := s.galleryUseCase.ListAlbumMediaItems(r.PathValue("id"), req)
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		MediaItems    []domain.MediaItem `json:"mediaItems"`
+		NextPageToken string             `json:"nextPageToken,omitempty"`
+	}{MediaItems: emptyIfNil(page.Items), NextPageToken: page.NextPageToken})
+}
+
+// handleThumbnail answers GET /media/{id}/thumbnail with the image bytes, which browsers may keep
+// for a day; base URLs expire and would need the Google token, so the server fetches them
+func (s *APIServer) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	size, err := queryInt(r.URL.Query().Get("size"), defaultThumbnailSize, 1, usecase.MaxGalleryThumbnailSize)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid size: %v", err))
+		return
+	}
+
+	data, err := s.galleryUseCase.Thumbnail(r.PathValue("id"), size)
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = w.Write(data)
+}
+
+// handleSearchMedia answers GET /media/search from the local index
+func (s *APIServer) handleSearchMedia(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := usecase.IndexFilter{AlbumID: query.Get("album"), Filename: query.Get("filename"), Sort: usecase.IndexSort(query.Get("sort"))}
+	if value := query.Get("type"); value != "" {
+		t, err := domain.ParseMediaType(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.MediaType = t
+	}
+	limit, err := queryInt(query.Get("limit"), defaultSearchLimit, 1, maxSearchLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", err))
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0, 0, -1)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid offset: %v", err))
+		return
+	}
+
+	items, err := s.searchMediaItems(r.Context(), filter)
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	total := len(items)
+	items = items[min(offset, total):]
+	items = items[:min(limit, len(items))]
+	writeJSON(w, http.StatusOK, struct {
+		MediaItems []domain.MediaItem `json:"mediaItems"`
+		Total      int                `json:"total"`
+	}{MediaItems: emptyIfNil(items), Total: total})
+}
+
+// searchMediaItems searches the session index, or the local index when there is none
+func (s *APIServer) searchMediaItems(ctx context.Context, filter usecase.IndexFilter) ([]domain.MediaItem, error) {
+	if s.opts.Index != nil {
+		return s.opts.Index.SearchMediaItems(filter)
+	}
+	indexUseCase, err := s.indexUseCase()
+	if err != nil {
+		return nil, err
+	}
+	defer indexUseCase.Close()
+	return indexUseCase.SearchMediaItems(ctx, filter)
+}
+
+// handleUpload answers POST /upload. The files of a multipart form are saved to a temporary
+// directory and uploaded like media upload does; the album or albumId fields select the album.
+func (s *APIServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, cmp.Or(s.opts.MaxUploadSize, DefaultMaxUploadSize))
+	form, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("expected a multipart form: %v", err))
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "upload-*")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("failed to create temporary directory: %v", err))
+		return
+	}
+	defer domain.OnExit(s.opts.Exit, "remove "+dir, func(context.Context) error {
+		return os.RemoveAll(dir)
+	})()
+
+	opts := s.opts.Upload
+	files := 0
+	for {
+		part, err := form.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeUploadError(w, fmt.Errorf("failed to read multipart form: %w", err))
+			return
+		}
+
+		switch {
+		case part.FileName() != "":
+			err = saveUploadedFile(dir, files, part)
+			files++
+		case part.FormName() == "album":
+			opts.AlbumTitle, err = readFormValue(part)
+		case part.FormName() == "albumId":
+			opts.AlbumID, err = readFormValue(part)
+		}
+		part.Close()
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+	}
+	if files == 0 {
+		writeJSONError(w, http.StatusBadRequest, errors.New("no files in the form"))
+		return
+	}
+	if opts.AlbumTitle != "" && opts.AlbumID != "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("album cannot be combined with albumId"))
+		return
+	}
+
+	summary, err := s.uploadUseCase.UploadDirectory(r.Context(), os.DirFS(dir), opts)
+	if err != nil {
+		writeUseCaseError(w, err)
+		return
+	}
+	// Paths are reported as the file names of the form, without the directory of each file
+	for i := range summary.Results {
+		summary.Results[i].Path = formFileName(summary.Results[i].Path)
+	}
+	for i := range summary.Skipped {
+		summary.Skipped[i] = formFileName(summary.Skipped[i])
+	}
+	summary.Results = emptyIfNil(summary.Results)
+	summary.Skipped = emptyIfNil(summary.Skipped)
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleMetrics answers GET /metrics with the API usage of the server in the Prometheus text format
+func (s *APIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.opts.Metrics.WritePrometheus(w); err != nil {
+		s.logger.Warn("Failed to write metrics", "error", err)
+	}
+}
+
+// writeUploadError answers a form that could not be read with 400, or with 413 when it was
+// larger than MaxUploadSize
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload is larger than the limit of %d bytes", tooLarge.Limit))
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, err)
+}
+
+// saveUploadedFile writes a file of an upload form to dir under its base name. Every file gets
+// a directory of its own, named after its position in the form, so equal names do not clash.
+func saveUploadedFile(dir string, i int, part *multipart.Part) error {
+	name := path.Base(strings.ReplaceAll(part.FileName(), `\`, "/"))
+	if name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid file name %q", part.FileName())
+	}
+
+	fileDir := filepath.Join(dir, strconv.Itoa(i))
+	if err := os.Mkdir(fileDir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(fileDir, name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, part); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return f.Close()
+}
+
+// formFileName returns the name of a file saved by saveUploadedFile, relative to its directory
+func formFileName(name string) string {
+	_, file, _ := strings.Cut(name, "/")
+	return file
+}
+
+// readFormValue reads a short text field of a multipart form
+func readFormValue(part *multipart.Part) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(part, 1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", part.FormName(), err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// logRequests logs every request with its status and duration; scrapes of /metrics, which come
+// every few seconds, only at debug level
+func (s *APIServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		level := slog.LevelInfo
+		if r.URL.Path == "/metrics" && rec.status == http.StatusOK {
+			level = slog.LevelDebug
+		}
+		s.logger.Log(r.Context(), level, "Handled request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// allowOrigin adds the CORS headers for opts.AllowOrigin and answers preflight requests, which
+// carry no token
+func (s *APIServer) allowOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.AllowOrigin == "" || r.Header.Get("Origin") != s.opts.AllowOrigin {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", s.opts.AllowOrigin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireToken rejects requests without the bearer token of opts.Token
+func (s *APIServer) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gpm"`)
+			writeJSONError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records status before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// writeJSON writes v as the JSON body of a response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes err as {"error": "..."} with status, without the secrets it may quote
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: domain.RedactError(err).Error()})
+}
+
+// writeUseCaseError writes the error of a use case with the status that matches its kind and
+// its code and hint from the error catalog; failures of the Google API that are not the client's
+// doing are reported as a bad gateway
+func writeUseCaseError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *domain.APIError
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidArgument):
+		status = http.StatusBadRequest
+	case errors.Is(err, domain.ErrPermissionDenied), errors.Is(err, domain.ErrInsufficientScope), errors.Is(err, domain.ErrAlbumReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, domain.ErrRateLimited):
+		status = http.StatusTooManyRequests
+	case errors.As(err, &apiErr):
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, newErrorReport(err))
+}
+
+// pageRequest reads the pageSize and pageToken query parameters; the page size defaults to maxPageSize
+func pageRequest(r *http.Request, maxPageSize int) (domain.PageRequest, error) {
+	query := r.URL.Query()
+	pageSize, err := queryInt(query.Get("pageSize"), maxPageSize, 1, maxPageSize)
+	if err != nil {
+		return domain.PageRequest{}, fmt.Errorf("invalid pageSize: %v", err)
+	}
+	return domain.PageRequest{PageSize: pageSize, PageToken: query.Get("pageToken")}, nil
+}
+
+// queryInt parses a query parameter between lo and hi, or at least lo when hi is negative;
+// an empty value gives def
+func queryInt(value string, def, lo, hi int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("%q is not a number", value)
+	case n < lo || (hi >= 0 && n > hi):
+		if hi < 0 {
+			return 0, fmt.Errorf("%d must be at least %d", n, lo)
+		}
+		return 0, fmt.Errorf("%d must be between %d and %d", n, lo, hi)
+	}
+	return n, nil
+}
+
+// newAPIToken makes up a random bearer token
+func newAPIToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// emptyIfNil returns an empty slice for nil, so lists are written as [] rather than null
+func emptyIfNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
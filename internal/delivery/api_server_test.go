@@ -0,0 +1,406 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+	"krupesh.faldu/pkg/gphotos/gphotostest"
+)
+
+// newTestLibrary holds the writeable albums a1 Trip, of photo1 and photo2, and a2 Home
+func newTestLibrary() *gphotostest.Library {
+	lib := gphotostest.NewLibrary()
+	for _, id := range []string{"photo1", "photo2"} {
+		lib.AddMediaItem(domain.MediaItem{ID: id}, nil)
+	}
+	lib.AddAlbum(domain.Album{ID: "a1", Title: "Trip", IsWriteable: true}, "photo1", "photo2")
+	lib.AddAlbum(domain.Album{ID: "a2", Title: "Home", IsWriteable: true})
+	return lib
+}
+
+// stubMediaItemRepository records uploaded file contents and creates a media item for each; the
+// media items of album a1 are photo1 and photo2, and every photo serves its ID as thumbnail
+type stubMediaItemRepository struct {
+	domain.MediaItemRepository
+
+	mu        sync.Mutex
+	uploaded  []string
+	downloads int
+}
+
+func (r *stubMediaItemRepository) GetMediaItem(id string) (*domain.MediaItem, error) {
+	if !strings.HasPrefix(id, "photo") {
+		return nil, &domain.APIError{StatusCode: http.StatusNotFound, HTTPStatus: "404 Not Found", Status: "NOT_FOUND"}
+	}
+	return &domain.MediaItem{ID: id, BaseURL: "https://img/" + id}, nil
+}
+
+func (r *stubMediaItemRepository) SearchMediaItems(albumID string, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	if albumID != "a1" {
+		return &domain.Page[domain.MediaItem]{}, nil
+	}
+	return &domain.Page[domain.MediaItem]{Items: []domain.MediaItem{{ID: "photo1"}, {ID: "photo2"}}, NextPageToken: "p2"}, nil
+}
+
+func (r *stubMediaItemRepository) DownloadMediaItem(item domain.MediaItem, size domain.ImageSize) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downloads++
+	return io.NopCloser(strings.NewReader("\xff\xd8\xff" + item.ID)), nil
+}
+
+func (r *stubMediaItemRepository) Upload(fileName, mimeType string, content io.Reader, size int64) (string, error) {
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploaded = append(r.uploaded, fileName+"="+string(b))
+	return "token-" + string(b), nil
+}
+
+func (r *stubMediaItemRepository) BatchCreateMediaItems(albumID string, items []domain.NewMediaItem) ([]domain.NewMediaItemResult, error) {
+	results := make([]domain.NewMediaItemResult, len(items))
+	for i, item := range items {
+		results[i] = domain.NewMediaItemResult{UploadToken: item.UploadToken, MediaItem: &domain.MediaItem{ID: "m-" + item.UploadToken}}
+	}
+	return results, nil
+}
+
+// stubThumbnailCache keeps thumbnails in memory
+type stubThumbnailCache struct {
+	thumbs map[string][]byte
+}
+
+func (c *stubThumbnailCache) LoadThumbnail(mediaItemID string, size int) ([]byte, error) {
+	return c.thumbs[fmt.Sprint(mediaItemID, size)], nil
+}
+
+func (c *stubThumbnailCache) SaveThumbnail(mediaItemID string, size int, data []byte) error {
+	c.thumbs[fmt.Sprint(mediaItemID, size)] = data
+	return nil
+}
+
+// stubIndexRepository holds a built index in memory
+type stubIndexRepository struct {
+	snapshot domain.IndexSnapshot
+}
+
+func (r *stubIndexRepository) Load() (*domain.IndexSnapshot, error) {
+	return &r.snapshot, nil
+}
+
+func (r *stubIndexRepository) Replace(snapshot domain.IndexSnapshot) error {
+	r.snapshot = snapshot
+	return nil
+}
+
+func (r *stubIndexRepository) Stats() (*domain.IndexStats, error) {
+	return &domain.IndexStats{}, nil
+}
+
+func (r *stubIndexRepository) History() ([]domain.LibrarySnapshot, error) {
+	return nil, nil
+}
+
+func (r *stubIndexRepository) Close() error {
+	return nil
+}
+
+// newTestAPIServer serves the albums of lib, an index of three photos and uploads from memory
+func newTestAPIServer(lib *gphotostest.Library, mediaRepo *stubMediaItemRepository) http.Handler {
+	albumRepo := lib.Albums()
+	index := &stubIndexRepository{snapshot: domain.IndexSnapshot{UpdatedAt: time.Now()}}
+	for i, name := range []string{"beach.jpg", "dune.jpg", "city.jpg"} {
+		index.snapshot.MediaItems = append(index.snapshot.MediaItems, domain.MediaItem{
+			ID:            name,
+			Filename:      name,
+			MediaMetadata: &domain.MediaMetadata{CreationTime: time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)},
+		})
+	}
+
+	gallery := usecase.NewGalleryUseCase(mediaRepo, &stubThumbnailCache{thumbs: make(map[string][]byte)})
+	server := NewAPIServer(usecase.NewAlbumUseCase(albumRepo), usecase.NewUploadUseCase(mediaRepo, albumRepo), gallery, func() (*usecase.IndexUseCase, error) {
+		return usecase.NewIndexUseCase(albumRepo, mediaRepo, index), nil
+	}, APIServerOptions{Token: "secret", AllowOrigin: "http://ui.test"})
+	server.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return server.Handler()
+}
+
+// serve sends req to handler with the test token and returns the response
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIServer_Auth(t *testing.T) {
+	handler := newTestAPIServer(newTestLibrary(), &stubMediaItemRepository{})
+
+	for _, header := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/albums", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %q, got %d", header, rec.Code)
+		}
+	}
+
+	// Preflight requests of the allowed origin are answered without a token
+	req := httptest.NewRequest(http.MethodOptions, "/albums", nil)
+	req.Header.Set("Origin", "http://ui.test")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "http://ui.test" {
+		t.Errorf("Expected a preflight answer for the allowed origin, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestAPIServer_Albums(t *testing.T) {
+	handler := newTestAPIServer(newTestLibrary(), &stubMediaItemRepository{})
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/albums", nil))
+	var page struct {
+		Albums []domain.Album `json:"albums"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || rec.Code != http.StatusOK || len(page.Albums) != 2 {
+		t.Errorf("Expected two albums, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/albums/a2", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"title":"Home"`) {
+		t.Errorf("Expected album a2, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/albums/missing", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"error"`) || !strings.Contains(rec.Body.String(), `"code":"PHM-0404"`) {
+		t.Errorf("Expected 404 with an error and its code, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/albums?pageSize=many", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid page size, got %d", rec.Code)
+	}
+}
+
+func TestAPIServer_SearchMedia(t *testing.T) {
+	handler := newTestAPIServer(newTestLibrary(), &stubMediaItemRepository{})
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/media/search?type=photo&limit=1&offset=1", nil))
+
+	var result struct {
+		MediaItems []domain.MediaItem `json:"mediaItems"`
+		Total      int                `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Expected JSON, got %d %s", rec.Code, rec.Body)
+	}
+	// Newest first, so the second item is the one taken on the second day
+	if result.Total != 3 || len(result.MediaItems) != 1 || result.MediaItems[0].ID != "dune.jpg" {
+		t.Errorf("Expected dune.jpg of 3 items, got %+v", result)
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/media/search?sort=filename&limit=1", nil))
+	if !strings.Contains(rec.Body.String(), `"id":"beach.jpg"`) {
+		t.Errorf("Expected beach.jpg first by file name, got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, query := range []string{"type=audio", "limit=0", "offset=-1", "sort=size"} {
+		if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/media/search?"+query, nil)); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAPIServer_SearchMediaSessionIndex(t *testing.T) {
+	mediaRepo := &stubMediaItemRepository{}
+	albumRepo := gphotostest.NewLibrary().Albums()
+	index := usecase.NewSessionIndex(&domain.IndexSnapshot{MediaItems: []domain.MediaItem{{ID: "m1", Filename: "beach.jpg"}}, UpdatedAt: time.Now()})
+	server := NewAPIServer(usecase.NewAlbumUseCase(albumRepo), usecase.NewUploadUseCase(mediaRepo, albumRepo), usecase.NewGalleryUseCase(mediaRepo, &stubThumbnailCache{}), func() (*usecase.IndexUseCase, error) {
+		return nil, errors.New("the database must not be opened")
+	}, APIServerOptions{Token: "secret", Index: index})
+	server.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := server.Handler()
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/media/search?filename=BEACH", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total":1`) {
+		t.Errorf("Expected beach.jpg from memory, got %d %s", rec.Code, rec.Body)
+	}
+
+	index.Apply(usecase.ItemAdded{Item: domain.MediaItem{ID: "m2", Filename: "beach2.jpg"}})
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/media/search?filename=beach", nil))
+	if !strings.Contains(rec.Body.String(), `"total":2`) {
+		t.Errorf("Expected the media item added meanwhile, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAPIServer_Upload(t *testing.T) {
+	lib := newTestLibrary()
+	mediaRepo := &stubMediaItemRepository{}
+	handler := newTestAPIServer(lib, mediaRepo)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, content := range []string{"one", "two"} {
+		w, _ := form.CreateFormFile("file", "photo.jpg")
+		w.Write([]byte(content))
+	}
+	form.WriteField("album", "Trip")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	rec := serve(handler, req)
+
+	var summary usecase.UploadSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected an upload summary, got %d %s", rec.Code, rec.Body)
+	}
+	// Files with the same name are both uploaded, into the album created for them
+	if album, _ := lib.Album(summary.AlbumID); album.ID == "a1" || album.Title != "Trip" || len(summary.Results) != 2 || summary.Results[0].Path != "photo.jpg" || summary.Results[1].MediaItemID != "m-token-two" {
+		t.Errorf("Expected both files uploaded into the new album, got %+v", summary)
+	}
+	if len(mediaRepo.uploaded) != 2 {
+		t.Errorf("Expected 2 uploads, got %v", mediaRepo.uploaded)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if rec := serve(handler, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a request that is not a form, got %d", rec.Code)
+	}
+}
+
+func TestAPIServer_UploadTooLarge(t *testing.T) {
+	lib := newTestLibrary()
+	mediaRepo := &stubMediaItemRepository{}
+	server := NewAPIServer(usecase.NewAlbumUseCase(lib.Albums()), usecase.NewUploadUseCase(mediaRepo, lib.Albums()), nil, nil, APIServerOptions{Token: "secret", MaxUploadSize: 1024})
+	server.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	w, _ := form.CreateFormFile("file", "photo.jpg")
+	w.Write(bytes.Repeat([]byte("x"), 4096))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	rec := serve(server.Handler(), req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge || len(mediaRepo.uploaded) != 0 {
+		t.Errorf("Expected 413 and nothing uploaded, got %d %s (%v)", rec.Code, rec.Body, mediaRepo.uploaded)
+	}
+}
+
+func TestAPIServer_Gallery(t *testing.T) {
+	mediaRepo := &stubMediaItemRepository{}
+	handler := newTestAPIServer(newTestLibrary(), mediaRepo)
+
+	// The page and its files are served without a token
+	for _, path := range []string{"/ui/", "/ui/gallery.js", "/ui/gallery.css"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("Expected %s to be served with a content security policy, got %d", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/ui/" {
+		t.Errorf("Expected / to redirect to the gallery, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = serve(handler, httptest.NewRequest(http.MethodGet, "/albums/a1/media?pageSize=2", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"photo2"`) || !strings.Contains(rec.Body.String(), `"nextPageToken":"p2"`) {
+		t.Errorf("Expected a page of album a1, got %d %s", rec.Code, rec.Body)
+	}
+
+	for range 2 {
+		rec = serve(handler, httptest.NewRequest(http.MethodGet, "/media/photo1/thumbnail?size=64", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "\xff\xd8\xffphoto1" || rec.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("Expected the JPEG thumbnail, got %d %q %v", rec.Code, rec.Body, rec.Header())
+		}
+	}
+	// The second request is answered from the thumbnail cache
+	if mediaRepo.downloads != 1 {
+		t.Errorf("Expected 1 download, got %d", mediaRepo.downloads)
+	}
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/media/video/thumbnail", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown media item, got %d", rec.Code)
+	}
+	if rec := serve(handler, httptest.NewRequest(http.MethodGet, "/media/photo1/thumbnail?size=5000", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a size that is too large, got %d", rec.Code)
+	}
+}
+
+func TestGalleryTheme(t *testing.T) {
+	theme, err := LoadGalleryTheme(fstest.MapFS{
+		"theme.html":  {Data: []byte(`{{define "title"}}Family photos{{end}}{{define "head"}}<link rel="stylesheet" href="theme.css">{{end}}`)},
+		"theme.css":   {Data: []byte("body { color: teal }")},
+		"gallery.css": {Data: []byte("main { margin: 0 }")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to load theme: %v", err)
+	}
+	handler := galleryHandler(theme)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get("/ui/")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "<title>Family photos</title>") ||
+		!strings.Contains(body, `href="theme.css"`) || !strings.Contains(body, `id="albums"`) {
+		t.Errorf("Expected the page with the blocks of the theme, got %d %s", rec.Code, body)
+	}
+	if rec := get("/ui/gallery.css"); rec.Body.String() != "main { margin: 0 }" {
+		t.Errorf("Expected the theme to replace gallery.css, got %q", rec.Body)
+	}
+	if rec := get("/ui/theme.css"); rec.Code != http.StatusOK || rec.Header().Get("Content-Security-Policy") == "" {
+		t.Errorf("Expected the files of the theme to be served with a content security policy, got %d", rec.Code)
+	}
+	if rec := get("/ui/gallery.js"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the built-in gallery.js, got %d", rec.Code)
+	}
+	if rec := get("/ui/theme.html"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a template of the theme, got %d", rec.Code)
+	}
+
+	if _, err := LoadGalleryTheme(fstest.MapFS{"theme.html": {Data: []byte(`{{define "main"}}{{.Missing}}{{end}}`)}}); err == nil {
+		t.Error("Expected an error for a theme that fails to render")
+	}
+}
+
+func TestAPIServer_CreateAlbum(t *testing.T) {
+	handler := newTestAPIServer(newTestLibrary(), &stubMediaItemRepository{})
+
+	rec := serve(handler, httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{"title": " Trip "}`)))
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"title":"Trip"`) {
+		t.Errorf("Expected the created album, got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, body := range []string{`{"title": ""}`, `title=Trip`} {
+		if rec := serve(handler, httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(body))); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
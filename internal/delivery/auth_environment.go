@@ -0,0 +1,64 @@
+package delivery
+
+import (
+	"os"
+	"runtime"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// containerMarkers are files created by common container runtimes
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// DetectAuthEnvironment inspects the process environment to help choose an auth flow
+func DetectAuthEnvironment() domain.AuthEnvironment {
+	return domain.AuthEnvironment{
+		SSH:              anyEnvSet("SSH_CONNECTION", "SSH_CLIENT", "SSH_TTY"),
+		Display:          hasDisplay(),
+		Container:        inContainer(),
+		InteractiveInput: isTerminal(os.Stdin),
+	}
+}
+
+// hasDisplay reports whether a browser can be opened; only X11/Wayland sessions are checked
+// since macOS and Windows always have a graphical session for interactive users
+func hasDisplay() bool {
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return true
+	default:
+		return anyEnvSet("DISPLAY", "WAYLAND_DISPLAY")
+	}
+}
+
+// inContainer reports whether the process appears to run in a container or Kubernetes pod
+func inContainer() bool {
+	if anyEnvSet("KUBERNETES_SERVICE_HOST", "container") {
+		return true
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminal reports whether f is a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// anyEnvSet reports whether any of the environment variables is non-empty
+func anyEnvSet(names ...string) bool {
+	for _, name := range names {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,2698 @@
+package delivery
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+// Exit codes returned by CLI.Run
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// GlobalOptions holds the flags shared by every command
+type GlobalOptions struct {
+	Profile        string
+	ConfigPath     string
+	StrictDecoding bool
+	Output         OutputFormat
+	Verbose        bool
+	Quiet          bool
+	LogFormat      LogFormat
+	// MaxRPS replaces api.max_rps of the config when --max-rps is given
+	MaxRPS float64
+	// DebugHTTP logs every Google API call with its headers, secrets redacted; DebugHTTPBodies
+	// adds the text bodies of requests and responses
+	DebugHTTP       bool
+	DebugHTTPBodies bool
+	// PushMetrics replaces metrics.push_url of the config when --push-metrics is given
+	PushMetrics string
+	// Transcript is the file that a sanitized record of the run is written to, if any
+	Transcript string
+	// Logger is built from the logging flags once they are parsed
+	Logger *slog.Logger
+	// Progress shows the progress of uploads, downloads and syncs in the way that suits stderr
+	Progress domain.Progress
+	// transcript also receives the records of Logger, when --transcript is given
+	transcript *transcript
+	// shutdown cancels interruptible commands on Ctrl-C and cleans up after every command
+	shutdown *shutdown
+	// global holds the parsed global flags, which the commands of daemon jobs share
+	global *flag.FlagSet
+	// Config is loaded once a command has been found, so help works without a valid config
+	Config domain.Config
+}
+
+// ExitHooks returns what cleans up after the command, for the use cases and repositories it builds
+func (o GlobalOptions) ExitHooks() domain.ExitHooks {
+	if o.shutdown == nil {
+		return nil
+	}
+	return o.shutdown
+}
+
+// Dependencies lazily provides the use cases needed by CLI commands, so commands that
+// only manage local state (such as profiles) work before any authentication has happened
+type Dependencies interface {
+	// LoadConfig reads the config file and environment, honouring --config
+	LoadConfig(opts GlobalOptions) (domain.Config, error)
+	// LoadConfigFile reads only the config file, for changing it with SaveConfig
+	LoadConfigFile(opts GlobalOptions) (domain.Config, error)
+	// SaveConfig writes config to the file LoadConfig reads and returns its name
+	SaveConfig(opts GlobalOptions, config domain.Config) (string, error)
+	ProfileUseCase(opts GlobalOptions) (*usecase.ProfileUseCase, error)
+	OAuthUseCase(opts GlobalOptions) (*usecase.OAuthUseCase, error)
+	AlbumUseCase(opts GlobalOptions) (*usecase.AlbumUseCase, error)
+	SharingUseCase(opts GlobalOptions) (*usecase.SharingUseCase, error)
+	UploadUseCase(opts GlobalOptions) (*usecase.UploadUseCase, error)
+	// WatchUseCase is UploadUseCase recording uploaded files in the local index
+	WatchUseCase(opts GlobalOptions) (*usecase.UploadUseCase, error)
+	// FolderNotifier reports the changes below dir from the file system notifications of the OS
+	FolderNotifier(opts GlobalOptions, dir string) (domain.FolderNotifier, error)
+	AccountUseCase(opts GlobalOptions) (*usecase.AccountUseCase, error)
+	DownloadUseCase(opts GlobalOptions) (*usecase.DownloadUseCase, error)
+	IndexUseCase(opts GlobalOptions) (*usecase.IndexUseCase, error)
+	SyncUseCase(opts GlobalOptions) (*usecase.SyncUseCase, error)
+	DedupeUseCase(opts GlobalOptions) (*usecase.DedupeUseCase, error)
+	// MagicUseCase applies the magic album rules in the file at rulesPath
+	MagicUseCase(opts GlobalOptions, rulesPath string) (*usecase.MagicUseCase, error)
+	ContactSheetUseCase(opts GlobalOptions) (*usecase.ContactSheetUseCase, error)
+	GalleryUseCase(opts GlobalOptions) (*usecase.GalleryUseCase, error)
+	LayoutUseCase(opts GlobalOptions) (*usecase.LayoutUseCase, error)
+	// ReelUseCase assembles highlight reels with the ffmpeg binary at ffmpegPath
+	ReelUseCase(opts GlobalOptions, ffmpegPath string) (*usecase.ReelUseCase, error)
+	// ThumbnailUseCase makes thumbnails of local photos with the vipsthumbnail binary at
+	// vipsPath, or with the image decoders of Go when it is empty
+	ThumbnailUseCase(opts GlobalOptions, vipsPath string) (*usecase.ThumbnailUseCase, error)
+	// OCRUseCase reads text into the local index with the tesseract binary at tesseractPath and
+	// the trained data of lang; it needs no login
+	OCRUseCase(opts GlobalOptions, tesseractPath, lang string) (*usecase.OCRUseCase, error)
+	DescribeUseCase(opts GlobalOptions) (*usecase.DescribeUseCase, error)
+	// DaemonUseCase keeps the status of daemon jobs in the cache of the profile
+	DaemonUseCase(opts GlobalOptions) (*usecase.DaemonUseCase, error)
+	// ListenControlSocket shares the local index of the profile over the control socket of the
+	// daemon until the result is closed; commands started meanwhile use it instead of opening the
+	// index themselves
+	ListenControlSocket(opts GlobalOptions) (io.Closer, error)
+	// BackupUseCase copies the library to target, an s3:// or gs:// URL or a directory
+	BackupUseCase(opts GlobalOptions, target string) (*usecase.BackupUseCase, error)
+	// ConfigSchema describes the config file as a JSON Schema
+	ConfigSchema() map[string]any
+	// Metrics returns the API usage of the run so far
+	Metrics() domain.Metrics
+	// PushMetrics sends the API usage of the run to the Pushgateway of opts.Config
+	PushMetrics(opts GlobalOptions) error
+	// StartTrace begins the trace of the run of command, whose span ends with the run
+	StartTrace(opts GlobalOptions, command string) (domain.Span, error)
+	// FlushTraces exports the spans of the run not sent yet
+	FlushTraces() error
+}
+
+// usageError reports invalid command-line usage and maps to ExitUsage
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// Is makes usage errors match domain.ErrUsage, which gives them their code in the error catalog
+func (e *usageError) Is(target error) bool {
+	return target == domain.ErrUsage
+}
+
+// command describes a single CLI subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error
+	// ownConfig commands run without the config being loaded first, so they work with a broken one
+	ownConfig bool
+	// access are the kinds of access to the library the command needs, if any
+	access []domain.Access
+	// flagAccess returns the kinds of access needed on top of access for the flags given
+	flagAccess func(fs *flag.FlagSet) []domain.Access
+}
+
+// accesses returns every kind of access the command needs with the flags of fs, from the narrowest
+func (cmd command) accesses(fs *flag.FlagSet) []domain.Access {
+	needed := cmd.access
+	if cmd.flagAccess != nil {
+		needed = append(slices.Clone(needed), cmd.flagAccess(fs)...)
+	}
+	var accesses []domain.Access
+	for _, access := range domain.Accesses {
+		if slices.Contains(needed, access) {
+			accesses = append(accesses, access)
+		}
+	}
+	return accesses
+}
+
+// whenGiven returns a flagAccess needing accesses when the flag name is given other than empty
+// or false
+func whenGiven(name string, accesses ...domain.Access) func(fs *flag.FlagSet) []domain.Access {
+	return func(fs *flag.FlagSet) []domain.Access {
+		if f := fs.Lookup(name); f != nil && flagSet(fs, name) && f.Value.String() != "" && f.Value.String() != "false" {
+			return accesses
+		}
+		return nil
+	}
+}
+
+// commandGroup groups related subcommands under a common noun, e.g. "albums"
+type commandGroup struct {
+	name     string
+	summary  string
+	commands []command
+}
+
+// CLI parses command-line arguments and dispatches them to CLIHandler methods.
+// Command results are written to stdout; logs, usage and errors go to stderr. Errors carry the
+// code and remediation hint of the error catalog, and with JSON output go to stdout as well.
+type CLI struct {
+	deps   Dependencies
+	stdout io.Writer
+	stderr io.Writer
+	groups []commandGroup
+}
+
+// NewCLI creates a new instance of CLI
+func NewCLI(deps Dependencies, stdout, stderr io.Writer) *CLI {
+	c := &CLI{
+		deps:   deps,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	c.groups = c.commandGroups()
+	return c
+}
+
+// Run executes the command described by args (without the program name) and returns an exit code
+func (c *CLI) Run(args []string) int {
+	opts := GlobalOptions{Output: OutputTable, LogFormat: LogText}
+
+	global := flag.NewFlagSet("app", flag.ContinueOnError)
+	global.SetOutput(c.stderr)
+	global.StringVar(&opts.Profile, "profile", "", "profile to use (defaults to the active profile)")
+	global.StringVar(&opts.ConfigPath, "config", "", "config `file` (defaults to $GPM_CONFIG, then gpm.yaml if it exists)")
+	global.BoolVar(&opts.StrictDecoding, "strict-decoding", false, "fail on API response fields unknown to this version (for canary runs)")
+	global.Float64Var(&opts.MaxRPS, "max-rps", 0, "most API requests a second over the whole run, 0 for no limit (defaults to api.max_rps of the config)")
+	global.Var(&opts.Output, "output", "result `format`: table, json or csv")
+	global.BoolVar(&opts.Verbose, "verbose", false, "also log debug details such as raw API responses")
+	global.BoolVar(&opts.Quiet, "quiet", false, "only log warnings and errors")
+	global.Var(&opts.LogFormat, "log-format", "log `format` on stderr: text or json")
+	global.BoolVar(&opts.DebugHTTP, "debug-http", false, "log every API call with its URL, headers, status and latency, secrets redacted")
+	global.BoolVar(&opts.DebugHTTPBodies, "debug-http-bodies", false, "like --debug-http, also logging the text bodies of requests and responses")
+	global.StringVar(&opts.PushMetrics, "push-metrics", "", "push the API metrics of commands calling the API to the Prometheus Pushgateway at `URL` as they exit (defaults to metrics.push_url of the config)")
+	global.StringVar(&opts.Transcript, "transcript", "", "write a record of the run with secrets removed to `file`, for bug reports")
+	global.Usage = func() { c.printUsage(global) }
+
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if opts.Verbose && opts.Quiet {
+		fmt.Fprintf(c.stderr, "--verbose and --quiet cannot be combined\n")
+		return ExitUsage
+	}
+	if opts.DebugHTTPBodies {
+		opts.DebugHTTP = true
+	}
+	if opts.DebugHTTP && opts.Quiet {
+		fmt.Fprintf(c.stderr, "--debug-http and --quiet cannot be combined\n")
+		return ExitUsage
+	}
+	if opts.MaxRPS < 0 {
+		fmt.Fprintf(c.stderr, "--max-rps must not be negative\n")
+		return ExitUsage
+	}
+	// On a terminal, logs are printed above the progress bar
+	stderr, status := c.stderr, (*statusLine)(nil)
+	if f, ok := c.stderr.(*os.File); ok && isTerminal(f) {
+		status = &statusLine{w: c.stderr}
+		stderr = status
+	}
+	opts.Logger = newLogger(stderr, opts)
+	if opts.Transcript != "" {
+		t, err := openTranscript(opts.Transcript)
+		if err != nil {
+			c.reportError(opts, err)
+			return ExitError
+		}
+		t.start(args)
+		opts.Logger, opts.transcript = t.tee(opts.Logger), t
+	}
+	opts.Progress = newProgress(status, opts)
+	opts.shutdown = &shutdown{}
+	opts.global = global
+
+	code, err := c.runCommand(global, global.Args(), opts)
+	opts.shutdown.run(opts.Logger)
+	if opts.transcript != nil {
+		if err := opts.transcript.finish(code, err); err != nil {
+			fmt.Fprintf(c.stderr, "Error: %v\n", domain.RedactError(err))
+		}
+	}
+	return code
+}
+
+// runCommand finds and runs the command named by rest, the arguments left after the global flags.
+// It returns the exit code along with the error reported, if any.
+func (c *CLI) runCommand(global *flag.FlagSet, rest []string, opts GlobalOptions) (int, error) {
+	if len(rest) == 0 || rest[0] == "help" {
+		c.printUsage(global)
+		if len(rest) == 0 {
+			return ExitUsage, nil
+		}
+		return ExitOK, nil
+	}
+
+	group := c.findGroup(rest[0])
+	if group == nil {
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n", rest[0])
+		c.printUsage(global)
+		return ExitUsage, nil
+	}
+
+	// Groups without subcommands, such as serve, take their flags right after the group name
+	cmd, name, cmdArgs := group.standalone(), group.name, rest[1:]
+	if cmd == nil {
+		if len(rest) < 2 || rest[1] == "help" || rest[1] == "-h" || rest[1] == "--help" {
+			c.printGroupUsage(group)
+			if len(rest) < 2 {
+				return ExitUsage, nil
+			}
+			return ExitOK, nil
+		}
+
+		if cmd = group.findCommand(rest[1]); cmd == nil {
+			fmt.Fprintf(c.stderr, "unknown command %q for %q\n\n", rest[1], group.name)
+			c.printGroupUsage(group)
+			return ExitUsage, nil
+		}
+		name, cmdArgs = group.name+" "+cmd.name, rest[2:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: app %s %s\n\n%s\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	if !cmd.ownConfig {
+		config, err := c.deps.LoadConfig(opts)
+		if err != nil {
+			c.reportError(opts, err)
+			return ExitError, err
+		}
+		opts.Config = config
+		if config.Output != "" && !flagSet(global, "output") {
+			opts.Output = OutputFormat(config.Output)
+		}
+		if flagSet(global, "max-rps") {
+			opts.Config.MaxRPS = opts.MaxRPS
+		}
+		if flagSet(global, "push-metrics") {
+			opts.Config.MetricsPushURL = opts.PushMetrics
+		}
+	}
+
+	// Commands register their flags before parsing and return the action to execute
+	action := cmd.run(c, opts, fs)
+	if name == group.name && len(cmdArgs) > 0 && cmdArgs[0] == "help" {
+		fs.Usage()
+		return ExitOK, nil
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK, nil
+		}
+		return ExitUsage, err
+	}
+
+	span, err := c.deps.StartTrace(opts, name)
+	if err != nil {
+		c.reportError(opts, err)
+		return ExitError, err
+	}
+	// Only commands calling the API have metrics worth replacing the previous push with
+	accesses := cmd.accesses(fs)
+	if opts.Config.MetricsPushURL != "" && len(accesses) > 0 {
+		opts.shutdown.OnExit("push metrics to "+opts.Config.MetricsPushURL, func(context.Context) error {
+			return c.deps.PushMetrics(opts)
+		})
+	}
+	opts.shutdown.OnExit("export traces", func(context.Context) error {
+		return c.deps.FlushTraces()
+	})
+	err = c.ensureAccess(opts, name, accesses)
+	if err == nil {
+		err = action()
+	}
+	span.End(err)
+
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return ExitOK, nil
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(c.stderr, "%v\n\n", err)
+		fs.Usage()
+		c.writeJSONError(opts, err)
+		return ExitUsage, err
+	default:
+		c.reportError(opts, err)
+		return ExitError, err
+	}
+}
+
+// reportError prints the failure of a command with its code and hint from the error catalog
+func (c *CLI) reportError(opts GlobalOptions, err error) {
+	entry := domain.ClassifyError(err)
+	fmt.Fprintf(c.stderr, "Error: %v [%s]\n", domain.RedactError(err), entry.Code)
+	fmt.Fprintf(c.stderr, "Hint: %s\n", entry.Hint)
+	c.writeJSONError(opts, err)
+}
+
+// writeJSONError writes the failure of a command to stdout with JSON output, so scripts read it
+// after any partial results
+func (c *CLI) writeJSONError(opts GlobalOptions, err error) {
+	if opts.Output != OutputJSON {
+		return
+	}
+	if err := NewFormatter(c.stdout, opts.Output).WriteError(err); err != nil {
+		fmt.Fprintf(c.stderr, "Error: %v\n", err)
+	}
+}
+
+// commandGroups defines every command supported by the CLI
+func (c *CLI) commandGroups() []commandGroup {
+	return []commandGroup{
+		{
+			name:    "account",
+			summary: "Show the Google account in use",
+			commands: []command{
+				{name: "info", summary: "Show the account identity, granted scopes and token expiry", run: runAccountInfo},
+			},
+		},
+		{
+			name:    "albums",
+			summary: "Manage Google Photos albums",
+			commands: []command{
+				{name: "list", args: "[--all [--prefetch] | --local] [--page-size N] [--page-token TOKEN] [--fields FIELDS]", summary: "List albums", run: runAlbumsList, access: []domain.Access{domain.AccessRead}},
+				{name: "get", args: "[--fields FIELDS] <album-id>", summary: "Show a single album", run: runAlbumsGet, access: []domain.Access{domain.AccessRead}},
+				{name: "find", args: "[--match regex|substring|exact] [--ignore-case] [--exclude-shared] [--app-created-only] <pattern>", summary: "List the albums whose title matches a pattern", run: runAlbumsFind, access: []domain.Access{domain.AccessRead}},
+				{name: "create", args: "[--title TITLE] [--app-created-only] [--force-new]", summary: "Create an app-owned album unless one with the title exists", run: runAlbumsCreate, access: []domain.Access{domain.AccessUpload}, flagAccess: func(fs *flag.FlagSet) []domain.Access {
+					// Looking for an album of the title lists albums, which creating one does not need
+					if fs.Lookup("title").Value.String() != "" && fs.Lookup("force-new").Value.String() != "true" {
+						return []domain.Access{domain.AccessRead}
+					}
+					return nil
+				}},
+				{name: "rename", args: "<album-id> <title>", summary: "Change the title of an app-owned album", run: runAlbumsRename, access: []domain.Access{domain.AccessEdit}},
+				{name: "set-cover", args: "<album-id> <media-item-id>", summary: "Use a media item in the album as its cover photo", run: runAlbumsSetCover, access: []domain.Access{domain.AccessEdit}},
+				{name: "add-items", args: "<album-id> <media-item-id>...", summary: "Add media items to an app-owned album", run: runAlbumsAddItems, access: []domain.Access{domain.AccessEdit}},
+				{name: "remove-items", args: "<album-id> <media-item-id>...", summary: "Remove media items from an app-owned album", run: runAlbumsRemoveItems, access: []domain.Access{domain.AccessEdit}},
+				{name: "share", args: "[--collaborative] [--commentable] [--qr] <album-id>", summary: "Share an app-owned album and print its link", run: runAlbumsShare, access: []domain.Access{domain.AccessShare}},
+				{name: "share-options", args: "[--collaborative=true|false] [--commentable=true|false] [--qr] <album-id>", summary: "Change the options of a shared app-owned album, keeping its link", run: runAlbumsShareOptions, access: []domain.Access{domain.AccessShare}},
+				{name: "unshare", args: "<album-id>", summary: "Make a shared album private", run: runAlbumsUnshare, access: []domain.Access{domain.AccessShare}},
+			},
+		},
+		{
+			name:    "auth",
+			summary: "Authenticate with Google",
+			commands: []command{
+				{name: "login", args: "[--auth-flow FLOW] [--timeout DURATION] [--qr] [--access LIST]", summary: "Authorize access to Google Photos", run: runAuthLogin},
+			},
+		},
+		{
+			name:    "backup",
+			summary: "Copy originals to S3, GCS or a local disk",
+			commands: []command{
+				{name: "run", args: "--to TARGET [--album ID] [--workers N]", summary: "Copy the originals missing from the target, resuming an interrupted backup", run: runBackupRun, access: []domain.Access{domain.AccessRead}},
+				{name: "status", args: "--to TARGET", summary: "Show how many media items the target holds and when it was last backed up to", run: runBackupStatus, access: []domain.Access{domain.AccessRead}},
+			},
+		},
+		{
+			name:    "config",
+			summary: "Check the config file",
+			commands: []command{
+				{name: "validate", args: "[FILE]", summary: "Report every unknown key and invalid value of the config file and GPM_* variables", run: runConfigValidate, ownConfig: true},
+				{name: "schema", summary: "Print the JSON Schema of the config file for editors", run: runConfigSchema, ownConfig: true},
+			},
+		},
+		{
+			name:    "daemon",
+			summary: "Run commands on schedules, for unattended use such as on a NAS",
+			commands: []command{
+				{name: "run", args: "[--log-dir DIR] [--log-max-size MB] [--log-keep N]", summary: "Run the jobs of daemon.jobs in the config on their schedules until SIGTERM or Ctrl-C", run: runDaemonRun},
+				{name: "status", summary: "Show when each daemon job last ran, how it ended and when it runs next", run: runDaemonStatus},
+			},
+		},
+		{
+			name:    "dedupe",
+			summary: "Find duplicate photos and videos in the local index",
+			commands: []command{
+				{name: "find", args: "[--method metadata|content] [--workers N] [--review [--review-album TITLE]]", summary: "Report groups of likely duplicates", run: runDedupeFind, access: []domain.Access{domain.AccessRead}, flagAccess: whenGiven("review", domain.AccessUpload, domain.AccessEdit)},
+			},
+		},
+		{
+			name:    "download",
+			summary: "Download photos and videos to disk",
+			commands: []command{
+				{name: "album", args: "[--dir DIR] [--workers N] [--max-width W] [--max-height H] <album-id>", summary: "Download every media item of an album", run: runDownloadAlbum, access: []domain.Access{domain.AccessRead}},
+				{name: "item", args: "[--dir DIR] [--max-width W] [--max-height H] <media-item-id>", summary: "Download a single media item", run: runDownloadItem, access: []domain.Access{domain.AccessRead}},
+				{name: "print", args: "[--dir DIR] [--sizes 4x6,5x7] [--min-dpi N] [--workers N] <album-id>", summary: "Crop an album's photos to print sizes and report the ones too low-res", run: runDownloadPrint, access: []domain.Access{domain.AccessRead}},
+			},
+		},
+		{
+			name:    "export",
+			summary: "Archive albums to portable files",
+			commands: []command{
+				{name: "album", args: "--out FILE [--originals] [--workers N] <album-id>", summary: "Write an album's metadata, and with --originals its files, to a .zip, .tar or .tar.gz archive", run: runExportAlbum, access: []domain.Access{domain.AccessRead}},
+			},
+		},
+		{
+			name:    "import",
+			summary: "Bring photos in from exports of other services",
+			commands: []command{
+				{name: "takeout", args: "[--workers N] [--dry-run] <dir>", summary: "Upload an extracted Google Takeout export, rebuilding its albums and descriptions", run: runImportTakeout, access: []domain.Access{domain.AccessRead, domain.AccessUpload}},
+			},
+		},
+		{
+			name:    "index",
+			summary: "Mirror album and media item metadata locally",
+			commands: []command{
+				{name: "build", summary: "Fetch all metadata and replace the local index", run: runIndexBuild, access: []domain.Access{domain.AccessRead}},
+				{name: "update", summary: "Refresh the local index, only re-reading albums that changed", run: runIndexUpdate, access: []domain.Access{domain.AccessRead}},
+				{name: "status", summary: "Show what the local index holds and when it was updated", run: runIndexStatus},
+				{name: "search", args: "[--album ID] [--filename TEXT] [--type photo|video]", summary: "Search media items in the local index", run: runIndexSearch},
+				{name: "ocr", args: "--dir DIR [--workers N] [--lang LANG] [--tesseract PATH]", summary: "Read the text of exported screenshots and documents into the local index with tesseract", run: runIndexOCR},
+				{name: "search-text", args: "<word>...", summary: "Find the files read by index ocr whose text holds every word", run: runIndexSearchText},
+			},
+		},
+		{
+			name:    "init",
+			summary: "Set up the config file, log in and schedule syncs interactively",
+			commands: []command{
+				{summary: "Ask for the settings a first run needs, write a validated config file, then offer to log in and print a crontab line for sync run", run: runInit, ownConfig: true},
+			},
+		},
+		{
+			name:    "magic",
+			summary: "Populate app-owned albums from rules",
+			commands: []command{
+				{name: "apply", args: "--config FILE [--dry-run]", summary: "Create each rule's album and add the matching media items it lacks", run: runMagicApply, access: []domain.Access{domain.AccessRead, domain.AccessUpload, domain.AccessEdit}},
+			},
+		},
+		{
+			name:    "media",
+			summary: "Manage photos and videos",
+			commands: []command{
+				{name: "upload", args: "--dir DIR [--album TITLE | --album-id ID] [--workers N] [--fix-dates OFFSET] [--fix-dates-zone FROM:TO] [--fix-dates-except GLOB,...] [--infer-dates] [--description TMPL] [--preview]", summary: "Upload every photo and video in a directory tree", run: runMediaUpload, access: []domain.Access{domain.AccessUpload}, flagAccess: whenGiven("album", domain.AccessRead)},
+				{name: "describe", args: "(--text TEXT | --template TMPL) (--album ID | <media-item-id>...) [--only-empty] [--dry-run] [--workers N]", summary: "Set the descriptions of app-created media items, the same text or one made from each item", run: runMediaDescribe, access: []domain.Access{domain.AccessRead, domain.AccessEdit}},
+				{name: "thumbnails", args: "--dir DIR [--out DIR] [--size PX] [--workers N] [--thumbnailer go|vips] [--vips PATH]", summary: "Make JPEG thumbnails of the photos in a directory tree without contacting Google", run: runMediaThumbnails},
+			},
+		},
+		{
+			name:    "plan",
+			summary: "Plan large jobs before running them",
+			commands: []command{
+				{name: "quota", args: "[--items N] [--albums N] [--workers N] [--latency D] [--item-mb N] [--mbps N] [--daily-quota N] [--media-quota N] [--to TARGET] <export|download|backup|index|upload|import>", summary: "Estimate the API calls of a pipeline, how long they take under the rate limit and the days the quotas stretch them over", run: runPlanQuota},
+			},
+		},
+		{
+			name:    "render",
+			summary: "Render albums as images and documents",
+			commands: []command{
+				{name: "contact-sheet", args: "[--dir DIR] [--format png|jpeg|pdf] [--columns N] [--rows N] [--thumbnail-size PX] [--workers N] <album-id>", summary: "Lay out an album's thumbnails with captions on pages", run: runRenderContactSheet, access: []domain.Access{domain.AccessRead}},
+				{name: "calendar", args: "[--year YEAR] [--paper a4|letter|WxH] [--sunday-first] [--title TITLE] [--out FILE] <album-id>...", summary: "Make a print-ready PDF year calendar with a photo for every month", run: runRenderCalendar, access: []domain.Access{domain.AccessRead}},
+				{name: "reel", args: "(--album ID | --from DATE --to DATE) [--out FILE] [--max N] [--photo-duration D] [--clip-duration D] [--size WxH] [--ffmpeg PATH] [--upload]", summary: "Assemble photos and videos into a highlight reel video with ffmpeg", run: runRenderReel, access: []domain.Access{domain.AccessRead}, flagAccess: whenGiven("upload", domain.AccessUpload)},
+				{name: "photo-book", args: "[--layout single|two|grid] [--months YYYY-MM,...] [--paper a4|letter|WxH] [--title TITLE] [--out FILE] <album-id>...", summary: "Make a print-ready PDF photo book from albums", run: runRenderPhotoBook, access: []domain.Access{domain.AccessRead}},
+			},
+		},
+		{
+			name:    "report",
+			summary: "Report on the library",
+			commands: []command{
+				{name: "categories", args: "[--categories LIST] [--samples N]", summary: "Count the media items of each content category, to find clutter such as screenshots", run: runReportCategories, access: []domain.Access{domain.AccessRead}},
+				{name: "overlap", args: "[--min-shared N] [--albums N] [--matrix] [--heatmap FILE]", summary: "List albums sharing media items, as pairs or a matrix, to consolidate redundant ones", run: runReportOverlap},
+				{name: "growth", args: "[--months N] [--model linear|seasonal] [--photo-mb N] [--video-mb N] [--used-gb N] [--monthly]", summary: "Forecast library growth and when it outgrows each Google One storage tier", run: runReportGrowth},
+			},
+		},
+		{
+			name:    "restore",
+			summary: "Rebuild albums from archives written by export",
+			commands: []command{
+				{name: "album", args: "[--workers N] [--dry-run] <archive>", summary: "Create the album of an export archive and upload its originals into it", run: runRestoreAlbum, access: []domain.Access{domain.AccessRead, domain.AccessUpload}},
+			},
+		},
+		{
+			name:    "search",
+			summary: "Search the library by example",
+			commands: []command{
+				{name: "similar", args: "[--dir DIR] [--limit N] [--max-distance D] [--workers N] <file>", summary: "Find indexed photos, or exported ones in --dir, that look like an image", run: runSearchSimilar, access: []domain.Access{domain.AccessRead}},
+			},
+		},
+		{
+			name:    "serve",
+			summary: "Serve albums, search and uploads as a JSON API and a web gallery",
+			commands: []command{
+				{args: "[--addr ADDR] [--token TOKEN] [--allow-origin ORIGIN] [--workers N] [--theme DIR] [--prefetch N] [--max-upload-size MB]", summary: "Serve the JSON API and the web gallery at /ui/ until interrupted", run: runServe, access: []domain.Access{domain.AccessRead, domain.AccessUpload, domain.AccessEdit}},
+			},
+		},
+		{
+			name:    "shared",
+			summary: "Manage shared albums",
+			commands: []command{
+				{name: "list", args: "[--all] [--page-size N] [--page-token TOKEN]", summary: "List albums shared with or by you", run: runSharedList, access: []domain.Access{domain.AccessShare}},
+				{name: "join", args: "<share-token>", summary: "Join a shared album", run: runSharedJoin, access: []domain.Access{domain.AccessShare}},
+				{name: "leave", args: "<share-token>", summary: "Leave a joined shared album", run: runSharedLeave, access: []domain.Access{domain.AccessShare}},
+			},
+		},
+		{
+			name:    "shares",
+			summary: "Audit what the account shares",
+			commands: []command{
+				{name: "list", summary: "List every album you share with its link, options and item count", run: runSharesList, access: []domain.Access{domain.AccessShare}},
+			},
+		},
+		{
+			name:    "stats",
+			summary: "Summarize the library",
+			commands: []command{
+				{args: "[--live] [--top N]", summary: "Count media items by type, year, album and camera and list the largest videos", run: runStats, flagAccess: whenGiven("live", domain.AccessRead)},
+			},
+		},
+		{
+			name:    "sync",
+			summary: "Keep the local index and originals in step with the library",
+			commands: []command{
+				{name: "run", args: "[--full] [--full-every DURATION] [--dir DIR [--workers N] [--prune] [--remap-root OLD=NEW]]", summary: "Sync changes since the last run and print what changed", run: runSyncRun, access: []domain.Access{domain.AccessRead}},
+				{name: "status", summary: "Show the sync watermark and when the last runs happened", run: runSyncStatus},
+			},
+		},
+		{
+			name:    "tui",
+			summary: "Browse albums and media items in the terminal",
+			commands: []command{
+				{args: "[--dir DIR] [--prefetch N]", summary: "Browse albums and their media items in panes, creating, renaming, downloading and adding to albums with single keys", run: runTUI, access: []domain.Access{domain.AccessRead, domain.AccessUpload, domain.AccessEdit}},
+			},
+		},
+		{
+			name:    "verify-mirror",
+			summary: "Check the originals mirrored by sync for corruption",
+			commands: []command{
+				{args: "[--workers N] [--all] [DIR]", summary: "Hash the mirror of originals again and report files that are corrupt, missing or unknown to sync", run: runVerifyMirror},
+			},
+		},
+		{
+			name:    "watch",
+			summary: "Upload new photos as they appear in a folder",
+			commands: []command{
+				{args: "--dir DIR [--album TITLE | --album-id ID] [--poll] [--interval D] [--settle D] [--workers N]", summary: "Watch a folder until interrupted, uploading every photo and video once it is completely written", run: runWatch, access: []domain.Access{domain.AccessUpload}, flagAccess: whenGiven("album", domain.AccessRead)},
+			},
+		},
+		{
+			name:    "profiles",
+			summary: "Manage account profiles",
+			commands: []command{
+				{name: "list", summary: "List profiles", run: runProfilesList},
+				{name: "add", args: "<name>", summary: "Create a profile", run: runProfilesAdd},
+				{name: "switch", args: "<name>", summary: "Make a profile active", run: runProfilesSwitch},
+				{name: "remove", args: "<name>", summary: "Delete a profile and its token", run: runProfilesRemove},
+			},
+		},
+	}
+}
+
+func runAccountInfo(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		accountUseCase, err := c.deps.AccountUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Account: accountUseCase})
+		return h.HandleAccountInfo(context.Background())
+	}
+}
+
+func runAlbumsList(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	req := pageFlags(fs)
+	all := fs.Bool("all", false, "follow page tokens and list every album")
+	prefetch := fs.Bool("prefetch", false, "with --all, fetch the next page while the current one is handled")
+	local := fs.Bool("local", false, "list albums from the local index instead of the API")
+	fields := fieldsFlag(fs, "album", "id,title,mediaItemsCount")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if err := domain.ValidateFields(*fields); err != nil {
+			return &usageError{msg: fmt.Sprintf("invalid --fields: %v", err)}
+		}
+		// --all takes the page size of its requests, but always starts from the first page
+		if *all && req.PageToken != "" {
+			return &usageError{msg: "--all cannot be combined with --page-token"}
+		}
+		if *prefetch && !*all {
+			return &usageError{msg: "--prefetch needs --all"}
+		}
+		if *local {
+			if *all || req.PageSize != 0 || req.PageToken != "" || *fields != "" {
+				return &usageError{msg: "--local cannot be combined with --all, --page-size, --page-token or --fields"}
+			}
+			return c.withIndexHandler(opts, func(h *CLIHandler) error {
+				return h.HandleListIndexedAlbums()
+			})
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		page := configuredPage(*req, opts, domain.MaxAlbumPageSize)
+		page.Fields = *fields
+		if *all {
+			return h.HandleListAllAlbums(domain.ListOptions{PageSize: page.PageSize, Prefetch: *prefetch, Fields: page.Fields})
+		}
+		return h.HandleListAlbums(page)
+	}
+}
+
+func runAlbumsGet(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	fields := fieldsFlag(fs, "album", "id,mediaItemsCount")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if err := domain.ValidateFields(*fields); err != nil {
+			return &usageError{msg: fmt.Sprintf("invalid --fields: %v", err)}
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleGetAlbum(fs.Arg(0), *fields)
+	}
+}
+
+func runAlbumsFind(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var filter domain.AlbumFilter
+	match := fs.String("match", string(domain.TitleRegex), "how the pattern is compared with titles: regex, substring or exact")
+	fs.BoolVar(&filter.IgnoreCase, "ignore-case", false, "compare titles regardless of case")
+	fs.BoolVar(&filter.ExcludeShared, "exclude-shared", false, "leave out shared albums")
+	fs.BoolVar(&filter.AppCreatedOnly, "app-created-only", false, "only list albums this app created")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		filter.Match = domain.TitleMatch(*match)
+		switch filter.Match {
+		case domain.TitleRegex, domain.TitleSubstring, domain.TitleExact:
+		default:
+			return &usageError{msg: fmt.Sprintf("invalid --match %q, expected regex, substring or exact", *match)}
+		}
+		if filter.Match == domain.TitleRegex {
+			if _, err := regexp.Compile(fs.Arg(0)); err != nil {
+				return &usageError{msg: fmt.Sprintf("invalid pattern: %v", err)}
+			}
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleFindAlbums(fs.Arg(0), filter)
+	}
+}
+
+func runAlbumsCreate(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	title := fs.String("title", "", "album title (defaults to a timestamped test title)")
+	appCreatedOnly := fs.Bool("app-created-only", false, "only reuse an album this app created, which new media items can be added to")
+	forceNew := fs.Bool("force-new", false, "create the album even if one with the title exists")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *forceNew && *appCreatedOnly {
+			return &usageError{msg: "--app-created-only cannot be combined with --force-new"}
+		}
+		reuse := *title != "" && !*forceNew
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		if !reuse {
+			return h.HandleCreateAlbum(*title)
+		}
+		return h.HandleCreateAlbumIfNotExists(context.Background(), *title, *appCreatedOnly)
+	}
+}
+
+func runAlbumsRename(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 2); err != nil {
+			return err
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleUpdateAlbum(fs.Arg(0), fs.Arg(1), "")
+	}
+}
+
+func runAlbumsSetCover(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 2); err != nil {
+			return err
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleUpdateAlbum(fs.Arg(0), "", fs.Arg(1))
+	}
+}
+
+func runAlbumsAddItems(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.mediaItemsCommand(opts, fs, (*CLIHandler).HandleAddMediaItems)
+}
+
+func runAlbumsRemoveItems(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.mediaItemsCommand(opts, fs, (*CLIHandler).HandleRemoveMediaItems)
+}
+
+func runAlbumsShare(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var options domain.SharedAlbumOptions
+	fs.BoolVar(&options.IsCollaborative, "collaborative", false, "allow others to add media items")
+	fs.BoolVar(&options.IsCommentable, "commentable", false, "allow others to comment")
+	qr := fs.Bool("qr", false, "also show the shareable URL as a QR code")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		h, err := c.sharingHandler(opts)
+		if err != nil {
+			return err
+		}
+		if *qr {
+			h.SetQRWriter(c.stderr)
+		}
+		return h.HandleShareAlbum(fs.Arg(0), options)
+	}
+}
+
+func runAlbumsShareOptions(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var update domain.SharedAlbumOptionsUpdate
+	fs.Var(optionalBool{&update.IsCollaborative}, "collaborative", "allow others to add media items (unset keeps the current value)")
+	fs.Var(optionalBool{&update.IsCommentable}, "commentable", "allow others to comment (unset keeps the current value)")
+	qr := fs.Bool("qr", false, "also show the shareable URL as a QR code")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if update.IsEmpty() {
+			return &usageError{msg: "at least one of --collaborative or --commentable is required"}
+		}
+		h, err := c.sharingHandler(opts)
+		if err != nil {
+			return err
+		}
+		if *qr {
+			h.SetQRWriter(c.stderr)
+		}
+		return h.HandleUpdateShareOptions(fs.Arg(0), update)
+	}
+}
+
+func runAlbumsUnshare(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.sharingArgCommand(opts, fs, (*CLIHandler).HandleUnshareAlbum)
+}
+
+func runBackupRun(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var backupOpts usecase.BackupOptions
+	target := fs.String("to", "", "s3://BUCKET/PREFIX, gs://BUCKET/PREFIX or a directory to copy originals to")
+	fs.StringVar(&backupOpts.AlbumID, "album", "", "only back up the media items of this album")
+	fs.IntVar(&backupOpts.Workers, "workers", opts.Config.Workers, "number of media items to copy concurrently")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *target == "" {
+			return &usageError{msg: "--to is required"}
+		}
+		if backupOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		backupUseCase, err := c.deps.BackupUseCase(opts, *target)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{})
+
+		// Ctrl-C stops starting new copies; the manifest still records the finished ones
+		ctx := opts.shutdown.context()
+
+		return h.HandleBackup(ctx, backupUseCase, backupOpts)
+	}
+}
+
+func runBackupStatus(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	target := fs.String("to", "", "s3://BUCKET/PREFIX, gs://BUCKET/PREFIX or a directory backed up to")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *target == "" {
+			return &usageError{msg: "--to is required"}
+		}
+
+		backupUseCase, err := c.deps.BackupUseCase(opts, *target)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{})
+		return h.HandleBackupStatus(opts.shutdown.context(), backupUseCase)
+	}
+}
+
+func runConfigValidate(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if fs.NArg() > 1 {
+			return &usageError{msg: fmt.Sprintf("expected at most 1 argument, got %d", fs.NArg())}
+		}
+		if fs.NArg() == 1 {
+			opts.ConfigPath = fs.Arg(0)
+		}
+
+		config, err := c.deps.LoadConfig(opts)
+		if err != nil {
+			return err
+		}
+		opts.Config = config
+		return c.newHandler(opts, HandlerUseCases{}).HandleValidateConfig(config)
+	}
+}
+
+func runConfigSchema(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		return c.newHandler(opts, HandlerUseCases{}).HandleConfigSchema(c.deps.ConfigSchema())
+	}
+}
+
+func runDaemonRun(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var logs jobLogs
+	fs.StringVar(&logs.dir, "log-dir", filepath.Join(opts.Config.Dir, "logs"), "directory each job appends its logs and output to, as JOB.log")
+	logMaxSize := fs.Int("log-max-size", 10, "megabytes a job log grows to before it is moved to JOB.log.1")
+	fs.IntVar(&logs.keep, "log-keep", 3, "number of rotated logs kept of every job")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		jobs := opts.Config.DaemonJobs
+		if len(jobs) == 0 {
+			return &usageError{msg: "no jobs to run; add them to daemon.jobs of the config"}
+		}
+		for _, job := range jobs {
+			if err := c.checkJobCommand(job); err != nil {
+				return err
+			}
+		}
+		if *logMaxSize < 1 || logs.keep < 0 {
+			return &usageError{msg: "--log-max-size must be at least 1 and --log-keep at least 0"}
+		}
+		logs.maxSize = int64(*logMaxSize) << 20
+		if err := os.MkdirAll(logs.dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create log directory: %v", err)
+		}
+
+		daemonUseCase, err := c.deps.DaemonUseCase(opts)
+		if err != nil {
+			return err
+		}
+		// The jobs, and any command run while the daemon is up, read and write the index through
+		// the daemon, which keeps it in memory
+		control, err := c.deps.ListenControlSocket(opts)
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the control socket", control)
+		h := c.newHandler(opts, HandlerUseCases{})
+
+		// SIGTERM or Ctrl-C interrupts the running job, and the daemon stops once it returned
+		ctx := opts.shutdown.context()
+
+		return h.HandleDaemon(ctx, daemonUseCase, jobs, opts.Config.TimeZone, func(ctx context.Context, job domain.DaemonJob) error {
+			return c.runJob(ctx, opts, job, logs)
+		})
+	}
+}
+
+func runDaemonStatus(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		daemonUseCase, err := c.deps.DaemonUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{})
+		return h.HandleDaemonStatus(daemonUseCase, opts.Config.DaemonJobs)
+	}
+}
+
+// checkJobCommand reports a daemon job whose command the CLI does not know, before the first run
+func (c *CLI) checkJobCommand(job domain.DaemonJob) error {
+	group := c.findGroup(job.Command[0])
+	if group == nil {
+		return fmt.Errorf("daemon job %s: unknown command %q", job.Name, job.Command[0])
+	}
+	if group.standalone() == nil && (len(job.Command) < 2 || group.findCommand(job.Command[1]) == nil) {
+		return fmt.Errorf("daemon job %s: unknown command %q", job.Name, strings.Join(job.Command[:min(2, len(job.Command))], " "))
+	}
+	return nil
+}
+
+// jobLogs says where daemon jobs log to and how their logs are rotated
+type jobLogs struct {
+	dir     string
+	maxSize int64
+	keep    int
+}
+
+// runJob runs the command of a daemon job as if the program had been started for it with the
+// global flags of the daemon: the config is read again and the cleanup of the command runs as
+// soon as it returns. Its logs go to the daemon's logger, tagged with the job, and along with its
+// output and errors they are appended to JOB.log in the log directory, which is rotated once it
+// grew past the size of logs.
+func (c *CLI) runJob(ctx context.Context, opts GlobalOptions, job domain.DaemonJob, logs jobLogs) error {
+	f, err := openRotatingFile(filepath.Join(logs.dir, job.Name+".log"), logs.maxSize, logs.keep)
+	if err != nil {
+		return fmt.Errorf("failed to open job log: %v", err)
+	}
+	defer f.Close()
+
+	jobOpts := opts
+	jobOpts.Logger = slog.New(teeHandler{opts.Logger.Handler(), newLogger(f, opts).Handler()}).With("job", job.Name)
+	jobOpts.Progress = newProgress(nil, jobOpts)
+	jobOpts.shutdown = &shutdown{parent: ctx}
+	jobCLI := &CLI{deps: c.deps, stdout: f, stderr: f, groups: c.groups}
+
+	code, err := jobCLI.runCommand(opts.global, job.Command, jobOpts)
+	jobOpts.shutdown.run(jobOpts.Logger)
+	if err == nil && code != ExitOK {
+		err = fmt.Errorf("exited with code %d", code)
+	}
+	return err
+}
+
+func runDedupeFind(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	method := fs.String("method", string(usecase.DedupeMetadata), "metadata compares names, capture times and sizes; content hashes downloaded bytes")
+	workers := fs.Int("workers", opts.Config.Workers, "number of files to download concurrently for content hashing")
+	review := fs.Bool("review", false, "pick the item to keep in each group and collect the rest in an album for deletion")
+	reviewAlbum := fs.String("review-album", "", "title of the album collecting duplicates (defaults to a timestamped title)")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		dedupeOpts := usecase.DedupeOptions{Workers: *workers}
+		var err error
+		if dedupeOpts.Method, err = usecase.ParseDedupeMethod(*method); err != nil {
+			return &usageError{msg: err.Error()}
+		}
+		if *workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if *reviewAlbum != "" && !*review {
+			return &usageError{msg: "--review-album requires --review"}
+		}
+
+		dedupeUseCase, err := c.deps.DedupeUseCase(opts)
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the local index", dedupeUseCase)
+		h := c.newHandler(opts, HandlerUseCases{Dedupe: dedupeUseCase})
+
+		// Ctrl-C stops hashing; nothing is changed until the review is confirmed
+		ctx := opts.shutdown.context()
+
+		if !*review {
+			return h.HandleFindDuplicates(ctx, dedupeOpts)
+		}
+		return h.HandleReviewDuplicates(ctx, dedupeOpts, *reviewAlbum, os.Stdin)
+	}
+}
+
+func runReportOverlap(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var overlapOpts usecase.OverlapOptions
+	fs.IntVar(&overlapOpts.MinShared, "min-shared", 1, "leave out pairs of albums sharing fewer media items")
+	fs.IntVar(&overlapOpts.MaxAlbums, "albums", 20, "most albums in the matrix and heatmap, those sharing the most media items")
+	matrix := fs.Bool("matrix", false, "print a matrix of shared media items instead of a list of pairs")
+	fs.StringVar(&overlapOpts.Heatmap, "heatmap", "", "also write the matrix as an SVG heatmap to this file")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if overlapOpts.MinShared < 1 || overlapOpts.MaxAlbums < 1 {
+			return &usageError{msg: "--min-shared and --albums must be at least 1"}
+		}
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleAlbumOverlap(overlapOpts, *matrix)
+		})
+	}
+}
+
+func runReportCategories(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var categoryOpts usecase.CategoryOptions
+	categories := fs.String("categories", "", "comma-separated content categories to count, such as SCREENSHOTS,RECEIPTS (default all)")
+	fs.IntVar(&categoryOpts.Samples, "samples", 3, "media items of each category to show")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if categoryOpts.Samples < 0 {
+			return &usageError{msg: "--samples must not be negative"}
+		}
+		if categoryOpts.Samples == 0 {
+			categoryOpts.Samples = -1
+		}
+		if *categories != "" {
+			for _, name := range strings.Split(*categories, ",") {
+				category, err := domain.ParseContentCategory(strings.TrimSpace(name))
+				if err != nil {
+					return &usageError{msg: err.Error()}
+				}
+				categoryOpts.Categories = append(categoryOpts.Categories, category)
+			}
+		}
+
+		// Ctrl-C stops between pages of the search
+		ctx := opts.shutdown.context()
+
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleCategoryReport(ctx, categoryOpts)
+		})
+	}
+}
+
+func runReportGrowth(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var growthOpts usecase.GrowthOptions
+	fs.IntVar(&growthOpts.Months, "months", 36, "months to forecast")
+	fs.StringVar(&growthOpts.Model, "model", "", "growth model: linear or seasonal (default seasonal with two years of history, else linear)")
+	photoMB := fs.Float64("photo-mb", 4, "average size of a photo in MiB")
+	videoMB := fs.Float64("video-mb", 80, "average size of a video in MiB")
+	usedGB := fs.Float64("used-gb", 0, "storage the rest of the account takes in GiB, such as Gmail and Drive")
+	monthly := fs.Bool("monthly", false, "print the forecast size of every month instead of the storage tiers")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if growthOpts.Months < 1 || *photoMB <= 0 || *videoMB <= 0 || *usedGB < 0 {
+			return &usageError{msg: "--months, --photo-mb and --video-mb must be positive and --used-gb not negative"}
+		}
+		growthOpts.PhotoSize = int64(*photoMB * (1 << 20))
+		growthOpts.VideoSize = int64(*videoMB * (1 << 20))
+		growthOpts.Used = int64(*usedGB * (1 << 30))
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleForecastGrowth(growthOpts, *monthly)
+		})
+	}
+}
+
+func runPlanQuota(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	planOpts := usecase.QuotaPlanOptions{MaxRPS: opts.Config.MaxRPS}
+	fs.IntVar(&planOpts.Items, "items", 0, "media items or files the pipeline handles (defaults to the media items of the local index for backup and index)")
+	fs.IntVar(&planOpts.Albums, "albums", 0, "albums it lists or creates (defaults to the albums of the local index for index)")
+	fs.IntVar(&planOpts.Workers, "workers", opts.Config.Workers, "number of concurrent uploads or downloads")
+	fs.DurationVar(&planOpts.Latency, "latency", 300*time.Millisecond, "time a single request takes")
+	itemMB := fs.Float64("item-mb", 4, "average size of a file in MiB")
+	mbps := fs.Float64("mbps", 0, "bandwidth of the connection in megabits a second, 0 to leave transfers out")
+	fs.IntVar(&planOpts.DailyQuota, "daily-quota", usecase.DefaultDailyQuota, "requests the project may send the Library API a day")
+	fs.IntVar(&planOpts.MediaQuota, "media-quota", usecase.DefaultMediaQuota, "requests for the bytes of media items the project may send a day")
+	target := fs.String("to", "", "s3://BUCKET/PREFIX or gs://BUCKET/PREFIX a backup goes to, to estimate its costs from backup.pricing")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		planOpts.Pipeline = fs.Arg(0)
+		if !slices.Contains(usecase.PlanPipelines(), planOpts.Pipeline) {
+			return &usageError{msg: fmt.Sprintf("unknown pipeline %q, expected one of %s", planOpts.Pipeline, strings.Join(usecase.PlanPipelines(), ", "))}
+		}
+		if planOpts.Items < 0 || planOpts.Albums < 0 || *mbps < 0 {
+			return &usageError{msg: "--items, --albums and --mbps must not be negative"}
+		}
+		if planOpts.Workers < 1 || planOpts.Latency <= 0 || *itemMB <= 0 || planOpts.DailyQuota < 1 || planOpts.MediaQuota < 1 {
+			return &usageError{msg: "--workers, --latency, --item-mb, --daily-quota and --media-quota must be positive"}
+		}
+		planOpts.ItemSize = int64(*itemMB * (1 << 20))
+		planOpts.Bandwidth = int64(*mbps * 1e6 / 8)
+		if *target != "" {
+			if planOpts.Pipeline != usecase.PlanBackup {
+				return &usageError{msg: "--to is only for backup"}
+			}
+			scheme, _, _ := strings.Cut(*target, "://")
+			if !slices.Contains(domain.BackupSchemes, scheme) {
+				return &usageError{msg: fmt.Sprintf("--to must be an s3:// or gs:// URL to estimate costs, got %q", *target)}
+			}
+			pricing, ok := opts.Config.BackupPricing[scheme]
+			if !ok {
+				return fmt.Errorf("%w: no backup.pricing.%s in the config to estimate the costs of %s from", domain.ErrInvalidConfig, scheme, *target)
+			}
+			planOpts.Pricing = &pricing
+		}
+
+		// Only whole-library pipelines can be sized from the local index
+		library := planOpts.Pipeline == usecase.PlanBackup || planOpts.Pipeline == usecase.PlanIndex
+		countItems := library && !flagSet(fs, "items")
+		countAlbums := planOpts.Pipeline == usecase.PlanIndex && !flagSet(fs, "albums")
+		if !library && !flagSet(fs, "items") {
+			return &usageError{msg: fmt.Sprintf("--items is required for %s", planOpts.Pipeline)}
+		}
+		if !countItems && !countAlbums {
+			return c.newHandler(opts, HandlerUseCases{}).HandlePlanQuota(planOpts, false, false)
+		}
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandlePlanQuota(planOpts, countItems, countAlbums)
+		})
+	}
+}
+
+func runStats(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var statsOpts usecase.StatsOptions
+	fs.BoolVar(&statsOpts.Live, "live", false, "list the library from the API instead of reading the local index")
+	fs.IntVar(&statsOpts.Top, "top", 10, "most albums, cameras and videos to list")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if statsOpts.Top < 1 {
+			return &usageError{msg: "--top must be at least 1"}
+		}
+
+		// Ctrl-C stops listing the library with --live
+		ctx := opts.shutdown.context()
+
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleLibraryStats(ctx, statsOpts)
+		})
+	}
+}
+
+func runSearchSimilar(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", "", "directory of exported photos to search instead of the local index")
+	var similarOpts usecase.SimilarOptions
+	fs.IntVar(&similarOpts.Limit, "limit", 10, "most matches to show")
+	fs.IntVar(&similarOpts.MaxDistance, "max-distance", 10, "most of the 64 bits of the perceptual hashes that may differ")
+	fs.IntVar(&similarOpts.Workers, "workers", opts.Config.Workers, "number of photos to hash concurrently")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if similarOpts.Limit < 1 || similarOpts.Workers < 1 {
+			return &usageError{msg: "--limit and --workers must be at least 1"}
+		}
+		if similarOpts.MaxDistance < 1 || similarOpts.MaxDistance > 64 {
+			return &usageError{msg: "--max-distance must be between 1 and 64"}
+		}
+		if *dir != "" {
+			if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+				return &usageError{msg: fmt.Sprintf("--dir %s is not a directory", *dir)}
+			}
+			similarOpts.Files = os.DirFS(*dir)
+		}
+
+		dedupeUseCase, err := c.deps.DedupeUseCase(opts)
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the local index", dedupeUseCase)
+		h := c.newHandler(opts, HandlerUseCases{Dedupe: dedupeUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleFindSimilar(ctx, fs.Arg(0), similarOpts)
+	}
+}
+
+func runMagicApply(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	config := fs.String("config", "", "JSON file with the rules")
+	magicOpts := usecase.MagicOptions{TimeZone: opts.Config.TimeZone}
+	fs.BoolVar(&magicOpts.DryRun, "dry-run", false, "report what would change without changing any album")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *config == "" {
+			return &usageError{msg: "--config is required"}
+		}
+
+		magicUseCase, err := c.deps.MagicUseCase(opts, *config)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Magic: magicUseCase})
+
+		// Ctrl-C stops before the next rule; albums already updated stay updated
+		ctx := opts.shutdown.context()
+
+		return h.HandleApplyMagicRules(ctx, magicOpts)
+	}
+}
+
+func runDownloadAlbum(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.downloadCommand(opts, fs, (*CLIHandler).HandleDownloadAlbum)
+}
+
+func runDownloadItem(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.downloadCommand(opts, fs, (*CLIHandler).HandleDownloadItem)
+}
+
+func runDownloadPrint(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	printOpts := usecase.PrintOptions{MinDPI: usecase.DefaultMinPrintDPI}
+	fs.StringVar(&printOpts.Dir, "dir", ".", "directory to create one folder per print size in")
+	sizes := fs.String("sizes", "4x6", "comma-separated print sizes in inches")
+	fs.IntVar(&printOpts.MinDPI, "min-dpi", printOpts.MinDPI, "lowest resolution a cropped photo may have")
+	fs.IntVar(&printOpts.Workers, "workers", opts.Config.Workers, "number of files to download concurrently")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		for _, name := range strings.Split(*sizes, ",") {
+			size, err := domain.ParsePrintSize(name)
+			if err != nil {
+				return &usageError{msg: err.Error()}
+			}
+			printOpts.Sizes = append(printOpts.Sizes, size)
+		}
+		if printOpts.MinDPI < 1 {
+			return &usageError{msg: "--min-dpi must be at least 1"}
+		}
+		if printOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		downloadUseCase, err := c.deps.DownloadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Download: downloadUseCase})
+
+		// Ctrl-C stops starting new downloads; partial files are removed
+		ctx := opts.shutdown.context()
+
+		return h.HandlePrintAlbum(ctx, fs.Arg(0), printOpts)
+	}
+}
+
+func runExportAlbum(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var exportOpts usecase.ExportOptions
+	fs.StringVar(&exportOpts.Out, "out", "", "archive to write: .zip, .tar, .tar.gz or .tgz")
+	fs.BoolVar(&exportOpts.Originals, "originals", false, "also add the original file of every media item")
+	fs.IntVar(&exportOpts.Workers, "workers", opts.Config.Workers, "number of files to download concurrently")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if exportOpts.Out == "" {
+			return &usageError{msg: "--out is required"}
+		}
+		if exportOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		downloadUseCase, err := c.deps.DownloadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Download: downloadUseCase})
+
+		// Ctrl-C stops the export before the archive is written
+		ctx := opts.shutdown.context()
+
+		return h.HandleExportAlbum(ctx, fs.Arg(0), exportOpts)
+	}
+}
+
+func runRenderContactSheet(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	sheetOpts := usecase.ContactSheetOptions{
+		Columns:       usecase.DefaultSheetColumns,
+		Rows:          usecase.DefaultSheetRows,
+		ThumbnailSize: usecase.DefaultSheetThumbnailSize,
+		TimeZone:      opts.Config.TimeZone,
+	}
+	fs.StringVar(&sheetOpts.Dir, "dir", ".", "directory to write the pages to")
+	format := fs.String("format", string(usecase.SheetPNG), "page format: png, jpeg, or pdf for a single document")
+	fs.IntVar(&sheetOpts.Columns, "columns", sheetOpts.Columns, "thumbnails per row")
+	fs.IntVar(&sheetOpts.Rows, "rows", sheetOpts.Rows, "rows per page")
+	fs.IntVar(&sheetOpts.ThumbnailSize, "thumbnail-size", sheetOpts.ThumbnailSize, "width and height of each thumbnail in pixels")
+	fs.IntVar(&sheetOpts.Workers, "workers", opts.Config.Workers, "number of thumbnails to download concurrently")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		sheetOpts.Format = usecase.SheetFormat(strings.ToLower(*format))
+		switch sheetOpts.Format {
+		case usecase.SheetPNG, usecase.SheetJPEG, usecase.SheetPDF:
+		case "jpg":
+			sheetOpts.Format = usecase.SheetJPEG
+		default:
+			return &usageError{msg: fmt.Sprintf("unknown format %q, expected png, jpeg or pdf", *format)}
+		}
+		if sheetOpts.Columns < 1 || sheetOpts.Rows < 1 {
+			return &usageError{msg: "--columns and --rows must be at least 1"}
+		}
+		// Google serves thumbnails of at most 16383 pixels, far beyond what a page can hold
+		if sheetOpts.ThumbnailSize < 16 || sheetOpts.ThumbnailSize > 1024 {
+			return &usageError{msg: "--thumbnail-size must be between 16 and 1024"}
+		}
+		if sheetOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		contactSheetUseCase, err := c.deps.ContactSheetUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{ContactSheet: contactSheetUseCase})
+
+		// Ctrl-C stops before the next page; pages already written are kept
+		ctx := opts.shutdown.context()
+
+		return h.HandleRenderContactSheet(ctx, fs.Arg(0), sheetOpts)
+	}
+}
+
+func runRenderCalendar(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	calendarOpts := usecase.CalendarOptions{DPI: usecase.DefaultLayoutDPI, TimeZone: opts.Config.TimeZone}
+	fs.IntVar(&calendarOpts.Year, "year", time.Now().Year()+1, "year of the calendar")
+	fs.BoolVar(&calendarOpts.SundayFirst, "sunday-first", false, "start weeks on Sunday instead of Monday")
+	fs.StringVar(&calendarOpts.Title, "title", "", "cover title (defaults to the year)")
+	fs.StringVar(&calendarOpts.Output, "out", "", "PDF file to write (defaults to calendar-YEAR.pdf)")
+	paper, workers := layoutFlags(fs, opts, &calendarOpts.DPI)
+	return func() error {
+		if err := expectMinArgs(fs, 1); err != nil {
+			return err
+		}
+		var err error
+		if calendarOpts.Paper, err = domain.ParsePaperSize(*paper); err != nil {
+			return &usageError{msg: err.Error()}
+		}
+		if calendarOpts.Year < 1 || calendarOpts.Year > 9999 {
+			return &usageError{msg: "--year must be between 1 and 9999"}
+		}
+		if calendarOpts.DPI < 72 || *workers < 1 {
+			return &usageError{msg: "--dpi must be at least 72 and --workers at least 1"}
+		}
+		calendarOpts.AlbumIDs, calendarOpts.Workers = fs.Args(), *workers
+		if calendarOpts.Output == "" {
+			calendarOpts.Output = fmt.Sprintf("calendar-%d.pdf", calendarOpts.Year)
+		}
+
+		layoutUseCase, err := c.deps.LayoutUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Layout: layoutUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleRenderCalendar(ctx, calendarOpts)
+	}
+}
+
+func runRenderReel(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	reelOpts := usecase.ReelOptions{TimeZone: opts.Config.TimeZone}
+	fs.StringVar(&reelOpts.AlbumID, "album", "", "album to make the reel of")
+	from := fs.String("from", "", "first day YYYY-MM-DD of media items to search the library for")
+	to := fs.String("to", "", "last day YYYY-MM-DD of media items to search the library for (defaults to --from)")
+	fs.StringVar(&reelOpts.Output, "out", "reel.mp4", "video file to write")
+	fs.IntVar(&reelOpts.MaxItems, "max", 20, "maximum number of photos and videos, picked evenly over time")
+	fs.DurationVar(&reelOpts.PhotoDuration, "photo-duration", 3*time.Second, "how long each photo is shown")
+	fs.DurationVar(&reelOpts.ClipDuration, "clip-duration", 5*time.Second, "where videos are cut off")
+	size := fs.String("size", "1920x1080", "frame size WIDTHxHEIGHT in pixels")
+	ffmpeg := fs.String("ffmpeg", "ffmpeg", "ffmpeg binary used to assemble the reel")
+	fs.BoolVar(&reelOpts.Upload, "upload", false, "upload the finished reel to the library")
+	fs.IntVar(&reelOpts.Workers, "workers", opts.Config.Workers, "number of media items to download concurrently")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if (reelOpts.AlbumID == "") == (*from == "") {
+			return &usageError{msg: "exactly one of --album and --from is required"}
+		}
+		if *from != "" {
+			dates, err := parseDateRange(*from, cmp.Or(*to, *from))
+			if err != nil {
+				return &usageError{msg: err.Error()}
+			}
+			reelOpts.Dates = dates
+		}
+		w, h, ok := strings.Cut(*size, "x")
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		// libx264 needs even frame dimensions
+		if !ok || errW != nil || errH != nil || width < 2 || height < 2 || width%2 != 0 || height%2 != 0 {
+			return &usageError{msg: fmt.Sprintf("invalid --size %q, expected even WIDTHxHEIGHT such as 1920x1080", *size)}
+		}
+		reelOpts.Width, reelOpts.Height = width, height
+		if reelOpts.MaxItems < 1 || reelOpts.PhotoDuration <= 0 || reelOpts.ClipDuration <= 0 || reelOpts.Workers < 1 {
+			return &usageError{msg: "--max and --workers must be at least 1 and durations positive"}
+		}
+
+		reelUseCase, err := c.deps.ReelUseCase(opts, *ffmpeg)
+		if err != nil {
+			return err
+		}
+		handler := c.newHandler(opts, HandlerUseCases{Reel: reelUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return handler.HandleRenderReel(ctx, reelOpts)
+	}
+}
+
+// parseDateRange parses the first and last day of a range written as YYYY-MM-DD
+func parseDateRange(from, to string) (domain.DateRange, error) {
+	start, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return domain.DateRange{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", from)
+	}
+	end, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		return domain.DateRange{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", to)
+	}
+	if end.Before(start) {
+		return domain.DateRange{}, fmt.Errorf("the date range ends on %s, before it starts", to)
+	}
+	return domain.DateRange{Start: start, End: end}, nil
+}
+
+func runRenderPhotoBook(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	bookOpts := usecase.PhotoBookOptions{DPI: usecase.DefaultLayoutDPI, TimeZone: opts.Config.TimeZone}
+	layout := fs.String("layout", string(usecase.LayoutTwo), "page template: single, two or grid (four photos)")
+	months := fs.String("months", "", "comma-separated months YYYY-MM to keep photos from (default all)")
+	fs.StringVar(&bookOpts.Title, "title", "", "cover title (defaults to the album titles)")
+	fs.StringVar(&bookOpts.Output, "out", "photo-book.pdf", "PDF file to write")
+	paper, workers := layoutFlags(fs, opts, &bookOpts.DPI)
+	return func() error {
+		if err := expectMinArgs(fs, 1); err != nil {
+			return err
+		}
+		var err error
+		if bookOpts.Paper, err = domain.ParsePaperSize(*paper); err != nil {
+			return &usageError{msg: err.Error()}
+		}
+		bookOpts.Layout = usecase.PhotoBookLayout(strings.ToLower(*layout))
+		switch bookOpts.Layout {
+		case usecase.LayoutSingle, usecase.LayoutTwo, usecase.LayoutGrid:
+		default:
+			return &usageError{msg: fmt.Sprintf("unknown layout %q, expected single, two or grid", *layout)}
+		}
+		if *months != "" {
+			for _, month := range strings.Split(*months, ",") {
+				t, err := time.Parse("2006-01", strings.TrimSpace(month))
+				if err != nil {
+					return &usageError{msg: fmt.Sprintf("invalid month %q, expected YYYY-MM", month)}
+				}
+				bookOpts.Months = append(bookOpts.Months, t)
+			}
+		}
+		if bookOpts.DPI < 72 || *workers < 1 {
+			return &usageError{msg: "--dpi must be at least 72 and --workers at least 1"}
+		}
+		bookOpts.AlbumIDs, bookOpts.Workers = fs.Args(), *workers
+
+		layoutUseCase, err := c.deps.LayoutUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Layout: layoutUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleRenderPhotoBook(ctx, bookOpts)
+	}
+}
+
+// layoutFlags registers the flags shared by the calendar and photo book commands
+func layoutFlags(fs *flag.FlagSet, opts GlobalOptions, dpi *int) (paper *string, workers *int) {
+	paper = fs.String("paper", "a4", "page size: a3, a4, a5, letter, legal or WIDTHxHEIGHT in inches")
+	fs.IntVar(dpi, "dpi", *dpi, "resolution pages are rendered at")
+	workers = fs.Int("workers", opts.Config.Workers, "number of photos to download concurrently")
+	return paper, workers
+}
+
+func runMediaUpload(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", "", "directory to upload, including subdirectories")
+	var uploadOpts usecase.UploadOptions
+	fs.StringVar(&uploadOpts.AlbumTitle, "album", "", "create an album with this title for the uploaded items")
+	fs.StringVar(&uploadOpts.AlbumID, "album-id", "", "add the uploaded items to this existing app-owned album")
+	fs.IntVar(&uploadOpts.Workers, "workers", opts.Config.Workers, "number of files to upload concurrently")
+	offset := fs.String("fix-dates", "", "shift EXIF timestamps of photos by an offset such as +1h or -2d3h before uploading")
+	zones := fs.String("fix-dates-zone", "", "move EXIF timestamps from the camera's time zone to the actual one, as FROM:TO such as Europe/Berlin:Asia/Tokyo")
+	except := fs.String("fix-dates-except", "", "comma-separated globs of files whose timestamps are left as they are")
+	infer := fs.Bool("infer-dates", false, "give JPEG photos without EXIF data the date in their file name, such as IMG_20240115_103000.jpg")
+	fs.StringVar(&uploadOpts.Description, "description", "", `Go template of the descriptions, with .Filename, .Name and, from EXIF data, .Created, .Camera and .Location, such as '{{.Name}}{{with .Location}} at {{.}}{{end}}'`)
+	preview := fs.Bool("preview", false, "show the corrected timestamps without uploading")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *dir == "" {
+			return &usageError{msg: "--dir is required"}
+		}
+		if uploadOpts.AlbumTitle != "" && uploadOpts.AlbumID != "" {
+			return &usageError{msg: "--album cannot be combined with --album-id"}
+		}
+		if uploadOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		var fileNames []domain.FilenameDateRule
+		if *infer {
+			fileNames = opts.Config.FilenameDates
+		}
+		fix, err := parseDateFix(*offset, *zones, *except, fileNames)
+		if err != nil {
+			return &usageError{msg: err.Error()}
+		}
+		if fix == nil && (*except != "" || *preview) {
+			return &usageError{msg: "--fix-dates-except and --preview need --fix-dates, --fix-dates-zone or --infer-dates"}
+		}
+		uploadOpts.FixDates = fix
+		if _, err := template.New("description").Parse(uploadOpts.Description); err != nil {
+			return &usageError{msg: fmt.Sprintf("invalid --description: %v", err)}
+		}
+
+		uploadUseCase, err := c.deps.UploadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Upload: uploadUseCase})
+		if *preview {
+			return h.HandlePreviewDateFix(*dir, *fix)
+		}
+
+		// Ctrl-C stops starting new uploads; files already sent are still turned into media items
+		ctx := opts.shutdown.context()
+
+		return h.HandleUploadDirectory(ctx, *dir, uploadOpts)
+	}
+}
+
+func runWatch(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", "", "directory to watch, including subdirectories")
+	var watchOpts usecase.WatchOptions
+	fs.StringVar(&watchOpts.AlbumTitle, "album", "", "add the uploaded items to the app-created album with this title, creating it if needed")
+	fs.StringVar(&watchOpts.AlbumID, "album-id", "", "add the uploaded items to this existing app-owned album")
+	fs.DurationVar(&watchOpts.Interval, "interval", 5*time.Second, "how often to look for new files with --poll or when file system notifications are unavailable")
+	poll := fs.Bool("poll", false, "scan every --interval instead of waiting for file system notifications, which network shares may not send")
+	fs.DurationVar(&watchOpts.Settle, "settle", 10*time.Second, "how long a file must stay unchanged before it is uploaded")
+	fs.IntVar(&watchOpts.Workers, "workers", opts.Config.Workers, "number of files to upload concurrently")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *dir == "" {
+			return &usageError{msg: "--dir is required"}
+		}
+		if watchOpts.AlbumTitle != "" && watchOpts.AlbumID != "" {
+			return &usageError{msg: "--album cannot be combined with --album-id"}
+		}
+		if watchOpts.Interval <= 0 || watchOpts.Settle <= 0 {
+			return &usageError{msg: "--interval and --settle must be positive"}
+		}
+		if watchOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+			return &usageError{msg: fmt.Sprintf("--dir %s is not a directory", *dir)}
+		}
+
+		uploadUseCase, err := c.deps.WatchUseCase(opts)
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the local index", uploadUseCase)
+		if !*poll {
+			notifier, err := c.deps.FolderNotifier(opts, *dir)
+			if err != nil {
+				opts.Logger.Warn("File system notifications are unavailable, scanning the folder every --interval", "error", err)
+			} else {
+				opts.shutdown.closeOnExit("the folder notifications", notifier)
+				watchOpts.Notifier = notifier
+			}
+		}
+		h := c.newHandler(opts, HandlerUseCases{Upload: uploadUseCase})
+
+		// Ctrl-C stops watching; files already sent are still turned into media items
+		ctx := opts.shutdown.context()
+
+		return h.HandleWatch(ctx, *dir, watchOpts)
+	}
+}
+
+func runImportTakeout(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var takeoutOpts usecase.TakeoutOptions
+	fs.IntVar(&takeoutOpts.Workers, "workers", opts.Config.Workers, "number of files to upload concurrently")
+	fs.BoolVar(&takeoutOpts.DryRun, "dry-run", false, "list what would be imported without uploading anything")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if takeoutOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		uploadUseCase, err := c.deps.UploadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Upload: uploadUseCase})
+
+		// Ctrl-C stops starting new uploads; files already sent are still turned into media items
+		ctx := opts.shutdown.context()
+
+		return h.HandleImportTakeout(ctx, fs.Arg(0), takeoutOpts)
+	}
+}
+
+func runRestoreAlbum(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var restoreOpts usecase.TakeoutOptions
+	fs.IntVar(&restoreOpts.Workers, "workers", opts.Config.Workers, "number of files to upload concurrently")
+	fs.BoolVar(&restoreOpts.DryRun, "dry-run", false, "list what would be restored without uploading anything")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if restoreOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+
+		uploadUseCase, err := c.deps.UploadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Upload: uploadUseCase})
+
+		// Ctrl-C stops starting new uploads; files already sent are still turned into media items
+		ctx := opts.shutdown.context()
+
+		return h.HandleRestoreAlbum(ctx, fs.Arg(0), restoreOpts)
+	}
+}
+
+func runMediaDescribe(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	text := fs.String("text", "", "description to set; an empty one clears the descriptions")
+	describeOpts := usecase.DescribeOptions{TimeZone: opts.Config.TimeZone}
+	fs.StringVar(&describeOpts.Template, "template", "", `Go template of the description, with .Filename, .Name, .Created, .Camera and .Description, such as '{{.Name}} {{.Created.Format "2006-01-02"}}'`)
+	albumID := fs.String("album", "", "describe every media item of this album instead of those given by ID")
+	fs.BoolVar(&describeOpts.OnlyEmpty, "only-empty", false, "leave media items that already have a description alone")
+	fs.BoolVar(&describeOpts.DryRun, "dry-run", false, "print the descriptions without setting them")
+	fs.IntVar(&describeOpts.Workers, "workers", opts.Config.Workers, "number of media items to update concurrently")
+	return func() error {
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if set["text"] == set["template"] {
+			return &usageError{msg: "either --text or --template is required"}
+		}
+		if (fs.NArg() == 0) == (*albumID == "") {
+			return &usageError{msg: "either --album or media item IDs are required"}
+		}
+		if describeOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if set["text"] {
+			// The text is set as it is, so braces in it print themselves instead of starting actions
+			describeOpts.Template = strings.ReplaceAll(*text, "{{", `{{"{{"}}`)
+		} else if _, err := template.New("description").Parse(describeOpts.Template); err != nil {
+			return &usageError{msg: fmt.Sprintf("invalid --template: %v", err)}
+		}
+
+		describeUseCase, err := c.deps.DescribeUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Describe: describeUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleDescribeMediaItems(ctx, fs.Args(), *albumID, describeOpts)
+	}
+}
+
+func runMediaThumbnails(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", "", "directory of the photos, including subdirectories")
+	var thumbOpts usecase.ThumbnailOptions
+	fs.StringVar(&thumbOpts.Out, "out", "", "directory to write the thumbnails to (defaults to .thumbnails in --dir, which uploads skip)")
+	fs.IntVar(&thumbOpts.Size, "size", usecase.DefaultThumbnailSize, "longest side of a thumbnail in pixels")
+	fs.IntVar(&thumbOpts.Workers, "workers", opts.Config.Workers, "number of photos to read concurrently")
+	thumbnailer := fs.String("thumbnailer", "go", "go for the built-in decoders of JPEG, PNG, GIF, WebP, BMP and TIFF, or vips for libvips, which also reads HEIC and raw files")
+	vips := fs.String("vips", "vipsthumbnail", "vipsthumbnail binary of --thumbnailer vips")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *dir == "" {
+			return &usageError{msg: "--dir is required"}
+		}
+		if thumbOpts.Size < 1 || thumbOpts.Workers < 1 {
+			return &usageError{msg: "--size and --workers must be at least 1"}
+		}
+		vipsPath := ""
+		switch *thumbnailer {
+		case "go":
+		case "vips":
+			vipsPath = *vips
+		default:
+			return &usageError{msg: fmt.Sprintf("invalid --thumbnailer %q, expected go or vips", *thumbnailer)}
+		}
+		if thumbOpts.Out == "" {
+			thumbOpts.Out = filepath.Join(*dir, ".thumbnails")
+		}
+
+		thumbnailUseCase, err := c.deps.ThumbnailUseCase(opts, vipsPath)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Thumbnail: thumbnailUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleMakeThumbnails(ctx, *dir, thumbOpts)
+	}
+}
+
+func runServe(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	addr := fs.String("addr", "localhost:9090", "address to listen on, such as :9090 for every interface")
+	token := fs.String("token", "", "bearer token clients must send; defaults to serve.token of the config, else a random token that is logged")
+	allowOrigin := fs.String("allow-origin", "", "origin of a web front end allowed to call the API, such as http://localhost:5173")
+	workers := fs.Int("workers", opts.Config.Workers, "number of files of an upload to send concurrently")
+	themeDir := fs.String("theme", opts.Config.ServeTheme, "`DIR`ectory of templates and files changing the look of the web gallery (defaults to serve.theme of the config)")
+	prefetch := fs.Int("prefetch", usecase.DefaultPrefetchBudget, "requests a minute the gallery may spend fetching the next page and thumbnails ahead; 0 turns prefetching off")
+	maxUpload := fs.Int64("max-upload-size", DefaultMaxUploadSize>>20, "largest body of an upload request in `MB`, every file of it together")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if *maxUpload < 1 {
+			return &usageError{msg: "--max-upload-size must be at least 1"}
+		}
+		if *prefetch < 0 {
+			return &usageError{msg: "--prefetch must not be negative"}
+		}
+		var theme *GalleryTheme
+		if *themeDir != "" {
+			if info, err := os.Stat(*themeDir); err != nil || !info.IsDir() {
+				return &usageError{msg: fmt.Sprintf("--theme %s is not a directory", *themeDir)}
+			}
+			var err error
+			if theme, err = LoadGalleryTheme(os.DirFS(*themeDir)); err != nil {
+				return fmt.Errorf("failed to load theme %s: %v", *themeDir, err)
+			}
+		}
+
+		// Uploads of concurrent requests would share one progress bar, so they are logged
+		opts.Progress = &progressLog{logger: opts.Logger}
+		albumUseCase, err := c.deps.AlbumUseCase(opts)
+		if err != nil {
+			return err
+		}
+		uploadUseCase, err := c.deps.UploadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		galleryUseCase, err := c.deps.GalleryUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Album: albumUseCase, Upload: uploadUseCase})
+
+		// Ctrl-C stops accepting requests and lets those in flight finish
+		ctx := opts.shutdown.context()
+		galleryUseCase.StartPrefetch(ctx, usecase.PrefetchOptions{Budget: *prefetch})
+
+		serverOpts := APIServerOptions{
+			Token:         cmp.Or(*token, opts.Config.ServeToken),
+			AllowOrigin:   *allowOrigin,
+			Upload:        usecase.UploadOptions{Workers: *workers},
+			MaxUploadSize: *maxUpload << 20,
+			Metrics:       c.deps.Metrics(),
+			Theme:         theme,
+			Index:         c.sessionIndex(ctx, opts),
+			Exit:          opts.ExitHooks(),
+		}
+		return h.HandleServe(ctx, *addr, serverOpts, galleryUseCase, func() (*usecase.IndexUseCase, error) {
+			return c.deps.IndexUseCase(opts)
+		})
+	}
+}
+
+func runTUI(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", ".", "directory downloaded media items are written to")
+	prefetch := fs.Int("prefetch", usecase.DefaultPrefetchBudget, "requests a minute that may be spent loading the selected album and the next page ahead; 0 turns prefetching off")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *prefetch < 0 {
+			return &usageError{msg: "--prefetch must not be negative"}
+		}
+
+		// Logs would be drawn over the panes, so the use cases report to the status line instead
+		// and only to the transcript
+		quiet := opts
+		quiet.Logger, quiet.Progress = slog.New(slog.DiscardHandler), domain.NopProgress{}
+		if opts.transcript != nil {
+			quiet.Logger = opts.transcript.logger
+		}
+		albumUseCase, err := c.deps.AlbumUseCase(quiet)
+		if err != nil {
+			return err
+		}
+		galleryUseCase, err := c.deps.GalleryUseCase(quiet)
+		if err != nil {
+			return err
+		}
+		downloadUseCase, err := c.deps.DownloadUseCase(quiet)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Album: albumUseCase, Download: downloadUseCase})
+
+		ctx := opts.shutdown.context()
+		galleryUseCase.StartPrefetch(ctx, usecase.PrefetchOptions{Budget: *prefetch})
+
+		return h.HandleTUI(ctx, galleryUseCase, TUIOptions{DownloadDir: *dir, TimeZone: opts.Config.TimeZone, Index: c.sessionIndex(ctx, quiet)})
+	}
+}
+
+// parseDateFix builds the EXIF date correction of media upload; it is nil when neither an
+// offset, time zones nor file name rules are given
+func parseDateFix(offset, zones, except string, fileNames []domain.FilenameDateRule) (*usecase.DateFix, error) {
+	if offset == "" && zones == "" && len(fileNames) == 0 {
+		return nil, nil
+	}
+
+	fix := &usecase.DateFix{FileNames: fileNames}
+	if offset != "" {
+		d, err := parseDateOffset(offset)
+		if err != nil {
+			return nil, err
+		}
+		fix.Offset = d
+	}
+	if zones != "" {
+		from, to, ok := strings.Cut(zones, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --fix-dates-zone %q, expected FROM:TO such as Europe/Berlin:Asia/Tokyo", zones)
+		}
+		var err error
+		if fix.From, err = time.LoadLocation(from); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", from)
+		}
+		if fix.To, err = time.LoadLocation(to); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", to)
+		}
+	}
+	for _, pattern := range strings.Split(except, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --fix-dates-except pattern %q", pattern)
+		}
+		fix.Except = append(fix.Except, pattern)
+	}
+	return fix, nil
+}
+
+// parseDateOffset parses a signed duration that may start with whole days, such as -2d3h or +45m
+func parseDateOffset(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid --fix-dates offset %q, expected a duration such as +1h or -2d3h", s)
+	sign, rest := time.Duration(1), s
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		sign, rest = -1, rest[1:]
+	case strings.HasPrefix(rest, "+"):
+		rest = rest[1:]
+	}
+
+	var days int
+	if d, after, ok := strings.Cut(rest, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		days, rest = n, after
+	}
+	var d time.Duration
+	if rest != "" {
+		var err error
+		if d, err = time.ParseDuration(rest); err != nil || d < 0 {
+			return 0, invalid
+		}
+	}
+	if days == 0 && d == 0 {
+		return 0, invalid
+	}
+	return sign * (time.Duration(days)*24*time.Hour + d), nil
+}
+
+func runIndexBuild(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.indexSyncCommand(opts, fs, (*CLIHandler).HandleBuildIndex)
+}
+
+func runIndexUpdate(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.indexSyncCommand(opts, fs, (*CLIHandler).HandleUpdateIndex)
+}
+
+func runIndexStatus(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleIndexStatus()
+		})
+	}
+}
+
+func runIndexSearch(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var filter usecase.IndexFilter
+	fs.StringVar(&filter.AlbumID, "album", "", "only media items in this album")
+	fs.StringVar(&filter.Filename, "filename", "", "only media items whose file name contains this text")
+	mediaType := fs.String("type", "", "only photos or only videos")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *mediaType != "" {
+			t, err := domain.ParseMediaType(*mediaType)
+			if err != nil {
+				return &usageError{msg: err.Error()}
+			}
+			filter.MediaType = t
+		}
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			return h.HandleSearchIndex(filter)
+		})
+	}
+}
+
+func runIndexOCR(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	dir := fs.String("dir", "", "directory of the exported photos, including subdirectories")
+	var ocrOpts usecase.OCROptions
+	fs.IntVar(&ocrOpts.Workers, "workers", opts.Config.Workers, "number of files to read concurrently")
+	lang := fs.String("lang", "eng", "languages of the text as tesseract names them, joined by +, such as eng+deu")
+	tesseract := fs.String("tesseract", "tesseract", "tesseract binary")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *dir == "" {
+			return &usageError{msg: "--dir is required"}
+		}
+		if ocrOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		root, err := filepath.Abs(*dir)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return &usageError{msg: fmt.Sprintf("--dir %s is not a directory", *dir)}
+		}
+		ocrOpts.Root = root
+
+		ocrUseCase, err := c.deps.OCRUseCase(opts, *tesseract, *lang)
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the local index", ocrUseCase)
+		h := c.newHandler(opts, HandlerUseCases{OCR: ocrUseCase})
+
+		ctx := opts.shutdown.context()
+
+		return h.HandleIndexText(ctx, root, ocrOpts)
+	}
+}
+
+func runIndexSearchText(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if fs.NArg() == 0 {
+			return &usageError{msg: "expected at least one word to search for"}
+		}
+		ocrUseCase, err := c.deps.OCRUseCase(opts, "", "")
+		if err != nil {
+			return err
+		}
+		opts.shutdown.closeOnExit("the local index", ocrUseCase)
+		h := c.newHandler(opts, HandlerUseCases{OCR: ocrUseCase})
+		return h.HandleSearchText(strings.Join(fs.Args(), " "))
+	}
+}
+
+func runInit(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		prompt := &prompter{in: os.Stdin, out: c.stderr}
+
+		// GPM_* variables apply to this run only, so they are neither offered nor saved
+		config, err := c.deps.LoadConfigFile(opts)
+		switch {
+		case err != nil:
+			fmt.Fprintf(c.stderr, "The current config has problems:\n%v\n\n", err)
+			if ok, err := prompt.confirm("Replace it with a new one?", true); err != nil || !ok {
+				return err
+			}
+			config = domain.DefaultConfig()
+		case config.File != "":
+			fmt.Fprintf(c.stderr, "Changing %s.\n", config.File)
+		}
+
+		if config, err = prompt.configure(config); err != nil {
+			return err
+		}
+		path, err := c.deps.SaveConfig(opts, config)
+		if err != nil {
+			return err
+		}
+		opts.ConfigPath = path
+		if config, err = c.deps.LoadConfig(opts); err != nil {
+			return err
+		}
+		opts.Config = config
+		h := c.newHandler(opts, HandlerUseCases{})
+		h.logger.Info("Saved config", "file", path)
+
+		fmt.Fprintln(c.stderr)
+		credentials := cmp.Or(config.CredentialsPath, filepath.Join(config.Dir, "credentials.json"))
+		if _, err := os.Stat(credentials); err != nil {
+			fmt.Fprintf(c.stderr, "Log in with 'auth login' once %s is in place.\n", credentials)
+		} else if ok, err := prompt.confirm("Log in to Google Photos now?", true); err != nil {
+			return err
+		} else if ok {
+			if err := c.login(opts, domain.AuthFlowAuto, config.AuthTimeout, false); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintln(c.stderr)
+		line, err := prompt.schedule(path)
+		if err != nil || line == "" {
+			return err
+		}
+		fmt.Fprintf(c.stderr, "Add this line to your crontab (crontab -e):\n")
+		fmt.Fprintln(c.stdout, line)
+		return nil
+	}
+}
+
+func runSharedList(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	req := pageFlags(fs)
+	all := fs.Bool("all", false, "follow page tokens and list every shared album")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if err := checkAllFlag(*all, *req); err != nil {
+			return err
+		}
+		h, err := c.sharingHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleListSharedAlbums(configuredPage(*req, opts, domain.MaxAlbumPageSize), *all)
+	}
+}
+
+func runSharedJoin(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.sharingArgCommand(opts, fs, (*CLIHandler).HandleJoinSharedAlbum)
+}
+
+func runSharedLeave(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.sharingArgCommand(opts, fs, (*CLIHandler).HandleLeaveSharedAlbum)
+}
+
+func runSharesList(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		h, err := c.sharingHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleListShareInventory()
+	}
+}
+
+func runAuthLogin(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	flowName := fs.String("auth-flow", string(domain.AuthFlowAuto), "auto, browser or paste (auto detects SSH sessions, missing displays and containers)")
+	headless := fs.Bool("headless", false, "shorthand for --auth-flow paste")
+	timeout := fs.Duration("timeout", opts.Config.AuthTimeout, "how long to wait for the browser to complete authorization")
+	qr := fs.Bool("qr", false, "show the URL to open on another device as a QR code (paste flow)")
+	accessList := fs.String("access", "", "kinds of access to grant, separated by commas: read, upload, edit and share (defaults to the configured ones)")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if *accessList != "" {
+			access, err := domain.ParseAccesses(*accessList)
+			if err != nil {
+				return &usageError{msg: err.Error()}
+			}
+			opts.Config.Scopes = domain.ScopesFor(access)
+		}
+		if *timeout <= 0 {
+			return &usageError{msg: "--timeout must be positive"}
+		}
+		flow, err := domain.ParseAuthFlow(*flowName)
+		if err != nil {
+			return &usageError{msg: err.Error()}
+		}
+		if *headless {
+			flow = domain.AuthFlowPaste
+		}
+		return c.login(opts, flow, *timeout, *qr)
+	}
+}
+
+// login authorizes access for the selected profile with flow, waiting up to timeout for the
+// browser; qr also shows the URL to open on another device as a QR code
+func (c *CLI) login(opts GlobalOptions, flow domain.AuthFlow, timeout time.Duration, qr bool) error {
+	oauthUseCase, err := c.deps.OAuthUseCase(opts)
+	if err != nil {
+		return err
+	}
+	h := c.newHandler(opts, HandlerUseCases{OAuth: oauthUseCase})
+	h.logger.Info("Requesting access", "access", domain.JoinAccesses(domain.AccessesOf(opts.Config.Scopes)))
+	if qr {
+		oauthUseCase.SetURLPresenter(func(url string) {
+			if err := writeQRCode(c.stderr, url); err != nil {
+				h.logger.Warn("Failed to show QR code", "error", err)
+			}
+		})
+	}
+
+	if flow == domain.AuthFlowAuto {
+		flow = usecase.ResolveAuthFlow(flow, DetectAuthEnvironment())
+		h.logger.Info("Detected environment, choosing auth flow (override with --auth-flow)", "flow", flow)
+	}
+
+	// Ctrl-C aborts the flow cleanly instead of killing the process with the port still bound
+	ctx := opts.shutdown.context()
+
+	switch flow {
+	case domain.AuthFlowPaste:
+		return h.HandleHeadlessLogin()
+	default:
+		oauthUseCase.SetCallbackServerConfig(usecase.CallbackServerConfig{Addr: opts.Config.CallbackAddr, Timeout: timeout})
+		return h.HandleLogin(ctx)
+	}
+}
+
+// ensureAccess makes sure the token of the selected profile grants every access a command needs.
+// A token lacking some is extended with one more consent, asked for on a terminal, which keeps the
+// scopes granted before. Tokens whose scopes are unknown are left to fail on the API call.
+func (c *CLI) ensureAccess(opts GlobalOptions, name string, accesses []domain.Access) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+	oauthUseCase, err := c.deps.OAuthUseCase(opts)
+	if err != nil {
+		// Commands report missing credentials themselves
+		return nil
+	}
+	granted, err := oauthUseCase.GrantedScopes()
+	if err != nil || len(granted) == 0 {
+		return nil
+	}
+	var missing []domain.Access
+	for _, access := range accesses {
+		if !slices.Contains(granted, access.Scope()) {
+			missing = append(missing, access)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	needed := domain.JoinAccesses(missing)
+	if !isTerminal(os.Stdin) {
+		all := domain.JoinAccesses(domain.AccessesOf(append(slices.Clone(granted), domain.ScopesFor(missing)...)))
+		return fmt.Errorf("%w: '%s' needs %s access, which the profile was not granted; run 'auth login --access %s' to grant it", domain.ErrInsufficientScope, name, needed, all)
+	}
+	prompt := &prompter{in: os.Stdin, out: c.stderr}
+	ok, err := prompt.confirm(fmt.Sprintf("'%s' needs %s access, which the profile was not granted. Grant it now?", name, needed), true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: '%s' needs %s access", domain.ErrInsufficientScope, name, needed)
+	}
+	opts.Config.Scopes = slices.Clone(granted)
+	for _, access := range missing {
+		opts.Config.Scopes = append(opts.Config.Scopes, access.Scope())
+	}
+	return c.login(opts, domain.AuthFlowAuto, opts.Config.AuthTimeout, false)
+}
+
+func runSyncRun(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var syncOpts usecase.SyncOptions
+	fs.BoolVar(&syncOpts.Full, "full", false, "list the whole library instead of only items newer than the watermark")
+	fs.DurationVar(&syncOpts.FullEvery, "full-every", usecase.DefaultFullSyncInterval, "run a full sync when the last one is older than this (0 disables)")
+	fs.StringVar(&syncOpts.Dir, "dir", opts.Config.SyncDir, "also mirror originals into this directory")
+	fs.IntVar(&syncOpts.Workers, "workers", opts.Config.Workers, "number of files to download concurrently")
+	fs.BoolVar(&syncOpts.Prune, "prune", false, "delete originals of media items removed from the library")
+	remap := fs.String("remap-root", "", "resume a mirror moved from OLD to NEW, such as from a laptop to a NAS, as OLD=NEW")
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		if syncOpts.FullEvery < 0 {
+			return &usageError{msg: "--full-every must not be negative"}
+		}
+		if syncOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if syncOpts.Prune && syncOpts.Dir == "" {
+			return &usageError{msg: "--prune requires --dir"}
+		}
+		if *remap != "" {
+			from, to, ok := strings.Cut(*remap, "=")
+			if !ok || from == "" || to == "" {
+				return &usageError{msg: "--remap-root must be OLD=NEW"}
+			}
+			if syncOpts.Dir == "" {
+				return &usageError{msg: "--remap-root requires --dir"}
+			}
+			syncOpts.RemapRoot = usecase.RootRemap{From: from, To: to}
+		}
+		return c.withSyncHandler(opts, func(h *CLIHandler) error {
+			// Ctrl-C stops fetching and downloading; the sync state only records finished work
+			ctx := opts.shutdown.context()
+
+			return h.HandleSync(ctx, syncOpts)
+		})
+	}
+}
+
+func runSyncStatus(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		return c.withSyncHandler(opts, func(h *CLIHandler) error {
+			return h.HandleSyncStatus()
+		})
+	}
+}
+
+func runVerifyMirror(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	var verifyOpts usecase.VerifyOptions
+	fs.IntVar(&verifyOpts.Workers, "workers", opts.Config.Workers, "number of files to hash concurrently")
+	all := fs.Bool("all", false, "also list the files that passed")
+	return func() error {
+		if fs.NArg() > 1 {
+			return &usageError{msg: fmt.Sprintf("expected at most 1 argument, got %d", fs.NArg())}
+		}
+		if verifyOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		// Without a directory, the one the last sync mirrored into is checked
+		verifyOpts.Dir = fs.Arg(0)
+		return c.withSyncHandler(opts, func(h *CLIHandler) error {
+			ctx := opts.shutdown.context()
+
+			return h.HandleVerifyMirror(ctx, verifyOpts, *all)
+		})
+	}
+}
+
+func runProfilesList(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		h, err := c.profileHandler(opts)
+		if err != nil {
+			return err
+		}
+		return h.HandleListProfiles()
+	}
+}
+
+func runProfilesAdd(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.profileNameCommand(opts, fs, (*CLIHandler).HandleAddProfile)
+}
+
+func runProfilesSwitch(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.profileNameCommand(opts, fs, (*CLIHandler).HandleSwitchProfile)
+}
+
+func runProfilesRemove(c *CLI, opts GlobalOptions, fs *flag.FlagSet) func() error {
+	return c.profileNameCommand(opts, fs, (*CLIHandler).HandleRemoveProfile)
+}
+
+// profileNameCommand builds an action for profile commands that take a single name argument
+func (c *CLI) profileNameCommand(opts GlobalOptions, fs *flag.FlagSet, handle func(*CLIHandler, string) error) func() error {
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		h, err := c.profileHandler(opts)
+		if err != nil {
+			return err
+		}
+		return handle(h, fs.Arg(0))
+	}
+}
+
+// mediaItemsCommand builds an action for album commands that take an album ID followed by media item IDs
+func (c *CLI) mediaItemsCommand(opts GlobalOptions, fs *flag.FlagSet, handle func(*CLIHandler, string, []string) error) func() error {
+	return func() error {
+		if err := expectMinArgs(fs, 2); err != nil {
+			return err
+		}
+		h, err := c.albumHandler(opts)
+		if err != nil {
+			return err
+		}
+		return handle(h, fs.Arg(0), fs.Args()[1:])
+	}
+}
+
+// downloadCommand builds an action for download commands that take a single album or media item ID
+func (c *CLI) downloadCommand(opts GlobalOptions, fs *flag.FlagSet, handle func(*CLIHandler, context.Context, string, usecase.DownloadOptions) error) func() error {
+	var downloadOpts usecase.DownloadOptions
+	fs.StringVar(&downloadOpts.Dir, "dir", ".", "directory to write files to")
+	fs.IntVar(&downloadOpts.Workers, "workers", opts.Config.Workers, "number of files to download concurrently")
+	fs.IntVar(&downloadOpts.MaxWidth, "max-width", 0, "scale photos down to at most this width (0 keeps the original)")
+	fs.IntVar(&downloadOpts.MaxHeight, "max-height", 0, "scale photos down to at most this height (0 keeps the original)")
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		if downloadOpts.Workers < 1 {
+			return &usageError{msg: "--workers must be at least 1"}
+		}
+		if downloadOpts.MaxWidth < 0 || downloadOpts.MaxHeight < 0 {
+			return &usageError{msg: "--max-width and --max-height must not be negative"}
+		}
+		downloadUseCase, err := c.deps.DownloadUseCase(opts)
+		if err != nil {
+			return err
+		}
+		h := c.newHandler(opts, HandlerUseCases{Download: downloadUseCase})
+
+		// Ctrl-C stops starting new downloads; partial files are removed
+		ctx := opts.shutdown.context()
+
+		return handle(h, ctx, fs.Arg(0), downloadOpts)
+	}
+}
+
+// indexSyncCommand builds an action for index commands that fetch metadata from the API
+func (c *CLI) indexSyncCommand(opts GlobalOptions, fs *flag.FlagSet, handle func(*CLIHandler, context.Context) error) func() error {
+	return func() error {
+		if err := expectArgs(fs, 0); err != nil {
+			return err
+		}
+		return c.withIndexHandler(opts, func(h *CLIHandler) error {
+			// Ctrl-C stops fetching; the index is only replaced once everything was fetched
+			ctx := opts.shutdown.context()
+
+			return handle(h, ctx)
+		})
+	}
+}
+
+// withIndexHandler runs fn with a CLIHandler for index commands and closes the index as the run
+// ends, since the database file stays locked while it is open
+func (c *CLI) withIndexHandler(opts GlobalOptions, fn func(*CLIHandler) error) error {
+	indexUseCase, err := c.deps.IndexUseCase(opts)
+	if err != nil {
+		return err
+	}
+	opts.shutdown.closeOnExit("the local index", indexUseCase)
+
+	return fn(c.newHandler(opts, HandlerUseCases{Index: indexUseCase}))
+}
+
+// sessionIndex loads the local index into memory for tui and serve, kept current by polling for
+// changes until ctx is cancelled. The database is closed again, so the CLI can update it
+// meanwhile. It is nil when the index cannot be loaded, such as before index build, and the
+// session goes without it.
+func (c *CLI) sessionIndex(ctx context.Context, opts GlobalOptions) *usecase.SessionIndex {
+	logger := cmp.Or(opts.Logger, slog.Default())
+	indexUseCase, err := c.deps.IndexUseCase(opts)
+	if err != nil {
+		logger.Warn("Local index not loaded into memory", "error", err)
+		return nil
+	}
+	defer indexUseCase.Close()
+
+	index, err := indexUseCase.Session(ctx, usecase.DefaultWatchInterval)
+	if err != nil {
+		logger.Warn("Local index not loaded into memory", "error", err)
+		return nil
+	}
+	return index
+}
+
+// withSyncHandler runs fn with a CLIHandler for sync commands and closes the index as the run ends
+func (c *CLI) withSyncHandler(opts GlobalOptions, fn func(*CLIHandler) error) error {
+	syncUseCase, err := c.deps.SyncUseCase(opts)
+	if err != nil {
+		return err
+	}
+	opts.shutdown.closeOnExit("the local index", syncUseCase)
+
+	return fn(c.newHandler(opts, HandlerUseCases{Sync: syncUseCase}))
+}
+
+// sharingArgCommand builds an action for sharing commands that take a single album ID or share token
+func (c *CLI) sharingArgCommand(opts GlobalOptions, fs *flag.FlagSet, handle func(*CLIHandler, string) error) func() error {
+	return func() error {
+		if err := expectArgs(fs, 1); err != nil {
+			return err
+		}
+		h, err := c.sharingHandler(opts)
+		if err != nil {
+			return err
+		}
+		return handle(h, fs.Arg(0))
+	}
+}
+
+// albumHandler builds a CLIHandler for album commands
+func (c *CLI) albumHandler(opts GlobalOptions) (*CLIHandler, error) {
+	albumUseCase, err := c.deps.AlbumUseCase(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.newHandler(opts, HandlerUseCases{Album: albumUseCase}), nil
+}
+
+// sharingHandler builds a CLIHandler for sharing commands
+func (c *CLI) sharingHandler(opts GlobalOptions) (*CLIHandler, error) {
+	sharingUseCase, err := c.deps.SharingUseCase(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.newHandler(opts, HandlerUseCases{Sharing: sharingUseCase}), nil
+}
+
+// profileHandler builds a CLIHandler for profile commands
+func (c *CLI) profileHandler(opts GlobalOptions) (*CLIHandler, error) {
+	profileUseCase, err := c.deps.ProfileUseCase(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.newHandler(opts, HandlerUseCases{Profile: profileUseCase}), nil
+}
+
+// newHandler builds a CLIHandler that writes results to stdout in the selected format
+func (c *CLI) newHandler(opts GlobalOptions, useCases HandlerUseCases) *CLIHandler {
+	h := NewCLIHandler(useCases)
+	out := NewFormatter(c.stdout, opts.Output)
+	out.SetTimeZone(opts.Config.TimeZone)
+	h.SetFormatter(out)
+	if opts.Logger != nil {
+		h.SetLogger(opts.Logger)
+	}
+	return h
+}
+
+// optionalBool is a boolean flag that stays nil unless given, so options left out keep their value
+type optionalBool struct {
+	value **bool
+}
+
+// String returns the flag value, or "" when it was not given
+func (b optionalBool) String() string {
+	if b.value == nil || *b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(**b.value)
+}
+
+// Set parses the flag value; a bare flag means true
+func (b optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*b.value = &v
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value
+func (b optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// pageFlags registers the --page-size and --page-token flags of list commands
+func pageFlags(fs *flag.FlagSet) *domain.PageRequest {
+	var req domain.PageRequest
+	fs.IntVar(&req.PageSize, "page-size", 0, "number of results per page (0 uses the configured page size or lets the API decide)")
+	fs.StringVar(&req.PageToken, "page-token", "", "start from this page token")
+	return &req
+}
+
+// configuredPage fills in the configured page size, capped at maxPageSize, when --page-size was not given
+func configuredPage(req domain.PageRequest, opts GlobalOptions, maxPageSize int) domain.PageRequest {
+	if req.PageSize == 0 {
+		req.PageSize = min(opts.Config.PageSize, maxPageSize)
+	}
+	return req
+}
+
+// fieldsFlag registers --fields, which asks the API for a partial response holding only some
+// fields of every item, with example in its usage
+func fieldsFlag(fs *flag.FlagSet, item, example string) *string {
+	return fs.String("fields", "", fmt.Sprintf("only fetch these comma-separated fields of every %s, such as %s", item, example))
+}
+
+// checkAllFlag rejects --all combined with a page selection, since --all always walks every page
+func checkAllFlag(all bool, req domain.PageRequest) error {
+	if all && (req.PageSize != 0 || req.PageToken != "") {
+		return &usageError{msg: "--all cannot be combined with --page-size or --page-token"}
+	}
+	return nil
+}
+
+// expectArgs validates the number of positional arguments left after flag parsing
+func expectArgs(fs *flag.FlagSet, n int) error {
+	if fs.NArg() != n {
+		return &usageError{msg: fmt.Sprintf("expected %d argument(s), got %d", n, fs.NArg())}
+	}
+	return nil
+}
+
+// flagSet reports whether the flag called name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// expectMinArgs validates that at least n positional arguments are left after flag parsing
+func expectMinArgs(fs *flag.FlagSet, n int) error {
+	if fs.NArg() < n {
+		return &usageError{msg: fmt.Sprintf("expected at least %d argument(s), got %d", n, fs.NArg())}
+	}
+	return nil
+}
+
+// findGroup returns the command group with the given name
+func (c *CLI) findGroup(name string) *commandGroup {
+	for i := range c.groups {
+		if c.groups[i].name == name {
+			return &c.groups[i]
+		}
+	}
+	return nil
+}
+
+// standalone returns the command of a group that is a command itself, which has a single
+// command without a name, or nil for groups with subcommands
+func (g *commandGroup) standalone() *command {
+	if len(g.commands) == 1 && g.commands[0].name == "" {
+		return &g.commands[0]
+	}
+	return nil
+}
+
+// findCommand returns the subcommand with the given name
+func (g *commandGroup) findCommand(name string) *command {
+	for i := range g.commands {
+		if g.commands[i].name == name {
+			return &g.commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage prints the top-level help text
+func (c *CLI) printUsage(global *flag.FlagSet) {
+	fmt.Fprintf(c.stderr, "Usage: app [global flags] <command> <subcommand> [flags] [args]\n\nCommands:\n")
+	for _, g := range c.groups {
+		fmt.Fprintf(c.stderr, "  %-10s %s\n", g.name, g.summary)
+	}
+	fmt.Fprintf(c.stderr, "\nGlobal flags:\n")
+	global.PrintDefaults()
+	fmt.Fprintf(c.stderr, "\nRun 'app <command> help' for details about a command.\n")
+}
+
+// printGroupUsage prints the help text for a command group
+func (c *CLI) printGroupUsage(g *commandGroup) {
+	fmt.Fprintf(c.stderr, "Usage: app %s <subcommand> [flags] [args]\n\n%s\n\nSubcommands:\n", g.name, g.summary)
+	tw := tabwriter.NewWriter(c.stderr, 0, 0, 1, ' ', 0)
+	for _, cmd := range g.commands {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	tw.Flush()
+}
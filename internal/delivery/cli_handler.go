@@ -1,104 +1,1438 @@
 package delivery
 
 import (
-	"log"
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"krupesh.faldu/internal/domain"
 	"krupesh.faldu/internal/usecase"
 )
 
-// CLIHandler handles command-line interface interactions
+// CLIHandler handles command-line interface interactions.
+// Use cases that a command does not need may be nil.
 type CLIHandler struct {
-	albumUseCase *usecase.AlbumUseCase
-	oauthUseCase *usecase.OAuthUseCase
+	albumUseCase        *usecase.AlbumUseCase
+	oauthUseCase        *usecase.OAuthUseCase
+	profileUseCase      *usecase.ProfileUseCase
+	sharingUseCase      *usecase.SharingUseCase
+	uploadUseCase       *usecase.UploadUseCase
+	accountUseCase      *usecase.AccountUseCase
+	downloadUseCase     *usecase.DownloadUseCase
+	indexUseCase        *usecase.IndexUseCase
+	syncUseCase         *usecase.SyncUseCase
+	dedupeUseCase       *usecase.DedupeUseCase
+	magicUseCase        *usecase.MagicUseCase
+	contactSheetUseCase *usecase.ContactSheetUseCase
+	layoutUseCase       *usecase.LayoutUseCase
+	reelUseCase         *usecase.ReelUseCase
+	thumbnailUseCase    *usecase.ThumbnailUseCase
+	ocrUseCase          *usecase.OCRUseCase
+	describeUseCase     *usecase.DescribeUseCase
+	out                 *Formatter
+	logger              *slog.Logger
+	// qr receives QR codes of shareable URLs when set
+	qr io.Writer
 }
 
-// NewCLIHandler creates a new instance of CLIHandler
-func NewCLIHandler(albumUseCase *usecase.AlbumUseCase, oauthUseCase *usecase.OAuthUseCase) *CLIHandler {
+// HandlerUseCases are the use cases a CLIHandler works with. Commands set only those they need;
+// the others stay nil.
+type HandlerUseCases struct {
+	Album        *usecase.AlbumUseCase
+	OAuth        *usecase.OAuthUseCase
+	Profile      *usecase.ProfileUseCase
+	Sharing      *usecase.SharingUseCase
+	Upload       *usecase.UploadUseCase
+	Account      *usecase.AccountUseCase
+	Download     *usecase.DownloadUseCase
+	Index        *usecase.IndexUseCase
+	Sync         *usecase.SyncUseCase
+	Dedupe       *usecase.DedupeUseCase
+	Magic        *usecase.MagicUseCase
+	ContactSheet *usecase.ContactSheetUseCase
+	Layout       *usecase.LayoutUseCase
+	Reel         *usecase.ReelUseCase
+	Thumbnail    *usecase.ThumbnailUseCase
+	OCR          *usecase.OCRUseCase
+	Describe     *usecase.DescribeUseCase
+}
+
+// NewCLIHandler creates a new instance of CLIHandler with useCases
+func NewCLIHandler(useCases HandlerUseCases) *CLIHandler {
 	return &CLIHandler{
-		albumUseCase: albumUseCase,
-		oauthUseCase: oauthUseCase,
+		albumUseCase:        useCases.Album,
+		oauthUseCase:        useCases.OAuth,
+		profileUseCase:      useCases.Profile,
+		sharingUseCase:      useCases.Sharing,
+		uploadUseCase:       useCases.Upload,
+		accountUseCase:      useCases.Account,
+		downloadUseCase:     useCases.Download,
+		indexUseCase:        useCases.Index,
+		syncUseCase:         useCases.Sync,
+		dedupeUseCase:       useCases.Dedupe,
+		magicUseCase:        useCases.Magic,
+		contactSheetUseCase: useCases.ContactSheet,
+		layoutUseCase:       useCases.Layout,
+		reelUseCase:         useCases.Reel,
+		thumbnailUseCase:    useCases.Thumbnail,
+		ocrUseCase:          useCases.OCR,
+		describeUseCase:     useCases.Describe,
+		out:                 NewFormatter(os.Stdout, OutputTable),
+		logger:              slog.Default(),
+	}
+}
+
+// SetFormatter replaces the formatter used to write command results
+func (h *CLIHandler) SetFormatter(out *Formatter) {
+	h.out = out
+}
+
+// SetLogger replaces the logger commands report progress and failures to
+func (h *CLIHandler) SetLogger(logger *slog.Logger) {
+	h.logger = logger
+}
+
+// SetQRWriter makes commands that print a shareable URL also render it as a QR code to w; nil disables it
+func (h *CLIHandler) SetQRWriter(w io.Writer) {
+	h.qr = w
+}
+
+// HandleListAlbums handles the list albums command for a single page
+func (h *CLIHandler) HandleListAlbums(req domain.PageRequest) error {
+	h.logger.Info("--- Listing Albums ---")
+
+	page, err := h.albumUseCase.ListAlbums(context.Background(), req)
+	if err != nil {
+		h.logger.Error("Failed to list albums", "error", err)
+		return err
+	}
+
+	if page.HasNext() {
+		h.logger.Info("More results available", "next_page_token", page.NextPageToken)
 	}
+
+	return h.printAlbums(page.Items)
+}
+
+// HandleListAllAlbums handles the list albums command when every page is requested
+func (h *CLIHandler) HandleListAllAlbums(opts domain.ListOptions) error {
+	h.logger.Info("--- Listing All Albums ---")
+
+	albums, err := h.albumUseCase.ListAllAlbums(context.Background(), opts)
+	if err != nil {
+		h.logger.Error("Failed to list albums", "error", err)
+		return err
+	}
+
+	return h.printAlbums(albums)
 }
 
-// HandleListAlbums handles the list albums command
-func (h *CLIHandler) HandleListAlbums() {
-	log.Printf("--- Listing Albums ---")
+// HandleFindAlbums handles the find albums command, listing the albums whose title matches pattern
+func (h *CLIHandler) HandleFindAlbums(pattern string, filter domain.AlbumFilter) error {
+	h.logger.Info("--- Finding Albums ---")
 
-	response, err := h.albumUseCase.ListAlbums()
+	albums, err := h.albumUseCase.FindAlbums(context.Background(), pattern, filter)
 	if err != nil {
-		log.Printf("Failed to list albums: %v", err)
-		return
+		h.logger.Error("Failed to find albums", "error", err)
+		return err
 	}
 
-	h.printAlbums(response.Albums)
+	return h.printAlbums(albums)
+}
+
+// HandleCreateAlbum handles the create album command; an empty title creates a timestamped test album
+func (h *CLIHandler) HandleCreateAlbum(title string) error {
+	h.logger.Info("--- Creating Album ---")
+	if title == "" {
+		title = "test-album-" + time.Now().Format("2006-01-02-15-04-05")
+	}
+
+	album, err := h.albumUseCase.CreateAlbum(context.Background(), title)
+	if err != nil {
+		h.logger.Error("Failed to create album", "error", err)
+		return err
+	}
+
+	h.logger.Info("Successfully created album", "title", album.Title, "album_id", album.ID)
+	return h.out.WriteAlbum(*album)
+}
+
+// HandleCreateAlbumIfNotExists handles the create album command for a title: the album with that
+// title is written if there is one, otherwise it is created
+func (h *CLIHandler) HandleCreateAlbumIfNotExists(ctx context.Context, title string, appCreatedOnly bool) error {
+	h.logger.Info("--- Creating Album ---")
+
+	album, created, err := h.albumUseCase.CreateAlbumIfNotExists(ctx, title, appCreatedOnly)
+	if err != nil {
+		h.logger.Error("Failed to create album", "error", err)
+		return err
+	}
 
-	if response.NextPageToken != "" {
-		log.Printf("Next page token: %s", response.NextPageToken)
-		h.handleNextPage(response.NextPageToken)
+	if created {
+		h.logger.Info("Successfully created album", "title", album.Title, "album_id", album.ID)
+	} else {
+		h.logger.Info("Album already exists, use --force-new to create another", "title", album.Title, "album_id", album.ID)
 	}
+	return h.out.WriteAlbum(*album)
 }
 
-// HandleCreateAlbum handles the create album command
-func (h *CLIHandler) HandleCreateAlbum() {
-	log.Printf("--- Testing Album Creation ---")
-	title := "test-album-" + time.Now().Format("2006-01-02-15-04-05")
+// HandleUpdateAlbum handles the rename and set-cover commands; empty values are left unchanged
+func (h *CLIHandler) HandleUpdateAlbum(albumID, title, coverPhotoMediaItemID string) error {
+	h.logger.Info("--- Updating Album ---")
 
-	album, err := h.albumUseCase.CreateAlbum(title)
+	album, err := h.albumUseCase.UpdateAlbum(context.Background(), albumID, title, coverPhotoMediaItemID)
 	if err != nil {
-		log.Printf("Failed to create album: %v", err)
-		return
+		h.logger.Error("Failed to update album", "error", err)
+		return err
 	}
 
-	log.Printf("Successfully created album: %s with ID: %s", album.Title, album.ID)
+	return h.out.WriteAlbum(*album)
+}
+
+// HandleAddMediaItems handles the add items to album command
+func (h *CLIHandler) HandleAddMediaItems(albumID string, mediaItemIDs []string) error {
+	h.logger.Info("--- Adding Media Items ---")
+
+	if err := h.albumUseCase.AddMediaItems(context.Background(), albumID, mediaItemIDs); err != nil {
+		h.logger.Error("Failed to add media items", "error", err)
+		return err
+	}
+
+	h.logger.Info("Added media items to album", "album_id", albumID)
+	return nil
+}
+
+// HandleRemoveMediaItems handles the remove items from album command
+func (h *CLIHandler) HandleRemoveMediaItems(albumID string, mediaItemIDs []string) error {
+	h.logger.Info("--- Removing Media Items ---")
+
+	if err := h.albumUseCase.RemoveMediaItems(context.Background(), albumID, mediaItemIDs); err != nil {
+		h.logger.Error("Failed to remove media items", "error", err)
+		return err
+	}
+
+	h.logger.Info("Removed media items from album", "album_id", albumID)
+	return nil
 }
 
 // HandleGetAlbum handles the get album by ID command
-func (h *CLIHandler) HandleGetAlbum(albumID string) {
-	log.Printf("--- Getting Album by ID ---")
+func (h *CLIHandler) HandleGetAlbum(albumID, fields string) error {
+	h.logger.Info("--- Getting Album by ID ---")
+
+	album, err := h.albumUseCase.GetAlbumFields(context.Background(), albumID, fields)
+	if err != nil {
+		h.logger.Error("Failed to get album", "error", err)
+		return err
+	}
+
+	return h.out.WriteAlbum(*album)
+}
 
-	album, err := h.albumUseCase.GetAlbumByID(albumID)
+// HandleShareAlbum handles the share album command
+func (h *CLIHandler) HandleShareAlbum(albumID string, options domain.SharedAlbumOptions) error {
+	h.logger.Info("--- Sharing Album ---")
+
+	shareInfo, err := h.sharingUseCase.ShareAlbum(albumID, options)
 	if err != nil {
-		log.Printf("Failed to get album: %v", err)
-		return
+		h.logger.Error("Failed to share album", "error", err)
+		return err
+	}
+
+	return h.printShareInfo(*shareInfo)
+}
+
+// HandleUpdateShareOptions handles the share-options command for an already-shared album
+func (h *CLIHandler) HandleUpdateShareOptions(albumID string, update domain.SharedAlbumOptionsUpdate) error {
+	h.logger.Info("--- Updating Share Options ---")
+
+	shareInfo, err := h.sharingUseCase.UpdateShareOptions(context.Background(), albumID, update)
+	if err != nil {
+		h.logger.Error("Failed to update share options", "error", err)
+		return err
+	}
+
+	return h.printShareInfo(*shareInfo)
+}
+
+// HandleUnshareAlbum handles the unshare album command
+func (h *CLIHandler) HandleUnshareAlbum(albumID string) error {
+	h.logger.Info("--- Unsharing Album ---")
+
+	if err := h.sharingUseCase.UnshareAlbum(albumID); err != nil {
+		h.logger.Error("Failed to unshare album", "error", err)
+		return err
 	}
 
-	log.Printf("Album Info:")
-	log.Printf("- ID: %s", album.ID)
-	log.Printf("- Title: %s", album.Title)
+	h.logger.Info("Album is no longer shared", "album_id", albumID)
+	return nil
 }
 
-// HandleNextPage handles fetching the next page of albums
-func (h *CLIHandler) HandleNextPage(nextPageToken string) {
-	log.Printf("--- Fetching Next Page ---")
+// HandleListSharedAlbums handles the list shared albums command; all follows page tokens to the end
+func (h *CLIHandler) HandleListSharedAlbums(req domain.PageRequest, all bool) error {
+	h.logger.Info("--- Listing Shared Albums ---")
+
+	if all {
+		albums, err := h.sharingUseCase.ListAllSharedAlbums(context.Background())
+		if err != nil {
+			h.logger.Error("Failed to list shared albums", "error", err)
+			return err
+		}
+		return h.printAlbums(albums)
+	}
 
-	response, err := h.albumUseCase.FetchNextPage(nextPageToken)
+	page, err := h.sharingUseCase.ListSharedAlbums(req)
 	if err != nil {
-		log.Printf("Failed to fetch next page: %v", err)
-		return
+		h.logger.Error("Failed to list shared albums", "error", err)
+		return err
 	}
 
-	if len(response.Albums) > 0 {
-		log.Printf("Found %d albums on next page:", len(response.Albums))
-		h.printAlbums(response.Albums)
+	if page.HasNext() {
+		h.logger.Info("More results available", "next_page_token", page.NextPageToken)
 	}
+
+	return h.printAlbums(page.Items)
 }
 
-// printAlbums prints album information to the console
-func (h *CLIHandler) printAlbums(albums []domain.Album) {
+// HandleListShareInventory handles the shares list command, listing every album the account shares
+func (h *CLIHandler) HandleListShareInventory() error {
+	h.logger.Info("--- Listing Owned Shares ---")
+
+	albums, err := h.sharingUseCase.ListOwnedSharedAlbums(context.Background())
+	if err != nil {
+		h.logger.Error("Failed to list owned shared albums", "error", err)
+		return err
+	}
+
 	if len(albums) == 0 {
-		log.Printf("No albums found.")
-		return
+		h.logger.Info("No shared albums found.")
+	}
+
+	return h.out.WriteShareInventory(albums)
+}
+
+// HandleJoinSharedAlbum handles the join shared album command
+func (h *CLIHandler) HandleJoinSharedAlbum(shareToken string) error {
+	h.logger.Info("--- Joining Shared Album ---")
+
+	album, err := h.sharingUseCase.JoinSharedAlbum(shareToken)
+	if err != nil {
+		h.logger.Error("Failed to join shared album", "error", err)
+		return err
+	}
+
+	return h.out.WriteAlbum(*album)
+}
+
+// HandleLeaveSharedAlbum handles the leave shared album command
+func (h *CLIHandler) HandleLeaveSharedAlbum(shareToken string) error {
+	h.logger.Info("--- Leaving Shared Album ---")
+
+	if err := h.sharingUseCase.LeaveSharedAlbum(shareToken); err != nil {
+		h.logger.Error("Failed to leave shared album", "error", err)
+		return err
+	}
+
+	h.logger.Info("Left shared album")
+	return nil
+}
+
+// HandleUploadDirectory handles the media upload command; cancelling ctx stops starting new uploads
+func (h *CLIHandler) HandleUploadDirectory(ctx context.Context, dir string, opts usecase.UploadOptions) error {
+	h.logger.Info("--- Uploading Directory ---")
+
+	summary, err := h.uploadUseCase.UploadDirectory(ctx, os.DirFS(dir), opts)
+	if err != nil {
+		h.logger.Error("Failed to upload directory", "error", err)
+		return err
+	}
+
+	for _, name := range summary.Skipped {
+		h.logger.Info("Skipped non-media file", "file", name)
+	}
+	if opts.FixDates != nil {
+		fixed, inferred := 0, 0
+		for _, result := range summary.Results {
+			if result.DatesFixed {
+				fixed++
+			}
+			if result.DateInferred {
+				inferred++
+			}
+		}
+		h.logger.Info("Corrected dates of uploaded files", "files", fixed, "from_file_names", inferred)
+	}
+	if summary.AlbumID != "" {
+		h.logger.Info("Uploaded into album", "album_id", summary.AlbumID)
+	}
+
+	if err := h.out.WriteUploadResults(summary.Results); err != nil {
+		return err
+	}
+
+	if failed := summary.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d files failed to upload", failed, len(summary.Results))
+	}
+	return nil
+}
+
+// HandleWatch handles the watch command until ctx is cancelled
+func (h *CLIHandler) HandleWatch(ctx context.Context, dir string, opts usecase.WatchOptions) error {
+	h.logger.Info("--- Watching Directory ---", "dir", dir)
+
+	uploaded, failed := 0, 0
+	err := h.uploadUseCase.Watch(ctx, os.DirFS(dir), opts, func(result usecase.UploadResult) {
+		if result.Error != "" {
+			failed++
+			h.logger.Warn("Failed to upload file", "file", result.Path, "error", result.Error)
+			return
+		}
+		uploaded++
+		h.logger.Info("Uploaded file", "file", result.Path, "media_item_id", result.MediaItemID)
+	})
+	if err != nil {
+		h.logger.Error("Failed to watch directory", "error", err)
+		return err
+	}
+
+	h.logger.Info("Stopped watching directory", "uploaded", uploaded, "failed_attempts", failed)
+	return nil
+}
+
+// HandleDaemon handles the daemon run command, starting each job with run on its schedule until
+// ctx is cancelled
+func (h *CLIHandler) HandleDaemon(ctx context.Context, daemonUseCase *usecase.DaemonUseCase, jobs []domain.DaemonJob, loc *time.Location, run usecase.JobRunner) error {
+	h.logger.Info("--- Running Daemon ---", "jobs", len(jobs))
+
+	if err := daemonUseCase.Run(ctx, jobs, loc, run); err != nil {
+		h.logger.Error("Failed to run daemon", "error", err)
+		return err
+	}
+
+	h.logger.Info("Daemon stopped")
+	return nil
+}
+
+// HandleDaemonStatus handles the daemon status command
+func (h *CLIHandler) HandleDaemonStatus(daemonUseCase *usecase.DaemonUseCase, jobs []domain.DaemonJob) error {
+	statuses, err := daemonUseCase.Status(jobs)
+	if err != nil {
+		h.logger.Error("Failed to read job status", "error", err)
+		return err
+	}
+
+	return h.out.WriteJobStatuses(statuses)
+}
+
+// HandleBackup handles the backup run command; cancelling ctx stops starting new copies, and the
+// ones made are recorded so the next run resumes
+func (h *CLIHandler) HandleBackup(ctx context.Context, backupUseCase *usecase.BackupUseCase, opts usecase.BackupOptions) error {
+	h.logger.Info("--- Backing Up Media Items ---")
+
+	report, err := backupUseCase.Backup(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to back up media items", "error", err)
+		return err
+	}
+
+	if len(report.Results) == 0 {
+		h.logger.Info("Backup is up to date.", "target", report.Target, "media_items", report.Present)
+		return nil
+	}
+	if err := h.out.WriteBackupResults(report.Results); err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d media items could not be backed up; run the backup again to retry them", failed, len(report.Results))
+	}
+	return nil
+}
+
+// HandleBackupStatus handles the backup status command
+func (h *CLIHandler) HandleBackupStatus(ctx context.Context, backupUseCase *usecase.BackupUseCase) error {
+	status, err := backupUseCase.Status(ctx)
+	if err != nil {
+		h.logger.Error("Failed to read backup manifest", "error", err)
+		return err
+	}
+
+	return h.out.WriteBackupStatus(*status)
+}
+
+// HandleImportTakeout handles the import takeout command; cancelling ctx stops starting new uploads
+func (h *CLIHandler) HandleImportTakeout(ctx context.Context, dir string, opts usecase.TakeoutOptions) error {
+	h.logger.Info("--- Importing Takeout Export ---")
+
+	result, err := h.uploadUseCase.ImportTakeout(ctx, os.DirFS(dir), opts)
+	if result == nil {
+		h.logger.Error("Failed to import Takeout export", "error", err)
+		return err
+	}
+
+	for _, name := range result.Skipped {
+		h.logger.Info("Skipped non-media file", "file", name)
+	}
+	if result.Duplicates > 0 {
+		h.logger.Info("Left out copies of photos in several folders", "files", result.Duplicates)
+	}
+	for _, album := range result.Albums {
+		if album.Error != "" {
+			h.logger.Warn("Failed to rebuild album", "title", album.Title, "media_items", album.MediaItems, "error", album.Error)
+			continue
+		}
+		h.logger.Info("Rebuilt album", "title", album.Title, "album_id", album.AlbumID, "media_items", album.MediaItems, "description_header", album.Header)
+	}
+
+	if err := h.out.WriteTakeoutItems(result.Items, opts.DryRun); err != nil {
+		return err
+	}
+	if err != nil {
+		h.logger.Error("Takeout import was interrupted", "error", err)
+		return err
+	}
+
+	if failed := result.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d files and albums failed to import", failed, len(result.Items)+len(result.Albums))
+	}
+	return nil
+}
+
+// HandleRestoreAlbum handles the restore album command; cancelling ctx stops starting new uploads
+func (h *CLIHandler) HandleRestoreAlbum(ctx context.Context, archive string, opts usecase.TakeoutOptions) error {
+	h.logger.Info("--- Restoring Album ---")
+
+	result, err := h.uploadUseCase.RestoreAlbum(ctx, archive, opts)
+	if result == nil {
+		h.logger.Error("Failed to restore album", "error", err)
+		return err
+	}
+	if result.Existing > 0 {
+		h.logger.Info("Left out media items the album already holds", "media_items", result.Existing)
+	}
+
+	for _, album := range result.Albums {
+		if album.Error != "" {
+			h.logger.Warn("Failed to rebuild album", "title", album.Title, "media_items", album.MediaItems, "error", album.Error)
+			continue
+		}
+		h.logger.Info("Rebuilt album", "title", album.Title, "album_id", album.AlbumID, "media_items", album.MediaItems, "description_header", album.Header)
+	}
+
+	if err := h.out.WriteTakeoutItems(result.Items, opts.DryRun); err != nil {
+		return err
+	}
+	if err != nil {
+		h.logger.Error("Restore was interrupted", "error", err)
+		return err
+	}
+
+	if failed := result.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d files and albums failed to restore", failed, len(result.Items)+len(result.Albums))
+	}
+	return nil
+}
+
+// HandlePreviewDateFix handles media upload --preview, showing how fix changes the dates of the
+// files in dir without uploading them
+func (h *CLIHandler) HandlePreviewDateFix(dir string, fix usecase.DateFix) error {
+	h.logger.Info("--- Previewing Date Corrections ---")
+
+	results, err := h.uploadUseCase.PreviewDateFix(os.DirFS(dir), fix)
+	if err != nil {
+		h.logger.Error("Failed to preview date corrections", "error", err)
+		return err
+	}
+	return h.out.WriteDateFixResults(results)
+}
+
+// HandleDescribeMediaItems handles media describe, setting the description of the media items with
+// the given IDs or of those in albumID, and fails when a description could not be set
+func (h *CLIHandler) HandleDescribeMediaItems(ctx context.Context, ids []string, albumID string, opts usecase.DescribeOptions) error {
+	h.logger.Info("--- Describing Media Items ---")
+
+	results, err := h.describeUseCase.DescribeMediaItems(ctx, ids, albumID, opts)
+	if err != nil {
+		h.logger.Error("Failed to describe media items", "error", err)
+		return err
+	}
+	if err := h.out.WriteDescribeResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("the descriptions of %d of %d media items could not be set", failed, len(results))
+	}
+	return nil
+}
+
+// HandleMakeThumbnails handles media thumbnails, writing a thumbnail of every photo in dir to
+// opts.Out without contacting Google, and fails when a thumbnail could not be made
+func (h *CLIHandler) HandleMakeThumbnails(ctx context.Context, dir string, opts usecase.ThumbnailOptions) error {
+	h.logger.Info("--- Making Thumbnails ---")
+
+	results, err := h.thumbnailUseCase.MakeThumbnails(ctx, os.DirFS(dir), opts)
+	if err != nil {
+		h.logger.Error("Failed to make thumbnails", "error", err)
+		return err
+	}
+	if err := h.out.WriteThumbnailResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d thumbnails could not be made", failed, len(results))
+	}
+	return nil
+}
+
+// HandleServe handles the serve command, answering API requests on addr until ctx is cancelled.
+// Without opts.Token a random token is made up and logged.
+func (h *CLIHandler) HandleServe(ctx context.Context, addr string, opts APIServerOptions, galleryUseCase *usecase.GalleryUseCase, indexUseCase func() (*usecase.IndexUseCase, error)) error {
+	h.logger.Info("--- Serving API ---")
+
+	if opts.Token == "" {
+		token, err := newAPIToken()
+		if err != nil {
+			return err
+		}
+		opts.Token = token
+		// Clients cannot connect without it, so it is shown even with --quiet
+		h.logger.Warn("No --token given, clients must send this bearer token", "token", token)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		h.logger.Error("Failed to listen", "addr", addr, "error", err)
+		return err
+	}
+
+	server := NewAPIServer(h.albumUseCase, h.uploadUseCase, galleryUseCase, indexUseCase, opts)
+	server.SetLogger(h.logger)
+	h.logger.Info("Listening for API requests", "addr", l.Addr().String(), "gallery", "http://"+l.Addr().String()+"/ui/")
+	if err := server.Serve(ctx, l); err != nil {
+		h.logger.Error("API server failed", "error", err)
+		return err
+	}
+	h.logger.Info("API server stopped")
+	return nil
+}
+
+// HandleTUI handles the tui command
+func (h *CLIHandler) HandleTUI(ctx context.Context, galleryUseCase *usecase.GalleryUseCase, opts TUIOptions) error {
+	tui := NewTUI(h.albumUseCase, galleryUseCase, h.downloadUseCase, opts)
+	if err := tui.Run(ctx); err != nil {
+		h.logger.Error("Terminal UI failed", "error", err)
+		return err
+	}
+	return nil
+}
+
+// HandleDownloadItem handles the download item command
+func (h *CLIHandler) HandleDownloadItem(ctx context.Context, mediaItemID string, opts usecase.DownloadOptions) error {
+	h.logger.Info("--- Downloading Media Item ---")
+
+	results, err := h.downloadUseCase.DownloadItem(ctx, mediaItemID, opts)
+	if err != nil {
+		h.logger.Error("Failed to download media item", "error", err)
+		return err
+	}
+
+	return h.printDownloadResults(results)
+}
+
+// HandleDownloadAlbum handles the download album command; cancelling ctx stops starting new downloads
+func (h *CLIHandler) HandleDownloadAlbum(ctx context.Context, albumID string, opts usecase.DownloadOptions) error {
+	h.logger.Info("--- Downloading Album ---")
+
+	results, err := h.downloadUseCase.DownloadAlbum(ctx, albumID, opts)
+	if err != nil {
+		h.logger.Error("Failed to download album", "error", err)
+		return err
+	}
+
+	return h.printDownloadResults(results)
+}
+
+// HandlePrintAlbum handles the download print command; cancelling ctx stops starting new downloads
+func (h *CLIHandler) HandlePrintAlbum(ctx context.Context, albumID string, opts usecase.PrintOptions) error {
+	h.logger.Info("--- Preparing Album For Print ---")
+
+	results, err := h.downloadUseCase.PrepareAlbumForPrint(ctx, albumID, opts)
+	if err != nil {
+		h.logger.Error("Failed to prepare album for print", "error", err)
+		return err
+	}
+
+	if len(results) == 0 {
+		h.logger.Info("No photos found.")
+	}
+
+	if err := h.out.WritePrintResults(results); err != nil {
+		return err
+	}
+
+	lowRes, failed := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case usecase.PrintLowRes:
+			lowRes++
+		case usecase.PrintFailed:
+			failed++
+		}
+	}
+	if lowRes > 0 {
+		h.logger.Warn("Prints below the minimum DPI were left out", "prints", lowRes, "total", len(results), "min_dpi", opts.MinDPI)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d prints could not be prepared", failed, len(results))
+	}
+	return nil
+}
+
+// HandleExportAlbum handles the export album command; cancelling ctx stops the export before the
+// archive is written
+func (h *CLIHandler) HandleExportAlbum(ctx context.Context, albumID string, opts usecase.ExportOptions) error {
+	h.logger.Info("--- Exporting Album ---")
+
+	result, err := h.downloadUseCase.ExportAlbum(ctx, albumID, opts)
+	if err != nil {
+		h.logger.Error("Failed to export album", "error", err)
+		return err
+	}
+
+	if err := h.out.WriteExportResult(*result); err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d of %d originals could not be downloaded and were left out", len(result.Failed), result.MediaItems)
+	}
+	return nil
+}
+
+// HandleBuildIndex handles the index build command, replacing the local index with fresh metadata
+func (h *CLIHandler) HandleBuildIndex(ctx context.Context) error {
+	h.logger.Info("--- Building Index ---")
+
+	result, err := h.indexUseCase.Build(ctx)
+	if err != nil {
+		h.logger.Error("Failed to build index", "error", err)
+		return err
+	}
+
+	return h.out.WriteIndexResult(*result)
+}
+
+// HandleUpdateIndex handles the index update command
+func (h *CLIHandler) HandleUpdateIndex(ctx context.Context) error {
+	h.logger.Info("--- Updating Index ---")
+
+	result, err := h.indexUseCase.Update(ctx)
+	if err != nil {
+		h.logger.Error("Failed to update index", "error", err)
+		return err
+	}
+
+	return h.out.WriteIndexResult(*result)
+}
+
+// HandleIndexStatus handles the index status command
+func (h *CLIHandler) HandleIndexStatus() error {
+	h.logger.Info("--- Index Status ---")
+
+	stats, err := h.indexUseCase.Status()
+	if err != nil {
+		h.logger.Error("Failed to read index", "error", err)
+		return err
+	}
+
+	return h.out.WriteIndexStats(*stats)
+}
+
+// HandleSearchIndex handles the index search command
+func (h *CLIHandler) HandleSearchIndex(filter usecase.IndexFilter) error {
+	h.logger.Info("--- Searching Index ---")
+
+	items, err := h.indexUseCase.SearchMediaItems(context.Background(), filter)
+	if err != nil {
+		h.logger.Error("Failed to search index", "error", err)
+		return err
+	}
+
+	if len(items) == 0 {
+		h.logger.Info("No media items found.")
+	}
+
+	return h.out.WriteMediaItems(items)
+}
+
+// HandleIndexText handles index ocr, reading the text of every photo in root into the local index,
+// and fails when a file could not be read
+func (h *CLIHandler) HandleIndexText(ctx context.Context, root string, opts usecase.OCROptions) error {
+	h.logger.Info("--- Reading Text ---")
+
+	results, err := h.ocrUseCase.IndexText(ctx, os.DirFS(root), opts)
+	if err != nil {
+		h.logger.Error("Failed to read text", "error", err)
+		return err
+	}
+	if err := h.out.WriteOCRResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("the text of %d of %d files could not be read", failed, len(results))
+	}
+	return nil
+}
+
+// HandleSearchText handles index search-text, writing the files whose text holds every word of query
+func (h *CLIHandler) HandleSearchText(query string) error {
+	h.logger.Info("--- Searching Text ---")
+
+	matches, err := h.ocrUseCase.SearchText(query)
+	if err != nil {
+		h.logger.Error("Failed to search text", "error", err)
+		return err
+	}
+
+	if len(matches) == 0 {
+		h.logger.Info("No text found.")
+	}
+
+	return h.out.WriteTextMatches(matches)
+}
+
+// HandleAlbumOverlap handles report overlap, writing the pairs of indexed albums that share media
+// items, or with matrix the matrix of the albums sharing the most
+func (h *CLIHandler) HandleAlbumOverlap(opts usecase.OverlapOptions, matrix bool) error {
+	h.logger.Info("--- Comparing Albums ---")
+
+	report, err := h.indexUseCase.AlbumOverlap(context.Background(), opts)
+	if err != nil {
+		h.logger.Error("Failed to compare albums", "error", err)
+		return err
+	}
+
+	if len(report.Pairs) == 0 {
+		h.logger.Info("No albums share media items.")
+	}
+
+	if matrix {
+		return h.out.WriteOverlapMatrix(report)
+	}
+	return h.out.WriteAlbumOverlaps(report.Pairs)
+}
+
+// HandleCategoryReport handles report categories, writing how many media items each content
+// category holds, the largest first
+func (h *CLIHandler) HandleCategoryReport(ctx context.Context, opts usecase.CategoryOptions) error {
+	h.logger.Info("--- Counting Media Items by Category ---")
+
+	counts, err := h.indexUseCase.CategoryReport(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to count media items by category", "error", err)
+		return err
+	}
+
+	return h.out.WriteCategoryCounts(counts)
+}
+
+// HandleLibraryStats handles stats, writing a health report of the library from the local index or
+// the API
+func (h *CLIHandler) HandleLibraryStats(ctx context.Context, opts usecase.StatsOptions) error {
+	h.logger.Info("--- Gathering Library Statistics ---")
+
+	stats, err := h.indexUseCase.Stats(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to gather library statistics", "error", err)
+		return err
+	}
+
+	h.logger.Info("Library statistics", "source", stats.Source, "updated", stats.UpdatedAt.Format(time.RFC3339))
+	return h.out.WriteLibraryStats(*stats)
+}
+
+// HandleForecastGrowth handles report growth, writing when the library outgrows each storage tier,
+// or with monthly its forecast size at the end of every month
+func (h *CLIHandler) HandleForecastGrowth(opts usecase.GrowthOptions, monthly bool) error {
+	h.logger.Info("--- Forecasting Library Growth ---")
+
+	forecast, err := h.indexUseCase.ForecastGrowth(context.Background(), opts)
+	if err != nil {
+		h.logger.Error("Failed to forecast library growth", "error", err)
+		return err
+	}
+
+	h.logger.Info("Library growth",
+		"model", forecast.Model,
+		"source", forecast.Source,
+		"photos", forecast.Current.Photos,
+		"videos", forecast.Current.Videos,
+		"estimated_size", formatBytes(forecast.Current.Size),
+		"photos_per_month", math.Round(forecast.PhotosPerMonth),
+		"videos_per_month", math.Round(forecast.VideosPerMonth))
+
+	if monthly {
+		return h.out.WriteGrowthMonths(forecast.Months)
+	}
+	return h.out.WriteTierForecasts(forecast.Tiers)
+}
+
+// HandlePlanQuota handles plan quota, writing the requests every step of a pipeline sends. With
+// countItems and countAlbums, the media items and albums of the local index are planned for.
+func (h *CLIHandler) HandlePlanQuota(opts usecase.QuotaPlanOptions, countItems, countAlbums bool) error {
+	h.logger.Info("--- Planning API Quota ---")
+
+	if countItems || countAlbums {
+		stats, err := h.indexUseCase.Status()
+		if err != nil {
+			h.logger.Error("Failed to read index", "error", err)
+			return err
+		}
+		if countItems {
+			opts.Items = stats.MediaItems
+		}
+		if countAlbums {
+			opts.Albums = stats.Albums
+		}
+	}
+
+	plan, err := usecase.PlanQuota(opts)
+	if err != nil {
+		h.logger.Error("Failed to plan API quota", "error", err)
+		return err
+	}
+
+	h.logger.Info("Quota plan",
+		"pipeline", plan.Pipeline,
+		"items", plan.Items,
+		"albums", plan.Albums,
+		"api_calls", plan.APICalls,
+		"media_calls", plan.MediaCalls,
+		"max_rps", opts.MaxRPS,
+		"duration", time.Duration(plan.Seconds)*time.Second,
+		"days", plan.Days)
+	if plan.QuotaBound {
+		h.logger.Warn("The daily quotas, not the rate limit, set how long this takes; plan to resume it on later days", "days", plan.Days)
+	}
+	if plan.Cost != nil {
+		h.logger.Info("Backup cost estimate (USD)",
+			"storage_gb", math.Round(plan.Cost.StorageGB*10)/10,
+			"storage_per_month", math.Round(plan.Cost.Storage*100)/100,
+			"upload", math.Round(plan.Cost.Upload*100)/100,
+			"restore_egress", math.Round(plan.Cost.Egress*100)/100)
+	}
+
+	return h.out.WriteQuotaSteps(plan.Steps)
+}
+
+// HandleListIndexedAlbums handles the list albums command when served from the local index
+func (h *CLIHandler) HandleListIndexedAlbums() error {
+	h.logger.Info("--- Listing Indexed Albums ---")
+
+	albums, err := h.indexUseCase.Albums()
+	if err != nil {
+		h.logger.Error("Failed to list indexed albums", "error", err)
+		return err
+	}
+
+	return h.printAlbums(albums)
+}
+
+// HandleSync handles the sync run command; cancelling ctx stops fetching and downloading
+func (h *CLIHandler) HandleSync(ctx context.Context, opts usecase.SyncOptions) error {
+	h.logger.Info("--- Syncing ---")
+
+	summary, err := h.syncUseCase.Sync(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to sync", "error", err)
+		return err
+	}
+
+	h.logger.Info("Sync finished", "full", summary.Full,
+		"added", summary.Count(usecase.SyncAdded), "removed", summary.Count(usecase.SyncRemoved),
+		"renamed", summary.Count(usecase.SyncRenamed), "downloaded", summary.Count(usecase.SyncDownloaded))
+
+	if err := h.out.WriteSyncChanges(summary.Changes); err != nil {
+		return err
+	}
+
+	if failed := summary.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d changes could not be applied to local files", failed, len(summary.Changes))
+	}
+	return nil
+}
+
+// HandleSyncStatus handles the sync status command
+func (h *CLIHandler) HandleSyncStatus() error {
+	h.logger.Info("--- Sync Status ---")
+
+	status, err := h.syncUseCase.Status()
+	if err != nil {
+		h.logger.Error("Failed to read sync state", "error", err)
+		return err
+	}
+
+	return h.out.WriteSyncStatus(*status)
+}
+
+// HandleVerifyMirror handles the verify-mirror command and writes the files that did not pass,
+// or every file with all
+func (h *CLIHandler) HandleVerifyMirror(ctx context.Context, opts usecase.VerifyOptions, all bool) error {
+	h.logger.Info("--- Verifying Mirror ---")
+
+	report, err := h.syncUseCase.VerifyMirror(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to verify mirror", "error", err)
+		return err
+	}
+
+	h.logger.Info("Verification finished", "dir", report.Dir, "ok", report.Count(usecase.MirrorOK),
+		"corrupt", report.Count(usecase.MirrorCorrupt), "missing", report.Count(usecase.MirrorMissing),
+		"unreadable", report.Count(usecase.MirrorUnreadable), "recorded", report.Count(usecase.MirrorRecorded),
+		"untracked", report.Count(usecase.MirrorUntracked))
+
+	files := report.Files
+	if !all {
+		files = slices.DeleteFunc(slices.Clone(files), func(f usecase.MirrorFile) bool { return f.Status == usecase.MirrorOK })
+	}
+	if err := h.out.WriteMirrorFiles(files); err != nil {
+		return err
+	}
+
+	if problems := report.Problems(); problems > 0 {
+		return fmt.Errorf("%d of %d files of the mirror are corrupt, missing or unreadable", problems, len(report.Files)-report.Count(usecase.MirrorUntracked))
+	}
+	return nil
+}
+
+// HandleFindDuplicates handles the dedupe find command and writes every group of likely duplicates
+func (h *CLIHandler) HandleFindDuplicates(ctx context.Context, opts usecase.DedupeOptions) error {
+	h.logger.Info("--- Finding Duplicates ---")
+
+	groups, err := h.dedupeUseCase.FindDuplicates(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to find duplicates", "error", err)
+		return err
+	}
+
+	if len(groups) == 0 {
+		h.logger.Info("No duplicates found.")
+	}
+
+	return h.out.WriteDuplicateGroups(groups)
+}
+
+// HandleFindSimilar handles the search similar command, writing the photos that look most like
+// the image in queryPath
+func (h *CLIHandler) HandleFindSimilar(ctx context.Context, queryPath string, opts usecase.SimilarOptions) error {
+	h.logger.Info("--- Finding Similar Photos ---")
+
+	query, err := os.Open(queryPath)
+	if err != nil {
+		h.logger.Error("Failed to open query image", "error", err)
+		return err
+	}
+	defer query.Close()
+
+	matches, err := h.dedupeUseCase.FindSimilar(ctx, query, opts)
+	if err != nil {
+		h.logger.Error("Failed to find similar photos", "error", err)
+		return err
+	}
+
+	if len(matches) == 0 {
+		h.logger.Info("No similar photos found.")
+	}
+
+	return h.out.WriteSimilarMatches(matches)
+}
+
+// HandleReviewDuplicates handles the dedupe find command with --review: for each group the user picks
+// the item to keep from input, and the others are collected in a new album for deletion in Google Photos
+func (h *CLIHandler) HandleReviewDuplicates(ctx context.Context, opts usecase.DedupeOptions, albumTitle string, input io.Reader) error {
+	h.logger.Info("--- Reviewing Duplicates ---")
+
+	groups, err := h.dedupeUseCase.FindDuplicates(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to find duplicates", "error", err)
+		return err
+	}
+
+	if len(groups) == 0 {
+		h.logger.Info("No duplicates found.")
+		return nil
 	}
 
-	log.Printf("Albums:")
-	for _, album := range albums {
-		log.Printf("- %s (%s)", album.Title, album.ID)
+	discard, err := reviewDuplicates(groups, bufio.NewReader(input), h.out.timeZone, h.logger)
+	if err != nil {
+		return err
+	}
+	if len(discard) == 0 {
+		h.logger.Info("No duplicates selected for deletion.")
+		return nil
+	}
+
+	if albumTitle == "" {
+		albumTitle = "duplicates-" + time.Now().Format("2006-01-02-15-04-05")
+	}
+
+	album, err := h.dedupeUseCase.CollectForReview(ctx, albumTitle, discard)
+	if err != nil {
+		h.logger.Error("Failed to collect duplicates", "error", err)
+		return err
+	}
+
+	h.logger.Info("Collected duplicates in album; delete them there in Google Photos", "duplicates", len(discard), "title", album.Title)
+	return h.out.WriteAlbum(*album)
+}
+
+// Answers of askKeep that do not pick an item
+const (
+	reviewSkip = 0
+	reviewQuit = -1
+)
+
+// reviewDuplicates asks which item of each group to keep, showing creation times in loc, and
+// returns the IDs of the others. Answering s skips a group and q stops the review, keeping the
+// choices made so far.
+func reviewDuplicates(groups []usecase.DuplicateGroup, input *bufio.Reader, loc *time.Location, logger *slog.Logger) ([]string, error) {
+	var discard []string
+	for g, group := range groups {
+		// Prompts the user has to act on are warnings so --quiet still shows them
+		logger.Warn("Duplicate group", "group", g+1, "groups", len(groups))
+		for i, item := range group.Items {
+			logger.Warn("Duplicate", "item", i+1, "filename", item.Filename, "created", formatCreationTime(inTimeZone(item, loc)), "url", item.ProductURL)
+		}
+
+		keep, err := askKeep(input, len(group.Items), logger)
+		if err != nil {
+			return nil, err
+		}
+		switch keep {
+		case reviewQuit:
+			return discard, nil
+		case reviewSkip:
+			continue
+		}
+
+		for i, item := range group.Items {
+			if i != keep-1 {
+				discard = append(discard, item.ID)
+			}
+		}
+	}
+	return discard, nil
+}
+
+// askKeep reads answers until one picks an item between 1 and n, skips or quits; the end of input quits
+func askKeep(input *bufio.Reader, n int, logger *slog.Logger) (int, error) {
+	for {
+		logger.Warn(fmt.Sprintf("Keep which item? [1-%d, s to skip, q to quit]", n))
+		line, err := input.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return reviewQuit, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to read answer: %v", err)
+		}
+
+		switch answer := strings.TrimSpace(line); answer {
+		case "s", "":
+			return reviewSkip, nil
+		case "q":
+			return reviewQuit, nil
+		default:
+			if keep, err := strconv.Atoi(answer); err == nil && keep >= 1 && keep <= n {
+				return keep, nil
+			}
+			logger.Warn("Invalid answer", "answer", answer)
+		}
+	}
+}
+
+// HandleApplyMagicRules handles the magic apply command and writes the outcome of every rule
+func (h *CLIHandler) HandleApplyMagicRules(ctx context.Context, opts usecase.MagicOptions) error {
+	h.logger.Info("--- Applying Magic Rules ---")
+
+	results, err := h.magicUseCase.Apply(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to apply magic rules", "error", err)
+		return err
+	}
+
+	if opts.DryRun {
+		h.logger.Info("Dry run: no albums were changed.")
+	}
+	if err := h.out.WriteMagicResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rules could not be applied", failed, len(results))
+	}
+	return nil
+}
+
+// HandleRenderContactSheet handles the render contact-sheet command and writes the rendered pages
+func (h *CLIHandler) HandleRenderContactSheet(ctx context.Context, albumID string, opts usecase.ContactSheetOptions) error {
+	h.logger.Info("--- Rendering Contact Sheet ---")
+
+	pages, err := h.contactSheetUseCase.RenderContactSheet(ctx, albumID, opts)
+	if err != nil {
+		h.logger.Error("Failed to render contact sheet", "error", err)
+		return err
+	}
+
+	if err := h.out.WriteContactSheetPages(pages); err != nil {
+		return err
+	}
+
+	missing := 0
+	for _, page := range pages {
+		missing += page.Missing
+	}
+	if missing > 0 {
+		h.logger.Warn("Thumbnails could not be fetched and show a placeholder", "missing", missing)
+	}
+	return nil
+}
+
+// HandleRenderCalendar handles the render calendar command and writes where the PDF was saved
+func (h *CLIHandler) HandleRenderCalendar(ctx context.Context, opts usecase.CalendarOptions) error {
+	h.logger.Info("--- Rendering Calendar ---")
+
+	result, err := h.layoutUseCase.RenderCalendar(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to render calendar", "error", err)
+		return err
+	}
+	return h.writeLayoutResult(result)
+}
+
+// HandleRenderPhotoBook handles the render photo-book command and writes where the PDF was saved
+func (h *CLIHandler) HandleRenderPhotoBook(ctx context.Context, opts usecase.PhotoBookOptions) error {
+	h.logger.Info("--- Rendering Photo Book ---")
+
+	result, err := h.layoutUseCase.RenderPhotoBook(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to render photo book", "error", err)
+		return err
+	}
+	return h.writeLayoutResult(result)
+}
+
+// writeLayoutResult writes a rendered calendar or photo book, warning about photos left blank
+func (h *CLIHandler) writeLayoutResult(result *usecase.LayoutResult) error {
+	if err := h.out.WriteLayoutResult(*result); err != nil {
+		return err
+	}
+	if result.Missing > 0 {
+		h.logger.Warn("Photos could not be downloaded and were left blank", "missing", result.Missing, "photos", result.Photos)
+	}
+	return nil
+}
+
+// HandleRenderReel handles the render reel command and writes where the video was saved
+func (h *CLIHandler) HandleRenderReel(ctx context.Context, opts usecase.ReelOptions) error {
+	h.logger.Info("--- Rendering Highlight Reel ---")
+
+	result, err := h.reelUseCase.RenderReel(ctx, opts)
+	if err != nil {
+		h.logger.Error("Failed to render highlight reel", "error", err)
+		return err
+	}
+	if err := h.out.WriteReelResult(*result); err != nil {
+		return err
 	}
+	if result.Missing > 0 {
+		h.logger.Warn("Media items could not be downloaded and were left out", "missing", result.Missing)
+	}
+	return nil
+}
+
+// HandleLogin handles the interactive login command using the local callback server;
+// cancelling ctx aborts the flow and shuts the server down
+func (h *CLIHandler) HandleLogin(ctx context.Context) error {
+	h.logger.Info("--- Login ---")
+
+	if err := h.oauthUseCase.CompleteAuthenticationWithServer(ctx); err != nil {
+		h.logger.Error("Failed to authenticate", "error", err)
+		return err
+	}
+
+	h.logger.Info("Authentication completed successfully")
+	return nil
+}
+
+// HandleHeadlessLogin handles authentication on machines without a local browser
+func (h *CLIHandler) HandleHeadlessLogin() error {
+	h.logger.Info("--- Headless Login ---")
+
+	if err := h.oauthUseCase.CompleteAuthenticationHeadless(os.Stdin); err != nil {
+		h.logger.Error("Failed to authenticate", "error", err)
+		return err
+	}
+
+	h.logger.Info("Authentication completed successfully")
+	return nil
+}
+
+// HandleAccountInfo handles the account info command
+func (h *CLIHandler) HandleAccountInfo(ctx context.Context) error {
+	h.logger.Info("--- Account Info ---")
+
+	info, err := h.accountUseCase.GetAccountInfo(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get account info", "error", err)
+		return err
+	}
+
+	return h.out.WriteAccountInfo(*info)
+}
+
+// HandleValidateConfig reports the config file that was found valid
+func (h *CLIHandler) HandleValidateConfig(config domain.Config) error {
+	if config.File == "" {
+		h.logger.Info("No config file found, the defaults and GPM_* variables are valid")
+		return nil
+	}
+	h.logger.Info("Config is valid", "file", config.File)
+	return nil
+}
+
+// HandleConfigSchema writes the JSON Schema of the config file, whatever the output format
+func (h *CLIHandler) HandleConfigSchema(schema map[string]any) error {
+	return h.out.WriteConfigSchema(schema)
+}
+
+// HandleListProfiles handles the list profiles command
+func (h *CLIHandler) HandleListProfiles() error {
+	h.logger.Info("--- Listing Profiles ---")
+
+	profiles, err := h.profileUseCase.ListProfiles()
+	if err != nil {
+		h.logger.Error("Failed to list profiles", "error", err)
+		return err
+	}
+
+	return h.out.WriteProfiles(profiles)
+}
+
+// HandleAddProfile handles the add profile command
+func (h *CLIHandler) HandleAddProfile(name string) error {
+	h.logger.Info("--- Adding Profile ---")
+
+	profile, err := h.profileUseCase.AddProfile(name)
+	if err != nil {
+		h.logger.Error("Failed to add profile", "error", err)
+		return err
+	}
+
+	h.logger.Info("Created profile; log in with it to store its token", "name", profile.Name, "token_path", profile.TokenPath)
+	return nil
+}
+
+// HandleSwitchProfile handles the switch profile command
+func (h *CLIHandler) HandleSwitchProfile(name string) error {
+	h.logger.Info("--- Switching Profile ---")
+
+	if err := h.profileUseCase.SwitchProfile(name); err != nil {
+		h.logger.Error("Failed to switch profile", "error", err)
+		return err
+	}
+
+	h.logger.Info("Active profile", "name", name)
+	return nil
+}
+
+// HandleRemoveProfile handles the remove profile command
+func (h *CLIHandler) HandleRemoveProfile(name string) error {
+	h.logger.Info("--- Removing Profile ---")
+
+	if err := h.profileUseCase.RemoveProfile(name); err != nil {
+		h.logger.Error("Failed to remove profile", "error", err)
+		return err
+	}
+
+	h.logger.Info("Removed profile", "name", name)
+	return nil
+}
+
+// printDownloadResults writes the per-item outcome of a download and fails when any item failed
+func (h *CLIHandler) printDownloadResults(results []usecase.DownloadResult) error {
+	if len(results) == 0 {
+		h.logger.Info("No media items found.")
+	}
+
+	if err := h.out.WriteDownloadResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d media items failed to download", failed, len(results))
+	}
+	return nil
 }
 
-// handleNextPage is a helper method for handling next page requests
-func (h *CLIHandler) handleNextPage(nextPageToken string) {
-	h.HandleNextPage(nextPageToken)
+// printShareInfo writes the sharing state of an album, followed by a QR code of its link when enabled.
+// The QR code uses the short link when there is one, since shorter URLs give smaller codes.
+func (h *CLIHandler) printShareInfo(shareInfo domain.ShareInfo) error {
+	if err := h.out.WriteShareInfo(shareInfo); err != nil {
+		return err
+	}
+
+	link := cmp.Or(shareInfo.ShortURL, shareInfo.ShareableURL)
+	if h.qr != nil && link != "" {
+		return writeQRCode(h.qr, link)
+	}
+	return nil
+}
+
+// printAlbums writes albums to the command output
+func (h *CLIHandler) printAlbums(albums []domain.Album) error {
+	if len(albums) == 0 {
+		h.logger.Info("No albums found.")
+	}
+
+	return h.out.WriteAlbums(albums)
 }
@@ -0,0 +1,39 @@
+package delivery
+
+import (
+	"bufio"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+func TestReviewDuplicates(t *testing.T) {
+	groups := []usecase.DuplicateGroup{
+		{Items: []domain.MediaItem{{ID: "a1"}, {ID: "a2"}, {ID: "a3"}}},
+		{Items: []domain.MediaItem{{ID: "b1"}, {ID: "b2"}}},
+		{Items: []domain.MediaItem{{ID: "c1"}, {ID: "c2"}}},
+		{Items: []domain.MediaItem{{ID: "d1"}, {ID: "d2"}}},
+	}
+
+	// An invalid answer is asked again, s skips a group and q ends the review
+	discard, err := reviewDuplicates(groups, bufio.NewReader(strings.NewReader("9\n2\ns\n1\nq\n")), nil, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []string{"a1", "a3", "c2"}; !slices.Equal(discard, want) {
+		t.Errorf("Expected %v, got %v", want, discard)
+	}
+
+	// The end of input keeps the choices made so far
+	discard, err = reviewDuplicates(groups, bufio.NewReader(strings.NewReader("1")), nil, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []string{"a2", "a3"}; !slices.Equal(discard, want) {
+		t.Errorf("Expected %v, got %v", want, discard)
+	}
+}
@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestCommand_AccessesFollowTheFlags(t *testing.T) {
+	c := NewCLI(nil, io.Discard, io.Discard)
+	find := func(group, name string) command {
+		for _, g := range c.groups {
+			for _, cmd := range g.commands {
+				if g.name == group && cmd.name == name {
+					return cmd
+				}
+			}
+		}
+		t.Fatalf("Expected a command %s %s", group, name)
+		return command{}
+	}
+
+	tests := []struct {
+		group, name string
+		args        []string
+		want        []domain.Access
+	}{
+		{"dedupe", "find", nil, []domain.Access{domain.AccessRead}},
+		{"dedupe", "find", []string{"--review"}, []domain.Access{domain.AccessRead, domain.AccessUpload, domain.AccessEdit}},
+		{"render", "reel", []string{"--album", "a1", "--upload"}, []domain.Access{domain.AccessRead, domain.AccessUpload}},
+		{"stats", "", nil, nil},
+		{"stats", "", []string{"--live"}, []domain.Access{domain.AccessRead}},
+		{"albums", "create", []string{"--title", "Trip"}, []domain.Access{domain.AccessRead, domain.AccessUpload}},
+		{"albums", "create", []string{"--title", "Trip", "--force-new"}, []domain.Access{domain.AccessUpload}},
+		{"media", "describe", []string{"--text", "x", "m1"}, []domain.Access{domain.AccessRead, domain.AccessEdit}},
+		{"tui", "", nil, []domain.Access{domain.AccessRead, domain.AccessUpload, domain.AccessEdit}},
+	}
+	for _, tt := range tests {
+		cmd := find(tt.group, tt.name)
+		fs := flag.NewFlagSet(tt.group, flag.ContinueOnError)
+		cmd.run(c, GlobalOptions{Config: domain.Config{Workers: 1}}, fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("%s %s %v: %v", tt.group, tt.name, tt.args, err)
+		}
+
+		if got := cmd.accesses(fs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s %s %v: expected %v, got %v", tt.group, tt.name, tt.args, tt.want, got)
+		}
+	}
+}
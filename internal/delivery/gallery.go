@@ -0,0 +1,114 @@
+package delivery
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// galleryFiles are the static files of the web gallery, served below /ui/
+//
+//go:embed ui
+var galleryFiles embed.FS
+
+// galleryTemplate is the page of the web gallery; themes redefine its blocks
+//
+//go:embed gallery.html
+var galleryTemplate string
+
+// galleryCSP only lets the gallery load its own files, and thumbnails as blobs fetched by it
+const galleryCSP = "default-src 'self'; img-src 'self' blob:; object-src 'none'; frame-ancestors 'none'"
+
+// galleryPage is what the templates of the gallery page are executed with
+type galleryPage struct {
+	Title string
+}
+
+// GalleryTheme changes the look and layout of the web gallery without rebuilding the binary
+type GalleryTheme struct {
+	// files are the static files of the theme; nil for the built-in look
+	files fs.FS
+	// page is the gallery page rendered with the templates of the theme
+	page []byte
+	// rendered is when the page was rendered, for conditional requests
+	rendered time.Time
+}
+
+// LoadGalleryTheme reads a theme from fsys. Its *.html files are html/template files whose
+// {{define}}s replace the blocks of the gallery page: "title", "head", "login", "sidebar", "main"
+// and "footer", or the whole page when named "gallery.html". Its other files are served below /ui/,
+// in place of the built-in gallery.css and gallery.js when named alike. The page is rendered
+// once, so a broken theme fails here rather than on the first request.
+func LoadGalleryTheme(fsys fs.FS) (*GalleryTheme, error) {
+	tmpl, err := template.New("gallery.html").Parse(galleryTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if fsys != nil {
+		names, err := fs.Glob(fsys, "*.html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read theme: %v", err)
+		}
+		if len(names) > 0 {
+			if tmpl, err = tmpl.ParseFS(fsys, names...); err != nil {
+				return nil, fmt.Errorf("invalid theme: %v", err)
+			}
+		}
+	}
+
+	var page bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&page, "gallery.html", galleryPage{Title: "Google Photos Magic"}); err != nil {
+		return nil, fmt.Errorf("invalid theme: %v", err)
+	}
+	return &GalleryTheme{files: fsys, page: page.Bytes(), rendered: time.Now()}, nil
+}
+
+// galleryHandler serves the web gallery in theme, or the built-in look when theme is nil. It
+// holds no data itself; the page asks for the token and calls the API, so it is served without one.
+func galleryHandler(theme *GalleryTheme) http.Handler {
+	if theme == nil {
+		var err error
+		if theme, err = LoadGalleryTheme(nil); err != nil {
+			panic(err)
+		}
+	}
+	files := http.FileServerFS(galleryFiles)
+	var themeFiles http.Handler
+	if theme.files != nil {
+		themeFiles = http.StripPrefix("/ui", http.FileServerFS(theme.files))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", galleryCSP)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		name := strings.TrimPrefix(r.URL.Path, "/ui/")
+		switch {
+		case name == "" || name == "index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			http.ServeContent(w, r, "index.html", theme.rendered, bytes.NewReader(theme.page))
+		case path.Ext(name) == ".html":
+			// Templates of the theme are not pages of their own
+			http.NotFound(w, r)
+		case themeFiles != nil && isThemeFile(theme.files, name):
+			themeFiles.ServeHTTP(w, r)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+// isThemeFile reports whether name is a regular file of the theme files
+func isThemeFile(fsys fs.FS, name string) bool {
+	if !fs.ValidPath(name) {
+		return false
+	}
+	info, err := fs.Stat(fsys, name)
+	return err == nil && info.Mode().IsRegular()
+}
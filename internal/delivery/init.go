@@ -0,0 +1,266 @@
+package delivery
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// prompter asks questions on out and reads the answers from in, for the init command and for
+// granting the access a command needs
+type prompter struct {
+	in  io.Reader
+	out io.Writer
+}
+
+// configure walks through the settings a first run needs, starting from config, and returns them
+func (p *prompter) configure(config domain.Config) (domain.Config, error) {
+	fmt.Fprintf(p.out, "Press Enter to keep the value in brackets.\n\n")
+
+	dir, err := p.ask("Directory for profiles, tokens and caches", config.Dir, func(dir string) error {
+		if dir == "" {
+			return errors.New("a directory is required")
+		}
+		return nil
+	})
+	if err != nil {
+		return config, err
+	}
+	config.Dir = dir
+
+	fmt.Fprintf(p.out, "\nThe OAuth client comes from the Google Cloud console: enable the Photos Library API, create an\n"+
+		"OAuth client ID of type \"Desktop app\" and download its JSON file.\n")
+	defaultCredentials := filepath.Join(dir, "credentials.json")
+	credentials, err := p.ask("OAuth client file", cmp.Or(config.CredentialsPath, defaultCredentials), p.checkCredentials)
+	if err != nil {
+		return config, err
+	}
+	config.CredentialsPath = credentials
+	if credentials == defaultCredentials {
+		config.CredentialsPath = ""
+	}
+
+	fmt.Fprintln(p.out)
+	zone, err := p.ask("Time zone dates are shown in (IANA name, UTC or Local)", config.TimeZone.String(), func(name string) error {
+		_, err := time.LoadLocation(name)
+		return err
+	})
+	if err != nil {
+		return config, err
+	}
+	config.TimeZone, _ = time.LoadLocation(zone)
+
+	workers, err := p.ask("Files to upload or download at a time", strconv.Itoa(config.Workers), func(s string) error {
+		if n, err := strconv.Atoi(s); err != nil || n < 1 {
+			return errors.New("enter a number of at least 1")
+		}
+		return nil
+	})
+	if err != nil {
+		return config, err
+	}
+	config.Workers, _ = strconv.Atoi(workers)
+
+	output, err := p.ask("Result format (table, json or csv)", cmp.Or(config.Output, string(OutputTable)), func(s string) error {
+		var format OutputFormat
+		return format.Set(s)
+	})
+	if err != nil {
+		return config, err
+	}
+	config.Output = strings.ToLower(output)
+
+	fmt.Fprintf(p.out, "\nsync run keeps the local index up to date and can also mirror the originals of the library.\n")
+	syncDir, err := p.ask("Directory to mirror originals into (\"none\" for none)", cmp.Or(config.SyncDir, "none"), nil)
+	if err != nil {
+		return config, err
+	}
+	config.SyncDir = syncDir
+	if syncDir == "none" {
+		config.SyncDir = ""
+	}
+
+	fmt.Fprintf(p.out, "\nLogging in grants only the access asked for here; commands needing more ask to grant it then.\n"+
+		"  read    list, index, download and export albums and media items\n"+
+		"  upload  upload media items and create albums\n"+
+		"  edit    rename albums and add and remove their media items\n"+
+		"  share   share albums and join those of others\n")
+	access := config.Access
+	if len(access) == 0 {
+		access = domain.AccessesOf(config.Scopes)
+	}
+	answer, err := p.ask("Access to ask for, separated by commas", domain.JoinAccesses(access), func(s string) error {
+		access, err := domain.ParseAccesses(s)
+		if err == nil && len(access) == 0 {
+			err = errors.New("ask for at least one kind of access")
+		}
+		return err
+	})
+	if err != nil {
+		return config, err
+	}
+	config.Access, _ = domain.ParseAccesses(answer)
+	config.Scopes = domain.ScopesFor(config.Access)
+	return config, nil
+}
+
+// checkCredentials accepts a missing OAuth client file, which can be put in place before logging
+// in, but not one that is not a client file downloaded from the Google Cloud console
+func (p *prompter) checkCredentials(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(p.out, "  %s does not exist yet; put the file there before logging in\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var client map[string]json.RawMessage
+	if json.Unmarshal(b, &client) != nil || (client["installed"] == nil && client["web"] == nil) {
+		return fmt.Errorf("%s is not an OAuth client file", path)
+	}
+	return nil
+}
+
+// schedule asks how often syncs should run and returns the crontab line running them with the
+// config file at configPath, or "" when none should
+func (p *prompter) schedule(configPath string) (string, error) {
+	var spec string
+	answer, err := p.ask("Run sync every (such as 6h or 24h, \"never\" to skip)", "never", func(s string) error {
+		if s == "never" {
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("enter a duration such as 30m, 6h or 24h")
+		}
+		spec, err = cronSchedule(d)
+		return err
+	})
+	if err != nil || answer == "never" {
+		return "", err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the gpm binary: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	config, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", err
+	}
+	return cronLine(spec, wd, exe, config), nil
+}
+
+// cronLine returns the crontab line running sync on spec with the config file at config, from
+// dir since relative directories in the config are relative to where it was written. Cron ends
+// the command at an unescaped %, so those in the paths are escaped.
+func cronLine(spec, dir, exe, config string) string {
+	command := fmt.Sprintf("cd %s && %s --config %s sync run", shellQuote(dir), shellQuote(exe), shellQuote(config))
+	return spec + " " + strings.ReplaceAll(command, "%", `\%`)
+}
+
+// cronSchedule returns the crontab schedule running every d, which must divide an hour or a
+// day evenly or be a week
+func cronSchedule(d time.Duration) (string, error) {
+	switch {
+	case d == 7*24*time.Hour:
+		return "0 3 * * 0", nil
+	case d == 24*time.Hour:
+		return "0 3 * * *", nil
+	case d >= time.Minute && d < time.Hour && d%time.Minute == 0 && time.Hour%d == 0:
+		return fmt.Sprintf("*/%d * * * *", d/time.Minute), nil
+	case d == time.Hour:
+		return "0 * * * *", nil
+	case d > time.Hour && d < 24*time.Hour && d%time.Hour == 0 && (24*time.Hour)%d == 0:
+		return fmt.Sprintf("0 */%d * * *", d/time.Hour), nil
+	}
+	return "", fmt.Errorf("cron cannot run every %s; use a part of an hour or a day such as 15m or 6h, 24h or 168h", d)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// confirm asks a yes or no question
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, hint)
+		line, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// ask shows question with def, which an empty answer keeps, and asks again until check, if
+// any, accepts the answer
+func (p *prompter) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		line, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+		answer := cmp.Or(strings.TrimSpace(line), def)
+		if check != nil {
+			if err := check(answer); err != nil {
+				fmt.Fprintf(p.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// readLine reads a line a byte at a time, so nothing after it is taken from the input that a
+// login following the questions reads
+func (p *prompter) readLine() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := p.in.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			return "", errors.New("input ended before the question was answered")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
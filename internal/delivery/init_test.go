@@ -0,0 +1,100 @@
+package delivery
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestInitWizard(t *testing.T) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "client.json")
+	if err := os.WriteFile(credentials, []byte(`{"installed": {"client_id": "id"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"type": "service_account"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid answers are asked again; empty ones keep the default
+	input := strings.Join([]string{
+		dir,
+		invalid,
+		credentials,
+		"Mars/Olympus",
+		"Europe/Paris",
+		"0",
+		"",
+		"JSON",
+		"",
+		"all",
+		"read, upload",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	prompt := &prompter{in: strings.NewReader(input), out: &out}
+
+	config, err := prompt.configure(domain.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Dir != dir || config.CredentialsPath != credentials || config.TimeZone.String() != "Europe/Paris" ||
+		config.Workers != domain.DefaultConfig().Workers || config.Output != "json" || config.SyncDir != "" {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+	if want := domain.ScopesFor([]domain.Access{domain.AccessRead, domain.AccessUpload}); !slices.Equal(config.Scopes, want) {
+		t.Errorf("Expected only the scopes of read and upload, got %v", config.Scopes)
+	}
+	for _, want := range []string{"is not an OAuth client file", "unknown time zone Mars/Olympus", "enter a number of at least 1", `invalid access "all"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	prompt = &prompter{in: strings.NewReader(dir + "\n"), out: &out}
+	if _, err := prompt.configure(domain.DefaultConfig()); err == nil || !strings.Contains(err.Error(), "input ended") {
+		t.Errorf("Expected error about the input ending, got %v", err)
+	}
+}
+
+func TestCronLine(t *testing.T) {
+	got := cronLine("0 3 * * *", "/home/me/100% photos", "/usr/bin/gpm", "/home/me/it's.yaml")
+	want := `0 3 * * * cd '/home/me/100\% photos' && '/usr/bin/gpm' --config '/home/me/it'\''s.yaml' sync run`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	tests := []struct {
+		every time.Duration
+		want  string
+	}{
+		{15 * time.Minute, "*/15 * * * *"},
+		{time.Hour, "0 * * * *"},
+		{6 * time.Hour, "0 */6 * * *"},
+		{24 * time.Hour, "0 3 * * *"},
+		{7 * 24 * time.Hour, "0 3 * * 0"},
+		{7 * time.Minute, ""},
+		{5 * time.Hour, ""},
+		{30 * time.Second, ""},
+	}
+	for _, tt := range tests {
+		got, err := cronSchedule(tt.every)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Expected error for %s, got %q", tt.every, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Expected %q for %s, got %q (%v)", tt.want, tt.every, got, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// LogFormat selects how progress and diagnostics are written to stderr
+type LogFormat string
+
+// Supported log formats
+const (
+	LogText LogFormat = "text"
+	LogJSON LogFormat = "json"
+)
+
+// String implements flag.Value
+func (f *LogFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value and rejects unsupported formats
+func (f *LogFormat) Set(value string) error {
+	switch format := LogFormat(strings.ToLower(value)); format {
+	case LogText, LogJSON:
+		*f = format
+		return nil
+	default:
+		return fmt.Errorf("unsupported log format %q (use text or json)", value)
+	}
+}
+
+// newLogger builds the logger of a run: --verbose adds debug output such as raw API responses,
+// --quiet keeps only warnings and errors. Secrets in messages and values are redacted.
+func newLogger(w io.Writer, opts GlobalOptions) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case opts.Verbose:
+		level = slog.LevelDebug
+	case opts.Quiet:
+		level = slog.LevelWarn
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if opts.LogFormat == LogJSON {
+		return slog.New(slog.NewJSONHandler(w, handlerOpts))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOpts))
+}
+
+// redactAttr removes secrets such as tokens and signed URLs from strings, including the message,
+// errors and values formatted with %v
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch {
+	case v.Kind() == slog.KindString:
+		return slog.String(a.Key, domain.RedactSecrets(v.String()))
+	case v.Kind() != slog.KindAny:
+		return a
+	}
+
+	switch value := v.Any().(type) {
+	case slog.Level:
+		return a
+	case []string:
+		redacted := make([]string, len(value))
+		for i, s := range value {
+			redacted[i] = domain.RedactSecrets(s)
+		}
+		return slog.Any(a.Key, redacted)
+	default:
+		return slog.String(a.Key, domain.RedactSecrets(fmt.Sprint(value)))
+	}
+}
+
+// rotatingFile appends to a log file until it grew past maxSize, then moves it to NAME.1, NAME.1
+// to NAME.2 and so on, dropping the oldest beyond keep, and starts a new one. A single write larger
+// than maxSize still goes to one file.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens the log file at path for appending, rotating it first when it already
+// grew past maxSize
+func openRotatingFile(path string, maxSize int64, keep int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if f.size >= maxSize {
+		if err := f.rotate(); err != nil {
+			f.file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// open opens the file at f.path for appending
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the full file and the older ones aside and opens a new one. When they cannot be
+// moved, the full file is opened again, so later writes still go somewhere.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	err := f.shift()
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// shift renames NAME.1 to NAME.2 and so on and the file to NAME.1, dropping the oldest beyond keep
+func (f *rotatingFile) shift() error {
+	if f.keep == 0 {
+		return os.Remove(f.path)
+	}
+	if err := os.Remove(fmt.Sprintf("%s.%d", f.path, f.keep)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := f.keep - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// Write implements io.Writer
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %v", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
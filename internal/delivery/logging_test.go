@@ -0,0 +1,114 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFormat_Set(t *testing.T) {
+	var format LogFormat
+	if err := format.Set("JSON"); err != nil || format != LogJSON {
+		t.Errorf("Expected json format, got %q (%v)", format, err)
+	}
+	if err := format.Set("logfmt"); err == nil {
+		t.Error("Expected unsupported format to be rejected")
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		opts GlobalOptions
+		want []string
+	}{
+		{name: "default", opts: GlobalOptions{}, want: []string{"info", "warn"}},
+		{name: "verbose", opts: GlobalOptions{Verbose: true}, want: []string{"debug", "info", "warn"}},
+		{name: "quiet", opts: GlobalOptions{Quiet: true}, want: []string{"warn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newLogger(&buf, tt.opts)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if _, msg, ok := strings.Cut(line, "msg="); ok {
+					got = append(got, msg)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected messages %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, GlobalOptions{LogFormat: LogJSON}).Info("Fetching album", "album_id", "a1")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q (%v)", buf.String(), err)
+	}
+	if record["msg"] != "Fetching album" || record["album_id"] != "a1" || record["level"] != "INFO" {
+		t.Errorf("Unexpected record %v", record)
+	}
+}
+
+func TestNewLogger_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, GlobalOptions{})
+	logger.Info("Joining https://photos.google.com/join?shareToken=AOxyz",
+		"url", "https://lh3.googleusercontent.com/lr/AF1Qip=d",
+		"error", errors.New(`Put "https://photoslibrary.googleapis.com/v1/uploads?upload_id=ADPy": EOF`),
+		"media_item_id", "m1")
+
+	out := buf.String()
+	for _, secret := range []string{"AOxyz", "AF1Qip", "ADPy"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "level=INFO") || !strings.Contains(out, "media_item_id=m1") {
+		t.Errorf("Expected the rest of the record to be kept, got %s", out)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.log")
+	if err := os.WriteFile(path, []byte("0123456789\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The log left by the last run is already full, so it is rotated before the first line
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(f, "line %d\n", i)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for name, want := range map[string]string{"sync.log": "line 4\n", "sync.log.1": "line 3\n", "sync.log.2": "line 2\n"} {
+		if got, err := os.ReadFile(filepath.Join(filepath.Dir(path), name)); err != nil || string(got) != want {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", name, want, got, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected only two rotated logs kept, got %v", err)
+	}
+}
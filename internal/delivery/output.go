@@ -0,0 +1,977 @@
+package delivery
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+// OutputFormat selects how command results are written to stdout
+type OutputFormat string
+
+// Supported output formats
+const (
+	OutputTable OutputFormat = "table"
+	OutputJSON  OutputFormat = "json"
+	OutputCSV   OutputFormat = "csv"
+)
+
+// String implements flag.Value
+func (f *OutputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value and rejects unsupported formats
+func (f *OutputFormat) Set(value string) error {
+	switch format := OutputFormat(strings.ToLower(value)); format {
+	case OutputTable, OutputJSON, OutputCSV:
+		*f = format
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q (use table, json or csv)", value)
+	}
+}
+
+// column describes how one field of a record is rendered in table and CSV output
+type column[T any] struct {
+	header string
+	value  func(T) string
+}
+
+// albumColumns are shown when listing albums
+var albumColumns = []column[domain.Album]{
+	{header: "id", value: func(a domain.Album) string { return a.ID }},
+	{header: "title", value: func(a domain.Album) string { return a.Title }},
+	{header: "items", value: func(a domain.Album) string { return strconv.FormatInt(a.MediaItemsCount, 10) }},
+	{header: "writeable", value: func(a domain.Album) string { return strconv.FormatBool(a.IsWriteable) }},
+	{header: "shared", value: func(a domain.Album) string { return strconv.FormatBool(a.ShareInfo != nil) }},
+	{header: "product_url", value: func(a domain.Album) string { return a.ProductURL }},
+}
+
+// albumDetailColumns are shown for a single album and include the cover photo and sharing details
+var albumDetailColumns = append(albumColumns[:len(albumColumns):len(albumColumns)],
+	column[domain.Album]{header: "cover_photo_id", value: func(a domain.Album) string { return a.CoverPhotoMediaItemID }},
+	column[domain.Album]{header: "cover_photo_base_url", value: func(a domain.Album) string { return a.CoverPhotoBaseURL }},
+	column[domain.Album]{header: "shareable_url", value: func(a domain.Album) string {
+		if a.ShareInfo == nil {
+			return ""
+		}
+		return a.ShareInfo.ShareableURL
+	}},
+)
+
+// shareInfoColumns are shown after sharing an album
+var shareInfoColumns = []column[domain.ShareInfo]{
+	{header: "shareable_url", value: func(s domain.ShareInfo) string { return s.ShareableURL }},
+	{header: "short_url", value: func(s domain.ShareInfo) string { return s.ShortURL }},
+	{header: "share_token", value: func(s domain.ShareInfo) string { return s.ShareToken }},
+	{header: "collaborative", value: func(s domain.ShareInfo) string { return strconv.FormatBool(s.SharedAlbumOptions.IsCollaborative) }},
+	{header: "commentable", value: func(s domain.ShareInfo) string { return strconv.FormatBool(s.SharedAlbumOptions.IsCommentable) }},
+	{header: "owned", value: func(s domain.ShareInfo) string { return strconv.FormatBool(s.IsOwned) }},
+	{header: "joined", value: func(s domain.ShareInfo) string { return strconv.FormatBool(s.IsJoined) }},
+}
+
+// shareInventoryColumns are shown when auditing the albums the account shares
+var shareInventoryColumns = []column[domain.Album]{
+	{header: "id", value: func(a domain.Album) string { return a.ID }},
+	{header: "title", value: func(a domain.Album) string { return a.Title }},
+	{header: "items", value: func(a domain.Album) string { return strconv.FormatInt(a.MediaItemsCount, 10) }},
+	{header: "shareable_url", value: func(a domain.Album) string { return a.ShareInfo.ShareableURL }},
+	{header: "collaborative", value: func(a domain.Album) string { return strconv.FormatBool(a.ShareInfo.SharedAlbumOptions.IsCollaborative) }},
+	{header: "commentable", value: func(a domain.Album) string { return strconv.FormatBool(a.ShareInfo.SharedAlbumOptions.IsCommentable) }},
+}
+
+// uploadColumns are shown in the per-file summary of an upload
+var uploadColumns = []column[usecase.UploadResult]{
+	{header: "path", value: func(r usecase.UploadResult) string { return r.Path }},
+	{header: "status", value: func(r usecase.UploadResult) string {
+		switch {
+		case r.Error != "":
+			return "failed"
+		case r.DateInferred:
+			return "uploaded with date from file name"
+		case r.DatesFixed:
+			return "uploaded with fixed dates"
+		}
+		return "uploaded"
+	}},
+	{header: "media_item_id", value: func(r usecase.UploadResult) string { return r.MediaItemID }},
+	{header: "error", value: func(r usecase.UploadResult) string { return r.Error }},
+}
+
+// takeoutColumns are shown for every photo of an imported Takeout export
+func takeoutColumns(dryRun bool) []column[usecase.TakeoutItem] {
+	return []column[usecase.TakeoutItem]{
+		{header: "path", value: func(i usecase.TakeoutItem) string { return i.Path }},
+		{header: "status", value: func(i usecase.TakeoutItem) string {
+			switch {
+			case dryRun:
+				return "planned"
+			case i.Error != "":
+				return "failed"
+			}
+			return "uploaded"
+		}},
+		{header: "albums", value: func(i usecase.TakeoutItem) string { return strings.Join(i.Albums, ", ") }},
+		{header: "media_item_id", value: func(i usecase.TakeoutItem) string { return i.MediaItemID }},
+		{header: "error", value: func(i usecase.TakeoutItem) string { return i.Error }},
+	}
+}
+
+// dateFixColumns are shown when previewing EXIF date corrections; times are EXIF wall clock times
+var dateFixColumns = []column[usecase.DateFixResult]{
+	{header: "path", value: func(r usecase.DateFixResult) string { return r.Path }},
+	{header: "taken", value: func(r usecase.DateFixResult) string { return formatWallTime(r.Taken) }},
+	{header: "corrected", value: func(r usecase.DateFixResult) string { return formatWallTime(r.Corrected) }},
+	{header: "status", value: func(r usecase.DateFixResult) string {
+		switch {
+		case r.Error != "":
+			return "failed"
+		case r.Excepted:
+			return "excepted"
+		case r.Taken.IsZero():
+			return "no date"
+		case r.Inferred:
+			return "from file name"
+		case r.Taken.Equal(r.Corrected):
+			return "unchanged"
+		}
+		return "fixed"
+	}},
+	{header: "error", value: func(r usecase.DateFixResult) string { return r.Error }},
+}
+
+// contactSheetColumns are shown for each page of a rendered contact sheet
+var contactSheetColumns = []column[usecase.ContactSheetPage]{
+	{header: "page", value: func(p usecase.ContactSheetPage) string { return strconv.Itoa(p.Page) }},
+	{header: "items", value: func(p usecase.ContactSheetPage) string { return strconv.Itoa(p.Items) }},
+	{header: "missing", value: func(p usecase.ContactSheetPage) string { return strconv.Itoa(p.Missing) }},
+	{header: "path", value: func(p usecase.ContactSheetPage) string { return p.Path }},
+}
+
+// layoutResultColumns are shown for a rendered calendar or photo book
+var layoutResultColumns = []column[usecase.LayoutResult]{
+	{header: "path", value: func(r usecase.LayoutResult) string { return r.Path }},
+	{header: "pages", value: func(r usecase.LayoutResult) string { return strconv.Itoa(r.Pages) }},
+	{header: "photos", value: func(r usecase.LayoutResult) string { return strconv.Itoa(r.Photos) }},
+	{header: "missing", value: func(r usecase.LayoutResult) string { return strconv.Itoa(r.Missing) }},
+}
+
+// reelResultColumns are shown for an assembled highlight reel
+var reelResultColumns = []column[usecase.ReelResult]{
+	{header: "path", value: func(r usecase.ReelResult) string { return r.Path }},
+	{header: "photos", value: func(r usecase.ReelResult) string { return strconv.Itoa(r.Photos) }},
+	{header: "videos", value: func(r usecase.ReelResult) string { return strconv.Itoa(r.Videos) }},
+	{header: "missing", value: func(r usecase.ReelResult) string { return strconv.Itoa(r.Missing) }},
+	{header: "media_item_id", value: func(r usecase.ReelResult) string { return r.MediaItemID }},
+}
+
+// exportResultColumns are shown for an exported album
+var exportResultColumns = []column[usecase.ExportResult]{
+	{header: "path", value: func(r usecase.ExportResult) string { return r.Path }},
+	{header: "album", value: func(r usecase.ExportResult) string { return r.Album.Title }},
+	{header: "media_items", value: func(r usecase.ExportResult) string { return strconv.Itoa(r.MediaItems) }},
+	{header: "originals", value: func(r usecase.ExportResult) string { return strconv.Itoa(r.Originals) }},
+	{header: "failed", value: func(r usecase.ExportResult) string { return strconv.Itoa(len(r.Failed)) }},
+	{header: "size", value: func(r usecase.ExportResult) string { return formatBytes(r.Bytes) }},
+}
+
+// printColumns are shown in the report of an album prepared for print
+var printColumns = []column[usecase.PrintResult]{
+	{header: "media_item_id", value: func(r usecase.PrintResult) string { return r.MediaItemID }},
+	{header: "filename", value: func(r usecase.PrintResult) string { return r.Filename }},
+	{header: "size", value: func(r usecase.PrintResult) string { return r.Size }},
+	{header: "status", value: func(r usecase.PrintResult) string { return string(r.Status) }},
+	{header: "dpi", value: func(r usecase.PrintResult) string { return strconv.Itoa(r.DPI) }},
+	{header: "pixels", value: func(r usecase.PrintResult) string {
+		if r.Width == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dx%d", r.Width, r.Height)
+	}},
+	{header: "path", value: func(r usecase.PrintResult) string { return r.Path }},
+	{header: "error", value: func(r usecase.PrintResult) string { return r.Error }},
+}
+
+// thumbnailColumns are shown for every file of media thumbnails
+var thumbnailColumns = []column[usecase.ThumbnailResult]{
+	{header: "path", value: func(r usecase.ThumbnailResult) string { return r.Path }},
+	{header: "status", value: func(r usecase.ThumbnailResult) string {
+		switch {
+		case r.Error != "":
+			return "failed"
+		case r.Unsupported:
+			return "unsupported"
+		case r.Current:
+			return "current"
+		default:
+			return "created"
+		}
+	}},
+	{header: "thumbnail", value: func(r usecase.ThumbnailResult) string { return r.Thumbnail }},
+	{header: "error", value: func(r usecase.ThumbnailResult) string { return r.Error }},
+}
+
+// ocrColumns are shown for every file of index ocr
+var ocrColumns = []column[usecase.OCRResult]{
+	{header: "path", value: func(r usecase.OCRResult) string { return r.Path }},
+	{header: "status", value: func(r usecase.OCRResult) string {
+		switch {
+		case r.Error != "":
+			return "failed"
+		case r.Unsupported:
+			return "unsupported"
+		case r.Current:
+			return "current"
+		default:
+			return "read"
+		}
+	}},
+	{header: "words", value: func(r usecase.OCRResult) string { return strconv.Itoa(r.Words) }},
+	{header: "error", value: func(r usecase.OCRResult) string { return r.Error }},
+}
+
+// albumOverlapColumns are shown for every pair of albums in the overlap report
+var albumOverlapColumns = []column[usecase.AlbumOverlap]{
+	{header: "album_a", value: func(o usecase.AlbumOverlap) string { return o.A.Title }},
+	{header: "album_b", value: func(o usecase.AlbumOverlap) string { return o.B.Title }},
+	{header: "shared", value: func(o usecase.AlbumOverlap) string { return strconv.Itoa(o.Shared) }},
+	{header: "jaccard", value: func(o usecase.AlbumOverlap) string { return strconv.FormatFloat(o.Jaccard, 'f', 2, 64) }},
+	{header: "contained", value: func(o usecase.AlbumOverlap) string { return strconv.FormatFloat(o.Contained, 'f', 2, 64) }},
+	{header: "album_a_id", value: func(o usecase.AlbumOverlap) string { return o.A.ID }},
+	{header: "album_b_id", value: func(o usecase.AlbumOverlap) string { return o.B.ID }},
+}
+
+// categoryCountColumns are shown for every content category of the category report
+var categoryCountColumns = []column[usecase.CategoryCount]{
+	{header: "category", value: func(c usecase.CategoryCount) string { return c.Category.String() }},
+	{header: "items", value: func(c usecase.CategoryCount) string { return strconv.Itoa(c.Count) }},
+	{header: "photos", value: func(c usecase.CategoryCount) string { return strconv.Itoa(c.Photos) }},
+	{header: "videos", value: func(c usecase.CategoryCount) string { return strconv.Itoa(c.Videos) }},
+	{header: "samples", value: func(c usecase.CategoryCount) string {
+		names := make([]string, len(c.Samples))
+		for i, item := range c.Samples {
+			names[i] = cmp.Or(item.Filename, item.ID)
+		}
+		return strings.Join(names, ", ")
+	}},
+}
+
+// growthMonthColumns are shown for every month of the growth forecast
+var growthMonthColumns = []column[usecase.GrowthMonth]{
+	{header: "month", value: func(m usecase.GrowthMonth) string { return m.Month.Format("2006-01") }},
+	{header: "photos", value: func(m usecase.GrowthMonth) string { return strconv.Itoa(m.Photos) }},
+	{header: "videos", value: func(m usecase.GrowthMonth) string { return strconv.Itoa(m.Videos) }},
+	{header: "size", value: func(m usecase.GrowthMonth) string { return formatBytes(m.Size) }},
+}
+
+// tierForecastColumns are shown for every storage tier of the growth forecast
+var tierForecastColumns = []column[usecase.TierForecast]{
+	{header: "tier", value: func(t usecase.TierForecast) string { return t.Name }},
+	{header: "exceeded", value: func(t usecase.TierForecast) string {
+		switch {
+		case t.Full:
+			return "now"
+		case t.Exceeded.IsZero():
+			return "-"
+		}
+		return t.Exceeded.Format("2006-01")
+	}},
+}
+
+// quotaStepColumns are shown for every step of a quota plan
+var quotaStepColumns = []column[usecase.QuotaStep]{
+	{header: "step", value: func(s usecase.QuotaStep) string { return s.Name }},
+	{header: "calls", value: func(s usecase.QuotaStep) string { return strconv.Itoa(s.Calls) }},
+	{header: "quota", value: func(s usecase.QuotaStep) string {
+		if s.Media {
+			return "media"
+		}
+		return "daily"
+	}},
+	{header: "duration", value: func(s usecase.QuotaStep) string { return (time.Duration(s.Seconds) * time.Second).String() }},
+}
+
+// textMatchColumns are shown in the results of index search-text
+var textMatchColumns = []column[usecase.TextMatch]{
+	{header: "path", value: func(m usecase.TextMatch) string { return m.Path }},
+	{header: "snippet", value: func(m usecase.TextMatch) string { return m.Snippet }},
+}
+
+// describeColumns are shown for every media item of media describe
+var describeColumns = []column[usecase.DescribeResult]{
+	{header: "media_item_id", value: func(r usecase.DescribeResult) string { return r.MediaItemID }},
+	{header: "filename", value: func(r usecase.DescribeResult) string { return r.Filename }},
+	{header: "status", value: func(r usecase.DescribeResult) string { return r.Status }},
+	{header: "description", value: func(r usecase.DescribeResult) string { return r.Description }},
+	{header: "previous", value: func(r usecase.DescribeResult) string { return r.Previous }},
+	{header: "error", value: func(r usecase.DescribeResult) string { return r.Error }},
+}
+
+// downloadColumns are shown in the per-item summary of a download
+var downloadColumns = []column[usecase.DownloadResult]{
+	{header: "media_item_id", value: func(r usecase.DownloadResult) string { return r.MediaItemID }},
+	{header: "path", value: func(r usecase.DownloadResult) string { return r.Path }},
+	{header: "status", value: func(r usecase.DownloadResult) string {
+		switch {
+		case r.Error != "":
+			return "failed"
+		case r.Exists:
+			return "exists"
+		default:
+			return "downloaded"
+		}
+	}},
+	{header: "bytes", value: func(r usecase.DownloadResult) string { return strconv.FormatInt(r.Bytes, 10) }},
+	{header: "error", value: func(r usecase.DownloadResult) string { return r.Error }},
+}
+
+// accountColumns are shown for the account behind a profile's token
+var accountColumns = []column[domain.AccountInfo]{
+	{header: "profile", value: func(a domain.AccountInfo) string { return a.Profile }},
+	{header: "email", value: func(a domain.AccountInfo) string { return a.Email }},
+	{header: "email_verified", value: func(a domain.AccountInfo) string { return strconv.FormatBool(a.EmailVerified) }},
+	{header: "name", value: func(a domain.AccountInfo) string { return a.Name }},
+	{header: "user_id", value: func(a domain.AccountInfo) string { return a.UserID }},
+	{header: "scopes", value: func(a domain.AccountInfo) string { return strings.Join(a.Scopes, " ") }},
+	{header: "expiry", value: func(a domain.AccountInfo) string {
+		if a.Expiry.IsZero() {
+			return ""
+		}
+		return a.Expiry.Format(time.RFC3339)
+	}},
+	{header: "refreshable", value: func(a domain.AccountInfo) string { return strconv.FormatBool(a.Refreshable) }},
+}
+
+// indexResultColumns are shown after building or updating the local index
+var indexResultColumns = []column[usecase.IndexResult]{
+	{header: "albums", value: func(r usecase.IndexResult) string { return strconv.Itoa(r.Albums) }},
+	{header: "media_items", value: func(r usecase.IndexResult) string { return strconv.Itoa(r.MediaItems) }},
+	{header: "added", value: func(r usecase.IndexResult) string { return strconv.Itoa(r.Added) }},
+	{header: "removed", value: func(r usecase.IndexResult) string { return strconv.Itoa(r.Removed) }},
+	{header: "albums_refreshed", value: func(r usecase.IndexResult) string { return strconv.Itoa(r.AlbumsRefreshed) }},
+}
+
+// indexStatsColumns are shown for the state of the local index
+var indexStatsColumns = []column[domain.IndexStats]{
+	{header: "albums", value: func(s domain.IndexStats) string { return strconv.Itoa(s.Albums) }},
+	{header: "media_items", value: func(s domain.IndexStats) string { return strconv.Itoa(s.MediaItems) }},
+	{header: "updated", value: func(s domain.IndexStats) string { return formatOptionalTime(s.UpdatedAt) }},
+}
+
+// mediaItemColumns are shown when listing media items
+var mediaItemColumns = []column[domain.MediaItem]{
+	{header: "id", value: func(m domain.MediaItem) string { return m.ID }},
+	{header: "filename", value: func(m domain.MediaItem) string { return m.Filename }},
+	{header: "mime_type", value: func(m domain.MediaItem) string { return m.MimeType }},
+	{header: "created", value: formatCreationTime},
+	{header: "product_url", value: func(m domain.MediaItem) string { return m.ProductURL }},
+}
+
+// duplicateRow is one media item of a duplicate group, flattened so groups fit in a table
+type duplicateRow struct {
+	Group int `json:"group"`
+	domain.MediaItem
+}
+
+// duplicateColumns are shown in the duplicate report
+var duplicateColumns = []column[duplicateRow]{
+	{header: "group", value: func(r duplicateRow) string { return strconv.Itoa(r.Group) }},
+	{header: "media_item_id", value: func(r duplicateRow) string { return r.ID }},
+	{header: "filename", value: func(r duplicateRow) string { return r.Filename }},
+	{header: "created", value: func(r duplicateRow) string { return formatCreationTime(r.MediaItem) }},
+	{header: "dimensions", value: func(r duplicateRow) string {
+		if r.MediaMetadata == nil || r.MediaMetadata.Width == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dx%d", r.MediaMetadata.Width, r.MediaMetadata.Height)
+	}},
+	{header: "product_url", value: func(r duplicateRow) string { return r.ProductURL }},
+}
+
+// statsRow is one figure of the library statistics, flattened so every section fits in a table
+type statsRow struct {
+	Section string
+	Name    string
+	Value   string
+	Detail  string
+}
+
+// statsColumns are shown in the library statistics
+var statsColumns = []column[statsRow]{
+	{header: "section", value: func(r statsRow) string { return r.Section }},
+	{header: "name", value: func(r statsRow) string { return r.Name }},
+	{header: "value", value: func(r statsRow) string { return r.Value }},
+	{header: "detail", value: func(r statsRow) string { return r.Detail }},
+}
+
+// similarColumns are shown in the matches of a similarity search; file is the filename of an
+// indexed photo or the path of an exported one
+var similarColumns = []column[usecase.SimilarMatch]{
+	{header: "distance", value: func(m usecase.SimilarMatch) string { return strconv.Itoa(m.Distance) }},
+	{header: "media_item_id", value: func(m usecase.SimilarMatch) string {
+		if m.MediaItem == nil {
+			return ""
+		}
+		return m.MediaItem.ID
+	}},
+	{header: "file", value: func(m usecase.SimilarMatch) string {
+		if m.MediaItem == nil {
+			return m.Path
+		}
+		return m.MediaItem.Filename
+	}},
+	{header: "product_url", value: func(m usecase.SimilarMatch) string {
+		if m.MediaItem == nil {
+			return ""
+		}
+		return m.MediaItem.ProductURL
+	}},
+}
+
+// syncChangeColumns are shown in the diff summary of a sync
+var syncChangeColumns = []column[usecase.SyncChange]{
+	{header: "change", value: func(c usecase.SyncChange) string { return string(c.Kind) }},
+	{header: "media_item_id", value: func(c usecase.SyncChange) string { return c.MediaItemID }},
+	{header: "filename", value: func(c usecase.SyncChange) string { return c.Filename }},
+	{header: "previous_filename", value: func(c usecase.SyncChange) string { return c.PreviousFilename }},
+	{header: "path", value: func(c usecase.SyncChange) string { return c.Path }},
+	{header: "error", value: func(c usecase.SyncChange) string { return c.Error }},
+}
+
+// mirrorFileColumns are shown in the report of verify-mirror
+var mirrorFileColumns = []column[usecase.MirrorFile]{
+	{header: "status", value: func(f usecase.MirrorFile) string { return string(f.Status) }},
+	{header: "path", value: func(f usecase.MirrorFile) string { return f.Path }},
+	{header: "media_item_id", value: func(f usecase.MirrorFile) string { return f.MediaItemID }},
+	{header: "expected", value: func(f usecase.MirrorFile) string { return f.Expected }},
+	{header: "actual", value: func(f usecase.MirrorFile) string { return f.Actual }},
+	{header: "error", value: func(f usecase.MirrorFile) string { return f.Error }},
+}
+
+// syncStatusColumns are shown for the persisted sync state
+var syncStatusColumns = []column[usecase.SyncStatus]{
+	{header: "watermark", value: func(s usecase.SyncStatus) string { return formatOptionalTime(s.Watermark) }},
+	{header: "last_sync", value: func(s usecase.SyncStatus) string { return formatOptionalTime(s.LastSyncAt) }},
+	{header: "last_full_sync", value: func(s usecase.SyncStatus) string { return formatOptionalTime(s.LastFullSyncAt) }},
+	{header: "dir", value: func(s usecase.SyncStatus) string { return s.Dir }},
+	{header: "files", value: func(s usecase.SyncStatus) string { return strconv.Itoa(s.Files) }},
+}
+
+// backupResultColumns are shown for each media item a backup copied or failed to copy
+var backupResultColumns = []column[usecase.BackupResult]{
+	{header: "media_item_id", value: func(r usecase.BackupResult) string { return r.MediaItemID }},
+	{header: "filename", value: func(r usecase.BackupResult) string { return r.Filename }},
+	{header: "key", value: func(r usecase.BackupResult) string { return r.Key }},
+	{header: "bytes", value: func(r usecase.BackupResult) string { return strconv.FormatInt(r.Bytes, 10) }},
+	{header: "sha256", value: func(r usecase.BackupResult) string { return r.SHA256 }},
+	{header: "error", value: func(r usecase.BackupResult) string { return r.Error }},
+}
+
+var backupStatusColumns = []column[usecase.BackupStatus]{
+	{header: "target", value: func(s usecase.BackupStatus) string { return s.Target }},
+	{header: "media_items", value: func(s usecase.BackupStatus) string { return strconv.Itoa(s.MediaItems) }},
+	{header: "size", value: func(s usecase.BackupStatus) string { return formatBytes(s.Bytes) }},
+	{header: "updated_at", value: func(s usecase.BackupStatus) string { return formatOptionalTime(s.UpdatedAt) }},
+}
+
+// jobStatusColumns are shown for the status of each daemon job
+var jobStatusColumns = []column[domain.JobStatus]{
+	{header: "job", value: func(s domain.JobStatus) string { return s.Name }},
+	{header: "schedule", value: func(s domain.JobStatus) string { return s.Schedule }},
+	{header: "last_start", value: func(s domain.JobStatus) string { return formatOptionalTime(s.LastStart) }},
+	{header: "last_end", value: func(s domain.JobStatus) string { return formatOptionalTime(s.LastEnd) }},
+	{header: "result", value: func(s domain.JobStatus) string { return s.Result }},
+	{header: "next_run", value: func(s domain.JobStatus) string { return formatOptionalTime(s.NextRun) }},
+	{header: "runs", value: func(s domain.JobStatus) string { return strconv.Itoa(s.Runs) }},
+	{header: "failures", value: func(s domain.JobStatus) string { return strconv.Itoa(s.Failures) }},
+	{header: "error", value: func(s domain.JobStatus) string { return s.Error }},
+}
+
+// magicResultColumns are shown for the outcome of each magic rule
+var magicResultColumns = []column[usecase.MagicResult]{
+	{header: "album", value: func(r usecase.MagicResult) string { return r.Album }},
+	{header: "album_id", value: func(r usecase.MagicResult) string { return r.AlbumID }},
+	{header: "created", value: func(r usecase.MagicResult) string { return strconv.FormatBool(r.Created) }},
+	{header: "matched", value: func(r usecase.MagicResult) string { return strconv.Itoa(r.Matched) }},
+	{header: "added", value: func(r usecase.MagicResult) string { return strconv.Itoa(r.Added) }},
+	{header: "error", value: func(r usecase.MagicResult) string { return r.Error }},
+}
+
+var profileColumns = []column[domain.Profile]{
+	{header: "name", value: func(p domain.Profile) string { return p.Name }},
+	{header: "active", value: func(p domain.Profile) string { return strconv.FormatBool(p.Active) }},
+	{header: "token", value: func(p domain.Profile) string { return p.TokenPath }},
+	{header: "cache", value: func(p domain.Profile) string { return p.CacheDir }},
+}
+
+// Formatter writes command results in the selected output format.
+// Results go to their own writer so logs on stderr never mix with them.
+type Formatter struct {
+	w      io.Writer
+	format OutputFormat
+	// timeZone is where creation times are shown; nil keeps the UTC the API reports
+	timeZone *time.Location
+}
+
+// NewFormatter creates a new instance of Formatter; an empty format means table
+func NewFormatter(w io.Writer, format OutputFormat) *Formatter {
+	if format == "" {
+		format = OutputTable
+	}
+	return &Formatter{
+		w:      w,
+		format: format,
+	}
+}
+
+// SetTimeZone sets where creation times of media items are shown
+func (f *Formatter) SetTimeZone(loc *time.Location) {
+	f.timeZone = loc
+}
+
+// WriteAlbums writes a list of albums
+func (f *Formatter) WriteAlbums(albums []domain.Album) error {
+	return writeRecords(f, albums, albumColumns)
+}
+
+// WriteAlbum writes a single album with all of its details; JSON output is an object rather than an array
+func (f *Formatter) WriteAlbum(album domain.Album) error {
+	return writeRecord(f, album, albumDetailColumns)
+}
+
+// WriteShareInfo writes the sharing state of an album
+func (f *Formatter) WriteShareInfo(shareInfo domain.ShareInfo) error {
+	return writeRecord(f, shareInfo, shareInfoColumns)
+}
+
+// WriteShareInventory writes shared albums with their links and share options; every album must have ShareInfo
+func (f *Formatter) WriteShareInventory(albums []domain.Album) error {
+	return writeRecords(f, albums, shareInventoryColumns)
+}
+
+// WriteTakeoutItems writes the outcome of every photo of a Takeout import, or on a dry run the
+// photos that would be uploaded
+func (f *Formatter) WriteTakeoutItems(items []usecase.TakeoutItem, dryRun bool) error {
+	return writeRecords(f, items, takeoutColumns(dryRun))
+}
+
+// WriteUploadResults writes the outcome of every uploaded file
+func (f *Formatter) WriteUploadResults(results []usecase.UploadResult) error {
+	return writeRecords(f, results, uploadColumns)
+}
+
+// WriteDateFixResults writes how the dates of every file would be corrected
+func (f *Formatter) WriteDateFixResults(results []usecase.DateFixResult) error {
+	return writeRecords(f, results, dateFixColumns)
+}
+
+// WriteThumbnailResults writes the outcome of making the thumbnail of every local file
+func (f *Formatter) WriteThumbnailResults(results []usecase.ThumbnailResult) error {
+	return writeRecords(f, results, thumbnailColumns)
+}
+
+// WriteAlbumOverlaps writes the pairs of albums sharing media items
+func (f *Formatter) WriteAlbumOverlaps(pairs []usecase.AlbumOverlap) error {
+	return writeRecords(f, pairs, albumOverlapColumns)
+}
+
+// WriteOverlapMatrix writes one row per album of the overlap report with a column per album
+// counting the media items they share; JSON holds the albums and the matrix as they are
+func (f *Formatter) WriteOverlapMatrix(report *usecase.OverlapReport) error {
+	if f.format == OutputJSON {
+		return f.writeJSON(struct {
+			Albums []domain.Album `json:"albums"`
+			Matrix [][]int        `json:"matrix"`
+		}{report.Albums, report.Matrix})
+	}
+
+	// Columns are numbered, since titles are too wide for a column each; the rows name the albums
+	columns := []column[int]{
+		{header: "#", value: func(i int) string { return strconv.Itoa(i + 1) }},
+		{header: "album", value: func(i int) string { return report.Albums[i].Title }},
+	}
+	rows := make([]int, len(report.Albums))
+	for j := range report.Albums {
+		rows[j] = j
+		columns = append(columns, column[int]{header: strconv.Itoa(j + 1), value: func(i int) string { return strconv.Itoa(report.Matrix[i][j]) }})
+	}
+	return writeRecords(f, rows, columns)
+}
+
+// WriteCategoryCounts writes how many media items each content category holds with a few of them
+func (f *Formatter) WriteCategoryCounts(counts []usecase.CategoryCount) error {
+	return writeRecords(f, counts, categoryCountColumns)
+}
+
+// WriteLibraryStats writes the library statistics one figure per row: the totals, then the media
+// items per year, the largest albums, the cameras and the largest videos. JSON holds the report as
+// it is.
+func (f *Formatter) WriteLibraryStats(stats usecase.LibraryStats) error {
+	stats.UpdatedAt = timeIn(stats.UpdatedAt, f.timeZone)
+	if f.format == OutputJSON {
+		return f.writeJSON(stats)
+	}
+
+	rows := []statsRow{
+		{Section: "total", Name: "items", Value: strconv.Itoa(stats.Items)},
+		{Section: "total", Name: "photos", Value: strconv.Itoa(stats.Photos)},
+		{Section: "total", Name: "videos", Value: strconv.Itoa(stats.Videos)},
+		{Section: "total", Name: "estimated_size", Value: formatBytes(stats.EstimatedSize)},
+	}
+	for _, year := range stats.Years {
+		name := "unknown"
+		if year.Year != 0 {
+			name = strconv.Itoa(year.Year)
+		}
+		rows = append(rows, statsRow{Section: "year", Name: name, Value: strconv.Itoa(year.Photos + year.Videos), Detail: fmt.Sprintf("%d photos, %d videos", year.Photos, year.Videos)})
+	}
+	for _, album := range stats.Albums {
+		rows = append(rows, statsRow{Section: "album", Name: album.Album.Title, Value: strconv.Itoa(album.Items), Detail: album.Album.ID})
+	}
+	for _, camera := range stats.Cameras {
+		rows = append(rows, statsRow{Section: "camera", Name: cmp.Or(camera.Camera, "unknown"), Value: strconv.Itoa(camera.Items)})
+	}
+	for _, item := range stats.LargestVideos {
+		var dimensions string
+		if item.MediaMetadata != nil && item.MediaMetadata.Width > 0 {
+			dimensions = fmt.Sprintf("%dx%d", item.MediaMetadata.Width, item.MediaMetadata.Height)
+		}
+		rows = append(rows, statsRow{Section: "video", Name: cmp.Or(item.Filename, item.ID), Value: dimensions, Detail: item.ID})
+	}
+	return writeRecords(f, rows, statsColumns)
+}
+
+// WriteGrowthMonths writes the forecast size of the library at the end of every month
+func (f *Formatter) WriteGrowthMonths(months []usecase.GrowthMonth) error {
+	return writeRecords(f, months, growthMonthColumns)
+}
+
+// WriteTierForecasts writes when the library outgrows each storage tier
+func (f *Formatter) WriteTierForecasts(tiers []usecase.TierForecast) error {
+	return writeRecords(f, tiers, tierForecastColumns)
+}
+
+// WriteQuotaSteps writes the requests every step of a quota plan sends and how long they take
+func (f *Formatter) WriteQuotaSteps(steps []usecase.QuotaStep) error {
+	return writeRecords(f, steps, quotaStepColumns)
+}
+
+// WriteOCRResults writes the outcome of reading the text of each file
+func (f *Formatter) WriteOCRResults(results []usecase.OCRResult) error {
+	return writeRecords(f, results, ocrColumns)
+}
+
+// WriteTextMatches writes the files found by their text
+func (f *Formatter) WriteTextMatches(matches []usecase.TextMatch) error {
+	return writeRecords(f, matches, textMatchColumns)
+}
+
+// WriteDescribeResults writes the outcome of setting the description of every media item
+func (f *Formatter) WriteDescribeResults(results []usecase.DescribeResult) error {
+	return writeRecords(f, results, describeColumns)
+}
+
+// WriteDownloadResults writes the outcome of every downloaded media item
+func (f *Formatter) WriteDownloadResults(results []usecase.DownloadResult) error {
+	return writeRecords(f, results, downloadColumns)
+}
+
+// WritePrintResults writes the outcome of preparing each photo for each print size
+func (f *Formatter) WritePrintResults(results []usecase.PrintResult) error {
+	return writeRecords(f, results, printColumns)
+}
+
+// WriteContactSheetPages writes the pages of a rendered contact sheet
+func (f *Formatter) WriteContactSheetPages(pages []usecase.ContactSheetPage) error {
+	return writeRecords(f, pages, contactSheetColumns)
+}
+
+// WriteLayoutResult writes where a calendar or photo book was saved and what it holds
+func (f *Formatter) WriteLayoutResult(result usecase.LayoutResult) error {
+	return writeRecord(f, result, layoutResultColumns)
+}
+
+// WriteExportResult writes where an album was exported and what the archive holds
+func (f *Formatter) WriteExportResult(result usecase.ExportResult) error {
+	return writeRecord(f, result, exportResultColumns)
+}
+
+// WriteReelResult writes where a highlight reel was saved, what it holds and its uploaded media item
+func (f *Formatter) WriteReelResult(result usecase.ReelResult) error {
+	return writeRecord(f, result, reelResultColumns)
+}
+
+// WriteAccountInfo writes the identity, scopes and expiry of the logged-in account
+func (f *Formatter) WriteAccountInfo(info domain.AccountInfo) error {
+	return writeRecord(f, info, accountColumns)
+}
+
+// WriteIndexResult writes the outcome of building or updating the local index
+func (f *Formatter) WriteIndexResult(result usecase.IndexResult) error {
+	return writeRecord(f, result, indexResultColumns)
+}
+
+// WriteIndexStats writes how much the local index holds and when it was last updated
+func (f *Formatter) WriteIndexStats(stats domain.IndexStats) error {
+	stats.UpdatedAt = timeIn(stats.UpdatedAt, f.timeZone)
+	return writeRecord(f, stats, indexStatsColumns)
+}
+
+// WriteMediaItems writes a list of media items
+func (f *Formatter) WriteMediaItems(items []domain.MediaItem) error {
+	shown := make([]domain.MediaItem, len(items))
+	for i, item := range items {
+		shown[i] = inTimeZone(item, f.timeZone)
+	}
+	return writeRecords(f, shown, mediaItemColumns)
+}
+
+// WriteSyncChanges writes the changes found by a sync
+func (f *Formatter) WriteSyncChanges(changes []usecase.SyncChange) error {
+	return writeRecords(f, changes, syncChangeColumns)
+}
+
+// WriteMirrorFiles writes the outcome of checking files of a mirror
+func (f *Formatter) WriteMirrorFiles(files []usecase.MirrorFile) error {
+	return writeRecords(f, files, mirrorFileColumns)
+}
+
+// WriteSyncStatus writes the persisted state of a profile's sync
+func (f *Formatter) WriteSyncStatus(status usecase.SyncStatus) error {
+	status.Watermark = timeIn(status.Watermark, f.timeZone)
+	status.LastSyncAt = timeIn(status.LastSyncAt, f.timeZone)
+	status.LastFullSyncAt = timeIn(status.LastFullSyncAt, f.timeZone)
+	return writeRecord(f, status, syncStatusColumns)
+}
+
+// WriteJobStatuses writes the status of every daemon job; next_run is "never" while no daemon runs
+func (f *Formatter) WriteJobStatuses(statuses []domain.JobStatus) error {
+	for i := range statuses {
+		statuses[i].LastStart = timeIn(statuses[i].LastStart, f.timeZone)
+		statuses[i].LastEnd = timeIn(statuses[i].LastEnd, f.timeZone)
+		statuses[i].NextRun = timeIn(statuses[i].NextRun, f.timeZone)
+	}
+	return writeRecords(f, statuses, jobStatusColumns)
+}
+
+// WriteBackupResults writes the media items a backup copied or failed to copy
+func (f *Formatter) WriteBackupResults(results []usecase.BackupResult) error {
+	return writeRecords(f, results, backupResultColumns)
+}
+
+// WriteBackupStatus writes what a backup target holds and when its manifest was last saved
+func (f *Formatter) WriteBackupStatus(status usecase.BackupStatus) error {
+	status.UpdatedAt = timeIn(status.UpdatedAt, f.timeZone)
+	return writeRecord(f, status, backupStatusColumns)
+}
+
+// WriteDuplicateGroups writes one row per media item of every duplicate group, numbered from 1
+func (f *Formatter) WriteDuplicateGroups(groups []usecase.DuplicateGroup) error {
+	var rows []duplicateRow
+	for i, group := range groups {
+		for _, item := range group.Items {
+			rows = append(rows, duplicateRow{Group: i + 1, MediaItem: inTimeZone(item, f.timeZone)})
+		}
+	}
+	return writeRecords(f, rows, duplicateColumns)
+}
+
+// WriteSimilarMatches writes the matches of a similarity search, closest first
+func (f *Formatter) WriteSimilarMatches(matches []usecase.SimilarMatch) error {
+	return writeRecords(f, matches, similarColumns)
+}
+
+// WriteMagicResults writes the outcome of applying each magic rule
+func (f *Formatter) WriteMagicResults(results []usecase.MagicResult) error {
+	return writeRecords(f, results, magicResultColumns)
+}
+
+// WriteConfigSchema writes a JSON Schema; it is JSON in every format
+func (f *Formatter) WriteConfigSchema(schema map[string]any) error {
+	return f.writeJSON(schema)
+}
+
+// WriteProfiles writes a list of profiles
+func (f *Formatter) WriteProfiles(profiles []domain.Profile) error {
+	return writeRecords(f, profiles, profileColumns)
+}
+
+// errorReport is the JSON form of a failure, with the code and hint of its kind in the error
+// catalog when it has one
+type errorReport struct {
+	Error string           `json:"error"`
+	Code  domain.ErrorCode `json:"code,omitempty"`
+	Hint  string           `json:"hint,omitempty"`
+}
+
+// newErrorReport describes err without the secrets it may quote
+func newErrorReport(err error) errorReport {
+	entry := domain.ClassifyError(err)
+	return errorReport{Error: domain.RedactError(err).Error(), Code: entry.Code, Hint: entry.Hint}
+}
+
+// WriteError writes a failure as {"error": "...", "code": "PHM-0404", "hint": "..."}. Only JSON
+// output carries errors; the other formats write nothing, as errors are printed to stderr.
+func (f *Formatter) WriteError(err error) error {
+	if f.format != OutputJSON {
+		return nil
+	}
+	return f.writeJSON(newErrorReport(err))
+}
+
+// writeRecord writes a single record in the formatter's format.
+// Tables show one field per line since a single wide row is hard to read.
+func writeRecord[T any](f *Formatter, record T, columns []column[T]) error {
+	switch f.format {
+	case OutputJSON:
+		return f.writeJSON(record)
+	case OutputCSV:
+		return writeCSV(f.w, []T{record}, columns)
+	default:
+		return writeDetails(f.w, record, columns)
+	}
+}
+
+// writeRecords writes records in the formatter's format
+func writeRecords[T any](f *Formatter, records []T, columns []column[T]) error {
+	switch f.format {
+	case OutputJSON:
+		if records == nil {
+			records = []T{}
+		}
+		return f.writeJSON(records)
+	case OutputCSV:
+		return writeCSV(f.w, records, columns)
+	default:
+		return writeTable(f.w, records, columns)
+	}
+}
+
+// writeJSON writes v as indented JSON
+func (f *Formatter) writeJSON(v any) error {
+	enc := json.NewEncoder(f.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON output: %v", err)
+	}
+	return nil
+}
+
+// writeCSV writes records as CSV with a header row
+func writeCSV[T any](w io.Writer, records []T, columns []column[T]) error {
+	cw := csv.NewWriter(w)
+
+	row := make([]string, len(columns))
+	for i, col := range columns {
+		row[i] = col.header
+	}
+	cw.Write(row)
+
+	for _, record := range records {
+		for i, col := range columns {
+			row[i] = col.value(record)
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV output: %v", err)
+	}
+	return nil
+}
+
+// writeDetails writes a single record as aligned "FIELD  value" lines
+func writeDetails[T any](w io.Writer, record T, columns []column[T]) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, col := range columns {
+		fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(col.header), tableCell(col.value(record)))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write table output: %v", err)
+	}
+	return nil
+}
+
+// writeTable writes records as aligned columns with an upper-case header row
+func writeTable[T any](w io.Writer, records []T, columns []column[T]) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	row := make([]string, len(columns))
+	for i, col := range columns {
+		row[i] = strings.ToUpper(col.header)
+	}
+	fmt.Fprintln(tw, strings.Join(row, "\t"))
+
+	for _, record := range records {
+		for i, col := range columns {
+			row[i] = tableCell(col.value(record))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write table output: %v", err)
+	}
+	return nil
+}
+
+// formatOptionalTime formats t as RFC 3339, or "never" for the zero time
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// inTimeZone returns item with its creation time moved to loc, leaving item itself unchanged;
+// a nil loc returns item as is
+func inTimeZone(item domain.MediaItem, loc *time.Location) domain.MediaItem {
+	if loc == nil || item.MediaMetadata == nil || item.MediaMetadata.CreationTime.IsZero() {
+		return item
+	}
+	metadata := *item.MediaMetadata
+	metadata.CreationTime = timeIn(metadata.CreationTime, loc)
+	item.MediaMetadata = &metadata
+	return item
+}
+
+// timeIn returns t in loc; the zero time and a nil loc leave t as is
+func timeIn(t time.Time, loc *time.Location) time.Time {
+	if loc == nil || t.IsZero() {
+		return t
+	}
+	return t.In(loc)
+}
+
+// formatWallTime formats a time without a time zone the way EXIF has it, or "" for the zero time
+func formatWallTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateTime)
+}
+
+// formatCreationTime formats the capture time of a media item as RFC 3339, or "" when unknown
+func formatCreationTime(item domain.MediaItem) string {
+	if item.MediaMetadata == nil || item.MediaMetadata.CreationTime.IsZero() {
+		return ""
+	}
+	return item.MediaMetadata.CreationTime.Format(time.RFC3339)
+}
+
+// tableCell flattens whitespace in a value, since tabs and newlines would break the column layout
+func tableCell(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
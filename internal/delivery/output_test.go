@@ -0,0 +1,190 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+func TestFormatter_WriteAlbums(t *testing.T) {
+	albums := []domain.Album{
+		{ID: "1", Title: "Summer, 2024", MediaItemsCount: 12, IsWriteable: true, ProductURL: "https://photos.google.com/lr/album/1"},
+		{ID: "22", Title: "Trip", ShareInfo: &domain.ShareInfo{ShareableURL: "https://photos.app.goo.gl/x"}},
+	}
+
+	tests := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{format: OutputTable, want: "" +
+			"ID  TITLE         ITEMS  WRITEABLE  SHARED  PRODUCT_URL\n" +
+			"1   Summer, 2024  12     true       false   https://photos.google.com/lr/album/1\n" +
+			"22  Trip          0      false      true    \n"},
+		{format: OutputCSV, want: "" +
+			"id,title,items,writeable,shared,product_url\n" +
+			"1,\"Summer, 2024\",12,true,false,https://photos.google.com/lr/album/1\n" +
+			"22,Trip,0,false,true,\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewFormatter(&buf, tt.format).WriteAlbums(albums); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatter_WriteAlbumDetails(t *testing.T) {
+	var buf bytes.Buffer
+	album := domain.Album{ID: "1", Title: "A", CoverPhotoMediaItemID: "m1", ShareInfo: &domain.ShareInfo{ShareableURL: "https://photos.app.goo.gl/x"}}
+	if err := NewFormatter(&buf, OutputTable).WriteAlbum(album); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, want := range []string{"COVER_PHOTO_ID        m1\n", "SHAREABLE_URL         https://photos.app.goo.gl/x\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected output to contain %q, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestFormatter_WriteShareInventory(t *testing.T) {
+	var buf bytes.Buffer
+	albums := []domain.Album{{ID: "1", Title: "Trip", MediaItemsCount: 3, ShareInfo: &domain.ShareInfo{
+		ShareableURL:       "https://photos.app.goo.gl/x",
+		SharedAlbumOptions: domain.SharedAlbumOptions{IsCollaborative: true},
+		IsOwned:            true,
+	}}}
+	if err := NewFormatter(&buf, OutputCSV).WriteShareInventory(albums); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := "id,title,items,shareable_url,collaborative,commentable\n1,Trip,3,https://photos.app.goo.gl/x,true,false\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestFormatter_WriteOverlapMatrix(t *testing.T) {
+	var buf bytes.Buffer
+	report := &usecase.OverlapReport{
+		Albums: []domain.Album{{ID: "1", Title: "Home"}, {ID: "2", Title: "Trip"}},
+		Matrix: [][]int{{3, 1}, {1, 4}},
+	}
+	if err := NewFormatter(&buf, OutputCSV).WriteOverlapMatrix(report); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := "#,album,1,2\n1,Home,3,1\n2,Trip,1,4\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestFormatter_WriteLibraryStats(t *testing.T) {
+	var buf bytes.Buffer
+	stats := usecase.LibraryStats{
+		Items:         2,
+		Photos:        1,
+		Videos:        1,
+		EstimatedSize: 84 << 20,
+		Years:         []usecase.YearCount{{Year: 0, Photos: 1}, {Year: 2024, Videos: 1}},
+		Albums:        []usecase.AlbumCount{{Album: domain.Album{ID: "a1", Title: "Trip"}, Items: 2}},
+		Cameras:       []usecase.CameraCount{{Items: 1}, {Camera: "Pixel 8", Items: 1}},
+		LargestVideos: []domain.MediaItem{{ID: "v1", Filename: "clip.mp4", MediaMetadata: &domain.MediaMetadata{Width: 1920, Height: 1080}}},
+	}
+	if err := NewFormatter(&buf, OutputCSV).WriteLibraryStats(stats); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := "section,name,value,detail\n" +
+		"total,items,2,\ntotal,photos,1,\ntotal,videos,1,\ntotal,estimated_size,84.0 MiB,\n" +
+		"year,unknown,1,\"1 photos, 0 videos\"\nyear,2024,1,\"0 photos, 1 videos\"\n" +
+		"album,Trip,2,a1\ncamera,unknown,1,\ncamera,Pixel 8,1,\nvideo,clip.mp4,1920x1080,v1\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestFormatter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewFormatter(&buf, OutputJSON).WriteAlbums(nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("Expected an empty JSON array, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := NewFormatter(&buf, OutputJSON).WriteAlbum(domain.Album{ID: "1", Title: "A"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var album domain.Album
+	if err := json.Unmarshal(buf.Bytes(), &album); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", buf.String(), err)
+	}
+	if album.ID != "1" || album.Title != "A" {
+		t.Errorf("Expected album 1/A, got %+v", album)
+	}
+}
+
+func TestFormatter_WriteError(t *testing.T) {
+	var buf bytes.Buffer
+	err := fmt.Errorf("rename: %w", domain.ErrAlbumReadOnly)
+	if err := NewFormatter(&buf, OutputJSON).WriteError(err); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var report errorReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", buf.String(), err)
+	}
+	if report.Error != "rename: album is read-only" || report.Code != "PHM-0423" || report.Hint == "" {
+		t.Errorf("Expected the error with its code and hint, got %+v", report)
+	}
+
+	buf.Reset()
+	if err := NewFormatter(&buf, OutputTable).WriteError(err); err != nil || buf.Len() != 0 {
+		t.Errorf("Expected tables to leave errors to stderr, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestFormatter_TimeZone(t *testing.T) {
+	created := time.Date(2024, 7, 1, 22, 30, 0, 0, time.UTC)
+	items := []domain.MediaItem{{ID: "1", Filename: "a.jpg", MediaMetadata: &domain.MediaMetadata{CreationTime: created}}}
+	var buf bytes.Buffer
+	out := NewFormatter(&buf, OutputTable)
+	out.SetTimeZone(time.FixedZone("CEST", 2*60*60))
+
+	if err := out.WriteMediaItems(items); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "2024-07-02T00:30:00+02:00") {
+		t.Errorf("Expected the creation time in the time zone, got %q", buf.String())
+	}
+	// The items passed in keep their UTC time
+	if items[0].MediaMetadata.CreationTime.Location() != time.UTC {
+		t.Errorf("Expected the media item to be left unchanged, got %v", items[0].MediaMetadata.CreationTime)
+	}
+}
+
+func TestOutputFormat_Set(t *testing.T) {
+	var format OutputFormat
+	if err := format.Set("JSON"); err != nil || format != OutputJSON {
+		t.Errorf("Expected json format, got %q (%v)", format, err)
+	}
+	if err := format.Set("yaml"); err == nil {
+		t.Error("Expected unsupported format to be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+package delivery
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	// progressBarWidth is the number of cells of the bar
+	progressBarWidth = 24
+	// progressRedrawInterval bounds how often the bar is drawn, so fast jobs do not flood the terminal
+	progressRedrawInterval = 100 * time.Millisecond
+)
+
+// progressJob describes how the progress of a kind of job is shown
+type progressJob struct {
+	// verb is shown in front of the bar
+	verb string
+	// message, items and item are the log message and the attributes holding the total and the item
+	message, items, item string
+}
+
+// progressJobs holds the kinds of jobs that report progress
+var progressJobs = map[string]progressJob{
+	domain.JobUpload:   {verb: "Uploading", message: "Uploaded file", items: "files", item: "file"},
+	domain.JobDownload: {verb: "Downloading", message: "Downloaded media item", items: "media_items", item: "path"},
+	domain.JobBackup:   {verb: "Backing up", message: "Backed up media item", items: "media_items", item: "key"},
+}
+
+// newProgress picks how the progress of long jobs is shown: a bar on the status line of a
+// terminal, else a log line per finished item. --quiet shows none and --log-format json keeps
+// to log lines, which stay machine readable.
+func newProgress(status *statusLine, opts GlobalOptions) domain.Progress {
+	switch {
+	case opts.Quiet:
+		return domain.NopProgress{}
+	case status != nil && opts.LogFormat != LogJSON:
+		return &progressBar{status: status, logger: opts.Logger, now: time.Now}
+	default:
+		return &progressLog{logger: opts.Logger}
+	}
+}
+
+// progressLog logs a line with the counts and the remaining time for every finished item
+type progressLog struct {
+	logger *slog.Logger
+}
+
+// Update implements domain.Progress
+func (p *progressLog) Update(update domain.ProgressUpdate) {
+	job := progressJobs[update.Job]
+	p.logger.Info(job.message, progressAttrs(job, update)...)
+}
+
+// Finish implements domain.Progress
+func (p *progressLog) Finish(string) {}
+
+// progressBar draws a bar with the counts and the remaining time on the status line. The log
+// lines of finished items are kept at debug level, for --verbose and transcripts.
+type progressBar struct {
+	status *statusLine
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	drawn time.Time
+}
+
+// Update implements domain.Progress
+func (p *progressBar) Update(update domain.ProgressUpdate) {
+	job := progressJobs[update.Job]
+	p.logger.Debug(job.message, progressAttrs(job, update)...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now := p.now(); now.Sub(p.drawn) >= progressRedrawInterval || update.Done == update.Total {
+		p.drawn = now
+		p.status.set(renderProgressBar(job, update))
+	}
+}
+
+// Finish implements domain.Progress and leaves the last state of the bar on the terminal
+func (p *progressBar) Finish(string) {
+	p.status.keep()
+}
+
+// progressAttrs are the attributes of the log line of a finished item
+func progressAttrs(job progressJob, update domain.ProgressUpdate) []any {
+	status := "done"
+	switch {
+	case update.Failed:
+		status = "failed"
+	case update.Skipped:
+		status = "skipped"
+	}
+	var eta any = update.ETA
+	if update.ETA < 0 {
+		eta = "unknown"
+	}
+	return []any{"done", update.Done, job.items, update.Total, "eta", eta, "bytes", update.Bytes, "status", status, job.item, update.Item}
+}
+
+// renderProgressBar formats an update such as
+// "Uploading [##########--------------] 12/30 files, 4.2 MiB, 1 failed, eta 1m20s"
+func renderProgressBar(job progressJob, update domain.ProgressUpdate) string {
+	filled := progressBarWidth
+	if update.Total > 0 {
+		filled = progressBarWidth * update.Done / update.Total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	parts := []string{fmt.Sprintf("%d/%d %s", update.Done, update.Total, strings.ReplaceAll(job.items, "_", " ")), formatBytes(update.Bytes)}
+	if update.Failures > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", update.Failures))
+	}
+	switch {
+	case update.ETA < 0:
+		parts = append(parts, "eta unknown")
+	case update.Done < update.Total:
+		parts = append(parts, "eta "+update.ETA.String())
+	}
+	return fmt.Sprintf("%s [%s] %s", job.verb, bar, strings.Join(parts, ", "))
+}
+
+// formatBytes formats n with a binary unit, such as 4.2 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// statusLine keeps a line, such as a progress bar, at the bottom of a terminal: everything else
+// written through it, such as log records, is printed above the line, which is then redrawn
+type statusLine struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+// clearLine moves the cursor to the start of the line and erases it
+const clearLine = "\r\x1b[K"
+
+// Write implements io.Writer; p must end with a newline, as log records do
+func (s *statusLine) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line == "" {
+		return s.w.Write(p)
+	}
+	io.WriteString(s.w, clearLine)
+	n, err := s.w.Write(p)
+	io.WriteString(s.w, s.line)
+	return n, err
+}
+
+// set replaces the status line
+func (s *statusLine) set(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line = line
+	io.WriteString(s.w, clearLine+line)
+}
+
+// keep ends the status line, leaving it on the terminal above what is written next
+func (s *statusLine) keep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.line != "" {
+		io.WriteString(s.w, "\n")
+		s.line = ""
+	}
+}
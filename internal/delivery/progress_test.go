@@ -0,0 +1,74 @@
+package delivery
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestRenderProgressBar(t *testing.T) {
+	job := progressJobs[domain.JobUpload]
+	tests := []struct {
+		update domain.ProgressUpdate
+		want   string
+	}{
+		{
+			update: domain.ProgressUpdate{Done: 12, Total: 48, Bytes: 4404019, Failures: 1, ETA: 80 * time.Second},
+			want:   "Uploading [######------------------] 12/48 files, 4.2 MiB, 1 failed, eta 1m20s",
+		},
+		{
+			update: domain.ProgressUpdate{Done: 1, Total: 2, Bytes: 512, ETA: -1},
+			want:   "Uploading [############------------] 1/2 files, 512 B, eta unknown",
+		},
+		{
+			update: domain.ProgressUpdate{Done: 2, Total: 2, Bytes: 3 << 30},
+			want:   "Uploading [########################] 2/2 files, 3.0 GiB",
+		},
+	}
+	for _, tt := range tests {
+		if got := renderProgressBar(job, tt.update); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	status := &statusLine{w: &buf}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bar := &progressBar{status: status, logger: newLogger(status, GlobalOptions{}), now: func() time.Time { return now }}
+
+	bar.Update(domain.ProgressUpdate{Job: domain.JobDownload, Done: 1, Total: 3, ETA: -1})
+	// Updates right after a redraw are only drawn when they finish the job
+	bar.Update(domain.ProgressUpdate{Job: domain.JobDownload, Done: 2, Total: 3, ETA: -1})
+	bar.logger.Warn("Failed to download")
+	bar.Update(domain.ProgressUpdate{Job: domain.JobDownload, Done: 3, Total: 3})
+	bar.Finish(domain.JobDownload)
+
+	got := buf.String()
+	if strings.Contains(got, "2/3") {
+		t.Errorf("Expected the second update to be skipped, got %q", got)
+	}
+	// The log record is printed on a cleared line, then the bar is redrawn below it
+	if !strings.Contains(got, clearLine+"time=") || !strings.Contains(got, "msg=\"Failed to download\"\n"+"Downloading [########") {
+		t.Errorf("Expected the log record above the bar, got %q", got)
+	}
+	if !strings.HasSuffix(got, clearLine+"Downloading [########################] 3/3 media items, 0 B\n") {
+		t.Errorf("Expected the finished bar to be kept, got %q", got)
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	var buf bytes.Buffer
+	progress := &progressLog{logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	progress.Update(domain.ProgressUpdate{Job: domain.JobUpload, Item: "a.jpg", Failed: true, Done: 1, Total: 2, Failures: 1, Bytes: 10, ETA: -1})
+
+	if got := buf.String(); !strings.Contains(got, `msg="Uploaded file" done=1 files=2 eta=unknown bytes=10 status=failed file=a.jpg`) {
+		t.Errorf("Expected a log line with the counts, got %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+package delivery
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ANSI escapes that draw dark modules on a light background whatever the terminal theme is,
+// since phone cameras do not reliably read inverted codes
+const (
+	qrColors = "\x1b[30;47m"
+	qrReset  = "\x1b[0m"
+)
+
+// writeQRCode renders text as a QR code for the terminal. Each line of output holds two rows of
+// modules using half-block characters, so the code stays roughly square.
+func writeQRCode(w io.Writer, text string) error {
+	code, err := qrcode.New(text, qrcode.Low)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %v", err)
+	}
+
+	bitmap := code.Bitmap()
+	var b strings.Builder
+	for y := 0; y < len(bitmap); y += 2 {
+		b.WriteString(qrColors)
+		for x := range bitmap[y] {
+			top := bitmap[y][x]
+			bottom := y+1 < len(bitmap) && bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(qrReset + "\n")
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,29 @@
+package delivery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteQRCode(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := writeQRCode(&buf, "https://photos.app.goo.gl/abc"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	// A version 2 code is 25 modules plus a quiet zone of 4 on each side, two rows per line
+	if len(lines) != 17 {
+		t.Errorf("Expected 17 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, qrColors) || !strings.HasSuffix(line, qrReset) {
+			t.Fatalf("Expected every line to set and reset colors, got %q", line)
+		}
+		if n := len([]rune(strings.TrimSuffix(strings.TrimPrefix(line, qrColors), qrReset))); n != 33 {
+			t.Fatalf("Expected 33 modules per line, got %d", n)
+		}
+	}
+}
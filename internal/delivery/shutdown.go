@@ -0,0 +1,106 @@
+package delivery
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// shutdown coordinates how a run ends. Commands that can be interrupted take its context, which
+// the first Ctrl-C or SIGTERM cancels; a second one kills the process as usual, for when stopping
+// takes too long. Cleanup registered with OnExit runs once the command returned, however it ended,
+// in reverse order of registration like deferred calls, unless it was run before. It implements
+// domain.ExitHooks for the use cases and repositories of the command.
+type shutdown struct {
+	mu    sync.Mutex
+	steps []*shutdownStep
+	ctx   context.Context
+	stop  context.CancelFunc
+	// parent replaces the signals when set, for the commands of daemon jobs, which stop with the
+	// daemon
+	parent context.Context
+}
+
+// shutdownStep is a cleanup function with the name it is logged under when it fails
+type shutdownStep struct {
+	name string
+	fn   func(context.Context) error
+	once sync.Once
+	err  error
+}
+
+// call runs the step unless it ran before, and returns how it ended
+func (s *shutdownStep) call() error {
+	s.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), domain.ExitTimeout)
+		defer cancel()
+		s.err = s.fn(ctx)
+	})
+	return s.err
+}
+
+// context returns the context of the run, cancelled by the first Ctrl-C or SIGTERM. Signals are
+// only caught from the first call on, so commands that never ask stop at once when interrupted.
+func (s *shutdown) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil && s.parent != nil {
+		s.ctx, s.stop = context.WithCancel(s.parent)
+	}
+	if s.ctx == nil {
+		s.ctx, s.stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		ctx, stop := s.ctx, s.stop
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+	}
+	return s.ctx
+}
+
+// OnExit registers fn to run when the run ends and returns a function running it at once
+// instead; fn gets a context bounded by domain.ExitTimeout
+func (s *shutdown) OnExit(name string, fn func(context.Context) error) func() error {
+	step := &shutdownStep{name: name, fn: fn}
+	s.mu.Lock()
+	s.steps = append(s.steps, step)
+	s.mu.Unlock()
+	return func() error {
+		s.mu.Lock()
+		s.steps = slices.DeleteFunc(s.steps, func(other *shutdownStep) bool { return other == step })
+		s.mu.Unlock()
+		return step.call()
+	}
+}
+
+// closeOnExit registers closing c, such as a use case holding the local index, as a cleanup step
+func (s *shutdown) closeOnExit(name string, c io.Closer) {
+	s.OnExit("close "+name, func(context.Context) error {
+		return c.Close()
+	})
+}
+
+// run stops catching signals and runs the registered cleanup, newest first. Failures are logged
+// and do not keep the other steps from running.
+func (s *shutdown) run(logger *slog.Logger) {
+	s.mu.Lock()
+	steps := s.steps
+	s.steps = nil
+	if s.stop != nil {
+		s.stop()
+	}
+	s.mu.Unlock()
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := steps[i].call(); err != nil {
+			logger.Warn("Failed to "+steps[i].name, "error", err)
+		}
+	}
+}
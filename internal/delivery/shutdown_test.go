@@ -0,0 +1,100 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestShutdown_Run(t *testing.T) {
+	var s shutdown
+	ctx := s.context()
+	if s.context() != ctx {
+		t.Error("Expected every command of a run to share one context")
+	}
+
+	var order []string
+	s.OnExit("flush traces", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected cleanup to be bounded by a deadline")
+		}
+		order = append(order, "traces")
+		return nil
+	})
+	s.closeOnExit("the local index", closerFunc(func() error {
+		order = append(order, "index")
+		return errors.New("disk full")
+	}))
+	s.OnExit("remove staging files", func(context.Context) error {
+		order = append(order, "staging")
+		return nil
+	})
+
+	var logs bytes.Buffer
+	s.run(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if got := strings.Join(order, ","); got != "staging,index,traces" {
+		t.Errorf("Expected cleanup newest first despite failures, got %s", got)
+	}
+	if !strings.Contains(logs.String(), `msg="Failed to close the local index" error="disk full"`) {
+		t.Errorf("Expected the failed step to be logged, got %q", logs.String())
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected signals to no longer be caught after the run")
+	}
+
+	// Steps run once, even if the run ends twice
+	order = nil
+	s.run(slog.New(slog.NewTextHandler(&logs, nil)))
+	if len(order) != 0 {
+		t.Errorf("Expected no step to run again, got %v", order)
+	}
+}
+
+func TestShutdown_Done(t *testing.T) {
+	var s shutdown
+	var removed []string
+	done := s.OnExit("remove a.tmp", func(context.Context) error {
+		removed = append(removed, "a.tmp")
+		return nil
+	})
+	s.OnExit("remove b.tmp", func(context.Context) error {
+		removed = append(removed, "b.tmp")
+		return nil
+	})
+
+	// An operation finishing cleans up at once, and the run does not do it again
+	if err := done(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	s.run(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := done(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := strings.Join(removed, ","); got != "a.tmp,b.tmp" {
+		t.Errorf("Expected every step to run once, got %s", got)
+	}
+}
+
+func TestShutdown_Parent(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	s := shutdown{parent: parent}
+	ctx := s.context()
+
+	cancel()
+
+	if ctx.Err() == nil {
+		t.Error("Expected the command of a daemon job to stop with the daemon")
+	}
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
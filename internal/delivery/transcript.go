@@ -0,0 +1,136 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// secretKeys are log attributes and flags whose string values are always secrets
+var secretKeys = map[string]bool{
+	"access_token":  true,
+	"api_key":       true,
+	"authorization": true,
+	"client_secret": true,
+	"code":          true,
+	"password":      true,
+	"refresh_token": true,
+	"secret":        true,
+	"token":         true,
+}
+
+// scrubAttr redacts the values of secret attributes and the secrets in every other value
+func scrubAttr(groups []string, a slog.Attr) slog.Attr {
+	if v := a.Value.Resolve(); v.Kind() == slog.KindString && secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, domain.Redacted)
+	}
+	return redactAttr(groups, a)
+}
+
+// scrubArgs redacts the values of secret flags, given as --token VALUE or --token=VALUE, and
+// the secrets in every other argument
+func scrubArgs(args []string) []string {
+	scrubbed := make([]string, len(args))
+	for i, arg := range args {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case strings.HasPrefix(arg, "-") && hasValue && secretKeys[name]:
+			scrubbed[i] = arg[:strings.Index(arg, "=")+1] + domain.Redacted
+		case i > 0 && strings.HasPrefix(args[i-1], "-") && !strings.Contains(args[i-1], "=") && secretKeys[strings.TrimLeft(args[i-1], "-")]:
+			scrubbed[i] = domain.Redacted
+		default:
+			scrubbed[i] = domain.RedactSecrets(arg)
+		}
+	}
+	return scrubbed
+}
+
+// transcript records a run for bug reports: the command line, every log record down to debug
+// level (which includes the decisions made and a summary of each API call) and how the run
+// ended, as JSON lines with secrets scrubbed
+type transcript struct {
+	file   *os.File
+	logger *slog.Logger
+}
+
+// openTranscript creates the transcript file at path, replacing an earlier one
+func openTranscript(path string) (*transcript, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %v", err)
+	}
+	handler := slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: scrubAttr})
+	return &transcript{file: file, logger: slog.New(handler)}, nil
+}
+
+// tee returns a logger writing to both logger and the transcript; the transcript gets debug
+// records even when logger filters them out
+func (t *transcript) tee(logger *slog.Logger) *slog.Logger {
+	return slog.New(teeHandler{logger.Handler(), t.logger.Handler()})
+}
+
+// start records the command line and the environment it ran in
+func (t *transcript) start(args []string) {
+	t.logger.Info("Run started", "args", scrubArgs(args), "go", runtime.Version(), "os", runtime.GOOS, "arch", runtime.GOARCH)
+}
+
+// finish records the exit code and the error that caused it, then closes the file
+func (t *transcript) finish(code int, err error) error {
+	if err != nil {
+		t.logger.Error("Run finished", "exit_code", code, "error", err)
+	} else {
+		t.logger.Info("Run finished", "exit_code", code)
+	}
+	if err := t.file.Close(); err != nil {
+		return fmt.Errorf("failed to write transcript: %v", err)
+	}
+	return nil
+}
+
+// teeHandler sends each record to every handler that is enabled for its level
+type teeHandler []slog.Handler
+
+// Enabled implements slog.Handler
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements slog.Handler
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements slog.Handler
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup implements slog.Handler
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,52 @@
+package delivery
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.jsonl")
+	transcript, err := openTranscript(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var stderr bytes.Buffer
+	transcript.start([]string{"--transcript", path, "serve", "--token", "s3cret", "--allow-origin=https://a.test"})
+	logger := transcript.tee(newLogger(&stderr, GlobalOptions{}))
+	logger.Debug("Raw API response", "body", `{"baseUrl":"https://lh3.googleusercontent.com/lr/abc123","nextPageToken":"page2"}`)
+	logger.Info("No --token given, clients must send this bearer token", "token", "random")
+	logger.With("album_id", "a1").Warn("Retrying", "error", errors.New("POST https://oauth2.googleapis.com/token?refresh_token=1//0abc: 401"))
+	if err := transcript.finish(ExitError, errors.New(`token expired: {"access_token": "ya29.a0Af"}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the transcript to be written, got %v", err)
+	}
+	got := string(b)
+	for _, secret := range []string{"s3cret", "abc123", "random", "1//0abc", "ya29"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Expected %q to be scrubbed from %s", secret, got)
+		}
+	}
+	for _, want := range []string{`"--token","[REDACTED]"`, `"msg":"Raw API response"`, "page2", `"album_id":"a1"`, `"exit_code":1`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in the transcript, got %s", want, got)
+		}
+	}
+	if lines := strings.Count(got, "\n"); lines != 5 {
+		t.Errorf("Expected 5 records, got %d", lines)
+	}
+
+	// Stderr keeps its own level and sees the values unchanged
+	if strings.Contains(stderr.String(), "Raw API response") || !strings.Contains(stderr.String(), "token=random") {
+		t.Errorf("Expected stderr to get the info records as they are, got %q", stderr.String())
+	}
+}
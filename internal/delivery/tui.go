@@ -0,0 +1,591 @@
+package delivery
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+const (
+	// tuiPrefetch is how close to the end of a pane the selection gets before its next page is loaded
+	tuiPrefetch = 10
+	// Names of the pages of the TUI: the panes, and a dialog shown above them
+	tuiMainPage   = "main"
+	tuiDialogPage = "dialog"
+	tuiKeys       = "[::b]Tab[::-] pane  [::b]Enter[::-] open  [::b]n[::-] new album  [::b]r[::-] rename  [::b]d[::-] download  [::b]a[::-] add to album  [::b]/[::-] filter  [::b]s[::-] sort  [::b]q[::-] quit"
+)
+
+// TUIOptions configures the terminal browser
+type TUIOptions struct {
+	// DownloadDir receives downloaded media items
+	DownloadDir string
+	// TimeZone is where creation times are shown; nil shows UTC
+	TimeZone *time.Location
+	// Index filters and sorts the panes from memory; nil leaves filtering and sorting off
+	Index *usecase.SessionIndex
+}
+
+// TUI is the terminal browser of the tui command: albums on the left and the media items of the
+// open album on the right, each loaded a page at a time as the selection nears its end
+type TUI struct {
+	albumUseCase    *usecase.AlbumUseCase
+	galleryUseCase  *usecase.GalleryUseCase
+	downloadUseCase *usecase.DownloadUseCase
+	opts            TUIOptions
+
+	app    *tview.Application
+	pages  *tview.Pages
+	albums *tview.List
+	items  *tview.Table
+	status *tview.TextView
+
+	// background runs API calls off the UI goroutine and update applies their results on it
+	background func(fn func())
+	update     func(fn func())
+	ctx        context.Context
+
+	albumList  []domain.Album
+	albumPages paneState
+	// album is the album whose media items are shown, nil before one is opened
+	album     *domain.Album
+	itemList  []domain.MediaItem
+	itemPages paneState
+	// albumFilter, itemFilter and itemSort are what the panes are filtered and sorted by; while
+	// any is set, the pane shows the matches in the index instead of the pages of the API
+	albumFilter string
+	itemFilter  string
+	itemSort    usecase.IndexSort
+	// focus is the pane to return to when a dialog closes
+	focus tview.Primitive
+}
+
+// paneState tracks the incremental loading of a pane
+type paneState struct {
+	// next is the token of the next page, and done is set once the last page is loaded
+	next    string
+	done    bool
+	loading bool
+	// generation tells pages of the open album apart from late pages of the one before
+	generation int
+}
+
+// NewTUI creates a new instance of TUI
+func NewTUI(albumUseCase *usecase.AlbumUseCase, galleryUseCase *usecase.GalleryUseCase, downloadUseCase *usecase.DownloadUseCase, opts TUIOptions) *TUI {
+	if opts.TimeZone == nil {
+		opts.TimeZone = time.UTC
+	}
+	t := &TUI{
+		albumUseCase:    albumUseCase,
+		galleryUseCase:  galleryUseCase,
+		downloadUseCase: downloadUseCase,
+		opts:            opts,
+		app:             tview.NewApplication(),
+		ctx:             context.Background(),
+	}
+	t.background = func(fn func()) { go fn() }
+	t.update = func(fn func()) { t.app.QueueUpdateDraw(fn) }
+
+	t.albums = tview.NewList().ShowSecondaryText(true)
+	t.albums.SetBorder(true).SetTitle(" Albums ")
+	t.albums.SetChangedFunc(func(index int, _, _ string, _ rune) {
+		if index >= len(t.albumList)-tuiPrefetch {
+			t.loadAlbums()
+		}
+		// The selected album is likely opened next
+		if index >= 0 && index < len(t.albumList) {
+			t.galleryUseCase.PrefetchAlbum(t.albumList[index].ID)
+		}
+	})
+	t.albums.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		t.openAlbum(index)
+		t.app.SetFocus(t.items)
+	})
+
+	t.items = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	t.items.SetBorder(true).SetTitle(" Media items ")
+	t.items.SetSelectionChangedFunc(func(row, _ int) {
+		if row-1 >= len(t.itemList)-tuiPrefetch {
+			t.loadItems()
+		}
+	})
+
+	t.status = tview.NewTextView().SetDynamicColors(true)
+	keys := tview.NewTextView().SetDynamicColors(true).SetText(tuiKeys)
+
+	panes := tview.NewFlex().
+		AddItem(t.albums, 0, 1, true).
+		AddItem(t.items, 0, 2, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(t.status, 1, 0, false).
+		AddItem(keys, 1, 0, false)
+	t.pages = tview.NewPages().AddPage(tuiMainPage, layout, true, true)
+	t.focus = t.albums
+
+	t.app.SetRoot(t.pages, true).SetInputCapture(t.handleKey)
+	return t
+}
+
+// Run shows the TUI until the user quits or ctx is cancelled
+func (t *TUI) Run(ctx context.Context) error {
+	t.ctx = ctx
+	stop := context.AfterFunc(ctx, t.app.Stop)
+	defer stop()
+
+	t.setStatus("Loading albums...")
+	t.loadAlbums()
+	return t.app.Run()
+}
+
+// handleKey runs the command bound to a key; dialogs get every key while they are shown
+func (t *TUI) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if front, _ := t.pages.GetFrontPage(); front != tuiMainPage {
+		return event
+	}
+
+	switch event.Key() {
+	case tcell.KeyTab, tcell.KeyBacktab:
+		if t.app.GetFocus() == t.items {
+			t.app.SetFocus(t.albums)
+		} else {
+			t.app.SetFocus(t.items)
+		}
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	switch event.Rune() {
+	case 'q':
+		t.app.Stop()
+	case 'n':
+		t.prompt("New album", "", t.createAlbum)
+	case 'r':
+		if album, ok := t.selectedAlbum(); ok {
+			t.prompt("Rename album", album.Title, func(title string) { t.renameAlbum(album.ID, title) })
+		}
+	case 'd':
+		t.download()
+	case 'a':
+		if item, ok := t.selectedItem(); ok {
+			t.pickAlbum(func(album domain.Album) { t.addToAlbum(item, album) })
+		}
+	case '/':
+		t.filter()
+	case 's':
+		t.cycleSort()
+	default:
+		return event
+	}
+	return nil
+}
+
+// loadAlbums appends the next page of albums, unless one is loading or the last one is shown
+func (t *TUI) loadAlbums() {
+	if t.albumPages.loading || t.albumPages.done {
+		return
+	}
+	t.albumPages.loading = true
+	req := domain.PageRequest{PageSize: domain.MaxAlbumPageSize, PageToken: t.albumPages.next}
+
+	t.background(func() {
+		page, err := t.albumUseCase.ListAlbums(t.ctx, req)
+		t.update(func() {
+			if err != nil {
+				t.albumPages.loading = false
+				t.setError("Failed to load albums", err)
+				return
+			}
+			t.albumPages.next, t.albumPages.done = page.NextPageToken, !page.HasNext()
+			t.albumList = append(t.albumList, page.Items...)
+			// Still loading while the items are added, so selecting the first does not load again
+			for _, album := range page.Items {
+				main, secondary := albumText(album)
+				t.albums.AddItem(main, secondary, 0, nil)
+			}
+			t.albumPages.loading = false
+			t.setStatus(fmt.Sprintf("%d albums%s", len(t.albumList), moreText(t.albumPages)))
+		})
+	})
+}
+
+// openAlbum shows the media items of the album at index in the albums pane
+func (t *TUI) openAlbum(index int) {
+	if index < 0 || index >= len(t.albumList) {
+		return
+	}
+	album := t.albumList[index]
+	t.album = &album
+	t.itemFilter, t.itemSort = "", ""
+	t.items.SetTitle(" " + tview.Escape(album.Title) + " ")
+	t.clearItems()
+	t.loadItems()
+}
+
+// clearItems empties the items pane down to its header and forgets the pages loaded
+func (t *TUI) clearItems() {
+	t.itemList = nil
+	t.itemPages = paneState{generation: t.itemPages.generation + 1}
+
+	t.items.Clear()
+	for col, header := range []string{"File name", "Type", "Created", "Size"} {
+		t.items.SetCell(0, col, tview.NewTableCell(header).SetAttributes(tcell.AttrBold).SetSelectable(false))
+	}
+}
+
+// loadItems appends the next page of the open album's media items
+func (t *TUI) loadItems() {
+	if t.album == nil || t.itemPages.loading || t.itemPages.done {
+		return
+	}
+	t.itemPages.loading = true
+	albumID, generation := t.album.ID, t.itemPages.generation
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize, PageToken: t.itemPages.next}
+
+	t.background(func() {
+		page, err := t.galleryUseCase.ListAlbumMediaItems(albumID, req)
+		t.update(func() {
+			if generation != t.itemPages.generation {
+				return // another album was opened meanwhile
+			}
+			t.itemPages.loading = false
+			if err != nil {
+				t.setError("Failed to load media items", err)
+				return
+			}
+			t.itemPages.next, t.itemPages.done = page.NextPageToken, !page.HasNext()
+			for _, item := range page.Items {
+				t.itemList = append(t.itemList, item)
+				t.addItemRow(len(t.itemList), item)
+			}
+			if len(t.itemList) > 0 && len(t.itemList) == len(page.Items) {
+				t.items.Select(1, 0)
+			}
+			t.setStatus(fmt.Sprintf("%d media items%s", len(t.itemList), moreText(t.itemPages)))
+		})
+	})
+}
+
+// addItemRow shows a media item in a row of the items pane
+func (t *TUI) addItemRow(row int, item domain.MediaItem) {
+	kind, created, size := "photo", "", ""
+	if item.IsVideo() {
+		kind = "video"
+	}
+	if m := item.MediaMetadata; m != nil {
+		if !m.CreationTime.IsZero() {
+			created = m.CreationTime.In(t.opts.TimeZone).Format("2006-01-02 15:04")
+		}
+		if m.Width > 0 && m.Height > 0 {
+			size = fmt.Sprintf("%dx%d", m.Width, m.Height)
+		}
+	}
+	for col, text := range []string{cmp.Or(item.Filename, item.ID), kind, created, size} {
+		cell := tview.NewTableCell(tview.Escape(text))
+		if col == 0 {
+			// The file name takes the width the other columns leave
+			cell.SetExpansion(1)
+		}
+		t.items.SetCell(row, col, cell)
+	}
+}
+
+// filter asks for text to filter the focused pane by, filtering it again on every keystroke:
+// albums by title and the media items of the open album by file name. Enter keeps the filter and
+// Escape clears it.
+func (t *TUI) filter() {
+	if t.opts.Index == nil {
+		t.setStatus("[red]Filtering needs the local index, run 'index build' first[-]")
+		return
+	}
+	apply, value, label := t.filterAlbums, t.albumFilter, "Filter albums"
+	if t.app.GetFocus() == t.items && t.album != nil {
+		apply, value, label = t.filterItems, t.itemFilter, "Filter media items"
+	}
+
+	input := tview.NewInputField().SetLabel("Filter: ").SetText(value)
+	input.SetBorder(true).SetTitle(" " + label + " ")
+	input.SetChangedFunc(apply)
+	input.SetDoneFunc(func(key tcell.Key) {
+		t.closeDialog()
+		if key == tcell.KeyEscape {
+			apply("")
+		}
+	})
+	t.showDialog(input, 60, 3)
+}
+
+// filterAlbums shows the indexed albums whose title contains text, or the pages of the API again
+// when text is empty
+func (t *TUI) filterAlbums(text string) {
+	if text == t.albumFilter {
+		return
+	}
+	t.albumFilter = text
+	t.albums.Clear()
+	t.albumList = nil
+	if text == "" {
+		t.albumPages = paneState{}
+		t.loadAlbums()
+		return
+	}
+
+	// Nothing is left to load, so moving through the matches does not ask the API for pages
+	t.albumPages = paneState{done: true}
+	t.albumList = t.opts.Index.Albums(text)
+	for _, album := range t.albumList {
+		main, secondary := albumText(album)
+		t.albums.AddItem(main, secondary, 0, nil)
+	}
+	t.setStatus(fmt.Sprintf("%d albums matching %q", len(t.albumList), tview.Escape(text)))
+}
+
+// filterItems shows the indexed media items of the open album whose file name contains text
+func (t *TUI) filterItems(text string) {
+	t.itemFilter = text
+	t.showIndexedItems()
+}
+
+// cycleSort sorts the media items of the open album from the index by the next order, going
+// back to the album order of the API after the last
+func (t *TUI) cycleSort() {
+	if t.opts.Index == nil || t.album == nil {
+		return
+	}
+	orders := []usecase.IndexSort{"", usecase.SortNewest, usecase.SortOldest, usecase.SortFilename}
+	t.itemSort = orders[(slices.Index(orders, t.itemSort)+1)%len(orders)]
+	t.showIndexedItems()
+}
+
+// showIndexedItems fills the items pane with the indexed media items of the open album matching
+// itemFilter in itemSort order, newest first unless sorted otherwise; without either it lists
+// the album from the API again
+func (t *TUI) showIndexedItems() {
+	t.clearItems()
+	if t.itemFilter == "" && t.itemSort == "" {
+		t.loadItems()
+		return
+	}
+
+	items, err := t.opts.Index.SearchMediaItems(usecase.IndexFilter{AlbumID: t.album.ID, Filename: t.itemFilter, Sort: t.itemSort})
+	if err != nil {
+		t.setError("Failed to filter media items", err)
+		return
+	}
+	t.itemPages.done = true
+	t.itemList = items
+	for i, item := range items {
+		t.addItemRow(i+1, item)
+	}
+	if len(items) > 0 {
+		t.items.Select(1, 0)
+	}
+	t.setStatus(fmt.Sprintf("%d media items, sorted by %s", len(items), cmp.Or(string(t.itemSort), string(usecase.SortNewest))))
+}
+
+// createAlbum creates an album and opens it at the top of the albums pane
+func (t *TUI) createAlbum(title string) {
+	t.setStatus("Creating album...")
+	t.background(func() {
+		album, err := t.albumUseCase.CreateAlbum(t.ctx, title)
+		t.update(func() {
+			if err != nil {
+				t.setError("Failed to create album", err)
+				return
+			}
+			t.albumList = append([]domain.Album{*album}, t.albumList...)
+			main, secondary := albumText(*album)
+			t.albums.InsertItem(0, main, secondary, 0, nil)
+			t.albums.SetCurrentItem(0)
+			t.openAlbum(0)
+			t.setStatus("Created album " + tview.Escape(album.Title))
+		})
+	})
+}
+
+// renameAlbum changes the title of an app-created album
+func (t *TUI) renameAlbum(albumID, title string) {
+	t.setStatus("Renaming album...")
+	t.background(func() {
+		album, err := t.albumUseCase.UpdateAlbum(t.ctx, albumID, title, "")
+		t.update(func() {
+			if err != nil {
+				t.setError("Failed to rename album", err)
+				return
+			}
+			for i := range t.albumList {
+				if t.albumList[i].ID == albumID {
+					t.albumList[i].Title = album.Title
+					main, secondary := albumText(t.albumList[i])
+					t.albums.SetItemText(i, main, secondary)
+				}
+			}
+			if t.album != nil && t.album.ID == albumID {
+				t.album.Title = album.Title
+				t.items.SetTitle(" " + tview.Escape(album.Title) + " ")
+			}
+			t.setStatus("Renamed album to " + tview.Escape(album.Title))
+		})
+	})
+}
+
+// download saves the selected media item, or every media item of the selected album when the
+// albums pane has the focus, to the download directory
+func (t *TUI) download() {
+	opts := usecase.DownloadOptions{Dir: t.opts.DownloadDir}
+	var run func() ([]usecase.DownloadResult, error)
+	if t.app.GetFocus() == t.items {
+		item, ok := t.selectedItem()
+		if !ok {
+			return
+		}
+		run = func() ([]usecase.DownloadResult, error) { return t.downloadUseCase.DownloadItem(t.ctx, item.ID, opts) }
+	} else {
+		album, ok := t.selectedAlbum()
+		if !ok {
+			return
+		}
+		run = func() ([]usecase.DownloadResult, error) {
+			return t.downloadUseCase.DownloadAlbum(t.ctx, album.ID, opts)
+		}
+	}
+
+	t.setStatus("Downloading...")
+	t.background(func() {
+		results, err := run()
+		t.update(func() {
+			if err != nil {
+				t.setError("Failed to download", err)
+				return
+			}
+			failed := 0
+			for _, result := range results {
+				if result.Error != "" {
+					failed++
+				}
+			}
+			message := fmt.Sprintf("Downloaded %d of %d files to %s", len(results)-failed, len(results), tview.Escape(opts.Dir))
+			if failed > 0 {
+				message = "[red]" + message + "[-]"
+			}
+			t.setStatus(message)
+		})
+	})
+}
+
+// addToAlbum adds a media item to an app-created album
+func (t *TUI) addToAlbum(item domain.MediaItem, album domain.Album) {
+	t.setStatus("Adding to album...")
+	t.background(func() {
+		err := t.albumUseCase.AddMediaItems(t.ctx, album.ID, []string{item.ID})
+		t.update(func() {
+			if err != nil {
+				t.setError("Failed to add to album", err)
+				return
+			}
+			t.setStatus(fmt.Sprintf("Added %s to %s", tview.Escape(cmp.Or(item.Filename, item.ID)), tview.Escape(album.Title)))
+		})
+	})
+}
+
+// selectedAlbum returns the album selected in the albums pane
+func (t *TUI) selectedAlbum() (domain.Album, bool) {
+	index := t.albums.GetCurrentItem()
+	if index < 0 || index >= len(t.albumList) {
+		return domain.Album{}, false
+	}
+	return t.albumList[index], true
+}
+
+// selectedItem returns the media item selected in the items pane
+func (t *TUI) selectedItem() (domain.MediaItem, bool) {
+	row, _ := t.items.GetSelection()
+	if row < 1 || row > len(t.itemList) {
+		return domain.MediaItem{}, false
+	}
+	return t.itemList[row-1], true
+}
+
+// prompt asks for a title in a dialog and passes it to done; Escape or an empty title cancels
+func (t *TUI) prompt(title, value string, done func(string)) {
+	input := tview.NewInputField().SetLabel("Title: ").SetText(value)
+	input.SetBorder(true).SetTitle(" " + title + " ")
+	input.SetDoneFunc(func(key tcell.Key) {
+		text := strings.TrimSpace(input.GetText())
+		t.closeDialog()
+		if key == tcell.KeyEnter && text != "" {
+			done(text)
+		}
+	})
+	t.showDialog(input, 60, 3)
+}
+
+// pickAlbum lets the user choose one of the loaded albums in a dialog and passes it to done
+func (t *TUI) pickAlbum(done func(domain.Album)) {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" Add to album ")
+	for _, album := range t.albumList {
+		list.AddItem(tview.Escape(album.Title), "", 0, nil)
+	}
+	list.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		t.closeDialog()
+		done(t.albumList[index])
+	})
+	list.SetDoneFunc(t.closeDialog)
+	t.showDialog(list, 60, 20)
+}
+
+// showDialog shows p centered above the panes
+func (t *TUI) showDialog(p tview.Primitive, width, height int) {
+	t.focus = t.app.GetFocus()
+	dialog := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+	t.pages.AddPage(tuiDialogPage, dialog, true, true)
+	t.app.SetFocus(p)
+}
+
+// closeDialog hides the dialog and gives the focus back to the pane that had it
+func (t *TUI) closeDialog() {
+	t.pages.RemovePage(tuiDialogPage)
+	if t.focus != nil {
+		t.app.SetFocus(t.focus)
+	}
+}
+
+// setStatus shows a message in the status line; it may contain color tags
+func (t *TUI) setStatus(message string) {
+	t.status.SetText(message)
+}
+
+// setError shows a failure in the status line
+func (t *TUI) setError(action string, err error) {
+	t.setStatus(fmt.Sprintf("[red]%s: %s[-]", action, tview.Escape(err.Error())))
+}
+
+// albumText returns the lines an album is listed with
+func albumText(album domain.Album) (string, string) {
+	return tview.Escape(cmp.Or(album.Title, "(untitled)")), fmt.Sprintf("%d items", album.MediaItemsCount)
+}
+
+// moreText tells whether a pane has more pages than it shows
+func moreText(state paneState) string {
+	if state.done {
+		return ""
+	}
+	return ", scroll down for more"
+}
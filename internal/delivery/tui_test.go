@@ -0,0 +1,186 @@
+package delivery
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+	"krupesh.faldu/pkg/gphotos/gphotostest"
+)
+
+// newTestTUI browses two albums, where a1 holds pages of photo1 and photo2, without a terminal
+func newTestTUI(t *testing.T) (*TUI, *gphotostest.Library) {
+	lib := newTestLibrary()
+	mediaRepo := &stubMediaItemRepository{}
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	albumUseCase := usecase.NewAlbumUseCase(lib.Albums())
+	albumUseCase.SetLogger(quiet)
+	galleryUseCase := usecase.NewGalleryUseCase(mediaRepo, &stubThumbnailCache{thumbs: make(map[string][]byte)})
+	galleryUseCase.SetLogger(quiet)
+	downloadUseCase := usecase.NewDownloadUseCase(mediaRepo)
+	downloadUseCase.SetLogger(quiet)
+
+	tui := NewTUI(albumUseCase, galleryUseCase, downloadUseCase, TUIOptions{DownloadDir: t.TempDir()})
+	// API calls and their results run right away instead of on the application loop
+	tui.background = func(fn func()) { fn() }
+	tui.update = func(fn func()) { fn() }
+	tui.loadAlbums()
+	return tui, lib
+}
+
+// press sends a key to the TUI the way the application loop does: first to the key bindings,
+// then to the focused widget
+func press(tui *TUI, key tcell.Key, r rune) {
+	event := tcell.NewEventKey(key, r, tcell.ModNone)
+	if event = tui.handleKey(event); event == nil {
+		return
+	}
+	focused := tui.app.GetFocus()
+	focused.InputHandler()(event, func(p tview.Primitive) { tui.app.SetFocus(p) })
+}
+
+// typeText replaces the text of the dialog's input field and submits it
+func typeText(t *testing.T, tui *TUI, text string) {
+	t.Helper()
+	input, ok := tui.app.GetFocus().(*tview.InputField)
+	if !ok {
+		t.Fatalf("Expected an input dialog, got %T", tui.app.GetFocus())
+	}
+	input.SetText(text)
+	press(tui, tcell.KeyEnter, 0)
+}
+
+func TestTUI_IncrementalLoading(t *testing.T) {
+	tui, _ := newTestTUI(t)
+
+	if tui.albums.GetItemCount() != 2 {
+		t.Fatalf("Expected 2 albums, got %d", tui.albums.GetItemCount())
+	}
+
+	// The first row is selected, which is close enough to the end of the short page to load the next
+	tui.openAlbum(0)
+	if len(tui.itemList) != 4 || tui.items.GetRowCount() != 5 || tui.items.GetCell(4, 0).Text != "photo2" {
+		t.Errorf("Expected two pages of a1 below a header, got %d items in %d rows", len(tui.itemList), tui.items.GetRowCount())
+	}
+	// Moving to the last row loads another page
+	tui.items.Select(4, 0)
+	if len(tui.itemList) != 6 {
+		t.Errorf("Expected the third page appended, got %d items", len(tui.itemList))
+	}
+
+	tui.openAlbum(1)
+	if len(tui.itemList) != 0 || tui.items.GetRowCount() != 1 || !tui.itemPages.done {
+		t.Errorf("Expected the empty album a2, got %d items", len(tui.itemList))
+	}
+}
+
+func TestTUI_CreateAndRenameAlbum(t *testing.T) {
+	tui, _ := newTestTUI(t)
+
+	press(tui, tcell.KeyRune, 'n')
+	typeText(t, tui, "New")
+
+	if main, _ := tui.albums.GetItemText(0); main != "New" || tui.album == nil || tui.album.Title != "New" {
+		t.Errorf("Expected the new album opened at the top, got %q", main)
+	}
+	if front, _ := tui.pages.GetFrontPage(); front != tuiMainPage {
+		t.Errorf("Expected the dialog to close, got %s", front)
+	}
+
+	tui.albums.SetCurrentItem(1)
+	press(tui, tcell.KeyRune, 'r')
+	typeText(t, tui, "Road trip")
+
+	if main, _ := tui.albums.GetItemText(1); main != "Road trip" || tui.albumList[1].Title != "Road trip" {
+		t.Errorf("Expected a1 to be renamed, got %q", main)
+	}
+}
+
+func TestTUI_DownloadAndAddToAlbum(t *testing.T) {
+	tui, lib := newTestTUI(t)
+	tui.openAlbum(0)
+	tui.app.SetFocus(tui.items)
+	tui.items.Select(1, 0)
+
+	press(tui, tcell.KeyRune, 'd')
+
+	if _, err := os.Stat(filepath.Join(tui.opts.DownloadDir, "photo1")); err != nil {
+		t.Errorf("Expected photo1 to be downloaded, got %v", err)
+	}
+	if text := tui.status.GetText(true); !strings.Contains(text, "Downloaded 1 of 1 files") {
+		t.Errorf("Expected the download in the status line, got %q", text)
+	}
+
+	// The album picker lists the loaded albums; Enter picks the second
+	press(tui, tcell.KeyRune, 'a')
+	press(tui, tcell.KeyDown, 0)
+	press(tui, tcell.KeyEnter, 0)
+
+	if ids := lib.AlbumItems("a2"); !slices.Equal(ids, []string{"photo1"}) {
+		t.Errorf("Expected photo1 added to a2, got %v", ids)
+	}
+	if tui.app.GetFocus() != tui.items {
+		t.Errorf("Expected the focus back on the media items, got %T", tui.app.GetFocus())
+	}
+}
+
+func TestTUI_FilterAndSort(t *testing.T) {
+	tui, _ := newTestTUI(t)
+
+	press(tui, tcell.KeyRune, '/')
+	if text := tui.status.GetText(true); !strings.Contains(text, "index build") {
+		t.Errorf("Expected filtering to need the index, got %q", text)
+	}
+
+	taken := func(id string, day int) domain.MediaItem {
+		return domain.MediaItem{ID: id, Filename: id + ".jpg", MediaMetadata: &domain.MediaMetadata{CreationTime: time.Date(2026, 5, day, 0, 0, 0, 0, time.UTC)}}
+	}
+	tui.opts.Index = usecase.NewSessionIndex(&domain.IndexSnapshot{
+		Albums:     []domain.Album{{ID: "a1", Title: "Trip"}, {ID: "a2", Title: "Home"}, {ID: "a3", Title: "Trip best"}},
+		MediaItems: []domain.MediaItem{taken("beach", 1), taken("city", 3), taken("boat", 2)},
+		AlbumItems: map[string][]string{"a1": {"beach", "city", "boat"}},
+		UpdatedAt:  time.Now(),
+	})
+
+	// Every keystroke filters the albums, including those the API has not listed yet
+	press(tui, tcell.KeyRune, '/')
+	press(tui, tcell.KeyRune, 't')
+	press(tui, tcell.KeyRune, 'r')
+	if len(tui.albumList) != 2 || tui.albumList[1].Title != "Trip best" {
+		t.Fatalf("Expected the albums titled trip, got %+v", tui.albumList)
+	}
+	press(tui, tcell.KeyEnter, 0)
+
+	tui.openAlbum(0)
+	tui.app.SetFocus(tui.items)
+	press(tui, tcell.KeyRune, '/')
+	typeText(t, tui, "b")
+	if len(tui.itemList) != 2 || tui.items.GetCell(1, 0).Text != "boat.jpg" {
+		t.Errorf("Expected boat and beach, newest first, got %+v", tui.itemList)
+	}
+	press(tui, tcell.KeyRune, 's')
+	press(tui, tcell.KeyRune, 's')
+	press(tui, tcell.KeyRune, 's')
+	if tui.itemSort != usecase.SortFilename || tui.items.GetCell(1, 0).Text != "beach.jpg" {
+		t.Errorf("Expected the matches sorted by file name, got %s %+v", tui.itemSort, tui.itemList)
+	}
+
+	// Escape clears the filter of the albums and lists them from the API again
+	tui.app.SetFocus(tui.albums)
+	press(tui, tcell.KeyRune, '/')
+	press(tui, tcell.KeyEscape, 0)
+	if tui.albumFilter != "" || len(tui.albumList) != 2 || tui.albumList[1].Title != "Home" {
+		t.Errorf("Expected the albums of the API, got %+v", tui.albumList)
+	}
+}
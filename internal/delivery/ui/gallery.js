@@ -0,0 +1,236 @@
+// The web gallery of the serve command. It browses albums and their thumbnails, creates albums
+// and uploads files through the JSON API, sending the token kept in session storage.
+'use strict';
+
+const tokenKey = 'gpm-token';
+const thumbnailSize = 256;
+
+let token = sessionStorage.getItem(tokenKey) || '';
+let album = null;
+let albumsPageToken = '';
+let itemsPageToken = '';
+// objectURLs of the thumbnails shown, released when the grid is cleared
+let thumbnailURLs = [];
+
+const $ = (id) => document.getElementById(id);
+
+// api calls the JSON API and throws the error message of failed requests
+async function api(path, options = {}) {
+  const response = await fetch(path, {
+    ...options,
+    headers: { ...options.headers, Authorization: `Bearer ${token}` },
+  });
+  if (response.status === 401) {
+    logout('The token was not accepted.');
+    throw new Error('The token was not accepted.');
+  }
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    throw new Error(body.error || response.statusText);
+  }
+  return response;
+}
+
+function setStatus(message) {
+  $('status').textContent = message;
+}
+
+function login(event) {
+  event.preventDefault();
+  token = $('token').value.trim();
+  sessionStorage.setItem(tokenKey, token);
+  start();
+}
+
+function logout(message = '') {
+  token = '';
+  sessionStorage.removeItem(tokenKey);
+  $('app').hidden = true;
+  $('login').hidden = false;
+  $('login-error').textContent = message;
+}
+
+async function start() {
+  $('login').hidden = true;
+  $('app').hidden = false;
+  $('albums').replaceChildren();
+  albumsPageToken = '';
+  await loadAlbums();
+}
+
+async function loadAlbums() {
+  try {
+    const query = albumsPageToken ? `?pageToken=${encodeURIComponent(albumsPageToken)}` : '';
+    const page = await (await api(`/albums${query}`)).json();
+    page.albums.forEach(addAlbum);
+    albumsPageToken = page.nextPageToken || '';
+    $('more-albums').hidden = !albumsPageToken;
+  } catch (err) {
+    setStatus(`Failed to load albums: ${err.message}`);
+  }
+}
+
+function addAlbum(a, prepend = false) {
+  const button = document.createElement('button');
+  button.type = 'button';
+  button.dataset.id = a.id;
+  button.textContent = a.title || '(untitled)';
+  const count = document.createElement('small');
+  count.textContent = `${a.mediaItemsCount || 0} items`;
+  button.append(count);
+  button.addEventListener('click', () => openAlbum(a));
+
+  const li = document.createElement('li');
+  li.append(button);
+  if (prepend) {
+    $('albums').prepend(li);
+  } else {
+    $('albums').append(li);
+  }
+}
+
+async function openAlbum(a) {
+  album = a;
+  for (const button of $('albums').querySelectorAll('button')) {
+    button.setAttribute('aria-current', button.dataset.id === a.id);
+  }
+  $('album-heading').textContent = a.title || '(untitled)';
+  clearGrid();
+  itemsPageToken = '';
+  await loadItems();
+}
+
+async function loadItems() {
+  if (!album) {
+    return;
+  }
+  const current = album;
+  try {
+    const query = itemsPageToken ? `?pageToken=${encodeURIComponent(itemsPageToken)}` : '';
+    const page = await (await api(`/albums/${encodeURIComponent(current.id)}/media${query}`)).json();
+    if (album !== current) {
+      return; // another album was opened meanwhile
+    }
+    page.mediaItems.forEach(addItem);
+    itemsPageToken = page.nextPageToken || '';
+    $('more-items').hidden = !itemsPageToken;
+    setStatus($('grid').childElementCount === 0 ? 'This album is empty.' : '');
+  } catch (err) {
+    setStatus(`Failed to load photos: ${err.message}`);
+  }
+}
+
+// Thumbnails need the token, so they are fetched once scrolled into view and shown as blobs
+const thumbnails = new IntersectionObserver((entries) => {
+  for (const entry of entries) {
+    if (entry.isIntersecting) {
+      thumbnails.unobserve(entry.target);
+      loadThumbnail(entry.target);
+    }
+  }
+}, { rootMargin: '200px' });
+
+async function loadThumbnail(img) {
+  try {
+    const response = await api(`/media/${encodeURIComponent(img.dataset.id)}/thumbnail?size=${thumbnailSize}`);
+    const url = URL.createObjectURL(await response.blob());
+    thumbnailURLs.push(url);
+    img.src = url;
+  } catch (err) {
+    img.alt = `${img.alt} (no thumbnail)`;
+  }
+}
+
+function addItem(item) {
+  const img = document.createElement('img');
+  img.dataset.id = item.id;
+  img.alt = item.filename || item.id;
+  img.title = item.filename || '';
+
+  const link = document.createElement('a');
+  link.href = item.productUrl || '#';
+  link.target = '_blank';
+  link.rel = 'noopener';
+  if ((item.mimeType || '').startsWith('video/')) {
+    link.classList.add('video');
+  }
+  link.append(img);
+  $('grid').append(link);
+  thumbnails.observe(img);
+}
+
+function clearGrid() {
+  thumbnails.disconnect();
+  thumbnailURLs.forEach(URL.revokeObjectURL);
+  thumbnailURLs = [];
+  $('grid').replaceChildren();
+  $('more-items').hidden = true;
+}
+
+async function createAlbum(event) {
+  event.preventDefault();
+  const input = $('new-album-title');
+  try {
+    const created = await (await api('/albums', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ title: input.value }),
+    })).json();
+    input.value = '';
+    addAlbum(created, true);
+    await openAlbum(created);
+  } catch (err) {
+    setStatus(`Failed to create album: ${err.message}`);
+  }
+}
+
+async function upload(event) {
+  event.preventDefault();
+  const files = $('files').files;
+  const form = new FormData();
+  if (album) {
+    form.append('albumId', album.id);
+  }
+  for (const file of files) {
+    form.append('file', file);
+  }
+
+  const button = $('upload').querySelector('button');
+  button.disabled = true;
+  setStatus(`Uploading ${files.length} files…`);
+  try {
+    const summary = await (await api('/upload', { method: 'POST', body: form })).json();
+    const failed = summary.results.filter((result) => result.error);
+    const messages = [`Uploaded ${summary.results.length - failed.length} of ${files.length} files.`];
+    if (summary.skipped.length > 0) {
+      messages.push(`Skipped ${summary.skipped.join(', ')}: not a photo or video.`);
+    }
+    for (const result of failed) {
+      messages.push(`${result.path}: ${result.error}`);
+    }
+    $('upload').reset();
+    if (album) {
+      clearGrid();
+      itemsPageToken = '';
+      await loadItems();
+    }
+    setStatus(messages.join(' '));
+  } catch (err) {
+    setStatus(`Upload failed: ${err.message}`);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+$('login').addEventListener('submit', login);
+$('logout').addEventListener('click', () => logout());
+$('create-album').addEventListener('submit', createAlbum);
+$('upload').addEventListener('submit', upload);
+$('more-albums').addEventListener('click', loadAlbums);
+$('more-items').addEventListener('click', loadItems);
+
+if (token) {
+  start();
+} else {
+  logout();
+}
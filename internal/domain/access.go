@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Google Photos scopes, each granting one kind of access to the library
+const (
+	ScopeReadAppCreated = "https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata"
+	ScopeAppendOnly     = "https://www.googleapis.com/auth/photoslibrary.appendonly"
+	ScopeEditAppCreated = "https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata"
+	ScopeSharing        = "https://www.googleapis.com/auth/photoslibrary.sharing"
+)
+
+// Access is a kind of operation on the library; logging in with only the accesses in use keeps
+// the token from granting more than is needed
+type Access string
+
+const (
+	// AccessRead lists, searches, indexes and downloads app-created albums and media items
+	AccessRead Access = "read"
+	// AccessUpload uploads media items and creates albums
+	AccessUpload Access = "upload"
+	// AccessEdit renames albums, sets their covers and adds and removes their media items
+	AccessEdit Access = "edit"
+	// AccessShare shares albums and joins and leaves the albums of others
+	AccessShare Access = "share"
+)
+
+// Accesses lists every kind of access, from the narrowest
+var Accesses = []Access{AccessRead, AccessUpload, AccessEdit, AccessShare}
+
+// accessScopes maps each kind of access to the scope granting it
+var accessScopes = map[Access]string{
+	AccessRead:   ScopeReadAppCreated,
+	AccessUpload: ScopeAppendOnly,
+	AccessEdit:   ScopeEditAppCreated,
+	AccessShare:  ScopeSharing,
+}
+
+// ParseAccess validates a kind of access given by name
+func ParseAccess(name string) (Access, error) {
+	access := Access(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := accessScopes[access]; !ok {
+		return "", fmt.Errorf("invalid access %q: expected read, upload, edit or share", name)
+	}
+	return access, nil
+}
+
+// ParseAccesses validates a list of kinds of access separated by commas or spaces
+func ParseAccesses(list string) ([]Access, error) {
+	var accesses []Access
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		access, err := ParseAccess(name)
+		if err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, nil
+}
+
+// Scope returns the scope granting the access
+func (a Access) Scope() string {
+	return accessScopes[a]
+}
+
+// ScopesFor returns the scopes to request for accesses: the scope of each, plus the userinfo
+// scopes, which only identify the account
+func ScopesFor(accesses []Access) []string {
+	var scopes []string
+	for _, access := range Accesses {
+		if slices.Contains(accesses, access) {
+			scopes = append(scopes, access.Scope())
+		}
+	}
+	return append(scopes, ScopeUserInfoEmail, ScopeUserInfoProfile)
+}
+
+// AccessesOf returns the kinds of access that scopes grant
+func AccessesOf(scopes []string) []Access {
+	var accesses []Access
+	for _, access := range Accesses {
+		if slices.Contains(scopes, access.Scope()) {
+			accesses = append(accesses, access)
+		}
+	}
+	return accesses
+}
+
+// JoinAccesses formats accesses as a list separated by commas, the way ParseAccesses reads it
+func JoinAccesses(accesses []Access) string {
+	names := make([]string, len(accesses))
+	for i, access := range accesses {
+		names[i] = string(access)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// Scopes that let a token identify the Google account it belongs to
+const (
+	ScopeUserInfoEmail   = "https://www.googleapis.com/auth/userinfo.email"
+	ScopeUserInfoProfile = "https://www.googleapis.com/auth/userinfo.profile"
+)
+
+// AccountInfo identifies the Google account behind a profile's token and what the token grants
+type AccountInfo struct {
+	Profile       string    `json:"profile"`
+	UserID        string    `json:"userId,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"emailVerified"`
+	Name          string    `json:"name,omitempty"`
+	Scopes        []string  `json:"scopes"`
+	Expiry        time.Time `json:"expiry"`
+	// Refreshable is set when a refresh token is stored, so access survives the expiry above
+	Refreshable bool `json:"refreshable"`
+}
+
+// TokenInfo describes an access token as reported by Google's tokeninfo endpoint.
+// UserID and Email are only present when the token carries the userinfo scopes.
+type TokenInfo struct {
+	UserID        string
+	Email         string
+	EmailVerified bool
+	Scopes        []string
+	Expiry        time.Time
+}
+
+// UserInfo is the OpenID Connect profile of the account behind an access token
+type UserInfo struct {
+	UserID        string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// AccountRepository defines the interface for looking up the account behind an access token
+type AccountRepository interface {
+	GetTokenInfo(accessToken string) (*TokenInfo, error)
+	GetUserInfo(accessToken string) (*UserInfo, error)
+}
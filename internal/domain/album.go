@@ -1,29 +1,80 @@
 package domain
 
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
 // Album represents a Google Photos album
 type Album struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
+	ID                    string     `json:"id"`
+	Title                 string     `json:"title"`
+	ProductURL            string     `json:"productUrl,omitempty"`
+	IsWriteable           bool       `json:"isWriteable,omitempty"`
+	ShareInfo             *ShareInfo `json:"shareInfo,omitempty"`
+	MediaItemsCount       int64      `json:"mediaItemsCount,string,omitempty"`
+	CoverPhotoBaseURL     string     `json:"coverPhotoBaseUrl,omitempty"`
+	CoverPhotoMediaItemID string     `json:"coverPhotoMediaItemId,omitempty"`
 }
 
-// AlbumsResponse represents the API response for listing albums
-type AlbumsResponse struct {
-	Albums        []Album `json:"albums"`
-	NextPageToken string  `json:"nextPageToken"`
+// TitleMatch is how an AlbumFilter compares album titles with its pattern
+type TitleMatch string
+
+// Ways of matching album titles
+const (
+	TitleExact     TitleMatch = "exact"
+	TitleSubstring TitleMatch = "substring"
+	TitleRegex     TitleMatch = "regex"
+)
+
+// AlbumFilter selects albums by their title and kind
+type AlbumFilter struct {
+	// Match is how the pattern is compared with titles; empty treats it as a regular expression,
+	// which matches anywhere in the title unless anchored with ^ and $
+	Match TitleMatch
+	// IgnoreCase compares titles regardless of case
+	IgnoreCase bool
+	// ExcludeShared leaves out shared albums
+	ExcludeShared bool
+	// AppCreatedOnly keeps only albums this app created and may change
+	AppCreatedOnly bool
 }
 
+// MaxBatchMediaItems is the largest number of media items a single batch request may carry
+const MaxBatchMediaItems = 50
+
+// ErrAlbumReadOnly is returned for changes to an album the config marks read-only
+var ErrAlbumReadOnly = errors.New("album is read-only")
+
 // AlbumRepository defines the interface for album operations
 type AlbumRepository interface {
-	ListAlbums() (*AlbumsResponse, error)
+	ListAlbums(req PageRequest) (*Page[Album], error)
 	GetAlbumByID(id string) (*Album, error)
+	// GetAlbumFields gets only the fields of an album a partial response selects, such as
+	// "id,mediaItemsCount", leaving the others zero; the ID is always fetched and empty fields
+	// get the whole album
+	GetAlbumFields(id, fields string) (*Album, error)
 	CreateAlbum(title string) (*Album, error)
-	FetchNextPage(nextPageToken string) (*AlbumsResponse, error)
+	UpdateAlbum(id, title, coverPhotoMediaItemID string) (*Album, error)
+	BatchAddMediaItems(albumID string, mediaItemIDs []string) error
+	BatchRemoveMediaItems(albumID string, mediaItemIDs []string) error
+	// AddTextEnrichment adds a text entry to an app-created album at position and returns the ID of
+	// the new enrichment item; positions relative to another item are not supported
+	AddTextEnrichment(albumID, text string, position PositionType) (string, error)
 }
 
 // AlbumUseCase defines the business logic for album operations
 type AlbumUseCase interface {
-	ListAlbums() (*AlbumsResponse, error)
+	ListAlbums(req PageRequest) (*Page[Album], error)
 	GetAlbumByID(id string) (*Album, error)
+	GetAlbumFields(id, fields string) (*Album, error)
 	CreateAlbum(title string) (*Album, error)
-	FetchNextPage(nextPageToken string) (*AlbumsResponse, error)
+	CreateAlbumIfNotExists(ctx context.Context, title string, appCreatedOnly bool) (*Album, bool, error)
+	UpdateAlbum(id, title, coverPhotoMediaItemID string) (*Album, error)
+	AddMediaItems(albumID string, mediaItemIDs []string) error
+	RemoveMediaItems(albumID string, mediaItemIDs []string) error
+	ListAllAlbums(ctx context.Context, opts ListOptions) ([]Album, error)
+	Albums(ctx context.Context, opts ListOptions) iter.Seq2[Album, error]
+	FindAlbums(ctx context.Context, pattern string, filter AlbumFilter) ([]Album, error)
 }
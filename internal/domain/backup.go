@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// BackupTarget stores copies of media items outside Google Photos, such as on a local disk or in
+// an S3 or GCS bucket. Keys are slash-separated paths below the root of the target.
+type BackupTarget interface {
+	// Put stores the bytes read from r under key, replacing what is there. size is their length,
+	// or -1 when it is only known once r ends, as for an original streamed from Google Photos.
+	// checksum is their hex SHA-256 when known ahead, which targets able to check what they
+	// received verify; empty leaves the check to the target.
+	Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error
+	// Get opens what is stored under key; it fails with ErrNotFound when there is nothing
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// String names the target, such as s3://bucket/prefix
+	String() string
+}
+
+// BackupManifest lists what a backup target holds. It is kept as manifest.json at the root of
+// the target, so a backup can be resumed and the copies found without Google Photos.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Items holds the copy of every backed up media item by media item ID
+	Items map[string]BackupEntry `json:"items"`
+}
+
+// BackupEntry is the copy of one media item in a backup target
+type BackupEntry struct {
+	Key          string    `json:"key"`
+	Filename     string    `json:"filename"`
+	MimeType     string    `json:"mimeType,omitempty"`
+	CreationTime time.Time `json:"creationTime,omitzero"`
+	Size         int64     `json:"size"`
+	// SHA256 is the hex checksum of the original, taken while it was downloaded
+	SHA256     string    `json:"sha256"`
+	BackedUpAt time.Time `json:"backedUpAt"`
+}
+
+// BackupSchemes are the schemes of backup targets in buckets, which storage providers charge for
+var BackupSchemes = []string{"s3", "gs"}
+
+// BackupPricing is what a storage provider charges in dollars, such as the list prices of an S3
+// storage class; S3-compatible providers such as Backblaze B2 go under s3
+type BackupPricing struct {
+	// StoragePerGBMonth is charged for every GiB kept for a month
+	StoragePerGBMonth float64
+	// EgressPerGB is charged for every GiB downloaded from the bucket, as a restore does
+	EgressPerGB float64
+	// PutPer1000 is charged for every 1000 uploads
+	PutPer1000 float64
+}
+
+// Validate reports negative prices
+func (p BackupPricing) Validate() error {
+	if p.StoragePerGBMonth < 0 || p.EgressPerGB < 0 || p.PutPer1000 < 0 {
+		return errors.New("prices must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultScopes are requested at login: Google Photos access to app-created data and sharing,
+// plus the userinfo scopes that identify the account
+var DefaultScopes = ScopesFor(Accesses)
+
+// Config holds the settings read at startup from the config file and GPM_* environment
+// variables; command-line flags take precedence over both
+type Config struct {
+	// File is the config file the settings were read from; empty when there was none
+	File string
+	// Dir holds the default profile, named profiles and their caches
+	Dir string
+	// CredentialsPath is the OAuth client secrets file; empty uses credentials.json in Dir
+	CredentialsPath string
+	// TokenPath is where the default profile's token is stored; empty uses token.json in Dir
+	TokenPath string
+	// Scopes are requested at login
+	Scopes []string
+	// Access lists the kinds of operation the library is used for; when set, Scopes holds only
+	// the scopes they need
+	Access []Access
+	// CallbackAddr is where the local OAuth callback server listens
+	CallbackAddr string
+	// AuthTimeout bounds how long login waits for the browser to return
+	AuthTimeout time.Duration
+	// PageSize is used by list commands when --page-size is not given; 0 lets the API decide
+	PageSize int
+	// HTTPTimeout bounds every Google Photos API request including its body; 0 means no limit
+	HTTPTimeout time.Duration
+	// DialTimeout bounds connecting to the API; 0 keeps the 30s of the Go HTTP client
+	DialTimeout time.Duration
+	// TLSTimeout bounds the TLS handshake with the API; 0 keeps the 10s of the Go HTTP client
+	TLSTimeout time.Duration
+	// Proxy is the URL of the proxy API requests go through; empty leaves it to HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY
+	Proxy string
+	// MaxRPS bounds the Google Photos API requests a second, counted over every client together so
+	// bulk jobs stay within the quotas; 0 means no limit
+	MaxRPS float64
+	// Burst is how many requests may go at once after a pause before MaxRPS paces them
+	Burst int
+	// Workers is the default number of concurrent uploads and downloads
+	Workers int
+	// TimeZone is where creation times, which the API reports in UTC, are shown and fall on days
+	// and months when matching dates
+	TimeZone *time.Location
+	// FilenameDates find when photos without an EXIF date were taken in their file names
+	FilenameDates []FilenameDateRule
+	// Output is the result format of commands run without --output: "table", "json" or "csv";
+	// empty means table
+	Output string
+	// SyncDir is where sync run mirrors originals when --dir is not given; empty mirrors none
+	SyncDir string
+	// ServeTheme is the theme directory of the web gallery of serve when --theme is not given;
+	// empty keeps the built-in look
+	ServeTheme string
+	// ServeToken is the bearer token clients of serve must send when --token is not given; empty
+	// makes serve log a random one
+	ServeToken string
+	// ReadOnlyAlbums are the IDs of albums no command may rename, change the cover of or add
+	// media items to or remove them from, whatever its flags
+	ReadOnlyAlbums []string
+	// MetricsPushURL is the Prometheus Pushgateway that API commands push their metrics to as they
+	// exit; empty pushes none
+	MetricsPushURL string
+	// MetricsJob is the job the metrics are pushed under
+	MetricsJob string
+	// Shortener is the self-hosted URL shortener the links of share commands go through: "shlink"
+	// or "kutt"; empty keeps the long links
+	Shortener string
+	// ShortenerURL is the base URL of the Shortener server
+	ShortenerURL string
+	// ShortenerAPIKey authenticates to the Shortener server
+	ShortenerAPIKey string
+	// DaemonJobs are the commands daemon run starts on their schedules
+	DaemonJobs []DaemonJob
+	// BackupPricing is what the storage providers of backup targets charge, by target scheme such
+	// as s3; plan quota estimates the costs of a backup from it
+	BackupPricing map[string]BackupPricing
+}
+
+// DefaultConfig returns the settings used when neither a config file nor environment sets them
+func DefaultConfig() Config {
+	return Config{
+		Dir:           ".",
+		Scopes:        DefaultScopes,
+		CallbackAddr:  "localhost:8080",
+		AuthTimeout:   10 * time.Minute,
+		MaxRPS:        10,
+		Burst:         10,
+		Workers:       4,
+		TimeZone:      time.Local,
+		FilenameDates: DefaultFilenameDateRules(),
+		MetricsJob:    "gpm",
+	}
+}
+
+// Validate reports settings that cannot work
+func (c Config) Validate() error {
+	switch {
+	case c.Dir == "":
+		return fmt.Errorf("%w: dir must not be empty", ErrInvalidConfig)
+	case len(c.Scopes) == 0:
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidConfig)
+	case c.CallbackAddr == "":
+		return fmt.Errorf("%w: auth callback address must not be empty", ErrInvalidConfig)
+	case c.AuthTimeout <= 0:
+		return fmt.Errorf("%w: auth timeout must be positive, got %s", ErrInvalidConfig, c.AuthTimeout)
+	case c.PageSize < 0 || c.PageSize > MaxMediaItemPageSize:
+		return fmt.Errorf("%w: page size must be between 0 and %d, got %d", ErrInvalidConfig, MaxMediaItemPageSize, c.PageSize)
+	case c.HTTPTimeout < 0:
+		return fmt.Errorf("%w: API timeout must not be negative, got %s", ErrInvalidConfig, c.HTTPTimeout)
+	case c.DialTimeout < 0:
+		return fmt.Errorf("%w: API dial timeout must not be negative, got %s", ErrInvalidConfig, c.DialTimeout)
+	case c.TLSTimeout < 0:
+		return fmt.Errorf("%w: API TLS timeout must not be negative, got %s", ErrInvalidConfig, c.TLSTimeout)
+	case c.MaxRPS < 0:
+		return fmt.Errorf("%w: API max requests a second must not be negative, got %g", ErrInvalidConfig, c.MaxRPS)
+	case c.Burst < 1:
+		return fmt.Errorf("%w: API burst must be at least 1, got %d", ErrInvalidConfig, c.Burst)
+	case c.Workers < 1:
+		return fmt.Errorf("%w: workers must be at least 1, got %d", ErrInvalidConfig, c.Workers)
+	case c.TimeZone == nil:
+		return fmt.Errorf("%w: time zone must be set", ErrInvalidConfig)
+	case c.Output != "" && c.Output != "table" && c.Output != "json" && c.Output != "csv":
+		return fmt.Errorf("%w: output must be table, json or csv, got %q", ErrInvalidConfig, c.Output)
+	case c.MetricsPushURL != "" && !strings.HasPrefix(c.MetricsPushURL, "http://") && !strings.HasPrefix(c.MetricsPushURL, "https://"):
+		return fmt.Errorf("%w: metrics push URL must start with http:// or https://, got %q", ErrInvalidConfig, c.MetricsPushURL)
+	case c.MetricsJob == "":
+		return fmt.Errorf("%w: metrics job must not be empty", ErrInvalidConfig)
+	case c.Shortener != "" && c.Shortener != "shlink" && c.Shortener != "kutt":
+		return fmt.Errorf("%w: URL shortener must be shlink or kutt, got %q", ErrInvalidConfig, c.Shortener)
+	case c.Shortener != "" && !strings.HasPrefix(c.ShortenerURL, "http://") && !strings.HasPrefix(c.ShortenerURL, "https://"):
+		return fmt.Errorf("%w: URL shortener %s needs the URL of the server starting with http:// or https://, got %q", ErrInvalidConfig, c.Shortener, c.ShortenerURL)
+	case c.CredentialsPath != "" && c.CredentialsPath == c.TokenPath:
+		return fmt.Errorf("%w: credentials and token are both %s, logging in would overwrite the client secrets", ErrInvalidConfig, c.CredentialsPath)
+	}
+	if c.Proxy != "" {
+		if _, err := ParseProxyURL(c.Proxy); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	names := make(map[string]bool, len(c.DaemonJobs))
+	for _, job := range c.DaemonJobs {
+		if err := job.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("%w: there are several daemon jobs named %s", ErrInvalidConfig, job.Name)
+		}
+		names[job.Name] = true
+	}
+	for _, scheme := range slices.Sorted(maps.Keys(c.BackupPricing)) {
+		if !slices.Contains(BackupSchemes, scheme) {
+			return fmt.Errorf("%w: backup pricing is for targets of scheme %s, got %q", ErrInvalidConfig, strings.Join(BackupSchemes, " or "), scheme)
+		}
+		if err := c.BackupPricing[scheme].Validate(); err != nil {
+			return fmt.Errorf("%w: backup pricing of %s: %v", ErrInvalidConfig, scheme, err)
+		}
+	}
+	return nil
+}
+
+// ParseProxyURL parses the URL of an http, https or socks5 proxy
+func ParseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: host is missing", s)
+	}
+	return u, nil
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// jobNamePattern limits job names to what is safe in file names, as each job logs to its own file
+var jobNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// DaemonJob is a command the daemon runs on a schedule, such as a sync every 6 hours
+type DaemonJob struct {
+	// Name identifies the job in logs and its status
+	Name     string
+	Schedule Schedule
+	// Command is the command line the job runs, without the program name and global flags, such
+	// as ["sync", "run"]
+	Command []string
+}
+
+// Validate reports a job the daemon could not run
+func (j DaemonJob) Validate() error {
+	switch {
+	case !jobNamePattern.MatchString(j.Name):
+		return fmt.Errorf("job name %q must start with a letter or digit and hold only letters, digits, '.', '_' and '-'", j.Name)
+	case j.Schedule.IsZero():
+		return fmt.Errorf("job %s has no schedule", j.Name)
+	case len(j.Command) == 0:
+		return fmt.Errorf("job %s has no command", j.Name)
+	case j.Command[0] == "daemon":
+		return fmt.Errorf("job %s cannot run the daemon itself", j.Name)
+	}
+	return nil
+}
+
+// Results of a daemon job run
+const (
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobInterrupted = "interrupted"
+)
+
+// JobStatus is what the daemon remembers of a job between runs
+type JobStatus struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// LastStart and LastEnd bound the last run; both are zero before the first one
+	LastStart time.Time `json:"lastStart"`
+	LastEnd   time.Time `json:"lastEnd"`
+	// Result is JobSucceeded, JobFailed or JobInterrupted, empty before the first run
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// NextRun is when the running daemon starts the job next
+	NextRun time.Time `json:"nextRun"`
+	// Runs counts every run, Failures those that failed
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+}
+
+// JobStatusStore persists the status of daemon jobs
+type JobStatusStore interface {
+	// LoadJobStatuses returns the saved status of every job by name
+	LoadJobStatuses() (map[string]JobStatus, error)
+	SaveJobStatus(status JobStatus) error
+}
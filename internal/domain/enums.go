@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MediaType filters media items by kind
+type MediaType string
+
+// Media types accepted by the media item search filter
+const (
+	MediaTypeAll   MediaType = "ALL_MEDIA"
+	MediaTypePhoto MediaType = "PHOTO"
+	MediaTypeVideo MediaType = "VIDEO"
+)
+
+var mediaTypes = []MediaType{MediaTypeAll, MediaTypePhoto, MediaTypeVideo}
+
+// ParseMediaType converts a case-insensitive name into a MediaType
+func ParseMediaType(s string) (MediaType, error) {
+	return parseEnum("media type", s, mediaTypes)
+}
+
+// String returns the API name of the media type
+func (t MediaType) String() string {
+	return string(t)
+}
+
+// Validate reports whether t is a known media type
+func (t MediaType) Validate() error {
+	return validateEnum("media type", t, mediaTypes)
+}
+
+// ContentCategory is a category Google Photos assigns to media items based on their content
+type ContentCategory string
+
+// Content categories supported by the media item search filter
+const (
+	ContentCategoryNone         ContentCategory = "NONE"
+	ContentCategoryLandscapes   ContentCategory = "LANDSCAPES"
+	ContentCategoryReceipts     ContentCategory = "RECEIPTS"
+	ContentCategoryCityscapes   ContentCategory = "CITYSCAPES"
+	ContentCategoryLandmarks    ContentCategory = "LANDMARKS"
+	ContentCategorySelfies      ContentCategory = "SELFIES"
+	ContentCategoryPeople       ContentCategory = "PEOPLE"
+	ContentCategoryPets         ContentCategory = "PETS"
+	ContentCategoryWeddings     ContentCategory = "WEDDINGS"
+	ContentCategoryBirthdays    ContentCategory = "BIRTHDAYS"
+	ContentCategoryDocuments    ContentCategory = "DOCUMENTS"
+	ContentCategoryTravel       ContentCategory = "TRAVEL"
+	ContentCategoryAnimals      ContentCategory = "ANIMALS"
+	ContentCategoryFood         ContentCategory = "FOOD"
+	ContentCategorySport        ContentCategory = "SPORT"
+	ContentCategoryNight        ContentCategory = "NIGHT"
+	ContentCategoryPerformances ContentCategory = "PERFORMANCES"
+	ContentCategoryWhiteboards  ContentCategory = "WHITEBOARDS"
+	ContentCategoryScreenshots  ContentCategory = "SCREENSHOTS"
+	ContentCategoryUtility      ContentCategory = "UTILITY"
+	ContentCategoryArts         ContentCategory = "ARTS"
+	ContentCategoryCrafts       ContentCategory = "CRAFTS"
+	ContentCategoryFashion      ContentCategory = "FASHION"
+	ContentCategoryHouses       ContentCategory = "HOUSES"
+	ContentCategoryGardens      ContentCategory = "GARDENS"
+	ContentCategoryFlowers      ContentCategory = "FLOWERS"
+	ContentCategoryHolidays     ContentCategory = "HOLIDAYS"
+)
+
+var contentCategories = []ContentCategory{
+	ContentCategoryNone, ContentCategoryLandscapes, ContentCategoryReceipts, ContentCategoryCityscapes,
+	ContentCategoryLandmarks, ContentCategorySelfies, ContentCategoryPeople, ContentCategoryPets,
+	ContentCategoryWeddings, ContentCategoryBirthdays, ContentCategoryDocuments, ContentCategoryTravel,
+	ContentCategoryAnimals, ContentCategoryFood, ContentCategorySport, ContentCategoryNight,
+	ContentCategoryPerformances, ContentCategoryWhiteboards, ContentCategoryScreenshots, ContentCategoryUtility,
+	ContentCategoryArts, ContentCategoryCrafts, ContentCategoryFashion, ContentCategoryHouses,
+	ContentCategoryGardens, ContentCategoryFlowers, ContentCategoryHolidays,
+}
+
+// ContentCategories returns every known content category
+func ContentCategories() []ContentCategory {
+	return slices.Clone(contentCategories)
+}
+
+// ParseContentCategory converts a case-insensitive name into a ContentCategory
+func ParseContentCategory(s string) (ContentCategory, error) {
+	return parseEnum("content category", s, contentCategories)
+}
+
+// String returns the API name of the content category
+func (c ContentCategory) String() string {
+	return string(c)
+}
+
+// Validate reports whether c is a known content category
+func (c ContentCategory) Validate() error {
+	return validateEnum("content category", c, contentCategories)
+}
+
+// VideoProcessingStatus describes whether an uploaded video is ready to be played
+type VideoProcessingStatus string
+
+// Video processing states reported in video metadata
+const (
+	VideoProcessingUnspecified VideoProcessingStatus = "UNSPECIFIED"
+	VideoProcessingProcessing  VideoProcessingStatus = "PROCESSING"
+	VideoProcessingReady       VideoProcessingStatus = "READY"
+	VideoProcessingFailed      VideoProcessingStatus = "FAILED"
+)
+
+var videoProcessingStatuses = []VideoProcessingStatus{
+	VideoProcessingUnspecified, VideoProcessingProcessing, VideoProcessingReady, VideoProcessingFailed,
+}
+
+// ParseVideoProcessingStatus converts a case-insensitive name into a VideoProcessingStatus
+func ParseVideoProcessingStatus(s string) (VideoProcessingStatus, error) {
+	return parseEnum("video processing status", s, videoProcessingStatuses)
+}
+
+// String returns the API name of the video processing status
+func (s VideoProcessingStatus) String() string {
+	return string(s)
+}
+
+// Validate reports whether s is a known video processing status
+func (s VideoProcessingStatus) Validate() error {
+	return validateEnum("video processing status", s, videoProcessingStatuses)
+}
+
+// PositionType selects where new items are placed in an album
+type PositionType string
+
+// Album positions accepted when adding media items or enrichments
+const (
+	PositionUnspecified         PositionType = "POSITION_TYPE_UNSPECIFIED"
+	PositionFirstInAlbum        PositionType = "FIRST_IN_ALBUM"
+	PositionLastInAlbum         PositionType = "LAST_IN_ALBUM"
+	PositionAfterMediaItem      PositionType = "AFTER_MEDIA_ITEM"
+	PositionAfterEnrichmentItem PositionType = "AFTER_ENRICHMENT_ITEM"
+)
+
+var positionTypes = []PositionType{
+	PositionUnspecified, PositionFirstInAlbum, PositionLastInAlbum, PositionAfterMediaItem, PositionAfterEnrichmentItem,
+}
+
+// ParsePositionType converts a case-insensitive name into a PositionType
+func ParsePositionType(s string) (PositionType, error) {
+	return parseEnum("position type", s, positionTypes)
+}
+
+// String returns the API name of the position type
+func (p PositionType) String() string {
+	return string(p)
+}
+
+// Validate reports whether p is a known position type
+func (p PositionType) Validate() error {
+	return validateEnum("position type", p, positionTypes)
+}
+
+// RequiresRelativeItem reports whether the position is relative to another item,
+// which then has to be identified alongside it
+func (p PositionType) RequiresRelativeItem() bool {
+	return p == PositionAfterMediaItem || p == PositionAfterEnrichmentItem
+}
+
+// parseEnum matches s case-insensitively against the known values; "-" may be used instead of "_"
+func parseEnum[T ~string](kind, s string, values []T) (T, error) {
+	name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), "-", "_"))
+	if slices.Contains(values, T(name)) {
+		return T(name), nil
+	}
+	var zero T
+	return zero, fmt.Errorf("invalid %s %q: use one of %s", kind, s, joinEnum(values))
+}
+
+// validateEnum returns an error when v is not one of the known values
+func validateEnum[T ~string](kind string, v T, values []T) error {
+	if slices.Contains(values, v) {
+		return nil
+	}
+	return fmt.Errorf("invalid %s %q: use one of %s", kind, string(v), joinEnum(values))
+}
+
+// joinEnum lists values for error messages
+func joinEnum[T ~string](values []T) string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = string(v)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,33 @@
+package domain
+
+import "testing"
+
+func TestParseEnums(t *testing.T) {
+	if got, err := ParseMediaType("photo"); err != nil || got != MediaTypePhoto {
+		t.Errorf("Expected PHOTO, got %q (%v)", got, err)
+	}
+	if got, err := ParseContentCategory("screenshots"); err != nil || got != ContentCategoryScreenshots {
+		t.Errorf("Expected SCREENSHOTS, got %q (%v)", got, err)
+	}
+	if got, err := ParsePositionType("after-media-item"); err != nil || got != PositionAfterMediaItem {
+		t.Errorf("Expected AFTER_MEDIA_ITEM, got %q (%v)", got, err)
+	}
+	if _, err := ParseVideoProcessingStatus("done"); err == nil {
+		t.Error("Expected unknown video processing status to be rejected")
+	}
+}
+
+func TestValidateEnums(t *testing.T) {
+	if err := MediaType("AUDIO").Validate(); err == nil {
+		t.Error("Expected unknown media type to be invalid")
+	}
+	if err := ContentCategory("pets").Validate(); err == nil {
+		t.Error("Expected Validate to require the exact API name")
+	}
+	if err := VideoProcessingReady.Validate(); err != nil {
+		t.Errorf("Expected READY to be valid, got %v", err)
+	}
+	if !PositionAfterEnrichmentItem.RequiresRelativeItem() || PositionLastInAlbum.RequiresRelativeItem() {
+		t.Error("Expected only AFTER_* positions to require a relative item")
+	}
+}
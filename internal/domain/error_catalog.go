@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrNotLoggedIn is returned when no token has been saved for the profile yet
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// ErrMissingCredentials is returned when the OAuth client credentials file is missing or cannot
+// be read as one
+var ErrMissingCredentials = errors.New("no OAuth client credentials")
+
+// ErrInvalidConfig is matched by errors in the config file or the GPM_* variables
+var ErrInvalidConfig = errors.New("invalid config")
+
+// ErrUsage is matched by errors in the way a command was called, such as a missing argument
+var ErrUsage = errors.New("invalid usage")
+
+// ErrorCode identifies a kind of user-facing failure, such as PHM-0423. Codes are stable across
+// releases, so scripts and support can react to them; a retired code is never reused.
+//
+// Codes are numbered after the HTTP status closest to the failure, such as PHM-0404 for not
+// found, and failures sharing a status take the next free number. Codes below PHM-0100 are
+// failures of the command line itself.
+type ErrorCode string
+
+// CatalogEntry is a kind of failure of the error catalog with what the user can do about it
+type CatalogEntry struct {
+	Code ErrorCode `json:"code"`
+	// Err is the sentinel that errors of the kind match with errors.Is; it is nil for the entries
+	// of API failures and of failures of no known kind
+	Err     error  `json:"-"`
+	Summary string `json:"summary"`
+	Hint    string `json:"hint"`
+}
+
+// Catalog entries that match no sentinel
+var (
+	errorUnknown = CatalogEntry{
+		Code:    "PHM-0001",
+		Summary: "Unexpected failure",
+		Hint:    "Run the command again with --verbose for details, and attach a --transcript of the run to bug reports.",
+	}
+	errorAPI = CatalogEntry{
+		Code:    "PHM-0502",
+		Summary: "Google Photos failed",
+		Hint:    "Google Photos could not complete the request; try again later.",
+	}
+)
+
+// errorCatalog lists the kinds of failures with a sentinel, the more specific ones first, as an
+// error may match several: a missing scope is also a denied permission
+var errorCatalog = []CatalogEntry{
+	{
+		Code:    "PHM-0002",
+		Err:     ErrUsage,
+		Summary: "Invalid command line",
+		Hint:    "Run the command with --help to see its arguments and flags.",
+	},
+	{
+		Code:    "PHM-0003",
+		Err:     ErrInvalidConfig,
+		Summary: "Invalid config",
+		Hint:    "Fix the config file or GPM_* variable named in the error; 'config validate' reports every problem at once.",
+	},
+	{
+		Code:    "PHM-0004",
+		Err:     ErrMissingCredentials,
+		Summary: "Missing OAuth client credentials",
+		Hint:    "Download the OAuth client of a desktop app from the Google Cloud Console and save it as credentials.json in the config dir, or run 'init' to point the config at it.",
+	},
+	{
+		Code:    "PHM-0402",
+		Err:     ErrNotLoggedIn,
+		Summary: "Not logged in",
+		Hint:    "Run 'auth login' to sign in with a Google account first.",
+	},
+	{
+		Code:    "PHM-0401",
+		Err:     ErrUnauthenticated,
+		Summary: "Authentication failed",
+		Hint:    "The saved token was revoked or has expired; run 'auth login' to sign in again.",
+	},
+	{
+		Code:    "PHM-0405",
+		Err:     ErrInsufficientScope,
+		Summary: "Missing access",
+		Hint:    "The token lacks a scope this command needs; run 'auth login' to grant it.",
+	},
+	{
+		Code:    "PHM-0423",
+		Err:     ErrAlbumReadOnly,
+		Summary: "Album is read-only",
+		Hint:    "The album is listed in read_only_albums of the config; remove it there to change the album.",
+	},
+	{
+		Code:    "PHM-0403",
+		Err:     ErrPermissionDenied,
+		Summary: "Permission denied",
+		Hint:    "The API only lets the app change albums and media items it created; use an app-created album instead.",
+	},
+	{
+		Code:    "PHM-0404",
+		Err:     ErrNotFound,
+		Summary: "Not found",
+		Hint:    "Check the ID; it may belong to another account, or the item may have been deleted.",
+	},
+	{
+		Code:    "PHM-0429",
+		Err:     ErrRateLimited,
+		Summary: "Rate limited",
+		Hint:    "The API quota is used up; wait for it to reset, or lower --max-rps or api.max_rps of the config.",
+	},
+	{
+		Code:    "PHM-0400",
+		Err:     ErrInvalidArgument,
+		Summary: "Request rejected",
+		Hint:    "Google Photos rejected the request; check the IDs, dates and values passed to the command.",
+	},
+	{
+		Code:    "PHM-0415",
+		Err:     ErrUnsupportedFormat,
+		Summary: "Unsupported file format",
+		Hint:    "The file cannot be read by the installed tools; videos and other unsupported formats are skipped.",
+	},
+}
+
+// ErrorCatalog returns every kind of failure, ordered by code
+func ErrorCatalog() []CatalogEntry {
+	entries := append([]CatalogEntry{errorUnknown, errorAPI}, errorCatalog...)
+	slices.SortFunc(entries, func(a, b CatalogEntry) int { return strings.Compare(string(a.Code), string(b.Code)) })
+	return entries
+}
+
+// ClassifyError returns the catalog entry of the kind of err: the first whose sentinel it matches,
+// then the one of API failures, or else the one of failures of no known kind
+func ClassifyError(err error) CatalogEntry {
+	for _, entry := range errorCatalog {
+		if errors.Is(err, entry.Err) {
+			return entry
+		}
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return errorAPI
+	}
+	return errorUnknown
+}
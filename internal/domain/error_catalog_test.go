@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	scope := &APIError{StatusCode: http.StatusForbidden, Status: "PERMISSION_DENIED", Details: []APIErrorDetail{{Reason: "ACCESS_TOKEN_SCOPE_INSUFFICIENT"}}}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"missing scope before denied permission", scope, "PHM-0405"},
+		{"denied permission", &APIError{StatusCode: http.StatusForbidden}, "PHM-0403"},
+		{"wrapped read-only album", fmt.Errorf("rename: %w", ErrAlbumReadOnly), "PHM-0423"},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, "PHM-0429"},
+		{"not logged in", fmt.Errorf("%w, run 'auth login' first", ErrNotLoggedIn), "PHM-0402"},
+		{"missing credentials", fmt.Errorf("%w: unable to read credentials.json: %w", ErrMissingCredentials, os.ErrNotExist), "PHM-0004"},
+		{"invalid config", Config{}.Validate(), "PHM-0003"},
+		{"other API failure", &APIError{StatusCode: http.StatusInternalServerError}, "PHM-0502"},
+		{"unknown", errors.New("disk full"), "PHM-0001"},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got.Code != tt.want || got.Hint == "" {
+			t.Errorf("%s: expected %s with a hint, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestErrorCatalog_CodesAreUnique(t *testing.T) {
+	format := regexp.MustCompile(`^PHM-\d{4}$`)
+	seen := make(map[ErrorCode]bool)
+	for _, entry := range ErrorCatalog() {
+		if !format.MatchString(string(entry.Code)) || seen[entry.Code] {
+			t.Errorf("Expected a unique code like PHM-0423, got %q", entry.Code)
+		}
+		seen[entry.Code] = true
+	}
+}
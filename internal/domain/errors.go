@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kinds of Google API failures. Repositories return *APIError, which matches the kinds that
+// apply to it with errors.Is, e.g. errors.Is(err, ErrNotFound).
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrInsufficientScope = errors.New("insufficient scope")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrUnauthenticated   = errors.New("unauthenticated")
+	ErrInvalidArgument   = errors.New("invalid argument")
+)
+
+// APIError is a failed API call, described by the JSON error body Google APIs return
+type APIError struct {
+	// StatusCode and HTTPStatus are the HTTP status of the response, e.g. 404 and "404 Not Found"
+	StatusCode int
+	HTTPStatus string
+	// Code, Status and Message come from the error body, e.g. 404, "NOT_FOUND" and a description
+	Code    int
+	Status  string
+	Message string
+	Details []APIErrorDetail
+	// Body is an excerpt of a response that is not in the Google error format
+	Body string
+}
+
+// APIErrorDetail is an entry of the details of a Google error, such as a google.rpc.ErrorInfo
+type APIErrorDetail struct {
+	Type     string            `json:"@type"`
+	Reason   string            `json:"reason,omitempty"`
+	Domain   string            `json:"domain,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Error returns the HTTP status followed by Google's message when there is one
+func (e *APIError) Error() string {
+	var msg string
+	switch {
+	case e.Message != "" && e.Status != "":
+		msg = fmt.Sprintf("%s (%s)", e.Message, e.Status)
+	case e.Message != "":
+		msg = e.Message
+	case e.Status != "":
+		msg = e.Status
+	default:
+		msg = e.Body
+	}
+
+	switch {
+	case msg == "":
+		return "API error: " + e.HTTPStatus
+	case e.HTTPStatus == "":
+		// Failures of single operations inside a batch request have no HTTP status of their own
+		return "API error: " + msg
+	}
+	return fmt.Sprintf("API error: %s: %s", e.HTTPStatus, msg)
+}
+
+// Is reports whether the error is of the kind of target, one of the Err* sentinels
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.Status == "NOT_FOUND"
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.Status == "RESOURCE_EXHAUSTED" || e.hasReason("RATE_LIMIT_EXCEEDED")
+	case ErrInsufficientScope:
+		// Older responses only say so in the message
+		return e.hasReason("ACCESS_TOKEN_SCOPE_INSUFFICIENT") || strings.Contains(e.Message, "insufficient authentication scopes")
+	case ErrPermissionDenied:
+		return e.StatusCode == http.StatusForbidden || e.Status == "PERMISSION_DENIED"
+	case ErrUnauthenticated:
+		return e.StatusCode == http.StatusUnauthorized || e.Status == "UNAUTHENTICATED"
+	case ErrInvalidArgument:
+		return e.StatusCode == http.StatusBadRequest || e.Status == "INVALID_ARGUMENT"
+	}
+	return false
+}
+
+// grpcStatusNames names the gRPC status codes that results of batch requests carry, as the
+// Status of error bodies does
+var grpcStatusNames = map[int]string{
+	3:  "INVALID_ARGUMENT",
+	5:  "NOT_FOUND",
+	7:  "PERMISSION_DENIED",
+	8:  "RESOURCE_EXHAUSTED",
+	16: "UNAUTHENTICATED",
+}
+
+// hasReason reports whether any detail of the error gives reason
+func (e *APIError) hasReason(reason string) bool {
+	for _, detail := range e.Details {
+		if detail.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"time"
+)
+
+// exifTagOrientation holds how a photo must be rotated or flipped to be shown upright
+const exifTagOrientation = 0x0112
+
+// earthRadiusKm is the mean radius of the earth, which distances between GeoPoints are taken on
+const earthRadiusKm = 6371.0
+
+// GeoPoint is a position on earth in decimal degrees
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Validate reports whether the point lies within the range of latitudes and longitudes
+func (p GeoPoint) Validate() error {
+	if math.IsNaN(p.Latitude) || p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("latitude %v is outside -90 to 90", p.Latitude)
+	}
+	if math.IsNaN(p.Longitude) || p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("longitude %v is outside -180 to 180", p.Longitude)
+	}
+	return nil
+}
+
+// DistanceKm returns the great-circle distance between p and q in kilometres
+func (p GeoPoint) DistanceKm(q GeoPoint) float64 {
+	lat1, lat2 := p.Latitude*math.Pi/180, q.Latitude*math.Pi/180
+	dLat, dLng := lat2-lat1, (q.Longitude-p.Longitude)*math.Pi/180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// String formats the point as "latitude,longitude" with five decimals, about a metre
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Latitude, 'f', 5, 64) + "," + strconv.FormatFloat(p.Longitude, 'f', 5, 64)
+}
+
+// GeoArea is the circle of RadiusKm kilometres around Center
+type GeoArea struct {
+	Center   GeoPoint
+	RadiusKm float64
+}
+
+// Contains reports whether p lies within the area
+func (a GeoArea) Contains(p GeoPoint) bool {
+	return a.Center.DistanceKm(p) <= a.RadiusKm
+}
+
+// ExifData is what the EXIF data of an uploaded photo says about when, where and with which
+// camera it was taken. The Library API never returns the location of a media item, so it is
+// read from the file while uploading and kept in the local index by media item ID.
+type ExifData struct {
+	MediaItemID string `json:"mediaItemId"`
+	// Path is the uploaded file, relative to the directory it was uploaded from
+	Path string `json:"path"`
+	// Taken is when the photo was taken, in the UTC offset EXIF gives or else as a wall clock
+	// time in UTC; zero when unknown
+	Taken       time.Time `json:"taken,omitzero"`
+	CameraMake  string    `json:"cameraMake,omitempty"`
+	CameraModel string    `json:"cameraModel,omitempty"`
+	// Location is where the photo was taken, nil without GPS data
+	Location *GeoPoint `json:"location,omitempty"`
+}
+
+// IsZero reports whether the EXIF data says nothing about the photo
+func (e ExifData) IsZero() bool {
+	return e.Taken.IsZero() && e.CameraMake == "" && e.CameraModel == "" && e.Location == nil
+}
+
+// ExifRepository keeps the EXIF data of uploaded photos
+type ExifRepository interface {
+	// SaveExif records data, replacing what was recorded for the same media items
+	SaveExif(data []ExifData) error
+	// LoadExif returns everything recorded by media item ID
+	LoadExif() (map[string]ExifData, error)
+}
+
+// ExifOrientation returns the EXIF orientation of a JPEG or TIFF based photo, from 1 for upright
+// to 8; it is 1 when the photo has none or it cannot be read
+func ExifOrientation(b []byte) int {
+	start, err := TIFFStart(b)
+	if err != nil || start < 0 {
+		return 1
+	}
+	tiff := b[start:]
+	order := TIFFByteOrder(tiff)
+	if order == nil {
+		return 1
+	}
+
+	// The orientation is a SHORT in the first directory
+	ifd := uint64(order.Uint32(tiff[4:8]))
+	if ifd+2 > uint64(len(tiff)) {
+		return 1
+	}
+	count := uint64(order.Uint16(tiff[ifd:]))
+	if ifd+2+12*count > uint64(len(tiff)) {
+		return 1
+	}
+	for i := range count {
+		entry := tiff[ifd+2+12*i:]
+		if order.Uint16(entry) == exifTagOrientation && order.Uint16(entry[2:]) == 3 {
+			if o := int(order.Uint16(entry[8:])); o >= 1 && o <= 8 {
+				return o
+			}
+		}
+	}
+	return 1
+}
+
+// TIFFByteOrder returns the byte order of the TIFF structure in tiff, or nil when it has none
+func TIFFByteOrder(tiff []byte) binary.ByteOrder {
+	switch {
+	case len(tiff) >= 8 && string(tiff[:2]) == "II":
+		return binary.LittleEndian
+	case len(tiff) >= 8 && string(tiff[:2]) == "MM":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// TIFFStart returns where the TIFF structure holding the EXIF data starts in b: at the start of
+// TIFF based files, or inside the APP1 segment of a JPEG. It is -1 when b has none.
+func TIFFStart(b []byte) (int, error) {
+	if len(b) >= 4 && (string(b[:4]) == "II*\x00" || string(b[:4]) == "MM\x00*") {
+		return 0, nil
+	}
+	if len(b) < 2 || b[0] != 0xFF || b[1] != 0xD8 {
+		return -1, nil
+	}
+
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return -1, fmt.Errorf("malformed JPEG: expected a marker at %d", i)
+		}
+		marker := b[i+1]
+		// Markers without a length, then the start of the image data, after which no EXIF follows
+		switch {
+		case marker == 0xFF:
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			return -1, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(b[i+2:]))
+		if length < 2 || i+2+length > len(b) {
+			return -1, fmt.Errorf("malformed JPEG: segment out of range")
+		}
+		if segment := b[i+4 : i+2+length]; marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return i + 4 + 6, nil
+		}
+		i += 2 + length
+	}
+	return -1, nil
+}
+
+// Orient rotates and flips img as its EXIF orientation says, so it is shown upright
+func Orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs a quarter turn clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs a quarter turn counterclockwise
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
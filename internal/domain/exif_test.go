@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// A 2x1 image: red, blue
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	img.SetRGBA(0, 0, red)
+	img.SetRGBA(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA
+	}{
+		{1, [][]color.RGBA{{red, blue}}},
+		{2, [][]color.RGBA{{blue, red}}},
+		{3, [][]color.RGBA{{blue, red}}},
+		{5, [][]color.RGBA{{red}, {blue}}},
+		{6, [][]color.RGBA{{red}, {blue}}},
+		{7, [][]color.RGBA{{blue}, {red}}},
+		{8, [][]color.RGBA{{blue}, {red}}},
+	}
+	for _, tt := range tests {
+		got := Orient(img, tt.orientation)
+		for y, row := range tt.want {
+			for x, c := range row {
+				if got.Bounds().Dx() != len(row) || got.RGBAAt(x, y) != c {
+					t.Errorf("Orientation %d: expected %v at %d,%d of a %v image, got %v", tt.orientation, c, x, y, got.Bounds(), got.RGBAAt(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	// A little-endian TIFF header and a first directory with only the orientation, a SHORT of 6
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+	if o := ExifOrientation(tiff); o != 6 {
+		t.Errorf("Expected orientation 6, got %d", o)
+	}
+	if o := ExifOrientation([]byte("\x89PNG")); o != 1 {
+		t.Errorf("Expected photos without EXIF data to be upright, got %d", o)
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ExitTimeout bounds how long each cleanup step may take once a run ends
+const ExitTimeout = 30 * time.Second
+
+// ExitHooks runs cleanup as a run ends, however it ends, such as removing temporary files,
+// stopping servers and aborting partial uploads. Operations register their cleanup as they start
+// and run it themselves as they finish, so what is still in flight when the run ends, such as
+// after Ctrl-C, is cleaned up as well.
+type ExitHooks interface {
+	// OnExit registers fn to run as the run ends, under name in logs, and returns a function
+	// running it at once instead, which operations defer. fn runs once either way, with a context
+	// bounded by ExitTimeout.
+	OnExit(name string, fn func(ctx context.Context) error) (done func() error)
+}
+
+// OnExit registers fn with hooks like ExitHooks.OnExit; without hooks the returned function only
+// runs fn
+func OnExit(hooks ExitHooks, name string, fn func(ctx context.Context) error) func() error {
+	if hooks != nil {
+		return hooks.OnExit(name, fn)
+	}
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), ExitTimeout)
+		defer cancel()
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFilenameDatePatterns recognize the file names cameras, phones and messengers give
+// photos, such as IMG_20240115_103000.jpg, PXL_20240115_103000123.jpg, IMG-20240115-WA0001.jpg
+// and "WhatsApp Image 2023-01-15 at 10.30.00.jpeg"
+var DefaultFilenameDatePatterns = []string{
+	`(?:IMG|VID|PXL|MVIMG|PANO|BURST)_(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})(?:_(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2}))?`,
+	`(?:IMG|VID|AUD|PTT)-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})-WA\d+`,
+	`WhatsApp (?:Image|Video) (?P<year>\d{4})-(?P<month>\d{2})-(?P<day>\d{2}) at (?P<hour>\d{1,2})[.:](?P<minute>\d{2})[.:](?P<second>\d{2})(?: (?P<ampm>[AaPp][Mm]))?`,
+	`Screenshot[_ -](?P<year>\d{4})-?(?P<month>\d{2})-?(?P<day>\d{2})(?:[_ -](?:at )?(?P<hour>\d{2})[.:-]?(?P<minute>\d{2})[.:-]?(?P<second>\d{2}))?`,
+	`(?P<year>\d{4})-(?P<month>\d{2})-(?P<day>\d{2})[ _T](?P<hour>\d{2})[.:-](?P<minute>\d{2})[.:-](?P<second>\d{2})`,
+}
+
+// FilenameDateRule finds when a photo was taken in its file name with a regular expression.
+// The named groups year, month and day are required; hour, minute, second and ampm, an AM or PM
+// marker, are used when present.
+type FilenameDateRule struct {
+	pattern *regexp.Regexp
+}
+
+// NewFilenameDateRule compiles pattern into a FilenameDateRule
+func NewFilenameDateRule(pattern string) (FilenameDateRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return FilenameDateRule{}, fmt.Errorf("invalid file name date pattern %q: %v", pattern, err)
+	}
+	for _, group := range []string{"year", "month", "day"} {
+		if re.SubexpIndex(group) < 0 {
+			return FilenameDateRule{}, fmt.Errorf("invalid file name date pattern %q: the named group %q is missing", pattern, group)
+		}
+	}
+	return FilenameDateRule{pattern: re}, nil
+}
+
+// DefaultFilenameDateRules returns the rules of DefaultFilenameDatePatterns
+func DefaultFilenameDateRules() []FilenameDateRule {
+	rules := make([]FilenameDateRule, len(DefaultFilenameDatePatterns))
+	for i, pattern := range DefaultFilenameDatePatterns {
+		rules[i] = FilenameDateRule{pattern: regexp.MustCompile(pattern)}
+	}
+	return rules
+}
+
+// String returns the pattern of the rule
+func (r FilenameDateRule) String() string {
+	return r.pattern.String()
+}
+
+// Match returns the date in name as a wall clock time in UTC, the way EXIF dates are read. ok
+// is false when the pattern does not match or the date it finds does not exist.
+func (r FilenameDateRule) Match(name string) (t time.Time, ok bool) {
+	m := r.pattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	group := func(name string) string {
+		if i := r.pattern.SubexpIndex(name); i >= 0 {
+			return m[i]
+		}
+		return ""
+	}
+	number := func(name string) int {
+		n, err := strconv.Atoi(group(name))
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+
+	year, month, day := number("year"), number("month"), number("day")
+	hour, minute, second := 0, 0, 0
+	if group("hour") != "" {
+		hour, minute, second = number("hour"), max(number("minute"), 0), max(number("second"), 0)
+	}
+	switch ampm := strings.ToUpper(group("ampm")); {
+	case ampm != "" && (hour < 1 || hour > 12):
+		return time.Time{}, false
+	case ampm == "AM" && hour == 12:
+		hour = 0
+	case ampm == "PM" && hour < 12:
+		hour += 12
+	}
+
+	// time.Date normalizes out of range values, so a date that changes was not a real one
+	t = time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	if year < 1900 || t.Year() != year || int(t.Month()) != month || t.Day() != day ||
+		t.Hour() != hour || t.Minute() != minute || t.Second() != second {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// InferFilenameDate returns the date found by the first of rules that matches name
+func InferFilenameDate(rules []FilenameDateRule, name string) (time.Time, bool) {
+	for _, rule := range rules {
+		if t, ok := rule.Match(name); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
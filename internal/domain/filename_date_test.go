@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInferFilenameDate(t *testing.T) {
+	rules := DefaultFilenameDateRules()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "IMG_20240115_103000.jpg", want: "2024-01-15 10:30:00"},
+		{name: "PXL_20240115_103000123.MP.jpg", want: "2024-01-15 10:30:00"},
+		{name: "IMG_20240115.jpg", want: "2024-01-15 00:00:00"},
+		{name: "IMG-20230102-WA0007.jpg", want: "2023-01-02 00:00:00"},
+		{name: "WhatsApp Image 2023-01-15 at 10.30.00.jpeg", want: "2023-01-15 10:30:00"},
+		{name: "WhatsApp Image 2023-01-15 at 3.04.05 PM.jpeg", want: "2023-01-15 15:04:05"},
+		{name: "WhatsApp Image 2023-01-15 at 12.04.05 AM.jpeg", want: "2023-01-15 00:04:05"},
+		{name: "Screenshot_20240301-221500.png", want: "2024-03-01 22:15:00"},
+		{name: "Screenshot 2024-03-01 at 22.15.00.png", want: "2024-03-01 22:15:00"},
+		{name: "2022-12-31 23.59.59.jpg", want: "2022-12-31 23:59:59"},
+		{name: "IMG_20240231_103000.jpg", want: ""},
+		{name: "IMG_20240115_253000.jpg", want: ""},
+		{name: "DSC01234.jpg", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := InferFilenameDate(rules, tt.name)
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("Expected no date, got %s", got)
+			case tt.want != "" && (!ok || got.Format(time.DateTime) != tt.want || got.Location() != time.UTC):
+				t.Errorf("Expected %s UTC, got %s (%v)", tt.want, got, ok)
+			}
+		})
+	}
+}
+
+func TestNewFilenameDateRule(t *testing.T) {
+	rule, err := NewFilenameDateRule(`scan-(?P<day>\d{2})(?P<month>\d{2})(?P<year>\d{4})`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, ok := rule.Match("scan-24121999.tif"); !ok || got.Format(time.DateOnly) != "1999-12-24" {
+		t.Errorf("Expected 1999-12-24, got %s (%v)", got, ok)
+	}
+
+	if _, err := NewFilenameDateRule(`(?P<year>\d{4})(?P<month>\d{2})`); err == nil || !strings.Contains(err.Error(), `"day"`) {
+		t.Errorf("Expected an error for the missing day group, got %v", err)
+	}
+	if _, err := NewFilenameDateRule(`(?P<year>\d{4}`); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+}
@@ -0,0 +1,17 @@
+package domain
+
+// ImageHashes are the perceptual hashes of an indexed photo: one for each square region of the
+// picture, so that a crop of the photo can be matched to the region it was cut from
+type ImageHashes struct {
+	MediaItemID string   `json:"mediaItemId"`
+	Hashes      []uint64 `json:"hashes"`
+}
+
+// ImageHashRepository keeps the perceptual hashes of indexed photos, so similarity searches only
+// hash the photos added since
+type ImageHashRepository interface {
+	// SaveImageHashes records hashes, replacing what was recorded for the same media items
+	SaveImageHashes(hashes []ImageHashes) error
+	// LoadImageHashes returns everything recorded by media item ID
+	LoadImageHashes() (map[string]ImageHashes, error)
+}
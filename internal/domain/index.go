@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+// IndexSnapshot is the album and media item metadata mirrored into the local index
+type IndexSnapshot struct {
+	Albums     []Album
+	MediaItems []MediaItem
+	// AlbumItems maps album IDs to the IDs of the media items they contain
+	AlbumItems map[string][]string
+	UpdatedAt  time.Time
+}
+
+// IndexStats summarizes the contents of the local index
+type IndexStats struct {
+	Albums     int       `json:"albums"`
+	MediaItems int       `json:"mediaItems"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// LibrarySnapshot is the size of the library on a day the index was written; the index keeps one
+// per day so the growth of the library can be followed over time
+type LibrarySnapshot struct {
+	At     time.Time `json:"at"`
+	Albums int       `json:"albums"`
+	Photos int       `json:"photos"`
+	Videos int       `json:"videos"`
+}
+
+// IndexRepository defines the interface for the local metadata index
+type IndexRepository interface {
+	// Load returns everything in the index; an index that was never built yields an empty snapshot
+	Load() (*IndexSnapshot, error)
+	// Replace atomically replaces the contents of the index with snapshot
+	Replace(snapshot IndexSnapshot) error
+	Stats() (*IndexStats, error)
+	// History returns the library snapshot of every day the index was written, oldest first
+	History() ([]LibrarySnapshot, error)
+	Close() error
+}
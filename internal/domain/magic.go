@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// MagicRule selects the media items that belong in an app-owned album. Every criterion that is
+// set must match; within a criterion, any of the date ranges or content categories may match.
+type MagicRule struct {
+	// Album is the title of the album the matching media items are added to
+	Album             string
+	DateRanges        []DateRange
+	ContentCategories []ContentCategory
+	MediaType         MediaType
+	// FilenamePattern is a path.Match glob compared case-insensitively with file names
+	FilenamePattern string
+	// TimeZone decides which day media items were taken on for DateRanges; nil uses the
+	// configured time zone
+	TimeZone *time.Location
+	// Location matches photos taken within the area according to the EXIF data recorded while
+	// uploading them, since the API returns no location; other media items never match
+	Location *GeoArea
+}
+
+// Validate reports whether the rule names an album and has at least one valid criterion
+func (r MagicRule) Validate() error {
+	if strings.TrimSpace(r.Album) == "" {
+		return fmt.Errorf("album title is required")
+	}
+	if len(r.DateRanges) == 0 && len(r.ContentCategories) == 0 && r.MediaType == "" && r.FilenamePattern == "" && r.Location == nil {
+		return fmt.Errorf("rule for %q has no criteria", r.Album)
+	}
+	for _, dr := range r.DateRanges {
+		if dr.Start.IsZero() || dr.End.IsZero() {
+			return fmt.Errorf("rule for %q: date ranges need a start and an end", r.Album)
+		}
+		if dr.End.Before(dr.Start) {
+			return fmt.Errorf("rule for %q: date range ends before it starts", r.Album)
+		}
+	}
+	for _, c := range r.ContentCategories {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("rule for %q: %v", r.Album, err)
+		}
+	}
+	if r.MediaType != "" {
+		if err := r.MediaType.Validate(); err != nil {
+			return fmt.Errorf("rule for %q: %v", r.Album, err)
+		}
+	}
+	if _, err := path.Match(r.FilenamePattern, ""); err != nil {
+		return fmt.Errorf("rule for %q: invalid filename pattern %q", r.Album, r.FilenamePattern)
+	}
+	if r.Location != nil {
+		if err := r.Location.Center.Validate(); err != nil {
+			return fmt.Errorf("rule for %q: %v", r.Album, err)
+		}
+		if !(r.Location.RadiusKm > 0) {
+			return fmt.Errorf("rule for %q: location radius must be positive", r.Album)
+		}
+	}
+	return nil
+}
+
+// Filters returns the search filters the API can apply for the rule. Date ranges are widened,
+// so results still need MatchesDate.
+func (r MagicRule) Filters() SearchFilters {
+	return SearchFilters{
+		DateRanges:        r.DateRanges,
+		ContentCategories: r.ContentCategories,
+		MediaType:         r.MediaType,
+	}.Widen()
+}
+
+// MatchesDate reports whether t falls within one of the rule's date ranges, if it has any, in
+// the rule's time zone or else in loc
+func (r MagicRule) MatchesDate(t time.Time, loc *time.Location) bool {
+	if len(r.DateRanges) == 0 {
+		return true
+	}
+	if r.TimeZone != nil {
+		loc = r.TimeZone
+	}
+	for _, dr := range r.DateRanges {
+		if dr.Contains(t, loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesFilename reports whether name matches the rule's filename pattern, if it has one
+func (r MagicRule) MatchesFilename(name string) bool {
+	if r.FilenamePattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(r.FilenamePattern), strings.ToLower(name))
+	return ok
+}
+
+// MatchesLocation reports whether p lies within the rule's location, if it has one; an unknown
+// location never does
+func (r MagicRule) MatchesLocation(p *GeoPoint) bool {
+	if r.Location == nil {
+		return true
+	}
+	return p != nil && r.Location.Contains(*p)
+}
+
+// MagicRuleRepository loads the rules that populate magic albums
+type MagicRuleRepository interface {
+	LoadMagicRules() ([]MagicRule, error)
+}
@@ -0,0 +1,301 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MediaItem represents a photo or video in Google Photos
+type MediaItem struct {
+	ID              string           `json:"id"`
+	Description     string           `json:"description,omitempty"`
+	ProductURL      string           `json:"productUrl,omitempty"`
+	BaseURL         string           `json:"baseUrl,omitempty"`
+	MimeType        string           `json:"mimeType,omitempty"`
+	MediaMetadata   *MediaMetadata   `json:"mediaMetadata,omitempty"`
+	ContributorInfo *ContributorInfo `json:"contributorInfo,omitempty"`
+	Filename        string           `json:"filename,omitempty"`
+}
+
+// IsVideo reports whether the media item is a video
+func (m MediaItem) IsVideo() bool {
+	if m.MediaMetadata != nil && m.MediaMetadata.Video != nil {
+		return true
+	}
+	return strings.HasPrefix(m.MimeType, "video/")
+}
+
+// ImageSize selects how a photo is scaled when it is downloaded. Zero values keep the original size.
+type ImageSize struct {
+	// Width and Height bound the photo; it is scaled down to fit within them
+	Width  int
+	Height int
+	// Crop fills exactly Width x Height, cutting off what does not fit the aspect ratio
+	Crop bool
+	// Still serves a still frame of a video instead of the video, scaled like a photo
+	Still bool
+}
+
+// DownloadURL returns the URL that serves the bytes of the media item. Videos are downloaded with
+// "=dv" unless size asks for a still; photos with "=d" keep their metadata, or are scaled (and
+// cropped) to size when it is set.
+// Base URLs expire after about an hour; MediaItemRepository.DownloadMediaItem refreshes them as needed.
+func (m MediaItem) DownloadURL(size ImageSize) string {
+	switch {
+	case m.IsVideo() && !size.Still:
+		return m.BaseURL + "=dv"
+	case size.Width > 0 && size.Height > 0 && size.Crop:
+		return fmt.Sprintf("%s=w%d-h%d-c", m.BaseURL, size.Width, size.Height)
+	case size.Width > 0 && size.Height > 0:
+		return fmt.Sprintf("%s=w%d-h%d", m.BaseURL, size.Width, size.Height)
+	case size.Width > 0:
+		return fmt.Sprintf("%s=w%d", m.BaseURL, size.Width)
+	case size.Height > 0:
+		return fmt.Sprintf("%s=h%d", m.BaseURL, size.Height)
+	default:
+		return m.BaseURL + "=d"
+	}
+}
+
+// MediaMetadata holds the dimensions, capture time and camera details of a media item
+type MediaMetadata struct {
+	CreationTime time.Time      `json:"creationTime"`
+	Width        int64          `json:"width,string,omitempty"`
+	Height       int64          `json:"height,string,omitempty"`
+	Photo        *PhotoMetadata `json:"photo,omitempty"`
+	Video        *VideoMetadata `json:"video,omitempty"`
+}
+
+// PhotoMetadata holds camera details of a photo
+type PhotoMetadata struct {
+	CameraMake      string  `json:"cameraMake,omitempty"`
+	CameraModel     string  `json:"cameraModel,omitempty"`
+	FocalLength     float64 `json:"focalLength,omitempty"`
+	ApertureFNumber float64 `json:"apertureFNumber,omitempty"`
+	ISOEquivalent   int     `json:"isoEquivalent,omitempty"`
+	ExposureTime    string  `json:"exposureTime,omitempty"`
+}
+
+// VideoMetadata holds camera details and the processing state of a video
+type VideoMetadata struct {
+	CameraMake  string                `json:"cameraMake,omitempty"`
+	CameraModel string                `json:"cameraModel,omitempty"`
+	FPS         float64               `json:"fps,omitempty"`
+	Status      VideoProcessingStatus `json:"status,omitempty"`
+}
+
+// ContributorInfo identifies who added a media item to a shared album
+type ContributorInfo struct {
+	ProfilePictureBaseURL string `json:"profilePictureBaseUrl,omitempty"`
+	DisplayName           string `json:"displayName,omitempty"`
+}
+
+// NewMediaItem describes an uploaded file that should become a media item
+type NewMediaItem struct {
+	UploadToken string
+	FileName    string
+	Description string
+}
+
+// Status is the outcome of a single operation inside a batch request
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// OK reports whether the operation succeeded; Google APIs use code 0 for success
+func (s Status) OK() bool {
+	return s.Code == 0
+}
+
+// Err returns the failure as an *APIError, which matches ErrNotFound, ErrPermissionDenied and the
+// other kinds with errors.Is; nil when the operation succeeded
+func (s Status) Err() error {
+	if s.OK() {
+		return nil
+	}
+	return &APIError{Code: s.Code, Status: grpcStatusNames[s.Code], Message: s.Message}
+}
+
+// NewMediaItemResult is the outcome of creating one media item from an upload token
+type NewMediaItemResult struct {
+	UploadToken string     `json:"uploadToken"`
+	Status      Status     `json:"status"`
+	MediaItem   *MediaItem `json:"mediaItem,omitempty"`
+}
+
+// MediaItemResult is the outcome of fetching one media item by its ID
+type MediaItemResult struct {
+	ID        string
+	MediaItem *MediaItem
+	// Err is why the media item could not be returned. errors.Is tells ErrNotFound, for items that
+	// were deleted or never existed, from ErrPermissionDenied, for items the app may not see.
+	Err error
+}
+
+// DateRange selects the calendar days from Start to End, both inclusive. Only the dates of Start
+// and End count, not their time of day or location.
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains reports whether t falls on one of the days of the range as seen in loc. Converting
+// with the rules of loc keeps days that start or end daylight saving time right.
+func (r DateRange) Contains(t time.Time, loc *time.Location) bool {
+	day := calendarDay(t.In(loc))
+	return !day.Before(calendarDay(r.Start)) && !day.After(calendarDay(r.End))
+}
+
+// Widen returns the range with a day added on both sides. The API matches days in a time zone of
+// its own, so searches ask for the wider range and check Contains on what comes back.
+func (r DateRange) Widen() DateRange {
+	return DateRange{Start: r.Start.AddDate(0, 0, -1), End: r.End.AddDate(0, 0, 1)}
+}
+
+// calendarDay returns midnight UTC of the date t has in its own location
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Limits the API puts on the filters of a search
+const (
+	MaxSearchDateRanges        = 5
+	MaxSearchContentCategories = 10
+)
+
+// SearchFilters narrows a media item search; empty fields match everything
+type SearchFilters struct {
+	DateRanges []DateRange
+	// ContentCategories matches media items in any of the categories
+	ContentCategories []ContentCategory
+	// ExcludedContentCategories leaves out media items in any of the categories
+	ExcludedContentCategories []ContentCategory
+	MediaType                 MediaType
+	// Favorites only matches media items marked as favorite
+	Favorites bool
+	// IncludeArchived also matches archived media items, which are left out otherwise
+	IncludeArchived bool
+	// AppCreatedOnly only matches media items uploaded by this app
+	AppCreatedOnly bool
+}
+
+// Validate reports filters the API would reject, so they fail before a request is made
+func (f SearchFilters) Validate() error {
+	if len(f.DateRanges) > MaxSearchDateRanges {
+		return fmt.Errorf("%w: at most %d date ranges, got %d", ErrInvalidArgument, MaxSearchDateRanges, len(f.DateRanges))
+	}
+	for _, dr := range f.DateRanges {
+		if dr.Start.IsZero() || dr.End.IsZero() {
+			return fmt.Errorf("%w: date ranges need a start and an end", ErrInvalidArgument)
+		}
+		if calendarDay(dr.End).Before(calendarDay(dr.Start)) {
+			return fmt.Errorf("%w: date range %s to %s ends before it starts", ErrInvalidArgument, dr.Start.Format(time.DateOnly), dr.End.Format(time.DateOnly))
+		}
+	}
+	if len(f.ContentCategories) > MaxSearchContentCategories || len(f.ExcludedContentCategories) > MaxSearchContentCategories {
+		return fmt.Errorf("%w: at most %d content categories are included or excluded", ErrInvalidArgument, MaxSearchContentCategories)
+	}
+	for _, c := range slices.Concat(f.ContentCategories, f.ExcludedContentCategories) {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+		}
+	}
+	for _, c := range f.ContentCategories {
+		if slices.Contains(f.ExcludedContentCategories, c) {
+			return fmt.Errorf("%w: content category %s is both included and excluded", ErrInvalidArgument, c)
+		}
+	}
+	if f.MediaType != "" {
+		if err := f.MediaType.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+		}
+	}
+	return nil
+}
+
+// Widen returns the filters with every date range widened by a day, see DateRange.Widen
+func (f SearchFilters) Widen() SearchFilters {
+	if len(f.DateRanges) == 0 {
+		return f
+	}
+	ranges := make([]DateRange, len(f.DateRanges))
+	for i, dr := range f.DateRanges {
+		ranges[i] = dr.Widen()
+	}
+	f.DateRanges = ranges
+	return f
+}
+
+// UploadSession is an in-progress resumable upload that can be continued after a failure
+type UploadSession struct {
+	// URL receives the chunks of this upload and answers offset queries
+	URL      string `json:"url"`
+	FileName string `json:"fileName"`
+	Size     int64  `json:"size"`
+	// ChunkGranularity is the multiple every chunk except the last must be sized in
+	ChunkGranularity int64     `json:"chunkGranularity,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// UploadSessionStore persists resumable upload sessions so interrupted uploads survive restarts
+type UploadSessionStore interface {
+	// LoadUploadSession returns the session saved under key, or nil when there is none
+	LoadUploadSession(key string) (*UploadSession, error)
+	SaveUploadSession(key string, session UploadSession) error
+	DeleteUploadSession(key string) error
+}
+
+// ThumbnailCache keeps small renditions of media items so they are downloaded only once
+type ThumbnailCache interface {
+	// LoadThumbnail returns the cached thumbnail of a media item at size pixels, or nil when there is none
+	LoadThumbnail(mediaItemID string, size int) ([]byte, error)
+	SaveThumbnail(mediaItemID string, size int, data []byte) error
+}
+
+// ErrUnsupportedFormat is returned by a Thumbnailer for files it cannot read, such as videos
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// Thumbnailer makes small renditions of local photos, such as files about to be uploaded,
+// without asking Google for them
+type Thumbnailer interface {
+	// Thumbnail returns a JPEG of the photo in content, a file called name, that fits in size
+	// by size pixels, upright and with its aspect ratio kept
+	Thumbnail(ctx context.Context, name string, content io.Reader, size int) ([]byte, error)
+}
+
+// MediaItemRepository defines the interface for media item operations
+type MediaItemRepository interface {
+	// Upload sends the bytes of a file and returns an upload token valid for one day
+	Upload(fileName, mimeType string, content io.Reader, size int64) (string, error)
+	// UploadResumable sends a file in chunks with the resumable protocol, retrying failed chunks
+	// from the offset the server confirmed. key identifies the file across runs so an interrupted
+	// upload continues where it stopped instead of starting from zero, also after ctx is cancelled.
+	UploadResumable(ctx context.Context, key, fileName, mimeType string, content io.ReaderAt, size int64) (string, error)
+	GetMediaItem(id string) (*MediaItem, error)
+	// UpdateMediaItemDescription replaces the description of an app-created media item
+	UpdateMediaItemDescription(id, description string) (*MediaItem, error)
+	// BatchGetMediaItems retrieves up to MaxBatchMediaItems media items, leaving out those that cannot be returned
+	BatchGetMediaItems(ids []string) ([]MediaItem, error)
+	// GetMediaItems retrieves any number of media items in as many batch requests as needed,
+	// returning one result per ID in the order given
+	GetMediaItems(ids []string) ([]MediaItemResult, error)
+	// ListMediaItems retrieves a page of the media items in the library that the app can see
+	ListMediaItems(req PageRequest) (*Page[MediaItem], error)
+	// SearchMediaItems retrieves a page of the media items in an album
+	SearchMediaItems(albumID string, req PageRequest) (*Page[MediaItem], error)
+	// SearchMediaItemsByFilters retrieves a page of the media items matching filters; results
+	// filtered by date are ordered newest first
+	SearchMediaItemsByFilters(filters SearchFilters, req PageRequest) (*Page[MediaItem], error)
+	// DownloadMediaItem opens the bytes of a media item as described by MediaItem.DownloadURL.
+	// Expired base URLs are refreshed transparently, so items may come from any earlier listing.
+	DownloadMediaItem(item MediaItem, size ImageSize) (io.ReadCloser, error)
+	// BatchCreateMediaItems turns up to MaxBatchMediaItems upload tokens into media items,
+	// optionally adding them to an app-created album
+	BatchCreateMediaItems(albumID string, items []NewMediaItem) ([]NewMediaItemResult, error)
+}
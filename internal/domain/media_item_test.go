@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestDateRange_Contains(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks in New York skipped from 02:00 to 03:00 on 10 March 2024, so that day had 23 hours
+	dates := DateRange{Start: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		loc  *time.Location
+		want bool
+	}{
+		{name: "start of the day", t: time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC), loc: newYork, want: true},
+		{name: "end of the short day", t: time.Date(2024, 3, 11, 3, 59, 0, 0, time.UTC), loc: newYork, want: true},
+		{name: "next day", t: time.Date(2024, 3, 11, 4, 0, 0, 0, time.UTC), loc: newYork, want: false},
+		{name: "previous evening", t: time.Date(2024, 3, 10, 4, 59, 0, 0, time.UTC), loc: newYork, want: false},
+		{name: "same instant in UTC", t: time.Date(2024, 3, 10, 4, 59, 0, 0, time.UTC), loc: time.UTC, want: true},
+		{name: "unknown time", t: time.Time{}, loc: newYork, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dates.Contains(tt.t, tt.loc); got != tt.want {
+				t.Errorf("Expected %v for %s, got %v", tt.want, tt.t, got)
+			}
+		})
+	}
+}
+
+func TestMagicRule_MatchesDate(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	rule := MagicRule{DateRanges: []DateRange{{Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}}
+	eve := time.Date(2023, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	if rule.MatchesDate(eve, time.UTC) {
+		t.Error("Expected New Year's Eve in UTC not to match")
+	}
+	if !rule.MatchesDate(eve, tokyo) {
+		t.Error("Expected New Year's Day in Tokyo to match")
+	}
+	// The rule's own time zone wins over the configured one
+	rule.TimeZone = time.UTC
+	if rule.MatchesDate(eve, tokyo) {
+		t.Error("Expected the rule's time zone to be used")
+	}
+}
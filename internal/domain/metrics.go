@@ -0,0 +1,10 @@
+package domain
+
+import "io"
+
+// Metrics collects the Google Photos API usage of a run, such as requests, retries and bytes
+// uploaded, so long-running deployments can be monitored
+type Metrics interface {
+	// WritePrometheus writes every metric in the Prometheus text exposition format
+	WritePrometheus(w io.Writer) error
+}
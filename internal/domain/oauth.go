@@ -4,6 +4,48 @@ import (
 	"golang.org/x/oauth2"
 )
 
+// AuthFlow selects how the user completes OAuth authorization
+type AuthFlow string
+
+// Supported authorization flows
+const (
+	// AuthFlowAuto picks a flow based on the detected AuthEnvironment
+	AuthFlowAuto AuthFlow = "auto"
+	// AuthFlowBrowser opens the consent page locally and captures the code with a loopback server
+	AuthFlowBrowser AuthFlow = "browser"
+	// AuthFlowPaste prints the consent URL and reads the pasted code or redirect URL from stdin
+	AuthFlowPaste AuthFlow = "paste"
+)
+
+var authFlows = []AuthFlow{AuthFlowAuto, AuthFlowBrowser, AuthFlowPaste}
+
+// ParseAuthFlow converts a case-insensitive name into an AuthFlow
+func ParseAuthFlow(s string) (AuthFlow, error) {
+	return parseEnum("auth flow", s, authFlows)
+}
+
+// String returns the name of the auth flow
+func (f AuthFlow) String() string {
+	return string(f)
+}
+
+// Validate reports whether f is a known auth flow
+func (f AuthFlow) Validate() error {
+	return validateEnum("auth flow", f, authFlows)
+}
+
+// AuthEnvironment describes where the application runs, as far as choosing an auth flow is concerned
+type AuthEnvironment struct {
+	// SSH is set when running inside an SSH session
+	SSH bool
+	// Display is set when a graphical session is available to open a browser in
+	Display bool
+	// Container is set when running inside a container
+	Container bool
+	// InteractiveInput is set when stdin is a terminal the user can paste into
+	InteractiveInput bool
+}
+
 // OAuthService defines the interface for OAuth operations
 type OAuthService interface {
 	GetClient() (*oauth2.Config, error)
@@ -12,4 +54,5 @@ type OAuthService interface {
 	ExchangeCode(code string) (*oauth2.Token, error)
 	GetAuthURL() string
 	GetAuthURLWithState(state string) string
+	SetRedirectURL(redirectURL string)
 }
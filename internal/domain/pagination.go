@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Maximum page sizes accepted by the Google Photos list endpoints
+const (
+	MaxAlbumPageSize     = 50
+	MaxMediaItemPageSize = 100
+)
+
+// PageRequest selects a page of a list. A zero PageSize lets the API choose and an empty
+// PageToken requests the first page.
+type PageRequest struct {
+	PageSize  int
+	PageToken string
+	// Fields asks for a partial response holding only these fields of every item, such as
+	// "id,title,mediaItemsCount"; the others are left zero. The ID is always fetched, as items
+	// are told apart by it. Empty returns whole items.
+	Fields string
+}
+
+// Validate checks the page size against the endpoint's limit and the syntax of the fields
+func (r PageRequest) Validate(maxPageSize int) error {
+	if r.PageSize < 0 || r.PageSize > maxPageSize {
+		return fmt.Errorf("invalid page size %d: must be between 1 and %d, or 0 for the API default", r.PageSize, maxPageSize)
+	}
+	return ValidateFields(r.Fields)
+}
+
+// Next returns the request for the page identified by nextPageToken, keeping the page size and
+// the fields
+func (r PageRequest) Next(nextPageToken string) PageRequest {
+	return PageRequest{
+		PageSize:  r.PageSize,
+		PageToken: nextPageToken,
+		Fields:    r.Fields,
+	}
+}
+
+// ValidateFields checks a partial response selector, a comma-separated list of field names where
+// a/b selects b inside a and a(b,c) selects b and c inside a. Empty selects every field.
+func ValidateFields(fields string) error {
+	if fields == "" {
+		return nil
+	}
+	depth := 0
+	for i, c := range fields {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '*':
+		case c == ',', c == '/', c == '(':
+			if i == 0 || strings.ContainsRune(",/(", rune(fields[i-1])) {
+				return fmt.Errorf("%w: invalid fields %q: missing field name before %q", ErrInvalidArgument, fields, c)
+			}
+			if c == '(' {
+				depth++
+			}
+		case c == ')':
+			if depth == 0 || strings.ContainsRune(",/(", rune(fields[i-1])) {
+				return fmt.Errorf("%w: invalid fields %q: unexpected %q", ErrInvalidArgument, fields, c)
+			}
+			depth--
+		default:
+			return fmt.Errorf("%w: invalid fields %q: unexpected %q", ErrInvalidArgument, fields, c)
+		}
+	}
+	if depth != 0 || strings.ContainsRune(",/", rune(fields[len(fields)-1])) {
+		return fmt.Errorf("%w: invalid fields %q: unbalanced parentheses or trailing separator", ErrInvalidArgument, fields)
+	}
+	return nil
+}
+
+// ListOptions tunes how a list is walked page by page
+type ListOptions struct {
+	// PageSize is the size of every page; 0 uses the largest the endpoint accepts
+	PageSize int
+	// Prefetch requests the next page while the items of the current one are processed, instead
+	// of only once they are done
+	Prefetch bool
+	// Fields asks for partial items as PageRequest.Fields does
+	Fields string
+}
+
+// Page is a single page of a list together with the token of the following page
+type Page[T any] struct {
+	Items         []T
+	NextPageToken string
+}
+
+// HasNext reports whether more pages follow this one
+func (p *Page[T]) HasNext() bool {
+	return p.NextPageToken != ""
+}
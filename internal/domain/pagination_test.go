@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateFields(t *testing.T) {
+	valid := []string{"", "id", "id,title,mediaItemsCount", "mediaMetadata/creationTime", "mediaMetadata(width,height),*"}
+	for _, fields := range valid {
+		if err := ValidateFields(fields); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", fields, err)
+		}
+	}
+
+	invalid := []string{",id", "id,", "id,,title", "a(b", "a)", "a()", "a/", "id title", "id;title"}
+	for _, fields := range invalid {
+		if err := ValidateFields(fields); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("Expected %q to be rejected as an invalid argument, got %v", fields, err)
+		}
+	}
+}
+
+func TestPageRequest_NextKeepsFields(t *testing.T) {
+	req := PageRequest{PageSize: 10, PageToken: "a", Fields: "id"}
+
+	next := req.Next("b")
+
+	if next != (PageRequest{PageSize: 10, PageToken: "b", Fields: "id"}) {
+		t.Errorf("Expected the page size and fields to be kept, got %+v", next)
+	}
+}
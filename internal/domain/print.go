@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PrintSize is a photo print format in inches, named like "4x6"
+type PrintSize struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+// ParsePrintSize converts a size such as "4x6" or "3.5x5" into a PrintSize
+func ParsePrintSize(s string) (PrintSize, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	w, h, ok := strings.Cut(name, "x")
+	if !ok {
+		return PrintSize{}, fmt.Errorf("invalid print size %q: use WIDTHxHEIGHT in inches, e.g. 4x6", s)
+	}
+
+	width, errW := strconv.ParseFloat(w, 64)
+	height, errH := strconv.ParseFloat(h, 64)
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return PrintSize{}, fmt.Errorf("invalid print size %q: use WIDTHxHEIGHT in inches, e.g. 4x6", s)
+	}
+	return PrintSize{Name: name, Width: width, Height: height}, nil
+}
+
+// Oriented returns the print dimensions turned to match a photo of width x height pixels,
+// so landscape photos get landscape prints; square photos count as landscape
+func (p PrintSize) Oriented(width, height int64) (float64, float64) {
+	long, short := max(p.Width, p.Height), min(p.Width, p.Height)
+	if height > width {
+		return short, long
+	}
+	return long, short
+}
+
+// paperSizes are the page formats ParsePaperSize knows by name, in inches
+var paperSizes = map[string]PrintSize{
+	"a3":     {Name: "a3", Width: 11.69, Height: 16.54},
+	"a4":     {Name: "a4", Width: 8.27, Height: 11.69},
+	"a5":     {Name: "a5", Width: 5.83, Height: 8.27},
+	"letter": {Name: "letter", Width: 8.5, Height: 11},
+	"legal":  {Name: "legal", Width: 8.5, Height: 14},
+}
+
+// ParsePaperSize converts a page format such as "a4", "letter" or "8x10" into a PrintSize
+func ParsePaperSize(s string) (PrintSize, error) {
+	if size, ok := paperSizes[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return size, nil
+	}
+	size, err := ParsePrintSize(s)
+	if err != nil {
+		return PrintSize{}, fmt.Errorf("invalid paper size %q: use a3, a4, a5, letter, legal or WIDTHxHEIGHT in inches", s)
+	}
+	return size, nil
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "testing"
+
+func TestPrintSize_Oriented(t *testing.T) {
+	size, err := ParsePrintSize("6x4")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if w, h := size.Oriented(3000, 4000); w != 4 || h != 6 {
+		t.Errorf("Expected a portrait 4x6 for a portrait photo, got %vx%v", w, h)
+	}
+	if _, err := ParsePrintSize("A4"); err == nil {
+		t.Error("Expected a size without dimensions to be rejected")
+	}
+}
+
+func TestParsePaperSize(t *testing.T) {
+	if size, err := ParsePaperSize("A4"); err != nil || size.Width != 8.27 || size.Height != 11.69 {
+		t.Errorf("Expected A4 by name, got %+v, %v", size, err)
+	}
+	if size, err := ParsePaperSize("8x10"); err != nil || size.Width != 8 || size.Height != 10 {
+		t.Errorf("Expected dimensions to be accepted, got %+v, %v", size, err)
+	}
+	if _, err := ParsePaperSize("tabloid"); err == nil {
+		t.Error("Expected an unknown paper size to be rejected")
+	}
+}
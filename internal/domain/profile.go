@@ -0,0 +1,32 @@
+package domain
+
+// DefaultProfileName is the profile used when no other profile has been selected
+const DefaultProfileName = "default"
+
+// Profile represents an isolated account configuration with its own credentials, token and cache
+type Profile struct {
+	Name            string `json:"name"`
+	CredentialsPath string `json:"credentialsPath"`
+	TokenPath       string `json:"tokenPath"`
+	CacheDir        string `json:"cacheDir"`
+	Active          bool   `json:"active"`
+}
+
+// ProfileRepository defines the interface for profile storage
+type ProfileRepository interface {
+	ListProfiles() ([]Profile, error)
+	GetProfile(name string) (*Profile, error)
+	CreateProfile(name string) (*Profile, error)
+	DeleteProfile(name string) error
+	GetActiveProfile() (string, error)
+	SetActiveProfile(name string) error
+}
+
+// ProfileUseCase defines the business logic for profile operations
+type ProfileUseCase interface {
+	ListProfiles() ([]Profile, error)
+	AddProfile(name string) (*Profile, error)
+	SwitchProfile(name string) error
+	RemoveProfile(name string) error
+	ResolveProfile(name string) (*Profile, error)
+}
@@ -0,0 +1,61 @@
+package domain
+
+import "time"
+
+// Kinds of long jobs whose throughput is kept across runs
+const (
+	JobDownload = "download"
+	JobUpload   = "upload"
+	JobBackup   = "backup"
+)
+
+// Throughput is how fast a kind of job gets through its items, smoothed over time. It depends
+// mostly on the connection, so it is kept per kind of job rather than per album or directory.
+type Throughput struct {
+	ItemsPerSecond float64   `json:"itemsPerSecond"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// ThroughputStore persists the throughput of long jobs, so a resumed job estimates its remaining
+// time from the speed it had reached instead of starting over
+type ThroughputStore interface {
+	// LoadThroughput returns the throughput saved for a kind of job, or nil when there is none
+	LoadThroughput(job string) (*Throughput, error)
+	SaveThroughput(job string, throughput Throughput) error
+}
+
+// ProgressUpdate is the state of a long job right after one of its items finished
+type ProgressUpdate struct {
+	// Job is the kind of job, such as JobUpload
+	Job string
+	// Item names the item that finished, such as the path of a file
+	Item string
+	// Failed is set when the item failed and Skipped when there was nothing to do for it
+	Failed  bool
+	Skipped bool
+	// Done counts the finished items out of Total, Failures the failed ones among them
+	Done     int
+	Total    int
+	Failures int
+	// Bytes is the size of the files the finished items sent or wrote
+	Bytes int64
+	// ETA is the estimated remaining time, negative while it is unknown
+	ETA time.Duration
+}
+
+// Progress receives the progress of uploads, downloads and syncs as their items finish. The
+// updates of one job come one at a time, even when its items are worked on concurrently.
+type Progress interface {
+	Update(update ProgressUpdate)
+	// Finish reports that a job ended, also when it was interrupted or had no items
+	Finish(job string)
+}
+
+// NopProgress ignores progress; use cases report to it unless they are given another Progress
+type NopProgress struct{}
+
+// Update implements Progress
+func (NopProgress) Update(ProgressUpdate) {}
+
+// Finish implements Progress
+func (NopProgress) Finish(string) {}
@@ -0,0 +1,63 @@
+package domain
+
+import "regexp"
+
+// Redacted replaces secrets removed from logs, transcripts and debug output
+const Redacted = "[REDACTED]"
+
+// secretPatterns find secrets embedded in free text such as messages, errors and raw API responses
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Authorization headers
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + Redacted},
+	// Google OAuth access tokens, refresh tokens and client secrets
+	{regexp.MustCompile(`\bya29\.[A-Za-z0-9._-]+`), Redacted},
+	{regexp.MustCompile(`\b1//[A-Za-z0-9._-]+`), Redacted},
+	{regexp.MustCompile(`\bGOCSPX-[A-Za-z0-9_-]+`), Redacted},
+	// Secret parameters in URLs, forms, JSON and YAML, such as access_token=... or "client_secret": "..."
+	{regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|id_token|client_secret|api_key|password|token|uploadToken|shareToken|share_token)["']?\s*[:=]\s*["']?)[^\s"'&,}]+`), "${1}" + Redacted},
+	// Query parameters of signed URLs and resumable upload sessions, which work without authorization
+	{regexp.MustCompile(`(?i)([?&](?:upload_id|x-goog-signature|x-goog-credential|signature|sig)=)[^\s"'&]+`), "${1}" + Redacted},
+	// Authorization codes in redirect URLs; JSON "code" fields are status codes worth keeping
+	{regexp.MustCompile(`([?&]code=)[^\s"'&]+`), "${1}" + Redacted},
+	// Base URLs of media items, which grant access to the photo without authorization
+	{regexp.MustCompile(`(https://[a-z0-9.-]*googleusercontent\.com/)[^\s"'\\]+`), "${1}" + Redacted},
+}
+
+// RedactSecrets removes tokens, share tokens, client secrets, authorization codes, signed URL
+// parameters and media base URLs from free text, leaving the rest as it is
+func RedactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// RedactError returns err with the secrets removed from its message; errors.Is and errors.As
+// still see err. Wrap errors of HTTP clients with it, since they quote the URL they failed on.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactSecrets(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError is an error whose message had secrets removed
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Authorization: Bearer abc.def", "Authorization: Bearer [REDACTED]"},
+		{"https://example.test/callback?state=s1&code=4/0Ab", "https://example.test/callback?state=s1&code=[REDACTED]"},
+		{`{"client_secret":"GOCSPX-x1"}`, `{"client_secret":"[REDACTED]"}`},
+		{"GET /v1/sharedAlbums:join?shareToken=AOxyz", "GET /v1/sharedAlbums:join?shareToken=[REDACTED]"},
+		{`{"shareToken": "AOxyz"}`, `{"shareToken": "[REDACTED]"}`},
+		{"PUT https://photoslibrary.googleapis.com/v1/uploads?upload_id=ADPy&upload_protocol=resumable", "PUT https://photoslibrary.googleapis.com/v1/uploads?upload_id=[REDACTED]&upload_protocol=resumable"},
+		{"https://storage.example.test/a.jpg?X-Goog-Expires=900&X-Goog-Signature=9f2c", "https://storage.example.test/a.jpg?X-Goog-Expires=900&X-Goog-Signature=[REDACTED]"},
+		{`{"error": {"code": 403, "status": "PERMISSION_DENIED"}}`, `{"error": {"code": 403, "status": "PERMISSION_DENIED"}}`},
+	}
+	for _, tt := range tests {
+		if got := RedactSecrets(tt.in); got != tt.want {
+			t.Errorf("Expected %q to redact to %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	err := &url.Error{Op: "Get", URL: "https://lh3.googleusercontent.com/lr/AF1Qip=d", Err: context.DeadlineExceeded}
+
+	redacted := RedactError(err)
+	if want := `Get "https://lh3.googleusercontent.com/[REDACTED]": context deadline exceeded`; redacted.Error() != want {
+		t.Errorf("Expected %q, got %q", want, redacted.Error())
+	}
+	if !errors.Is(redacted, context.DeadlineExceeded) {
+		t.Error("Expected the redacted error to wrap the original")
+	}
+
+	plain := errors.New("connection refused")
+	if RedactError(plain) != plain || RedactError(nil) != nil {
+		t.Error("Expected errors without secrets to be returned as they are")
+	}
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ReelClip is a downloaded photo or video that becomes one scene of a highlight reel
+type ReelClip struct {
+	Path  string
+	Video bool
+	// Duration is how long a photo is shown, or where a video is cut off
+	Duration time.Duration
+}
+
+// ReelSpec describes a highlight reel to assemble from clips in order
+type ReelSpec struct {
+	Clips []ReelClip
+	// Width and Height are the frame size; clips are scaled to fit and padded with black
+	Width  int
+	Height int
+	FPS    int
+	// Output is the video file to write
+	Output string
+}
+
+// ReelAssembler turns the clips of a highlight reel into one video file
+type ReelAssembler interface {
+	Assemble(ctx context.Context, spec ReelSpec) error
+}
@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a recurring job runs: every fixed interval, or at the times matching a
+// five-field cron expression
+type Schedule struct {
+	spec  string
+	every time.Duration
+	// fields are the allowed minutes, hours, days of the month, months and days of the week,
+	// as bit sets
+	fields [5]uint64
+	// domAny and dowAny are set when the day of the month or of the week is not restricted
+	domAny, dowAny bool
+}
+
+// cronField is the range of one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronShortcuts are the named schedules cron knows
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSchedule parses "@every DURATION", such as "@every 6h", one of @hourly, @daily,
+// @midnight, @weekly and @monthly, or a cron expression of minute, hour, day of month, month and
+// day of week, such as "0 3 * * *" for every night at three. Cron fields take *, numbers, ranges
+// like 1-5, steps like */15 and lists of those; Sunday is 0 or 7.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Minute {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: @every needs a duration of at least 1m, such as 6h", spec)
+		}
+		return Schedule{spec: spec, every: every}, nil
+	}
+
+	expr := spec
+	if shortcut, ok := cronShortcuts[spec]; ok {
+		expr = shortcut
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: use @every DURATION, @daily or a cron expression of 5 fields", spec)
+	}
+	s := Schedule{spec: spec, domAny: parts[2] == "*", dowAny: parts[4] == "*"}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		s.fields[i] = bits
+	}
+	// Sunday is both 0 and 7
+	if s.fields[4]&(1<<7) != 0 {
+		s.fields[4] |= 1
+	}
+	return s, nil
+}
+
+// parseCronField returns the values allowed by one comma-separated field as a bit set
+func parseCronField(part string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s step %q must be a positive number", field.name, stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := field.min, field.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = cronValue(from, field); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(to, field); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = field.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("%s range %q ends before it starts", field.name, rangePart)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// cronValue parses a single value of field
+func cronValue(s string, field cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("%s %q must be a number from %d to %d", field.name, s, field.min, field.max)
+	}
+	return v, nil
+}
+
+// String returns the schedule as it was written
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// IsZero reports whether the schedule was never parsed
+func (s Schedule) IsZero() bool {
+	return s.spec == ""
+}
+
+// Next returns the first time the schedule fires after t. Cron expressions are matched in the
+// zone of t; the zero time means nothing matches within five years, such as on February 30.
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	if s.spec == "" {
+		return time.Time{}
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.allows(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.allowsDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.allows(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.allows(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// allows reports whether value is allowed by field i
+func (s Schedule) allows(i, value int) bool {
+	return s.fields[i]&(1<<value) != 0
+}
+
+// allowsDay matches the day of t the way cron does: when both the day of the month and the day
+// of the week are restricted, either may match
+func (s Schedule) allowsDay(t time.Time) bool {
+	dom, dow := s.allows(2, t.Day()), s.allows(4, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
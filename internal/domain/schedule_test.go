@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Thursday
+	from := time.Date(2026, 10, 15, 9, 41, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{spec: "@every 6h", want: "2026-10-15 15:41:30"},
+		{spec: "@hourly", want: "2026-10-15 10:00:00"},
+		{spec: "@daily", want: "2026-10-16 00:00:00"},
+		{spec: "0 3 * * *", want: "2026-10-16 03:00:00"},
+		{spec: "*/15 * * * *", want: "2026-10-15 09:45:00"},
+		{spec: "50 9-17 * * 1-5", want: "2026-10-15 09:50:00"},
+		{spec: "0 8 * * 6,7", want: "2026-10-17 08:00:00"},
+		{spec: "@weekly", want: "2026-10-18 00:00:00"},
+		{spec: "@monthly", want: "2026-11-01 00:00:00"},
+		{spec: "0 0 1 1 *", want: "2027-01-01 00:00:00"},
+		// Either day field may match when both are restricted
+		{spec: "0 12 20 * 5", want: "2026-10-16 12:00:00"},
+		{spec: "0 0 30 2 *", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			got := schedule.Next(from)
+			switch {
+			case tt.want == "" && !got.IsZero():
+				t.Errorf("Expected no next run, got %s", got)
+			case tt.want != "" && got.Format(time.DateTime) != tt.want:
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScheduleNextInZone(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	schedule, err := ParseSchedule("0 3 * * *")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got := schedule.Next(time.Date(2026, 10, 15, 21, 0, 0, 0, time.UTC).In(loc))
+
+	if want := time.Date(2026, 10, 16, 3, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "nightly", "@every 10s", "@every soon", "0 3 * *", "60 * * * *", "0 3 * * 8", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
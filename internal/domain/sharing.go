@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"context"
+	"iter"
+)
+
+// ShareInfo holds the sharing state of an album; it is only present for shared albums
+type ShareInfo struct {
+	SharedAlbumOptions SharedAlbumOptions `json:"sharedAlbumOptions"`
+	ShareableURL       string             `json:"shareableUrl,omitempty"`
+	ShareToken         string             `json:"shareToken,omitempty"`
+	IsJoined           bool               `json:"isJoined,omitempty"`
+	IsOwned            bool               `json:"isOwned,omitempty"`
+	IsJoinable         bool               `json:"isJoinable,omitempty"`
+	// ShortURL is a shortened ShareableURL; it is set locally when a URL shortener is configured
+	ShortURL string `json:"shortUrl,omitempty"`
+}
+
+// URLShortener turns long URLs into short links that are easier to text or print
+type URLShortener interface {
+	Shorten(longURL string) (string, error)
+}
+
+// SharedAlbumOptions controls what collaborators can do in a shared album
+type SharedAlbumOptions struct {
+	IsCollaborative bool `json:"isCollaborative,omitempty"`
+	IsCommentable   bool `json:"isCommentable,omitempty"`
+}
+
+// SharedAlbumOptionsUpdate changes some of the share options of an album; nil fields keep their value
+type SharedAlbumOptionsUpdate struct {
+	IsCollaborative *bool
+	IsCommentable   *bool
+}
+
+// IsEmpty reports whether the update changes nothing
+func (u SharedAlbumOptionsUpdate) IsEmpty() bool {
+	return u.IsCollaborative == nil && u.IsCommentable == nil
+}
+
+// Apply returns options with the fields set in u replaced
+func (u SharedAlbumOptionsUpdate) Apply(options SharedAlbumOptions) SharedAlbumOptions {
+	if u.IsCollaborative != nil {
+		options.IsCollaborative = *u.IsCollaborative
+	}
+	if u.IsCommentable != nil {
+		options.IsCommentable = *u.IsCommentable
+	}
+	return options
+}
+
+// SharingRepository defines the interface for album sharing operations.
+// Shared albums are regular albums whose ShareInfo is set.
+type SharingRepository interface {
+	ShareAlbum(albumID string, options SharedAlbumOptions) (*ShareInfo, error)
+	UnshareAlbum(albumID string) error
+	ListSharedAlbums(req PageRequest) (*Page[Album], error)
+	JoinSharedAlbum(shareToken string) (*Album, error)
+	LeaveSharedAlbum(shareToken string) error
+}
+
+// SharingUseCase defines the business logic for album sharing operations
+type SharingUseCase interface {
+	ShareAlbum(albumID string, options SharedAlbumOptions) (*ShareInfo, error)
+	UpdateShareOptions(ctx context.Context, albumID string, update SharedAlbumOptionsUpdate) (*ShareInfo, error)
+	UnshareAlbum(albumID string) error
+	ListSharedAlbums(req PageRequest) (*Page[Album], error)
+	ListAllSharedAlbums(ctx context.Context) ([]Album, error)
+	SharedAlbums(ctx context.Context) iter.Seq2[Album, error]
+	JoinSharedAlbum(shareToken string) (*Album, error)
+	LeaveSharedAlbum(shareToken string) error
+}
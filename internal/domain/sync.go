@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// SyncState is what a profile remembers between sync runs
+type SyncState struct {
+	// Watermark is the creation time of the newest media item seen; incremental runs only
+	// fetch media items created since then
+	Watermark      time.Time `json:"watermark"`
+	LastSyncAt     time.Time `json:"lastSyncAt"`
+	LastFullSyncAt time.Time `json:"lastFullSyncAt"`
+	// Dir is the directory originals were last synced to, empty when only metadata is synced
+	Dir string `json:"dir,omitempty"`
+	// Files maps media item IDs to the names of their originals in Dir
+	Files map[string]string `json:"files,omitempty"`
+	// Checksums maps media item IDs to the SHA-256 of their originals in Dir, taken when they were
+	// downloaded, so later changes to the files can be found
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// SyncStateStore persists the sync state of a profile
+type SyncStateStore interface {
+	// LoadSyncState returns the saved state, or an empty state before the first sync
+	LoadSyncState() (*SyncState, error)
+	SaveSyncState(state SyncState) error
+}
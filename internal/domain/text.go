@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// minTextTermLength is the shortest word kept as a search term; single letters are mostly noise
+// of text recognition
+const minTextTermLength = 2
+
+// DocumentText is the text recognized in a local photo, such as a screenshot, receipt or
+// whiteboard, kept in the local index for text search
+type DocumentText struct {
+	// Path is the file the text was read from
+	Path string `json:"path"`
+	Text string `json:"text"`
+	// ModTime is the modification time of the file when it was read, so unchanged files are skipped
+	ModTime   time.Time `json:"modTime"`
+	IndexedAt time.Time `json:"indexedAt"`
+}
+
+// TextRecognizer reads the text in an image. Formats it cannot read yield ErrUnsupportedFormat.
+type TextRecognizer interface {
+	RecognizeText(ctx context.Context, name string, content io.Reader) (string, error)
+}
+
+// TextIndexRepository keeps recognized text with an index of its words
+type TextIndexRepository interface {
+	// LoadText returns the text stored for path, or nil if there is none
+	LoadText(path string) (*DocumentText, error)
+	// SaveText stores doc, replacing the text stored for its path before
+	SaveText(doc DocumentText) error
+	// SearchText returns the documents holding a word starting with each of terms, as TextTerms
+	// splits them
+	SearchText(terms []string) ([]DocumentText, error)
+	Close() error
+}
+
+// TextTerms splits text into the lowercase words it is searched by, each once, in the order they
+// first appear
+func TextTerms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < minTextTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
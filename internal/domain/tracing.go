@@ -0,0 +1,29 @@
+package domain
+
+import "context"
+
+// Tracer records the operations of a run as spans of a trace, so they can be followed in the
+// tracing system of a larger automation pipeline
+type Tracer interface {
+	// Start begins a span of the operation name, such as "album.list", with attributes given as
+	// alternating keys and values like those of slog. The span is a child of the one started with
+	// ctx, if any, and the returned context carries it for the operations it runs in turn.
+	Start(ctx context.Context, name string, attrs ...any) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	// End finishes the span, marking it failed with err when err is not nil
+	End(err error)
+}
+
+// NopTracer records nothing; use cases trace to it unless they are given another Tracer
+type NopTracer struct{}
+
+// Start implements Tracer
+func (NopTracer) Start(ctx context.Context, _ string, _ ...any) (context.Context, Span) {
+	return ctx, NopTracer{}
+}
+
+// End implements Span
+func (NopTracer) End(error) {}
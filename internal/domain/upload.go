@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// UploadedFile is a local file that watching a folder uploaded, kept in the local index so the
+// file is not uploaded again after a restart, even when it was renamed or moved meanwhile
+type UploadedFile struct {
+	// SHA256 is the hex checksum of the file's content, which identifies it
+	SHA256      string    `json:"sha256"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	MediaItemID string    `json:"mediaItemId"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+// UploadedFileRepository remembers which local files were uploaded, by their content
+type UploadedFileRepository interface {
+	// LoadUploaded returns the record of the file with the checksum sha256, or nil if no such file
+	// was uploaded
+	LoadUploaded(sha256 string) (*UploadedFile, error)
+	// SaveUploaded records file, replacing the record of the same content before
+	SaveUploaded(file UploadedFile) error
+	Close() error
+}
+
+// FolderNotifier tells when the files below a watched folder may have changed, so the folder is
+// only scanned then instead of on a timer
+type FolderNotifier interface {
+	// Changes receives a value after files below the folder were created, written, renamed or
+	// removed; changes in quick succession may be reported once
+	Changes() <-chan struct{}
+	Close() error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	tokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+	userInfoEndpoint  = "https://openidconnect.googleapis.com/v1/userinfo"
+)
+
+// NewGoogleAccountRepository creates a GooglePhotosRepository used to look up the account behind a token.
+// The client must not be authorized itself, since every call passes the token to inspect explicitly.
+func NewGoogleAccountRepository(client *http.Client, opts GooglePhotosOptions) domain.AccountRepository {
+	return &GooglePhotosRepository{
+		client: client,
+		opts:   opts,
+	}
+}
+
+// GetTokenInfo asks Google which scopes an access token carries and when it expires
+func (r *GooglePhotosRepository) GetTokenInfo(accessToken string) (*domain.TokenInfo, error) {
+	resp, err := r.client.Get(tokenInfoEndpoint + "?" + url.Values{"access_token": {accessToken}}.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token info: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTokenInfo(data, r.decoding())
+}
+
+// GetUserInfo retrieves the identity of the account behind an access token; it needs the userinfo scopes
+func (r *GooglePhotosRepository) GetUserInfo(accessToken string) (*domain.UserInfo, error) {
+	req, err := http.NewRequest("GET", userInfoEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUserInfo(data, r.decoding())
+}
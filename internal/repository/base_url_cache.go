@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// baseURLTTL is how long a base URL is trusted after it was fetched. Google documents base URLs
+// as valid for about 60 minutes; the margin covers downloads that take a while to complete.
+const baseURLTTL = 50 * time.Minute
+
+// baseURLEntry is a base URL and when the API returned it
+type baseURLEntry struct {
+	url       string
+	fetchedAt time.Time
+}
+
+// baseURLCache remembers when the base URL of each media item was fetched, so expired URLs can be
+// refreshed before they are used instead of failing with 403
+type baseURLCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]baseURLEntry
+	// refreshing serializes refreshes, so concurrent downloads do not fetch the same URLs twice
+	refreshing sync.Mutex
+}
+
+// newBaseURLCache creates an empty cache trusting base URLs for ttl
+func newBaseURLCache(ttl time.Duration) *baseURLCache {
+	return &baseURLCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]baseURLEntry),
+	}
+}
+
+// record stores the base URLs of items as fetched now
+func (c *baseURLCache) record(items ...domain.MediaItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for _, item := range items {
+		if item.ID != "" && item.BaseURL != "" {
+			c.entries[item.ID] = baseURLEntry{url: item.BaseURL, fetchedAt: now}
+		}
+	}
+}
+
+// fresh returns the base URL of a media item if it was fetched less than ttl ago
+func (c *baseURLCache) fresh(id string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || c.now().Sub(entry.fetchedAt) >= c.ttl {
+		return "", false
+	}
+	return entry.url, true
+}
+
+// invalidate forgets the base URL of a media item, e.g. after the server rejected it
+func (c *baseURLCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// expired returns up to limit IDs other than except whose base URLs have expired. Items listed
+// together expire together, so refreshing them in the same batch saves requests.
+func (c *baseURLCache) expired(limit int, except string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ids []string
+	now := c.now()
+	for id, entry := range c.entries {
+		if len(ids) == limit {
+			break
+		}
+		if id != except && now.Sub(entry.fetchedAt) >= c.ttl {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,610 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultConfigFile is read from the working directory when no config file is given; unlike
+// an explicit file it may be missing
+const DefaultConfigFile = "gpm.yaml"
+
+// configFile is the layout of the YAML config file; JSON works too. Durations are written like
+// "30s" or "10m" and relative paths are relative to the working directory.
+type configFile struct {
+	Dir         string   `yaml:"dir,omitempty"`
+	Credentials string   `yaml:"credentials,omitempty"`
+	Token       string   `yaml:"token,omitempty"`
+	Scopes      []string `yaml:"scopes,omitempty"`
+	Access      []string `yaml:"access,omitempty"`
+	Auth        struct {
+		CallbackAddr string `yaml:"callback_addr,omitempty"`
+		Timeout      string `yaml:"timeout,omitempty"`
+	} `yaml:"auth,omitempty"`
+	API struct {
+		PageSize    *int     `yaml:"page_size,omitempty"`
+		Timeout     string   `yaml:"timeout,omitempty"`
+		DialTimeout string   `yaml:"dial_timeout,omitempty"`
+		TLSTimeout  string   `yaml:"tls_timeout,omitempty"`
+		Proxy       string   `yaml:"proxy,omitempty"`
+		MaxRPS      *float64 `yaml:"max_rps,omitempty"`
+		Burst       int      `yaml:"burst,omitempty"`
+	} `yaml:"api,omitempty"`
+	Workers       int      `yaml:"workers,omitempty"`
+	TimeZone      string   `yaml:"time_zone,omitempty"`
+	FilenameDates []string `yaml:"filename_dates,omitempty"`
+	Output        string   `yaml:"output,omitempty"`
+	Sync          struct {
+		Dir string `yaml:"dir,omitempty"`
+	} `yaml:"sync,omitempty"`
+	Serve struct {
+		Theme string `yaml:"theme,omitempty"`
+		Token string `yaml:"token,omitempty"`
+	} `yaml:"serve,omitempty"`
+	ReadOnlyAlbums []string `yaml:"read_only_albums,omitempty"`
+	Metrics        struct {
+		PushURL string `yaml:"push_url,omitempty"`
+		Job     string `yaml:"job,omitempty"`
+	} `yaml:"metrics,omitempty"`
+	Shortener struct {
+		Provider string `yaml:"provider,omitempty"`
+		URL      string `yaml:"url,omitempty"`
+		APIKey   string `yaml:"api_key,omitempty"`
+	} `yaml:"shortener,omitempty"`
+	Daemon struct {
+		Jobs []configJob `yaml:"jobs,omitempty"`
+	} `yaml:"daemon,omitempty"`
+	Backup struct {
+		Pricing map[string]configPricing `yaml:"pricing,omitempty"`
+	} `yaml:"backup,omitempty"`
+}
+
+// configJob is a job of daemon.jobs, such as {name: sync, schedule: "@every 6h", command: [sync, run]}
+type configJob struct {
+	Name     string   `yaml:"name"`
+	Schedule string   `yaml:"schedule"`
+	Command  []string `yaml:"command,flow"`
+}
+
+// configPricing is an entry of backup.pricing, such as s3: {storage_per_gb_month: 0.023, egress_per_gb: 0.09}
+type configPricing struct {
+	StoragePerGBMonth float64 `yaml:"storage_per_gb_month,omitempty"`
+	EgressPerGB       float64 `yaml:"egress_per_gb,omitempty"`
+	PutPer1000        float64 `yaml:"put_per_1000,omitempty"`
+}
+
+// LoadConfig builds the configuration from the defaults, the config file at path and GPM_*
+// variables looked up with getenv, each overriding the previous. An empty path reads the file
+// named by GPM_CONFIG, or DefaultConfigFile when it exists.
+func LoadConfig(path string, getenv func(string) string) (domain.Config, error) {
+	path, required := configPath(path, getenv)
+	return loadConfig(path, required, getenv)
+}
+
+// LoadConfigFile is LoadConfig without the GPM_* variables other than GPM_CONFIG: the settings
+// kept in the config file, to be changed and saved again without writing the environment into it
+func LoadConfigFile(path string, getenv func(string) string) (domain.Config, error) {
+	path, required := configPath(path, getenv)
+	return loadConfig(path, required, func(string) string { return "" })
+}
+
+// loadConfig applies the config file at path, which may be missing unless required, and the
+// variables of getenv to the defaults
+func loadConfig(path string, required bool, getenv func(string) string) (domain.Config, error) {
+	config := domain.DefaultConfig()
+
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		config.File = path
+		if err := applyConfigFile(&config, path, b); err != nil {
+			return domain.Config{}, invalidConfig{err}
+		}
+	case required || !errors.Is(err, os.ErrNotExist):
+		return domain.Config{}, fmt.Errorf("%w: failed to read config file: %w", domain.ErrInvalidConfig, err)
+	}
+
+	if err := applyConfigEnv(&config, getenv); err != nil {
+		return domain.Config{}, invalidConfig{err}
+	}
+	if len(config.Access) > 0 {
+		config.Scopes = domain.ScopesFor(config.Access)
+	}
+	if err := config.Validate(); err != nil {
+		return domain.Config{}, err
+	}
+	return config, nil
+}
+
+// configPath returns the config file to use: path, else the one named by GPM_CONFIG, else
+// DefaultConfigFile, which unlike the others is not required to exist
+func configPath(path string, getenv func(string) string) (string, bool) {
+	if path == "" {
+		path = getenv("GPM_CONFIG")
+	}
+	if path == "" {
+		return DefaultConfigFile, false
+	}
+	return path, true
+}
+
+// configHeader starts config files written by SaveConfig
+const configHeader = "# Settings of gpm; check changes with 'config validate'\n"
+
+// SaveConfig writes the settings of config that differ from the defaults, along with dir, workers
+// and time_zone, to the config file LoadConfig reads given path and getenv, and returns its name.
+// The file is checked the way LoadConfig does before it replaces the previous one.
+func SaveConfig(path string, getenv func(string) string, config domain.Config) (string, error) {
+	path, _ = configPath(path, getenv)
+	defaults := domain.DefaultConfig()
+
+	file := configFile{
+		Dir:         config.Dir,
+		Credentials: config.CredentialsPath,
+		Token:       config.TokenPath,
+		Workers:     config.Workers,
+		Output:      config.Output,
+	}
+	for _, access := range config.Access {
+		file.Access = append(file.Access, string(access))
+	}
+	if len(config.Access) == 0 && !slices.Equal(config.Scopes, defaults.Scopes) {
+		file.Scopes = config.Scopes
+	}
+	if config.CallbackAddr != defaults.CallbackAddr {
+		file.Auth.CallbackAddr = config.CallbackAddr
+	}
+	if config.AuthTimeout != defaults.AuthTimeout {
+		file.Auth.Timeout = config.AuthTimeout.String()
+	}
+	if config.PageSize != 0 {
+		file.API.PageSize = &config.PageSize
+	}
+	if config.HTTPTimeout != 0 {
+		file.API.Timeout = config.HTTPTimeout.String()
+	}
+	if config.DialTimeout != 0 {
+		file.API.DialTimeout = config.DialTimeout.String()
+	}
+	if config.TLSTimeout != 0 {
+		file.API.TLSTimeout = config.TLSTimeout.String()
+	}
+	file.API.Proxy = config.Proxy
+	if config.MaxRPS != defaults.MaxRPS {
+		file.API.MaxRPS = &config.MaxRPS
+	}
+	if config.Burst != defaults.Burst {
+		file.API.Burst = config.Burst
+	}
+	if config.TimeZone != nil {
+		file.TimeZone = config.TimeZone.String()
+	}
+	patterns := make([]string, len(config.FilenameDates))
+	for i, rule := range config.FilenameDates {
+		patterns[i] = rule.String()
+	}
+	if !slices.Equal(patterns, domain.DefaultFilenameDatePatterns) {
+		file.FilenameDates = patterns
+	}
+	file.Sync.Dir = config.SyncDir
+	file.Serve.Theme = config.ServeTheme
+	file.Serve.Token = config.ServeToken
+	file.ReadOnlyAlbums = config.ReadOnlyAlbums
+	file.Metrics.PushURL = config.MetricsPushURL
+	if config.MetricsJob != defaults.MetricsJob {
+		file.Metrics.Job = config.MetricsJob
+	}
+	file.Shortener.Provider = config.Shortener
+	file.Shortener.URL = config.ShortenerURL
+	file.Shortener.APIKey = config.ShortenerAPIKey
+	for _, job := range config.DaemonJobs {
+		file.Daemon.Jobs = append(file.Daemon.Jobs, configJob{Name: job.Name, Schedule: job.Schedule.String(), Command: job.Command})
+	}
+	for scheme, pricing := range config.BackupPricing {
+		if file.Backup.Pricing == nil {
+			file.Backup.Pricing = make(map[string]configPricing)
+		}
+		file.Backup.Pricing[scheme] = configPricing(pricing)
+	}
+
+	b, err := yaml.Marshal(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %v", err)
+	}
+	b = append([]byte(configHeader), b...)
+
+	check := domain.DefaultConfig()
+	if err := applyConfigFile(&check, path, b); err != nil {
+		return "", invalidConfig{err}
+	}
+	if err := check.Validate(); err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return "", fmt.Errorf("failed to save config: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to save config: %v", err)
+	}
+	return path, nil
+}
+
+// invalidConfig marks a problem of the config file or the GPM_* variables as domain.ErrInvalidConfig,
+// keeping its message: the problems of a file are reported one per line
+type invalidConfig struct{ error }
+
+func (e invalidConfig) Unwrap() []error { return []error{domain.ErrInvalidConfig, e.error} }
+
+// applyConfigFile overrides config with the settings present in the config file read from path.
+// Rather than stopping at the first problem it reports every unknown or repeated key and every
+// invalid value, each as "path:line: problem".
+func applyConfigFile(config *domain.Config, path string, b []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	type problem struct {
+		line int
+		err  error
+	}
+	var problems []problem
+	report := func(line int, err error) {
+		if err != nil {
+			problems = append(problems, problem{line, err})
+		}
+	}
+
+	// Unknown and repeated keys are dropped once reported, so the rest can still be checked
+	var file configFile
+	if len(root.Content) > 0 {
+		checkKeys(root.Content[0], reflect.TypeOf(file), "", report)
+		if err := root.Decode(&file); err != nil {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return fmt.Errorf("failed to parse config file %s: %v", path, err)
+			}
+			for _, msg := range typeErr.Errors {
+				report(parseYAMLError(msg))
+			}
+		}
+	}
+
+	setString(&config.Dir, file.Dir)
+	setString(&config.CredentialsPath, file.Credentials)
+	setString(&config.TokenPath, file.Token)
+	if len(file.Scopes) > 0 {
+		config.Scopes = file.Scopes
+	}
+	if len(file.Scopes) > 0 && len(file.Access) > 0 {
+		report(nodeLine(&root, "access"), errors.New("access and scopes cannot both be set, access picks the scopes"))
+	}
+	for i, name := range file.Access {
+		access, err := domain.ParseAccess(name)
+		if err != nil {
+			report(nodeLine(&root, "access", strconv.Itoa(i)), fmt.Errorf("access: %v", err))
+			continue
+		}
+		config.Access = append(config.Access, access)
+	}
+	setString(&config.CallbackAddr, file.Auth.CallbackAddr)
+	report(nodeLine(&root, "auth", "timeout"), setDuration(&config.AuthTimeout, "auth.timeout", file.Auth.Timeout))
+	if file.API.PageSize != nil {
+		config.PageSize = *file.API.PageSize
+	}
+	report(nodeLine(&root, "api", "timeout"), setDuration(&config.HTTPTimeout, "api.timeout", file.API.Timeout))
+	report(nodeLine(&root, "api", "dial_timeout"), setDuration(&config.DialTimeout, "api.dial_timeout", file.API.DialTimeout))
+	report(nodeLine(&root, "api", "tls_timeout"), setDuration(&config.TLSTimeout, "api.tls_timeout", file.API.TLSTimeout))
+	if file.API.Proxy != "" {
+		if _, err := domain.ParseProxyURL(file.API.Proxy); err != nil {
+			report(nodeLine(&root, "api", "proxy"), fmt.Errorf("api.proxy: %v", err))
+		}
+		config.Proxy = file.API.Proxy
+	}
+	if file.API.MaxRPS != nil {
+		config.MaxRPS = *file.API.MaxRPS
+	}
+	if file.API.Burst != 0 {
+		config.Burst = file.API.Burst
+	}
+	if file.Workers != 0 {
+		config.Workers = file.Workers
+	}
+	report(nodeLine(&root, "time_zone"), setTimeZone(&config.TimeZone, "time_zone", file.TimeZone))
+
+	rules := make([]domain.FilenameDateRule, 0, len(file.FilenameDates))
+	for i, pattern := range file.FilenameDates {
+		rule, err := domain.NewFilenameDateRule(pattern)
+		if err != nil {
+			report(nodeLine(&root, "filename_dates", strconv.Itoa(i)), fmt.Errorf("filename_dates: %v", err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) > 0 {
+		config.FilenameDates = rules
+	}
+	setString(&config.Output, file.Output)
+	setString(&config.SyncDir, file.Sync.Dir)
+	setString(&config.ServeTheme, file.Serve.Theme)
+	setString(&config.ServeToken, file.Serve.Token)
+	for i, id := range file.ReadOnlyAlbums {
+		if strings.TrimSpace(id) == "" {
+			report(nodeLine(&root, "read_only_albums", strconv.Itoa(i)), errors.New("read_only_albums: album ID must not be empty"))
+			continue
+		}
+		config.ReadOnlyAlbums = append(config.ReadOnlyAlbums, id)
+	}
+	setString(&config.MetricsPushURL, file.Metrics.PushURL)
+	setString(&config.MetricsJob, file.Metrics.Job)
+	setString(&config.Shortener, file.Shortener.Provider)
+	setString(&config.ShortenerURL, file.Shortener.URL)
+	setString(&config.ShortenerAPIKey, file.Shortener.APIKey)
+	for i, job := range file.Daemon.Jobs {
+		schedule, err := domain.ParseSchedule(job.Schedule)
+		if err != nil {
+			report(nodeLine(&root, "daemon", "jobs", strconv.Itoa(i), "schedule"), fmt.Errorf("daemon.jobs: %v", err))
+			continue
+		}
+		daemonJob := domain.DaemonJob{Name: job.Name, Schedule: schedule, Command: job.Command}
+		if err := daemonJob.Validate(); err != nil {
+			report(nodeLine(&root, "daemon", "jobs", strconv.Itoa(i)), fmt.Errorf("daemon.jobs: %v", err))
+			continue
+		}
+		config.DaemonJobs = append(config.DaemonJobs, daemonJob)
+	}
+	for _, scheme := range slices.Sorted(maps.Keys(file.Backup.Pricing)) {
+		line := nodeLine(&root, "backup", "pricing", scheme)
+		if !slices.Contains(domain.BackupSchemes, scheme) {
+			report(line, fmt.Errorf("backup.pricing: unknown target scheme %q, expected %s", scheme, strings.Join(domain.BackupSchemes, " or ")))
+			continue
+		}
+		pricing := domain.BackupPricing(file.Backup.Pricing[scheme])
+		if err := pricing.Validate(); err != nil {
+			report(line, fmt.Errorf("backup.pricing.%s: %v", scheme, err))
+			continue
+		}
+		if config.BackupPricing == nil {
+			config.BackupPricing = make(map[string]domain.BackupPricing)
+		}
+		config.BackupPricing[scheme] = pricing
+	}
+
+	slices.SortStableFunc(problems, func(a, b problem) int { return cmp.Compare(a.line, b.line) })
+	errs := make([]error, len(problems))
+	for i, p := range problems {
+		errs[i] = fmt.Errorf("%s:%d: %v", path, p.line, p.err)
+	}
+	return errors.Join(errs...)
+}
+
+// checkKeys reports the unknown and repeated keys of a mapping decoded into a struct of type t,
+// and of the mappings nested in it or in its lists and maps, then removes them from the mapping
+func checkKeys(node *yaml.Node, t reflect.Type, prefix string, report func(int, error)) {
+	if node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice {
+		for i, item := range node.Content {
+			checkKeys(item, t.Elem(), prefix+strconv.Itoa(i)+".", report)
+		}
+		return
+	}
+	if node.Kind == yaml.MappingNode && t.Kind() == reflect.Map {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKeys(node.Content[i+1], t.Elem(), prefix+node.Content[i].Value+".", report)
+		}
+		return
+	}
+	if node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct {
+		return
+	}
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		fields[name] = t.Field(i).Type
+	}
+
+	seen := make(map[string]int)
+	content := node.Content[:0]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		fieldType, known := fields[key.Value]
+		line, repeated := seen[key.Value]
+		switch {
+		case !known:
+			report(key.Line, fmt.Errorf("unknown key %q", prefix+key.Value))
+		case repeated:
+			report(key.Line, fmt.Errorf("key %q is repeated, it is already set on line %d", prefix+key.Value, line))
+		default:
+			seen[key.Value] = key.Line
+			checkKeys(value, fieldType, prefix+key.Value+".", report)
+			content = append(content, key, value)
+		}
+	}
+	node.Content = content
+}
+
+// yamlErrorPattern splits the errors of yaml.TypeError, such as "line 3: cannot unmarshal !!str
+// `many` into int", into their line, the value and the type it should have had
+var yamlErrorPattern = regexp.MustCompile(`^line (\d+): (?:cannot unmarshal !!\w+ (.*) into \*?(\S+)|(.*))$`)
+
+// parseYAMLError returns the line and message of an error of yaml.TypeError
+func parseYAMLError(msg string) (int, error) {
+	m := yamlErrorPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return 0, errors.New(msg)
+	}
+	line, _ := strconv.Atoi(m[1])
+	if m[4] != "" {
+		return line, errors.New(m[4])
+	}
+	return line, fmt.Errorf("expected %s, got %s", cmp.Or(yamlTypeNames[m[3]], m[3]), m[2])
+}
+
+// yamlTypeNames describe the Go types of configFile in config file terms
+var yamlTypeNames = map[string]string{
+	"int":      "a number",
+	"float64":  "a number",
+	"string":   "a string",
+	"[]string": "a list of strings",
+}
+
+// nodeLine returns the line of the value found by following keys, or indexes of sequences, from
+// the root of a YAML document; it is 0 when there is no such value
+func nodeLine(root *yaml.Node, path ...string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, key := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return 0
+		}
+		node = next
+	}
+	return node.Line
+}
+
+// applyConfigEnv overrides config with the GPM_* variables that are set. GPM_SCOPES, GPM_ACCESS
+// and GPM_READ_ONLY_ALBUMS separate their values with spaces or commas; GPM_SCOPES and
+// GPM_ACCESS each replace access from the file. The PHOTOS_SHORTENER* names of the URL shortener
+// settings from before the config file are still read when their GPM_* variables are not set.
+func applyConfigEnv(config *domain.Config, getenv func(string) string) error {
+	setString(&config.Dir, getenv("GPM_DIR"))
+	setString(&config.CredentialsPath, getenv("GPM_CREDENTIALS"))
+	setString(&config.TokenPath, getenv("GPM_TOKEN"))
+	if scopes := strings.FieldsFunc(getenv("GPM_SCOPES"), func(r rune) bool { return r == ',' || r == ' ' }); len(scopes) > 0 {
+		config.Scopes = scopes
+		config.Access = nil
+	}
+	access, err := domain.ParseAccesses(getenv("GPM_ACCESS"))
+	if err != nil {
+		return fmt.Errorf("GPM_ACCESS: %v", err)
+	}
+	if len(access) > 0 {
+		config.Access = access
+	}
+	setString(&config.CallbackAddr, getenv("GPM_AUTH_CALLBACK_ADDR"))
+	if err := setDuration(&config.AuthTimeout, "GPM_AUTH_TIMEOUT", getenv("GPM_AUTH_TIMEOUT")); err != nil {
+		return err
+	}
+	if err := setInt(&config.PageSize, "GPM_API_PAGE_SIZE", getenv("GPM_API_PAGE_SIZE")); err != nil {
+		return err
+	}
+	if err := setDuration(&config.HTTPTimeout, "GPM_API_TIMEOUT", getenv("GPM_API_TIMEOUT")); err != nil {
+		return err
+	}
+	if err := setDuration(&config.DialTimeout, "GPM_API_DIAL_TIMEOUT", getenv("GPM_API_DIAL_TIMEOUT")); err != nil {
+		return err
+	}
+	if err := setDuration(&config.TLSTimeout, "GPM_API_TLS_TIMEOUT", getenv("GPM_API_TLS_TIMEOUT")); err != nil {
+		return err
+	}
+	setString(&config.Proxy, getenv("GPM_API_PROXY"))
+	if err := setFloat(&config.MaxRPS, "GPM_API_MAX_RPS", getenv("GPM_API_MAX_RPS")); err != nil {
+		return err
+	}
+	if err := setInt(&config.Burst, "GPM_API_BURST", getenv("GPM_API_BURST")); err != nil {
+		return err
+	}
+	if err := setInt(&config.Workers, "GPM_WORKERS", getenv("GPM_WORKERS")); err != nil {
+		return err
+	}
+	setString(&config.Output, getenv("GPM_OUTPUT"))
+	setString(&config.SyncDir, getenv("GPM_SYNC_DIR"))
+	setString(&config.ServeTheme, getenv("GPM_SERVE_THEME"))
+	setString(&config.ServeToken, getenv("GPM_SERVE_TOKEN"))
+	setString(&config.MetricsPushURL, getenv("GPM_METRICS_PUSH_URL"))
+	setString(&config.MetricsJob, getenv("GPM_METRICS_JOB"))
+	setString(&config.Shortener, cmp.Or(getenv("GPM_SHORTENER"), getenv("PHOTOS_SHORTENER")))
+	setString(&config.ShortenerURL, cmp.Or(getenv("GPM_SHORTENER_URL"), getenv("PHOTOS_SHORTENER_URL")))
+	setString(&config.ShortenerAPIKey, cmp.Or(getenv("GPM_SHORTENER_API_KEY"), getenv("PHOTOS_SHORTENER_API_KEY")))
+	if albums := strings.FieldsFunc(getenv("GPM_READ_ONLY_ALBUMS"), func(r rune) bool { return r == ',' || r == ' ' }); len(albums) > 0 {
+		config.ReadOnlyAlbums = albums
+	}
+	return setTimeZone(&config.TimeZone, "GPM_TIME_ZONE", getenv("GPM_TIME_ZONE"))
+}
+
+// setString replaces *dst with value unless value is empty
+func setString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// setDuration parses value into *dst unless value is empty
+func setDuration(dst *time.Duration, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: use a duration such as 30s or 10m", name, value)
+	}
+	*dst = d
+	return nil
+}
+
+// setTimeZone loads the IANA time zone, "UTC" or "Local" named by value into *dst unless value is empty
+func setTimeZone(dst **time.Location, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: use an IANA time zone such as Europe/Berlin, UTC or Local", name, value)
+	}
+	*dst = loc
+	return nil
+}
+
+// setFloat parses value into *dst unless value is empty
+func setFloat(dst *float64, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: not a number", name, value)
+	}
+	*dst = f
+	return nil
+}
+
+// setInt parses value into *dst unless value is empty
+func setInt(dst *int, name, value string) error {
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: not a number", name, value)
+	}
+	*dst = n
+	return nil
+}
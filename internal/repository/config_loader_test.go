@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// env returns a getenv function backed by vars
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpm.yaml")
+	file := `
+dir: /srv/photos
+credentials: /etc/gpm/credentials.json
+scopes:
+  - https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata
+auth:
+  callback_addr: localhost:9090
+  timeout: 2m
+api:
+  page_size: 25
+  timeout: 30s
+  dial_timeout: 5s
+  proxy: http://proxy.lan:3128
+  max_rps: 2.5
+  burst: 5
+workers: 8
+time_zone: Europe/Berlin
+filename_dates:
+  - 'scan-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})'
+read_only_albums: [AB1]
+serve:
+  theme: /etc/gpm/theme
+metrics:
+  push_url: http://pushgateway:9091
+shortener:
+  provider: shlink
+  url: https://s.example.com
+daemon:
+  jobs:
+    - name: sync
+      schedule: "@every 6h"
+      command: [sync, run]
+backup:
+  pricing:
+    s3: {storage_per_gb_month: 0.006, egress_per_gb: 0.01, put_per_1000: 0.004}
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path, env(map[string]string{"GPM_WORKERS": "2", "GPM_TOKEN": "/run/token.json", "GPM_READ_ONLY_ALBUMS": "AB2, AB3", "GPM_METRICS_JOB": "gpm-nas", "GPM_API_TLS_TIMEOUT": "3s",
+		"GPM_SHORTENER_URL": "https://sho.rt", "PHOTOS_SHORTENER_API_KEY": "key", "GPM_SERVE_TOKEN": "s3cret"}))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := domain.Config{
+		File:            path,
+		Dir:             "/srv/photos",
+		CredentialsPath: "/etc/gpm/credentials.json",
+		TokenPath:       "/run/token.json",
+		Scopes:          []string{"https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata"},
+		CallbackAddr:    "localhost:9090",
+		AuthTimeout:     2 * time.Minute,
+		PageSize:        25,
+		HTTPTimeout:     30 * time.Second,
+		DialTimeout:     5 * time.Second,
+		TLSTimeout:      3 * time.Second,
+		Proxy:           "http://proxy.lan:3128",
+		MaxRPS:          2.5,
+		Burst:           5,
+		Workers:         2,
+		ReadOnlyAlbums:  []string{"AB2", "AB3"},
+		MetricsPushURL:  "http://pushgateway:9091",
+		MetricsJob:      "gpm-nas",
+		ServeTheme:      "/etc/gpm/theme",
+		ServeToken:      "s3cret",
+		Shortener:       "shlink",
+		ShortenerURL:    "https://sho.rt",
+		ShortenerAPIKey: "key",
+		BackupPricing:   map[string]domain.BackupPricing{"s3": {StoragePerGBMonth: 0.006, EgressPerGB: 0.01, PutPer1000: 0.004}},
+	}
+	schedule, _ := domain.ParseSchedule("@every 6h")
+	want.DaemonJobs = []domain.DaemonJob{{Name: "sync", Schedule: schedule, Command: []string{"sync", "run"}}}
+	if config.TimeZone.String() != "Europe/Berlin" {
+		t.Errorf("Expected time zone Europe/Berlin, got %v", config.TimeZone)
+	}
+	if len(config.FilenameDates) != 1 || config.FilenameDates[0].String() != `scan-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})` {
+		t.Errorf("Expected the file name date pattern of the file, got %v", config.FilenameDates)
+	}
+	config.TimeZone, config.FilenameDates = nil, nil
+	// Environment variables override the file
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Expected %+v, got %+v", want, config)
+	}
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// A missing default file is fine, GPM_CONFIG and explicit paths must exist
+	config, err := LoadConfig("", env(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config.Dir != "." || config.CallbackAddr != "localhost:8080" || config.Workers != 4 || len(config.Scopes) != len(domain.DefaultScopes) || config.TimeZone != time.Local ||
+		len(config.FilenameDates) != len(domain.DefaultFilenameDatePatterns) {
+		t.Errorf("Expected the defaults, got %+v", config)
+	}
+	if _, err := LoadConfig("", env(map[string]string{"GPM_CONFIG": "missing.yaml"})); err == nil {
+		t.Error("Expected an error for a missing GPM_CONFIG file")
+	}
+
+	config, err = LoadConfig("", env(map[string]string{"GPM_SCOPES": "a, b c"}))
+	if err != nil || strings.Join(config.Scopes, " ") != "a b c" {
+		t.Errorf("Expected scopes split on commas and spaces, got %v (%v)", config.Scopes, err)
+	}
+}
+
+func TestLoadConfig_Access(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpm.yaml")
+	if err := os.WriteFile(path, []byte("access: [upload, read]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path, env(nil))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []string{domain.ScopeReadAppCreated, domain.ScopeAppendOnly, domain.ScopeUserInfoEmail, domain.ScopeUserInfoProfile}
+	if !reflect.DeepEqual(config.Scopes, want) {
+		t.Errorf("Expected only the scopes of read and upload, got %v", config.Scopes)
+	}
+
+	// Environment variables replace the access of the file, GPM_SCOPES by giving the scopes directly
+	config, err = LoadConfig(path, env(map[string]string{"GPM_ACCESS": "share"}))
+	if err != nil || !reflect.DeepEqual(config.Scopes, []string{domain.ScopeSharing, domain.ScopeUserInfoEmail, domain.ScopeUserInfoProfile}) {
+		t.Errorf("Expected the scopes of GPM_ACCESS, got %v (%v)", config.Scopes, err)
+	}
+	config, err = LoadConfig(path, env(map[string]string{"GPM_SCOPES": "a"}))
+	if err != nil || config.Access != nil || strings.Join(config.Scopes, " ") != "a" {
+		t.Errorf("Expected the scopes of GPM_SCOPES, got %v %v (%v)", config.Access, config.Scopes, err)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		file string
+		env  map[string]string
+		want string
+	}{
+		{file: "workers: 4\nverbose: true\n", want: `gpm.yaml:2: unknown key "verbose"`},
+		{file: "auth:\n  timeout: soon\n", want: "invalid auth.timeout"},
+		{file: "api:\n  page_size: 500\n", want: "page size must be between 0 and 100"},
+		{file: "workers: 0\n", env: map[string]string{"GPM_WORKERS": "-1"}, want: "workers must be at least 1"},
+		{file: "", env: map[string]string{"GPM_API_TIMEOUT": "30"}, want: "invalid GPM_API_TIMEOUT"},
+		{file: "api:\n  max_rps: -1\n", want: "max requests a second must not be negative"},
+		{file: "", env: map[string]string{"GPM_API_MAX_RPS": "fast"}, want: "invalid GPM_API_MAX_RPS"},
+		{file: "time_zone: Mars/Olympus\n", want: "invalid time_zone"},
+		{file: "filename_dates: ['(?P<year>\\d{4})']\n", want: `filename_dates: invalid file name date pattern`},
+		{file: "credentials: gpm.json\n", env: map[string]string{"GPM_TOKEN": "gpm.json"}, want: "would overwrite the client secrets"},
+		{file: "access: [read, delete]\n", want: `gpm.yaml:1: access: invalid access "delete"`},
+		{file: "scopes: [a]\naccess: [read]\n", want: "gpm.yaml:2: access and scopes cannot both be set"},
+		{file: "", env: map[string]string{"GPM_ACCESS": "read,all"}, want: `GPM_ACCESS: invalid access "all"`},
+		{file: "metrics:\n  push_url: pushgateway:9091\n", want: "metrics push URL must start with http:// or https://"},
+		{file: "shortener:\n  provider: bitly\n  url: https://bit.ly\n", want: `URL shortener must be shlink or kutt, got "bitly"`},
+		{file: "", env: map[string]string{"GPM_SHORTENER": "kutt"}, want: "URL shortener kutt needs the URL of the server"},
+		{file: "read_only_albums: [AB1, '']\n", want: "gpm.yaml:1: read_only_albums: album ID must not be empty"},
+		{file: "api:\n  proxy: ftp://proxy.lan\n", want: `gpm.yaml:2: api.proxy: invalid proxy URL "ftp://proxy.lan": scheme must be http, https or socks5`},
+		{file: "", env: map[string]string{"GPM_API_PROXY": "proxy.lan:3128"}, want: "invalid config: invalid proxy URL"},
+		{file: "api:\n  dial_timeout: -1s\n", want: "API dial timeout must not be negative"},
+		{file: "daemon:\n  jobs:\n    - {name: sync, schedule: nightly, command: [sync, run]}\n", want: `gpm.yaml:3: daemon.jobs: invalid schedule "nightly"`},
+		{file: "daemon:\n  jobs:\n    - name: sync\n      every: 6h\n", want: `gpm.yaml:4: unknown key "daemon.jobs.0.every"`},
+		{file: "daemon:\n  jobs:\n    - {name: sync, schedule: '@daily'}\n", want: "gpm.yaml:3: daemon.jobs: job sync has no command"},
+		{file: "daemon:\n  jobs:\n    - {name: a, schedule: '@daily', command: [sync, run]}\n    - {name: a, schedule: '@hourly', command: [index, update]}\n", want: "several daemon jobs named a"},
+		{file: "backup:\n  pricing:\n    b2: {storage_per_gb_month: 0.006}\n", want: `gpm.yaml:3: backup.pricing: unknown target scheme "b2", expected s3 or gs`},
+		{file: "backup:\n  pricing:\n    gs: {egress_per_gb: -0.1}\n", want: "gpm.yaml:3: backup.pricing.gs: prices must not be negative"},
+		{file: "backup:\n  pricing:\n    s3: {storage: 0.02}\n", want: `gpm.yaml:3: unknown key "backup.pricing.s3.storage"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gpm.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadConfig(path, env(tt.env))
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ReportsEveryProblem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpm.yaml")
+	file := `workers: 2
+auth:
+  timeout: soon
+  callbak_addr: localhost:9090
+workers: 3
+api:
+  page_size: many
+filename_dates:
+  - '(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})'
+  - '(?P<year>\d{4})'
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(path, env(nil))
+
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	want := []string{
+		path + `:3: invalid auth.timeout "soon": use a duration such as 30s or 10m`,
+		path + `:4: unknown key "auth.callbak_addr"`,
+		path + `:5: key "workers" is repeated, it is already set on line 1`,
+		path + ":7: expected a number, got `many`",
+		path + `:10: filename_dates: invalid file name date pattern "(?P<year>\\d{4})": the named group "month" is missing`,
+	}
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), err)
+	}
+	if !errors.Is(err, domain.ErrInvalidConfig) {
+		t.Errorf("Expected an invalid config error, got %v", err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	schema := ConfigSchema()
+
+	// Every key of the config file is described, nested ones included
+	var check func(typ reflect.Type, properties map[string]any, prefix string)
+	check = func(typ reflect.Type, properties map[string]any, prefix string) {
+		for i := range typ.NumField() {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("yaml"), ",")
+			property, ok := properties[name].(map[string]any)
+			if !ok {
+				t.Errorf("Expected %s%s in the schema", prefix, name)
+				continue
+			}
+			if description, _ := property["description"].(string); description == "" {
+				t.Errorf("Expected %s%s to be described", prefix, name)
+			}
+			if nested, ok := property["properties"].(map[string]any); ok {
+				check(typ.Field(i).Type, nested, prefix+name+".")
+			}
+		}
+		if len(properties) != typ.NumField() {
+			t.Errorf("Expected %d properties in %s, got %d", typ.NumField(), cmp.Or(prefix, "the schema"), len(properties))
+		}
+	}
+	check(reflect.TypeOf(configFile{}), schema["properties"].(map[string]any), "")
+
+	pattern := regexp.MustCompile(durationSchema["pattern"].(string))
+	for _, d := range []string{"30s", "1h30m", "1.5h", "0", "-2m"} {
+		if !pattern.MatchString(d) {
+			t.Errorf("Expected %q to match the duration pattern", d)
+		}
+	}
+	if pattern.MatchString("10 minutes") {
+		t.Error("Expected \"10 minutes\" not to match the duration pattern")
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := domain.DefaultConfig()
+	config.Dir, config.CredentialsPath, config.Workers, config.TimeZone = "photos", "client.json", 8, berlin
+	config.Output, config.SyncDir, config.ServeTheme = "json", "originals", "theme"
+	config.Shortener, config.ShortenerURL = "kutt", "https://kutt.lan"
+	schedule, _ := domain.ParseSchedule("0 3 * * *")
+	config.DaemonJobs = []domain.DaemonJob{{Name: "magic", Schedule: schedule, Command: []string{"magic", "apply", "--config", "rules.yaml"}}}
+	config.BackupPricing = map[string]domain.BackupPricing{"gs": {StoragePerGBMonth: 0.02, EgressPerGB: 0.12}}
+
+	// Without --config and GPM_CONFIG the default file is written
+	path, err := SaveConfig("", env(nil), config)
+	if err != nil || path != DefaultConfigFile {
+		t.Fatalf("Expected %s to be written, got %q (%v)", DefaultConfigFile, path, err)
+	}
+
+	loaded, err := LoadConfig("", env(nil))
+	if err != nil {
+		t.Fatalf("Expected the saved config to load, got %v", err)
+	}
+	config.File = DefaultConfigFile
+	if loaded.TimeZone.String() != "Europe/Berlin" || len(loaded.FilenameDates) != len(domain.DefaultFilenameDatePatterns) {
+		t.Errorf("Expected the time zone and default patterns, got %+v", loaded)
+	}
+	loaded.TimeZone, loaded.FilenameDates, config.TimeZone, config.FilenameDates = nil, nil, nil, nil
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("Expected %+v, got %+v", config, loaded)
+	}
+
+	// Defaults are left out so later versions can change them
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "auth:") || strings.Contains(string(b), "scopes:") || !strings.HasPrefix(string(b), configHeader) {
+		t.Errorf("Expected only the chosen settings, got\n%s", b)
+	}
+
+	config.Access = []domain.Access{domain.AccessRead}
+	config.Scopes = domain.ScopesFor(config.Access)
+	if _, err := SaveConfig("", env(nil), config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if b, _ := os.ReadFile(path); !strings.Contains(string(b), "access:\n    - read\n") || strings.Contains(string(b), "scopes:") {
+		t.Errorf("Expected access instead of the scopes it picks, got\n%s", b)
+	}
+
+	config.Output = "xml"
+	if _, err := SaveConfig("", env(nil), config); err == nil || !strings.Contains(err.Error(), "output must be") {
+		t.Errorf("Expected an invalid config to be refused, got %v", err)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	vars := map[string]string{"GPM_WORKERS": "2", "GPM_SERVE_TOKEN": "secret"}
+
+	// Without a config file the defaults are loaded
+	config, err := LoadConfigFile("", env(vars))
+	if err != nil || !reflect.DeepEqual(config, domain.DefaultConfig()) {
+		t.Errorf("Expected the defaults, got %+v (%v)", config, err)
+	}
+
+	if err := os.WriteFile("gpm.yaml", []byte("workers: 8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vars["GPM_CONFIG"] = "gpm.yaml"
+	config, err = LoadConfigFile("", env(vars))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config.File != "gpm.yaml" || config.Workers != 8 || config.ServeToken != "" {
+		t.Errorf("Expected only the settings of the file, got %+v", config)
+	}
+}
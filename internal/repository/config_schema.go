@@ -0,0 +1,154 @@
+package repository
+
+import "maps"
+
+// durationSchema matches the durations of time.ParseDuration, such as "30s" or "1h30m"
+var durationSchema = map[string]any{
+	"type":    "string",
+	"pattern": `^[-+]?(0|([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+$`,
+}
+
+// ConfigSchema describes the config file read by LoadConfig as a JSON Schema, for editors that
+// check and complete YAML files. Checks that depend on the system, such as whether a time zone
+// is known, are left to LoadConfig.
+func ConfigSchema() map[string]any {
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Google Photos Magic config",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"dir":         describe(map[string]any{"type": "string", "minLength": 1}, "Directory holding the default profile, named profiles and their caches"),
+			"credentials": describe(map[string]any{"type": "string"}, "OAuth client secrets file; defaults to credentials.json in dir"),
+			"token":       describe(map[string]any{"type": "string"}, "Token file of the default profile; defaults to token.json in dir"),
+			"scopes": describe(map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string", "minLength": 1},
+				"minItems": 1,
+			}, "OAuth scopes requested at login; leave out to pick them with access"),
+			"access": describe(map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"enum": []string{"read", "upload", "edit", "share"}},
+				"minItems":    1,
+				"uniqueItems": true,
+			}, "Kinds of operation the library is used for; login requests only the scopes they need"),
+			"auth": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"callback_addr": describe(map[string]any{"type": "string", "minLength": 1}, "Address the local OAuth callback server listens on"),
+					"timeout":       describe(durationSchema, "How long login waits for the browser to return"),
+				},
+			}, "Login settings"),
+			"api": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"page_size":    describe(map[string]any{"type": "integer", "minimum": 0, "maximum": 100}, "Page size of list commands without --page-size; 0 lets the API decide"),
+					"timeout":      describe(durationSchema, "Limit of every Google Photos API request including its body; 0 means none"),
+					"dial_timeout": describe(durationSchema, "Limit of connecting to the API; 0 keeps the default of 30s"),
+					"tls_timeout":  describe(durationSchema, "Limit of the TLS handshake with the API; 0 keeps the default of 10s"),
+					"proxy":        describe(map[string]any{"type": "string", "pattern": "^(https?|socks5h?)://"}, "URL of the http, https or socks5 proxy API requests go through, instead of HTTPS_PROXY and HTTP_PROXY"),
+					"max_rps":      describe(map[string]any{"type": "number", "minimum": 0}, "Most Google Photos API requests a second over every client, without --max-rps; 0 means no limit"),
+					"burst":        describe(map[string]any{"type": "integer", "minimum": 1}, "Requests that may go at once after a pause before max_rps paces them"),
+				},
+			}, "Google Photos API settings"),
+			"workers":   describe(map[string]any{"type": "integer", "minimum": 1}, "Default number of concurrent uploads and downloads"),
+			"time_zone": describe(map[string]any{"type": "string", "minLength": 1}, "IANA time zone, UTC or Local that dates are shown and matched in"),
+			"filename_dates": describe(map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string", "format": "regex"},
+				"minItems": 1,
+			}, "Regular expressions with named groups year, month and day finding dates in file names"),
+			"output": describe(map[string]any{"enum": []string{"table", "json", "csv"}}, "Result format of commands run without --output"),
+			"sync": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"dir": describe(map[string]any{"type": "string"}, "Directory sync run mirrors originals into without --dir"),
+				},
+			}, "Sync settings"),
+			"serve": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"theme": describe(map[string]any{"type": "string"}, "Theme directory of the web gallery without --theme"),
+					"token": describe(map[string]any{"type": "string"}, "Bearer token clients must send without --token; empty logs a random one"),
+				},
+			}, "Serve settings"),
+			"read_only_albums": describe(map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string", "minLength": 1},
+				"uniqueItems": true,
+			}, "IDs of albums no command may rename or add media items to or remove them from"),
+			"metrics": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"push_url": describe(map[string]any{"type": "string", "pattern": "^https?://"}, "Prometheus Pushgateway API commands push their metrics to as they exit, without --push-metrics"),
+					"job":      describe(map[string]any{"type": "string", "minLength": 1}, "Job the metrics are pushed under"),
+				},
+			}, "Prometheus metrics settings"),
+			"shortener": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"provider": describe(map[string]any{"enum": []string{"shlink", "kutt"}}, "Self-hosted URL shortener the links of share commands go through"),
+					"url":      describe(map[string]any{"type": "string", "pattern": "^https?://"}, "Base URL of the URL shortener server"),
+					"api_key":  describe(map[string]any{"type": "string"}, "API key of the URL shortener server"),
+				},
+			}, "URL shortener settings"),
+			"daemon": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"jobs": describe(map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type":                 "object",
+							"additionalProperties": false,
+							"required":             []string{"name", "schedule", "command"},
+							"properties": map[string]any{
+								"name":     describe(map[string]any{"type": "string", "pattern": `^[A-Za-z0-9][A-Za-z0-9_.-]*$`}, "Name of the job in logs, its log file and daemon status"),
+								"schedule": describe(map[string]any{"type": "string", "minLength": 1}, "When the job runs: @every DURATION, @hourly, @daily, @weekly, @monthly or a cron expression such as \"0 3 * * *\""),
+								"command": describe(map[string]any{
+									"type":     "array",
+									"items":    map[string]any{"type": "string"},
+									"minItems": 1,
+								}, "Command line the job runs without the program name, such as [sync, run]"),
+							},
+						},
+					}, "Commands daemon run starts on their schedules"),
+				},
+			}, "Scheduling daemon settings"),
+			"backup": describe(map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"pricing": describe(map[string]any{
+						"type":          "object",
+						"propertyNames": map[string]any{"enum": []string{"s3", "gs"}},
+						"additionalProperties": map[string]any{
+							"type":                 "object",
+							"additionalProperties": false,
+							"properties": map[string]any{
+								"storage_per_gb_month": describe(map[string]any{"type": "number", "minimum": 0}, "Dollars charged for every GiB kept for a month"),
+								"egress_per_gb":        describe(map[string]any{"type": "number", "minimum": 0}, "Dollars charged for every GiB downloaded, as a restore does"),
+								"put_per_1000":         describe(map[string]any{"type": "number", "minimum": 0}, "Dollars charged for every 1000 uploads"),
+							},
+						},
+					}, "What the storage provider of s3:// or gs:// backup targets charges, which plan quota backup --to estimates costs from"),
+				},
+			}, "Backup settings"),
+		},
+		// access picks the scopes, so the two cannot both be set
+		"not": map[string]any{"required": []string{"scopes", "access"}},
+	}
+}
+
+// describe returns a copy of schema with a description
+func describe(schema map[string]any, description string) map[string]any {
+	described := maps.Clone(schema)
+	described["description"] = description
+	return described
+}
@@ -0,0 +1,665 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// controlBaseURL is the host of requests over the control socket, which the dialer ignores
+const controlBaseURL = "http://daemon"
+
+// controlDialTimeout is how long a command waits for a daemon to accept its connection before
+// it opens the index itself
+const controlDialTimeout = 200 * time.Millisecond
+
+// controlRequestTimeout is how long a command waits for a daemon to answer, including reading the
+// whole index, before it opens the index itself
+const controlRequestTimeout = 30 * time.Second
+
+// errDaemonUnreachable marks requests the daemon did not answer, as opposed to those it failed
+var errDaemonUnreachable = errors.New("failed to reach the daemon")
+
+// LocalIndex is the whole index database: the index of the library and the uploaded files,
+// recognized text, EXIF data and image hashes recorded beside it
+type LocalIndex interface {
+	domain.IndexRepository
+	domain.UploadedFileRepository
+	domain.TextIndexRepository
+	domain.ExifRepository
+	domain.ImageHashRepository
+}
+
+// SharedIndexRepository serves the index database at path to many callers at once, as the daemon
+// does over its control socket. It opens the database only to read what it does not hold yet and
+// to write, so the file is not locked between requests and the commands using it directly still
+// can, and it keeps what it read of the library index in memory until the file changes.
+type SharedIndexRepository struct {
+	path string
+
+	mu sync.Mutex
+	// version is the file as it was when the cached values were read
+	version  fileVersion
+	snapshot *domain.IndexSnapshot
+	stats    *domain.IndexStats
+	history  []domain.LibrarySnapshot
+}
+
+// fileVersion tells whether a file changed, by its size and modification time
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+var _ LocalIndex = (*SharedIndexRepository)(nil)
+
+// NewSharedIndexRepository creates a SharedIndexRepository over the index database at path
+func NewSharedIndexRepository(path string) *SharedIndexRepository {
+	return &SharedIndexRepository{path: path}
+}
+
+// Load returns everything in the index, from memory unless the file changed since it was read
+func (r *SharedIndexRepository) Load() (*domain.IndexSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revalidate()
+	if r.snapshot == nil {
+		err := r.withIndex(func(index *BoltIndexRepository) (err error) {
+			r.snapshot, err = index.Load()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cloneSnapshot(r.snapshot), nil
+}
+
+// Replace replaces the contents of the index and forgets what was read of it
+func (r *SharedIndexRepository) Replace(snapshot domain.IndexSnapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.forget()
+	return r.withIndex(func(index *BoltIndexRepository) error {
+		return index.Replace(snapshot)
+	})
+}
+
+// Stats counts the albums and media items in the index, from memory unless the file changed
+func (r *SharedIndexRepository) Stats() (*domain.IndexStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revalidate()
+	if r.stats == nil {
+		err := r.withIndex(func(index *BoltIndexRepository) (err error) {
+			r.stats, err = index.Stats()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats := *r.stats
+	return &stats, nil
+}
+
+// History returns the library snapshot of every day the index was written, from memory unless
+// the file changed
+func (r *SharedIndexRepository) History() ([]domain.LibrarySnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revalidate()
+	if r.history == nil {
+		var history []domain.LibrarySnapshot
+		err := r.withIndex(func(index *BoltIndexRepository) (err error) {
+			history, err = index.History()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		// An empty history is cached as well, which nil would not tell apart from none read
+		r.history = append([]domain.LibrarySnapshot{}, history...)
+	}
+	return slices.Clone(r.history), nil
+}
+
+// LoadUploaded returns the record of the file with the checksum sha256, or nil if there is none
+func (r *SharedIndexRepository) LoadUploaded(sha256 string) (file *domain.UploadedFile, err error) {
+	err = r.withRecords(func(index *BoltIndexRepository) error {
+		file, err = index.LoadUploaded(sha256)
+		return err
+	})
+	return file, err
+}
+
+// SaveUploaded records file under the checksum of its content
+func (r *SharedIndexRepository) SaveUploaded(file domain.UploadedFile) error {
+	return r.withRecords(func(index *BoltIndexRepository) error {
+		return index.SaveUploaded(file)
+	})
+}
+
+// LoadText returns the text stored for path, or nil if there is none
+func (r *SharedIndexRepository) LoadText(path string) (doc *domain.DocumentText, err error) {
+	err = r.withRecords(func(index *BoltIndexRepository) error {
+		doc, err = index.LoadText(path)
+		return err
+	})
+	return doc, err
+}
+
+// SaveText stores doc, replacing the text stored for its path before
+func (r *SharedIndexRepository) SaveText(doc domain.DocumentText) error {
+	return r.withRecords(func(index *BoltIndexRepository) error {
+		return index.SaveText(doc)
+	})
+}
+
+// SearchText returns the documents holding a word starting with each of terms
+func (r *SharedIndexRepository) SearchText(terms []string) (docs []domain.DocumentText, err error) {
+	err = r.withRecords(func(index *BoltIndexRepository) error {
+		docs, err = index.SearchText(terms)
+		return err
+	})
+	return docs, err
+}
+
+// SaveExif records data, replacing what was recorded for the same media items
+func (r *SharedIndexRepository) SaveExif(data []domain.ExifData) error {
+	return r.withRecords(func(index *BoltIndexRepository) error {
+		return index.SaveExif(data)
+	})
+}
+
+// LoadExif returns the recorded EXIF data by media item ID
+func (r *SharedIndexRepository) LoadExif() (exif map[string]domain.ExifData, err error) {
+	err = r.withRecords(func(index *BoltIndexRepository) error {
+		exif, err = index.LoadExif()
+		return err
+	})
+	return exif, err
+}
+
+// SaveImageHashes records hashes, replacing what was recorded for the same media items
+func (r *SharedIndexRepository) SaveImageHashes(hashes []domain.ImageHashes) error {
+	return r.withRecords(func(index *BoltIndexRepository) error {
+		return index.SaveImageHashes(hashes)
+	})
+}
+
+// LoadImageHashes returns the recorded image hashes by media item ID
+func (r *SharedIndexRepository) LoadImageHashes() (hashes map[string]domain.ImageHashes, err error) {
+	err = r.withRecords(func(index *BoltIndexRepository) error {
+		hashes, err = index.LoadImageHashes()
+		return err
+	})
+	return hashes, err
+}
+
+// Close forgets what was read of the index; the file is not held open between requests
+func (r *SharedIndexRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.forget()
+	return nil
+}
+
+// revalidate forgets what was read of the index when the file changed since; r.mu must be held.
+// The file is looked at before it is read, so a write in between is seen by the next request.
+func (r *SharedIndexRepository) revalidate() {
+	var version fileVersion
+	if info, err := os.Stat(r.path); err == nil {
+		version = fileVersion{size: info.Size(), modTime: info.ModTime()}
+	}
+	if version != r.version {
+		r.forget()
+		r.version = version
+	}
+}
+
+// forget drops the cached values; r.mu must be held
+func (r *SharedIndexRepository) forget() {
+	r.snapshot, r.stats, r.history = nil, nil, nil
+}
+
+// withIndex opens the database for fn and closes it again
+func (r *SharedIndexRepository) withIndex(fn func(index *BoltIndexRepository) error) error {
+	index, err := openBoltIndex(r.path)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	return fn(index)
+}
+
+// withRecords opens the database for fn, which only reads or writes the records kept beside the
+// library index. Writing them changes the file but not the library index, so what was read of it
+// stays in memory rather than being read again on the next request.
+func (r *SharedIndexRepository) withRecords(fn func(index *BoltIndexRepository) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revalidate()
+	err := r.withIndex(fn)
+	if info, statErr := os.Stat(r.path); statErr == nil {
+		r.version = fileVersion{size: info.Size(), modTime: info.ModTime()}
+	}
+	return err
+}
+
+// cloneSnapshot copies snapshot, so callers sorting or changing it leave the cache alone
+func cloneSnapshot(snapshot *domain.IndexSnapshot) *domain.IndexSnapshot {
+	clone := *snapshot
+	clone.Albums = slices.Clone(snapshot.Albums)
+	clone.MediaItems = slices.Clone(snapshot.MediaItems)
+	clone.AlbumItems = maps.Clone(snapshot.AlbumItems)
+	for albumID, ids := range clone.AlbumItems {
+		clone.AlbumItems[albumID] = slices.Clone(ids)
+	}
+	return &clone
+}
+
+// NewControlHandler answers the requests of ControlIndexRepository from index
+func NewControlHandler(index LocalIndex) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /index", func(w http.ResponseWriter, req *http.Request) {
+		snapshot, err := index.Load()
+		writeControlResponse(w, snapshot, err)
+	})
+	mux.HandleFunc("PUT /index", func(w http.ResponseWriter, req *http.Request) {
+		var snapshot domain.IndexSnapshot
+		if err := json.NewDecoder(req.Body).Decode(&snapshot); err != nil {
+			http.Error(w, fmt.Sprintf("invalid index snapshot: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeControlResponse(w, struct{}{}, index.Replace(snapshot))
+	})
+	mux.HandleFunc("GET /index/stats", func(w http.ResponseWriter, req *http.Request) {
+		stats, err := index.Stats()
+		writeControlResponse(w, stats, err)
+	})
+	mux.HandleFunc("GET /index/history", func(w http.ResponseWriter, req *http.Request) {
+		history, err := index.History()
+		writeControlResponse(w, history, err)
+	})
+	mux.HandleFunc("GET /uploaded/{sha256}", func(w http.ResponseWriter, req *http.Request) {
+		file, err := index.LoadUploaded(req.PathValue("sha256"))
+		writeControlResponse(w, file, err)
+	})
+	mux.HandleFunc("PUT /uploaded", func(w http.ResponseWriter, req *http.Request) {
+		var file domain.UploadedFile
+		if err := json.NewDecoder(req.Body).Decode(&file); err != nil {
+			http.Error(w, fmt.Sprintf("invalid uploaded file: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeControlResponse(w, struct{}{}, index.SaveUploaded(file))
+	})
+	mux.HandleFunc("GET /texts", func(w http.ResponseWriter, req *http.Request) {
+		doc, err := index.LoadText(req.URL.Query().Get("path"))
+		writeControlResponse(w, doc, err)
+	})
+	mux.HandleFunc("PUT /texts", func(w http.ResponseWriter, req *http.Request) {
+		var doc domain.DocumentText
+		if err := json.NewDecoder(req.Body).Decode(&doc); err != nil {
+			http.Error(w, fmt.Sprintf("invalid text: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeControlResponse(w, struct{}{}, index.SaveText(doc))
+	})
+	mux.HandleFunc("GET /texts/search", func(w http.ResponseWriter, req *http.Request) {
+		docs, err := index.SearchText(req.URL.Query()["term"])
+		writeControlResponse(w, docs, err)
+	})
+	mux.HandleFunc("GET /exif", func(w http.ResponseWriter, req *http.Request) {
+		exif, err := index.LoadExif()
+		writeControlResponse(w, exif, err)
+	})
+	mux.HandleFunc("PUT /exif", func(w http.ResponseWriter, req *http.Request) {
+		var data []domain.ExifData
+		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+			http.Error(w, fmt.Sprintf("invalid EXIF data: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeControlResponse(w, struct{}{}, index.SaveExif(data))
+	})
+	mux.HandleFunc("GET /hashes", func(w http.ResponseWriter, req *http.Request) {
+		hashes, err := index.LoadImageHashes()
+		writeControlResponse(w, hashes, err)
+	})
+	mux.HandleFunc("PUT /hashes", func(w http.ResponseWriter, req *http.Request) {
+		var hashes []domain.ImageHashes
+		if err := json.NewDecoder(req.Body).Decode(&hashes); err != nil {
+			http.Error(w, fmt.Sprintf("invalid image hashes: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeControlResponse(w, struct{}{}, index.SaveImageHashes(hashes))
+	})
+	return mux
+}
+
+// writeControlResponse writes v as JSON, or err as the plain text body of a failed response
+func writeControlResponse(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ControlServer is a daemon listening on its control socket
+type ControlServer struct {
+	server *http.Server
+}
+
+// ListenControlSocket serves handler on a Unix socket at path, only to the current user, until
+// the server is closed. A socket left behind by a daemon that is gone is replaced; one that a
+// running daemon answers on is not.
+//
+// The socket is created with the permissions the umask leaves, and only restricted after, so its
+// directory is made private first: no one else can connect to it in between.
+func ListenControlSocket(path string, handler http.Handler) (*ControlServer, error) {
+	if conn, err := net.DialTimeout("unix", path, controlDialTimeout); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another daemon is already listening on %s", path)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create control socket directory: %v", err)
+	}
+	// MkdirAll leaves a directory that already exists as it is
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to restrict control socket directory: %v", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %v", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %v", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %v", err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	return &ControlServer{server: server}, nil
+}
+
+// Close stops answering on the control socket and removes it
+func (s *ControlServer) Close() error {
+	return s.server.Close()
+}
+
+// ControlIndexRepository is the index of a running daemon, reached over its control socket. The
+// daemon answers from memory and is the only one opening the database, so commands neither wait
+// for its lock nor read the file again. Once the daemon stops answering, or takes longer than
+// controlRequestTimeout, the database is opened directly instead for the rest of the command.
+type ControlIndexRepository struct {
+	client    *http.Client
+	indexPath string
+
+	mu     sync.Mutex
+	direct *BoltIndexRepository
+}
+
+var _ LocalIndex = (*ControlIndexRepository)(nil)
+
+// ConnectControlSocket returns the index of the daemon listening on the Unix socket at path, or
+// false when no daemon answers there. indexPath is the database the daemon serves, opened directly
+// when the daemon stops answering.
+func ConnectControlSocket(path, indexPath string) (*ControlIndexRepository, bool) {
+	conn, err := net.DialTimeout("unix", path, controlDialTimeout)
+	if err != nil {
+		return nil, false
+	}
+	conn.Close()
+
+	dialer := &net.Dialer{Timeout: controlDialTimeout}
+	return &ControlIndexRepository{
+		client: &http.Client{
+			Timeout: controlRequestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+		indexPath: indexPath,
+	}, true
+}
+
+// Load returns everything in the daemon's index
+func (r *ControlIndexRepository) Load() (*domain.IndexSnapshot, error) {
+	return withDaemon(r, func() (*domain.IndexSnapshot, error) {
+		var snapshot domain.IndexSnapshot
+		if err := r.do(http.MethodGet, "/index", nil, &snapshot); err != nil {
+			return nil, err
+		}
+		if snapshot.AlbumItems == nil {
+			snapshot.AlbumItems = make(map[string][]string)
+		}
+		return &snapshot, nil
+	}, (*BoltIndexRepository).Load)
+}
+
+// Replace has the daemon replace the contents of its index with snapshot
+func (r *ControlIndexRepository) Replace(snapshot domain.IndexSnapshot) error {
+	return r.put("/index", snapshot, func(index *BoltIndexRepository) error {
+		return index.Replace(snapshot)
+	})
+}
+
+// Stats counts the albums and media items in the daemon's index
+func (r *ControlIndexRepository) Stats() (*domain.IndexStats, error) {
+	return withDaemon(r, func() (*domain.IndexStats, error) {
+		var stats domain.IndexStats
+		if err := r.do(http.MethodGet, "/index/stats", nil, &stats); err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}, (*BoltIndexRepository).Stats)
+}
+
+// History returns the library snapshot of every day the daemon's index was written
+func (r *ControlIndexRepository) History() ([]domain.LibrarySnapshot, error) {
+	return withDaemon(r, func() ([]domain.LibrarySnapshot, error) {
+		var history []domain.LibrarySnapshot
+		if err := r.do(http.MethodGet, "/index/history", nil, &history); err != nil {
+			return nil, err
+		}
+		return history, nil
+	}, (*BoltIndexRepository).History)
+}
+
+// LoadUploaded returns the record the daemon keeps of the file with the checksum sha256, or nil
+// if there is none
+func (r *ControlIndexRepository) LoadUploaded(sha256 string) (*domain.UploadedFile, error) {
+	return withDaemon(r, func() (*domain.UploadedFile, error) {
+		var file *domain.UploadedFile
+		err := r.do(http.MethodGet, "/uploaded/"+url.PathEscape(sha256), nil, &file)
+		return file, err
+	}, func(index *BoltIndexRepository) (*domain.UploadedFile, error) {
+		return index.LoadUploaded(sha256)
+	})
+}
+
+// SaveUploaded has the daemon record file under the checksum of its content
+func (r *ControlIndexRepository) SaveUploaded(file domain.UploadedFile) error {
+	return r.put("/uploaded", file, func(index *BoltIndexRepository) error {
+		return index.SaveUploaded(file)
+	})
+}
+
+// LoadText returns the text the daemon stores for path, or nil if there is none
+func (r *ControlIndexRepository) LoadText(path string) (*domain.DocumentText, error) {
+	return withDaemon(r, func() (*domain.DocumentText, error) {
+		var doc *domain.DocumentText
+		err := r.do(http.MethodGet, "/texts?"+url.Values{"path": {path}}.Encode(), nil, &doc)
+		return doc, err
+	}, func(index *BoltIndexRepository) (*domain.DocumentText, error) {
+		return index.LoadText(path)
+	})
+}
+
+// SaveText has the daemon store doc, replacing the text stored for its path before
+func (r *ControlIndexRepository) SaveText(doc domain.DocumentText) error {
+	return r.put("/texts", doc, func(index *BoltIndexRepository) error {
+		return index.SaveText(doc)
+	})
+}
+
+// SearchText returns the documents of the daemon holding a word starting with each of terms
+func (r *ControlIndexRepository) SearchText(terms []string) ([]domain.DocumentText, error) {
+	return withDaemon(r, func() ([]domain.DocumentText, error) {
+		var docs []domain.DocumentText
+		err := r.do(http.MethodGet, "/texts/search?"+url.Values{"term": terms}.Encode(), nil, &docs)
+		return docs, err
+	}, func(index *BoltIndexRepository) ([]domain.DocumentText, error) {
+		return index.SearchText(terms)
+	})
+}
+
+// SaveExif has the daemon record data, replacing what was recorded for the same media items
+func (r *ControlIndexRepository) SaveExif(data []domain.ExifData) error {
+	return r.put("/exif", data, func(index *BoltIndexRepository) error {
+		return index.SaveExif(data)
+	})
+}
+
+// LoadExif returns the EXIF data the daemon records by media item ID
+func (r *ControlIndexRepository) LoadExif() (map[string]domain.ExifData, error) {
+	return withDaemon(r, func() (map[string]domain.ExifData, error) {
+		exif := make(map[string]domain.ExifData)
+		err := r.do(http.MethodGet, "/exif", nil, &exif)
+		return exif, err
+	}, (*BoltIndexRepository).LoadExif)
+}
+
+// SaveImageHashes has the daemon record hashes, replacing what was recorded for the same media items
+func (r *ControlIndexRepository) SaveImageHashes(hashes []domain.ImageHashes) error {
+	return r.put("/hashes", hashes, func(index *BoltIndexRepository) error {
+		return index.SaveImageHashes(hashes)
+	})
+}
+
+// LoadImageHashes returns the image hashes the daemon records by media item ID
+func (r *ControlIndexRepository) LoadImageHashes() (map[string]domain.ImageHashes, error) {
+	return withDaemon(r, func() (map[string]domain.ImageHashes, error) {
+		hashes := make(map[string]domain.ImageHashes)
+		err := r.do(http.MethodGet, "/hashes", nil, &hashes)
+		return hashes, err
+	}, (*BoltIndexRepository).LoadImageHashes)
+}
+
+// Close releases the connections to the daemon, which keeps its index, and closes the database
+// if it was opened directly
+func (r *ControlIndexRepository) Close() error {
+	r.client.CloseIdleConnections()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.direct == nil {
+		return nil
+	}
+	err := r.direct.Close()
+	r.direct = nil
+	return err
+}
+
+// withDaemon asks the daemon through viaDaemon. When the daemon does not answer, or did so before,
+// it opens the database and answers through direct instead.
+func withDaemon[T any](r *ControlIndexRepository, viaDaemon func() (T, error), direct func(*BoltIndexRepository) (T, error)) (T, error) {
+	r.mu.Lock()
+	index := r.direct
+	r.mu.Unlock()
+	if index == nil {
+		v, err := viaDaemon()
+		if !errors.Is(err, errDaemonUnreachable) {
+			return v, err
+		}
+		if index, err = r.openDirect(err); err != nil {
+			return v, err
+		}
+	}
+	return direct(index)
+}
+
+// openDirect opens the database the daemon serves after reaching it failed with cause
+func (r *ControlIndexRepository) openDirect(cause error) (*BoltIndexRepository, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.direct != nil {
+		return r.direct, nil
+	}
+	index, err := openBoltIndex(r.indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w; opening the index instead: %v", cause, err)
+	}
+	r.direct = index
+	return index, nil
+}
+
+// put has the daemon write v at path, or writes it through direct once the daemon does not
+// answer. Every write replaces what was there, so one the daemon may have done is repeated safely.
+func (r *ControlIndexRepository) put(path string, v any, direct func(*BoltIndexRepository) error) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", strings.TrimPrefix(path, "/"), err)
+	}
+	_, err = withDaemon(r, func() (struct{}, error) {
+		return struct{}{}, r.do(http.MethodPut, path, body, nil)
+	}, func(index *BoltIndexRepository) (struct{}, error) {
+		return struct{}{}, direct(index)
+	})
+	return err
+}
+
+// do sends a request with body to the daemon and decodes its answer into out unless out is nil
+func (r *ControlIndexRepository) do(method, path string, body []byte, out any) error {
+	req, err := http.NewRequest(method, controlBaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errDaemonUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("daemon: %s", strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode daemon response: %v", err)
+	}
+	return nil
+}
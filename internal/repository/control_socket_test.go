@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestControlSocket_SharesTheIndexOfTheDaemon(t *testing.T) {
+	dir := t.TempDir()
+	indexPath, socketPath := filepath.Join(dir, "index.db"), filepath.Join(dir, "daemon.sock")
+	if _, ok := ConnectControlSocket(socketPath, indexPath); ok {
+		t.Fatal("Expected no daemon before the socket is listened on")
+	}
+
+	server, err := ListenControlSocket(socketPath, NewControlHandler(NewSharedIndexRepository(indexPath)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer server.Close()
+	if _, err := ListenControlSocket(socketPath, NewControlHandler(NewSharedIndexRepository(indexPath))); err == nil {
+		t.Error("Expected a second daemon on the same socket to be refused")
+	}
+
+	index, ok := ConnectControlSocket(socketPath, indexPath)
+	if !ok {
+		t.Fatal("Expected to reach the daemon")
+	}
+	defer index.Close()
+
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := domain.IndexSnapshot{
+		Albums:     []domain.Album{{ID: "a1", Title: "Trip", MediaItemsCount: 1}},
+		MediaItems: []domain.MediaItem{{ID: "m1", Filename: "a.jpg"}},
+		AlbumItems: map[string][]string{"a1": {"m1"}},
+		UpdatedAt:  updated,
+	}
+	if err := index.Replace(snapshot); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	loaded, err := index.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(loaded.Albums) != 1 || loaded.Albums[0].MediaItemsCount != 1 || !slices.Equal(loaded.AlbumItems["a1"], []string{"m1"}) || !loaded.UpdatedAt.Equal(updated) {
+		t.Errorf("Expected the snapshot written through the daemon, got %+v", loaded)
+	}
+	stats, err := index.Stats()
+	if err != nil || stats.Albums != 1 || stats.MediaItems != 1 {
+		t.Errorf("Expected one album and one media item, got %+v, %v", stats, err)
+	}
+	history, err := index.History()
+	if err != nil || len(history) != 1 || history[0].Photos != 1 {
+		t.Errorf("Expected the day of the write in the history, got %+v, %v", history, err)
+	}
+
+	// Between requests the daemon leaves the database unlocked for other commands
+	direct, err := NewBoltIndexRepository(indexPath)
+	if err != nil {
+		t.Fatalf("Expected the index to be unlocked, got %v", err)
+	}
+	direct.Close()
+
+	server.Close()
+	if _, ok := ConnectControlSocket(socketPath, indexPath); ok {
+		t.Error("Expected no daemon once the socket is closed")
+	}
+}
+
+func TestControlSocket_SharesTheRecordsBesideTheIndex(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	indexPath, socketPath := filepath.Join(dir, "index.db"), filepath.Join(dir, "daemon.sock")
+	direct, err := NewBoltIndexRepository(indexPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	direct.Close()
+	shared := NewSharedIndexRepository(indexPath)
+	server, err := ListenControlSocket(socketPath, NewControlHandler(shared))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer server.Close()
+	if info, err := os.Stat(dir); runtime.GOOS != "windows" && (err != nil || info.Mode().Perm() != 0o700) {
+		t.Errorf("Expected the socket directory to be private, got %v, %v", info.Mode(), err)
+	}
+
+	index, ok := ConnectControlSocket(socketPath, indexPath)
+	if !ok {
+		t.Fatal("Expected to reach the daemon")
+	}
+	defer index.Close()
+	if _, err := index.Load(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	uploaded := domain.UploadedFile{SHA256: "abc", Path: "DCIM/a.jpg", MediaItemID: "m1"}
+	if err := index.SaveUploaded(uploaded); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if file, err := index.LoadUploaded("abc"); err != nil || file == nil || file.MediaItemID != "m1" {
+		t.Errorf("Expected the uploaded file, got %+v, %v", file, err)
+	}
+	if file, err := index.LoadUploaded("def"); err != nil || file != nil {
+		t.Errorf("Expected no record of another file, got %+v, %v", file, err)
+	}
+
+	if err := index.SaveText(domain.DocumentText{Path: "scans/receipt.png", Text: "Coffee and croissant"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if doc, err := index.LoadText("scans/receipt.png"); err != nil || doc == nil || doc.Text != "Coffee and croissant" {
+		t.Errorf("Expected the stored text, got %+v, %v", doc, err)
+	}
+	if docs, err := index.SearchText([]string{"coff", "crois"}); err != nil || len(docs) != 1 {
+		t.Errorf("Expected the receipt found, got %+v, %v", docs, err)
+	}
+
+	if err := index.SaveExif([]domain.ExifData{{MediaItemID: "m1", CameraModel: "Pixel 9"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if exif, err := index.LoadExif(); err != nil || exif["m1"].CameraModel != "Pixel 9" {
+		t.Errorf("Expected the EXIF data of m1, got %+v, %v", exif, err)
+	}
+
+	// Hashes use every bit, so they must survive JSON without rounding
+	if err := index.SaveImageHashes([]domain.ImageHashes{{MediaItemID: "m1", Hashes: []uint64{1<<63 + 1, 42}}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hashes, err := index.LoadImageHashes(); err != nil || !slices.Equal(hashes["m1"].Hashes, []uint64{1<<63 + 1, 42}) {
+		t.Errorf("Expected the image hashes of m1, got %+v, %v", hashes, err)
+	}
+
+	// Writing the records changed the file, but not the library index the daemon holds
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	shared.revalidate()
+	if shared.snapshot == nil {
+		t.Error("Expected the daemon to keep the index it read")
+	}
+}
+
+func TestSharedIndexRepository_ReadsAgainOnlyWhenTheFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	shared := NewSharedIndexRepository(path)
+
+	snapshot, err := shared.Load()
+	if err != nil || len(snapshot.Albums) != 0 {
+		t.Fatalf("Expected an empty index, got %+v, %v", snapshot, err)
+	}
+
+	// Another command writes the file directly
+	direct, err := NewBoltIndexRepository(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err = direct.Replace(domain.IndexSnapshot{Albums: []domain.Album{{ID: "a1", Title: "Trip"}}, UpdatedAt: time.Now()})
+	direct.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	snapshot, err = shared.Load()
+	if err != nil || len(snapshot.Albums) != 1 {
+		t.Fatalf("Expected the album written by the other command, got %+v, %v", snapshot, err)
+	}
+
+	// Callers changing what they got leave the cached snapshot alone
+	snapshot.Albums[0].Title = "Changed"
+	snapshot, err = shared.Load()
+	if err != nil || snapshot.Albums[0].Title != "Trip" {
+		t.Errorf("Expected the cached album unchanged, got %+v, %v", snapshot, err)
+	}
+}
+
+func TestControlIndexRepository_OpensTheIndexWhenTheDaemonStopsAnswering(t *testing.T) {
+	dir := t.TempDir()
+	indexPath, socketPath := filepath.Join(dir, "index.db"), filepath.Join(dir, "daemon.sock")
+	direct, err := NewBoltIndexRepository(indexPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err = direct.Replace(domain.IndexSnapshot{Albums: []domain.Album{{ID: "a1", Title: "Trip"}}, UpdatedAt: time.Now()})
+	direct.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A daemon that accepts requests but never answers them
+	stuck := make(chan struct{})
+	server, err := ListenControlSocket(socketPath, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-stuck:
+		case <-req.Context().Done():
+		}
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer server.Close()
+	defer close(stuck)
+
+	index, ok := ConnectControlSocket(socketPath, indexPath)
+	if !ok {
+		t.Fatal("Expected to reach the daemon")
+	}
+	defer index.Close()
+	index.client.Timeout = 50 * time.Millisecond
+
+	snapshot, err := index.Load()
+	if err != nil || len(snapshot.Albums) != 1 || snapshot.Albums[0].Title != "Trip" {
+		t.Fatalf("Expected the index read directly once the daemon timed out, got %+v, %v", snapshot, err)
+	}
+
+	// Later requests go to the database without waiting for the daemon again
+	server.Close()
+	stats, err := index.Stats()
+	if err != nil || stats.Albums != 1 {
+		t.Errorf("Expected one album, got %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// maxDebugBody is the most of a request or response body DebugTransport logs
+const maxDebugBody = 64 << 10
+
+// secretHeaders are headers whose values are always left out of debug output
+var secretHeaders = map[string]bool{
+	"Authorization":     true,
+	"Cookie":            true,
+	"Set-Cookie":        true,
+	"X-Goog-Upload-Url": true,
+}
+
+// DebugTransport logs every HTTP request at info level, for --debug-http: its method, URL,
+// headers, the response status, headers and how long it took, and optionally the bodies.
+// Authorization headers, tokens and other secrets are redacted.
+type DebugTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+	bodies bool
+}
+
+// NewDebugTransport creates a new instance of DebugTransport sending requests through next, or
+// http.DefaultTransport when next is nil; bodies adds the text bodies of requests and responses
+func NewDebugTransport(next http.RoundTripper, logger *slog.Logger, bodies bool) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &DebugTransport{
+		next:   next,
+		logger: logger,
+		bodies: bodies,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *DebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", domain.RedactSecrets(req.URL.String())),
+		slog.String("request_headers", debugHeaders(req.Header)),
+	}
+	if t.bodies && req.Body != nil && req.Body != http.NoBody {
+		body, err := t.requestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, slog.String("request_body", body))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs = append(attrs, slog.Duration("duration", time.Since(start).Round(time.Millisecond)))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", domain.RedactSecrets(err.Error())))
+		t.logger.LogAttrs(context.Background(), slog.LevelInfo, "API call", attrs...)
+		return resp, err
+	}
+
+	attrs = append(attrs,
+		slog.Int("status", resp.StatusCode),
+		slog.String("response_headers", debugHeaders(resp.Header)),
+	)
+	if t.bodies {
+		body, err := t.responseBody(req, resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		attrs = append(attrs, slog.String("response_body", body))
+	}
+	t.logger.LogAttrs(context.Background(), slog.LevelInfo, "API call", attrs...)
+	return resp, nil
+}
+
+// requestBody returns the body of req to log. Text bodies are read from a copy, or read and put
+// back when the request cannot make one; others, such as uploaded files, are only described.
+func (t *DebugTransport) requestBody(req *http.Request) (string, error) {
+	contentType := req.Header.Get("Content-Type")
+	if !isText(contentType) {
+		return describeBody(req.ContentLength, contentType), nil
+	}
+
+	var b []byte
+	var err error
+	if req.GetBody != nil {
+		var body io.ReadCloser
+		if body, err = req.GetBody(); err != nil {
+			return "", err
+		}
+		b, err = io.ReadAll(body)
+		body.Close()
+	} else {
+		b, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %v", err)
+	}
+	return debugBody(b), nil
+}
+
+// responseBody returns the body of resp to log, putting back what it read. Downloads are only
+// described, and upload tokens, which the uploads endpoint returns as plain text, are redacted.
+func (t *DebugTransport) responseBody(req *http.Request, resp *http.Response) (string, error) {
+	contentType := resp.Header.Get("Content-Type")
+	if !isText(contentType) {
+		return describeBody(resp.ContentLength, contentType), nil
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+	if strings.HasSuffix(req.URL.Path, "/uploads") && resp.StatusCode == http.StatusOK && !strings.Contains(contentType, "json") {
+		return domain.Redacted, nil
+	}
+	return debugBody(b), nil
+}
+
+// isText reports whether a body of contentType is worth logging as text
+func isText(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") ||
+		strings.HasPrefix(contentType, "application/x-www-form-urlencoded")
+}
+
+// describeBody stands for a body that is not logged
+func describeBody(size int64, contentType string) string {
+	if size < 0 {
+		return fmt.Sprintf("[%s body]", contentType)
+	}
+	return fmt.Sprintf("[%d bytes of %s]", size, contentType)
+}
+
+// debugBody returns b with secrets redacted, cut to maxDebugBody
+func debugBody(b []byte) string {
+	if len(b) > maxDebugBody {
+		return domain.RedactSecrets(string(b[:maxDebugBody])) + fmt.Sprintf("... [%d more bytes]", len(b)-maxDebugBody)
+	}
+	return domain.RedactSecrets(string(b))
+}
+
+// debugHeaders formats headers sorted by name, redacting the secret ones
+func debugHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if secretHeaders[http.CanonicalHeaderKey(name)] {
+			value = domain.Redacted
+		}
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(name + ": " + domain.RedactSecrets(value))
+	}
+	return b.String()
+}
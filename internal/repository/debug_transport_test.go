@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransport(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	stub := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"id":"a1","title":"Trip"}`
+		header := http.Header{"Content-Type": {"application/json"}}
+		if strings.HasSuffix(req.URL.Path, "/uploads") {
+			body, header = "CAIS-upload-token", http.Header{"Content-Type": {"text/plain"}}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+	client := &http.Client{Transport: NewDebugTransport(stub, logger, true)}
+
+	req, _ := http.NewRequest(http.MethodPost, albumsEndpoint+"?access_token=ya29.secret", strings.NewReader(`{"album":{"title":"Trip"}}`))
+	req.Header.Set("Authorization", "Bearer ya29.secret")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != `{"id":"a1","title":"Trip"}` {
+		t.Errorf("Expected the response body to be left for the caller, got %q", b)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, uploadsEndpoint, bytes.NewReader([]byte{0xff, 0xd8}))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	got := buf.String()
+	for _, want := range []string{
+		"level=INFO", `msg="API call" method=POST`, "status=200", "duration=",
+		`request_headers="Authorization: [REDACTED]; Content-Type: application/json"`,
+		`request_body="{\"album\":{\"title\":\"Trip\"}}"`, `response_body="{\"id\":\"a1\",\"title\":\"Trip\"}"`,
+		`request_body="[2 bytes of application/octet-stream]"`, "response_body=[REDACTED]",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in the log, got %s", want, got)
+		}
+	}
+	for _, secret := range []string{"ya29.secret", "CAIS-upload-token"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"krupesh.faldu/internal/domain"
+)
+
+// exifBucket holds the EXIF data of uploaded photos as JSON keyed by media item ID. Rebuilding the
+// index leaves it alone.
+var exifBucket = []byte("exif")
+
+// SaveExif records data under the media item IDs, replacing what was recorded for them before
+func (r *BoltIndexRepository) SaveExif(data []domain.ExifData) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(exifBucket)
+		if err != nil {
+			return err
+		}
+		for _, exif := range data {
+			if err := putJSON(b, exif.MediaItemID, exif); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record EXIF data: %v", err)
+	}
+	return nil
+}
+
+// LoadExif returns the recorded EXIF data by media item ID
+func (r *BoltIndexRepository) LoadExif() (map[string]domain.ExifData, error) {
+	exif := make(map[string]domain.ExifData)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(exifBucket), func(data domain.ExifData) {
+			exif[data.MediaItemID] = data
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EXIF data: %v", err)
+	}
+	return exif, nil
+}
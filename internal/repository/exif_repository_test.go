@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestSharedIndexRepository_SaveAndLoadExif(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	repo := NewSharedIndexRepository(path)
+
+	exif, err := repo.LoadExif()
+	if err != nil || len(exif) != 0 {
+		t.Fatalf("Expected no EXIF data before anything was uploaded, got %+v (%v)", exif, err)
+	}
+
+	beach := domain.ExifData{
+		MediaItemID: "m1",
+		Path:        "DCIM/IMG_1.jpg",
+		Taken:       time.Date(2026, 7, 4, 18, 30, 0, 0, time.FixedZone("", 2*60*60)),
+		CameraMake:  "Canon",
+		CameraModel: "EOS R6",
+		Location:    &domain.GeoPoint{Latitude: 43.6954, Longitude: 7.2656},
+	}
+	if err := repo.SaveExif([]domain.ExifData{beach, {MediaItemID: "m2", Path: "IMG_2.jpg", CameraModel: "Pixel 9"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Rebuilding the index must not forget the EXIF data, which cannot be fetched again
+	index, err := openBoltIndex(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := index.Replace(domain.IndexSnapshot{UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	index.Close()
+
+	exif, err = repo.LoadExif()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(exif) != 2 || exif["m2"].CameraModel != "Pixel 9" {
+		t.Fatalf("Expected EXIF data of m1 and m2, got %+v", exif)
+	}
+	got := exif["m1"]
+	if !got.Taken.Equal(beach.Taken) || !reflect.DeepEqual(got.Location, beach.Location) || got.CameraModel != beach.CameraModel {
+		t.Errorf("Expected %+v, got %+v", beach, got)
+	}
+}
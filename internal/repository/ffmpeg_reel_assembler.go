@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FFmpegReelAssembler implements the ReelAssembler interface by running ffmpeg. Scenes are
+// scaled to the frame, padded with black and joined without audio, since photos have none.
+type FFmpegReelAssembler struct {
+	binary string
+}
+
+// NewFFmpegReelAssembler creates a new instance of FFmpegReelAssembler that runs binary, a path
+// or a name looked up in PATH; an empty binary runs "ffmpeg"
+func NewFFmpegReelAssembler(binary string) domain.ReelAssembler {
+	if binary == "" {
+		binary = "ffmpeg"
+	}
+	return &FFmpegReelAssembler{
+		binary: binary,
+	}
+}
+
+// Assemble runs ffmpeg to write spec.Output, reporting the end of ffmpeg's output when it fails
+func (a *FFmpegReelAssembler) Assemble(ctx context.Context, spec domain.ReelSpec) error {
+	if len(spec.Clips) == 0 {
+		return fmt.Errorf("a highlight reel needs at least one clip")
+	}
+	binary, err := exec.LookPath(a.binary)
+	if err != nil {
+		return fmt.Errorf("ffmpeg not found, install it or pass its path with --ffmpeg: %v", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, ffmpegReelArgs(spec)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := lastLines(stderr.String(), 5); msg != "" {
+			return fmt.Errorf("ffmpeg failed: %v: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg failed: %v", err)
+	}
+	return nil
+}
+
+// ffmpegReelArgs builds the ffmpeg command line: one input per clip, photos looped for their
+// duration, and a filter graph that normalizes every scene before concatenating them
+func ffmpegReelArgs(spec domain.ReelSpec) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y"}
+	for _, clip := range spec.Clips {
+		if !clip.Video {
+			args = append(args, "-loop", "1")
+		}
+		args = append(args, "-t", seconds(clip.Duration), "-i", clip.Path)
+	}
+
+	var graph strings.Builder
+	for i := range spec.Clips {
+		fmt.Fprintf(&graph, "[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%d,format=yuv420p[v%d];",
+			i, spec.Width, spec.Height, spec.Width, spec.Height, spec.FPS, i)
+	}
+	for i := range spec.Clips {
+		fmt.Fprintf(&graph, "[v%d]", i)
+	}
+	fmt.Fprintf(&graph, "concat=n=%d:v=1:a=0[reel]", len(spec.Clips))
+
+	return append(args,
+		"-filter_complex", graph.String(),
+		"-map", "[reel]",
+		"-c:v", "libx264", "-crf", "20", "-preset", "medium",
+		"-movflags", "+faststart",
+		spec.Output)
+}
+
+// seconds formats d the way ffmpeg expects durations
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// lastLines returns up to n trailing non-empty lines of s joined by "; "
+func lastLines(s string, n int) string {
+	lines := strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' })
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
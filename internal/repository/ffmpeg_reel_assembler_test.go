@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestFFmpegReelArgs(t *testing.T) {
+	spec := domain.ReelSpec{
+		Clips: []domain.ReelClip{
+			{Path: "0000.jpg", Duration: 3 * time.Second},
+			{Path: "0001.mp4", Video: true, Duration: 1500 * time.Millisecond},
+		},
+		Width:  1280,
+		Height: 720,
+		FPS:    30,
+		Output: "reel.mp4",
+	}
+
+	args := ffmpegReelArgs(spec)
+	line := strings.Join(args, " ")
+
+	// Only photos are looped, videos are cut off at their duration
+	if !strings.Contains(line, "-loop 1 -t 3 -i 0000.jpg -t 1.5 -i 0001.mp4") {
+		t.Errorf("Unexpected inputs in %s", line)
+	}
+	graph := args[slices.Index(args, "-filter_complex")+1]
+	if !strings.Contains(graph, "[1:v]scale=1280:720:") || !strings.HasSuffix(graph, "[v0][v1]concat=n=2:v=1:a=0[reel]") {
+		t.Errorf("Unexpected filter graph %s", graph)
+	}
+	if args[len(args)-1] != "reel.mp4" {
+		t.Errorf("Expected the output last, got %s", args[len(args)-1])
+	}
+}
+
+func TestFFmpegReelAssembler_MissingBinary(t *testing.T) {
+	assembler := NewFFmpegReelAssembler("ffmpeg-that-does-not-exist")
+	spec := domain.ReelSpec{Clips: []domain.ReelClip{{Path: "a.jpg"}}, Output: "reel.mp4"}
+
+	err := assembler.Assemble(context.Background(), spec)
+
+	if err == nil || !strings.Contains(err.Error(), "--ffmpeg") {
+		t.Errorf("Expected an error pointing at --ffmpeg, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FSNotifyFolderNotifier reports changes below a folder through the file system notifications of
+// the operating system. Notifications cover a single directory, so every subdirectory is watched
+// as well, including those created later.
+type FSNotifyFolderNotifier struct {
+	watcher *fsnotify.Watcher
+	changes chan struct{}
+	logger  *slog.Logger
+}
+
+var _ domain.FolderNotifier = (*FSNotifyFolderNotifier)(nil)
+
+// NewFSNotifyFolderNotifier watches dir and the directories below it, logging to logger the
+// directories that cannot be watched
+func NewFSNotifyFolderNotifier(dir string, logger *slog.Logger) (*FSNotifyFolderNotifier, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	n := &FSNotifyFolderNotifier{watcher: watcher, changes: make(chan struct{}, 1), logger: logger}
+	// The folder itself must be watched; directories below it that cannot be are only logged
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	n.addTree(dir)
+	go n.run()
+	return n, nil
+}
+
+// Changes receives a value after files below the folder changed
+func (n *FSNotifyFolderNotifier) Changes() <-chan struct{} {
+	return n.changes
+}
+
+// Close stops watching the folder
+func (n *FSNotifyFolderNotifier) Close() error {
+	return n.watcher.Close()
+}
+
+// run turns the notifications of the watcher into changes until it is closed
+func (n *FSNotifyFolderNotifier) run() {
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				// A directory created or moved in holds files nothing was told about yet
+				n.addTree(event.Name)
+			}
+			n.notify()
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Notifications may have been lost, so the folder is looked at anyway
+			n.logger.Warn("File system notifications failed", "error", err)
+			n.notify()
+		}
+	}
+}
+
+// notify reports a change unless one is already waiting to be received
+func (n *FSNotifyFolderNotifier) notify() {
+	select {
+	case n.changes <- struct{}{}:
+	default:
+	}
+}
+
+// addTree watches the directories below root, which is skipped unless it is a directory
+func (n *FSNotifyFolderNotifier) addTree(root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if err := n.watcher.Add(path); err != nil && !errors.Is(err, fsnotify.ErrClosed) {
+			n.logger.Warn("Failed to watch directory", "dir", path, "error", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFSNotifyFolderNotifier_ReportsChangesInNewSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	notifier, err := NewFSNotifyFolderNotifier(dir, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Skipf("File system notifications are unavailable: %v", err)
+	}
+	defer notifier.Close()
+
+	waitForChange := func(what string) {
+		t.Helper()
+		select {
+		case <-notifier.Changes():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a change after %s", what)
+		}
+	}
+	// Drains what creating the directory reported, so the next change is the file's
+	drain := func() {
+		for {
+			select {
+			case <-notifier.Changes():
+			case <-time.After(100 * time.Millisecond):
+				return
+			}
+		}
+	}
+
+	sub := filepath.Join(dir, "DCIM")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange("creating a directory")
+	drain()
+
+	if err := os.WriteFile(filepath.Join(sub, "a.jpg"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange("writing a file in the new directory")
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// GCSScope is the OAuth scope the client of a GCSBackupTarget needs
+const GCSScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// defaultGCSEndpoint is the Cloud Storage JSON API
+const defaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCSOptions configures a Google Cloud Storage bucket
+type GCSOptions struct {
+	Bucket string
+	// Prefix is put in front of every key, such as "photos/"
+	Prefix string
+	// Endpoint replaces the Cloud Storage API, such as with an emulator; empty uses the real one
+	Endpoint string
+}
+
+// GCSBackupTarget implements the BackupTarget interface with a Google Cloud Storage bucket, through
+// the JSON API. The client authenticates the requests, usually with application default
+// credentials.
+type GCSBackupTarget struct {
+	client *http.Client
+	opts   GCSOptions
+}
+
+// NewGCSBackupTarget creates a new instance of GCSBackupTarget
+func NewGCSBackupTarget(client *http.Client, opts GCSOptions) (domain.BackupTarget, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("%w: GCS bucket is required", domain.ErrInvalidArgument)
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = defaultGCSEndpoint
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	return &GCSBackupTarget{
+		client: client,
+		opts:   opts,
+	}, nil
+}
+
+// Put uploads r as the object of key, in chunks when size is -1. Cloud Storage checks uploads with
+// its own checksums, so checksum is kept in the manifest only.
+func (t *GCSBackupTarget) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	query := url.Values{"uploadType": {"media"}, "name": {t.opts.Prefix + key}}
+	endpoint := t.opts.Endpoint + "/upload/storage/v1/b/" + url.PathEscape(t.opts.Bucket) + "/o?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, r)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to GCS: %v", key, domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload %s to GCS: %w", key, statusError(resp, body))
+	}
+	return nil
+}
+
+// Get downloads the object of key
+func (t *GCSBackupTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	endpoint := t.opts.Endpoint + "/storage/v1/b/" + url.PathEscape(t.opts.Bucket) + "/o/" + url.PathEscape(t.opts.Prefix+key) + "?alt=media"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from GCS: %v", key, domain.RedactError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to read %s from GCS: %w", key, statusError(resp, body))
+	}
+	return resp.Body, nil
+}
+
+// String returns the target as a gs:// URL
+func (t *GCSBackupTarget) String() string {
+	return "gs://" + t.opts.Bucket + "/" + t.opts.Prefix
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGCSBackupTarget_PutGet(t *testing.T) {
+	var requests []*http.Request
+	target, err := NewGCSBackupTarget(stubClient(&requests, "photo"), GCSOptions{Bucket: "photos", Prefix: "backup/"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx := context.Background()
+
+	if err := target.Put(ctx, "media/a.jpg", strings.NewReader("photo"), 5, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r, err := target.Get(ctx, "media/a.jpg")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r.Close()
+
+	want := []string{
+		"POST https://storage.googleapis.com/upload/storage/v1/b/photos/o?name=backup%2Fmedia%2Fa.jpg&uploadType=media",
+		"GET https://storage.googleapis.com/storage/v1/b/photos/o/backup%2Fmedia%2Fa.jpg?alt=media",
+	}
+	for i, req := range requests {
+		if got := req.Method + " " + req.URL.String(); got != want[i] {
+			t.Errorf("Expected %s, got %s", want[i], got)
+		}
+	}
+}
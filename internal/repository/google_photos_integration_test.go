@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/testutil/fakeserver"
+)
+
+func TestGooglePhotosRepository_AlbumsAgainstFakeServer(t *testing.T) {
+	server := fakeserver.New(t)
+	shared := server.AddAlbum(domain.Album{Title: "Shared with me"})
+	item := server.AddMediaItem(domain.MediaItem{Filename: "a.jpg", MimeType: "image/jpeg"}, []byte("a"))
+	repo := NewGooglePhotosRepository(server.Client())
+
+	created, err := repo.CreateAlbum("Holiday")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !created.IsWriteable || created.ID == "" {
+		t.Errorf("Expected a writeable album with an ID, got %+v", created)
+	}
+
+	// Pages of one album each, until there is no next page token
+	var titles []string
+	req := domain.PageRequest{PageSize: 1}
+	for {
+		page, err := repo.ListAlbums(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, album := range page.Items {
+			titles = append(titles, album.Title)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		req.PageToken = page.NextPageToken
+	}
+	if !slices.Equal(titles, []string{"Shared with me", "Holiday"}) {
+		t.Errorf("Expected both albums over two pages, got %v", titles)
+	}
+
+	if _, err := repo.AddTextEnrichment(created.ID, "Two weeks off", domain.PositionFirstInAlbum); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if texts := server.Enrichments(created.ID); !slices.Equal(texts, []string{"Two weeks off"}) {
+		t.Errorf("Expected the text at the top of the album, got %v", texts)
+	}
+	if _, err := repo.UpdateAlbum(created.ID, "Summer", ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.BatchAddMediaItems(created.ID, []string{item.ID}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	album, err := repo.GetAlbumByID(created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.Title != "Summer" || album.MediaItemsCount != 1 {
+		t.Errorf("Expected the renamed album with one media item, got %+v", album)
+	}
+	if err := repo.BatchRemoveMediaItems(created.ID, []string{item.ID}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := server.AlbumItems(created.ID); len(ids) != 0 {
+		t.Errorf("Expected the media item to be removed, got %v", ids)
+	}
+
+	if err := repo.BatchAddMediaItems(shared.ID, []string{item.ID}); !errors.Is(err, domain.ErrPermissionDenied) {
+		t.Errorf("Expected albums not created by the app to be read-only, got %v", err)
+	}
+	if _, err := repo.AddTextEnrichment(shared.ID, "Hello", domain.PositionLastInAlbum); !errors.Is(err, domain.ErrPermissionDenied) {
+		t.Errorf("Expected no entries in albums not created by the app, got %v", err)
+	}
+	if _, err := repo.GetAlbumByID("missing"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected an unknown album not to be found, got %v", err)
+	}
+}
+
+func TestGooglePhotosRepository_MediaItemsAgainstFakeServer(t *testing.T) {
+	server := fakeserver.New(t)
+	albums := NewGooglePhotosRepository(server.Client())
+	repo := NewGooglePhotosMediaItemRepository(server.Client(), GooglePhotosOptions{})
+	album, err := albums.CreateAlbum("Uploads")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	token, err := repo.Upload("a.jpg", "image/jpeg", bytes.NewReader([]byte("photo")), 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	results, err := repo.BatchCreateMediaItems(album.ID, []domain.NewMediaItem{
+		{UploadToken: token, FileName: "a.jpg", Description: "first"},
+		{UploadToken: "unknown", FileName: "b.jpg"},
+	})
+	if err != nil {
+		t.Fatalf("Expected the batch to succeed in part, got %v", err)
+	}
+	if len(results) != 2 || !results[0].Status.OK() || results[1].Status.OK() {
+		t.Fatalf("Expected only the uploaded file to be created, got %+v", results)
+	}
+	item := *results[0].MediaItem
+
+	page, err := repo.ListMediaItems(domain.PageRequest{})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Filename != "a.jpg" {
+		t.Errorf("Expected the new media item in the library, got %+v, %v", page, err)
+	}
+	page, err = repo.SearchMediaItems(album.ID, domain.PageRequest{})
+	if err != nil || len(page.Items) != 1 {
+		t.Errorf("Expected the new media item in the album, got %+v, %v", page, err)
+	}
+	page, err = repo.SearchMediaItemsByFilters(domain.SearchFilters{MediaType: domain.MediaTypeVideo}, domain.PageRequest{})
+	if err != nil || len(page.Items) != 0 {
+		t.Errorf("Expected no videos, got %+v, %v", page, err)
+	}
+
+	got, err := repo.GetMediaItems([]string{item.ID, "missing"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got[0].Err != nil || got[0].MediaItem.Description != "first" || !errors.Is(got[1].Err, domain.ErrNotFound) {
+		t.Errorf("Expected the media item and a missing one, got %+v", got)
+	}
+
+	if _, err := repo.UpdateMediaItemDescription(item.ID, "edited"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated, _ := server.MediaItem(item.ID); updated.Description != "edited" {
+		t.Errorf("Expected the description to be updated, got %q", updated.Description)
+	}
+
+	content, err := repo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "photo" {
+		t.Errorf("Expected the uploaded bytes, got %q", data)
+	}
+}
+
+func TestGooglePhotosRepository_PartialResponsesAgainstFakeServer(t *testing.T) {
+	server := fakeserver.New(t)
+	taken := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	item := server.AddMediaItem(domain.MediaItem{Filename: "a.jpg", MimeType: "image/jpeg", MediaMetadata: &domain.MediaMetadata{CreationTime: taken}}, []byte("a"))
+	server.AddAlbum(domain.Album{Title: "Trip", IsWriteable: true}, item.ID)
+	server.AddAlbum(domain.Album{Title: "Home", IsWriteable: true})
+	albums := NewGooglePhotosRepository(server.Client())
+	repo := NewGooglePhotosMediaItemRepository(server.Client(), GooglePhotosOptions{StrictDecoding: true})
+
+	// The next page token survives the selection of album fields
+	var got []domain.Album
+	req := domain.PageRequest{PageSize: 1, Fields: "id,title,mediaItemsCount"}
+	for {
+		page, err := albums.ListAlbums(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		got = append(got, page.Items...)
+		if !page.HasNext() {
+			break
+		}
+		req = req.Next(page.NextPageToken)
+	}
+	if len(got) != 2 || got[0].Title != "Trip" || got[0].MediaItemsCount != 1 || got[0].IsWriteable {
+		t.Errorf("Expected both albums with only the selected fields, got %+v", got)
+	}
+
+	album, err := albums.GetAlbumFields(got[0].ID, "id,mediaItemsCount")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.ID != got[0].ID || album.MediaItemsCount != 1 || album.Title != "" {
+		t.Errorf("Expected only the ID and count of the album, got %+v", album)
+	}
+	// Albums and media items are parsed by their ID, so it is fetched even when left out
+	page, err := albums.ListAlbums(domain.PageRequest{Fields: "title"})
+	if err != nil || len(page.Items) != 2 || page.Items[0].ID != got[0].ID || page.Items[0].Title != "Trip" {
+		t.Errorf("Expected both albums with their IDs and titles, got %+v, %v", page, err)
+	}
+	album, err = albums.GetAlbumFields(got[0].ID, "title")
+	if err != nil || album.ID != got[0].ID || album.Title != "Trip" || album.MediaItemsCount != 0 {
+		t.Errorf("Expected the ID and title of the album, got %+v, %v", album, err)
+	}
+	if _, err := albums.GetAlbumFields(got[0].ID, "id,(title"); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected a malformed selector to be rejected, got %v", err)
+	}
+
+	items, err := repo.ListMediaItems(domain.PageRequest{Fields: "filename"})
+	if err != nil || len(items.Items) != 1 || items.Items[0].ID != item.ID || items.Items[0].Filename != "a.jpg" {
+		t.Errorf("Expected the ID and filename of the media item, got %+v, %v", items, err)
+	}
+	items, err = repo.SearchMediaItems(album.ID, domain.PageRequest{Fields: "id"})
+	if err != nil || len(items.Items) != 1 || items.Items[0].ID != item.ID || items.Items[0].Filename != "" || items.Items[0].BaseURL != "" {
+		t.Errorf("Expected only the ID of the media item, got %+v, %v", items, err)
+	}
+	items, err = repo.ListMediaItems(domain.PageRequest{Fields: "id,mediaMetadata/creationTime"})
+	if err != nil || len(items.Items) != 1 || items.Items[0].MimeType != "" || items.Items[0].MediaMetadata == nil || !items.Items[0].MediaMetadata.CreationTime.Equal(taken) {
+		t.Errorf("Expected the ID and creation time of the media item, got %+v, %v", items, err)
+	}
+
+	// Partial items leave the cached base URLs alone, so downloads still work
+	content, err := repo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "a" {
+		t.Errorf("Expected the bytes of the media item, got %q", data)
+	}
+}
+
+func TestGooglePhotosRepository_ResumableUploadAgainstFakeServer(t *testing.T) {
+	useSmallResumableChunks(t)
+	server := fakeserver.New(t)
+	// The start of the upload goes through, its second request fails
+	server.Inject(fakeserver.Fault{Method: http.MethodPost, Path: "/v1/uploads", Status: http.StatusServiceUnavailable, Skip: 1, Times: 1})
+	repo := NewGooglePhotosMediaItemRepository(server.Client(), GooglePhotosOptions{UploadSessions: memorySessionStore{}})
+	content := []byte("0123456789abcdefghijklmnopqrstu")
+
+	token, err := repo.UploadResumable(context.Background(), "key", "clip.mp4", "video/mp4", bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	results, err := repo.BatchCreateMediaItems("", []domain.NewMediaItem{{UploadToken: token, FileName: "clip.mp4"}})
+	if err != nil || !results[0].Status.OK() {
+		t.Fatalf("Expected the upload to become a media item, got %+v, %v", results, err)
+	}
+	item, _ := server.MediaItem(results[0].MediaItem.ID)
+	if !item.IsVideo() {
+		t.Errorf("Expected a video, got %+v", item)
+	}
+
+	rc, err := repo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); !bytes.Equal(data, content) {
+		t.Errorf("Expected the whole file to arrive once, got %q", data)
+	}
+}
+
+func TestGooglePhotosRepository_FaultsAgainstFakeServer(t *testing.T) {
+	server := fakeserver.New(t)
+	item := server.AddMediaItem(domain.MediaItem{Filename: "a.jpg"}, []byte("a"))
+	repo := NewGooglePhotosMediaItemRepository(server.Client(), GooglePhotosOptions{})
+
+	server.Inject(fakeserver.Fault{Method: http.MethodGet, Path: "/v1/mediaItems", Status: http.StatusTooManyRequests, Times: 1})
+	if _, err := repo.ListMediaItems(domain.PageRequest{}); !errors.Is(err, domain.ErrRateLimited) {
+		t.Errorf("Expected the request to be rate limited, got %v", err)
+	}
+	if _, err := repo.ListMediaItems(domain.PageRequest{}); err != nil {
+		t.Errorf("Expected the fault to be used up, got %v", err)
+	}
+
+	// A rejected base URL is refreshed and the download tried once more
+	server.Inject(fakeserver.Fault{Path: "/media/*", Status: http.StatusForbidden, Times: 1})
+	rc, err := repo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rc.Close()
+	var refreshes int
+	for _, request := range server.Requests() {
+		if request == "GET /v1/mediaItems:batchGet" {
+			refreshes++
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("Expected the base URL to be refreshed once after the 403, got %v", server.Requests())
+	}
+}
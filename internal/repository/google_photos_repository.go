@@ -5,31 +5,72 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"krupesh.faldu/internal/domain"
 )
 
 const (
-	albumsEndpoint = "https://photoslibrary.googleapis.com/v1/albums"
+	albumsEndpoint       = "https://photoslibrary.googleapis.com/v1/albums"
+	sharedAlbumsEndpoint = "https://photoslibrary.googleapis.com/v1/sharedAlbums"
 )
 
+// GooglePhotosOptions configures optional behavior of GooglePhotosRepository
+type GooglePhotosOptions struct {
+	// StrictDecoding fails responses containing fields the domain model does not know about
+	// and logs each of them; useful for canary runs that should detect API changes early
+	StrictDecoding bool
+	// UploadSessions persists resumable upload sessions so they can be resumed by a later run;
+	// when nil, interrupted uploads are only resumed within the same run
+	UploadSessions domain.UploadSessionStore
+	// Logger receives retries, skipped items and, at debug level, raw API responses; when nil,
+	// slog.Default() is used
+	Logger *slog.Logger
+	// Metrics counts retries; when nil, they are not counted
+	Metrics *Metrics
+}
+
 // GooglePhotosRepository implements the AlbumRepository interface
 type GooglePhotosRepository struct {
 	client *http.Client
+	opts   GooglePhotosOptions
+	// baseURLs tracks the age of media item base URLs; it is only set for media item repositories
+	baseURLs *baseURLCache
 }
 
 // NewGooglePhotosRepository creates a new instance of GooglePhotosRepository
 func NewGooglePhotosRepository(client *http.Client) domain.AlbumRepository {
+	return NewGooglePhotosRepositoryWithOptions(client, GooglePhotosOptions{})
+}
+
+// NewGooglePhotosRepositoryWithOptions creates a new instance of GooglePhotosRepository with options
+func NewGooglePhotosRepositoryWithOptions(client *http.Client, opts GooglePhotosOptions) domain.AlbumRepository {
 	return &GooglePhotosRepository{
 		client: client,
+		opts:   opts,
 	}
 }
 
-// ListAlbums retrieves all albums from Google Photos API
-func (r *GooglePhotosRepository) ListAlbums() (*domain.AlbumsResponse, error) {
-	resp, err := r.makeAlbumsRequest(albumsEndpoint)
+// log returns the logger of the repository
+func (r *GooglePhotosRepository) log() *slog.Logger {
+	if r.opts.Logger == nil {
+		return slog.Default()
+	}
+	return r.opts.Logger
+}
+
+// decoding returns how the repository decodes API responses
+func (r *GooglePhotosRepository) decoding() jsonDecoding {
+	return jsonDecoding{strict: r.opts.StrictDecoding, logger: r.log()}
+}
+
+// ListAlbums retrieves a page of albums from Google Photos API
+func (r *GooglePhotosRepository) ListAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	resp, err := r.makeAlbumsRequest(pageURL(albumsEndpoint, "albums", req))
 	if err != nil {
 		return nil, fmt.Errorf("failed to make albums request: %v", err)
 	}
@@ -51,20 +92,30 @@ func (r *GooglePhotosRepository) GetAlbumByID(id string) (*domain.Album, error)
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch album: %v", err)
+		return nil, fmt.Errorf("failed to fetch album: %v", domain.RedactError(err))
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
+	return r.readAndParseAlbum(resp)
+}
+
+// GetAlbumFields retrieves the given fields of an album and its ID, such as "mediaItemsCount",
+// leaving the others zero; empty fields retrieve the whole album like GetAlbumByID
+func (r *GooglePhotosRepository) GetAlbumFields(id, fields string) (*domain.Album, error) {
+	if err := domain.ValidateFields(fields); err != nil {
+		return nil, err
+	}
+	if fields == "" {
+		return r.GetAlbumByID(id)
 	}
 
-	var album domain.Album
-	if err := json.NewDecoder(resp.Body).Decode(&album); err != nil {
-		return nil, fmt.Errorf("failed to decode album: %v", err)
+	resp, err := r.client.Get(fmt.Sprintf("%s/%s?%s", albumsEndpoint, id, url.Values{"fields": {withID(fields)}}.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch album: %v", domain.RedactError(err))
 	}
+	defer resp.Body.Close()
 
-	return &album, nil
+	return r.readAndParseAlbum(resp)
 }
 
 // CreateAlbum creates a new album
@@ -75,12 +126,36 @@ func (r *GooglePhotosRepository) CreateAlbum(title string) (*domain.Album, error
 		},
 	}
 
-	jsonBody, err := json.Marshal(body)
+	resp, err := r.postJSON(albumsEndpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("create album failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return r.readAndParseAlbum(resp)
+}
+
+// UpdateAlbum changes the title and/or cover photo of an app-created album.
+// Only non-empty values are sent and listed in the update mask.
+func (r *GooglePhotosRepository) UpdateAlbum(id, title, coverPhotoMediaItemID string) (*domain.Album, error) {
+	album := map[string]string{}
+	var mask []string
+	if title != "" {
+		album["title"] = title
+		mask = append(mask, "title")
+	}
+	if coverPhotoMediaItemID != "" {
+		album["coverPhotoMediaItemId"] = coverPhotoMediaItemID
+		mask = append(mask, "coverPhotoMediaItemId")
+	}
+
+	jsonBody, err := json.Marshal(album)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", albumsEndpoint, bytes.NewBuffer(jsonBody))
+	endpoint := fmt.Sprintf("%s/%s?updateMask=%s", albumsEndpoint, id, url.QueryEscape(strings.Join(mask, ",")))
+	req, err := http.NewRequest("PATCH", endpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -89,29 +164,59 @@ func (r *GooglePhotosRepository) CreateAlbum(title string) (*domain.Album, error
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("create album failed: %v", err)
+		return nil, fmt.Errorf("update album failed: %v", domain.RedactError(err))
 	}
 	defer resp.Body.Close()
 
-	var album domain.Album
-	if err := json.NewDecoder(resp.Body).Decode(&album); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+	return r.readAndParseAlbum(resp)
+}
+
+// BatchAddMediaItems adds up to domain.MaxBatchMediaItems media items to an app-created album
+func (r *GooglePhotosRepository) BatchAddMediaItems(albumID string, mediaItemIDs []string) error {
+	return r.batchMediaItems(albumID, "batchAddMediaItems", mediaItemIDs)
+}
+
+// BatchRemoveMediaItems removes up to domain.MaxBatchMediaItems media items from an app-created album
+func (r *GooglePhotosRepository) BatchRemoveMediaItems(albumID string, mediaItemIDs []string) error {
+	return r.batchMediaItems(albumID, "batchRemoveMediaItems", mediaItemIDs)
+}
+
+// AddTextEnrichment adds a text entry to an app-created album at position
+func (r *GooglePhotosRepository) AddTextEnrichment(albumID, text string, position domain.PositionType) (string, error) {
+	body := map[string]any{
+		"newEnrichmentItem": map[string]any{
+			"textEnrichment": map[string]string{"text": text},
+		},
+		"albumPosition": map[string]string{"position": position.String()},
+	}
+
+	resp, err := r.postJSON(fmt.Sprintf("%s/%s:addEnrichment", albumsEndpoint, albumID), body)
+	if err != nil {
+		return "", fmt.Errorf("addEnrichment failed: %v", err)
 	}
+	defer resp.Body.Close()
 
-	return &album, nil
+	data, err := r.readBody(resp)
+	if err != nil {
+		return "", err
+	}
+	return parseEnrichmentItemID(data, r.decoding())
 }
 
-// FetchNextPage retrieves the next page of albums
-func (r *GooglePhotosRepository) FetchNextPage(nextPageToken string) (*domain.AlbumsResponse, error) {
-	nextPageURL := albumsEndpoint + "?pageToken=" + nextPageToken
+// batchMediaItems posts media item IDs to one of the album batch methods
+func (r *GooglePhotosRepository) batchMediaItems(albumID, method string, mediaItemIDs []string) error {
+	body := map[string]interface{}{
+		"mediaItemIds": mediaItemIDs,
+	}
 
-	resp, err := r.makeAlbumsRequest(nextPageURL)
+	resp, err := r.postJSON(fmt.Sprintf("%s/%s:%s", albumsEndpoint, albumID, method), body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch next page: %v", err)
+		return fmt.Errorf("%s failed: %v", method, err)
 	}
 	defer resp.Body.Close()
 
-	return r.readAndParseResponse(resp)
+	_, err = r.readBody(resp)
+	return err
 }
 
 // makeAlbumsRequest creates and executes a request to the albums endpoint
@@ -122,27 +227,114 @@ func (r *GooglePhotosRepository) makeAlbumsRequest(url string) (*http.Response,
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	return r.client.Do(req)
+	resp, err := r.client.Do(req)
+	return resp, domain.RedactError(err)
+}
+
+// pageURL adds the page size, token and fields of req to a list endpoint whose items are listed
+// under collection
+func pageURL(endpoint, collection string, req domain.PageRequest) string {
+	query := url.Values{}
+	if req.PageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(req.PageSize))
+	}
+	if req.PageToken != "" {
+		query.Set("pageToken", req.PageToken)
+	}
+	if req.Fields != "" {
+		query.Set("fields", listFields(collection, req.Fields))
+	}
+	if len(query) == 0 {
+		return endpoint
+	}
+	return endpoint + "?" + query.Encode()
+}
+
+// listFields selects fields in every item of collection and the token of the next page, which a
+// partial response would otherwise leave out
+func listFields(collection, fields string) string {
+	return fmt.Sprintf("%s(%s),nextPageToken", collection, withID(fields))
+}
+
+// withID adds id to fields unless they select it already, as responses are parsed into items
+// identified by their ID
+func withID(fields string) string {
+	depth, start := 0, 0
+	for i := 0; i <= len(fields); i++ {
+		if i < len(fields) {
+			switch fields[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if field := fields[start:i]; field == "id" || field == "*" {
+			return fields
+		}
+		start = i + 1
+	}
+	return "id," + fields
+}
+
+// postJSON sends body as JSON in a POST request to url
+func (r *GooglePhotosRepository) postJSON(url string, body any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	return resp, domain.RedactError(err)
 }
 
 // readAndParseResponse reads and parses the HTTP response
-func (r *GooglePhotosRepository) readAndParseResponse(resp *http.Response) (*domain.AlbumsResponse, error) {
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %v", resp.StatusCode)
+func (r *GooglePhotosRepository) readAndParseResponse(resp *http.Response) (*domain.Page[domain.Album], error) {
+	body, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	// Bodies may contain base URLs of private media, so they are only logged with --verbose
+	r.log().Debug("Raw API response", "body", string(body))
+
+	return parseAlbumsResponse(body, r.decoding())
+}
+
+// readAndParseAlbum reads and parses an HTTP response containing a single album
+func (r *GooglePhotosRepository) readAndParseAlbum(resp *http.Response) (*domain.Album, error) {
+	body, err := r.readBody(resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, err
 	}
 
-	log.Printf("Raw API Response: %s", string(body))
+	return parseAlbum(body, r.decoding())
+}
 
-	var data domain.AlbumsResponse
-	err = json.Unmarshal(body, &data)
+// readBody reads the response body and converts non-success statuses into errors
+func (r *GooglePhotosRepository) readBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode JSON: %v", err)
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, body)
 	}
 
-	return &data, nil
+	return body, nil
 }
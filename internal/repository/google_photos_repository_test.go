@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc lets tests answer requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubClient returns an HTTP client that records each request and answers with body
+func stubClient(requests *[]*http.Request, body string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*requests = append(*requests, req)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+}
+
+func TestGooglePhotosRepository_UpdateAlbumFieldMask(t *testing.T) {
+	var requests []*http.Request
+	repo := NewGooglePhotosRepository(stubClient(&requests, `{"id":"a1","title":"New"}`))
+
+	if _, err := repo.UpdateAlbum("a1", "New", ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.UpdateAlbum("a1", "New", "m1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if requests[0].Method != http.MethodPatch {
+		t.Errorf("Expected PATCH, got %s", requests[0].Method)
+	}
+	if got := requests[0].URL.Query().Get("updateMask"); got != "title" {
+		t.Errorf("Expected update mask 'title', got %q", got)
+	}
+	if got := requests[1].URL.Query().Get("updateMask"); got != "title,coverPhotoMediaItemId" {
+		t.Errorf("Expected update mask for title and cover, got %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// TransportOptions configures the connections of NewHTTPTransport; zero values keep those of
+// http.DefaultTransport
+type TransportOptions struct {
+	// DialTimeout bounds connecting to a server
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake once connected
+	TLSHandshakeTimeout time.Duration
+	// Proxy is the URL of the http, https or socks5 proxy requests go through; when empty,
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY decide
+	Proxy string
+}
+
+// NewHTTPTransport creates the transport API requests go out through: a copy of
+// http.DefaultTransport with the timeouts and proxy of opts
+func NewHTTPTransport(opts TransportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.Proxy != "" {
+		proxy, err := domain.ParseProxyURL(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport, nil
+}
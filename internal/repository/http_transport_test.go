@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	transport, err := NewHTTPTransport(TransportOptions{DialTimeout: time.Second, TLSHandshakeTimeout: 2 * time.Second, Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if transport.TLSHandshakeTimeout != 2*time.Second {
+		t.Errorf("Expected the TLS handshake timeout of the options, got %v", transport.TLSHandshakeTimeout)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get("http://photoslibrary.example/v1/albums")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if proxied != "http://photoslibrary.example/v1/albums" {
+		t.Errorf("Expected the request to go through the proxy, got %q", proxied)
+	}
+
+	if _, err := NewHTTPTransport(TransportOptions{Proxy: "ftp://proxy.lan"}); err == nil {
+		t.Error("Expected an error for a proxy that is not http, https or socks5")
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"krupesh.faldu/internal/domain"
+)
+
+// imageHashBucket holds the perceptual hashes of indexed photos keyed by media item ID, as 8
+// big-endian bytes per hash since a photo has a hundred of them. Rebuilding the index leaves it
+// alone, as a media item keeps its picture.
+var imageHashBucket = []byte("image_hashes")
+
+// SaveImageHashes records hashes under the media item IDs, replacing what was recorded for them before
+func (r *BoltIndexRepository) SaveImageHashes(hashes []domain.ImageHashes) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(imageHashBucket)
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			data := make([]byte, 0, 8*len(h.Hashes))
+			for _, hash := range h.Hashes {
+				data = binary.BigEndian.AppendUint64(data, hash)
+			}
+			if err := b.Put([]byte(h.MediaItemID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record image hashes: %v", err)
+	}
+	return nil
+}
+
+// LoadImageHashes returns the recorded perceptual hashes by media item ID
+func (r *BoltIndexRepository) LoadImageHashes() (map[string]domain.ImageHashes, error) {
+	hashes := make(map[string]domain.ImageHashes)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(imageHashBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key, data []byte) error {
+			if len(data)%8 != 0 {
+				return fmt.Errorf("corrupt entry %s: %d bytes", key, len(data))
+			}
+			h := domain.ImageHashes{MediaItemID: string(key), Hashes: make([]uint64, len(data)/8)}
+			for i := range h.Hashes {
+				h.Hashes[i] = binary.BigEndian.Uint64(data[8*i:])
+			}
+			hashes[h.MediaItemID] = h
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image hashes: %v", err)
+	}
+	return hashes, nil
+}
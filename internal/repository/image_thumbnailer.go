@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+
+	_ "golang.org/x/image/bmp" // decoders for the formats ImageThumbnailer reads besides JPEG, PNG and GIF
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// imageThumbnailQuality is the JPEG quality of thumbnails made by ImageThumbnailer
+const imageThumbnailQuality = 85
+
+// ImageThumbnailer implements the Thumbnailer interface with the image decoders of Go: JPEG, PNG,
+// GIF, WebP, BMP and TIFF. Photos are turned upright by their EXIF orientation and scaled with
+// Catmull-Rom onto white, so transparent parts do not turn black. HEIC, AVIF and raw files need a
+// thumbnailer backed by libvips instead.
+type ImageThumbnailer struct{}
+
+// NewImageThumbnailer creates a new instance of ImageThumbnailer
+func NewImageThumbnailer() domain.Thumbnailer {
+	return &ImageThumbnailer{}
+}
+
+// Thumbnail implements domain.Thumbnailer
+func (*ImageThumbnailer) Thumbnail(ctx context.Context, name string, content io.Reader, size int) ([]byte, error) {
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedFormat, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	// The thumbnail fits in size once turned; orientations from 5 on swap width and height
+	orientation := domain.ExifOrientation(b)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if longest := max(w, h); longest > size {
+		w, h = max(1, w*size/longest), max(1, h*size/longest)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(scaled, scaled.Bounds(), image.White, image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, domain.Orient(scaled, orientation), &jpeg.Options{Quality: imageThumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail of %s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// widePNG encodes a w by h PNG that is red on the left half and blue on the right
+func widePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			c := color.RGBA{R: 0xff, A: 0xff}
+			if x >= w/2 {
+				c = color.RGBA{B: 0xff, A: 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageThumbnailer(t *testing.T) {
+	thumbnailer := NewImageThumbnailer()
+
+	// Large photos are scaled to fit, small ones are kept at their size
+	for _, tt := range []struct {
+		data []byte
+		want image.Point
+	}{
+		{widePNG(t, 600, 300), image.Point{256, 128}},
+		{widePNG(t, 20, 10), image.Point{20, 10}},
+	} {
+		data, err := thumbnailer.Thumbnail(context.Background(), "photo.png", bytes.NewReader(tt.data), 256)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil || config.Width != tt.want.X || config.Height != tt.want.Y {
+			t.Errorf("Expected a %dx%d JPEG, got %+v (%v)", tt.want.X, tt.want.Y, config, err)
+		}
+	}
+
+	if _, err := thumbnailer.Thumbnail(context.Background(), "phone.heic", bytes.NewReader([]byte("not decodable by Go")), 256); !errors.Is(err, domain.ErrUnsupportedFormat) {
+		t.Errorf("Expected HEIC to be unsupported, got %v", err)
+	}
+	if _, err := thumbnailer.Thumbnail(context.Background(), "broken.jpg", bytes.NewReader([]byte("\xff\xd8\xff truncated")), 256); err == nil || errors.Is(err, domain.ErrUnsupportedFormat) {
+		t.Errorf("Expected a broken JPEG to fail, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"krupesh.faldu/internal/domain"
+)
+
+// Buckets of the index database. Albums and media items are stored as JSON keyed by ID;
+// album membership uses one nested bucket per album whose keys are media item IDs. The history
+// survives replacing the index and holds a library snapshot per day keyed by the date.
+var (
+	albumsBucket     = []byte("albums")
+	mediaItemsBucket = []byte("media_items")
+	albumItemsBucket = []byte("album_items")
+	metaBucket       = []byte("meta")
+	updatedAtKey     = []byte("updated_at")
+	historyBucket    = []byte("history")
+)
+
+// BoltIndexRepository implements the IndexRepository interface with a bbolt database file
+type BoltIndexRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltIndexRepository opens or creates the index database at path. The file is locked while
+// open, so a second process fails fast instead of waiting for the first one to finish.
+func NewBoltIndexRepository(path string) (LocalIndex, error) {
+	return openBoltIndex(path)
+}
+
+// openBoltIndex opens or creates the index database at path for the repositories sharing it
+func openBoltIndex(path string) (*BoltIndexRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %v", path, err)
+	}
+
+	return &BoltIndexRepository{
+		db: db,
+	}, nil
+}
+
+// Load returns everything in the index
+func (r *BoltIndexRepository) Load() (*domain.IndexSnapshot, error) {
+	snapshot := &domain.IndexSnapshot{AlbumItems: make(map[string][]string)}
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if err := forEachJSON(tx.Bucket(albumsBucket), func(album domain.Album) {
+			snapshot.Albums = append(snapshot.Albums, album)
+		}); err != nil {
+			return err
+		}
+
+		if err := forEachJSON(tx.Bucket(mediaItemsBucket), func(item domain.MediaItem) {
+			snapshot.MediaItems = append(snapshot.MediaItems, item)
+		}); err != nil {
+			return err
+		}
+
+		if b := tx.Bucket(albumItemsBucket); b != nil {
+			err := b.ForEachBucket(func(albumID []byte) error {
+				ids := []string{}
+				err := b.Bucket(albumID).ForEach(func(id, _ []byte) error {
+					ids = append(ids, string(id))
+					return nil
+				})
+				snapshot.AlbumItems[string(albumID)] = ids
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		snapshot.UpdatedAt = updatedAt(tx)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+
+	return snapshot, nil
+}
+
+// Replace atomically replaces the contents of the index with snapshot
+func (r *BoltIndexRepository) Replace(snapshot domain.IndexSnapshot) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{albumsBucket, mediaItemsBucket, albumItemsBucket, metaBucket} {
+			if tx.Bucket(name) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		albums, err := tx.CreateBucket(albumsBucket)
+		if err != nil {
+			return err
+		}
+		for _, album := range snapshot.Albums {
+			if err := putJSON(albums, album.ID, album); err != nil {
+				return err
+			}
+		}
+
+		items, err := tx.CreateBucket(mediaItemsBucket)
+		if err != nil {
+			return err
+		}
+		for _, item := range snapshot.MediaItems {
+			if err := putJSON(items, item.ID, item); err != nil {
+				return err
+			}
+		}
+
+		albumItems, err := tx.CreateBucket(albumItemsBucket)
+		if err != nil {
+			return err
+		}
+		for albumID, ids := range snapshot.AlbumItems {
+			b, err := albumItems.CreateBucket([]byte(albumID))
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := b.Put([]byte(id), nil); err != nil {
+					return err
+				}
+			}
+		}
+
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(updatedAtKey, []byte(snapshot.UpdatedAt.UTC().Format(time.RFC3339Nano))); err != nil {
+			return err
+		}
+
+		history, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		entry := domain.LibrarySnapshot{At: snapshot.UpdatedAt.UTC(), Albums: len(snapshot.Albums)}
+		for _, item := range snapshot.MediaItems {
+			if item.IsVideo() {
+				entry.Videos++
+			} else {
+				entry.Photos++
+			}
+		}
+		return putJSON(history, entry.At.Format(time.DateOnly), entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+
+	return nil
+}
+
+// Stats counts the albums and media items in the index without decoding them
+func (r *BoltIndexRepository) Stats() (*domain.IndexStats, error) {
+	stats := &domain.IndexStats{}
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(albumsBucket); b != nil {
+			stats.Albums = b.Stats().KeyN
+		}
+		if b := tx.Bucket(mediaItemsBucket); b != nil {
+			stats.MediaItems = b.Stats().KeyN
+		}
+		stats.UpdatedAt = updatedAt(tx)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+
+	return stats, nil
+}
+
+// History returns the library snapshot of every day the index was written, oldest first
+func (r *BoltIndexRepository) History() ([]domain.LibrarySnapshot, error) {
+	var history []domain.LibrarySnapshot
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return forEachJSON(tx.Bucket(historyBucket), func(entry domain.LibrarySnapshot) {
+			history = append(history, entry)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index history: %v", err)
+	}
+	return history, nil
+}
+
+// Close releases the database file and its lock
+func (r *BoltIndexRepository) Close() error {
+	return r.db.Close()
+}
+
+// putJSON stores v as JSON under key
+func putJSON(b *bolt.Bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+// forEachJSON decodes every value of a bucket; a missing bucket has no values
+func forEachJSON[T any](b *bolt.Bucket, fn func(T)) error {
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(key, data []byte) error {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("corrupt entry %s: %v", key, err)
+		}
+		fn(v)
+		return nil
+	})
+}
+
+// updatedAt returns when the index was last written, or the zero time if it never was
+func updatedAt(tx *bolt.Tx) time.Time {
+	b := tx.Bucket(metaBucket)
+	if b == nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, string(b.Get(updatedAtKey)))
+	return t
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestBoltIndexRepository_ReplaceAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "index.db")
+	index, err := NewBoltIndexRepository(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer index.Close()
+
+	stats, err := index.Stats()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Albums != 0 || !stats.UpdatedAt.IsZero() {
+		t.Errorf("Expected an empty index, got %+v", stats)
+	}
+
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := domain.IndexSnapshot{
+		Albums:     []domain.Album{{ID: "a1", Title: "Trip", MediaItemsCount: 2}},
+		MediaItems: []domain.MediaItem{{ID: "m1", Filename: "a.jpg"}, {ID: "m2", Filename: "b.jpg"}},
+		AlbumItems: map[string][]string{"a1": {"m1", "m2"}},
+		UpdatedAt:  updated,
+	}
+	if err := index.Replace(first); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Replacing drops everything from the previous snapshot
+	second := domain.IndexSnapshot{
+		Albums:     []domain.Album{{ID: "a2", Title: "Home"}},
+		MediaItems: []domain.MediaItem{{ID: "m3", Filename: "c.jpg"}},
+		AlbumItems: map[string][]string{"a2": {}},
+		UpdatedAt:  updated.Add(time.Hour),
+	}
+	if err := index.Replace(second); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	snapshot, err := index.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(snapshot.Albums) != 1 || snapshot.Albums[0].Title != "Home" {
+		t.Errorf("Expected album Home, got %+v", snapshot.Albums)
+	}
+	if len(snapshot.MediaItems) != 1 || snapshot.MediaItems[0].Filename != "c.jpg" {
+		t.Errorf("Expected media item c.jpg, got %+v", snapshot.MediaItems)
+	}
+	if ids, ok := snapshot.AlbumItems["a2"]; !ok || len(ids) != 0 || len(snapshot.AlbumItems) != 1 {
+		t.Errorf("Expected only an empty album a2, got %v", snapshot.AlbumItems)
+	}
+	if !snapshot.UpdatedAt.Equal(second.UpdatedAt) {
+		t.Errorf("Expected update time %v, got %v", second.UpdatedAt, snapshot.UpdatedAt)
+	}
+
+	stats, err = index.Stats()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Albums != 1 || stats.MediaItems != 1 {
+		t.Errorf("Expected 1 album and 1 media item, got %+v", stats)
+	}
+
+	// Both snapshots were written the same day, so the history keeps only the later one
+	third := second
+	third.MediaItems = append(third.MediaItems, domain.MediaItem{ID: "m4", MimeType: "video/mp4"})
+	third.UpdatedAt = updated.AddDate(0, 1, 0)
+	if err := index.Replace(third); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history, err := index.History()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []domain.LibrarySnapshot{
+		{At: second.UpdatedAt, Albums: 1, Photos: 1},
+		{At: third.UpdatedAt, Albums: 1, Photos: 1, Videos: 1},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("Expected history %+v, got %+v", want, history)
+	}
+	for i := range want {
+		if !history[i].At.Equal(want[i].At) || history[i].Photos != want[i].Photos || history[i].Videos != want[i].Videos || history[i].Albums != want[i].Albums {
+			t.Errorf("Expected history entry %+v, got %+v", want[i], history[i])
+		}
+	}
+}
+
+func TestFileSyncStateStore(t *testing.T) {
+	store := NewFileSyncStateStore(filepath.Join(t.TempDir(), "cache", "sync.json"))
+
+	state, err := store.LoadSyncState()
+	if err != nil || !state.LastSyncAt.IsZero() {
+		t.Fatalf("Expected an empty state, got %+v (%v)", state, err)
+	}
+
+	saved := domain.SyncState{
+		Watermark:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		LastSyncAt: time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC),
+		Dir:        "/photos",
+		Files:      map[string]string{"m1": "a.jpg"},
+	}
+	if err := store.SaveSyncState(saved); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	state, err = store.LoadSyncState()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !state.Watermark.Equal(saved.Watermark) || state.Dir != "/photos" || state.Files["m1"] != "a.jpg" {
+		t.Errorf("Expected the saved state, got %+v", state)
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileJobStatusStore implements the JobStatusStore interface with a single JSON file holding the
+// status of every daemon job
+type FileJobStatusStore struct {
+	path string
+}
+
+// NewFileJobStatusStore creates a new instance of FileJobStatusStore that keeps statuses in path
+func NewFileJobStatusStore(path string) domain.JobStatusStore {
+	return &FileJobStatusStore{
+		path: path,
+	}
+}
+
+// LoadJobStatuses returns the saved status of every job by name; a missing file holds none
+func (s *FileJobStatusStore) LoadJobStatuses() (map[string]domain.JobStatus, error) {
+	statuses := make(map[string]domain.JobStatus)
+
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return statuses, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job status: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &statuses); err != nil {
+		return nil, fmt.Errorf("failed to parse job status: %v", err)
+	}
+	return statuses, nil
+}
+
+// SaveJobStatus replaces the status of one job, keeping the others. The file is written to a
+// temporary file and renamed, so a crash while saving keeps the previous one.
+func (s *FileJobStatusStore) SaveJobStatus(status domain.JobStatus) error {
+	statuses, err := s.LoadJobStatuses()
+	if err != nil {
+		return err
+	}
+	statuses[status.Name] = status
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create job status directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job status: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to save job status: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to save job status: %v", err)
+	}
+	return nil
+}
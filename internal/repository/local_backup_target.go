@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// LocalBackupTarget implements the BackupTarget interface with a directory, such as a mounted NAS
+// share or an external disk
+type LocalBackupTarget struct {
+	dir string
+	// exit removes the files of copies in flight when the run ends before them
+	exit domain.ExitHooks
+}
+
+// NewLocalBackupTarget creates a new instance of LocalBackupTarget that keeps copies below dir;
+// exit, if not nil, removes the partial files of copies the run ends before
+func NewLocalBackupTarget(dir string, exit domain.ExitHooks) domain.BackupTarget {
+	return &LocalBackupTarget{
+		dir:  dir,
+		exit: exit,
+	}
+}
+
+// Put writes r to the file of key. It is written under a temporary name and renamed, so an
+// interrupted copy never leaves a truncated file that looks complete.
+func (t *LocalBackupTarget) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	name, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %v", err)
+	}
+	defer domain.OnExit(t.exit, "remove "+tmp.Name(), func(context.Context) error {
+		return os.RemoveAll(tmp.Name())
+	})()
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup file: %v", err)
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("failed to write backup file %s: got %d bytes, expected %d", key, n, size)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to save backup file: %v", err)
+	}
+	return nil
+}
+
+// Get opens the file of key
+func (t *LocalBackupTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := t.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("backup file %s: %w", key, domain.ErrNotFound)
+	}
+	return f, err
+}
+
+// String returns the directory of the target
+func (t *LocalBackupTarget) String() string {
+	return t.dir
+}
+
+// path returns the file of key, refusing keys that would leave the directory
+func (t *LocalBackupTarget) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: backup key %q leaves the target directory", domain.ErrInvalidArgument, key)
+	}
+	return filepath.Join(t.dir, name), nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestLocalBackupTarget_PutGet(t *testing.T) {
+	target := NewLocalBackupTarget(t.TempDir(), nil)
+	ctx := context.Background()
+
+	if err := target.Put(ctx, "media/2024/05/a.jpg", strings.NewReader("photo"), 5, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r, err := target.Get(ctx, "media/2024/05/a.jpg")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "photo" {
+		t.Errorf("Expected the stored bytes, got %q", data)
+	}
+
+	if _, err := target.Get(ctx, "manifest.json"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing key, got %v", err)
+	}
+}
+
+func TestLocalBackupTarget_Invalid(t *testing.T) {
+	target := NewLocalBackupTarget(t.TempDir(), nil)
+	ctx := context.Background()
+
+	if err := target.Put(ctx, "a.jpg", strings.NewReader("phot"), 5, ""); err == nil {
+		t.Error("Expected a short copy to be rejected")
+	}
+	if _, err := target.Get(ctx, "a.jpg"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a short copy to leave nothing behind, got %v", err)
+	}
+	if err := target.Put(ctx, "../escape.jpg", strings.NewReader(""), 0, ""); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected a key leaving the directory to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LoggingTransport logs a summary of each HTTP request at debug level: its method, its URL
+// without the query, which may hold secrets, the response status and how long it took
+type LoggingTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+// NewLoggingTransport creates a new instance of LoggingTransport sending requests through next,
+// or http.DefaultTransport when next is nil
+func NewLoggingTransport(next http.RoundTripper, logger *slog.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &LoggingTransport{
+		next:   next,
+		logger: logger,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.logger.Enabled(req.Context(), slog.LevelDebug) {
+		return t.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+		slog.Duration("duration", time.Since(start).Round(time.Millisecond)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	t.logger.LogAttrs(context.Background(), slog.LevelDebug, "API call", attrs...)
+	return resp, err
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoggingTransport(t *testing.T) {
+	var requests []*http.Request
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := &http.Client{Transport: NewLoggingTransport(stubClient(&requests, `{}`).Transport, logger)}
+
+	resp, err := client.Get(albumsEndpoint + "?pageToken=p2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	got := buf.String()
+	if !strings.Contains(got, `msg="API call" method=GET url=https://photoslibrary.googleapis.com/v1/albums duration=`) || !strings.Contains(got, "status=200") {
+		t.Errorf("Expected a summary of the call, got %q", got)
+	}
+	if strings.Contains(got, "p2") {
+		t.Errorf("Expected the query to be left out, got %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileMagicRuleRepository implements the MagicRuleRepository interface with a JSON config file
+type FileMagicRuleRepository struct {
+	path string
+}
+
+// NewFileMagicRuleRepository creates a new instance of FileMagicRuleRepository that reads rules from path
+func NewFileMagicRuleRepository(path string) domain.MagicRuleRepository {
+	return &FileMagicRuleRepository{
+		path: path,
+	}
+}
+
+// magicConfig is the layout of the rules file
+type magicConfig struct {
+	Rules []magicRuleConfig `json:"rules"`
+}
+
+// magicRuleConfig is a rule as written in the rules file; dates are YYYY-MM-DD in the IANA time
+// zone named by TimeZone, or the configured one
+type magicRuleConfig struct {
+	Album string `json:"album"`
+	Dates []struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"dates"`
+	Categories []string `json:"categories"`
+	Type       string   `json:"type"`
+	Filename   string   `json:"filename"`
+	TimeZone   string   `json:"time_zone"`
+	// Location is a circle in decimal degrees and kilometres
+	Location *struct {
+		Lat      *float64 `json:"lat"`
+		Lng      *float64 `json:"lng"`
+		RadiusKm float64  `json:"radius_km"`
+	} `json:"location"`
+}
+
+// LoadMagicRules reads and validates the rules file. Album titles must be unique, since each
+// rule owns its album.
+func (r *FileMagicRuleRepository) LoadMagicRules() ([]domain.MagicRule, error) {
+	b, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read magic rules: %v", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var config magicConfig
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse magic rules: %v", err)
+	}
+	if len(config.Rules) == 0 {
+		return nil, fmt.Errorf("no rules in %s", r.path)
+	}
+
+	rules := make([]domain.MagicRule, 0, len(config.Rules))
+	albums := make(map[string]bool, len(config.Rules))
+	for i, rc := range config.Rules {
+		rule, err := rc.toDomain()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if albums[rule.Album] {
+			return nil, fmt.Errorf("rule %d: album %q is used by another rule", i+1, rule.Album)
+		}
+		albums[rule.Album] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// toDomain converts the names and dates of a configured rule into a MagicRule
+func (rc magicRuleConfig) toDomain() (domain.MagicRule, error) {
+	rule := domain.MagicRule{
+		Album:           rc.Album,
+		FilenamePattern: rc.Filename,
+	}
+
+	if rc.Location != nil {
+		if rc.Location.Lat == nil || rc.Location.Lng == nil {
+			return rule, fmt.Errorf("location needs lat and lng")
+		}
+		rule.Location = &domain.GeoArea{
+			Center:   domain.GeoPoint{Latitude: *rc.Location.Lat, Longitude: *rc.Location.Lng},
+			RadiusKm: rc.Location.RadiusKm,
+		}
+	}
+
+	for _, d := range rc.Dates {
+		start, err := time.Parse(time.DateOnly, d.From)
+		if err != nil {
+			return rule, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", d.From)
+		}
+		end, err := time.Parse(time.DateOnly, d.To)
+		if err != nil {
+			return rule, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", d.To)
+		}
+		rule.DateRanges = append(rule.DateRanges, domain.DateRange{Start: start, End: end})
+	}
+
+	if rc.TimeZone != "" {
+		loc, err := time.LoadLocation(rc.TimeZone)
+		if err != nil {
+			return rule, fmt.Errorf("invalid time zone %q, expected an IANA name such as Europe/Berlin", rc.TimeZone)
+		}
+		rule.TimeZone = loc
+	}
+
+	for _, name := range rc.Categories {
+		c, err := domain.ParseContentCategory(name)
+		if err != nil {
+			return rule, err
+		}
+		rule.ContentCategories = append(rule.ContentCategories, c)
+	}
+
+	if rc.Type != "" {
+		t, err := domain.ParseMediaType(rc.Type)
+		if err != nil {
+			return rule, err
+		}
+		rule.MediaType = t
+	}
+	return rule, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestFileMagicRuleRepository_LoadMagicRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "magic.json")
+	config := `{"rules": [
+		{"album": "Summer 2024", "dates": [{"from": "2024-06-01", "to": "2024-08-31"}], "categories": ["travel", "landscapes"], "type": "photo"},
+		{"album": "Screens", "filename": "Screenshot_*", "time_zone": "UTC"},
+		{"album": "Paris", "location": {"lat": 48.8566, "lng": 2.3522, "radius_km": 10}}
+	]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := NewFileMagicRuleRepository(path).LoadMagicRules()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+	summer := rules[0]
+	if len(summer.DateRanges) != 1 || !summer.DateRanges[0].End.Equal(time.Date(2024, 8, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the summer date range, got %+v", summer.DateRanges)
+	}
+	if len(summer.ContentCategories) != 2 || summer.ContentCategories[1] != domain.ContentCategoryLandscapes || summer.MediaType != domain.MediaTypePhoto {
+		t.Errorf("Expected categories and media type to be parsed, got %+v", summer)
+	}
+	if summer.TimeZone != nil || rules[1].TimeZone != time.UTC {
+		t.Errorf("Expected only the second rule to have its own time zone, got %v and %v", summer.TimeZone, rules[1].TimeZone)
+	}
+	if !rules[1].MatchesFilename("screenshot_1.png") || rules[1].MatchesFilename("IMG_1.jpg") {
+		t.Errorf("Expected the filename pattern to match case-insensitively, got %q", rules[1].FilenamePattern)
+	}
+	paris := domain.GeoArea{Center: domain.GeoPoint{Latitude: 48.8566, Longitude: 2.3522}, RadiusKm: 10}
+	if rules[2].Location == nil || *rules[2].Location != paris {
+		t.Errorf("Expected the location %+v, got %+v", paris, rules[2].Location)
+	}
+}
+
+func TestFileMagicRuleRepository_LoadMagicRulesInvalid(t *testing.T) {
+	tests := map[string]string{
+		`{"rules": [{"album": "Home", "location": "Paris"}]}`:                                  "location",
+		`{"rules": [{"album": "Home", "location": {"lat": 48.85, "radius_km": 5}}]}`:           "location needs lat and lng",
+		`{"rules": [{"album": "Home", "location": {"lat": 48.85, "lng": 2.35}}]}`:              "radius must be positive",
+		`{"rules": [{"album": "Home", "location": {"lat": 98, "lng": 2.35, "radius_km": 5}}]}`: "latitude",
+		`{"rules": [{"album": "Home"}]}`:                                                       "no criteria",
+		`{"rules": [{"album": "Home", "type": "photo"}, {"album": "Home", "type": "video"}]}`:  "used by another rule",
+		`{"rules": [{"album": "Home", "categories": ["castles"]}]}`:                            "content category",
+		`{"rules": [{"album": "Home", "dates": [{"from": "2024-06-01"}]}]}`:                    "invalid to date",
+		`{"rules": [{"album": "Home", "filename": "[a"}]}`:                                     "invalid filename pattern",
+		`{"rules": [{"album": "Home", "camera": "Pixel"}]}`:                                    "unknown field",
+		`{"rules": [{"album": "Home", "type": "photo", "time_zone": "CEST"}]}`:                 "invalid time zone",
+	}
+	for config, want := range tests {
+		path := filepath.Join(t.TempDir(), "magic.json")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewFileMagicRuleRepository(path).LoadMagicRules()
+
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error containing %q for %s, got %v", want, config, err)
+		}
+	}
+}
@@ -0,0 +1,688 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	uploadsEndpoint    = "https://photoslibrary.googleapis.com/v1/uploads"
+	mediaItemsEndpoint = "https://photoslibrary.googleapis.com/v1/mediaItems"
+
+	// maxResumableRetries bounds how often an interrupted resumable upload is retried within one run
+	maxResumableRetries = 5
+)
+
+// Resumable upload tuning, kept in variables so tests can use small chunks without delays
+var (
+	resumableChunkSize  int64 = 8 << 20
+	resumableRetryDelay       = time.Second
+)
+
+// NewGooglePhotosMediaItemRepository creates a GooglePhotosRepository used for media item operations
+func NewGooglePhotosMediaItemRepository(client *http.Client, opts GooglePhotosOptions) domain.MediaItemRepository {
+	return &GooglePhotosRepository{
+		client:   client,
+		opts:     opts,
+		baseURLs: newBaseURLCache(baseURLTTL),
+	}
+}
+
+// Upload sends the bytes of a file with the raw upload protocol and returns the upload token
+func (r *GooglePhotosRepository) Upload(fileName, mimeType string, content io.Reader, size int64) (string, error) {
+	req, err := http.NewRequest("POST", uploadsEndpoint, content)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	req.Header.Set("X-Goog-Upload-File-Name", fileName)
+	req.Header.Set("X-Goog-Upload-Protocol", "raw")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload failed: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := r.readBody(resp)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(body))
+	if token == "" {
+		return "", fmt.Errorf("upload failed: empty upload token")
+	}
+	return token, nil
+}
+
+// UploadResumable sends a file with the resumable upload protocol. Failed chunks are retried from the
+// offset the server reports, and the session is persisted under key so a later run can continue it.
+// Cancelling ctx stops the upload, also between retries, and keeps the session.
+func (r *GooglePhotosRepository) UploadResumable(ctx context.Context, key, fileName, mimeType string, content io.ReaderAt, size int64) (string, error) {
+	session, offset := r.resumeUploadSession(ctx, key, fileName, size)
+	if session == nil {
+		var err error
+		session, err = r.startResumableUpload(ctx, fileName, mimeType, size)
+		if err != nil {
+			return "", err
+		}
+		r.saveUploadSession(key, *session)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxResumableRetries; attempt++ {
+		if attempt > 0 {
+			r.log().Warn("Upload interrupted, retrying", "file", fileName, "attempt", attempt, "max_attempts", maxResumableRetries, "error", lastErr)
+			r.opts.Metrics.AddRetry("upload")
+			timer := time.NewTimer(time.Duration(attempt) * resumableRetryDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return "", fmt.Errorf("upload of %s stopped: %w", fileName, ctx.Err())
+			}
+
+			status, err := r.queryResumableUpload(ctx, session)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if status.final {
+				r.deleteUploadSession(key)
+				return "", fmt.Errorf("upload of %s was finalized without returning an upload token", fileName)
+			}
+			offset = status.received
+		}
+
+		token, err := r.uploadChunks(ctx, session, content, offset)
+		if err == nil {
+			r.deleteUploadSession(key)
+			return token, nil
+		}
+		lastErr = err
+	}
+
+	return "", fmt.Errorf("resumable upload failed after %d attempts: %v", maxResumableRetries+1, lastErr)
+}
+
+// startResumableUpload opens a resumable upload session for a file of the given size
+func (r *GooglePhotosRepository) startResumableUpload(ctx context.Context, fileName, mimeType string, size int64) (*domain.UploadSession, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadsEndpoint, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	req.Header.Set("X-Goog-Upload-File-Name", fileName)
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Raw-Size", strconv.FormatInt(size, 10))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("start resumable upload failed: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	if _, err := r.readBody(resp); err != nil {
+		return nil, err
+	}
+
+	session := &domain.UploadSession{
+		URL:       resp.Header.Get("X-Goog-Upload-URL"),
+		FileName:  fileName,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	if session.URL == "" {
+		return nil, fmt.Errorf("start resumable upload failed: no upload URL returned")
+	}
+	if granularity := resp.Header.Get("X-Goog-Upload-Chunk-Granularity"); granularity != "" {
+		session.ChunkGranularity, _ = strconv.ParseInt(granularity, 10, 64)
+	}
+
+	return session, nil
+}
+
+// uploadStatus is the state of a resumable upload as reported by a query
+type uploadStatus struct {
+	received int64
+	final    bool
+}
+
+// queryResumableUpload asks the server how many bytes of an upload it has received
+func (r *GooglePhotosRepository) queryResumableUpload(ctx context.Context, session *domain.UploadSession) (uploadStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", session.URL, http.NoBody)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("X-Goog-Upload-Command", "query")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("query upload status failed: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	if _, err := r.readBody(resp); err != nil {
+		return uploadStatus{}, err
+	}
+
+	received, err := strconv.ParseInt(resp.Header.Get("X-Goog-Upload-Size-Received"), 10, 64)
+	if err != nil {
+		return uploadStatus{}, fmt.Errorf("query upload status failed: invalid received size %q", resp.Header.Get("X-Goog-Upload-Size-Received"))
+	}
+
+	return uploadStatus{
+		received: received,
+		final:    resp.Header.Get("X-Goog-Upload-Status") == "final",
+	}, nil
+}
+
+// uploadChunks sends the file from offset to the end and returns the upload token from the final chunk
+func (r *GooglePhotosRepository) uploadChunks(ctx context.Context, session *domain.UploadSession, content io.ReaderAt, offset int64) (string, error) {
+	chunkSize := resumableChunkSizeFor(session.ChunkGranularity)
+
+	for {
+		n := min(chunkSize, session.Size-offset)
+		final := offset+n == session.Size
+
+		body, err := r.uploadChunk(ctx, session.URL, io.NewSectionReader(content, offset, n), offset, n, final)
+		if err != nil {
+			return "", err
+		}
+
+		if final {
+			token := strings.TrimSpace(string(body))
+			if token == "" {
+				return "", fmt.Errorf("upload failed: empty upload token")
+			}
+			return token, nil
+		}
+		offset += n
+	}
+}
+
+// uploadChunk sends n bytes of chunk starting at offset; the final chunk also finalizes the upload
+func (r *GooglePhotosRepository) uploadChunk(ctx context.Context, uploadURL string, chunk io.Reader, offset, n int64, final bool) ([]byte, error) {
+	if n == 0 {
+		chunk = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, chunk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	command := "upload"
+	if final {
+		command = "upload, finalize"
+	}
+	req.ContentLength = n
+	req.Header.Set("X-Goog-Upload-Command", command)
+	req.Header.Set("X-Goog-Upload-Offset", strconv.FormatInt(offset, 10))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload chunk at offset %d failed: %v", offset, domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	return r.readBody(resp)
+}
+
+// resumeUploadSession returns a persisted session for key and the offset to continue from.
+// Sessions that no longer match the file or that the server has forgotten are discarded.
+func (r *GooglePhotosRepository) resumeUploadSession(ctx context.Context, key, fileName string, size int64) (*domain.UploadSession, int64) {
+	if r.opts.UploadSessions == nil {
+		return nil, 0
+	}
+
+	session, err := r.opts.UploadSessions.LoadUploadSession(key)
+	if err != nil {
+		r.log().Warn("Failed to load upload session", "file", fileName, "error", err)
+		return nil, 0
+	}
+	if session == nil {
+		return nil, 0
+	}
+
+	if session.FileName != fileName || session.Size != size {
+		r.deleteUploadSession(key)
+		return nil, 0
+	}
+
+	status, err := r.queryResumableUpload(ctx, session)
+	if ctx.Err() != nil {
+		// Starting over fails too, and the session stays for the next run
+		return nil, 0
+	}
+	if err != nil || status.final {
+		r.log().Info("Discarding upload session, starting over", "file", fileName)
+		r.deleteUploadSession(key)
+		return nil, 0
+	}
+
+	r.log().Info("Resuming upload", "file", fileName, "received", status.received, "size", size)
+	return session, status.received
+}
+
+// saveUploadSession persists a session; failures only cost the ability to resume after a restart
+func (r *GooglePhotosRepository) saveUploadSession(key string, session domain.UploadSession) {
+	if r.opts.UploadSessions == nil {
+		return
+	}
+	if err := r.opts.UploadSessions.SaveUploadSession(key, session); err != nil {
+		r.log().Warn("Failed to save upload session", "file", session.FileName, "error", err)
+	}
+}
+
+// deleteUploadSession forgets a finished or unusable session
+func (r *GooglePhotosRepository) deleteUploadSession(key string) {
+	if r.opts.UploadSessions == nil {
+		return
+	}
+	if err := r.opts.UploadSessions.DeleteUploadSession(key); err != nil {
+		r.log().Warn("Failed to delete upload session", "error", err)
+	}
+}
+
+// resumableChunkSizeFor returns the chunk size to use, rounded down to a multiple of granularity
+func resumableChunkSizeFor(granularity int64) int64 {
+	switch {
+	case granularity <= 0:
+		return resumableChunkSize
+	case granularity >= resumableChunkSize:
+		return granularity
+	default:
+		return resumableChunkSize - resumableChunkSize%granularity
+	}
+}
+
+// GetMediaItem retrieves a media item with a fresh base URL
+func (r *GooglePhotosRepository) GetMediaItem(id string) (*domain.MediaItem, error) {
+	resp, err := r.client.Get(fmt.Sprintf("%s/%s", mediaItemsEndpoint, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media item: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := parseMediaItem(data, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	r.baseURLs.record(*item)
+	return item, nil
+}
+
+// UpdateMediaItemDescription replaces the description of an app-created media item; an empty
+// description clears it
+func (r *GooglePhotosRepository) UpdateMediaItemDescription(id, description string) (*domain.MediaItem, error) {
+	jsonBody, err := json.Marshal(map[string]string{"description": description})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/%s?updateMask=description", mediaItemsEndpoint, id), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update media item failed: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := parseMediaItem(data, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	r.baseURLs.record(*item)
+	return item, nil
+}
+
+// BatchGetMediaItems retrieves up to domain.MaxBatchMediaItems media items with fresh base URLs.
+// Items the API cannot return, e.g. because they were deleted, are left out.
+func (r *GooglePhotosRepository) BatchGetMediaItems(ids []string) ([]domain.MediaItem, error) {
+	results, err := r.batchGet(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []domain.MediaItem
+	for _, result := range results {
+		if result.Err != nil {
+			r.log().Warn("Media item not returned", "media_item_id", result.ID, "error", result.Err)
+			continue
+		}
+		items = append(items, *result.MediaItem)
+	}
+	return items, nil
+}
+
+// GetMediaItems retrieves the media items with the given IDs with fresh base URLs, in batches of
+// domain.MaxBatchMediaItems. The results follow the order of ids, repeated IDs included; items the
+// API cannot return carry the reason in their Err instead of failing the whole call.
+func (r *GooglePhotosRepository) GetMediaItems(ids []string) ([]domain.MediaItemResult, error) {
+	// Every ID is asked for once, however often it is given
+	var unique []string
+	byID := make(map[string]domain.MediaItemResult, len(ids))
+	for _, id := range ids {
+		if _, ok := byID[id]; ok {
+			continue
+		}
+		if id == "" {
+			byID[id] = domain.MediaItemResult{Err: fmt.Errorf("%w: empty media item id", domain.ErrInvalidArgument)}
+			continue
+		}
+		byID[id] = domain.MediaItemResult{}
+		unique = append(unique, id)
+	}
+
+	for batch := range slices.Chunk(unique, domain.MaxBatchMediaItems) {
+		results, err := r.batchGet(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			byID[result.ID] = result
+		}
+	}
+
+	results := make([]domain.MediaItemResult, len(ids))
+	for i, id := range ids {
+		results[i] = byID[id]
+		results[i].ID = id
+	}
+	return results, nil
+}
+
+// batchGet fetches up to domain.MaxBatchMediaItems media items in one request and records their
+// base URLs
+func (r *GooglePhotosRepository) batchGet(ids []string) ([]domain.MediaItemResult, error) {
+	query := url.Values{"mediaItemIds": ids}
+	resp, err := r.client.Get(mediaItemsEndpoint + ":batchGet?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media items: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseMediaItemResults(data, ids, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Err == nil {
+			r.baseURLs.record(*result.MediaItem)
+		}
+	}
+	return results, nil
+}
+
+// ListMediaItems retrieves a page of the media items in the library
+func (r *GooglePhotosRepository) ListMediaItems(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	resp, err := r.client.Get(pageURL(mediaItemsEndpoint, "mediaItems", req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media items: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := parseMediaItemsResponse(data, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	r.baseURLs.record(page.Items...)
+	return page, nil
+}
+
+// SearchMediaItems retrieves a page of the media items in an album
+func (r *GooglePhotosRepository) SearchMediaItems(albumID string, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	return r.searchMediaItems(map[string]interface{}{
+		"albumId": albumID,
+	}, req)
+}
+
+// SearchMediaItemsByFilters retrieves a page of the media items matching filters; results
+// filtered by date are ordered newest first
+func (r *GooglePhotosRepository) SearchMediaItemsByFilters(filters domain.SearchFilters, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	return r.searchMediaItems(map[string]interface{}{
+		"filters": SearchFiltersBody(filters),
+	}, req)
+}
+
+// SearchFiltersBody converts filters into the filters object of a media item search request
+func SearchFiltersBody(filters domain.SearchFilters) map[string]interface{} {
+	body := map[string]interface{}{}
+
+	if len(filters.DateRanges) > 0 {
+		ranges := make([]map[string]interface{}, len(filters.DateRanges))
+		for i, dr := range filters.DateRanges {
+			ranges[i] = map[string]interface{}{"startDate": apiDate(dr.Start), "endDate": apiDate(dr.End)}
+		}
+		body["dateFilter"] = map[string]interface{}{"ranges": ranges}
+	}
+	content := map[string]interface{}{}
+	if len(filters.ContentCategories) > 0 {
+		content["includedContentCategories"] = filters.ContentCategories
+	}
+	if len(filters.ExcludedContentCategories) > 0 {
+		content["excludedContentCategories"] = filters.ExcludedContentCategories
+	}
+	if len(content) > 0 {
+		body["contentFilter"] = content
+	}
+	if filters.MediaType != "" {
+		body["mediaTypeFilter"] = map[string]interface{}{"mediaTypes": []domain.MediaType{filters.MediaType}}
+	}
+	if filters.Favorites {
+		body["featureFilter"] = map[string]interface{}{"includedFeatures": []string{"FAVORITES"}}
+	}
+	if filters.IncludeArchived {
+		body["includeArchivedMedia"] = true
+	}
+	if filters.AppCreatedOnly {
+		body["excludeNonAppCreatedData"] = true
+	}
+	return body
+}
+
+// searchMediaItems posts a media item search with the paging fields of req added to body
+func (r *GooglePhotosRepository) searchMediaItems(body map[string]interface{}, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	if req.PageSize > 0 {
+		body["pageSize"] = req.PageSize
+	}
+	if req.PageToken != "" {
+		body["pageToken"] = req.PageToken
+	}
+
+	// The fields of a partial response go in the query, not the body
+	endpoint := mediaItemsEndpoint + ":search"
+	if req.Fields != "" {
+		endpoint += "?" + url.Values{"fields": {listFields("mediaItems", req.Fields)}}.Encode()
+	}
+	resp, err := r.postJSON(endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("search media items failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := parseMediaItemsResponse(data, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	r.baseURLs.record(page.Items...)
+	return page, nil
+}
+
+// apiDate converts the calendar day of t into the date object used by search filters
+func apiDate(t time.Time) map[string]int {
+	return map[string]int{"year": t.Year(), "month": int(t.Month()), "day": t.Day()}
+}
+
+// DownloadMediaItem opens the bytes of a media item as described by MediaItem.DownloadURL; the caller
+// must close it. Base URLs this repository fetched more than baseURLTTL ago, or never saw, are refreshed
+// first, and a download the server rejects with 403 is retried once with a refreshed URL.
+func (r *GooglePhotosRepository) DownloadMediaItem(item domain.MediaItem, size domain.ImageSize) (io.ReadCloser, error) {
+	for attempt := 0; ; attempt++ {
+		baseURL, err := r.freshBaseURL(item.ID)
+		if err != nil {
+			return nil, err
+		}
+		item.BaseURL = baseURL
+
+		resp, err := r.client.Get(item.DownloadURL(size))
+		if err != nil {
+			return nil, fmt.Errorf("download failed: %v", domain.RedactError(err))
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+
+		_, err = r.readBody(resp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || attempt > 0 {
+			return nil, err
+		}
+
+		// The URL expired earlier than expected
+		r.log().Info("Base URL of media item was rejected, refreshing it", "media_item_id", item.ID)
+		r.opts.Metrics.AddRetry("download")
+		r.baseURLs.invalidate(item.ID)
+	}
+}
+
+// freshBaseURL returns a base URL of the media item that has not expired. Expired URLs are
+// refreshed in one batch together with other expired ones, since items listed together expire together.
+func (r *GooglePhotosRepository) freshBaseURL(id string) (string, error) {
+	if baseURL, ok := r.baseURLs.fresh(id); ok {
+		return baseURL, nil
+	}
+
+	r.baseURLs.refreshing.Lock()
+	defer r.baseURLs.refreshing.Unlock()
+
+	// Another download may have refreshed it while this one waited
+	if baseURL, ok := r.baseURLs.fresh(id); ok {
+		return baseURL, nil
+	}
+
+	ids := append([]string{id}, r.baseURLs.expired(domain.MaxBatchMediaItems-1, id)...)
+	if _, err := r.BatchGetMediaItems(ids); err != nil {
+		return "", fmt.Errorf("failed to refresh base URL: %w", err)
+	}
+
+	baseURL, ok := r.baseURLs.fresh(id)
+	if !ok {
+		return "", fmt.Errorf("media item %s has no base URL", id)
+	}
+	return baseURL, nil
+}
+
+// BatchCreateMediaItems creates media items from upload tokens, adding them to albumID when it is set
+func (r *GooglePhotosRepository) BatchCreateMediaItems(albumID string, items []domain.NewMediaItem) ([]domain.NewMediaItemResult, error) {
+	newMediaItems := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		newMediaItems[i] = map[string]interface{}{
+			"description": item.Description,
+			"simpleMediaItem": map[string]string{
+				"uploadToken": item.UploadToken,
+				"fileName":    item.FileName,
+			},
+		}
+	}
+
+	body := map[string]interface{}{
+		"newMediaItems": newMediaItems,
+	}
+	if albumID != "" {
+		body["albumId"] = albumID
+	}
+
+	resp, err := r.postJSON(mediaItemsEndpoint+":batchCreate", body)
+	if err != nil {
+		return nil, fmt.Errorf("batch create media items failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBatchCreateBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := parseNewMediaItemResults(data, r.decoding())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.MediaItem != nil {
+			r.baseURLs.record(*result.MediaItem)
+		}
+	}
+	return results, nil
+}
+
+// readBatchCreateBody reads a batchCreate response. The API answers 207 Multi-Status when only
+// some items were created; the per-item statuses in the body then tell which ones failed.
+func (r *GooglePhotosRepository) readBatchCreateBody(resp *http.Response) ([]byte, error) {
+	if resp.StatusCode != http.StatusMultiStatus {
+		return r.readBody(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	return body, nil
+}
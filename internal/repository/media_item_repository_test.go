@@ -0,0 +1,378 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// fakeResumableServer implements enough of the resumable upload protocol for tests
+type fakeResumableServer struct {
+	received []byte
+	commands []string
+	// failChunks makes this many chunk uploads fail with a network error before reaching the server
+	failChunks int
+}
+
+func (s *fakeResumableServer) client() *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		command := req.Header.Get("X-Goog-Upload-Command")
+		s.commands = append(s.commands, command)
+		header := make(http.Header)
+		body := ""
+
+		switch command {
+		case "start":
+			header.Set("X-Goog-Upload-URL", "https://upload.example/session")
+			header.Set("X-Goog-Upload-Chunk-Granularity", "4")
+		case "query":
+			header.Set("X-Goog-Upload-Status", "active")
+			header.Set("X-Goog-Upload-Size-Received", strconv.Itoa(len(s.received)))
+		default:
+			if s.failChunks > 0 {
+				s.failChunks--
+				return nil, errors.New("connection reset")
+			}
+			if offset := req.Header.Get("X-Goog-Upload-Offset"); offset != strconv.Itoa(len(s.received)) {
+				return nil, errors.New("unexpected offset " + offset)
+			}
+			data, _ := io.ReadAll(req.Body)
+			s.received = append(s.received, data...)
+			if command == "upload, finalize" {
+				body = "upload-token"
+			}
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     header,
+		}, nil
+	})}
+}
+
+// memorySessionStore is an in-memory UploadSessionStore
+type memorySessionStore map[string]domain.UploadSession
+
+func (m memorySessionStore) LoadUploadSession(key string) (*domain.UploadSession, error) {
+	session, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (m memorySessionStore) SaveUploadSession(key string, session domain.UploadSession) error {
+	m[key] = session
+	return nil
+}
+
+func (m memorySessionStore) DeleteUploadSession(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func useSmallResumableChunks(t *testing.T) {
+	chunkSize, delay := resumableChunkSize, resumableRetryDelay
+	resumableChunkSize, resumableRetryDelay = 10, 0
+	t.Cleanup(func() { resumableChunkSize, resumableRetryDelay = chunkSize, delay })
+}
+
+func TestGooglePhotosRepository_UploadResumableRetriesFromOffset(t *testing.T) {
+	useSmallResumableChunks(t)
+	server := &fakeResumableServer{failChunks: 1}
+	store := memorySessionStore{}
+	repo := NewGooglePhotosMediaItemRepository(server.client(), GooglePhotosOptions{UploadSessions: store})
+	content := []byte("0123456789abcdefghijklmnopqrstu")
+
+	token, err := repo.UploadResumable(context.Background(), "key", "video.mp4", "video/mp4", bytes.NewReader(content), int64(len(content)))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if token != "upload-token" {
+		t.Errorf("Expected upload-token, got %q", token)
+	}
+	if !bytes.Equal(server.received, content) {
+		t.Errorf("Expected the whole file to arrive once, got %q", server.received)
+	}
+	// Chunks are rounded down to the granularity of 4 bytes
+	want := []string{"start", "upload", "query", "upload", "upload", "upload", "upload, finalize"}
+	if strings.Join(server.commands, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected commands %v, got %v", want, server.commands)
+	}
+	if len(store) != 0 {
+		t.Errorf("Expected the finished session to be deleted, got %v", store)
+	}
+}
+
+func TestGooglePhotosRepository_UploadResumableCancelledWhileWaiting(t *testing.T) {
+	useSmallResumableChunks(t)
+	resumableRetryDelay = time.Hour
+	server := &fakeResumableServer{failChunks: 1}
+	store := memorySessionStore{}
+	// The upload is cancelled once the chunk fails, so it would wait an hour to retry
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := server.client()
+	transport := client.Transport
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			cancel()
+		}
+		return resp, err
+	})
+	repo := NewGooglePhotosMediaItemRepository(client, GooglePhotosOptions{UploadSessions: store})
+	content := []byte("0123456789abcdef")
+
+	_, err := repo.UploadResumable(ctx, "key", "video.mp4", "video/mp4", bytes.NewReader(content), int64(len(content)))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the upload to stop, got %v", err)
+	}
+	if _, ok := store["key"]; !ok {
+		t.Errorf("Expected the session to be kept for the next run")
+	}
+}
+
+func TestGooglePhotosRepository_UploadResumableContinuesSavedSession(t *testing.T) {
+	useSmallResumableChunks(t)
+	content := []byte("0123456789abcdef")
+	server := &fakeResumableServer{received: content[:8]}
+	store := memorySessionStore{"key": {URL: "https://upload.example/session", FileName: "video.mp4", Size: int64(len(content))}}
+	repo := NewGooglePhotosMediaItemRepository(server.client(), GooglePhotosOptions{UploadSessions: store})
+
+	if _, err := repo.UploadResumable(context.Background(), "key", "video.mp4", "video/mp4", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if server.commands[0] != "query" {
+		t.Errorf("Expected the saved session to be queried instead of starting a new one, got %v", server.commands)
+	}
+	if !bytes.Equal(server.received, content) {
+		t.Errorf("Expected upload to continue at byte 8, got %q", server.received)
+	}
+}
+
+func TestGooglePhotosRepository_SearchMediaItemsByFilters(t *testing.T) {
+	var requests []*http.Request
+	repo := NewGooglePhotosMediaItemRepository(stubClient(&requests, `{"mediaItems":[{"id":"m1"}]}`), GooglePhotosOptions{})
+
+	start := time.Date(2024, 2, 9, 23, 0, 0, 0, time.UTC)
+	filters := domain.SearchFilters{
+		DateRanges:        []domain.DateRange{{Start: start, End: start.AddDate(0, 1, 0)}},
+		ContentCategories: []domain.ContentCategory{domain.ContentCategoryTravel},
+		MediaType:         domain.MediaTypePhoto,
+	}
+	page, err := repo.SearchMediaItemsByFilters(filters, domain.PageRequest{PageSize: 100})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 1 {
+		t.Errorf("Expected 1 media item, got %d", len(page.Items))
+	}
+
+	body, _ := io.ReadAll(requests[0].Body)
+	want := `{"filters":{"contentFilter":{"includedContentCategories":["TRAVEL"]},"dateFilter":{"ranges":[{"endDate":{"day":9,"month":3,"year":2024},"startDate":{"day":9,"month":2,"year":2024}}]},"mediaTypeFilter":{"mediaTypes":["PHOTO"]}},"pageSize":100}`
+	if string(body) != want {
+		t.Errorf("Expected body %s, got %s", want, body)
+	}
+}
+
+// fakeBaseURLServer hands out versioned base URLs and only serves the bytes of the current version
+type fakeBaseURLServer struct {
+	version  int
+	requests []string
+}
+
+func (s *fakeBaseURLServer) client() *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		s.requests = append(s.requests, req.URL.Path+"?"+req.URL.RawQuery)
+		status, body := http.StatusOK, ""
+		switch {
+		case req.URL.Path == "/v1/mediaItems":
+			body = fmt.Sprintf(`{"mediaItems":[{"id":"m1","baseUrl":"https://lh3.test/m1-v%d"},{"id":"m2","baseUrl":"https://lh3.test/m2-v%d"}]}`, s.version, s.version)
+		case req.URL.Path == "/v1/mediaItems:batchGet":
+			s.version++
+			var results []string
+			for _, id := range req.URL.Query()["mediaItemIds"] {
+				results = append(results, fmt.Sprintf(`{"mediaItem":{"id":%q,"baseUrl":"https://lh3.test/%s-v%d"}}`, id, id, s.version))
+			}
+			body = `{"mediaItemResults":[` + strings.Join(results, ",") + `]}`
+		case strings.HasSuffix(req.URL.Path, fmt.Sprintf("-v%d=d", s.version)):
+			body = "bytes of " + req.URL.Path
+		default:
+			status = http.StatusForbidden
+		}
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+}
+
+func TestGooglePhotosRepository_UpdateMediaItemDescription(t *testing.T) {
+	var requests []*http.Request
+	repo := NewGooglePhotosMediaItemRepository(stubClient(&requests, `{"id":"m1","description":"Beach day"}`), GooglePhotosOptions{})
+
+	item, err := repo.UpdateMediaItemDescription("m1", "Beach day")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if item.Description != "Beach day" {
+		t.Errorf("Expected the updated item, got %+v", item)
+	}
+
+	req := requests[0]
+	if req.Method != http.MethodPatch || req.URL.Path != "/v1/mediaItems/m1" || req.URL.Query().Get("updateMask") != "description" {
+		t.Errorf("Expected PATCH of m1 with the description mask, got %s %s", req.Method, req.URL)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"description":"Beach day"}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+}
+
+func TestGooglePhotosRepository_GetMediaItems(t *testing.T) {
+	var batches [][]string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		ids := req.URL.Query()["mediaItemIds"]
+		batches = append(batches, ids)
+		var results []string
+		for _, id := range ids {
+			switch id {
+			case "gone":
+				results = append(results, `{"status":{"code":5,"message":"Requested entity was not found."}}`)
+			case "private":
+				results = append(results, `{"status":{"code":7,"message":"The caller does not have permission"}}`)
+			default:
+				results = append(results, fmt.Sprintf(`{"mediaItem":{"id":%q}}`, id))
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       io.NopCloser(strings.NewReader(`{"mediaItemResults":[` + strings.Join(results, ",") + `]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+	repo := NewGooglePhotosMediaItemRepository(client, GooglePhotosOptions{})
+
+	ids := []string{"gone", "m0", "private"}
+	for i := 1; i < 60; i++ {
+		ids = append(ids, "m"+strconv.Itoa(i))
+	}
+	ids = append(ids, "m0", "")
+
+	results, err := repo.GetMediaItems(ids)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Repeated and empty IDs are not sent, and the rest goes in batches of 50
+	if len(batches) != 2 || len(batches[0]) != domain.MaxBatchMediaItems || len(batches[1]) != 12 {
+		t.Errorf("Expected batches of 50 and 12 media items, got %v", batches)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("Expected a result per ID, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.ID != ids[i] {
+			t.Fatalf("Expected result %d to be for %q, got %q", i, ids[i], result.ID)
+		}
+	}
+	if err := results[0].Err; !errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrPermissionDenied) {
+		t.Errorf("Expected a deleted item to be not found, got %v", err)
+	}
+	if err := results[2].Err; !errors.Is(err, domain.ErrPermissionDenied) || errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a hidden item to be denied, got %v", err)
+	}
+	if r := results[len(results)-2]; r.Err != nil || r.MediaItem == nil || r.MediaItem.ID != "m0" {
+		t.Errorf("Expected the repeated ID to be returned again, got %+v", r)
+	}
+	if err := results[len(results)-1].Err; !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an empty ID to be invalid, got %v", err)
+	}
+}
+
+func TestGooglePhotosRepository_DownloadMediaItemRefreshesBaseURL(t *testing.T) {
+	server := &fakeBaseURLServer{version: 1}
+	repo := NewGooglePhotosMediaItemRepository(server.client(), GooglePhotosOptions{})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo.(*GooglePhotosRepository).baseURLs.now = func() time.Time { return now }
+
+	page, err := repo.ListMediaItems(domain.PageRequest{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	download := func(item domain.MediaItem) string {
+		t.Helper()
+		content, err := repo.DownloadMediaItem(item, domain.ImageSize{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer content.Close()
+		data, _ := io.ReadAll(content)
+		return string(data)
+	}
+
+	// A fresh URL is used as listed
+	if got := download(page.Items[0]); got != "bytes of /m1-v1=d" || len(server.requests) != 2 {
+		t.Errorf("Expected a direct download, got %q after %v", got, server.requests)
+	}
+
+	// Once expired, every expired URL is refreshed in one batch
+	now = now.Add(baseURLTTL)
+	if got := download(page.Items[0]); got != "bytes of /m1-v2=d" {
+		t.Errorf("Expected the refreshed URL to be used, got %q", got)
+	}
+	if got := server.requests[2]; !strings.Contains(got, "mediaItemIds=m1") || !strings.Contains(got, "mediaItemIds=m2") {
+		t.Errorf("Expected m1 and m2 to be refreshed together, got %s", got)
+	}
+	if got := download(page.Items[1]); got != "bytes of /m2-v2=d" || len(server.requests) != 5 {
+		t.Errorf("Expected m2 to reuse the batch, got %q after %v", got, server.requests)
+	}
+
+	// A URL revoked early is refreshed after the 403
+	server.version++
+	if got := download(page.Items[1]); got != "bytes of /m2-v4=d" {
+		t.Errorf("Expected a retry with a refreshed URL, got %q after %v", got, server.requests)
+	}
+}
+
+func TestFileUploadSessionStore(t *testing.T) {
+	store := NewFileUploadSessionStore(t.TempDir())
+
+	if session, err := store.LoadUploadSession("dir/video.mp4"); err != nil || session != nil {
+		t.Fatalf("Expected no session, got %+v (%v)", session, err)
+	}
+
+	if err := store.SaveUploadSession("dir/video.mp4", domain.UploadSession{URL: "https://upload.example/s", Size: 42}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	session, err := store.LoadUploadSession("dir/video.mp4")
+	if err != nil || session == nil || session.URL != "https://upload.example/s" || session.Size != 42 {
+		t.Errorf("Expected the saved session, got %+v (%v)", session, err)
+	}
+
+	if err := store.DeleteUploadSession("dir/video.mp4"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if session, _ := store.LoadUploadSession("dir/video.mp4"); session != nil {
+		t.Errorf("Expected the session to be deleted, got %+v", session)
+	}
+}
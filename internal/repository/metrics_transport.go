@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// requestKey labels a count of API requests
+type requestKey struct {
+	endpoint, method, status string
+}
+
+// histogram counts observations into latencyBuckets
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Metrics collects the API usage of a run and writes it in the Prometheus text format. Every
+// method may be called on a nil Metrics, which collects nothing.
+type Metrics struct {
+	mu              sync.Mutex
+	requests        map[requestKey]uint64
+	latency         map[string]*histogram
+	retries         map[string]uint64
+	rateLimitWaits  uint64
+	rateLimitWaited time.Duration
+	uploadBytes     int64
+}
+
+// NewMetrics creates a new instance of Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[string]*histogram),
+		retries:  make(map[string]uint64),
+	}
+}
+
+// ObserveRequest counts a request to endpoint and its latency; status 0 stands for a request
+// that got no response
+func (m *Metrics) ObserveRequest(endpoint, method string, status int, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	statusLabel := "error"
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{endpoint, method, statusLabel}]++
+	h := m.latency[endpoint]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[endpoint] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// AddRetry counts a retry of operation, such as "upload"
+func (m *Metrics) AddRetry(operation string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries[operation]++
+}
+
+// ObserveRateLimitWait counts a request that waited for the rate limit
+func (m *Metrics) ObserveRateLimitWait(wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rateLimitWaits++
+	m.rateLimitWaited += wait
+}
+
+// AddUploadBytes counts bytes of media sent to the uploads endpoint
+func (m *Metrics) AddUploadBytes(n int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploadBytes += n
+}
+
+// WritePrometheus implements domain.Metrics
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	writeMetricHeader(&b, "gpm_api_requests_total", "counter", "Google Photos API requests by endpoint, method and response status; 429 marks the API rate limiting")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b requestKey) int {
+		return strings.Compare(a.endpoint+" "+a.method+" "+a.status, b.endpoint+" "+b.method+" "+b.status)
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "gpm_api_requests_total{endpoint=%s,method=%s,status=%s} %d\n", labelValue(key.endpoint), labelValue(key.method), labelValue(key.status), m.requests[key])
+	}
+
+	writeMetricHeader(&b, "gpm_api_request_duration_seconds", "histogram", "Latency of Google Photos API requests by endpoint")
+	endpoints := make([]string, 0, len(m.latency))
+	for endpoint := range m.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	slices.Sort(endpoints)
+	for _, endpoint := range endpoints {
+		h, label := m.latency[endpoint], labelValue(endpoint)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&b, "gpm_api_request_duration_seconds_bucket{endpoint=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(&b, "gpm_api_request_duration_seconds_bucket{endpoint=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "gpm_api_request_duration_seconds_sum{endpoint=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "gpm_api_request_duration_seconds_count{endpoint=%s} %d\n", label, h.count)
+	}
+
+	writeMetricHeader(&b, "gpm_api_retries_total", "counter", "Operations retried after a failure, such as interrupted uploads")
+	operations := make([]string, 0, len(m.retries))
+	for operation := range m.retries {
+		operations = append(operations, operation)
+	}
+	slices.Sort(operations)
+	for _, operation := range operations {
+		fmt.Fprintf(&b, "gpm_api_retries_total{operation=%s} %d\n", labelValue(operation), m.retries[operation])
+	}
+
+	writeMetricHeader(&b, "gpm_api_rate_limit_waits_total", "counter", "Requests that waited for the --max-rps rate limit")
+	fmt.Fprintf(&b, "gpm_api_rate_limit_waits_total %d\n", m.rateLimitWaits)
+	writeMetricHeader(&b, "gpm_api_rate_limit_wait_seconds_total", "counter", "Time requests waited for the --max-rps rate limit")
+	fmt.Fprintf(&b, "gpm_api_rate_limit_wait_seconds_total %s\n", strconv.FormatFloat(m.rateLimitWaited.Seconds(), 'g', -1, 64))
+	writeMetricHeader(&b, "gpm_upload_bytes_total", "counter", "Bytes of media uploaded")
+	fmt.Fprintf(&b, "gpm_upload_bytes_total %d\n", m.uploadBytes)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric
+func writeMetricHeader(b *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelValue quotes a label value as the Prometheus text format expects
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// metricsEndpoint names the endpoint of a request for metrics: the URL path with album, media
+// item and other IDs replaced by {id}, so each endpoint is one series. Downloads of media items
+// from their base URLs are all "download".
+func metricsEndpoint(u *url.URL) string {
+	if strings.HasSuffix(u.Host, ".googleusercontent.com") {
+		return "download"
+	}
+	// Paths look like /v1/albums/ID:batchAddMediaItems; segments after the collection are IDs
+	segments := strings.Split(u.Path, "/")
+	for i := 3; i < len(segments); i++ {
+		if id, method, ok := strings.Cut(segments[i], ":"); id != "" {
+			segments[i] = "{id}"
+			if ok {
+				segments[i] += ":" + method
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// MetricsTransport counts the requests sent through it, their latency and the bytes uploaded
+type MetricsTransport struct {
+	next    http.RoundTripper
+	metrics *Metrics
+}
+
+// NewMetricsTransport creates a new instance of MetricsTransport sending requests through next,
+// or http.DefaultTransport when next is nil; a nil metrics returns next unchanged
+func NewMetricsTransport(next http.RoundTripper, metrics *Metrics) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if metrics == nil {
+		return next
+	}
+	return &MetricsTransport{
+		next:    next,
+		metrics: metrics,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	t.metrics.ObserveRequest(metricsEndpoint(req.URL), req.Method, status, time.Since(start))
+	if status >= 200 && status < 300 && req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/uploads") && req.ContentLength > 0 {
+		t.metrics.AddUploadBytes(req.ContentLength)
+	}
+	return resp, err
+}
+
+// PushMetrics replaces the metrics of job on the Prometheus Pushgateway at gatewayURL with those
+// in metrics, for runs that end before a scrape would find them
+func PushMetrics(client *http.Client, gatewayURL, job string, metrics *Metrics) error {
+	var body bytes.Buffer
+	if err := metrics.WritePrometheus(&body); err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("invalid metrics push URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to push metrics: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
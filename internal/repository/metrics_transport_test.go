@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsTransport(t *testing.T) {
+	var requests []*http.Request
+	metrics := NewMetrics()
+	client := &http.Client{Transport: NewMetricsTransport(stubClient(&requests, `{}`).Transport, metrics)}
+
+	for _, url := range []string{albumsEndpoint + "/a1", albumsEndpoint + "/a2", albumsEndpoint + "/a3:batchAddMediaItems"} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := client.Post(uploadsEndpoint, "application/octet-stream", bytes.NewReader(make([]byte, 1234)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	metrics.AddRetry("upload")
+	metrics.ObserveRateLimitWait(1500 * time.Millisecond)
+
+	var out bytes.Buffer
+	if err := metrics.WritePrometheus(&out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"# TYPE gpm_api_requests_total counter\n",
+		`gpm_api_requests_total{endpoint="/v1/albums/{id}",method="GET",status="200"} 2`,
+		`gpm_api_requests_total{endpoint="/v1/albums/{id}:batchAddMediaItems",method="GET",status="200"} 1`,
+		`gpm_api_request_duration_seconds_bucket{endpoint="/v1/albums/{id}",le="+Inf"} 2`,
+		`gpm_api_request_duration_seconds_count{endpoint="/v1/uploads"} 1`,
+		`gpm_api_retries_total{operation="upload"} 1`,
+		"gpm_api_rate_limit_waits_total 1\n",
+		"gpm_api_rate_limit_wait_seconds_total 1.5\n",
+		"gpm_upload_bytes_total 1234\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in the metrics, got:\n%s", want, got)
+		}
+	}
+
+	// Nil metrics collect nothing and leave the transport alone
+	var none *Metrics
+	none.AddRetry("upload")
+	if next := http.DefaultTransport; NewMetricsTransport(next, nil) != next {
+		t.Error("Expected nil metrics to return the transport unchanged")
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(b)
+	}))
+	defer gateway.Close()
+
+	metrics := NewMetrics()
+	metrics.AddUploadBytes(10)
+	if err := PushMetrics(gateway.Client(), gateway.URL+"/", "gpm nas", metrics); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/gpm nas" || !strings.Contains(body, "gpm_upload_bytes_total 10") {
+		t.Errorf("Expected the metrics to replace those of the job, got %s %s:\n%s", method, path, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metric", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	if err := PushMetrics(failing.Client(), failing.URL, "gpm", metrics); err == nil || !strings.Contains(err.Error(), "bad metric") {
+		t.Errorf("Expected the error of the gateway, got %v", err)
+	}
+}
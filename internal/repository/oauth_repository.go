@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -12,36 +14,73 @@ import (
 )
 
 const (
-	tokenFile = "token.json"
+	defaultCallbackAddr = "localhost:8080"
+	callbackPath        = "/oauth2callback"
 )
 
+// OAuthOptions configures the OAuth client of a profile
+type OAuthOptions struct {
+	// Scopes are requested at login; when empty, domain.DefaultScopes are requested
+	Scopes []string
+	// CallbackAddr is the host and port of the redirect URI until the local callback server
+	// picks its own; when empty, localhost:8080 is used
+	CallbackAddr string
+	// Transport sends the requests to the token endpoint; when nil, http.DefaultTransport is used
+	Transport http.RoundTripper
+}
+
 // OAuthRepository implements the OAuthService interface
 type OAuthRepository struct {
-	config *oauth2.Config
+	config    *oauth2.Config
+	tokenPath string
+	transport http.RoundTripper
 }
 
-// NewOAuthRepository creates a new instance of OAuthRepository
+// NewOAuthRepository creates a new instance of OAuthRepository using credentials.json and token.json
+// in the working directory
 func NewOAuthRepository() (domain.OAuthService, error) {
+	return NewOAuthRepositoryForProfile(domain.Profile{
+		Name:            domain.DefaultProfileName,
+		CredentialsPath: credentialsFile,
+		TokenPath:       profileTokenFile,
+	})
+}
+
+// NewOAuthRepositoryForProfile creates a new instance of OAuthRepository bound to a profile's
+// credentials and token files
+func NewOAuthRepositoryForProfile(profile domain.Profile) (domain.OAuthService, error) {
+	return NewOAuthRepositoryWithOptions(profile, OAuthOptions{})
+}
+
+// NewOAuthRepositoryWithOptions creates a new instance of OAuthRepository bound to a profile's
+// credentials and token files with options
+func NewOAuthRepositoryWithOptions(profile domain.Profile, opts OAuthOptions) (domain.OAuthService, error) {
 	// Load OAuth2 config from credentials file
-	b, err := os.ReadFile("credentials.json")
+	b, err := os.ReadFile(profile.CredentialsPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read credentials.json: %v", err)
+		return nil, fmt.Errorf("%w: unable to read %s: %w", domain.ErrMissingCredentials, profile.CredentialsPath, err)
 	}
 
-	// Configure OAuth2 scopes for Google Photos
-	config, err := google.ConfigFromJSON(b,
-		"https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata",
-		"https://www.googleapis.com/auth/photoslibrary.appendonly",
-		"https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata")
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = domain.DefaultScopes
+	}
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse credentials.json: %v", err)
+		return nil, fmt.Errorf("%w: unable to parse %s: %v", domain.ErrMissingCredentials, profile.CredentialsPath, err)
 	}
 
 	// Set the redirect URI to our local server
-	config.RedirectURL = "http://localhost:8080/oauth2callback"
+	callbackAddr := opts.CallbackAddr
+	if callbackAddr == "" {
+		callbackAddr = defaultCallbackAddr
+	}
+	config.RedirectURL = "http://" + callbackAddr + callbackPath
 
 	return &OAuthRepository{
-		config: config,
+		config:    config,
+		tokenPath: profile.TokenPath,
+		transport: opts.Transport,
 	}, nil
 }
 
@@ -50,41 +89,75 @@ func (r *OAuthRepository) GetClient() (*oauth2.Config, error) {
 	return r.config, nil
 }
 
-// LoadToken loads the OAuth2 token from disk
+// storedToken is the layout of token files: the token plus the scopes it was granted, which
+// the token endpoint reports but oauth2.Token does not encode
+type storedToken struct {
+	oauth2.Token
+	Scope string `json:"scope,omitempty"`
+}
+
+// LoadToken loads the OAuth2 token from disk; the scopes it was granted are its "scope" extra
 func (r *OAuthRepository) LoadToken() (*oauth2.Token, error) {
-	f, err := os.Open(tokenFile)
+	f, err := os.Open(r.tokenPath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	var tok oauth2.Token
-	err = json.NewDecoder(f).Decode(&tok)
-	return &tok, err
+	var stored storedToken
+	if err := json.NewDecoder(f).Decode(&stored); err != nil {
+		return &stored.Token, err
+	}
+	if stored.Scope == "" {
+		return &stored.Token, nil
+	}
+	return stored.Token.WithExtra(map[string]any{"scope": stored.Scope}), nil
 }
 
 // SaveToken saves the OAuth2 token to disk
 func (r *OAuthRepository) SaveToken(tok *oauth2.Token) error {
-	f, err := os.Create(tokenFile)
+	if err := os.MkdirAll(filepath.Dir(r.tokenPath), 0o700); err != nil {
+		return fmt.Errorf("failed to create token directory: %v", err)
+	}
+
+	f, err := os.Create(r.tokenPath)
 	if err != nil {
 		return fmt.Errorf("failed to create token file: %v", err)
 	}
 	defer f.Close()
 
-	return json.NewEncoder(f).Encode(tok)
+	scope, _ := tok.Extra("scope").(string)
+	return json.NewEncoder(f).Encode(storedToken{Token: *tok, Scope: scope})
 }
 
 // ExchangeCode exchanges an authorization code for an access token
 func (r *OAuthRepository) ExchangeCode(code string) (*oauth2.Token, error) {
-	return r.config.Exchange(context.Background(), code)
+	return r.config.Exchange(r.context(context.Background()), code)
+}
+
+// context returns ctx carrying the client oauth2 sends token requests with
+func (r *OAuthRepository) context(ctx context.Context) context.Context {
+	if r.transport == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: r.transport})
 }
 
+// includeGrantedScopes asks Google to keep the scopes granted earlier, so asking for one more
+// scope does not take away the others
+var includeGrantedScopes = oauth2.SetAuthURLParam("include_granted_scopes", "true")
+
 // GetAuthURL returns the authorization URL for the OAuth2 flow
 func (r *OAuthRepository) GetAuthURL() string {
-	return r.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	return r.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline, includeGrantedScopes)
 }
 
 // GetAuthURLWithState returns the authorization URL with a custom state parameter
 func (r *OAuthRepository) GetAuthURLWithState(state string) string {
-	return r.config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	return r.config.AuthCodeURL(state, oauth2.AccessTypeOffline, includeGrantedScopes)
+}
+
+// SetRedirectURL updates the redirect URI used for authorization URLs and code exchange
+func (r *OAuthRepository) SetRedirectURL(redirectURL string) {
+	r.config.RedirectURL = redirectURL
 }
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"krupesh.faldu/internal/domain"
+)
+
+func TestOAuthRepository_TokenKeepsGrantedScopes(t *testing.T) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials.json")
+	client := `{"installed": {"client_id": "id", "client_secret": "secret", "auth_uri": "https://accounts.google.com/o/oauth2/auth", "token_uri": "https://oauth2.googleapis.com/token", "redirect_uris": ["http://localhost"]}}`
+	if err := os.WriteFile(credentials, []byte(client), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewOAuthRepositoryForProfile(domain.Profile{CredentialsPath: credentials, TokenPath: filepath.Join(dir, "token.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := (&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}).WithExtra(map[string]any{"scope": domain.ScopeReadAppCreated})
+	if err := repo.SaveToken(token); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loaded, err := repo.LoadToken()
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if loaded.AccessToken != "access" || loaded.RefreshToken != "refresh" || loaded.Extra("scope") != domain.ScopeReadAppCreated {
+		t.Errorf("Expected the token with its scope, got %+v (scope %v)", loaded, loaded.Extra("scope"))
+	}
+
+	// Adding a scope keeps the ones granted before
+	if url := repo.GetAuthURLWithState("state"); !strings.Contains(url, "include_granted_scopes=true") {
+		t.Errorf("Expected the consent page to keep granted scopes, got %s", url)
+	}
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	profilesDir      = "profiles"
+	activeFile       = "active"
+	profileCacheDir  = "cache"
+	credentialsFile  = "credentials.json"
+	profileTokenFile = "token.json"
+)
+
+// FileProfileRepository implements the ProfileRepository interface on the local filesystem.
+// The default profile lives directly in the base directory so existing setups keep working;
+// named profiles live under profiles/<name>/ and fall back to the shared credentials file.
+type FileProfileRepository struct {
+	baseDir string
+	opts    ProfileOptions
+}
+
+// ProfileOptions moves files of the default profile out of the base directory
+type ProfileOptions struct {
+	// CredentialsPath replaces credentials.json in the base directory, which named profiles
+	// without their own OAuth client fall back to
+	CredentialsPath string
+	// TokenPath replaces token.json in the base directory as the default profile's token
+	TokenPath string
+}
+
+// NewFileProfileRepository creates a new instance of FileProfileRepository rooted at baseDir
+func NewFileProfileRepository(baseDir string) domain.ProfileRepository {
+	return NewFileProfileRepositoryWithOptions(baseDir, ProfileOptions{})
+}
+
+// NewFileProfileRepositoryWithOptions creates a new instance of FileProfileRepository rooted at
+// baseDir with options
+func NewFileProfileRepositoryWithOptions(baseDir string, opts ProfileOptions) domain.ProfileRepository {
+	return &FileProfileRepository{
+		baseDir: baseDir,
+		opts:    opts,
+	}
+}
+
+// ListProfiles returns the default profile followed by all named profiles
+func (r *FileProfileRepository) ListProfiles() ([]domain.Profile, error) {
+	active, err := r.GetActiveProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{domain.DefaultProfileName}
+
+	entries, err := os.ReadDir(filepath.Join(r.baseDir, profilesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read profiles directory: %v", err)
+	}
+	var named []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != domain.DefaultProfileName {
+			named = append(named, entry.Name())
+		}
+	}
+	sort.Strings(named)
+	names = append(names, named...)
+
+	profiles := make([]domain.Profile, 0, len(names))
+	for _, name := range names {
+		profile := r.buildProfile(name)
+		profile.Active = name == active
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// GetProfile retrieves a profile by name
+func (r *FileProfileRepository) GetProfile(name string) (*domain.Profile, error) {
+	if err := checkProfileName(name); err != nil {
+		return nil, err
+	}
+	if name != domain.DefaultProfileName {
+		info, err := os.Stat(r.profileDir(name))
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("profile %s does not exist", name)
+		}
+	}
+
+	active, err := r.GetActiveProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := r.buildProfile(name)
+	profile.Active = name == active
+	return &profile, nil
+}
+
+// CreateProfile creates the directory layout for a new named profile
+func (r *FileProfileRepository) CreateProfile(name string) (*domain.Profile, error) {
+	if err := checkProfileName(name); err != nil {
+		return nil, err
+	}
+	if name == domain.DefaultProfileName {
+		return nil, fmt.Errorf("profile %s already exists", name)
+	}
+
+	dir := r.profileDir(name)
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("profile %s already exists", name)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, profileCacheDir), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %v", err)
+	}
+
+	profile := r.buildProfile(name)
+	return &profile, nil
+}
+
+// DeleteProfile removes a named profile together with its token and cache
+func (r *FileProfileRepository) DeleteProfile(name string) error {
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	if name == domain.DefaultProfileName {
+		return fmt.Errorf("the %s profile cannot be removed", name)
+	}
+
+	if _, err := r.GetProfile(name); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(r.profileDir(name)); err != nil {
+		return fmt.Errorf("failed to remove profile directory: %v", err)
+	}
+
+	return nil
+}
+
+// GetActiveProfile returns the name of the currently selected profile
+func (r *FileProfileRepository) GetActiveProfile() (string, error) {
+	b, err := os.ReadFile(filepath.Join(r.baseDir, profilesDir, activeFile))
+	if os.IsNotExist(err) {
+		return domain.DefaultProfileName, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read active profile: %v", err)
+	}
+
+	name := strings.TrimSpace(string(b))
+	if name == "" {
+		return domain.DefaultProfileName, nil
+	}
+	return name, nil
+}
+
+// SetActiveProfile persists the selected profile name
+func (r *FileProfileRepository) SetActiveProfile(name string) error {
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(r.baseDir, profilesDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create profiles directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, activeFile), []byte(name+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to save active profile: %v", err)
+	}
+
+	return nil
+}
+
+// checkProfileName refuses names that would not stay a single directory under profiles/, such
+// as .. or a/b, whatever the caller validated
+func checkProfileName(name string) error {
+	if name == "" || name == "." || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: invalid profile name %q", domain.ErrInvalidArgument, name)
+	}
+	return nil
+}
+
+// buildProfile resolves the file locations for a profile
+func (r *FileProfileRepository) buildProfile(name string) domain.Profile {
+	sharedCredentials := r.opts.CredentialsPath
+	if sharedCredentials == "" {
+		sharedCredentials = filepath.Join(r.baseDir, credentialsFile)
+	}
+
+	if name == domain.DefaultProfileName {
+		token := r.opts.TokenPath
+		if token == "" {
+			token = filepath.Join(r.baseDir, profileTokenFile)
+		}
+		return domain.Profile{
+			Name:            name,
+			CredentialsPath: sharedCredentials,
+			TokenPath:       token,
+			CacheDir:        filepath.Join(r.baseDir, profileCacheDir),
+		}
+	}
+
+	dir := r.profileDir(name)
+
+	// Named profiles may bring their own OAuth client, otherwise the shared one is used
+	credentials := filepath.Join(dir, credentialsFile)
+	if _, err := os.Stat(credentials); err != nil {
+		credentials = sharedCredentials
+	}
+
+	return domain.Profile{
+		Name:            name,
+		CredentialsPath: credentials,
+		TokenPath:       filepath.Join(dir, profileTokenFile),
+		CacheDir:        filepath.Join(dir, profileCacheDir),
+	}
+}
+
+// profileDir returns the directory that holds a named profile
+func (r *FileProfileRepository) profileDir(name string) string {
+	return filepath.Join(r.baseDir, profilesDir, name)
+}
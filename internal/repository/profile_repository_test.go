@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+func TestFileProfileRepository_RefusesNamesOutsideProfiles(t *testing.T) {
+	base := t.TempDir()
+	credentials := filepath.Join(base, credentialsFile)
+	if err := os.WriteFile(credentials, []byte("{}"), 0o600); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo := NewFileProfileRepository(base)
+	if _, err := repo.CreateProfile("work"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	profiles := usecase.NewProfileUseCase(repo)
+
+	for _, name := range []string{"..", ".", "../x", "work/..", ""} {
+		if err := repo.DeleteProfile(name); !errors.Is(err, domain.ErrInvalidArgument) {
+			t.Errorf("Expected the repository to refuse deleting %q, got %v", name, err)
+		}
+		if err := profiles.RemoveProfile(name); err == nil {
+			t.Errorf("Expected removing %q to fail", name)
+		}
+	}
+	if _, err := profiles.ResolveProfile("../x"); err == nil {
+		t.Error("Expected --profile ../x to be refused")
+	}
+	if err := profiles.SwitchProfile(".."); err == nil {
+		t.Error("Expected switching to .. to be refused")
+	}
+
+	if _, err := os.Stat(credentials); err != nil {
+		t.Errorf("Expected the base directory to be left intact, got %v", err)
+	}
+	if _, err := repo.GetProfile("work"); err != nil {
+		t.Errorf("Expected the other profiles to be left intact, got %v", err)
+	}
+}
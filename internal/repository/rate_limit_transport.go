@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by the HTTP clients of a run: it holds up to burst
+// tokens, gains rate tokens a second and every request takes one, waiting for it when the
+// bucket is empty. Waiting requests queue up in the order they asked.
+type RateLimiter struct {
+	rate    float64
+	burst   float64
+	now     func() time.Time
+	metrics *Metrics
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a new instance of RateLimiter allowing rate requests a second after a
+// burst of up to burst requests; it returns nil, which allows every request, when rate is not positive
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst = max(burst, 1)
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		now:    time.Now,
+		tokens: float64(burst),
+	}
+}
+
+// SetMetrics counts the waits of requests in metrics; it must be called before the limiter is used
+func (l *RateLimiter) SetMetrics(metrics *Metrics) {
+	if l != nil {
+		l.metrics = metrics
+	}
+}
+
+// Wait blocks until a request may go, or ctx is done, and returns how long it waited
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	wait := l.reserve()
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.metrics.ObserveRateLimitWait(wait)
+		return wait, nil
+	case <-ctx.Done():
+		// The request does not go, so its token is left for the next one
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is earned; the bucket goes into
+// debt for waiting requests, so later ones wait longer
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// RateLimitTransport sends requests through a RateLimiter, so the API calls of every client
+// sharing it stay within the Google Photos quotas
+type RateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *RateLimiter
+	logger  *slog.Logger
+}
+
+// NewRateLimitTransport creates a new instance of RateLimitTransport sending requests through
+// next, or http.DefaultTransport when next is nil; a nil limiter returns next unchanged
+func NewRateLimitTransport(next http.RoundTripper, limiter *RateLimiter, logger *slog.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if limiter == nil {
+		return next
+	}
+	return &RateLimitTransport{
+		next:    next,
+		limiter: limiter,
+		logger:  logger,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	waited, err := t.limiter.Wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if waited > 0 {
+		t.logger.Debug("Waited for the API rate limit", "wait", waited.Round(time.Millisecond), "url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// A full bucket lets a burst through, then requests queue up half a second apart
+	var waits []time.Duration
+	for range 5 {
+		waits = append(waits, limiter.reserve())
+	}
+	want := []time.Duration{0, 0, 0, 500 * time.Millisecond, time.Second}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("Expected waits %v, got %v", want, waits)
+		}
+	}
+
+	// The debt is paid back over time, and a pause refills the bucket up to the burst only
+	now = now.Add(time.Hour)
+	for i := range 4 {
+		if wait := limiter.reserve(); (wait > 0) != (i == 3) {
+			t.Errorf("Request %d after a pause: unexpected wait %s", i, wait)
+		}
+	}
+
+	if NewRateLimiter(0, 10) != nil {
+		t.Error("Expected no limiter without a rate")
+	}
+}
+
+func TestRateLimitTransport_Cancelled(t *testing.T) {
+	var requests []*http.Request
+	limiter := NewRateLimiter(0.001, 1)
+	client := &http.Client{Transport: NewRateLimitTransport(stubClient(&requests, `{}`).Transport, limiter, slog.New(slog.DiscardHandler))}
+
+	resp, err := client.Get(albumsEndpoint)
+	if err != nil {
+		t.Fatalf("Expected the first request to go, got %v", err)
+	}
+	resp.Body.Close()
+
+	// The next token is far away; a cancelled request gives up waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, albumsEndpoint, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to stop the wait, got %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected 1 request to be sent, got %d", len(requests))
+	}
+}
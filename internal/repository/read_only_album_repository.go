@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"fmt"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// readOnlyAlbums is a set of album IDs that must not be changed
+type readOnlyAlbums map[string]bool
+
+// check returns an error matching domain.ErrAlbumReadOnly when albumID is read-only
+func (r readOnlyAlbums) check(albumID string) error {
+	if r[albumID] {
+		return fmt.Errorf("%w: %s is listed in read_only_albums of the config", domain.ErrAlbumReadOnly, albumID)
+	}
+	return nil
+}
+
+// ReadOnlyAlbumRepository refuses to rename, change the cover of, add media items or entries to,
+// or remove media items from the read-only albums, and passes every other call to the repository it wraps
+type ReadOnlyAlbumRepository struct {
+	domain.AlbumRepository
+	readOnly readOnlyAlbums
+}
+
+// NewReadOnlyAlbumRepository creates a new instance of ReadOnlyAlbumRepository protecting the
+// albums with the given IDs; without any, next is returned unchanged
+func NewReadOnlyAlbumRepository(next domain.AlbumRepository, albumIDs []string) domain.AlbumRepository {
+	if len(albumIDs) == 0 {
+		return next
+	}
+	return &ReadOnlyAlbumRepository{AlbumRepository: next, readOnly: newReadOnlyAlbums(albumIDs)}
+}
+
+// UpdateAlbum implements domain.AlbumRepository
+func (r *ReadOnlyAlbumRepository) UpdateAlbum(id, title, coverPhotoMediaItemID string) (*domain.Album, error) {
+	if err := r.readOnly.check(id); err != nil {
+		return nil, err
+	}
+	return r.AlbumRepository.UpdateAlbum(id, title, coverPhotoMediaItemID)
+}
+
+// BatchAddMediaItems implements domain.AlbumRepository
+func (r *ReadOnlyAlbumRepository) BatchAddMediaItems(albumID string, mediaItemIDs []string) error {
+	if err := r.readOnly.check(albumID); err != nil {
+		return err
+	}
+	return r.AlbumRepository.BatchAddMediaItems(albumID, mediaItemIDs)
+}
+
+// BatchRemoveMediaItems implements domain.AlbumRepository
+func (r *ReadOnlyAlbumRepository) BatchRemoveMediaItems(albumID string, mediaItemIDs []string) error {
+	if err := r.readOnly.check(albumID); err != nil {
+		return err
+	}
+	return r.AlbumRepository.BatchRemoveMediaItems(albumID, mediaItemIDs)
+}
+
+// AddTextEnrichment implements domain.AlbumRepository
+func (r *ReadOnlyAlbumRepository) AddTextEnrichment(albumID, text string, position domain.PositionType) (string, error) {
+	if err := r.readOnly.check(albumID); err != nil {
+		return "", err
+	}
+	return r.AlbumRepository.AddTextEnrichment(albumID, text, position)
+}
+
+// ReadOnlyMediaItemRepository refuses to create media items in the read-only albums, and passes
+// every other call to the repository it wraps
+type ReadOnlyMediaItemRepository struct {
+	domain.MediaItemRepository
+	readOnly readOnlyAlbums
+}
+
+// NewReadOnlyMediaItemRepository creates a new instance of ReadOnlyMediaItemRepository
+// protecting the albums with the given IDs; without any, next is returned unchanged
+func NewReadOnlyMediaItemRepository(next domain.MediaItemRepository, albumIDs []string) domain.MediaItemRepository {
+	if len(albumIDs) == 0 {
+		return next
+	}
+	return &ReadOnlyMediaItemRepository{MediaItemRepository: next, readOnly: newReadOnlyAlbums(albumIDs)}
+}
+
+// BatchCreateMediaItems implements domain.MediaItemRepository
+func (r *ReadOnlyMediaItemRepository) BatchCreateMediaItems(albumID string, items []domain.NewMediaItem) ([]domain.NewMediaItemResult, error) {
+	if err := r.readOnly.check(albumID); err != nil {
+		return nil, err
+	}
+	return r.MediaItemRepository.BatchCreateMediaItems(albumID, items)
+}
+
+// newReadOnlyAlbums returns the set of albumIDs
+func newReadOnlyAlbums(albumIDs []string) readOnlyAlbums {
+	readOnly := make(readOnlyAlbums, len(albumIDs))
+	for _, id := range albumIDs {
+		readOnly[id] = true
+	}
+	return readOnly
+}
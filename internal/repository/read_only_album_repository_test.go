@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestReadOnlyAlbumRepository(t *testing.T) {
+	var requests []*http.Request
+	client := stubClient(&requests, `{"id":"a2","newMediaItemResults":[]}`)
+	albums := NewReadOnlyAlbumRepository(NewGooglePhotosRepository(client), []string{"a1"})
+	media := NewReadOnlyMediaItemRepository(NewGooglePhotosMediaItemRepository(client, GooglePhotosOptions{}), []string{"a1"})
+
+	// Every change to the read-only album is refused before it reaches the API
+	if _, err := albums.UpdateAlbum("a1", "New", ""); !errors.Is(err, domain.ErrAlbumReadOnly) {
+		t.Errorf("Expected ErrAlbumReadOnly renaming, got %v", err)
+	}
+	if err := albums.BatchAddMediaItems("a1", []string{"m1"}); !errors.Is(err, domain.ErrAlbumReadOnly) {
+		t.Errorf("Expected ErrAlbumReadOnly adding items, got %v", err)
+	}
+	if err := albums.BatchRemoveMediaItems("a1", []string{"m1"}); !errors.Is(err, domain.ErrAlbumReadOnly) {
+		t.Errorf("Expected ErrAlbumReadOnly removing items, got %v", err)
+	}
+	if _, err := albums.AddTextEnrichment("a1", "Hello", domain.PositionFirstInAlbum); !errors.Is(err, domain.ErrAlbumReadOnly) {
+		t.Errorf("Expected ErrAlbumReadOnly adding an entry, got %v", err)
+	}
+	if _, err := media.BatchCreateMediaItems("a1", []domain.NewMediaItem{{UploadToken: "t1"}}); !errors.Is(err, domain.ErrAlbumReadOnly) {
+		t.Errorf("Expected ErrAlbumReadOnly uploading into the album, got %v", err)
+	}
+	if len(requests) != 0 {
+		t.Fatalf("Expected no requests for the read-only album, got %d", len(requests))
+	}
+
+	// Other albums and reads go through
+	if err := albums.BatchAddMediaItems("a2", []string{"m1"}); err != nil {
+		t.Errorf("Expected no error adding items to another album, got %v", err)
+	}
+	if _, err := albums.GetAlbumByID("a1"); err != nil {
+		t.Errorf("Expected no error reading the read-only album, got %v", err)
+	}
+	if _, err := media.BatchCreateMediaItems("", []domain.NewMediaItem{{UploadToken: "t1"}}); err != nil {
+		t.Errorf("Expected no error uploading outside albums, got %v", err)
+	}
+	if len(requests) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(requests))
+	}
+}
@@ -0,0 +1,489 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// maxErrorSnippet limits how much of an unparseable body is echoed back in errors
+const maxErrorSnippet = 200
+
+// googleErrorBody mirrors the JSON error envelope returned by Google APIs
+type googleErrorBody struct {
+	Error *struct {
+		Code    int                     `json:"code"`
+		Message string                  `json:"message"`
+		Status  string                  `json:"status"`
+		Details []domain.APIErrorDetail `json:"details"`
+	} `json:"error"`
+}
+
+// albumsResponse mirrors the JSON body of the list albums endpoint
+type albumsResponse struct {
+	Albums        []domain.Album `json:"albums"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+// sharedAlbumsResponse mirrors the JSON body of the list shared albums endpoint
+type sharedAlbumsResponse struct {
+	SharedAlbums  []domain.Album `json:"sharedAlbums"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+// parseAlbumsResponse decodes a list albums response.
+// Empty or null bodies yield an empty page and entries without an ID are dropped.
+func parseAlbumsResponse(body []byte, dec jsonDecoding) (*domain.Page[domain.Album], error) {
+	var data albumsResponse
+	if isEmptyJSON(body) {
+		return &domain.Page[domain.Album]{}, nil
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed albums response: %v", err)
+	}
+
+	return &domain.Page[domain.Album]{
+		Items:         albumsWithID(data.Albums),
+		NextPageToken: data.NextPageToken,
+	}, nil
+}
+
+// parseAlbum decodes a single album response and requires the album ID to be present
+func parseAlbum(body []byte, dec jsonDecoding) (*domain.Album, error) {
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed album response: empty body")
+	}
+
+	var album domain.Album
+	if err := decodeJSON(body, &album, dec); err != nil {
+		return nil, fmt.Errorf("malformed album response: %v", err)
+	}
+
+	if album.ID == "" {
+		return nil, fmt.Errorf("malformed album response: missing album id")
+	}
+
+	return &album, nil
+}
+
+// parseSharedAlbumsResponse decodes a list shared albums response, dropping entries without an ID
+func parseSharedAlbumsResponse(body []byte, dec jsonDecoding) (*domain.Page[domain.Album], error) {
+	var data sharedAlbumsResponse
+	if isEmptyJSON(body) {
+		return &domain.Page[domain.Album]{}, nil
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed shared albums response: %v", err)
+	}
+
+	return &domain.Page[domain.Album]{
+		Items:         albumsWithID(data.SharedAlbums),
+		NextPageToken: data.NextPageToken,
+	}, nil
+}
+
+// albumsWithID drops entries without an ID, such as null array elements
+func albumsWithID(albums []domain.Album) []domain.Album {
+	filtered := albums[:0]
+	for _, album := range albums {
+		if album.ID != "" {
+			filtered = append(filtered, album)
+		}
+	}
+	return filtered
+}
+
+// parseShareInfo decodes the response of sharing an album
+func parseShareInfo(body []byte, dec jsonDecoding) (*domain.ShareInfo, error) {
+	var data struct {
+		ShareInfo *domain.ShareInfo `json:"shareInfo"`
+	}
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed share album response: %v", err)
+	}
+
+	if data.ShareInfo == nil {
+		return nil, fmt.Errorf("malformed share album response: missing share info")
+	}
+
+	return data.ShareInfo, nil
+}
+
+// parseJoinedAlbum decodes the response of joining a shared album and requires the album ID
+func parseJoinedAlbum(body []byte, dec jsonDecoding) (*domain.Album, error) {
+	var data struct {
+		Album *domain.Album `json:"album"`
+	}
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed join shared album response: %v", err)
+	}
+
+	if data.Album == nil || data.Album.ID == "" {
+		return nil, fmt.Errorf("malformed join shared album response: missing album id")
+	}
+
+	return data.Album, nil
+}
+
+// parseEnrichmentItemID decodes the response of adding an enrichment and requires its ID
+func parseEnrichmentItemID(body []byte, dec jsonDecoding) (string, error) {
+	var data struct {
+		EnrichmentItem *struct {
+			ID string `json:"id"`
+		} `json:"enrichmentItem"`
+	}
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return "", fmt.Errorf("malformed add enrichment response: %v", err)
+	}
+
+	if data.EnrichmentItem == nil || data.EnrichmentItem.ID == "" {
+		return "", fmt.Errorf("malformed add enrichment response: missing enrichment item id")
+	}
+
+	return data.EnrichmentItem.ID, nil
+}
+
+// parseMediaItem decodes a single media item response and requires the media item ID to be present
+func parseMediaItem(body []byte, dec jsonDecoding) (*domain.MediaItem, error) {
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed media item response: empty body")
+	}
+
+	var item domain.MediaItem
+	if err := decodeJSON(body, &item, dec); err != nil {
+		return nil, fmt.Errorf("malformed media item response: %v", err)
+	}
+
+	if item.ID == "" {
+		return nil, fmt.Errorf("malformed media item response: missing media item id")
+	}
+
+	return &item, nil
+}
+
+// parseMediaItemsResponse decodes a media item search response, dropping entries without an ID
+func parseMediaItemsResponse(body []byte, dec jsonDecoding) (*domain.Page[domain.MediaItem], error) {
+	var data mediaItemsResponse
+	if isEmptyJSON(body) {
+		return &domain.Page[domain.MediaItem]{}, nil
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed media items response: %v", err)
+	}
+
+	items := data.MediaItems[:0]
+	for _, item := range data.MediaItems {
+		if item.ID != "" {
+			items = append(items, item)
+		}
+	}
+
+	return &domain.Page[domain.MediaItem]{
+		Items:         items,
+		NextPageToken: data.NextPageToken,
+	}, nil
+}
+
+// parseNewMediaItemResults decodes a batchCreate response
+func parseNewMediaItemResults(body []byte, dec jsonDecoding) ([]domain.NewMediaItemResult, error) {
+	var data struct {
+		NewMediaItemResults []domain.NewMediaItemResult `json:"newMediaItemResults"`
+	}
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed batch create response: empty body")
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed batch create response: %v", err)
+	}
+
+	return data.NewMediaItemResults, nil
+}
+
+// parseMediaItemResults decodes a batchGet response for the media items with the given IDs. The
+// API returns a result per ID in the order asked for; results that failed carry only a status.
+func parseMediaItemResults(body []byte, ids []string, dec jsonDecoding) ([]domain.MediaItemResult, error) {
+	var data struct {
+		MediaItemResults []struct {
+			Status    domain.Status     `json:"status"`
+			MediaItem *domain.MediaItem `json:"mediaItem"`
+		} `json:"mediaItemResults"`
+	}
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed batch get response: empty body")
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed batch get response: %v", err)
+	}
+	if len(data.MediaItemResults) != len(ids) {
+		return nil, fmt.Errorf("malformed batch get response: %d results for %d media items", len(data.MediaItemResults), len(ids))
+	}
+
+	results := make([]domain.MediaItemResult, len(ids))
+	for i, result := range data.MediaItemResults {
+		results[i] = domain.MediaItemResult{ID: ids[i], MediaItem: result.MediaItem, Err: result.Status.Err()}
+		if results[i].Err == nil && (result.MediaItem == nil || result.MediaItem.ID == "") {
+			results[i].MediaItem, results[i].Err = nil, &domain.APIError{Status: "NOT_FOUND", Message: "media item not returned"}
+		}
+	}
+	return results, nil
+}
+
+// mediaItemsResponse mirrors the JSON body of the media item search endpoint
+type mediaItemsResponse struct {
+	MediaItems    []domain.MediaItem `json:"mediaItems"`
+	NextPageToken string             `json:"nextPageToken"`
+}
+
+// tokenInfoResponse mirrors the JSON body of the tokeninfo endpoint, which encodes every value as a string
+type tokenInfoResponse struct {
+	Azp           string `json:"azp"`
+	Aud           string `json:"aud"`
+	Sub           string `json:"sub"`
+	Scope         string `json:"scope"`
+	Exp           string `json:"exp"`
+	ExpiresIn     string `json:"expires_in"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	AccessType    string `json:"access_type"`
+}
+
+// userInfoResponse mirrors the JSON body of the OpenID Connect userinfo endpoint
+type userInfoResponse struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Locale        string `json:"locale"`
+	HD            string `json:"hd"`
+}
+
+// parseTokenInfo decodes a tokeninfo response
+func parseTokenInfo(body []byte, dec jsonDecoding) (*domain.TokenInfo, error) {
+	var data tokenInfoResponse
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed token info response: empty body")
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed token info response: %v", err)
+	}
+
+	info := &domain.TokenInfo{
+		UserID:        data.Sub,
+		Email:         data.Email,
+		EmailVerified: data.EmailVerified == "true",
+		Scopes:        strings.Fields(data.Scope),
+	}
+	if data.Exp != "" {
+		exp, err := strconv.ParseInt(data.Exp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed token info response: invalid exp %q", data.Exp)
+		}
+		info.Expiry = time.Unix(exp, 0)
+	}
+
+	return info, nil
+}
+
+// parseUserInfo decodes a userinfo response
+func parseUserInfo(body []byte, dec jsonDecoding) (*domain.UserInfo, error) {
+	var data userInfoResponse
+	if isEmptyJSON(body) {
+		return nil, fmt.Errorf("malformed user info response: empty body")
+	}
+
+	if err := decodeJSON(body, &data, dec); err != nil {
+		return nil, fmt.Errorf("malformed user info response: %v", err)
+	}
+
+	if data.Sub == "" {
+		return nil, fmt.Errorf("malformed user info response: missing sub")
+	}
+
+	return &domain.UserInfo{
+		UserID:        data.Sub,
+		Email:         data.Email,
+		EmailVerified: data.EmailVerified,
+		Name:          data.Name,
+	}, nil
+}
+
+// jsonDecoding says how decodeJSON treats a response
+type jsonDecoding struct {
+	// strict fails responses with fields the domain model does not know about
+	strict bool
+	// logger receives every unknown field in strict mode
+	logger *slog.Logger
+}
+
+// decodeJSON unmarshals body into v. In strict mode every field not known to v is logged
+// and decoding fails, so API surface changes are noticed early.
+func decodeJSON(body []byte, v any, dec jsonDecoding) error {
+	if dec.strict {
+		if fields := unknownFields(body, v); len(fields) > 0 {
+			for _, field := range fields {
+				dec.logger.Warn("Strict decoding: unrecognized field", "field", field, "type", fmt.Sprintf("%T", v))
+			}
+			return fmt.Errorf("unknown fields %s", strings.Join(fields, ", "))
+		}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.New(describeJSONError(err, body))
+	}
+	return nil
+}
+
+// unknownFields lists the dotted paths of JSON object keys in body that v has no field for
+func unknownFields(body []byte, v any) []string {
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+
+	var fields []string
+	collectUnknownFields(raw, reflect.TypeOf(v), "", &fields)
+	sort.Strings(fields)
+	return fields
+}
+
+// collectUnknownFields walks raw JSON alongside the Go type it is decoded into
+func collectUnknownFields(raw any, t reflect.Type, prefix string, fields *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		known := jsonFieldTypes(t)
+		for key, value := range obj {
+			path := joinFieldPath(prefix, key)
+			fieldType, ok := known[strings.ToLower(key)]
+			if !ok {
+				*fields = append(*fields, path)
+				continue
+			}
+			collectUnknownFields(value, fieldType, path, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := raw.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			collectUnknownFields(item, t.Elem(), joinFieldPath(prefix, fmt.Sprintf("%d", i)), fields)
+		}
+	}
+}
+
+// jsonFieldTypes maps the lower-cased JSON names of a struct's fields to their types,
+// mirroring the case-insensitive matching of encoding/json
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	known := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		known[strings.ToLower(name)] = field.Type
+	}
+	return known
+}
+
+// joinFieldPath appends a key to a dotted field path
+func joinFieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// statusError builds a *domain.APIError for a non-success response from Google's error body, if any
+func statusError(resp *http.Response, body []byte) error {
+	return parseAPIError(resp.StatusCode, resp.Status, body)
+}
+
+// parseAPIError reads a Google error body into an APIError. Bodies that are not in the Google
+// error format are kept as a truncated snippet.
+func parseAPIError(statusCode int, status string, body []byte) *domain.APIError {
+	apiErr := &domain.APIError{StatusCode: statusCode, HTTPStatus: status}
+	if isEmptyJSON(body) {
+		return apiErr
+	}
+
+	var envelope googleErrorBody
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil &&
+		(envelope.Error.Message != "" || envelope.Error.Status != "") {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Status = envelope.Error.Status
+		apiErr.Message = envelope.Error.Message
+		apiErr.Details = envelope.Error.Details
+		return apiErr
+	}
+
+	apiErr.Body = snippet(body)
+	return apiErr
+}
+
+// describeJSONError turns encoding/json errors into messages that point at the offending field
+func describeJSONError(err error, body []byte) string {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		field := e.Field
+		if field == "" {
+			field = "response"
+		}
+		return fmt.Sprintf("field %q has JSON type %s, expected %s", field, e.Value, e.Type)
+	case *json.SyntaxError:
+		return fmt.Sprintf("invalid JSON at offset %d: %q", e.Offset, snippet(body))
+	default:
+		return err.Error()
+	}
+}
+
+// isEmptyJSON reports whether a body carries no data at all
+func isEmptyJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// snippet returns a bounded, single-line excerpt of a body for error messages
+func snippet(body []byte) string {
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) > maxErrorSnippet {
+		s = s[:maxErrorSnippet] + "..."
+	}
+	return s
+}
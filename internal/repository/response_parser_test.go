@@ -0,0 +1,352 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// strictDecoding decodes like a repository with StrictDecoding, discarding the unknown fields it logs
+var strictDecoding = jsonDecoding{strict: true, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+func TestParseAlbumsResponse_Hardening(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantAlbums int
+		wantToken  string
+		wantErr    string
+	}{
+		{name: "empty body", body: "", wantAlbums: 0},
+		{name: "null body", body: "null", wantAlbums: 0},
+		{name: "missing albums", body: `{"nextPageToken":"abc"}`, wantAlbums: 0, wantToken: "abc"},
+		{name: "null albums", body: `{"albums":null}`, wantAlbums: 0},
+		{name: "null entry dropped", body: `{"albums":[null,{"id":"1","title":"A"}]}`, wantAlbums: 1},
+		{name: "entry without id dropped", body: `{"albums":[{"title":"orphan"},{"id":"2"}]}`, wantAlbums: 1},
+		{name: "extra fields ignored", body: `{"albums":[{"id":"1","title":"A","futureField":{"x":1}}],"somethingNew":true}`, wantAlbums: 1},
+		{name: "wrong type", body: `{"albums":[{"id":123}]}`, wantErr: `field "albums.0.id"`},
+		{name: "truncated", body: `{"albums":[{"id":"1"`, wantErr: "malformed albums response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := parseAlbumsResponse([]byte(tt.body), jsonDecoding{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(resp.Items) != tt.wantAlbums {
+				t.Errorf("Expected %d albums, got %d", tt.wantAlbums, len(resp.Items))
+			}
+			if resp.NextPageToken != tt.wantToken {
+				t.Errorf("Expected next page token %q, got %q", tt.wantToken, resp.NextPageToken)
+			}
+		})
+	}
+}
+
+func TestParseAlbumsResponse_StrictMode(t *testing.T) {
+	body := []byte(`{"albums":[{"id":"1","title":"A","newField":1}],"nextPageToken":"t","topLevelNew":true}`)
+
+	if _, err := parseAlbumsResponse(body, jsonDecoding{}); err != nil {
+		t.Fatalf("Expected lenient mode to accept unknown fields, got %v", err)
+	}
+
+	_, err := parseAlbumsResponse(body, strictDecoding)
+	if err == nil {
+		t.Fatal("Expected strict mode to reject unknown fields")
+	}
+	if !strings.Contains(err.Error(), "albums.0.newField") || !strings.Contains(err.Error(), "topLevelNew") {
+		t.Errorf("Expected all unknown fields to be reported, got %v", err)
+	}
+
+	if _, err := parseAlbumsResponse([]byte(`{"albums":[{"ID":"1","Title":"A"}]}`), strictDecoding); err != nil {
+		t.Errorf("Expected case-insensitive field matching, got %v", err)
+	}
+}
+
+func TestParseAlbum_FullSchema(t *testing.T) {
+	body := []byte(`{
+		"id": "a1",
+		"title": "Trip",
+		"productUrl": "https://photos.google.com/lr/album/a1",
+		"isWriteable": true,
+		"shareInfo": {
+			"sharedAlbumOptions": {"isCollaborative": true, "isCommentable": false},
+			"shareableUrl": "https://photos.app.goo.gl/x",
+			"shareToken": "tok",
+			"isJoined": true,
+			"isOwned": true,
+			"isJoinable": false
+		},
+		"mediaItemsCount": "42",
+		"coverPhotoBaseUrl": "https://lh3.googleusercontent.com/abc",
+		"coverPhotoMediaItemId": "m1"
+	}`)
+
+	album, err := parseAlbum(body, strictDecoding)
+	if err != nil {
+		t.Fatalf("Expected the full schema to decode strictly, got %v", err)
+	}
+	if album.MediaItemsCount != 42 {
+		t.Errorf("Expected 42 media items, got %d", album.MediaItemsCount)
+	}
+	if !album.IsWriteable || album.CoverPhotoMediaItemID != "m1" || album.ProductURL == "" || album.CoverPhotoBaseURL == "" {
+		t.Errorf("Expected album fields to be populated, got %+v", album)
+	}
+	if album.ShareInfo == nil || !album.ShareInfo.SharedAlbumOptions.IsCollaborative || album.ShareInfo.ShareToken != "tok" {
+		t.Errorf("Expected share info to be populated, got %+v", album.ShareInfo)
+	}
+}
+
+func TestParseSharingResponses(t *testing.T) {
+	shareInfo, err := parseShareInfo([]byte(`{"shareInfo":{"sharedAlbumOptions":{"isCollaborative":true},"shareableUrl":"https://photos.app.goo.gl/x","shareToken":"tok","isOwned":true}}`), strictDecoding)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if shareInfo.ShareToken != "tok" || !shareInfo.SharedAlbumOptions.IsCollaborative {
+		t.Errorf("Expected share info to be decoded, got %+v", shareInfo)
+	}
+	if _, err := parseShareInfo([]byte(`{}`), jsonDecoding{}); err == nil {
+		t.Error("Expected a response without share info to be rejected")
+	}
+
+	album, err := parseJoinedAlbum([]byte(`{"album":{"id":"a1","title":"Joined"}}`), strictDecoding)
+	if err != nil || album.ID != "a1" {
+		t.Errorf("Expected joined album a1, got %+v (%v)", album, err)
+	}
+	if _, err := parseJoinedAlbum([]byte(`{"album":{}}`), jsonDecoding{}); err == nil {
+		t.Error("Expected a joined album without id to be rejected")
+	}
+
+	shared, err := parseSharedAlbumsResponse([]byte(`{"sharedAlbums":[{"id":"1"},{"title":"no id"}],"nextPageToken":"p2"}`), jsonDecoding{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(shared.Items) != 1 || shared.NextPageToken != "p2" {
+		t.Errorf("Expected 1 shared album and token p2, got %+v", shared)
+	}
+}
+
+func TestParseMediaItemResponses(t *testing.T) {
+	page, err := parseMediaItemsResponse([]byte(`{"mediaItems":[{"id":"m1","filename":"a.mp4","baseUrl":"https://lh3/x","mimeType":"video/mp4","mediaMetadata":{"creationTime":"2024-01-02T03:04:05Z","width":"1920","height":"1080","video":{"fps":30,"status":"READY"}}},{"filename":"no id"}],"nextPageToken":"p2"}`), strictDecoding)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 1 || page.NextPageToken != "p2" {
+		t.Fatalf("Expected 1 media item and token p2, got %+v", page)
+	}
+	if item := page.Items[0]; !item.IsVideo() || item.MediaMetadata.Width != 1920 || item.DownloadURL(domain.ImageSize{}) != "https://lh3/x=dv" {
+		t.Errorf("Expected a decoded video, got %+v", item)
+	}
+
+	if _, err := parseMediaItem([]byte(`{"filename":"a.jpg"}`), jsonDecoding{}); err == nil {
+		t.Error("Expected a media item without id to be rejected")
+	}
+}
+
+func TestParseNewMediaItemResults(t *testing.T) {
+	body := `{"newMediaItemResults":[
+		{"uploadToken":"t1","status":{"message":"Success"},"mediaItem":{"id":"m1","filename":"a.jpg"}},
+		{"uploadToken":"t2","status":{"code":3,"message":"Failed: There was an error while trying to create this media item."}}
+	]}`
+
+	results, err := parseNewMediaItemResults([]byte(body), strictDecoding)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if !results[0].Status.OK() || results[0].MediaItem == nil || results[0].MediaItem.ID != "m1" {
+		t.Errorf("Expected media item m1 to be created, got %+v", results[0])
+	}
+	if results[1].Status.OK() || results[1].MediaItem != nil {
+		t.Errorf("Expected t2 to fail, got %+v", results[1])
+	}
+	if _, err := parseNewMediaItemResults(nil, jsonDecoding{}); err == nil {
+		t.Error("Expected an empty body to be rejected")
+	}
+}
+
+func TestParseAccountResponses(t *testing.T) {
+	tokenInfo, err := parseTokenInfo([]byte(`{"azp":"c","aud":"c","sub":"42","scope":"https://www.googleapis.com/auth/photoslibrary.appendonly https://www.googleapis.com/auth/userinfo.email","exp":"1760000000","expires_in":"3599","email":"me@example.com","email_verified":"true","access_type":"offline"}`), strictDecoding)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(tokenInfo.Scopes) != 2 || tokenInfo.Expiry.Unix() != 1760000000 || !tokenInfo.EmailVerified || tokenInfo.UserID != "42" {
+		t.Errorf("Expected token info to be decoded, got %+v", tokenInfo)
+	}
+	if _, err := parseTokenInfo([]byte(`{"exp":"soon"}`), jsonDecoding{}); err == nil {
+		t.Error("Expected an invalid exp to be rejected")
+	}
+
+	userInfo, err := parseUserInfo([]byte(`{"sub":"42","name":"Me","email":"me@example.com","email_verified":true}`), strictDecoding)
+	if err != nil || userInfo.Name != "Me" || userInfo.Email != "me@example.com" {
+		t.Errorf("Expected user info to be decoded, got %+v (%v)", userInfo, err)
+	}
+	if _, err := parseUserInfo([]byte(`{"name":"Me"}`), jsonDecoding{}); err == nil {
+		t.Error("Expected user info without sub to be rejected")
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	tests := []struct {
+		req  domain.PageRequest
+		want string
+	}{
+		{req: domain.PageRequest{}, want: albumsEndpoint},
+		{req: domain.PageRequest{PageSize: 20}, want: albumsEndpoint + "?pageSize=20"},
+		{req: domain.PageRequest{PageSize: 50, PageToken: "a+b/c"}, want: albumsEndpoint + "?pageSize=50&pageToken=a%2Bb%2Fc"},
+		{req: domain.PageRequest{Fields: "id,title"}, want: albumsEndpoint + "?fields=albums%28id%2Ctitle%29%2CnextPageToken"},
+		{req: domain.PageRequest{Fields: "title,shareInfo(id)"}, want: albumsEndpoint + "?fields=albums%28id%2Ctitle%2CshareInfo%28id%29%29%2CnextPageToken"},
+	}
+
+	for _, tt := range tests {
+		if got := pageURL(albumsEndpoint, "albums", tt.req); got != tt.want {
+			t.Errorf("Expected %q for %+v, got %q", tt.want, tt.req, got)
+		}
+	}
+}
+
+func TestStatusError_UsesGoogleErrorMessage(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusForbidden, Status: "403 Forbidden"}
+	body := []byte(`{"error":{"code":403,"message":"Request had insufficient authentication scopes.","status":"PERMISSION_DENIED"}}`)
+
+	err := statusError(resp, body)
+
+	want := "API error: 403 Forbidden: Request had insufficient authentication scopes. (PERMISSION_DENIED)"
+	if err.Error() != want {
+		t.Errorf("Expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestStatusError_MatchesSentinels(t *testing.T) {
+	tests := []struct {
+		code   int
+		status string
+		body   string
+		is     []error
+		isNot  []error
+	}{
+		{
+			code: 403, status: "403 Forbidden",
+			body:  `{"error":{"code":403,"message":"Request had insufficient authentication scopes.","status":"PERMISSION_DENIED","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"ACCESS_TOKEN_SCOPE_INSUFFICIENT","domain":"googleapis.com"}]}}`,
+			is:    []error{domain.ErrInsufficientScope, domain.ErrPermissionDenied},
+			isNot: []error{domain.ErrNotFound, domain.ErrRateLimited},
+		},
+		{
+			code: 404, status: "404 Not Found",
+			body:  `{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND"}}`,
+			is:    []error{domain.ErrNotFound},
+			isNot: []error{domain.ErrPermissionDenied, domain.ErrInsufficientScope},
+		},
+		{
+			code: 429, status: "429 Too Many Requests",
+			body:  `{"error":{"code":429,"message":"Quota exceeded.","status":"RESOURCE_EXHAUSTED"}}`,
+			is:    []error{domain.ErrRateLimited},
+			isNot: []error{domain.ErrInvalidArgument},
+		},
+		{
+			code: 400, status: "400 Bad Request",
+			body: `<html>Bad Request</html>`,
+			is:   []error{domain.ErrInvalidArgument},
+		},
+		{
+			code: 401, status: "401 Unauthorized",
+			is: []error{domain.ErrUnauthenticated},
+		},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", statusError(&http.Response{StatusCode: tt.code, Status: tt.status}, []byte(tt.body)))
+
+		var apiErr *domain.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.code {
+			t.Errorf("Expected an APIError with status %d, got %v", tt.code, err)
+		}
+		for _, target := range tt.is {
+			if !errors.Is(err, target) {
+				t.Errorf("Expected %q to be %v", err, target)
+			}
+		}
+		for _, target := range tt.isNot {
+			if errors.Is(err, target) {
+				t.Errorf("Expected %q not to be %v", err, target)
+			}
+		}
+	}
+}
+
+func TestParseAPIError_Details(t *testing.T) {
+	body := []byte(`{"error":{"code":403,"message":"Denied","status":"PERMISSION_DENIED","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"ACCESS_TOKEN_SCOPE_INSUFFICIENT","metadata":{"service":"photoslibrary.googleapis.com"}}]}}`)
+
+	apiErr := parseAPIError(http.StatusForbidden, "403 Forbidden", body)
+
+	if apiErr.Code != 403 || apiErr.Status != "PERMISSION_DENIED" || apiErr.Message != "Denied" {
+		t.Errorf("Expected code, status and message from the body, got %+v", apiErr)
+	}
+	if len(apiErr.Details) != 1 || apiErr.Details[0].Reason != "ACCESS_TOKEN_SCOPE_INSUFFICIENT" || apiErr.Details[0].Metadata["service"] != "photoslibrary.googleapis.com" {
+		t.Errorf("Expected the error info detail, got %+v", apiErr.Details)
+	}
+
+	if snippet := parseAPIError(http.StatusBadGateway, "502 Bad Gateway", []byte("<html>\n Bad Gateway</html>")); snippet.Body != "<html> Bad Gateway</html>" {
+		t.Errorf("Expected a single-line body excerpt, got %q", snippet.Body)
+	}
+}
+
+func FuzzParseAlbumsResponse(f *testing.F) {
+	f.Add([]byte(`{"albums":[{"id":"1","title":"A"}],"nextPageToken":"t"}`))
+	f.Add([]byte(`{"albums":[null]}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"albums":{"id":"1"}}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		resp, err := parseAlbumsResponse(body, jsonDecoding{})
+		if err != nil {
+			return
+		}
+		for _, album := range resp.Items {
+			if album.ID == "" {
+				t.Fatalf("Parsed album without ID from %q", body)
+			}
+		}
+	})
+}
+
+func FuzzParseAlbum(f *testing.F) {
+	f.Add([]byte(`{"id":"1","title":"A"}`))
+	f.Add([]byte(`{"title":"no id"}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		album, err := parseAlbum(body, jsonDecoding{})
+		if err == nil && (album == nil || album.ID == "") {
+			t.Fatalf("Expected album with ID or an error for %q", body)
+		}
+	})
+}
+
+func FuzzParseAPIError(f *testing.F) {
+	f.Add([]byte(`{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND"}}`))
+	f.Add([]byte(`<html>Bad Gateway</html>`))
+	f.Add([]byte(`{"error":"string instead of object"}`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		msg := parseAPIError(http.StatusInternalServerError, "500 Internal Server Error", body).Error()
+		if strings.Contains(msg, "\n") {
+			t.Fatalf("Expected single-line message, got %q", msg)
+		}
+	})
+}
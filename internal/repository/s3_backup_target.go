@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// emptySHA256 is the hex SHA-256 of an empty body, which requests without one are signed with
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+const (
+	// s3MaxPutSize is the largest object a single PUT may upload; larger ones go in parts
+	s3MaxPutSize = 5 << 30
+	// s3PartSize is the size of the parts of multipart uploads unless the object needs larger ones.
+	// Each part is held in memory while it is sent, as its checksum signs the request.
+	s3PartSize = 16 << 20
+	// s3MaxParts is how many parts a multipart upload may have
+	s3MaxParts = 10000
+)
+
+// S3Options configures an S3 bucket, or one of a store speaking the S3 API such as MinIO
+type S3Options struct {
+	Bucket string
+	// Prefix is put in front of every key, such as "photos/"
+	Prefix string
+	// Region defaults to us-east-1
+	Region string
+	// Endpoint is the URL of a store other than AWS, such as http://nas.lan:9000; its buckets are
+	// addressed in the path rather than the host name
+	Endpoint string
+	// AccessKeyID, SecretAccessKey and, for temporary credentials, SessionToken sign requests
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3OptionsFromEnv reads the credentials, region and endpoint of bucket from the AWS_* variables
+// the AWS tools use
+func S3OptionsFromEnv(bucket, prefix string, getenv func(string) string) S3Options {
+	region := getenv("AWS_REGION")
+	if region == "" {
+		region = getenv("AWS_DEFAULT_REGION")
+	}
+	return S3Options{
+		Bucket:          bucket,
+		Prefix:          prefix,
+		Region:          region,
+		Endpoint:        getenv("AWS_ENDPOINT_URL"),
+		AccessKeyID:     getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// S3BackupTarget implements the BackupTarget interface with an S3 bucket. Requests are signed with
+// AWS Signature Version 4 and carry the checksum of their body, so S3 refuses corrupted uploads.
+type S3BackupTarget struct {
+	client *http.Client
+	opts   S3Options
+	// exit aborts the multipart uploads in flight when the run ends before them
+	exit domain.ExitHooks
+	// now is the time requests are signed at
+	now func() time.Time
+}
+
+// NewS3BackupTarget creates a new instance of S3BackupTarget; exit, if not nil, aborts the
+// multipart uploads the run ends before
+func NewS3BackupTarget(client *http.Client, opts S3Options, exit domain.ExitHooks) (domain.BackupTarget, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("%w: S3 bucket is required", domain.ErrInvalidArgument)
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 credentials are missing: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint != "" {
+		if _, err := url.Parse(opts.Endpoint); err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+		}
+	}
+	return &S3BackupTarget{
+		client: client,
+		opts:   opts,
+		exit:   exit,
+		now:    time.Now,
+	}, nil
+}
+
+// Put uploads r as the object of key. With the size and checksum known ahead, objects up to 5 GB
+// are streamed in a single PUT; otherwise r is read a part at a time, and an object larger than a
+// part is sent as a multipart upload whose every part carries its checksum.
+func (t *S3BackupTarget) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	if checksum != "" && size >= 0 && size <= s3MaxPutSize {
+		return t.putObject(ctx, key, r, size, checksum)
+	}
+
+	partSize := int64(s3PartSize)
+	if size > partSize*s3MaxParts {
+		partSize = (size + s3MaxParts - 1) / s3MaxParts
+	}
+	part := make([]byte, partSize)
+	n, err := io.ReadFull(r, part)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		// The object fits a single part
+		if size >= 0 && int64(n) != size {
+			return fmt.Errorf("failed to upload %s to S3: got %d bytes, expected %d", key, n, size)
+		}
+		sum := sha256.Sum256(part[:n])
+		return t.putObject(ctx, key, bytes.NewReader(part[:n]), int64(n), hex.EncodeToString(sum[:]))
+	case err != nil:
+		return fmt.Errorf("failed to upload %s to S3: %v", key, err)
+	}
+	return t.putMultipart(ctx, key, r, part, size)
+}
+
+// putObject uploads the size bytes of r, whose hex SHA-256 is checksum, in a single PUT
+func (t *S3BackupTarget) putObject(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	req, err := t.newRequest(ctx, http.MethodPut, key, nil, r, checksum)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to S3: %v", key, domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to upload %s to S3: %w", key, statusError(resp, body))
+	}
+	return nil
+}
+
+// putMultipart uploads the object of key in parts of len(part) bytes, the first of which has been
+// read into part and the rest are read from r. An upload that fails, or that the run ends before,
+// is aborted, so the bucket does not keep, and charge for, the parts sent.
+func (t *S3BackupTarget) putMultipart(ctx context.Context, key string, r io.Reader, part []byte, size int64) error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := t.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, &initiated); err != nil {
+		return fmt.Errorf("failed to start upload of %s to S3: %w", key, err)
+	}
+	// The run may end and abort the upload while the parts are still being sent
+	var completedUpload atomic.Bool
+	abort := domain.OnExit(t.exit, "abort the upload of "+key+" to S3", func(ctx context.Context) error {
+		if completedUpload.Load() {
+			return nil
+		}
+		return t.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil)
+	})
+	defer abort()
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var completed struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+	var sent int64
+	for n := len(part); n > 0; {
+		if len(completed.Parts) == s3MaxParts {
+			return fmt.Errorf("failed to upload %s to S3: larger than %d parts of %d bytes", key, s3MaxParts, len(part))
+		}
+		number := len(completed.Parts) + 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+		etag, err := t.uploadPart(ctx, key, query, part[:n])
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d of %s to S3: %w", number, key, err)
+		}
+		completed.Parts = append(completed.Parts, completedPart{PartNumber: number, ETag: etag})
+		sent += int64(n)
+
+		n, err = io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to upload %s to S3: %v", key, err)
+		}
+	}
+	if size >= 0 && sent != size {
+		return fmt.Errorf("failed to upload %s to S3: got %d bytes, expected %d", key, sent, size)
+	}
+
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return err
+	}
+	if err := t.do(ctx, http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, body, nil); err != nil {
+		return fmt.Errorf("failed to complete upload of %s to S3: %w", key, err)
+	}
+	completedUpload.Store(true)
+	return nil
+}
+
+// uploadPart sends a part of a multipart upload and returns its ETag
+func (t *S3BackupTarget) uploadPart(ctx context.Context, key string, query url.Values, part []byte) (string, error) {
+	sum := sha256.Sum256(part)
+	req, err := t.newRequest(ctx, http.MethodPut, key, query, bytes.NewReader(part), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", domain.RedactError(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp, body)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// do sends a request of the multipart upload API with body and decodes the XML answer into v
+// unless it is nil. S3 may report a failure with 200 OK and an error document, which do returns.
+func (t *S3BackupTarget) do(ctx context.Context, method, key string, query url.Values, body []byte, v any) error {
+	sum := sha256.Sum256(body)
+	req, err := t.newRequest(ctx, method, key, query, bytes.NewReader(body), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+	if query.Has("uploads") {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return domain.RedactError(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return statusError(resp, data)
+	}
+	var failure struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &failure) == nil && failure.XMLName.Local == "Error" {
+		return fmt.Errorf("%s: %s", failure.Code, failure.Message)
+	}
+	if v != nil {
+		if err := xml.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("failed to parse response: %v", err)
+		}
+	}
+	return nil
+}
+
+// Get downloads the object of key
+func (t *S3BackupTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := t.newRequest(ctx, http.MethodGet, key, nil, nil, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from S3: %v", key, domain.RedactError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to read %s from S3: %w", key, statusError(resp, body))
+	}
+	return resp.Body, nil
+}
+
+// String returns the target as an s3:// URL
+func (t *S3BackupTarget) String() string {
+	return "s3://" + t.opts.Bucket + "/" + t.opts.Prefix
+}
+
+// newRequest builds a signed request for the object of key with the query parameters of query,
+// whose body has the hex SHA-256 checksum
+func (t *S3BackupTarget) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader, checksum string) (*http.Request, error) {
+	u := &url.URL{Scheme: "https", Host: t.opts.Bucket + ".s3." + t.opts.Region + ".amazonaws.com", Path: "/" + t.opts.Prefix + key}
+	if t.opts.Endpoint != "" {
+		endpoint, _ := url.Parse(t.opts.Endpoint)
+		u = &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: strings.TrimSuffix(endpoint.Path, "/") + "/" + t.opts.Bucket + "/" + t.opts.Prefix + key}
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	// Encode sorts the parameters, as the canonical request of the signature lists them
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	t.sign(req, checksum)
+	return req, nil
+}
+
+// sign adds the AWS Signature Version 4 of req, whose body has the hex SHA-256 payloadHash
+func (t *S3BackupTarget) sign(req *http.Request, payloadHash string) {
+	now := t.now().UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if t.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", t.opts.SessionToken)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers.String(), signedHeaders, payloadHash}, "\n")
+
+	scope := day + "/" + t.opts.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+t.opts.SecretAccessKey), day)
+	for _, part := range []string{t.opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", t.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes every byte of p but the unreserved characters and slashes, as signatures
+// require
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
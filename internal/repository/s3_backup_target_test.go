@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestS3BackupTarget_Put(t *testing.T) {
+	tests := []struct {
+		endpoint, want string
+	}{
+		{"", "https://photos.s3.eu-west-1.amazonaws.com/backup/media/a%20b.jpg"},
+		{"http://nas.lan:9000", "http://nas.lan:9000/photos/backup/media/a%20b.jpg"},
+	}
+	for _, tt := range tests {
+		var requests []*http.Request
+		target, err := NewS3BackupTarget(stubClient(&requests, ""), S3Options{
+			Bucket: "photos", Prefix: "backup/", Region: "eu-west-1", Endpoint: tt.endpoint,
+			AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token",
+		}, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		target.(*S3BackupTarget).now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+		if err := target.Put(context.Background(), "media/a b.jpg", strings.NewReader("photo"), 5, "abc123"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		req := requests[0]
+		if req.Method != http.MethodPut || req.URL.String() != tt.want {
+			t.Errorf("Expected PUT %s, got %s %s", tt.want, req.Method, req.URL)
+		}
+		if req.Header.Get("X-Amz-Content-Sha256") != "abc123" || req.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("Expected the checksum and session token headers, got %v", req.Header)
+		}
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240501/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature=") {
+			t.Errorf("Expected a SigV4 authorization, got %q", auth)
+		}
+	}
+}
+
+// s3MultipartStub answers the requests of multipart uploads, completing them with complete, and
+// records each request with the size of its body
+func s3MultipartStub(requests *[]string, complete string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var n int
+		if req.Body != nil {
+			data, _ := io.ReadAll(req.Body)
+			n = len(data)
+		}
+		*requests = append(*requests, fmt.Sprintf("%s %s %d", req.Method, req.URL.RawQuery, n))
+		resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: make(http.Header)}
+		switch {
+		case req.URL.Query().Has("uploads"):
+			resp.Body = io.NopCloser(strings.NewReader("<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>"))
+		case req.Method == http.MethodPost:
+			resp.Body = io.NopCloser(strings.NewReader(complete))
+		default:
+			resp.Header.Set("ETag", fmt.Sprintf(`"etag%d"`, len(*requests)))
+			resp.Body = io.NopCloser(strings.NewReader(""))
+		}
+		return resp, nil
+	})}
+}
+
+// pendingExitHooks keeps the cleanup registered with it, as if the run ended before the operations
+type pendingExitHooks struct {
+	steps []func(context.Context) error
+}
+
+func (h *pendingExitHooks) OnExit(name string, fn func(context.Context) error) func() error {
+	h.steps = append(h.steps, fn)
+	return func() error { return nil }
+}
+
+func TestS3BackupTarget_PutStreamed(t *testing.T) {
+	var requests []string
+	hooks := &pendingExitHooks{}
+	target, err := NewS3BackupTarget(s3MultipartStub(&requests, "<CompleteMultipartUploadResult/>"), S3Options{Bucket: "photos", AccessKeyID: "AKID", SecretAccessKey: "secret"}, hooks)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx := context.Background()
+
+	// An original smaller than a part goes in a single PUT signed with its checksum
+	if err := target.Put(ctx, "a.jpg", strings.NewReader("photo"), -1, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []string{"PUT  5"}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, requests)
+	}
+
+	// A larger one goes in parts
+	requests = nil
+	video := bytes.Repeat([]byte{1}, 2*s3PartSize+10)
+	if err := target.Put(ctx, "b.mp4", bytes.NewReader(video), -1, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []string{
+		"POST uploads= 0",
+		fmt.Sprintf("PUT partNumber=1&uploadId=u1 %d", s3PartSize),
+		fmt.Sprintf("PUT partNumber=2&uploadId=u1 %d", s3PartSize),
+		"PUT partNumber=3&uploadId=u1 10",
+		"POST uploadId=u1 " + fmt.Sprint(len(`<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>&#34;etag2&#34;</ETag></Part><Part><PartNumber>2</PartNumber><ETag>&#34;etag3&#34;</ETag></Part><Part><PartNumber>3</PartNumber><ETag>&#34;etag4&#34;</ETag></Part></CompleteMultipartUpload>`)),
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, requests)
+	}
+
+	// A completed upload is left alone when the run ends
+	requests = nil
+	for _, step := range hooks.steps {
+		step(ctx)
+	}
+	if len(hooks.steps) != 1 || len(requests) != 0 {
+		t.Errorf("Expected the abort of the upload to be registered and skipped, got %d steps and %v", len(hooks.steps), requests)
+	}
+}
+
+func TestS3BackupTarget_PutAborted(t *testing.T) {
+	// S3 may answer 200 OK with an error document when it fails to put the parts together
+	var requests []string
+	target, err := NewS3BackupTarget(s3MultipartStub(&requests, "<Error><Code>InternalError</Code><Message>try again</Message></Error>"), S3Options{Bucket: "photos", AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	err = target.Put(context.Background(), "b.mp4", bytes.NewReader(make([]byte, s3PartSize+1)), -1, "")
+	if err == nil || !strings.Contains(err.Error(), "InternalError: try again") {
+		t.Errorf("Expected the error document to fail the upload, got %v", err)
+	}
+	if last := requests[len(requests)-1]; last != "DELETE uploadId=u1 0" {
+		t.Errorf("Expected the upload to be aborted, got %v", requests)
+	}
+}
+
+func TestS3BackupTarget_GetNotFound(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Body:       io.NopCloser(strings.NewReader("<Error><Code>NoSuchKey</Code></Error>")),
+			Header:     make(http.Header),
+		}, nil
+	})}
+	target, err := NewS3BackupTarget(client, S3Options{Bucket: "photos", AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := target.Get(context.Background(), "manifest.json"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestNewS3BackupTarget_Invalid(t *testing.T) {
+	if _, err := NewS3BackupTarget(nil, S3Options{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil); err == nil {
+		t.Error("Expected a missing bucket to be rejected")
+	}
+	if _, err := NewS3BackupTarget(nil, S3Options{Bucket: "photos"}, nil); err == nil {
+		t.Error("Expected missing credentials to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// NewGooglePhotosSharingRepository creates a GooglePhotosRepository used for album sharing operations
+func NewGooglePhotosSharingRepository(client *http.Client, opts GooglePhotosOptions) domain.SharingRepository {
+	return &GooglePhotosRepository{
+		client: client,
+		opts:   opts,
+	}
+}
+
+// ShareAlbum marks an app-created album as shared and returns its share information. Both options
+// are always sent, so sharing an already-shared album again can also turn them off.
+func (r *GooglePhotosRepository) ShareAlbum(albumID string, options domain.SharedAlbumOptions) (*domain.ShareInfo, error) {
+	body := map[string]interface{}{
+		"sharedAlbumOptions": map[string]bool{
+			"isCollaborative": options.IsCollaborative,
+			"isCommentable":   options.IsCommentable,
+		},
+	}
+
+	resp, err := r.postJSON(fmt.Sprintf("%s/%s:share", albumsEndpoint, albumID), body)
+	if err != nil {
+		return nil, fmt.Errorf("share album failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseShareInfo(data, r.decoding())
+}
+
+// UnshareAlbum marks a previously shared album as private; all non-owner members lose access
+func (r *GooglePhotosRepository) UnshareAlbum(albumID string) error {
+	resp, err := r.postJSON(fmt.Sprintf("%s/%s:unshare", albumsEndpoint, albumID), struct{}{})
+	if err != nil {
+		return fmt.Errorf("unshare album failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = r.readBody(resp)
+	return err
+}
+
+// ListSharedAlbums retrieves a page of albums shared with or by the user
+func (r *GooglePhotosRepository) ListSharedAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	resp, err := r.makeAlbumsRequest(pageURL(sharedAlbumsEndpoint, "sharedAlbums", req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch shared albums: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSharedAlbumsResponse(data, r.decoding())
+}
+
+// JoinSharedAlbum joins a shared album on behalf of the user
+func (r *GooglePhotosRepository) JoinSharedAlbum(shareToken string) (*domain.Album, error) {
+	resp, err := r.postJSON(sharedAlbumsEndpoint+":join", map[string]string{"shareToken": shareToken})
+	if err != nil {
+		return nil, fmt.Errorf("join shared album failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := r.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJoinedAlbum(data, r.decoding())
+}
+
+// LeaveSharedAlbum leaves a previously joined shared album; the owner cannot leave their own album
+func (r *GooglePhotosRepository) LeaveSharedAlbum(shareToken string) error {
+	resp, err := r.postJSON(sharedAlbumsEndpoint+":leave", map[string]string{"shareToken": shareToken})
+	if err != nil {
+		return fmt.Errorf("leave shared album failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = r.readBody(resp)
+	return err
+}
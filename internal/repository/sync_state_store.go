@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileSyncStateStore implements the SyncStateStore interface with a single JSON file
+type FileSyncStateStore struct {
+	path string
+}
+
+// NewFileSyncStateStore creates a new instance of FileSyncStateStore that keeps the state in path
+func NewFileSyncStateStore(path string) domain.SyncStateStore {
+	return &FileSyncStateStore{
+		path: path,
+	}
+}
+
+// LoadSyncState returns the saved state, or an empty state when none was saved yet
+func (s *FileSyncStateStore) LoadSyncState() (*domain.SyncState, error) {
+	state := &domain.SyncState{}
+
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %v", err)
+	}
+
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state: %v", err)
+	}
+	return state, nil
+}
+
+// SaveSyncState replaces the saved state. It is written to a temporary file and renamed,
+// so a crash while saving keeps the previous state rather than a truncated one.
+func (s *FileSyncStateStore) SaveSyncState(state domain.SyncState) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create sync state directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to save sync state: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to save sync state: %v", err)
+	}
+	return nil
+}
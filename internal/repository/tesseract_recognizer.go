@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// TesseractRecognizer implements the TextRecognizer interface by running the tesseract OCR engine,
+// which reads PNG, JPEG, TIFF, BMP, GIF and WebP images as far as its Leptonica was built with them
+type TesseractRecognizer struct {
+	binary string
+	lang   string
+}
+
+// NewTesseractRecognizer creates a new instance of TesseractRecognizer that runs binary, a path or
+// a name looked up in PATH, with the trained data of lang, such as "eng" or "eng+deu"; empty values
+// run "tesseract" with English
+func NewTesseractRecognizer(binary, lang string) domain.TextRecognizer {
+	if binary == "" {
+		binary = "tesseract"
+	}
+	if lang == "" {
+		lang = "eng"
+	}
+	return &TesseractRecognizer{
+		binary: binary,
+		lang:   lang,
+	}
+}
+
+// RecognizeText implements domain.TextRecognizer. The image is copied to a temporary directory
+// first, since tesseract reads files, and the text is read from its standard output.
+func (r *TesseractRecognizer) RecognizeText(ctx context.Context, name string, content io.Reader) (string, error) {
+	binary, err := exec.LookPath(r.binary)
+	if err != nil {
+		return "", fmt.Errorf("tesseract not found, install it or pass its path with --tesseract: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "gpm-tesseract-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "image"+strings.ToLower(filepath.Ext(name)))
+	f, err := os.Create(input)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, tesseractArgs(input, r.lang)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := lastLines(stderr.String(), 3)
+		if strings.Contains(msg, "Unsupported image type") || strings.Contains(msg, "Error during processing") {
+			return "", fmt.Errorf("%w: %s", domain.ErrUnsupportedFormat, name)
+		}
+		if msg != "" {
+			return "", fmt.Errorf("tesseract failed on %s: %v: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("tesseract failed on %s: %v", name, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// tesseractArgs builds the tesseract command line, writing the text to standard output
+func tesseractArgs(input, lang string) []string {
+	return []string{input, "stdout", "-l", lang}
+}
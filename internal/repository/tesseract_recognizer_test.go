@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTesseractArgs(t *testing.T) {
+	args := tesseractArgs("/tmp/receipt.png", "eng+deu")
+
+	if line := strings.Join(args, " "); line != "/tmp/receipt.png stdout -l eng+deu" {
+		t.Errorf("Unexpected arguments %s", line)
+	}
+}
+
+func TestTesseractRecognizer_MissingBinary(t *testing.T) {
+	recognizer := NewTesseractRecognizer("tesseract-that-does-not-exist", "")
+
+	_, err := recognizer.RecognizeText(context.Background(), "a.png", strings.NewReader("image"))
+
+	if err == nil || !strings.Contains(err.Error(), "--tesseract") {
+		t.Errorf("Expected an error pointing at --tesseract, got %v", err)
+	}
+}
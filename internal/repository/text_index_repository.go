@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+	"krupesh.faldu/internal/domain"
+)
+
+// Buckets of recognized text in the index database. Texts are stored as JSON keyed by path; the
+// words of each text use one nested bucket per word whose keys are the paths holding it. Rebuilding
+// the index leaves them alone.
+var (
+	textsBucket     = []byte("texts")
+	textTermsBucket = []byte("text_terms")
+)
+
+// NewBoltTextIndexRepository opens or creates the index database at path for storing and
+// searching recognized text. Like NewBoltIndexRepository it locks the file while open.
+func NewBoltTextIndexRepository(path string) (domain.TextIndexRepository, error) {
+	return openBoltIndex(path)
+}
+
+// LoadText returns the text stored for path, or nil if there is none
+func (r *BoltIndexRepository) LoadText(path string) (*domain.DocumentText, error) {
+	var doc *domain.DocumentText
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		doc, err = loadText(tx, path)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text index: %v", err)
+	}
+	return doc, nil
+}
+
+// SaveText stores doc and indexes its words, dropping the words of the text stored for its path before
+func (r *BoltIndexRepository) SaveText(doc domain.DocumentText) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		texts, err := tx.CreateBucketIfNotExists(textsBucket)
+		if err != nil {
+			return err
+		}
+		terms, err := tx.CreateBucketIfNotExists(textTermsBucket)
+		if err != nil {
+			return err
+		}
+
+		previous, err := loadText(tx, doc.Path)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			for _, term := range domain.TextTerms(previous.Text) {
+				b := terms.Bucket([]byte(term))
+				if b == nil {
+					continue
+				}
+				if err := b.Delete([]byte(doc.Path)); err != nil {
+					return err
+				}
+				if k, _ := b.Cursor().First(); k == nil {
+					if err := terms.DeleteBucket([]byte(term)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for _, term := range domain.TextTerms(doc.Text) {
+			b, err := terms.CreateBucketIfNotExists([]byte(term))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(doc.Path), nil); err != nil {
+				return err
+			}
+		}
+		return putJSON(texts, doc.Path, doc)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write text index: %v", err)
+	}
+	return nil
+}
+
+// SearchText returns the documents holding a word starting with each of terms, sorted by path
+func (r *BoltIndexRepository) SearchText(terms []string) ([]domain.DocumentText, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var docs []domain.DocumentText
+	err := r.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(textTermsBucket)
+		if index == nil {
+			return nil
+		}
+
+		var matches map[string]bool
+		for _, term := range terms {
+			paths := make(map[string]bool)
+			prefix := []byte(term)
+			c := index.Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if v != nil {
+					continue
+				}
+				if err := index.Bucket(k).ForEach(func(path, _ []byte) error {
+					if matches == nil || matches[string(path)] {
+						paths[string(path)] = true
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+			matches = paths
+			if len(matches) == 0 {
+				return nil
+			}
+		}
+
+		for path := range matches {
+			doc, err := loadText(tx, path)
+			if err != nil {
+				return err
+			}
+			if doc != nil {
+				docs = append(docs, *doc)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search text index: %v", err)
+	}
+
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+	return docs, nil
+}
+
+// loadText decodes the text stored for path, or returns nil if there is none
+func loadText(tx *bolt.Tx, path string) (*domain.DocumentText, error) {
+	b := tx.Bucket(textsBucket)
+	if b == nil {
+		return nil, nil
+	}
+	data := b.Get([]byte(path))
+	if data == nil {
+		return nil, nil
+	}
+	var doc domain.DocumentText
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("corrupt entry %s: %v", path, err)
+	}
+	return &doc, nil
+}
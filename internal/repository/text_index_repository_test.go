@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestBoltTextIndexRepository_SaveAndSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	texts, err := NewBoltTextIndexRepository(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer texts.Close()
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, doc := range []domain.DocumentText{
+		{Path: "/photos/receipt.jpg", Text: "CAFE ROMA\nTotal 12.50 EUR", ModTime: modTime},
+		{Path: "/photos/board.png", Text: "Sprint goals: receipts export", ModTime: modTime},
+	} {
+		if err := texts.SaveText(doc); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	search := func(query string) string {
+		t.Helper()
+		docs, err := texts.SearchText(domain.TextTerms(query))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var paths []string
+		for _, doc := range docs {
+			paths = append(paths, doc.Path)
+		}
+		return strings.Join(paths, ",")
+	}
+
+	if got := search("receipt"); got != "/photos/board.png" {
+		t.Errorf("Expected words to match by prefix, got %s", got)
+	}
+	if got := search("total eur"); got != "/photos/receipt.jpg" {
+		t.Errorf("Expected every word to match, got %s", got)
+	}
+	if got := search("total sprint"); got != "" {
+		t.Errorf("Expected no document with both words, got %s", got)
+	}
+
+	// Saving a path again replaces its words
+	if err := texts.SaveText(domain.DocumentText{Path: "/photos/receipt.jpg", Text: "Invoice 42"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := search("cafe"); got != "" {
+		t.Errorf("Expected the old words to be gone, got %s", got)
+	}
+	if got := search("invoice"); got != "/photos/receipt.jpg" {
+		t.Errorf("Expected the new words to match, got %s", got)
+	}
+
+	doc, err := texts.LoadText("/photos/board.png")
+	if err != nil || doc == nil || !doc.ModTime.Equal(modTime) {
+		t.Errorf("Expected the stored text, got %+v (%v)", doc, err)
+	}
+	if doc, err := texts.LoadText("/photos/missing.jpg"); err != nil || doc != nil {
+		t.Errorf("Expected no text for an unknown path, got %+v (%v)", doc, err)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileThroughputStore implements the ThroughputStore interface with a single JSON file holding
+// the throughput of every kind of job
+type FileThroughputStore struct {
+	path string
+}
+
+// NewFileThroughputStore creates a new instance of FileThroughputStore that keeps throughputs in path
+func NewFileThroughputStore(path string) domain.ThroughputStore {
+	return &FileThroughputStore{
+		path: path,
+	}
+}
+
+// LoadThroughput returns the throughput saved for a kind of job, or nil when there is none
+func (s *FileThroughputStore) LoadThroughput(job string) (*domain.Throughput, error) {
+	throughputs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	throughput, ok := throughputs[job]
+	if !ok {
+		return nil, nil
+	}
+	return &throughput, nil
+}
+
+// SaveThroughput replaces the throughput of a kind of job, keeping the others. The file is
+// written to a temporary file and renamed, so a crash while saving keeps the previous one.
+func (s *FileThroughputStore) SaveThroughput(job string, throughput domain.Throughput) error {
+	throughputs, err := s.load()
+	if err != nil {
+		return err
+	}
+	throughputs[job] = throughput
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create throughput directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(throughputs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode throughput: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to save throughput: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to save throughput: %v", err)
+	}
+	return nil
+}
+
+// load reads the throughputs of every kind of job; a missing file holds none
+func (s *FileThroughputStore) load() (map[string]domain.Throughput, error) {
+	throughputs := make(map[string]domain.Throughput)
+
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return throughputs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read throughput: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &throughputs); err != nil {
+		return nil, fmt.Errorf("failed to parse throughput: %v", err)
+	}
+	return throughputs, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileThumbnailCache implements the ThumbnailCache interface with one file per thumbnail, in a
+// folder per size. Media item IDs are hashed into file names so they cannot escape the folder.
+type FileThumbnailCache struct {
+	dir string
+}
+
+// NewFileThumbnailCache creates a new instance of FileThumbnailCache that keeps thumbnails in dir
+func NewFileThumbnailCache(dir string) domain.ThumbnailCache {
+	return &FileThumbnailCache{
+		dir: dir,
+	}
+}
+
+// LoadThumbnail returns the cached thumbnail of a media item at size pixels, or nil when there is none
+func (c *FileThumbnailCache) LoadThumbnail(mediaItemID string, size int) ([]byte, error) {
+	data, err := os.ReadFile(c.path(mediaItemID, size))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %v", err)
+	}
+	return data, nil
+}
+
+// SaveThumbnail stores the thumbnail of a media item at size pixels. The file is written under a
+// temporary name and renamed, so concurrent readers never see a partial thumbnail.
+func (c *FileThumbnailCache) SaveThumbnail(mediaItemID string, size int, data []byte) error {
+	path := c.path(mediaItemID, size)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".thumbnail-*")
+	if err != nil {
+		return fmt.Errorf("failed to save thumbnail: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save thumbnail: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save thumbnail: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save thumbnail: %v", err)
+	}
+	return nil
+}
+
+// path returns the file that holds the thumbnail of a media item at size pixels
+func (c *FileThumbnailCache) path(mediaItemID string, size int) string {
+	sum := sha256.Sum256([]byte(mediaItemID))
+	return filepath.Join(c.dir, strconv.Itoa(size), hex.EncodeToString(sum[:]))
+}
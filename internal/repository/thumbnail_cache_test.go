@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"testing"
+)
+
+func TestFileThumbnailCache_SaveAndLoad(t *testing.T) {
+	cache := NewFileThumbnailCache(t.TempDir())
+
+	if data, err := cache.LoadThumbnail("item-1", 240); err != nil || data != nil {
+		t.Fatalf("Expected no thumbnail before saving, got %q, %v", data, err)
+	}
+	if err := cache.SaveThumbnail("item-1", 240, []byte("jpeg")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, err := cache.LoadThumbnail("item-1", 240)
+	if err != nil || string(data) != "jpeg" {
+		t.Errorf("Expected the saved thumbnail, got %q, %v", data, err)
+	}
+	if data, _ := cache.LoadThumbnail("item-1", 120); data != nil {
+		t.Errorf("Expected sizes to be cached separately, got %q", data)
+	}
+	if data, _ := cache.LoadThumbnail("../item-1", 240); data != nil {
+		t.Errorf("Expected IDs not to be used as paths, got %q", data)
+	}
+}
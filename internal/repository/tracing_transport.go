@@ -0,0 +1,445 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Batching of exported spans: a batch goes once it holds maxSpanBatch spans or the oldest span
+// waited exportInterval, and whatever is left when the run ends
+const (
+	maxSpanBatch   = 512
+	exportInterval = 5 * time.Second
+)
+
+// Kinds and status codes of spans in OTLP
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusCodeError  = 2
+)
+
+// TracingOptions configures an OTLPTracer
+type TracingOptions struct {
+	// Endpoint is the URL spans are posted to, such as http://localhost:4318/v1/traces
+	Endpoint string
+	// Headers are sent with every export, such as the API key of a hosted collector
+	Headers map[string]string
+	// ServiceName is the service.name of the spans; "gpm" when empty
+	ServiceName string
+	// ResourceAttributes describe where the spans come from, such as deployment.environment
+	ResourceAttributes map[string]string
+	// TraceParent is a W3C traceparent whose trace the spans of the run join, beneath the span
+	// of the pipeline that started it
+	TraceParent string
+}
+
+// TracingOptionsFromEnv reads the standard OpenTelemetry exporter variables:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with /v1/traces added,
+// OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES, as well as
+// TRACEPARENT. Tracing is off without an endpoint, with OTEL_TRACES_EXPORTER=none or
+// OTEL_SDK_DISABLED=true. Spans are only sent as OTLP/HTTP JSON.
+func TracingOptionsFromEnv(getenv func(string) string) (opts TracingOptions, enabled bool, err error) {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return opts, false, nil
+	}
+	switch exporter := getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "otlp":
+	case "none":
+		return opts, false, nil
+	default:
+		return opts, false, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q: only otlp and none are supported", exporter)
+	}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		if protocol := getenv(name); protocol != "" {
+			if protocol != "http/json" {
+				return opts, false, fmt.Errorf("invalid %s %q: only http/json is supported", name, protocol)
+			}
+			break
+		}
+	}
+
+	opts.Endpoint = getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); opts.Endpoint == "" && base != "" {
+		opts.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if opts.Endpoint == "" {
+		return opts, false, nil
+	}
+	if u, err := url.Parse(opts.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return opts, false, fmt.Errorf("invalid OTLP endpoint %q: must be an http:// or https:// URL", opts.Endpoint)
+	}
+
+	if opts.Headers, err = parseKeyValues("OTEL_EXPORTER_OTLP_HEADERS", getenv("OTEL_EXPORTER_OTLP_HEADERS")); err != nil {
+		return opts, false, err
+	}
+	traceHeaders, err := parseKeyValues("OTEL_EXPORTER_OTLP_TRACES_HEADERS", getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS"))
+	if err != nil {
+		return opts, false, err
+	}
+	for key, value := range traceHeaders {
+		opts.Headers[key] = value
+	}
+	if opts.ResourceAttributes, err = parseKeyValues("OTEL_RESOURCE_ATTRIBUTES", getenv("OTEL_RESOURCE_ATTRIBUTES")); err != nil {
+		return opts, false, err
+	}
+	opts.ServiceName = getenv("OTEL_SERVICE_NAME")
+	opts.TraceParent = getenv("TRACEPARENT")
+	return opts, true, nil
+}
+
+// parseKeyValues parses a list such as "key1=value1,key2=value2" with percent-encoded values
+func parseKeyValues(name, list string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid %s: %q is not key=value", name, pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
+
+// spanKey is the context key of the ID of the span the spans started with the context go beneath
+type spanKey struct{}
+
+// spanData is a finished span waiting to be exported
+type spanData struct {
+	traceID, spanID, parentID string
+	name                      string
+	kind                      int
+	start, end                time.Time
+	attrs                     []any
+	err                       error
+}
+
+// OTLPTracer records spans and exports them in batches to an OpenTelemetry collector over
+// OTLP/HTTP JSON. Spans of a run share a trace: a span goes beneath the span whose context it was
+// started with, or else beneath the one started with StartRun, which is itself beneath the span of
+// TraceParent when one is given. Every method may
+// be called on a nil OTLPTracer, which records nothing.
+type OTLPTracer struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	resource []any
+	traceID  string
+	parentID string
+
+	mu         sync.Mutex
+	runID      string
+	batch      []spanData
+	batchStart time.Time
+	exports    sync.WaitGroup
+	exportErrs []error
+}
+
+// NewOTLPTracer creates a new instance of OTLPTracer exporting spans with client as opts says.
+// An invalid TraceParent starts a trace of its own.
+func NewOTLPTracer(client *http.Client, opts TracingOptions) *OTLPTracer {
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = opts.ResourceAttributes["service.name"]
+	}
+	if serviceName == "" {
+		serviceName = "gpm"
+	}
+	resource := []any{"service.name", serviceName}
+	for key, value := range opts.ResourceAttributes {
+		if key != "service.name" {
+			resource = append(resource, key, value)
+		}
+	}
+
+	t := &OTLPTracer{
+		client:   client,
+		endpoint: opts.Endpoint,
+		headers:  opts.Headers,
+		resource: resource,
+	}
+	t.traceID, t.parentID = parseTraceParent(opts.TraceParent)
+	if t.traceID == "" {
+		t.traceID = randomID(16)
+	}
+	return t
+}
+
+// parseTraceParent returns the trace and span IDs of a W3C traceparent such as
+// 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01, or empty strings when it is invalid
+func parseTraceParent(traceParent string) (traceID, spanID string) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHexID(parts[1], 16) || !isHexID(parts[2], 8) {
+		return "", ""
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2])
+}
+
+// isHexID reports whether s is the hex of a non-zero ID of n bytes
+func isHexID(s string, n int) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == n && strings.Trim(s, "0") != ""
+}
+
+// randomID returns n random bytes in hex
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// StartRun begins the span of the whole run, which becomes the parent of the spans started after it
+func (t *OTLPTracer) StartRun(name string, attrs ...any) domain.Span {
+	if t == nil {
+		return domain.NopTracer{}
+	}
+	span := t.start(context.Background(), name, spanKindInternal, attrs)
+	t.mu.Lock()
+	t.runID = span.data.spanID
+	t.mu.Unlock()
+	return span
+}
+
+// Start implements domain.Tracer
+func (t *OTLPTracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, domain.Span) {
+	if t == nil {
+		return ctx, domain.NopTracer{}
+	}
+	span := t.start(ctx, name, spanKindInternal, attrs)
+	return context.WithValue(ctx, spanKey{}, span.data.spanID), span
+}
+
+// start begins a span of kind beneath the span of ctx, or beneath the run when ctx has none
+func (t *OTLPTracer) start(ctx context.Context, name string, kind int, attrs []any) *otlpSpan {
+	parentID, _ := ctx.Value(spanKey{}).(string)
+	if parentID == "" {
+		t.mu.Lock()
+		parentID = t.runID
+		t.mu.Unlock()
+	}
+	if parentID == "" {
+		parentID = t.parentID
+	}
+	return &otlpSpan{tracer: t, data: spanData{
+		traceID:  t.traceID,
+		spanID:   randomID(8),
+		parentID: parentID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		attrs:    attrs,
+	}}
+}
+
+// finish queues a finished span, sending the batch in the background once it is due
+func (t *OTLPTracer) finish(span spanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.batch) == 0 {
+		t.batchStart = span.end
+	}
+	t.batch = append(t.batch, span)
+	if len(t.batch) < maxSpanBatch && span.end.Sub(t.batchStart) < exportInterval {
+		return
+	}
+
+	batch := t.batch
+	t.batch = nil
+	t.exports.Add(1)
+	go func() {
+		defer t.exports.Done()
+		if err := t.export(batch); err != nil {
+			t.mu.Lock()
+			t.exportErrs = append(t.exportErrs, err)
+			t.mu.Unlock()
+		}
+	}()
+}
+
+// Flush sends the spans not exported yet and waits for the exports in flight. It returns the
+// errors of every export that failed since the last Flush.
+func (t *OTLPTracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	batch := t.batch
+	t.batch = nil
+	t.mu.Unlock()
+
+	var err error
+	if len(batch) > 0 {
+		err = t.export(batch)
+	}
+	t.exports.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = errors.Join(append(t.exportErrs, err)...)
+	t.exportErrs = nil
+	return err
+}
+
+// export posts spans to the collector as an OTLP/HTTP JSON request
+func (t *OTLPTracer) export(spans []spanData) error {
+	encoded := make([]map[string]any, len(spans))
+	for i, span := range spans {
+		encoded[i] = encodeSpan(span)
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": encodeAttributes(t.resource)},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "krupesh.faldu"},
+				"spans": encoded,
+			}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export %d spans: %v", len(spans), domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export %d spans: %s: %s", len(spans), resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// encodeSpan returns span as OTLP JSON
+func encodeSpan(span spanData) map[string]any {
+	encoded := map[string]any{
+		"traceId":           span.traceID,
+		"spanId":            span.spanID,
+		"name":              span.name,
+		"kind":              span.kind,
+		"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+		"attributes":        encodeAttributes(span.attrs),
+	}
+	if span.parentID != "" {
+		encoded["parentSpanId"] = span.parentID
+	}
+	if span.err != nil {
+		encoded["status"] = map[string]any{"code": statusCodeError, "message": domain.RedactSecrets(span.err.Error())}
+	}
+	return encoded
+}
+
+// encodeAttributes returns attributes given as alternating keys and values as OTLP JSON
+func encodeAttributes(attrs []any) []map[string]any {
+	encoded := make([]map[string]any, 0, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		var value map[string]any
+		switch v := attrs[i+1].(type) {
+		case string:
+			value = map[string]any{"stringValue": domain.RedactSecrets(v)}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": domain.RedactSecrets(fmt.Sprint(v))}
+		}
+		encoded = append(encoded, map[string]any{"key": fmt.Sprint(attrs[i]), "value": value})
+	}
+	return encoded
+}
+
+// otlpSpan is a span of an OTLPTracer being recorded
+type otlpSpan struct {
+	tracer *OTLPTracer
+	data   spanData
+	once   sync.Once
+}
+
+// End implements domain.Span
+func (s *otlpSpan) End(err error) {
+	s.once.Do(func() {
+		s.data.end, s.data.err = time.Now(), err
+		s.tracer.finish(s.data)
+	})
+}
+
+// TracingTransport records a client span for every HTTP request sent through it, beneath the
+// span of the request context or else the span of the run
+type TracingTransport struct {
+	next   http.RoundTripper
+	tracer *OTLPTracer
+}
+
+// NewTracingTransport creates a new instance of TracingTransport sending requests through next,
+// or http.DefaultTransport when next is nil; a nil tracer returns next unchanged
+func NewTracingTransport(next http.RoundTripper, tracer *OTLPTracer) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if tracer == nil {
+		return next
+	}
+	return &TracingTransport{
+		next:   next,
+		tracer: tracer,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Query strings may hold tokens, so only the endpoint is recorded
+	span := t.tracer.start(req.Context(), req.Method, spanKindClient, []any{
+		"http.request.method", req.Method,
+		"server.address", req.URL.Hostname(),
+		"url.template", metricsEndpoint(req.URL),
+	})
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.End(err)
+		return resp, err
+	}
+	span.data.attrs = append(span.data.attrs, "http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.End(fmt.Errorf("%s", resp.Status))
+	} else {
+		span.End(nil)
+	}
+	return resp, nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingOptionsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT":       "http://collector:4318/",
+		"OTEL_EXPORTER_OTLP_HEADERS":        "x-api-key=secret%20key, x-team=photos",
+		"OTEL_EXPORTER_OTLP_TRACES_HEADERS": "x-team=media",
+		"OTEL_RESOURCE_ATTRIBUTES":          "deployment.environment=nas",
+		"OTEL_SERVICE_NAME":                 "nightly-sync",
+	}
+	opts, enabled, err := TracingOptionsFromEnv(func(key string) string { return env[key] })
+	if err != nil || !enabled {
+		t.Fatalf("Expected tracing to be enabled, got %v, %v", enabled, err)
+	}
+	if opts.Endpoint != "http://collector:4318/v1/traces" || opts.Headers["x-api-key"] != "secret key" || opts.Headers["x-team"] != "media" ||
+		opts.ResourceAttributes["deployment.environment"] != "nas" || opts.ServiceName != "nightly-sync" {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		enabled bool
+		err     string
+	}{
+		{"no endpoint", map[string]string{"OTEL_SERVICE_NAME": "gpm"}, false, ""},
+		{"exporter none", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_TRACES_EXPORTER": "none"}, false, ""},
+		{"sdk disabled", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_SDK_DISABLED": "true"}, false, ""},
+		{"traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://c/traces"}, true, ""},
+		{"grpc", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4317", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, false, "only http/json"},
+		{"zipkin", map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, false, "only otlp and none"},
+		{"no scheme", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, false, "must be an http:// or https:// URL"},
+		{"bad header", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_EXPORTER_OTLP_HEADERS": "token"}, false, "not key=value"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, enabled, err := TracingOptionsFromEnv(func(key string) string { return tc.env[key] })
+			if enabled != tc.enabled || (tc.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tc.err)) {
+				t.Errorf("Expected enabled %v and error %q, got %v and %v", tc.enabled, tc.err, enabled, err)
+			}
+		})
+	}
+}
+
+// otlpSpanJSON is a span as the collector receives it
+type otlpSpanJSON struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	} `json:"attributes"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+func TestOTLPTracer(t *testing.T) {
+	var spans []otlpSpanJSON
+	var service, apiKey string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []struct {
+						Key   string            `json:"key"`
+						Value map[string]string `json:"value"`
+					} `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []otlpSpanJSON `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Expected OTLP JSON, got %v", err)
+		}
+		service, apiKey = body.ResourceSpans[0].Resource.Attributes[0].Value["stringValue"], r.Header.Get("x-api-key")
+		spans = append(spans, body.ResourceSpans[0].ScopeSpans[0].Spans...)
+	}))
+	defer collector.Close()
+
+	tracer := NewOTLPTracer(collector.Client(), TracingOptions{
+		Endpoint:    collector.URL + "/v1/traces",
+		Headers:     map[string]string{"x-api-key": "key"},
+		TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	})
+	run := tracer.StartRun("gpm albums list", "gpm.command", "albums list")
+
+	var requests []*http.Request
+	client := &http.Client{Transport: NewTracingTransport(stubClient(&requests, `{}`).Transport, tracer)}
+	ctx, span := tracer.Start(context.Background(), "album.list", "page_size", 50)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, albumsEndpoint+"?pageToken=secret", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	span.End(io.ErrUnexpectedEOF)
+	run.End(nil)
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if service != "gpm" || apiKey != "key" {
+		t.Errorf("Expected the service gpm and the headers of the options, got %q and %q", service, apiKey)
+	}
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %+v", spans)
+	}
+	call, list, root := spans[0], spans[1], spans[2]
+	if root.Name != "gpm albums list" || root.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("Expected the run beneath the traceparent, got %+v", root)
+	}
+	for _, s := range spans {
+		if s.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("Expected every span in the trace of the traceparent, got %+v", s)
+		}
+	}
+	if list.Name != "album.list" || list.ParentSpanID != root.SpanID || list.Status.Code != statusCodeError || list.Status.Message != "unexpected EOF" {
+		t.Errorf("Expected a failed album.list beneath the run, got %+v", list)
+	}
+	if call.Name != "GET" || call.Kind != spanKindClient || call.ParentSpanID != list.SpanID || call.Status.Code != 0 {
+		t.Errorf("Expected a client span of the request beneath album.list, got %+v", call)
+	}
+	for _, attr := range call.Attributes {
+		if attr.Key == "url.template" && attr.Value["stringValue"] != "/v1/albums" {
+			t.Errorf("Expected the endpoint without its query, got %v", attr.Value)
+		}
+	}
+
+	// A nil tracer records nothing and leaves the transport alone
+	var none *OTLPTracer
+	_, span = none.Start(context.Background(), "album.list")
+	span.End(nil)
+	if err := none.Flush(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if next := http.DefaultTransport; NewTracingTransport(next, nil) != next {
+		t.Error("Expected a nil tracer to return the transport unchanged")
+	}
+}
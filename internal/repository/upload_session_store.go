@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// FileUploadSessionStore implements the UploadSessionStore interface with one JSON file per session.
+// Keys are hashed into file names since they usually contain paths.
+type FileUploadSessionStore struct {
+	dir string
+}
+
+// NewFileUploadSessionStore creates a new instance of FileUploadSessionStore that keeps sessions in dir
+func NewFileUploadSessionStore(dir string) domain.UploadSessionStore {
+	return &FileUploadSessionStore{
+		dir: dir,
+	}
+}
+
+// LoadUploadSession returns the session saved under key, or nil when there is none
+func (s *FileUploadSessionStore) LoadUploadSession(key string) (*domain.UploadSession, error) {
+	b, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload session: %v", err)
+	}
+
+	var session domain.UploadSession
+	if err := json.Unmarshal(b, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse upload session: %v", err)
+	}
+	return &session, nil
+}
+
+// SaveUploadSession persists a session under key, replacing any previous one
+func (s *FileUploadSessionStore) SaveUploadSession(key string, session domain.UploadSession) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create upload session directory: %v", err)
+	}
+
+	b, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload session: %v", err)
+	}
+
+	if err := os.WriteFile(s.path(key), b, 0o600); err != nil {
+		return fmt.Errorf("failed to save upload session: %v", err)
+	}
+	return nil
+}
+
+// DeleteUploadSession removes the session saved under key; a missing session is not an error
+func (s *FileUploadSessionStore) DeleteUploadSession(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete upload session: %v", err)
+	}
+	return nil
+}
+
+// path returns the file that holds the session for key
+func (s *FileUploadSessionStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
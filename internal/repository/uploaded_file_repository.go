@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"krupesh.faldu/internal/domain"
+)
+
+// uploadedFilesBucket holds the files uploaded by watching a folder as JSON keyed by the checksum
+// of their content. Rebuilding the index leaves it alone.
+var uploadedFilesBucket = []byte("uploaded_files")
+
+// NewBoltUploadedFileRepository opens or creates the index database at path for recording
+// uploaded files. Like NewBoltIndexRepository it locks the file while open.
+func NewBoltUploadedFileRepository(path string) (domain.UploadedFileRepository, error) {
+	return openBoltIndex(path)
+}
+
+// LoadUploaded returns the record of the file with the checksum sha256, or nil if there is none
+func (r *BoltIndexRepository) LoadUploaded(sha256 string) (*domain.UploadedFile, error) {
+	var file *domain.UploadedFile
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(uploadedFilesBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(sha256))
+		if data == nil {
+			return nil
+		}
+		file = &domain.UploadedFile{}
+		return json.Unmarshal(data, file)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded files: %v", err)
+	}
+	return file, nil
+}
+
+// SaveUploaded records file under the checksum of its content
+func (r *BoltIndexRepository) SaveUploaded(file domain.UploadedFile) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(uploadedFilesBucket)
+		if err != nil {
+			return err
+		}
+		return putJSON(b, file.SHA256, file)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record uploaded file: %v", err)
+	}
+	return nil
+}
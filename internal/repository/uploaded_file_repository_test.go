@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestBoltUploadedFileRepository_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	repo, err := openBoltIndex(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer repo.Close()
+
+	if file, err := repo.LoadUploaded("abc"); err != nil || file != nil {
+		t.Fatalf("Expected no record before anything was uploaded, got %+v (%v)", file, err)
+	}
+
+	uploaded := domain.UploadedFile{SHA256: "abc", Path: "DCIM/IMG_1.jpg", Size: 42, MediaItemID: "m1", UploadedAt: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)}
+	if err := repo.SaveUploaded(uploaded); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Rebuilding the index must not forget what was uploaded
+	if err := repo.Replace(domain.IndexSnapshot{UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	file, err := repo.LoadUploaded("abc")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if file == nil || *file != uploaded {
+		t.Errorf("Expected %+v, got %+v", uploaded, file)
+	}
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Self-hosted URL shortener APIs supported by NewURLShortener
+const (
+	ShortenerShlink = "shlink"
+	ShortenerKutt   = "kutt"
+)
+
+// HTTPURLShortener implements the URLShortener interface with the REST API of a Shlink or Kutt server
+type HTTPURLShortener struct {
+	client   *http.Client
+	provider string
+	baseURL  string
+	apiKey   string
+}
+
+// NewURLShortener creates a new instance of HTTPURLShortener for the server at baseURL.
+// provider is ShortenerShlink or ShortenerKutt.
+func NewURLShortener(client *http.Client, provider, baseURL, apiKey string) (domain.URLShortener, error) {
+	provider = strings.ToLower(provider)
+	if provider != ShortenerShlink && provider != ShortenerKutt {
+		return nil, fmt.Errorf("unknown URL shortener %q, expected %s or %s", provider, ShortenerShlink, ShortenerKutt)
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("URL shortener %s needs the URL of the server", provider)
+	}
+
+	return &HTTPURLShortener{
+		client:   client,
+		provider: provider,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		apiKey:   apiKey,
+	}, nil
+}
+
+// Shorten asks the server for a short link to longURL, reusing an existing one for the same URL
+func (s *HTTPURLShortener) Shorten(longURL string) (string, error) {
+	var endpoint, keyHeader string
+	var body any
+	switch s.provider {
+	case ShortenerShlink:
+		endpoint, keyHeader = s.baseURL+"/rest/v3/short-urls", "X-Api-Key"
+		body = map[string]any{"longUrl": longURL, "findIfExists": true}
+	default:
+		endpoint, keyHeader = s.baseURL+"/api/v2/links", "X-API-KEY"
+		body = map[string]any{"target": longURL, "reuse": true}
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(keyHeader, s.apiKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to shorten URL: %v", domain.RedactError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+	// Kutt answers 201 Created, Shlink 200 OK
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", statusError(resp, data)
+	}
+
+	var result struct {
+		ShortURL string `json:"shortUrl"`
+		Link     string `json:"link"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse %s response: %v", s.provider, err)
+	}
+
+	short := result.ShortURL
+	if s.provider == ShortenerKutt {
+		short = result.Link
+	}
+	if short == "" {
+		return "", fmt.Errorf("%s response has no short link", s.provider)
+	}
+	return short, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPURLShortener_Shorten(t *testing.T) {
+	tests := []struct {
+		provider, response, path, keyHeader, urlField, want string
+	}{
+		{ShortenerShlink, `{"shortCode":"abc","shortUrl":"https://s.test/abc"}`, "/rest/v3/short-urls", "X-Api-Key", "longUrl", "https://s.test/abc"},
+		{ShortenerKutt, `{"id":"1","link":"https://kutt.test/xyz"}`, "/api/v2/links", "X-API-KEY", "target", "https://kutt.test/xyz"},
+	}
+	for _, tt := range tests {
+		var recorded []*http.Request
+		shortener, err := NewURLShortener(stubClient(&recorded, tt.response), tt.provider, "https://short.test/", "secret")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		short, err := shortener.Shorten("https://photos.app.goo.gl/long")
+
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if short != tt.want {
+			t.Errorf("Expected %q from %s, got %q", tt.want, tt.provider, short)
+		}
+		req := recorded[0]
+		if req.URL.String() != "https://short.test"+tt.path || req.Header.Get(tt.keyHeader) != "secret" {
+			t.Errorf("Expected a request to %s with the API key, got %s", tt.path, req.URL)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body[tt.urlField] != "https://photos.app.goo.gl/long" {
+			t.Errorf("Expected the long URL in %s, got %v", tt.urlField, body)
+		}
+	}
+}
+
+func TestNewURLShortener_Invalid(t *testing.T) {
+	if _, err := NewURLShortener(nil, "bitly", "https://short.test", ""); err == nil {
+		t.Error("Expected an unknown provider to be rejected")
+	}
+	if _, err := NewURLShortener(nil, ShortenerShlink, "", ""); err == nil {
+		t.Error("Expected a missing server URL to be rejected")
+	}
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVipsThumbnailArgs(t *testing.T) {
+	args := vipsThumbnailArgs("/tmp/photo.heic", "/tmp/thumbnail.jpg", 256)
+
+	if line := strings.Join(args, " "); line != "/tmp/photo.heic --size 256x256> -o /tmp/thumbnail.jpg[Q=85,strip]" {
+		t.Errorf("Unexpected arguments %s", line)
+	}
+}
+
+func TestVipsThumbnailer_MissingBinary(t *testing.T) {
+	thumbnailer := NewVipsThumbnailer("vipsthumbnail-that-does-not-exist")
+
+	_, err := thumbnailer.Thumbnail(context.Background(), "a.heic", strings.NewReader("photo"), 256)
+
+	if err == nil || !strings.Contains(err.Error(), "--vips") {
+		t.Errorf("Expected an error pointing at --vips, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// listAlbums serves a page of the albums, oldest first
+func (s *Server) listAlbums(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, token := queryPage(req)
+	start, end, next, err := page(len(s.albums), size, token, defaultAlbumPageSize, domain.MaxAlbumPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	albums := []domain.Album{}
+	for i := start; i < end; i++ {
+		albums = append(albums, s.albumWithCount(i))
+	}
+	writeFields(w, req, map[string]any{"albums": albums, "nextPageToken": next})
+}
+
+// getAlbum serves one album
+func (s *Server) getAlbum(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.albumIndex(req.PathValue("id"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeFields(w, req, s.albumWithCount(i))
+}
+
+// createAlbum creates an app-created album, which the app may add media items to
+func (s *Server) createAlbum(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Album struct {
+			Title string `json:"title"`
+		} `json:"album"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Album.Title == "" {
+		writeError(w, http.StatusBadRequest, "Request must contain an album with a title.")
+		return
+	}
+
+	album := s.AddAlbum(domain.Album{Title: body.Album.Title, IsWriteable: true})
+	writeJSON(w, http.StatusOK, album)
+}
+
+// updateAlbum changes the fields of an app-created album listed in the update mask
+func (s *Server) updateAlbum(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Title                 string `json:"title"`
+		CoverPhotoMediaItemID string `json:"coverPhotoMediaItemId"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload received.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.albumIndex(req.PathValue("id"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if !s.albums[i].IsWriteable {
+		writeError(w, http.StatusForbidden, "No permission to update the album.")
+		return
+	}
+	for _, field := range strings.Split(req.URL.Query().Get("updateMask"), ",") {
+		switch field {
+		case "title":
+			s.albums[i].Title = body.Title
+		case "coverPhotoMediaItemId":
+			if !slices.Contains(s.albumItems[s.albums[i].ID], body.CoverPhotoMediaItemID) {
+				writeError(w, http.StatusBadRequest, "The cover photo must be in the album.")
+				return
+			}
+			s.albums[i].CoverPhotoMediaItemID = body.CoverPhotoMediaItemID
+		default:
+			writeError(w, http.StatusBadRequest, "Invalid update mask.")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.albumWithCount(i))
+}
+
+// albumMethod serves the custom methods of albums, such as albums/{id}:batchAddMediaItems
+func (s *Server) albumMethod(w http.ResponseWriter, req *http.Request) {
+	id, method, _ := strings.Cut(req.PathValue("method"), ":")
+	switch method {
+	case "batchAddMediaItems", "batchRemoveMediaItems":
+		s.batchAlbumItems(w, req, id, method)
+	case "addEnrichment":
+		s.addEnrichment(w, req, id)
+	default:
+		writeError(w, http.StatusNotFound, "Unknown method.")
+	}
+}
+
+// batchAlbumItems adds media items to or removes them from an app-created album
+func (s *Server) batchAlbumItems(w http.ResponseWriter, req *http.Request, id, method string) {
+	var body struct {
+		MediaItemIDs []string `json:"mediaItemIds"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || len(body.MediaItemIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "Request must contain media item IDs.")
+		return
+	}
+	if len(body.MediaItemIDs) > domain.MaxBatchMediaItems {
+		writeError(w, http.StatusBadRequest, "Request contains more than 50 media items.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.albumIndex(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if !s.albums[i].IsWriteable {
+		writeError(w, http.StatusForbidden, "No permission to add media items to this album.")
+		return
+	}
+	for _, itemID := range body.MediaItemIDs {
+		if s.itemIndex(itemID) < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid media item ID.")
+			return
+		}
+	}
+
+	ids := s.albumItems[id]
+	for _, itemID := range body.MediaItemIDs {
+		if method == "batchAddMediaItems" {
+			if !slices.Contains(ids, itemID) {
+				ids = append(ids, itemID)
+			}
+		} else {
+			ids = slices.DeleteFunc(ids, func(other string) bool { return other == itemID })
+		}
+	}
+	s.albumItems[id] = ids
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// addEnrichment adds a text entry to an app-created album. Only text enrichments are kept, and
+// only at the start or the end of the album.
+func (s *Server) addEnrichment(w http.ResponseWriter, req *http.Request, id string) {
+	var body struct {
+		NewEnrichmentItem struct {
+			TextEnrichment *struct {
+				Text string `json:"text"`
+			} `json:"textEnrichment"`
+		} `json:"newEnrichmentItem"`
+		AlbumPosition struct {
+			Position domain.PositionType `json:"position"`
+		} `json:"albumPosition"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.NewEnrichmentItem.TextEnrichment == nil {
+		writeError(w, http.StatusBadRequest, "Request must contain a text enrichment.")
+		return
+	}
+	position := body.AlbumPosition.Position
+	if position != domain.PositionFirstInAlbum && position != domain.PositionLastInAlbum {
+		writeError(w, http.StatusBadRequest, "Invalid album position.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.albumIndex(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if !s.albums[i].IsWriteable {
+		writeError(w, http.StatusForbidden, "No permission to add enrichments to this album.")
+		return
+	}
+
+	text := body.NewEnrichmentItem.TextEnrichment.Text
+	if position == domain.PositionFirstInAlbum {
+		s.enrichments[id] = append([]string{text}, s.enrichments[id]...)
+	} else {
+		s.enrichments[id] = append(s.enrichments[id], text)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"enrichmentItem": map[string]string{"id": s.newID("enrichment")}})
+}
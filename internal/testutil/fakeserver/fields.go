@@ -0,0 +1,150 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// selection is a parsed partial response selector: the fields selected at one level, each with
+// the selection inside it, or nil for the whole field. The * field selects every field.
+type selection map[string]selection
+
+// writeFields writes v like writeJSON, keeping only the fields the fields query parameter of req
+// selects, as the API does for partial responses
+func writeFields(w http.ResponseWriter, req *http.Request, v any) {
+	fields := req.URL.Query().Get("fields")
+	if fields == "" {
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	sel, err := parseFields(fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid field selection "+fields)
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var body any
+	json.Unmarshal(data, &body)
+	writeJSON(w, http.StatusOK, sel.apply(body))
+}
+
+// apply returns v with only the selected fields; lists have the selection applied to each element
+func (sel selection) apply(v any) any {
+	if sel == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = sel.apply(e)
+		}
+		return out
+	case map[string]any:
+		out := map[string]any{}
+		for k, e := range v {
+			sub, ok := sel[k]
+			if !ok {
+				sub, ok = sel["*"]
+			}
+			if ok {
+				out[k] = sub.apply(e)
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// parseFields parses a selector such as albums(id,title),nextPageToken, where a/b selects b
+// inside a and a(b,c) selects b and c inside a
+func parseFields(fields string) (selection, error) {
+	sel, rest, err := parseSelection(fields)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errors.New("unexpected " + rest)
+	}
+	return sel, nil
+}
+
+// parseSelection parses comma-separated fields up to the end of s or an unmatched closing
+// parenthesis, returning what follows
+func parseSelection(s string) (selection, string, error) {
+	sel := selection{}
+	for {
+		// a/b/c is the path to the field the selection applies to
+		var path []string
+		for {
+			n := 0
+			for n < len(s) && !isSeparator(s[n]) {
+				n++
+			}
+			if n == 0 {
+				return nil, "", errors.New("missing field name")
+			}
+			path = append(path, s[:n])
+			s = s[n:]
+			if s == "" || s[0] != '/' {
+				break
+			}
+			s = s[1:]
+		}
+
+		var sub selection
+		if s != "" && s[0] == '(' {
+			var err error
+			if sub, s, err = parseSelection(s[1:]); err != nil {
+				return nil, "", err
+			}
+			if s == "" || s[0] != ')' {
+				return nil, "", errors.New("missing )")
+			}
+			s = s[1:]
+		}
+		sel.add(path, sub)
+
+		if s == "" || s[0] != ',' {
+			return sel, s, nil
+		}
+		s = s[1:]
+	}
+}
+
+// add selects sub at the end of path, merging it with what is already selected there
+func (sel selection) add(path []string, sub selection) {
+	name := path[0]
+	existing, ok := sel[name]
+	if ok && existing == nil {
+		// The whole field is already selected
+		return
+	}
+	if len(path) > 1 {
+		if existing == nil {
+			existing = selection{}
+			sel[name] = existing
+		}
+		existing.add(path[1:], sub)
+		return
+	}
+	if sub == nil || !ok {
+		sel[name] = sub
+		return
+	}
+	for k, v := range sub {
+		existing.add([]string{k}, v)
+	}
+}
+
+// isSeparator reports whether c ends a field name
+func isSeparator(c byte) bool {
+	return c == ',' || c == '/' || c == '(' || c == ')'
+}
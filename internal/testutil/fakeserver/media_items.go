@@ -0,0 +1,269 @@
+package fakeserver
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// listMediaItems serves a page of the library, in the order the media items were added
+func (s *Server) listMediaItems(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, token := queryPage(req)
+	s.writeItemsPage(w, req, s.items, size, token)
+}
+
+// writeItemsPage writes the page of items a list or search asked for; s.mu must be held
+func (s *Server) writeItemsPage(w http.ResponseWriter, req *http.Request, items []domain.MediaItem, size int, token string) {
+	start, end, next, err := page(len(items), size, token, defaultMediaItemPageSize, domain.MaxMediaItemPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The API leaves mediaItems out of empty pages
+	body := map[string]any{"nextPageToken": next}
+	if start < end {
+		body["mediaItems"] = items[start:end]
+	}
+	writeFields(w, req, body)
+}
+
+// getMediaItem serves one media item
+func (s *Server) getMediaItem(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.itemIndex(req.PathValue("id"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	writeFields(w, req, s.items[i])
+}
+
+// updateMediaItem changes the description of a media item
+func (s *Server) updateMediaItem(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || req.URL.Query().Get("updateMask") != "description" {
+		writeError(w, http.StatusBadRequest, "Only the description can be updated.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.itemIndex(req.PathValue("id"))
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	s.items[i].Description = body.Description
+	writeJSON(w, http.StatusOK, s.items[i])
+}
+
+// batchGetMediaItems serves up to 50 media items with a status for each that is missing
+func (s *Server) batchGetMediaItems(w http.ResponseWriter, req *http.Request) {
+	ids := req.URL.Query()["mediaItemIds"]
+	if len(ids) == 0 || len(ids) > domain.MaxBatchMediaItems {
+		writeError(w, http.StatusBadRequest, "Request must contain between 1 and 50 media item IDs.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]map[string]any, len(ids))
+	for n, id := range ids {
+		if i := s.itemIndex(id); i >= 0 {
+			results[n] = map[string]any{"mediaItem": s.items[i]}
+		} else {
+			results[n] = map[string]any{"status": domain.Status{Code: codeNotFound, Message: "Requested entity was not found."}}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"mediaItemResults": results})
+}
+
+// searchRequest is the body of a media item search. Of the filters, only dates and media types
+// are applied, since the server knows nothing of content categories, favorites or archiving.
+type searchRequest struct {
+	AlbumID   string `json:"albumId"`
+	PageSize  int    `json:"pageSize"`
+	PageToken string `json:"pageToken"`
+	Filters   *struct {
+		DateFilter *struct {
+			Ranges []dateRange `json:"ranges"`
+		} `json:"dateFilter"`
+		MediaTypeFilter *struct {
+			MediaTypes []domain.MediaType `json:"mediaTypes"`
+		} `json:"mediaTypeFilter"`
+	} `json:"filters"`
+}
+
+// dateRange is a range of days of a date filter, both inclusive
+type dateRange struct {
+	StartDate apiDate `json:"startDate"`
+	EndDate   apiDate `json:"endDate"`
+}
+
+// contains reports whether t falls on one of the days of the range
+func (r dateRange) contains(t time.Time) bool {
+	return !t.Before(r.StartDate.time()) && t.Before(r.EndDate.time().AddDate(0, 0, 1))
+}
+
+// apiDate is a calendar day of a date filter
+type apiDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+// time returns the start of the day
+func (d apiDate) time() time.Time {
+	return time.Date(d.Year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// searchMediaItems serves a page of the media items in an album, in album order, or of those
+// matching the filters, newest first when filtered by date
+func (s *Server) searchMediaItems(w http.ResponseWriter, req *http.Request) {
+	var body searchRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON payload received.")
+		return
+	}
+	if body.AlbumID != "" && body.Filters != nil {
+		writeError(w, http.StatusBadRequest, "An album ID and filters cannot be set together.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []domain.MediaItem
+	switch {
+	case body.AlbumID != "":
+		if s.albumIndex(body.AlbumID) < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid album ID.")
+			return
+		}
+		for _, id := range s.albumItems[body.AlbumID] {
+			items = append(items, s.items[s.itemIndex(id)])
+		}
+	default:
+		items = slices.DeleteFunc(slices.Clone(s.items), func(item domain.MediaItem) bool { return !body.matches(item) })
+		if body.Filters != nil && body.Filters.DateFilter != nil {
+			slices.SortStableFunc(items, func(a, b domain.MediaItem) int { return creationTime(b).Compare(creationTime(a)) })
+		}
+	}
+	s.writeItemsPage(w, req, items, body.PageSize, body.PageToken)
+}
+
+// matches reports whether item passes the filters of the search
+func (r searchRequest) matches(item domain.MediaItem) bool {
+	if r.Filters == nil {
+		return true
+	}
+	if f := r.Filters.MediaTypeFilter; f != nil && len(f.MediaTypes) > 0 {
+		switch f.MediaTypes[0] {
+		case domain.MediaTypePhoto:
+			if item.IsVideo() {
+				return false
+			}
+		case domain.MediaTypeVideo:
+			if !item.IsVideo() {
+				return false
+			}
+		}
+	}
+	if f := r.Filters.DateFilter; f != nil && len(f.Ranges) > 0 {
+		return slices.ContainsFunc(f.Ranges, func(dr dateRange) bool { return dr.contains(creationTime(item)) })
+	}
+	return true
+}
+
+// creationTime returns when item was taken, or the zero time
+func creationTime(item domain.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime
+}
+
+// batchCreateMediaItems turns uploads into media items, adding them to an app-created album when
+// one is given. Unknown upload tokens fail their item alone, answered with 207 Multi-Status.
+func (s *Server) batchCreateMediaItems(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		AlbumID       string `json:"albumId"`
+		NewMediaItems []struct {
+			Description     string `json:"description"`
+			SimpleMediaItem struct {
+				UploadToken string `json:"uploadToken"`
+				FileName    string `json:"fileName"`
+			} `json:"simpleMediaItem"`
+		} `json:"newMediaItems"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || len(body.NewMediaItems) == 0 {
+		writeError(w, http.StatusBadRequest, "Request must contain new media items.")
+		return
+	}
+	if len(body.NewMediaItems) > domain.MaxBatchMediaItems {
+		writeError(w, http.StatusBadRequest, "Request contains more than 50 media items.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if body.AlbumID != "" {
+		i := s.albumIndex(body.AlbumID)
+		if i < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid album ID.")
+			return
+		}
+		if !s.albums[i].IsWriteable {
+			writeError(w, http.StatusForbidden, "No permission to add media items to this album.")
+			return
+		}
+	}
+
+	status := http.StatusOK
+	results := make([]domain.NewMediaItemResult, len(body.NewMediaItems))
+	for n, newItem := range body.NewMediaItems {
+		token := newItem.SimpleMediaItem.UploadToken
+		results[n].UploadToken = token
+		up, ok := s.uploads[token]
+		if !ok {
+			results[n].Status = domain.Status{Code: codeInvalidArgument, Message: "Failed: There was an error while trying to create this media item."}
+			status = http.StatusMultiStatus
+			continue
+		}
+		delete(s.uploads, token)
+
+		metadata := &domain.MediaMetadata{CreationTime: time.Now().UTC().Truncate(time.Second)}
+		if strings.HasPrefix(up.mimeType, "video/") {
+			metadata.Video = &domain.VideoMetadata{Status: domain.VideoProcessingReady}
+		} else {
+			metadata.Photo = &domain.PhotoMetadata{}
+		}
+		item := s.addMediaItem(domain.MediaItem{
+			Description:   newItem.Description,
+			MimeType:      up.mimeType,
+			Filename:      cmp.Or(newItem.SimpleMediaItem.FileName, up.fileName),
+			MediaMetadata: metadata,
+		}, up.data)
+		if body.AlbumID != "" {
+			s.albumItems[body.AlbumID] = append(s.albumItems[body.AlbumID], item.ID)
+		}
+		results[n].Status = domain.Status{Message: "Success"}
+		results[n].MediaItem = &item
+	}
+	writeJSON(w, status, map[string]any{"newMediaItemResults": results})
+}
@@ -0,0 +1,357 @@
+// Package fakeserver imitates the Google Photos Library API in memory, so the repositories can be
+// tested end to end over HTTP without a Google account. It serves the albums, mediaItems and
+// uploads endpoints with the pagination, per-item statuses and error bodies of the real API, the
+// base URLs of media items for downloads, and faults injected by the test.
+package fakeserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// apiHost is the host the repositories send their requests to
+const apiHost = "photoslibrary.googleapis.com"
+
+// Page sizes the API uses when a request asks for none
+const (
+	defaultAlbumPageSize     = 20
+	defaultMediaItemPageSize = 25
+)
+
+// Codes of the per-item statuses, as in google.rpc.Code
+const (
+	codeInvalidArgument = 3
+	codeNotFound        = 5
+)
+
+// Fault makes matching requests fail instead of being served
+type Fault struct {
+	// Method matches the HTTP method of requests; empty matches any
+	Method string
+	// Path matches the path of requests, such as /v1/mediaItems:search; a trailing * matches any
+	// path starting with the rest
+	Path string
+	// Status is the HTTP status of the error; the body is a Google error with the matching status
+	// name
+	Status int
+	// Skip is how many matching requests are served before the fault applies, such as the start of
+	// a resumable upload before its chunks
+	Skip int
+	// Times is how many matching requests fail; 0 fails all of them
+	Times int
+	// Header is added to the response, such as Retry-After
+	Header http.Header
+}
+
+// matches reports whether req is one of the requests f fails
+func (f *Fault) matches(req *http.Request) bool {
+	if f.Method != "" && f.Method != req.Method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(f.Path, "*"); ok {
+		return strings.HasPrefix(req.URL.Path, prefix)
+	}
+	return f.Path == req.URL.Path
+}
+
+// Server is an in-memory Google Photos Library API. It is safe for concurrent use.
+type Server struct {
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	albums     []domain.Album
+	albumItems map[string][]string
+	// enrichments holds the texts added to albums, in album order
+	enrichments map[string][]string
+	items       []domain.MediaItem
+	contents    map[string][]byte
+	uploads     map[string]upload
+	sessions    map[string]*session
+	faults      []*Fault
+	requests    []string
+	nextID      int
+}
+
+// upload is a file received by the uploads endpoint and not yet turned into a media item
+type upload struct {
+	fileName string
+	mimeType string
+	data     []byte
+}
+
+// session is a resumable upload in progress
+type session struct {
+	upload
+	size  int64
+	token string
+}
+
+// New starts a Server, closed when the test ends
+func New(t testing.TB) *Server {
+	s := &Server{
+		albumItems:  make(map[string][]string),
+		enrichments: make(map[string][]string),
+		contents:    make(map[string][]byte),
+		uploads:     make(map[string]upload),
+		sessions:    make(map[string]*session),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/albums", s.listAlbums)
+	mux.HandleFunc("POST /v1/albums", s.createAlbum)
+	mux.HandleFunc("GET /v1/albums/{id}", s.getAlbum)
+	mux.HandleFunc("PATCH /v1/albums/{id}", s.updateAlbum)
+	mux.HandleFunc("POST /v1/albums/{method}", s.albumMethod)
+	mux.HandleFunc("GET /v1/mediaItems", s.listMediaItems)
+	mux.HandleFunc("GET /v1/mediaItems/{id}", s.getMediaItem)
+	mux.HandleFunc("PATCH /v1/mediaItems/{id}", s.updateMediaItem)
+	mux.HandleFunc("GET /v1/mediaItems:batchGet", s.batchGetMediaItems)
+	mux.HandleFunc("POST /v1/mediaItems:search", s.searchMediaItems)
+	mux.HandleFunc("POST /v1/mediaItems:batchCreate", s.batchCreateMediaItems)
+	mux.HandleFunc("POST /v1/uploads", s.upload)
+	mux.HandleFunc("GET /media/{ref}", s.download)
+
+	s.srv = httptest.NewServer(s.serve(mux))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// Client returns an HTTP client that sends the requests for the Google Photos API to the server
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.srv.URL)
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == apiHost {
+			req = req.Clone(req.Context())
+			req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		}
+		return s.srv.Client().Transport.RoundTrip(req)
+	})}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Inject makes the requests matching f fail, ahead of the faults injected before
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append([]*Fault{&f}, s.faults...)
+}
+
+// Requests returns the requests served so far, as method and path such as "GET /v1/albums"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// AddAlbum adds an album holding the media items itemIDs, giving it an ID unless it has one
+func (s *Server) AddAlbum(album domain.Album, itemIDs ...string) domain.Album {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if album.ID == "" {
+		album.ID = s.newID("album")
+	}
+	album.ProductURL = "https://photos.google.com/lr/album/" + album.ID
+	s.albums = append(s.albums, album)
+	s.albumItems[album.ID] = append([]string(nil), itemIDs...)
+	return s.albumWithCount(len(s.albums) - 1)
+}
+
+// AddMediaItem adds a media item with content as its bytes, giving it an ID unless it has one.
+// Its base URL serves content from the server.
+func (s *Server) AddMediaItem(item domain.MediaItem, content []byte) domain.MediaItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addMediaItem(item, content)
+}
+
+// addMediaItem adds a media item; s.mu must be held
+func (s *Server) addMediaItem(item domain.MediaItem, content []byte) domain.MediaItem {
+	if item.ID == "" {
+		item.ID = s.newID("item")
+	}
+	item.BaseURL = s.srv.URL + "/media/" + item.ID
+	item.ProductURL = "https://photos.google.com/lr/photo/" + item.ID
+	s.items = append(s.items, item)
+	s.contents[item.ID] = content
+	return item
+}
+
+// Album returns the album with the given ID as the API would
+func (s *Server) Album(id string) (domain.Album, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.albumIndex(id)
+	if i < 0 {
+		return domain.Album{}, false
+	}
+	return s.albumWithCount(i), true
+}
+
+// AlbumItems returns the IDs of the media items in an album
+func (s *Server) AlbumItems(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.albumItems[id]...)
+}
+
+// Enrichments returns the texts added to an album, in album order
+func (s *Server) Enrichments(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.enrichments[id]...)
+}
+
+// MediaItem returns the media item with the given ID
+func (s *Server) MediaItem(id string) (domain.MediaItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.itemIndex(id)
+	if i < 0 {
+		return domain.MediaItem{}, false
+	}
+	return s.items[i], true
+}
+
+// serve records every request and fails those matching a fault before passing them to next
+func (s *Server) serve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+		var fault *Fault
+		for i, f := range s.faults {
+			if !f.matches(req) {
+				continue
+			}
+			if f.Skip > 0 {
+				f.Skip--
+				continue
+			}
+			fault = f
+			if f.Times > 0 {
+				if f.Times--; f.Times == 0 {
+					s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				}
+			}
+			break
+		}
+		s.mu.Unlock()
+
+		if fault != nil {
+			for key, values := range fault.Header {
+				w.Header()[key] = values
+			}
+			writeError(w, fault.Status, "injected fault")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// newID returns a new ID starting with prefix; s.mu must be held
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+// albumIndex returns the position of an album in s.albums, or -1; s.mu must be held
+func (s *Server) albumIndex(id string) int {
+	for i, album := range s.albums {
+		if album.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemIndex returns the position of a media item in s.items, or -1; s.mu must be held
+func (s *Server) itemIndex(id string) int {
+	for i, item := range s.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// albumWithCount returns the album at position i with its media item count; s.mu must be held
+func (s *Server) albumWithCount(i int) domain.Album {
+	album := s.albums[i]
+	album.MediaItemsCount = int64(len(s.albumItems[album.ID]))
+	return album
+}
+
+// page returns the part of n results that req asks for as start and end positions and the token
+// of the next page. Tokens are the position of the next page.
+func page(n int, pageSize int, pageToken string, defaultSize, maxSize int) (start, end int, next string, err error) {
+	if pageSize <= 0 {
+		pageSize = defaultSize
+	}
+	pageSize = min(pageSize, maxSize)
+	if pageToken != "" {
+		if start, err = strconv.Atoi(pageToken); err != nil || start < 0 || start > n {
+			return 0, 0, "", fmt.Errorf("invalid page token %q", pageToken)
+		}
+	}
+	end = min(start+pageSize, n)
+	if end < n {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next, nil
+}
+
+// queryPage reads the page size and token of a list request
+func queryPage(req *http.Request) (int, string) {
+	size, _ := strconv.Atoi(req.URL.Query().Get("pageSize"))
+	return size, req.URL.Query().Get("pageToken")
+}
+
+// writeJSON writes v as the JSON body of a response with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of Google APIs
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"error": map[string]any{
+		"code":    status,
+		"message": message,
+		"status":  statusName(status),
+	}})
+}
+
+// statusName returns the name Google APIs give an HTTP status in error bodies
+func statusName(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,133 @@
+package fakeserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// upload receives the bytes of a file with the raw protocol, or starts, continues or queries an
+// upload with the resumable protocol. Finished uploads answer with the upload token.
+func (s *Server) upload(w http.ResponseWriter, req *http.Request) {
+	if id := req.URL.Query().Get("upload_id"); id != "" {
+		s.resumeUpload(w, req, id)
+		return
+	}
+
+	up := upload{fileName: req.Header.Get("X-Goog-Upload-File-Name"), mimeType: req.Header.Get("X-Goog-Upload-Content-Type")}
+	switch protocol := req.Header.Get("X-Goog-Upload-Protocol"); {
+	case protocol == "raw":
+		data, err := io.ReadAll(req.Body)
+		if err != nil || len(data) == 0 {
+			writeError(w, http.StatusBadRequest, "Upload must contain the bytes of the file.")
+			return
+		}
+		up.data = data
+
+		s.mu.Lock()
+		token := s.newID("upload")
+		s.uploads[token] = up
+		s.mu.Unlock()
+		fmt.Fprint(w, token)
+	case protocol == "resumable" && req.Header.Get("X-Goog-Upload-Command") == "start":
+		size, err := strconv.ParseInt(req.Header.Get("X-Goog-Upload-Raw-Size"), 10, 64)
+		if err != nil || size < 0 {
+			writeError(w, http.StatusBadRequest, "Resumable uploads must give their size.")
+			return
+		}
+
+		s.mu.Lock()
+		id := s.newID("session")
+		s.sessions[id] = &session{upload: up, size: size}
+		s.mu.Unlock()
+		w.Header().Set("X-Goog-Upload-URL", s.srv.URL+"/v1/uploads?upload_id="+id)
+		w.Header().Set("X-Goog-Upload-Status", "active")
+	default:
+		writeError(w, http.StatusBadRequest, "Unknown upload protocol.")
+	}
+}
+
+// resumeUpload serves the commands sent to the URL of a resumable upload: query, upload and
+// upload, finalize. Chunks must start where the previous one ended.
+func (s *Server) resumeUpload(w http.ResponseWriter, req *http.Request, id string) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read the chunk.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown upload session.")
+		return
+	}
+	status := func() {
+		w.Header().Set("X-Goog-Upload-Size-Received", strconv.Itoa(len(sess.data)))
+		if sess.token != "" {
+			w.Header().Set("X-Goog-Upload-Status", "final")
+		} else {
+			w.Header().Set("X-Goog-Upload-Status", "active")
+		}
+	}
+
+	command := req.Header.Get("X-Goog-Upload-Command")
+	if command == "query" {
+		status()
+		return
+	}
+	if sess.token != "" {
+		writeError(w, http.StatusBadRequest, "The upload was already finalized.")
+		return
+	}
+	if command != "upload" && command != "upload, finalize" {
+		writeError(w, http.StatusBadRequest, "Unknown upload command.")
+		return
+	}
+	if offset, err := strconv.Atoi(req.Header.Get("X-Goog-Upload-Offset")); err != nil || offset != len(sess.data) {
+		status()
+		writeError(w, http.StatusBadRequest, "The offset does not match the bytes received.")
+		return
+	}
+	sess.data = append(sess.data, data...)
+
+	if strings.HasSuffix(command, "finalize") {
+		if int64(len(sess.data)) != sess.size {
+			writeError(w, http.StatusBadRequest, "The upload does not have the size it was started with.")
+			return
+		}
+		sess.token = s.newID("upload")
+		s.uploads[sess.token] = sess.upload
+		status()
+		fmt.Fprint(w, sess.token)
+		return
+	}
+	status()
+}
+
+// download serves the bytes of a media item from its base URL with any of the suffixes, such as
+// =d, =dv or =w100-h100
+func (s *Server) download(w http.ResponseWriter, req *http.Request) {
+	id, _, _ := strings.Cut(req.PathValue("ref"), "=")
+
+	s.mu.Lock()
+	content, ok := s.contents[id]
+	var mimeType string
+	if i := s.itemIndex(id); i >= 0 {
+		mimeType = s.items[i].MimeType
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Write(content)
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// AccountUseCase implements the business logic for inspecting the account behind a profile's token
+type AccountUseCase struct {
+	logging
+
+	oauthService domain.OAuthService
+	repo         domain.AccountRepository
+	profile      string
+}
+
+// NewAccountUseCase creates a new instance of AccountUseCase for the named profile
+func NewAccountUseCase(oauthService domain.OAuthService, repo domain.AccountRepository, profile string) *AccountUseCase {
+	return &AccountUseCase{
+		oauthService: oauthService,
+		repo:         repo,
+		profile:      profile,
+	}
+}
+
+// GetAccountInfo reports which Google account the stored token belongs to, the scopes it
+// carries and when it expires. The identity is only available for tokens issued with the
+// userinfo scopes; older tokens still report their scopes and expiry.
+func (uc *AccountUseCase) GetAccountInfo(ctx context.Context) (*domain.AccountInfo, error) {
+	uc.log().Info("Fetching account info", "profile", uc.profile)
+
+	token, err := uc.oauthService.LoadToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w, run 'auth login' first: %v", domain.ErrNotLoggedIn, err)
+	}
+
+	config, err := uc.oauthService.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh an expired access token so tokeninfo describes a live token, and keep the result
+	fresh, err := config.TokenSource(ctx, token).Token()
+	if err != nil {
+		uc.log().Error("Failed to refresh token", "error", err)
+		return nil, fmt.Errorf("failed to refresh token, run 'auth login' again: %w", err)
+	}
+	if fresh.AccessToken != token.AccessToken {
+		if err := uc.oauthService.SaveToken(fresh); err != nil {
+			uc.log().Error("Failed to save refreshed token", "error", err)
+		}
+	}
+
+	tokenInfo, err := uc.repo.GetTokenInfo(fresh.AccessToken)
+	if err != nil {
+		uc.log().Error("Failed to fetch token info", "error", err)
+		return nil, err
+	}
+
+	info := &domain.AccountInfo{
+		Profile:       uc.profile,
+		UserID:        tokenInfo.UserID,
+		Email:         tokenInfo.Email,
+		EmailVerified: tokenInfo.EmailVerified,
+		Scopes:        tokenInfo.Scopes,
+		Expiry:        tokenInfo.Expiry,
+		Refreshable:   fresh.RefreshToken != "",
+	}
+
+	if !slices.Contains(info.Scopes, domain.ScopeUserInfoEmail) && !slices.Contains(info.Scopes, domain.ScopeUserInfoProfile) {
+		uc.log().Info("Token was issued without the userinfo scopes; run 'auth login' again to see which account it belongs to")
+		return info, nil
+	}
+
+	userInfo, err := uc.repo.GetUserInfo(fresh.AccessToken)
+	if err != nil {
+		uc.log().Error("Failed to fetch user info", "error", err)
+		return nil, err
+	}
+
+	info.UserID = userInfo.UserID
+	info.Name = userInfo.Name
+	if userInfo.Email != "" {
+		info.Email = userInfo.Email
+		info.EmailVerified = userInfo.EmailVerified
+	}
+
+	uc.log().Info("Successfully fetched account info", "email", info.Email)
+	return info, nil
+}
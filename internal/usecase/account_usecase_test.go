@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"krupesh.faldu/internal/domain"
+)
+
+// MockAccountRepository is a mock implementation for testing
+type MockAccountRepository struct {
+	tokenInfo     domain.TokenInfo
+	userInfoCalls int
+}
+
+func (m *MockAccountRepository) GetTokenInfo(accessToken string) (*domain.TokenInfo, error) {
+	info := m.tokenInfo
+	return &info, nil
+}
+
+func (m *MockAccountRepository) GetUserInfo(accessToken string) (*domain.UserInfo, error) {
+	m.userInfoCalls++
+	return &domain.UserInfo{UserID: "42", Email: "me@example.com", EmailVerified: true, Name: "Me"}, nil
+}
+
+func TestAccountUseCase_GetAccountInfo(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	oauthService := &MockOAuthService{
+		config: &oauth2.Config{},
+		token:  &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: expiry},
+	}
+	repo := &MockAccountRepository{tokenInfo: domain.TokenInfo{
+		Scopes: []string{"https://www.googleapis.com/auth/photoslibrary.appendonly", domain.ScopeUserInfoEmail},
+		Expiry: expiry,
+	}}
+	useCase := NewAccountUseCase(oauthService, repo, "work")
+
+	info, err := useCase.GetAccountInfo(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info.Profile != "work" || info.Email != "me@example.com" || info.Name != "Me" || info.UserID != "42" {
+		t.Errorf("Expected identity of profile work, got %+v", info)
+	}
+	if len(info.Scopes) != 2 || !info.Expiry.Equal(expiry) || !info.Refreshable {
+		t.Errorf("Expected scopes, expiry and refresh token to be reported, got %+v", info)
+	}
+}
+
+func TestAccountUseCase_GetAccountInfoWithoutUserInfoScopes(t *testing.T) {
+	oauthService := &MockOAuthService{
+		config: &oauth2.Config{},
+		token:  &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)},
+	}
+	repo := &MockAccountRepository{tokenInfo: domain.TokenInfo{
+		Scopes: []string{"https://www.googleapis.com/auth/photoslibrary.appendonly"},
+	}}
+	useCase := NewAccountUseCase(oauthService, repo, "default")
+
+	info, err := useCase.GetAccountInfo(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if repo.userInfoCalls != 0 {
+		t.Errorf("Expected userinfo not to be called without its scopes, got %d calls", repo.userInfoCalls)
+	}
+	if info.Email != "" || info.Refreshable {
+		t.Errorf("Expected no identity and no refresh token, got %+v", info)
+	}
+}
@@ -1,13 +1,21 @@
 package usecase
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"strings"
 
 	"krupesh.faldu/internal/domain"
 )
 
 // AlbumUseCase implements the business logic for album operations
 type AlbumUseCase struct {
+	logging
+	tracing
+
 	repo domain.AlbumRepository
 }
 
@@ -18,64 +26,283 @@ func NewAlbumUseCase(repo domain.AlbumRepository) *AlbumUseCase {
 	}
 }
 
-// ListAlbums retrieves all albums with business logic
-func (uc *AlbumUseCase) ListAlbums() (*domain.AlbumsResponse, error) {
-	log.Printf("Fetching albums...")
+// ListAlbums retrieves a single page of albums
+func (uc *AlbumUseCase) ListAlbums(ctx context.Context, req domain.PageRequest) (page *domain.Page[domain.Album], err error) {
+	_, span := uc.trace(ctx, "album.list", "page_size", req.PageSize)
+	defer func() { span.End(err) }()
+
+	if err := req.Validate(domain.MaxAlbumPageSize); err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Fetching albums...")
 
-	response, err := uc.repo.ListAlbums()
+	page, err = uc.repo.ListAlbums(req)
 	if err != nil {
-		log.Printf("Failed to fetch albums: %v", err)
+		uc.log().Error("Failed to fetch albums", "error", err)
 		return nil, err
 	}
 
-	log.Printf("Successfully fetched %d albums", len(response.Albums))
+	uc.log().Info("Successfully fetched albums", "albums", len(page.Items))
 
 	// Business logic: if there are more pages, log it
-	if response.NextPageToken != "" {
-		log.Printf("More albums available on next page")
+	if page.HasNext() {
+		uc.log().Info("More albums available on next page")
 	}
 
-	return response, nil
+	return page, nil
 }
 
 // GetAlbumByID retrieves a specific album by ID
-func (uc *AlbumUseCase) GetAlbumByID(id string) (*domain.Album, error) {
-	log.Printf("Fetching album with ID: %s", id)
+func (uc *AlbumUseCase) GetAlbumByID(ctx context.Context, id string) (album *domain.Album, err error) {
+	_, span := uc.trace(ctx, "album.get", "album_id", id)
+	defer func() { span.End(err) }()
 
-	album, err := uc.repo.GetAlbumByID(id)
+	uc.log().Info("Fetching album", "album_id", id)
+
+	album, err = uc.repo.GetAlbumByID(id)
 	if err != nil {
-		log.Printf("Failed to fetch album %s: %v", id, err)
+		uc.log().Error("Failed to fetch album", "album_id", id, "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully fetched album", "title", album.Title)
+	return album, nil
+}
+
+// GetAlbumFields retrieves only the given fields of an album, such as "id,mediaItemsCount";
+// empty fields retrieve the whole album like GetAlbumByID
+func (uc *AlbumUseCase) GetAlbumFields(ctx context.Context, id, fields string) (album *domain.Album, err error) {
+	if fields == "" {
+		return uc.GetAlbumByID(ctx, id)
+	}
+	_, span := uc.trace(ctx, "album.get", "album_id", id, "fields", fields)
+	defer func() { span.End(err) }()
+
+	if err := domain.ValidateFields(fields); err != nil {
 		return nil, err
 	}
 
-	log.Printf("Successfully fetched album: %s", album.Title)
+	uc.log().Info("Fetching album fields", "album_id", id, "fields", fields)
+
+	album, err = uc.repo.GetAlbumFields(id, fields)
+	if err != nil {
+		uc.log().Error("Failed to fetch album", "album_id", id, "error", err)
+		return nil, err
+	}
 	return album, nil
 }
 
 // CreateAlbum creates a new album with business logic
-func (uc *AlbumUseCase) CreateAlbum(title string) (*domain.Album, error) {
-	log.Printf("Creating album with title: %s", title)
+func (uc *AlbumUseCase) CreateAlbum(ctx context.Context, title string) (album *domain.Album, err error) {
+	_, span := uc.trace(ctx, "album.create")
+	defer func() { span.End(err) }()
+
+	uc.log().Info("Creating album with title", "title", title)
+
+	album, err = uc.repo.CreateAlbum(title)
+	if err != nil {
+		uc.log().Error("Failed to create album", "title", title, "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully created album", "title", album.Title, "album_id", album.ID)
+	return album, nil
+}
+
+// CreateAlbumIfNotExists returns the first album titled exactly title, creating it only when there
+// is none, so automation can run again without making duplicate albums. With appCreatedOnly, albums
+// this app cannot change are ignored, so the album returned always accepts new media items. The
+// result reports whether the album was created.
+func (uc *AlbumUseCase) CreateAlbumIfNotExists(ctx context.Context, title string, appCreatedOnly bool) (album *domain.Album, created bool, err error) {
+	ctx, span := uc.trace(ctx, "album.get_or_create", "app_created_only", appCreatedOnly)
+	defer func() { span.End(err) }()
+
+	if title == "" {
+		return nil, false, fmt.Errorf("%w: album title is required", domain.ErrInvalidArgument)
+	}
+
+	uc.log().Info("Looking for album with title", "title", title)
+
+	for existing, err := range uc.Albums(ctx, domain.ListOptions{Prefetch: true}) {
+		if err != nil {
+			uc.log().Error("Failed to look for album", "title", title, "error", err)
+			return nil, false, err
+		}
+		if existing.Title == title && (existing.IsWriteable || !appCreatedOnly) {
+			uc.log().Info("Album already exists", "title", title, "album_id", existing.ID)
+			return &existing, false, nil
+		}
+	}
+
+	album, err = uc.CreateAlbum(ctx, title)
+	if err != nil {
+		return nil, false, err
+	}
+	return album, true, nil
+}
 
-	album, err := uc.repo.CreateAlbum(title)
+// UpdateAlbum changes the title and/or cover photo of an app-created album; empty values are left unchanged
+func (uc *AlbumUseCase) UpdateAlbum(ctx context.Context, id, title, coverPhotoMediaItemID string) (album *domain.Album, err error) {
+	_, span := uc.trace(ctx, "album.update", "album_id", id)
+	defer func() { span.End(err) }()
+
+	if id == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if title == "" && coverPhotoMediaItemID == "" {
+		return nil, fmt.Errorf("nothing to update: a title or cover photo is required")
+	}
+
+	uc.log().Info("Updating album", "album_id", id)
+
+	album, err = uc.repo.UpdateAlbum(id, title, coverPhotoMediaItemID)
 	if err != nil {
-		log.Printf("Failed to create album %s: %v", title, err)
+		uc.log().Error("Failed to update album", "album_id", id, "error", err)
 		return nil, err
 	}
 
-	log.Printf("Successfully created album: %s with ID: %s", album.Title, album.ID)
+	uc.log().Info("Successfully updated album", "title", album.Title, "album_id", album.ID)
 	return album, nil
 }
 
-// FetchNextPage retrieves the next page of albums
-func (uc *AlbumUseCase) FetchNextPage(nextPageToken string) (*domain.AlbumsResponse, error) {
-	log.Printf("Fetching next page of albums...")
+// AddMediaItems adds media items to an app-created album, splitting them into batches
+// the API accepts. Empty and duplicate IDs are skipped.
+func (uc *AlbumUseCase) AddMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return uc.batchMediaItems(ctx, "add", albumID, mediaItemIDs, uc.repo.BatchAddMediaItems)
+}
+
+// RemoveMediaItems removes media items from an app-created album, splitting them into batches
+// the API accepts. Empty and duplicate IDs are skipped.
+func (uc *AlbumUseCase) RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return uc.batchMediaItems(ctx, "remove", albumID, mediaItemIDs, uc.repo.BatchRemoveMediaItems)
+}
+
+// batchMediaItems sends media item IDs to the repository in chunks of domain.MaxBatchMediaItems.
+// On failure the error reports how many items were already processed.
+func (uc *AlbumUseCase) batchMediaItems(ctx context.Context, action, albumID string, mediaItemIDs []string, send func(string, []string) error) (err error) {
+	_, span := uc.trace(ctx, "album."+action+"_media_items", "album_id", albumID, "media_items", len(mediaItemIDs))
+	defer func() { span.End(err) }()
+
+	if albumID == "" {
+		return fmt.Errorf("album id is required")
+	}
+
+	ids := uniqueIDs(mediaItemIDs)
+	if len(ids) == 0 {
+		return fmt.Errorf("at least one media item id is required")
+	}
+
+	uc.log().Info("Requesting media item change in album", "action", action, "media_items", len(ids), "album_id", albumID)
+
+	done := 0
+	for batch := range slices.Chunk(ids, domain.MaxBatchMediaItems) {
+		if err := send(albumID, batch); err != nil {
+			uc.log().Error("Failed to change media items in album", "action", action, "album_id", albumID, "done", done, "media_items", len(ids), "error", err)
+			return fmt.Errorf("failed to %s media items after %d of %d: %w", action, done, len(ids), err)
+		}
+		done += len(batch)
+	}
+
+	uc.log().Info("Successfully processed media items in album", "done", done, "album_id", albumID)
+	return nil
+}
+
+// uniqueIDs drops empty and repeated IDs while keeping their order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// ListAllAlbums retrieves every album, transparently following page tokens
+func (uc *AlbumUseCase) ListAllAlbums(ctx context.Context, opts domain.ListOptions) ([]domain.Album, error) {
+	albums, err := collect(uc.Albums(ctx, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Successfully fetched albums in total", "albums", len(albums))
+	return albums, nil
+}
+
+// FindAlbums walks every album and returns the ones whose title matches pattern and that pass
+// filter, in the order the API lists them
+func (uc *AlbumUseCase) FindAlbums(ctx context.Context, pattern string, filter domain.AlbumFilter) (albums []domain.Album, err error) {
+	ctx, span := uc.trace(ctx, "album.find", "match", string(filter.Match))
+	defer func() { span.End(err) }()
 
-	response, err := uc.repo.FetchNextPage(nextPageToken)
+	matches, err := titleMatcher(pattern, filter)
 	if err != nil {
-		log.Printf("Failed to fetch next page: %v", err)
 		return nil, err
 	}
 
-	log.Printf("Successfully fetched %d albums from next page", len(response.Albums))
-	return response, nil
+	uc.log().Info("Finding albums", "pattern", pattern)
+
+	// Albums are only filtered here, so the next page is fetched meanwhile
+	for album, err := range uc.Albums(ctx, domain.ListOptions{Prefetch: true}) {
+		if err != nil {
+			uc.log().Error("Failed to find albums", "error", err)
+			return nil, err
+		}
+		if (filter.ExcludeShared && album.ShareInfo != nil) || (filter.AppCreatedOnly && !album.IsWriteable) {
+			continue
+		}
+		if matches(album.Title) {
+			albums = append(albums, album)
+		}
+	}
+
+	uc.log().Info("Successfully found albums", "albums", len(albums))
+	return albums, nil
+}
+
+// titleMatcher returns a function reporting whether a title matches pattern as filter says
+func titleMatcher(pattern string, filter domain.AlbumFilter) (func(title string) bool, error) {
+	switch filter.Match {
+	case domain.TitleExact:
+		if filter.IgnoreCase {
+			return func(title string) bool { return strings.EqualFold(title, pattern) }, nil
+		}
+		return func(title string) bool { return title == pattern }, nil
+	case domain.TitleSubstring:
+		if filter.IgnoreCase {
+			pattern = strings.ToLower(pattern)
+			return func(title string) bool { return strings.Contains(strings.ToLower(title), pattern) }, nil
+		}
+		return func(title string) bool { return strings.Contains(title, pattern) }, nil
+	case domain.TitleRegex, "":
+		if filter.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid title pattern: %v", domain.ErrInvalidArgument, err)
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown title match %q", domain.ErrInvalidArgument, filter.Match)
+	}
+}
+
+// Albums returns an iterator over all albums. Pages are fetched lazily as the caller ranges
+// over the sequence, so stopping early avoids further requests. A failure is yielded once
+// as a non-nil error, after which iteration ends. With opts.Prefetch the next page is fetched
+// while the caller handles the current one.
+func (uc *AlbumUseCase) Albums(ctx context.Context, opts domain.ListOptions) iter.Seq2[domain.Album, error] {
+	return listPages(ctx, opts, domain.MaxAlbumPageSize, func(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+		page, err := uc.repo.ListAlbums(req)
+		if err != nil {
+			uc.log().Error("Failed to fetch albums", "error", err)
+			return nil, err
+		}
+		return page, nil
+	})
 }
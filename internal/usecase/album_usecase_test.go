@@ -1,23 +1,34 @@
 package usecase
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"krupesh.faldu/internal/domain"
 )
 
 // MockAlbumRepository is a mock implementation for testing
 type MockAlbumRepository struct {
-	albums []domain.Album
-	err    error
+	albums  []domain.Album
+	err     error
+	batches [][]string
+	// failAfter makes batch calls fail once this many batches have succeeded (0 disables it)
+	failAfter int
+	// enrichments records the text entries added, as album ID and text
+	enrichments [][2]string
 }
 
-func (m *MockAlbumRepository) ListAlbums() (*domain.AlbumsResponse, error) {
+func (m *MockAlbumRepository) ListAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return &domain.AlbumsResponse{
-		Albums:        m.albums,
+	return &domain.Page[domain.Album]{
+		Items:         m.albums,
 		NextPageToken: "",
 	}, nil
 }
@@ -34,6 +45,10 @@ func (m *MockAlbumRepository) GetAlbumByID(id string) (*domain.Album, error) {
 	return nil, nil
 }
 
+func (m *MockAlbumRepository) GetAlbumFields(id, fields string) (*domain.Album, error) {
+	return m.GetAlbumByID(id)
+}
+
 func (m *MockAlbumRepository) CreateAlbum(title string) (*domain.Album, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -45,14 +60,38 @@ func (m *MockAlbumRepository) CreateAlbum(title string) (*domain.Album, error) {
 	return &album, nil
 }
 
-func (m *MockAlbumRepository) FetchNextPage(nextPageToken string) (*domain.AlbumsResponse, error) {
+func (m *MockAlbumRepository) UpdateAlbum(id, title, coverPhotoMediaItemID string) (*domain.Album, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return &domain.AlbumsResponse{
-		Albums:        m.albums,
-		NextPageToken: "",
-	}, nil
+	return &domain.Album{ID: id, Title: title, CoverPhotoMediaItemID: coverPhotoMediaItemID}, nil
+}
+
+func (m *MockAlbumRepository) BatchAddMediaItems(albumID string, mediaItemIDs []string) error {
+	return m.recordBatch(mediaItemIDs)
+}
+
+func (m *MockAlbumRepository) BatchRemoveMediaItems(albumID string, mediaItemIDs []string) error {
+	return m.recordBatch(mediaItemIDs)
+}
+
+func (m *MockAlbumRepository) AddTextEnrichment(albumID, text string, position domain.PositionType) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	m.enrichments = append(m.enrichments, [2]string{albumID, text})
+	return fmt.Sprintf("enrichment-%d", len(m.enrichments)), nil
+}
+
+func (m *MockAlbumRepository) recordBatch(mediaItemIDs []string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.failAfter > 0 && len(m.batches) == m.failAfter {
+		return errors.New("batch failed")
+	}
+	m.batches = append(m.batches, mediaItemIDs)
+	return nil
 }
 
 func TestAlbumUseCase_ListAlbums(t *testing.T) {
@@ -67,19 +106,19 @@ func TestAlbumUseCase_ListAlbums(t *testing.T) {
 	useCase := NewAlbumUseCase(mockRepo)
 
 	// Act
-	response, err := useCase.ListAlbums()
+	response, err := useCase.ListAlbums(context.Background(), domain.PageRequest{})
 
 	// Assert
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
-	if len(response.Albums) != 2 {
-		t.Errorf("Expected 2 albums, got %d", len(response.Albums))
+	if len(response.Items) != 2 {
+		t.Errorf("Expected 2 albums, got %d", len(response.Items))
 	}
 
-	if response.Albums[0].Title != "Test Album 1" {
-		t.Errorf("Expected first album title 'Test Album 1', got '%s'", response.Albums[0].Title)
+	if response.Items[0].Title != "Test Album 1" {
+		t.Errorf("Expected first album title 'Test Album 1', got '%s'", response.Items[0].Title)
 	}
 }
 
@@ -90,7 +129,7 @@ func TestAlbumUseCase_CreateAlbum(t *testing.T) {
 	title := "New Test Album"
 
 	// Act
-	album, err := useCase.CreateAlbum(title)
+	album, err := useCase.CreateAlbum(context.Background(), title)
 
 	// Assert
 	if err != nil {
@@ -105,3 +144,317 @@ func TestAlbumUseCase_CreateAlbum(t *testing.T) {
 		t.Errorf("Expected album ID 'test-id', got '%s'", album.ID)
 	}
 }
+
+func TestAlbumUseCase_CreateAlbumIfNotExists(t *testing.T) {
+	repo := &MockAlbumRepository{albums: []domain.Album{
+		{ID: "1", Title: "Trips"},
+		{ID: "2", Title: "Trips", IsWriteable: true},
+	}}
+	useCase := NewAlbumUseCase(repo)
+
+	tests := []struct {
+		title          string
+		appCreatedOnly bool
+		wantID         string
+		wantCreated    bool
+	}{
+		{"Trips", false, "1", false},
+		{"Trips", true, "2", false},
+		{"trips", false, "test-id", true},
+	}
+	for _, tt := range tests {
+		album, created, err := useCase.CreateAlbumIfNotExists(context.Background(), tt.title, tt.appCreatedOnly)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.title, err)
+		}
+		if album.ID != tt.wantID || created != tt.wantCreated {
+			t.Errorf("%s (app created only %v): expected album %s created %v, got %s created %v", tt.title, tt.appCreatedOnly, tt.wantID, tt.wantCreated, album.ID, created)
+		}
+	}
+
+	if _, _, err := useCase.CreateAlbumIfNotExists(context.Background(), "", false); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an empty title to be rejected, got %v", err)
+	}
+}
+
+// pagedAlbumRepository serves albums in pages keyed by page token ("" is the first page)
+type pagedAlbumRepository struct {
+	MockAlbumRepository
+	pages    map[string]domain.Page[domain.Album]
+	requests []domain.PageRequest
+}
+
+func (m *pagedAlbumRepository) ListAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	m.requests = append(m.requests, req)
+	page, ok := m.pages[req.PageToken]
+	if !ok {
+		return nil, errors.New("unknown page token")
+	}
+	return &page, nil
+}
+
+func TestAlbumUseCase_ListAllAlbums(t *testing.T) {
+	repo := &pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}, {ID: "2"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "3"}}, NextPageToken: "p3"},
+		"p3": {Items: []domain.Album{{ID: "4"}}},
+	}}
+	useCase := NewAlbumUseCase(repo)
+
+	albums, err := useCase.ListAllAlbums(context.Background(), domain.ListOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 4 || albums[3].ID != "4" {
+		t.Errorf("Expected albums 1-4, got %+v", albums)
+	}
+	if len(repo.requests) != 3 {
+		t.Fatalf("Expected 3 page requests, got %d", len(repo.requests))
+	}
+	if last := repo.requests[2]; last.PageSize != domain.MaxAlbumPageSize || last.PageToken != "p3" {
+		t.Errorf("Expected the page size to be kept across pages, got %+v", last)
+	}
+}
+
+func TestAlbumUseCase_AlbumsStopsEarly(t *testing.T) {
+	repo := &pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}, {ID: "2"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "3"}}},
+	}}
+	useCase := NewAlbumUseCase(repo)
+
+	for album, err := range useCase.Albums(context.Background(), domain.ListOptions{}) {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if album.ID == "2" {
+			break
+		}
+	}
+
+	if len(repo.requests) != 1 {
+		t.Errorf("Expected the second page not to be fetched, got %d requests", len(repo.requests))
+	}
+}
+
+// signalingAlbumRepository is a pagedAlbumRepository that reports every page token it is asked
+// for on fetched
+type signalingAlbumRepository struct {
+	pagedAlbumRepository
+	fetched chan string
+}
+
+func (m *signalingAlbumRepository) ListAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	defer func() { m.fetched <- req.PageToken }()
+	return m.pagedAlbumRepository.ListAlbums(req)
+}
+
+func TestAlbumUseCase_AlbumsPrefetch(t *testing.T) {
+	repo := &signalingAlbumRepository{fetched: make(chan string, 3), pagedAlbumRepository: pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}, {ID: "2"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "3"}}, NextPageToken: "p3"},
+		"p3": {Items: []domain.Album{{ID: "4"}}},
+	}}}
+	useCase := NewAlbumUseCase(repo)
+
+	var ids []string
+	for album, err := range useCase.Albums(context.Background(), domain.ListOptions{PageSize: 2, Prefetch: true}) {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if album.ID == "1" {
+			// The second page is requested while the first is still being handled
+			<-repo.fetched
+			select {
+			case token := <-repo.fetched:
+				if token != "p2" {
+					t.Errorf("Expected page p2 to be prefetched, got %q", token)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the second page to be fetched before the first was handled")
+			}
+		}
+		ids = append(ids, album.ID)
+	}
+
+	if strings.Join(ids, ",") != "1,2,3,4" {
+		t.Errorf("Expected albums 1-4 in order, got %v", ids)
+	}
+	for _, req := range repo.requests {
+		if req.PageSize != 2 {
+			t.Errorf("Expected pages of 2 albums, got %+v", req)
+		}
+	}
+
+	looping := &pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "2"}}, NextPageToken: "p2"},
+	}}
+	if _, err := NewAlbumUseCase(looping).ListAllAlbums(context.Background(), domain.ListOptions{Prefetch: true}); err == nil {
+		t.Error("Expected a repeated page token to be reported")
+	}
+	if _, err := useCase.ListAllAlbums(context.Background(), domain.ListOptions{PageSize: domain.MaxAlbumPageSize + 1}); err == nil {
+		t.Error("Expected a page size above the API limit to be rejected")
+	}
+}
+
+func TestAlbumUseCase_ListAllAlbumsErrors(t *testing.T) {
+	looping := &pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "2"}}, NextPageToken: "p2"},
+	}}
+	if _, err := NewAlbumUseCase(looping).ListAllAlbums(context.Background(), domain.ListOptions{}); err == nil {
+		t.Error("Expected a repeated page token to be reported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewAlbumUseCase(&MockAlbumRepository{}).ListAllAlbums(ctx, domain.ListOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestAlbumUseCase_FindAlbums(t *testing.T) {
+	repo := &pagedAlbumRepository{pages: map[string]domain.Page[domain.Album]{
+		"": {Items: []domain.Album{
+			{ID: "1", Title: "Vacation Spain 2023", IsWriteable: true},
+			{ID: "2", Title: "vacation italy 2023", ShareInfo: &domain.ShareInfo{}},
+		}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{
+			{ID: "3", Title: "Vacation 2024", IsWriteable: true},
+			{ID: "4", Title: "Vacation", IsWriteable: true, ShareInfo: &domain.ShareInfo{}},
+		}},
+	}}
+	useCase := NewAlbumUseCase(repo)
+
+	tests := []struct {
+		name    string
+		pattern string
+		filter  domain.AlbumFilter
+		want    string
+	}{
+		{"regex", "Vacation.*2023", domain.AlbumFilter{}, "1"},
+		{"regex ignoring case", "^vacation.*2023$", domain.AlbumFilter{IgnoreCase: true}, "1,2"},
+		{"substring", "cation", domain.AlbumFilter{Match: domain.TitleSubstring}, "1,2,3,4"},
+		{"exact", "VACATION", domain.AlbumFilter{Match: domain.TitleExact, IgnoreCase: true}, "4"},
+		{"exclude shared", "Vacation", domain.AlbumFilter{Match: domain.TitleSubstring, IgnoreCase: true, ExcludeShared: true}, "1,3"},
+		{"app created only", "2023", domain.AlbumFilter{AppCreatedOnly: true}, "1"},
+	}
+	for _, tt := range tests {
+		albums, err := useCase.FindAlbums(context.Background(), tt.pattern, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		var ids []string
+		for _, album := range albums {
+			ids = append(ids, album.ID)
+		}
+		if got := strings.Join(ids, ","); got != tt.want {
+			t.Errorf("%s: expected albums %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := useCase.FindAlbums(context.Background(), "Vacation(", domain.AlbumFilter{}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an invalid pattern to be rejected, got %v", err)
+	}
+}
+
+func TestAlbumUseCase_ListAlbumsValidatesPageSize(t *testing.T) {
+	useCase := NewAlbumUseCase(&MockAlbumRepository{})
+
+	if _, err := useCase.ListAlbums(context.Background(), domain.PageRequest{PageSize: domain.MaxAlbumPageSize + 1}); err == nil {
+		t.Error("Expected a page size above the API limit to be rejected")
+	}
+}
+
+func TestAlbumUseCase_AddMediaItemsChunks(t *testing.T) {
+	ids := make([]string, 0, 121)
+	for i := 0; i < 120; i++ {
+		ids = append(ids, fmt.Sprintf("item-%d", i))
+	}
+	ids = append(ids, "item-0", "")
+
+	repo := &MockAlbumRepository{}
+	if err := NewAlbumUseCase(repo).AddMediaItems(context.Background(), "album", ids); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	sizes := make([]int, len(repo.batches))
+	for i, batch := range repo.batches {
+		sizes[i] = len(batch)
+	}
+	if !slices.Equal(sizes, []int{50, 50, 20}) {
+		t.Errorf("Expected batches of 50, 50 and 20 unique ids, got %v", sizes)
+	}
+}
+
+func TestAlbumUseCase_RemoveMediaItemsReportsProgress(t *testing.T) {
+	ids := make([]string, 75)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("item-%d", i)
+	}
+
+	repo := &MockAlbumRepository{failAfter: 1}
+	err := NewAlbumUseCase(repo).RemoveMediaItems(context.Background(), "album", ids)
+	if err == nil || !strings.Contains(err.Error(), "after 50 of 75") {
+		t.Errorf("Expected error reporting 50 of 75 processed, got %v", err)
+	}
+
+	if err := NewAlbumUseCase(repo).RemoveMediaItems(context.Background(), "album", []string{""}); err == nil {
+		t.Error("Expected a request without media item ids to be rejected")
+	}
+}
+
+func TestAlbumUseCase_UpdateAlbum(t *testing.T) {
+	useCase := NewAlbumUseCase(&MockAlbumRepository{})
+
+	album, err := useCase.UpdateAlbum(context.Background(), "a1", "Renamed", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.Title != "Renamed" {
+		t.Errorf("Expected title 'Renamed', got '%s'", album.Title)
+	}
+
+	if _, err := useCase.UpdateAlbum(context.Background(), "a1", "", ""); err == nil {
+		t.Error("Expected an update without changes to be rejected")
+	}
+}
+
+// recordingTracer keeps the name and error of every span that ended
+type recordingTracer struct {
+	spans []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, attrs ...any) (context.Context, domain.Span) {
+	return ctx, recordingSpan{tracer: r, name: name}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	name   string
+}
+
+func (s recordingSpan) End(err error) {
+	s.tracer.spans = append(s.tracer.spans, fmt.Sprintf("%s: %v", s.name, err))
+}
+
+func TestAlbumUseCase_Traces(t *testing.T) {
+	tracer := &recordingTracer{}
+	uc := NewAlbumUseCase(&MockAlbumRepository{})
+	uc.SetTracer(tracer)
+
+	uc.ListAlbums(context.Background(), domain.PageRequest{})
+	uc.UpdateAlbum(context.Background(), "album-1", "", "")
+	uc.AddMediaItems(context.Background(), "album-1", []string{"m1"})
+
+	want := []string{
+		"album.list: <nil>",
+		"album.update: nothing to update: a title or cover photo is required",
+		"album.add_media_items: <nil>",
+	}
+	if !slices.Equal(tracer.spans, want) {
+		t.Errorf("Expected spans %q, got %q", want, tracer.spans)
+	}
+}
@@ -0,0 +1,307 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// backupManifestVersion is the version of the manifest layout, raised when it changes incompatibly
+const backupManifestVersion = 1
+
+// backupManifestKey is where the manifest is kept in a backup target
+const backupManifestKey = "manifest.json"
+
+// backupSaveEvery is how many new copies are recorded before the manifest is saved again, which
+// bounds what a crashed backup copies twice when it is run again
+const backupSaveEvery = 50
+
+// BackupOptions configures copying originals to a backup target
+type BackupOptions struct {
+	// AlbumID limits the backup to one album; empty backs up every media item the app can read
+	AlbumID string
+	// Workers is the number of media items copied at a time; values below 1 use the default
+	Workers int
+}
+
+// BackupResult is the outcome of copying one media item
+type BackupResult struct {
+	MediaItemID string `json:"mediaItemId"`
+	Filename    string `json:"filename,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BackupReport is the outcome of a backup run
+type BackupReport struct {
+	Target string `json:"target"`
+	// Present counts the media items the target held before the run, which were not copied again
+	Present int `json:"present"`
+	// Results holds every media item the run copied or failed to copy
+	Results []BackupResult `json:"results"`
+}
+
+// Failed counts the media items that could not be copied
+func (r BackupReport) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// BackupStatus summarizes what a backup target holds
+type BackupStatus struct {
+	Target     string    `json:"target"`
+	MediaItems int       `json:"mediaItems"`
+	Bytes      int64     `json:"bytes"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// BackupUseCase copies originals from Google Photos to a backup target, so the library is not
+// the only copy of the photos
+type BackupUseCase struct {
+	logging
+	tracing
+
+	repo       domain.MediaItemRepository
+	target     domain.BackupTarget
+	throughput domain.ThroughputStore
+	progress   domain.Progress
+}
+
+// NewBackupUseCase creates a new instance of BackupUseCase
+func NewBackupUseCase(repo domain.MediaItemRepository, target domain.BackupTarget) *BackupUseCase {
+	return &BackupUseCase{
+		repo:   repo,
+		target: target,
+	}
+}
+
+// SetThroughputStore keeps the backup speed across runs, so the remaining time of a resumed
+// backup is estimated from the start; nil estimates every run from scratch
+func (uc *BackupUseCase) SetThroughputStore(store domain.ThroughputStore) {
+	uc.throughput = store
+}
+
+// SetProgress reports the progress of backups to progress; nil reports it nowhere
+func (uc *BackupUseCase) SetProgress(progress domain.Progress) {
+	uc.progress = progress
+}
+
+// Backup copies the originals of the media items missing from the manifest of the target. Each
+// original is streamed from the download to the target while its SHA-256 is taken for the
+// manifest, so nothing is written to disk on the way. The manifest is saved every few copies and when the run ends, interrupted
+// or not, so running the backup again resumes it. Failures of single items are reported in their
+// result; cancelling ctx stops starting new copies.
+func (uc *BackupUseCase) Backup(ctx context.Context, opts BackupOptions) (report *BackupReport, err error) {
+	ctx, span := uc.trace(ctx, "backup.run", "target", uc.target.String(), "album_id", opts.AlbumID)
+	defer func() { span.End(err) }()
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	manifest, err := uc.loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := uc.backupItems(ctx, opts.AlbumID)
+	if err != nil {
+		uc.log().Error("Failed to list media items", "album_id", opts.AlbumID, "error", err)
+		return nil, err
+	}
+
+	report = &BackupReport{Target: uc.target.String()}
+	var pending []domain.MediaItem
+	for _, item := range items {
+		if _, ok := manifest.Items[item.ID]; ok {
+			report.Present++
+			continue
+		}
+		pending = append(pending, item)
+	}
+	uc.log().Info("Backing up media items", "target", uc.target.String(), "media_items", len(pending), "present", report.Present)
+
+	report.Results = make([]BackupResult, len(pending))
+	var mu sync.Mutex
+	unsaved := 0
+	progress := newProgressTracker(uc.throughput, uc.progress, domain.JobBackup, len(pending), uc.log())
+	runConcurrently(ctx, len(pending), workers, func(i int) {
+		result := &report.Results[i]
+		entry, err := uc.copyItem(ctx, pending[i])
+		*result = BackupResult{MediaItemID: pending[i].ID, Filename: pending[i].Filename, Key: entry.Key, Bytes: entry.Size, SHA256: entry.SHA256}
+		if err != nil {
+			uc.log().Warn("Failed to back up media item", "media_item_id", pending[i].ID, "error", err)
+			result.Error = err.Error()
+			progress.finish(pending[i].Filename, 0, true, false)
+			return
+		}
+
+		mu.Lock()
+		manifest.Items[pending[i].ID] = entry
+		if unsaved++; unsaved >= backupSaveEvery {
+			if err := uc.saveManifest(ctx, manifest); err != nil {
+				uc.log().Warn("Failed to save backup manifest", "error", err)
+			} else {
+				unsaved = 0
+			}
+		}
+		mu.Unlock()
+		progress.finish(entry.Key, entry.Size, false, false)
+	}, func(i int, err error) {
+		report.Results[i] = BackupResult{MediaItemID: pending[i].ID, Filename: pending[i].Filename, Error: err.Error()}
+	})
+	progress.close()
+
+	// The copies made before an interrupt are recorded too, so the next run skips them
+	if unsaved > 0 {
+		if err := uc.saveManifest(context.WithoutCancel(ctx), manifest); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	uc.log().Info("Backup finished", "target", uc.target.String(), "copied", len(pending)-report.Failed(), "failed", report.Failed())
+	return report, nil
+}
+
+// Status summarizes the manifest of the target
+func (uc *BackupUseCase) Status(ctx context.Context) (*BackupStatus, error) {
+	manifest, err := uc.loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &BackupStatus{Target: uc.target.String(), MediaItems: len(manifest.Items), UpdatedAt: manifest.UpdatedAt}
+	for _, entry := range manifest.Items {
+		status.Bytes += entry.Size
+	}
+	return status, nil
+}
+
+// backupItems lists the media items of albumID, or every media item when it is empty
+func (uc *BackupUseCase) backupItems(ctx context.Context, albumID string) ([]domain.MediaItem, error) {
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	if albumID == "" {
+		return collect(paginate(ctx, req, uc.repo.ListMediaItems))
+	}
+	return collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.repo.SearchMediaItems(albumID, req)
+	}))
+}
+
+// copyItem streams the original of item to the target, taking its size and checksum on the way
+func (uc *BackupUseCase) copyItem(ctx context.Context, item domain.MediaItem) (entry domain.BackupEntry, err error) {
+	ctx, span := uc.trace(ctx, "backup.item", "media_item_id", item.ID)
+	defer func() { span.End(err) }()
+
+	entry = domain.BackupEntry{Key: backupKey(item), Filename: item.Filename, MimeType: item.MimeType, CreationTime: creationTime(item)}
+	content, err := uc.repo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		return entry, err
+	}
+	defer content.Close()
+
+	original := &checksumReader{r: content, hash: sha256.New()}
+	if err := uc.target.Put(ctx, entry.Key, original, -1, ""); err != nil {
+		if original.err != nil {
+			return entry, fmt.Errorf("failed to download original: %w", original.err)
+		}
+		return entry, err
+	}
+	entry.Size, entry.SHA256 = original.n, hex.EncodeToString(original.hash.Sum(nil))
+	entry.BackedUpAt = time.Now().UTC()
+	return entry, nil
+}
+
+// checksumReader takes the size and SHA-256 of what is read through it, and keeps the error
+// reading failed with so a broken download is told apart from a failed upload
+type checksumReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+	err  error
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	c.n += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// loadManifest reads the manifest of the target; a target without one holds nothing yet
+func (uc *BackupUseCase) loadManifest(ctx context.Context) (*domain.BackupManifest, error) {
+	manifest := &domain.BackupManifest{Version: backupManifestVersion, Items: make(map[string]domain.BackupEntry)}
+	r, err := uc.target.Get(ctx, backupManifestKey)
+	if errors.Is(err, domain.ErrNotFound) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+	if manifest.Version > backupManifestVersion {
+		return nil, fmt.Errorf("backup manifest version %d is newer than this program understands", manifest.Version)
+	}
+	if manifest.Items == nil {
+		manifest.Items = make(map[string]domain.BackupEntry)
+	}
+	return manifest, nil
+}
+
+// saveManifest replaces the manifest of the target
+func (uc *BackupUseCase) saveManifest(ctx context.Context, manifest *domain.BackupManifest) error {
+	manifest.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup manifest: %w", err)
+	}
+	checksum := sha256.Sum256(data)
+	if err := uc.target.Put(ctx, backupManifestKey, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(checksum[:])); err != nil {
+		return fmt.Errorf("failed to save backup manifest: %w", err)
+	}
+	return nil
+}
+
+// backupKey places the original of item under media/YEAR/MONTH by its capture date. A short hash of
+// its ID keeps items sharing a file name apart, across runs too.
+func backupKey(item domain.MediaItem) string {
+	dir := "media/undated"
+	if created := creationTime(item); !created.IsZero() {
+		dir = created.Format("media/2006/01")
+	}
+
+	name := path.Base(strings.ReplaceAll(item.Filename, "\\", "/"))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "original"
+	}
+	id := sha256.Sum256([]byte(item.ID))
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s/%s_%s%s", dir, strings.TrimSuffix(name, ext), hex.EncodeToString(id[:4]), ext)
+}
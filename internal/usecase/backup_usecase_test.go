@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// mockBackupTarget keeps what is put in memory
+type mockBackupTarget struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// sizes records the size each key was put with
+	sizes map[string]int64
+	puts  []string
+}
+
+func newMockBackupTarget() *mockBackupTarget {
+	return &mockBackupTarget{objects: make(map[string][]byte), sizes: make(map[string]int64)}
+}
+
+func (m *mockBackupTarget) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("got %d bytes, expected %d", len(data), size)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	m.sizes[key] = size
+	m.puts = append(m.puts, key)
+	return nil
+}
+
+func (m *mockBackupTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *mockBackupTarget) String() string {
+	return "mem://"
+}
+
+func TestBackupUseCase_Backup(t *testing.T) {
+	taken := time.Date(2023, 8, 14, 10, 0, 0, 0, time.UTC)
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			{ID: "1", Filename: "beach.jpg", BaseURL: "https://img/1", MediaMetadata: &domain.MediaMetadata{CreationTime: taken}},
+			{ID: "2", Filename: "clip.mp4", BaseURL: "https://img/2", MimeType: "video/mp4"},
+			{ID: "3", Filename: "gone.jpg", BaseURL: "https://img/3"},
+		},
+		files: map[string]string{
+			"https://img/1=d":  "one",
+			"https://img/2=dv": "video",
+		},
+	}
+	target := newMockBackupTarget()
+	useCase := NewBackupUseCase(repo, target)
+
+	report, err := useCase.Backup(context.Background(), BackupOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Failed() != 1 || report.Results[2].Error == "" {
+		t.Errorf("Expected only the missing original to fail, got %+v", report.Results)
+	}
+	key := report.Results[0].Key
+	if !strings.HasPrefix(key, "media/2023/08/beach_") || !strings.HasSuffix(key, ".jpg") {
+		t.Errorf("Expected the photo under its capture month, got %q", key)
+	}
+	// Originals are streamed, so their size is only known once they are sent
+	checksum := sha256.Sum256([]byte("one"))
+	if string(target.objects[key]) != "one" || target.sizes[key] != -1 || report.Results[0].SHA256 != hex.EncodeToString(checksum[:]) {
+		t.Errorf("Expected the streamed original with its checksum, got %q (%d, %s)", target.objects[key], target.sizes[key], report.Results[0].SHA256)
+	}
+	if !strings.HasPrefix(report.Results[1].Key, "media/undated/clip_") {
+		t.Errorf("Expected an undated video under media/undated, got %q", report.Results[1].Key)
+	}
+
+	var manifest domain.BackupManifest
+	if err := json.Unmarshal(target.objects[backupManifestKey], &manifest); err != nil {
+		t.Fatalf("Expected a manifest, got %v", err)
+	}
+	if len(manifest.Items) != 2 || manifest.Items["1"].Size != 3 {
+		t.Errorf("Expected the two copies in the manifest, got %+v", manifest.Items)
+	}
+
+	// A second run resumes, copying only what is still missing
+	repo.files["https://img/3=d"] = "three"
+	target.puts = nil
+	report, err = useCase.Backup(context.Background(), BackupOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Present != 2 || len(report.Results) != 1 || report.Results[0].MediaItemID != "3" {
+		t.Errorf("Expected only the failed item to be copied again, got %+v", report)
+	}
+	if len(target.puts) != 2 {
+		t.Errorf("Expected the copy and the manifest to be put, got %v", target.puts)
+	}
+
+	status, err := useCase.Status(context.Background())
+	if err != nil || status.MediaItems != 3 || status.Bytes != 13 {
+		t.Errorf("Expected 3 media items of 13 bytes, got %+v (%v)", status, err)
+	}
+}
+
+func TestBackupUseCase_NewerManifest(t *testing.T) {
+	target := newMockBackupTarget()
+	target.objects[backupManifestKey] = []byte(`{"version": 99}`)
+	useCase := NewBackupUseCase(&MockMediaItemRepository{}, target)
+
+	if _, err := useCase.Status(context.Background()); err == nil {
+		t.Error("Expected a manifest of a newer version to be rejected")
+	}
+	if _, err := useCase.Backup(context.Background(), BackupOptions{}); err == nil {
+		t.Errorf("Expected the backup to refuse the manifest, got %v", err)
+	}
+}
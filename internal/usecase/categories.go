@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// defaultCategorySamples is how many media items of each category are shown unless another number
+// is asked for
+const defaultCategorySamples = 3
+
+// CategoryOptions configures the report of media items by content category
+type CategoryOptions struct {
+	// Categories are the content categories to count; empty counts every one but NONE
+	Categories []domain.ContentCategory
+	// Samples is how many media items of each category are kept as examples; zero keeps the
+	// default of 3 and negative values keep none
+	Samples int
+}
+
+// CategoryCount is how many media items Google Photos puts in one content category
+type CategoryCount struct {
+	Category domain.ContentCategory `json:"category"`
+	Count    int                    `json:"count"`
+	Photos   int                    `json:"photos"`
+	Videos   int                    `json:"videos"`
+	// Samples are the first media items the search returned for the category
+	Samples []domain.MediaItem `json:"samples,omitempty"`
+}
+
+// CategoryReport counts the media items of every content category by searching the library for
+// each in turn, the largest first, to find clutter such as screenshots and receipts. A media item
+// in several categories is counted in each. Unlike the other reports it asks the API, since the
+// local index does not know the categories.
+func (uc *IndexUseCase) CategoryReport(ctx context.Context, opts CategoryOptions) (counts []CategoryCount, err error) {
+	ctx, span := uc.trace(ctx, "index.category_report")
+	defer func() { span.End(err) }()
+
+	categories := opts.Categories
+	if len(categories) == 0 {
+		categories = slices.DeleteFunc(domain.ContentCategories(), func(c domain.ContentCategory) bool { return c == domain.ContentCategoryNone })
+	}
+	samples := opts.Samples
+	if samples == 0 {
+		samples = defaultCategorySamples
+	}
+
+	for _, category := range categories {
+		uc.log().Info("Counting media items", "category", category)
+		count := CategoryCount{Category: category}
+		filters := domain.SearchFilters{ContentCategories: []domain.ContentCategory{category}}
+		for item, err := range paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItemsByFilters(filters, req)
+		}) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to search %s media items: %w", category, err)
+			}
+			count.Count++
+			if item.IsVideo() {
+				count.Videos++
+			} else {
+				count.Photos++
+			}
+			if len(count.Samples) < samples {
+				count.Samples = append(count.Samples, item)
+			}
+		}
+		counts = append(counts, count)
+	}
+
+	slices.SortStableFunc(counts, func(a, b CategoryCount) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return counts, nil
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// categorizedMediaItemRepository answers searches by content category with the media items of
+// that category
+type categorizedMediaItemRepository struct {
+	*MockMediaItemRepository
+	categories map[domain.ContentCategory][]domain.MediaItem
+}
+
+func (r categorizedMediaItemRepository) SearchMediaItemsByFilters(filters domain.SearchFilters, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	r.MockMediaItemRepository.SearchMediaItemsByFilters(filters, req)
+	var items []domain.MediaItem
+	for _, c := range filters.ContentCategories {
+		items = append(items, r.categories[c]...)
+	}
+	return &domain.Page[domain.MediaItem]{Items: items}, nil
+}
+
+func TestIndexUseCase_CategoryReport(t *testing.T) {
+	video := domain.MediaItem{ID: "v1", MediaMetadata: &domain.MediaMetadata{Video: &domain.VideoMetadata{}}}
+	repo := categorizedMediaItemRepository{&MockMediaItemRepository{}, map[domain.ContentCategory][]domain.MediaItem{
+		domain.ContentCategoryScreenshots: {{ID: "s1"}, {ID: "s2"}, {ID: "s3"}},
+		domain.ContentCategoryPeople:      {{ID: "p1"}, video},
+	}}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, repo, &MockIndexRepository{})
+
+	counts, err := uc.CategoryReport(context.Background(), CategoryOptions{
+		Categories: []domain.ContentCategory{domain.ContentCategoryReceipts, domain.ContentCategoryPeople, domain.ContentCategoryScreenshots},
+		Samples:    2,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(counts) != 3 {
+		t.Fatalf("Expected a count per category, got %+v", counts)
+	}
+	if c := counts[0]; c.Category != domain.ContentCategoryScreenshots || c.Count != 3 || len(c.Samples) != 2 || c.Samples[0].ID != "s1" {
+		t.Errorf("Expected screenshots first with 2 samples, got %+v", c)
+	}
+	if c := counts[1]; c.Category != domain.ContentCategoryPeople || c.Photos != 1 || c.Videos != 1 {
+		t.Errorf("Expected a photo and a video of people, got %+v", c)
+	}
+	if c := counts[2]; c.Category != domain.ContentCategoryReceipts || c.Count != 0 || c.Samples != nil {
+		t.Errorf("Expected no receipts, got %+v", c)
+	}
+
+	// Without categories every one but NONE is searched
+	repo.filterSearches = nil
+	if _, err := uc.CategoryReport(context.Background(), CategoryOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.filterSearches) != len(domain.ContentCategories())-1 {
+		t.Errorf("Expected a search per category, got %d", len(repo.filterSearches))
+	}
+}
@@ -0,0 +1,34 @@
+package usecase
+
+import (
+	"context"
+	"os"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// cleanup is embedded by use cases leaving temporary files, servers or partial uploads behind
+// until an operation finishes, so they are cleaned up however the run ends
+type cleanup struct {
+	hooks domain.ExitHooks
+}
+
+// SetExitHooks registers the cleanup of operations with hooks, which also run it when the run
+// ends before them; nil leaves it to the operations alone
+func (c *cleanup) SetExitHooks(hooks domain.ExitHooks) {
+	c.hooks = hooks
+}
+
+// removeAll returns a cleanup step removing the temporary file or directory at path, which the
+// operation may have renamed or removed already
+func removeAll(path string) func(context.Context) error {
+	return func(context.Context) error {
+		return os.RemoveAll(path)
+	}
+}
+
+// onExit registers fn with the exit hooks and returns the function running it at once, which the
+// operation defers
+func (c *cleanup) onExit(name string, fn func(context.Context) error) func() error {
+	return domain.OnExit(c.hooks, name, fn)
+}
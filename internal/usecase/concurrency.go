@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+)
+
+// runConcurrently calls fn for every index below n using up to workers goroutines. Once ctx is
+// cancelled no new calls are started and skip receives the context error for each remaining index.
+func runConcurrently(ctx context.Context, n, workers int, fn func(i int), skip func(i int, err error)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		if err := ctx.Err(); err != nil {
+			skip(i, err)
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			skip(i, ctx.Err())
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
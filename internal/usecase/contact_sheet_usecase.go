@@ -0,0 +1,355 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // decoders for the formats Google may serve thumbnails in
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// SheetFormat is the file format contact sheets are rendered to
+type SheetFormat string
+
+// Supported contact sheet formats
+const (
+	SheetPNG  SheetFormat = "png"
+	SheetJPEG SheetFormat = "jpeg"
+	// SheetPDF writes every page into a single document
+	SheetPDF SheetFormat = "pdf"
+)
+
+// Contact sheet defaults and layout, in pixels
+const (
+	DefaultSheetColumns       = 5
+	DefaultSheetRows          = 6
+	DefaultSheetThumbnailSize = 240
+
+	sheetMargin = 24
+	sheetGap    = 16
+	// sheetHeader holds the album title and page number above the grid
+	sheetHeader = 28
+	// sheetLine is the height of a caption line set in basicfont.Face7x13
+	sheetLine = 15
+	// sheetCaptionLines are the file name and the creation date under each thumbnail
+	sheetCaptionLines = 2
+	sheetJPEGQuality  = 90
+	// sheetDPI sets the page size of PDF contact sheets
+	sheetDPI = 150
+)
+
+// ContactSheetOptions configures how an album is laid out on contact sheets
+type ContactSheetOptions struct {
+	// Dir receives the page images, or the PDF document
+	Dir    string
+	Format SheetFormat
+	// Columns and Rows set how many thumbnails fit on a page
+	Columns int
+	Rows    int
+	// ThumbnailSize is the width and height of each square thumbnail
+	ThumbnailSize int
+	// Workers is the number of concurrent thumbnail downloads; values below 1 use the default
+	Workers int
+	// TimeZone is where captions show creation times; nil shows UTC
+	TimeZone *time.Location
+}
+
+// ContactSheetPage is one rendered page of a contact sheet
+type ContactSheetPage struct {
+	Page  int `json:"page"`
+	Items int `json:"items"`
+	// Missing counts the thumbnails that could not be fetched and show a placeholder instead
+	Missing int    `json:"missing"`
+	Path    string `json:"path"`
+}
+
+// ContactSheetUseCase implements the business logic for rendering an album as contact sheets:
+// pages of captioned thumbnails to review or print an album at a glance
+type ContactSheetUseCase struct {
+	logging
+
+	albumRepo domain.AlbumRepository
+	mediaRepo domain.MediaItemRepository
+	thumbs    domain.ThumbnailCache
+}
+
+// NewContactSheetUseCase creates a new instance of ContactSheetUseCase
+func NewContactSheetUseCase(albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository, thumbs domain.ThumbnailCache) *ContactSheetUseCase {
+	return &ContactSheetUseCase{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+		thumbs:    thumbs,
+	}
+}
+
+// RenderContactSheet lays out every media item of an album as captioned thumbnails, opts.Columns x
+// opts.Rows per page, and writes the pages to opts.Dir. Thumbnails come from the thumbnail cache
+// and are only downloaded when missing; videos show a still frame.
+func (uc *ContactSheetUseCase) RenderContactSheet(ctx context.Context, albumID string, opts ContactSheetOptions) ([]ContactSheetPage, error) {
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if opts.Columns < 1 || opts.Rows < 1 || opts.ThumbnailSize < 1 {
+		return nil, fmt.Errorf("contact sheet columns, rows and thumbnail size must be at least 1")
+	}
+	if opts.Format != SheetPNG && opts.Format != SheetJPEG && opts.Format != SheetPDF {
+		return nil, fmt.Errorf("unknown contact sheet format %q, expected png, jpeg or pdf", opts.Format)
+	}
+
+	uc.log().Info("Fetching album", "album_id", albumID)
+
+	album, err := uc.albumRepo.GetAlbumByID(albumID)
+	if err != nil {
+		uc.log().Error("Failed to fetch album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	items, err := collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.mediaRepo.SearchMediaItems(albumID, req)
+	}))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("album %s has no media items", albumID)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create contact sheet directory: %w", err)
+	}
+
+	perPage := opts.Columns * opts.Rows
+	total := (len(items) + perPage - 1) / perPage
+	uc.log().Info("Rendering media items on contact sheet pages", "media_items", len(items), "pages", total)
+
+	var pages []ContactSheetPage
+	var pdfPages []pdfPage
+	for start := 0; start < len(items); start += perPage {
+		pageItems := items[start:min(start+perPage, len(items))]
+		page := ContactSheetPage{Page: len(pages) + 1, Items: len(pageItems)}
+
+		thumbs, err := uc.thumbnails(ctx, pageItems, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, thumb := range thumbs {
+			if thumb == nil {
+				page.Missing++
+			}
+		}
+
+		sheet := drawContactSheet(album.Title, page.Page, total, pageItems, thumbs, opts)
+		if opts.Format == SheetPDF {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: sheetJPEGQuality}); err != nil {
+				return nil, fmt.Errorf("failed to encode contact sheet page: %w", err)
+			}
+			pdfPages = append(pdfPages, pdfPage{jpeg: buf.Bytes(), width: sheet.Bounds().Dx(), height: sheet.Bounds().Dy(), dpi: sheetDPI})
+			page.Path = filepath.Join(opts.Dir, "contact-sheet.pdf")
+		} else {
+			page.Path = filepath.Join(opts.Dir, fmt.Sprintf("contact-sheet-%03d.%s", page.Page, opts.Format))
+			if err := writeSheetImage(page.Path, sheet, opts.Format); err != nil {
+				return nil, err
+			}
+		}
+
+		uc.log().Info("Rendered contact sheet page", "page", page.Page, "pages", total)
+		pages = append(pages, page)
+	}
+
+	if opts.Format == SheetPDF {
+		if err := writeFile(filepath.Join(opts.Dir, "contact-sheet.pdf"), func(w io.Writer) error {
+			return writePDF(w, pdfPages)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	uc.log().Info("Successfully rendered contact sheet pages", "pages", len(pages))
+	return pages, nil
+}
+
+// thumbnails returns the decoded thumbnail of each item, nil for the ones that could not be fetched.
+// Cached thumbnails are used as is; missing ones are downloaded square-cropped and cached.
+func (uc *ContactSheetUseCase) thumbnails(ctx context.Context, items []domain.MediaItem, opts ContactSheetOptions) ([]image.Image, error) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	thumbs := make([]image.Image, len(items))
+	runConcurrently(ctx, len(items), workers, func(i int) {
+		thumb, err := uc.thumbnail(items[i], opts.ThumbnailSize)
+		if err != nil {
+			uc.log().Warn("Failed to fetch thumbnail", "media_item_id", items[i].ID, "error", err)
+			return
+		}
+		thumbs[i] = thumb
+	}, func(int, error) {})
+
+	// An interrupted page would be mostly placeholders, so stop instead of writing it
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return thumbs, nil
+}
+
+// thumbnail loads the thumbnail of an item from the cache, downloading it first when it is missing
+func (uc *ContactSheetUseCase) thumbnail(item domain.MediaItem, size int) (image.Image, error) {
+	data, err := uc.thumbs.LoadThumbnail(item.ID, size)
+	if err != nil {
+		uc.log().Warn("Failed to read cached thumbnail", "media_item_id", item.ID, "error", err)
+	}
+	if data != nil {
+		if thumb, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			return thumb, nil
+		}
+		// A corrupt cache entry is replaced by a fresh download
+	}
+
+	content, err := uc.mediaRepo.DownloadMediaItem(item, domain.ImageSize{Width: size, Height: size, Crop: true, Still: true})
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err = io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	thumb, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+
+	if err := uc.thumbs.SaveThumbnail(item.ID, size, data); err != nil {
+		uc.log().Warn("Failed to cache thumbnail", "media_item_id", item.ID, "error", err)
+	}
+	return thumb, nil
+}
+
+// drawContactSheet renders one page: a header with the album title and page number, then the
+// thumbnails in a grid with the file name and creation date under each
+func drawContactSheet(title string, page, total int, items []domain.MediaItem, thumbs []image.Image, opts ContactSheetOptions) *image.RGBA {
+	size := opts.ThumbnailSize
+	cellHeight := size + 4 + sheetCaptionLines*sheetLine
+	width := 2*sheetMargin + opts.Columns*size + (opts.Columns-1)*sheetGap
+	height := 2*sheetMargin + sheetHeader + opts.Rows*cellHeight + (opts.Rows-1)*sheetGap
+
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+
+	face := basicfont.Face7x13
+	header := fmt.Sprintf("%s - page %d of %d", title, page, total)
+	drawText(sheet, face, fitText(face, header, width-2*sheetMargin), sheetMargin, sheetMargin+sheetLine, color.Black)
+
+	placeholder := image.NewUniform(color.Gray{Y: 0xdd})
+	for i, item := range items {
+		x := sheetMargin + (i%opts.Columns)*(size+sheetGap)
+		y := sheetMargin + sheetHeader + (i/opts.Columns)*(cellHeight+sheetGap)
+		cell := image.Rect(x, y, x+size, y+size)
+
+		if thumb := thumbs[i]; thumb != nil {
+			// Center thumbnails that came back smaller than requested
+			b := thumb.Bounds()
+			offset := image.Pt((size-min(b.Dx(), size))/2, (size-min(b.Dy(), size))/2)
+			draw.Draw(sheet, cell.Add(offset).Intersect(cell), thumb, b.Min, draw.Src)
+		} else {
+			draw.Draw(sheet, cell, placeholder, image.Point{}, draw.Src)
+			drawText(sheet, face, "no preview", x+8, y+size/2, color.Black)
+		}
+
+		name := item.Filename
+		if name == "" {
+			name = item.ID
+		}
+		drawText(sheet, face, fitText(face, name, size), x, y+size+sheetLine, color.Black)
+		drawText(sheet, face, fitText(face, captionDate(item, opts.TimeZone), size), x, y+size+2*sheetLine, color.Gray{Y: 0x66})
+	}
+	return sheet
+}
+
+// captionDate formats when an item was created in loc, marking videos
+func captionDate(item domain.MediaItem, loc *time.Location) string {
+	var date string
+	if t := creationTimeIn(item, loc); !t.IsZero() {
+		date = t.Format("2006-01-02 15:04")
+	}
+	if item.IsVideo() {
+		return strings.TrimSpace(date + " video")
+	}
+	return date
+}
+
+// fitText shortens s with "..." until it fits within width pixels when set in face
+func fitText(face font.Face, s string, width int) string {
+	if font.MeasureString(face, s).Ceil() <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)+"...").Ceil() > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// drawText writes s in face with its baseline starting at (x, y)
+func drawText(dst draw.Image, face font.Face, s string, x, y int, c color.Color) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+// writeSheetImage encodes a contact sheet page as a PNG or JPEG file
+func writeSheetImage(path string, sheet image.Image, format SheetFormat) error {
+	return writeFile(path, func(w io.Writer) error {
+		if format == SheetJPEG {
+			return jpeg.Encode(w, sheet, &jpeg.Options{Quality: sheetJPEGQuality})
+		}
+		return png.Encode(w, sheet)
+	})
+}
+
+// writeFile writes a file through a temporary file in the same directory, so a failure never
+// leaves a truncated file behind
+func writeFile(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".render-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockThumbnailCache keeps thumbnails in memory
+type MockThumbnailCache struct {
+	mu     sync.Mutex
+	thumbs map[string][]byte
+}
+
+func (m *MockThumbnailCache) LoadThumbnail(mediaItemID string, size int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.thumbs[mediaItemID], nil
+}
+
+func (m *MockThumbnailCache) SaveThumbnail(mediaItemID string, size int, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.thumbs == nil {
+		m.thumbs = make(map[string][]byte)
+	}
+	m.thumbs[mediaItemID] = data
+	return nil
+}
+
+// pngThumbnail encodes a square PNG of one color
+func pngThumbnail(t *testing.T, size int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func contactSheetFixture(t *testing.T) (*MockMediaItemRepository, *MockAlbumRepository) {
+	thumb := pngThumbnail(t, 40)
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			sized("1", "beach.jpg", 4000, 3000),
+			sized("2", "a-very-long-file-name-from-the-camera.jpg", 3000, 4000),
+			{ID: "3", Filename: "clip.mp4", BaseURL: "https://img/3", MimeType: "video/mp4"},
+		},
+		// The video serves a still frame; item 2 has no thumbnail and gets a placeholder
+		files: map[string]string{
+			"https://img/1=w40-h40-c": thumb,
+			"https://img/3=w40-h40-c": thumb,
+		},
+	}
+	albums := &MockAlbumRepository{albums: []domain.Album{{ID: "album", Title: "Holiday"}}}
+	return repo, albums
+}
+
+func TestContactSheetUseCase_RenderContactSheet(t *testing.T) {
+	dir := t.TempDir()
+	repo, albums := contactSheetFixture(t)
+	cache := &MockThumbnailCache{}
+	useCase := NewContactSheetUseCase(albums, repo, cache)
+	opts := ContactSheetOptions{Dir: dir, Format: SheetPNG, Columns: 2, Rows: 1, ThumbnailSize: 40, Workers: 2}
+
+	pages, err := useCase.RenderContactSheet(context.Background(), "album", opts)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []ContactSheetPage{
+		{Page: 1, Items: 2, Missing: 1, Path: filepath.Join(dir, "contact-sheet-001.png")},
+		{Page: 2, Items: 1, Path: filepath.Join(dir, "contact-sheet-002.png")},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("Expected %d pages, got %+v", len(want), pages)
+	}
+	for i := range want {
+		if pages[i] != want[i] {
+			t.Errorf("Expected page %+v, got %+v", want[i], pages[i])
+		}
+	}
+
+	f, err := os.Open(pages[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Expected a PNG page, got %v", err)
+	}
+	// Two 40px thumbnails with margins, gap, header and two caption lines
+	if b := sheet.Bounds(); b.Dx() != 2*24+2*40+16 || b.Dy() != 2*24+28+40+4+2*15 {
+		t.Errorf("Expected the page to fit the grid, got %v", b)
+	}
+	if c := color.GrayModel.Convert(sheet.At(24+1, 24+28+1)).(color.Gray); c.Y != 0x80 {
+		t.Errorf("Expected the first thumbnail at the top left of the grid, got %v", c)
+	}
+
+	if len(cache.thumbs) != 2 {
+		t.Errorf("Expected the 2 fetched thumbnails to be cached, got %d", len(cache.thumbs))
+	}
+
+	// Rendering again only retries the thumbnail that is not cached
+	repo.downloads = nil
+	if _, err := useCase.RenderContactSheet(context.Background(), "album", opts); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.downloads) != 1 || repo.downloads[0] != "https://img/2=w40-h40-c" {
+		t.Errorf("Expected only the missing thumbnail to be downloaded, got %v", repo.downloads)
+	}
+}
+
+func TestContactSheetUseCase_RenderContactSheetPDF(t *testing.T) {
+	dir := t.TempDir()
+	repo, albums := contactSheetFixture(t)
+	useCase := NewContactSheetUseCase(albums, repo, &MockThumbnailCache{})
+
+	pages, err := useCase.RenderContactSheet(context.Background(), "album", ContactSheetOptions{
+		Dir: dir, Format: SheetPDF, Columns: 1, Rows: 1, ThumbnailSize: 40,
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(pages) != 3 || pages[2].Path != filepath.Join(dir, "contact-sheet.pdf") {
+		t.Fatalf("Expected 3 pages in one document, got %+v", pages)
+	}
+
+	data, err := os.ReadFile(pages[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(data)
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Errorf("Expected a PDF header and trailer, got %q...", doc[:min(len(doc), 20)])
+	}
+	if !strings.Contains(doc, "/Count 3") || strings.Count(doc, "/Filter /DCTDecode") != 3 {
+		t.Errorf("Expected 3 pages with a JPEG image each")
+	}
+
+	// The cross-reference table must point at the objects
+	for _, id := range []string{"1 0 obj", "11 0 obj"} {
+		if !strings.Contains(doc, "\n"+id+"\n") {
+			t.Errorf("Expected object %q in the document", id)
+		}
+	}
+}
+
+func TestContactSheetUseCase_RenderContactSheetInvalid(t *testing.T) {
+	repo, albums := contactSheetFixture(t)
+	useCase := NewContactSheetUseCase(albums, repo, &MockThumbnailCache{})
+
+	_, err := useCase.RenderContactSheet(context.Background(), "album", ContactSheetOptions{Dir: t.TempDir(), Format: "gif", Columns: 1, Rows: 1, ThumbnailSize: 40})
+
+	if err == nil || !strings.Contains(err.Error(), "unknown contact sheet format") {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// JobRunner runs the command of a daemon job until it is done or ctx is cancelled
+type JobRunner func(ctx context.Context, job domain.DaemonJob) error
+
+// DaemonUseCase runs commands on schedules, such as a sync every 6 hours and magic albums every
+// night, and keeps the outcome of their last runs. Each run of a command is traced on its own.
+type DaemonUseCase struct {
+	logging
+
+	statuses domain.JobStatusStore
+	now      func() time.Time
+	// wait sleeps for d and reports false when ctx was cancelled first
+	wait func(ctx context.Context, d time.Duration) bool
+}
+
+// NewDaemonUseCase creates a new instance of DaemonUseCase
+func NewDaemonUseCase(statuses domain.JobStatusStore) *DaemonUseCase {
+	return &DaemonUseCase{
+		statuses: statuses,
+		now:      time.Now,
+		wait:     sleepContext,
+	}
+}
+
+// Run starts every job with run each time its schedule fires, until ctx is cancelled. Cron
+// schedules are matched in loc. Jobs run one at a time, since most of them take the local index;
+// a job that fell due while another ran starts right after it, once, however many times it was
+// missed. The status of every job is saved after each of its runs. Cancelling ctx interrupts the
+// running job, which Run waits for before it returns.
+func (uc *DaemonUseCase) Run(ctx context.Context, jobs []domain.DaemonJob, loc *time.Location, run JobRunner) error {
+	if len(jobs) == 0 {
+		return fmt.Errorf("%w: no daemon jobs are configured", domain.ErrInvalidArgument)
+	}
+	saved, err := uc.statuses.LoadJobStatuses()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]domain.JobStatus, len(jobs))
+	now := uc.now().In(loc)
+	for i, job := range jobs {
+		status := saved[job.Name]
+		status.Name, status.Schedule = job.Name, job.Schedule.String()
+		status.NextRun = job.Schedule.Next(now)
+		statuses[i] = status
+		uc.saveStatus(status)
+		uc.log().Info("Scheduled job", "job", job.Name, "schedule", job.Schedule.String(), "next_run", status.NextRun)
+	}
+	// The next runs mean nothing once the daemon is gone
+	defer func() {
+		for _, status := range statuses {
+			status.NextRun = time.Time{}
+			uc.saveStatus(status)
+		}
+	}()
+
+	for {
+		i := nextJob(statuses)
+		if i < 0 {
+			uc.log().Warn("No job is ever due again")
+			<-ctx.Done()
+			return nil
+		}
+		if !uc.wait(ctx, statuses[i].NextRun.Sub(uc.now())) {
+			return nil
+		}
+
+		statuses[i] = uc.runJob(ctx, jobs[i], statuses[i], run)
+		if ctx.Err() != nil {
+			return nil
+		}
+		statuses[i].NextRun = jobs[i].Schedule.Next(uc.now().In(loc))
+		uc.saveStatus(statuses[i])
+	}
+}
+
+// Status returns the status of every job in jobs, as saved by the last runs of the daemon
+func (uc *DaemonUseCase) Status(jobs []domain.DaemonJob) ([]domain.JobStatus, error) {
+	saved, err := uc.statuses.LoadJobStatuses()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]domain.JobStatus, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = saved[job.Name]
+		statuses[i].Name, statuses[i].Schedule = job.Name, job.Schedule.String()
+	}
+	return statuses, nil
+}
+
+// runJob runs job once and returns its status updated with the outcome
+func (uc *DaemonUseCase) runJob(ctx context.Context, job domain.DaemonJob, status domain.JobStatus, run JobRunner) domain.JobStatus {
+	uc.log().Info("Starting job", "job", job.Name, "command", strings.Join(job.Command, " "))
+
+	status.LastStart = uc.now()
+	err := run(ctx, job)
+	status.LastEnd = uc.now()
+	status.Runs++
+
+	duration := status.LastEnd.Sub(status.LastStart).Round(time.Second)
+	status.Error = ""
+	if err != nil {
+		status.Error = domain.RedactError(err).Error()
+	}
+	switch {
+	case ctx.Err() != nil:
+		status.Result = domain.JobInterrupted
+		uc.log().Warn("Interrupted job", "job", job.Name, "duration", duration)
+	case err != nil:
+		status.Result = domain.JobFailed
+		status.Failures++
+		uc.log().Error("Job failed", "job", job.Name, "duration", duration, "error", err)
+	default:
+		status.Result = domain.JobSucceeded
+		uc.log().Info("Finished job", "job", job.Name, "duration", duration)
+	}
+	return status
+}
+
+// saveStatus saves status; a failure only costs the status, so it is logged rather than returned
+func (uc *DaemonUseCase) saveStatus(status domain.JobStatus) {
+	if err := uc.statuses.SaveJobStatus(status); err != nil {
+		uc.log().Warn("Failed to save job status", "job", status.Name, "error", err)
+	}
+}
+
+// nextJob returns the index of the job due first, the earliest in jobs on ties, or -1 when no job
+// is ever due again
+func nextJob(statuses []domain.JobStatus) int {
+	next := -1
+	for i, status := range statuses {
+		if status.NextRun.IsZero() {
+			continue
+		}
+		if next < 0 || status.NextRun.Before(statuses[next].NextRun) {
+			next = i
+		}
+	}
+	return next
+}
+
+// sleepContext sleeps for d and reports false when ctx was cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockJobStatusStore is a mock implementation for testing
+type MockJobStatusStore struct {
+	statuses map[string]domain.JobStatus
+}
+
+func (m *MockJobStatusStore) LoadJobStatuses() (map[string]domain.JobStatus, error) {
+	statuses := make(map[string]domain.JobStatus)
+	for name, status := range m.statuses {
+		statuses[name] = status
+	}
+	return statuses, nil
+}
+
+func (m *MockJobStatusStore) SaveJobStatus(status domain.JobStatus) error {
+	if m.statuses == nil {
+		m.statuses = make(map[string]domain.JobStatus)
+	}
+	m.statuses[status.Name] = status
+	return nil
+}
+
+func TestDaemonUseCase_Run(t *testing.T) {
+	mustSchedule := func(spec string) domain.Schedule {
+		schedule, err := domain.ParseSchedule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schedule
+	}
+	jobs := []domain.DaemonJob{
+		{Name: "sync", Schedule: mustSchedule("@every 1h"), Command: []string{"sync", "run"}},
+		{Name: "magic", Schedule: mustSchedule("30 * * * *"), Command: []string{"magic", "apply"}},
+	}
+	store := &MockJobStatusStore{statuses: map[string]domain.JobStatus{"sync": {Name: "sync", Runs: 5}}}
+	useCase := NewDaemonUseCase(store)
+	clock := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	useCase.now = func() time.Time { return clock }
+	useCase.wait = func(ctx context.Context, d time.Duration) bool {
+		clock = clock.Add(d)
+		return ctx.Err() == nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ran []string
+	err := useCase.Run(ctx, jobs, time.UTC, func(ctx context.Context, job domain.DaemonJob) error {
+		ran = append(ran, job.Name+"@"+clock.Format("15:04"))
+		clock = clock.Add(10 * time.Minute)
+		switch {
+		case len(ran) == 4:
+			cancel()
+			return ctx.Err()
+		case job.Name == "magic":
+			return errors.New("rules file is missing")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []string{"magic@00:30", "sync@01:00", "magic@01:30", "sync@02:10"}
+	if len(ran) != len(want) {
+		t.Fatalf("Expected runs %v, got %v", want, ran)
+	}
+	for i := range want {
+		if ran[i] != want[i] {
+			t.Errorf("Expected runs %v, got %v", want, ran)
+			break
+		}
+	}
+
+	sync, magic := store.statuses["sync"], store.statuses["magic"]
+	if sync.Runs != 7 || sync.Result != domain.JobInterrupted || !sync.NextRun.IsZero() {
+		t.Errorf("Expected sync to be interrupted on its 7th run without a next run, got %+v", sync)
+	}
+	if magic.Runs != 2 || magic.Failures != 2 || magic.Result != domain.JobFailed || magic.Error != "rules file is missing" {
+		t.Errorf("Expected magic to have failed twice, got %+v", magic)
+	}
+	if magic.Schedule != "30 * * * *" {
+		t.Errorf("Expected the schedule to be saved, got %q", magic.Schedule)
+	}
+}
+
+func TestDaemonUseCase_RunWithoutJobs(t *testing.T) {
+	useCase := NewDaemonUseCase(&MockJobStatusStore{})
+
+	err := useCase.Run(context.Background(), nil, time.UTC, nil)
+
+	if !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an invalid argument error, got %v", err)
+	}
+}
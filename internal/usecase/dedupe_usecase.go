@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DedupeMethod is how media items are compared when looking for duplicates
+type DedupeMethod string
+
+// Duplicate detection methods
+const (
+	// DedupeMetadata compares file names, capture times and dimensions from the index without downloading
+	DedupeMetadata DedupeMethod = "metadata"
+	// DedupeContent compares hashes of the downloaded bytes of items that share dimensions and type
+	DedupeContent DedupeMethod = "content"
+)
+
+var dedupeMethods = []DedupeMethod{DedupeMetadata, DedupeContent}
+
+// ParseDedupeMethod converts a case-insensitive name into a DedupeMethod
+func ParseDedupeMethod(s string) (DedupeMethod, error) {
+	for _, m := range dedupeMethods {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown dedupe method %q, expected metadata or content", s)
+}
+
+// copySuffix matches the " (1)" or "-copy" endings added to file names of copies
+var copySuffix = regexp.MustCompile(`(\s*\(\d+\)|[-_ ]copy(\s*\d+)?)$`)
+
+// DedupeOptions configures a duplicate search
+type DedupeOptions struct {
+	Method DedupeMethod
+	// Workers is the number of concurrent downloads for content hashing; values below 1 use the default
+	Workers int
+}
+
+// DuplicateGroup is a set of media items that are likely copies of each other
+type DuplicateGroup struct {
+	// Key is what the items have in common: a metadata fingerprint or a content hash
+	Key   string             `json:"key"`
+	Items []domain.MediaItem `json:"items"`
+}
+
+// DedupeUseCase implements the business logic for finding duplicate media items in the local index.
+// The API cannot delete media items, so duplicates chosen for removal are collected in an album
+// where they can be reviewed and deleted in Google Photos.
+type DedupeUseCase struct {
+	logging
+
+	index     domain.IndexRepository
+	mediaRepo domain.MediaItemRepository
+	albums    *AlbumUseCase
+	hashes    domain.ImageHashRepository
+}
+
+// NewDedupeUseCase creates a new instance of DedupeUseCase
+func NewDedupeUseCase(index domain.IndexRepository, mediaRepo domain.MediaItemRepository, albumRepo domain.AlbumRepository) *DedupeUseCase {
+	return &DedupeUseCase{
+		index:     index,
+		mediaRepo: mediaRepo,
+		albums:    NewAlbumUseCase(albumRepo),
+	}
+}
+
+// SetLogger replaces the logger the use case and the use case it builds on report to
+func (uc *DedupeUseCase) SetLogger(logger *slog.Logger) {
+	uc.logging.SetLogger(logger)
+	uc.albums.SetLogger(logger)
+}
+
+// Close releases the index
+func (uc *DedupeUseCase) Close() error {
+	return uc.index.Close()
+}
+
+// FindDuplicates groups the indexed media items that are likely duplicates, largest groups first
+func (uc *DedupeUseCase) FindDuplicates(ctx context.Context, opts DedupeOptions) ([]DuplicateGroup, error) {
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Comparing indexed media items", "media_items", len(snapshot.MediaItems), "method", opts.Method)
+
+	var groups []DuplicateGroup
+	switch opts.Method {
+	case DedupeMetadata, "":
+		groups = groupMediaItems(snapshot.MediaItems, metadataFingerprint)
+	case DedupeContent:
+		groups, err = uc.groupByContent(ctx, snapshot.MediaItems, opts.Workers)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown dedupe method %q", opts.Method)
+	}
+
+	uc.log().Info("Found groups of likely duplicates", "groups", len(groups))
+	return groups, nil
+}
+
+// CollectForReview adds media items to a new app-created album so they can be reviewed and deleted
+// in Google Photos. Only media items created by this app can be added to it.
+func (uc *DedupeUseCase) CollectForReview(ctx context.Context, title string, mediaItemIDs []string) (*domain.Album, error) {
+	album, err := uc.albums.CreateAlbum(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.albums.AddMediaItems(ctx, album.ID, mediaItemIDs); err != nil {
+		return album, err
+	}
+	return album, nil
+}
+
+// groupByContent hashes the bytes of every media item that shares its type and dimensions with
+// another one, since only those can be identical, and groups the items by hash. Items that fail
+// to download are left out of the comparison.
+func (uc *DedupeUseCase) groupByContent(ctx context.Context, items []domain.MediaItem, workers int) ([]DuplicateGroup, error) {
+	var candidates []domain.MediaItem
+	for _, group := range groupMediaItems(items, shapeFingerprint) {
+		candidates = append(candidates, group.Items...)
+	}
+
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	uc.log().Info("Hashing media items that share type and dimensions", "candidates", len(candidates))
+
+	hashes := make([]string, len(candidates))
+	var done atomic.Int64
+	runConcurrently(ctx, len(candidates), workers, func(i int) {
+		hash, err := uc.contentHash(candidates[i])
+		if err != nil {
+			uc.log().Warn("Failed to hash media item", "media_item_id", candidates[i].ID, "error", err)
+			return
+		}
+		hashes[i] = hash
+		if n := done.Add(1); n%100 == 0 {
+			uc.log().Info("Hashed media items", "done", n, "candidates", len(candidates))
+		}
+	}, func(i int, err error) {})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]string, len(candidates))
+	for i, item := range candidates {
+		byID[item.ID] = hashes[i]
+	}
+	return groupMediaItems(candidates, func(item domain.MediaItem) string {
+		return byID[item.ID]
+	}), nil
+}
+
+// contentHash downloads a media item and returns the SHA-256 of its bytes
+func (uc *DedupeUseCase) contentHash(item domain.MediaItem) (string, error) {
+	content, err := uc.mediaRepo.DownloadMediaItem(item, domain.ImageSize{})
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// groupMediaItems groups items by the key fingerprint returns, ignoring empty keys, and keeps the
+// groups with more than one item. Items are ordered oldest first, so the original usually comes first.
+func groupMediaItems(items []domain.MediaItem, fingerprint func(domain.MediaItem) string) []DuplicateGroup {
+	byKey := make(map[string][]domain.MediaItem)
+	for _, item := range items {
+		if key := fingerprint(item); key != "" {
+			byKey[key] = append(byKey[key], item)
+		}
+	}
+
+	var groups []DuplicateGroup
+	for key, members := range byKey {
+		if len(members) < 2 {
+			continue
+		}
+		slices.SortFunc(members, func(a, b domain.MediaItem) int {
+			return cmp.Or(creationTime(a).Compare(creationTime(b)), cmp.Compare(a.ID, b.ID))
+		})
+		groups = append(groups, DuplicateGroup{Key: key, Items: members})
+	}
+
+	slices.SortFunc(groups, func(a, b DuplicateGroup) int {
+		return cmp.Or(cmp.Compare(len(b.Items), len(a.Items)), cmp.Compare(a.Key, b.Key))
+	})
+	return groups
+}
+
+// metadataFingerprint identifies a media item by its file name without copy suffixes, capture
+// time and dimensions; items without a capture time cannot be compared
+func metadataFingerprint(item domain.MediaItem) string {
+	if item.MediaMetadata == nil || item.MediaMetadata.CreationTime.IsZero() {
+		return ""
+	}
+
+	name := strings.ToLower(item.Filename)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = copySuffix.ReplaceAllString(name, "")
+
+	m := item.MediaMetadata
+	return fmt.Sprintf("%s|%s|%dx%d", name, m.CreationTime.UTC().Format(time.RFC3339Nano), m.Width, m.Height)
+}
+
+// shapeFingerprint identifies the type and dimensions of a media item, which identical files share
+func shapeFingerprint(item domain.MediaItem) string {
+	if item.MediaMetadata == nil || item.MediaMetadata.Width == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s|%dx%d", item.MimeType, item.MediaMetadata.Width, item.MediaMetadata.Height)
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func photo(id, filename string, created time.Time, width, height int64) domain.MediaItem {
+	return domain.MediaItem{
+		ID:            id,
+		Filename:      filename,
+		MimeType:      "image/jpeg",
+		BaseURL:       "https://photos.example/" + id,
+		MediaMetadata: &domain.MediaMetadata{CreationTime: created, Width: width, Height: height},
+	}
+}
+
+func TestDedupeUseCase_FindDuplicatesByMetadata(t *testing.T) {
+	taken := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{
+		MediaItems: []domain.MediaItem{
+			photo("m1", "IMG_0001.JPG", taken, 4000, 3000),
+			photo("m2", "IMG_0001 (1).jpg", taken, 4000, 3000),
+			photo("m3", "img_0001-copy.jpg", taken, 4000, 3000),
+			photo("m4", "IMG_0001.jpg", taken, 2000, 1500),
+			photo("m5", "IMG_0002.jpg", taken, 4000, 3000),
+			{ID: "m6", Filename: "IMG_0001.jpg"},
+		},
+		UpdatedAt: time.Now(),
+	}}
+	uc := NewDedupeUseCase(index, &MockMediaItemRepository{}, &MockAlbumRepository{})
+
+	groups, err := uc.FindDuplicates(context.Background(), DedupeOptions{Method: DedupeMetadata})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Items) != 3 {
+		t.Fatalf("Expected one group of 3, got %+v", groups)
+	}
+	for i, id := range []string{"m1", "m2", "m3"} {
+		if groups[0].Items[i].ID != id {
+			t.Errorf("Expected item %d to be %s, got %s", i, id, groups[0].Items[i].ID)
+		}
+	}
+}
+
+func TestDedupeUseCase_FindDuplicatesByContent(t *testing.T) {
+	taken := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	items := []domain.MediaItem{
+		photo("m1", "a.jpg", taken, 100, 100),
+		photo("m2", "b.jpg", taken.Add(time.Hour), 100, 100),
+		photo("m3", "c.jpg", taken, 100, 100),
+		photo("m4", "d.jpg", taken, 50, 50),
+	}
+	mediaRepo := &MockMediaItemRepository{
+		items: items,
+		files: map[string]string{
+			"https://photos.example/m1=d": "same",
+			"https://photos.example/m2=d": "same",
+			"https://photos.example/m3=d": "different",
+			"https://photos.example/m4=d": "same",
+		},
+	}
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{MediaItems: items, UpdatedAt: time.Now()}}
+	uc := NewDedupeUseCase(index, mediaRepo, &MockAlbumRepository{})
+
+	groups, err := uc.FindDuplicates(context.Background(), DedupeOptions{Method: DedupeContent, Workers: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(groups) != 1 || len(groups[0].Items) != 2 || groups[0].Items[0].ID != "m1" || groups[0].Items[1].ID != "m2" {
+		t.Fatalf("Expected m1 and m2 to be grouped, got %+v", groups)
+	}
+	// m4 has other dimensions, so it is never downloaded
+	if len(mediaRepo.downloads) != 3 {
+		t.Errorf("Expected 3 downloads, got %v", mediaRepo.downloads)
+	}
+}
+
+func TestParseDedupeMethod(t *testing.T) {
+	if got, err := ParseDedupeMethod("Content"); err != nil || got != DedupeContent {
+		t.Errorf("Expected content, got %q (%v)", got, err)
+	}
+	if _, err := ParseDedupeMethod("pixels"); err == nil {
+		t.Error("Expected an unknown method to be rejected")
+	}
+}
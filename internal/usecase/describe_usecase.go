@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// maxDescriptionLength is the longest description the API accepts, in characters
+const maxDescriptionLength = 1000
+
+// DescribeOptions configures setting the descriptions of many media items at once
+type DescribeOptions struct {
+	// Template is a text/template executed for every media item with DescriptionData; a template
+	// without actions sets the same text on all of them, and an empty one clears the descriptions
+	Template string
+	// OnlyEmpty leaves media items that already have a description alone
+	OnlyEmpty bool
+	// DryRun reports the descriptions without changing anything
+	DryRun bool
+	// TimeZone is the zone capture times are shown in; nil keeps the UTC the API reports
+	TimeZone *time.Location
+	// Workers is the number of media items updated at a time; values below 1 use the default
+	Workers int
+}
+
+// DescriptionData is what description templates see of a media item
+type DescriptionData struct {
+	// Filename is the file name of the media item and Name the same without its extension
+	Filename string
+	Name     string
+	// Created is the creation time of the media item in the configured zone, or the capture time
+	// from the EXIF data of the file when uploading; the zero time when unknown. Format it with
+	// {{.Created.Format "2006-01-02"}}.
+	Created time.Time
+	// Camera is the make and model of the camera, if known
+	Camera string
+	// Location is where the photo was taken according to its EXIF data, which only uploads see;
+	// nil when unknown. It prints as "latitude,longitude".
+	Location *domain.GeoPoint
+	// Description is the description the media item has now
+	Description string
+}
+
+// DescribeResult is the outcome of setting the description of one media item
+type DescribeResult struct {
+	MediaItemID string `json:"mediaItemId"`
+	Filename    string `json:"filename,omitempty"`
+	Description string `json:"description"`
+	Previous    string `json:"previous,omitempty"`
+	// Status is updated, unchanged, skipped (a description exists and only empty ones were asked
+	// for), planned (dry run) or failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DescribeUseCase edits the descriptions of app-created media items
+type DescribeUseCase struct {
+	logging
+	tracing
+
+	mediaRepo domain.MediaItemRepository
+}
+
+// NewDescribeUseCase creates a new instance of DescribeUseCase
+func NewDescribeUseCase(mediaRepo domain.MediaItemRepository) *DescribeUseCase {
+	return &DescribeUseCase{
+		mediaRepo: mediaRepo,
+	}
+}
+
+// DescribeMediaItems sets the description of every media item with the given IDs, or of every
+// media item of albumID, to opts.Template executed for the item. Failures of single items are
+// reported in their result.
+func (uc *DescribeUseCase) DescribeMediaItems(ctx context.Context, ids []string, albumID string, opts DescribeOptions) (results []DescribeResult, err error) {
+	ctx, span := uc.trace(ctx, "media.describe_all", "album_id", albumID, "media_items", len(ids))
+	defer func() { span.End(err) }()
+
+	if (len(ids) == 0) == (albumID == "") {
+		return nil, fmt.Errorf("%w: either media item ids or an album id is required", domain.ErrInvalidArgument)
+	}
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(opts.Template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid description template: %v", domain.ErrInvalidArgument, err)
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	items, err := uc.describedItems(ctx, ids, albumID)
+	if err != nil {
+		return nil, err
+	}
+	uc.log().Info("Describing media items", "media_items", len(items), "dry_run", opts.DryRun)
+
+	results = make([]DescribeResult, len(items))
+	runConcurrently(ctx, len(items), workers, func(i int) {
+		results[i] = uc.describeItem(items[i], tmpl, opts)
+	}, func(i int, err error) {
+		results[i] = DescribeResult{MediaItemID: items[i].ID, Filename: items[i].Filename, Status: "failed", Error: err.Error()}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// describedItems fetches the media items with the given IDs, or those of albumID
+func (uc *DescribeUseCase) describedItems(ctx context.Context, ids []string, albumID string) ([]domain.MediaItem, error) {
+	if albumID != "" {
+		return collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItems(albumID, req)
+		}))
+	}
+
+	results, err := uc.mediaRepo.GetMediaItems(uniqueIDs(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media items: %w", err)
+	}
+	items := make([]domain.MediaItem, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			return nil, fmt.Errorf("media item %s: %w", result.ID, result.Err)
+		}
+		items[i] = *result.MediaItem
+	}
+	return items, nil
+}
+
+// describeItem renders the description of one media item and sets it unless it would not change
+func (uc *DescribeUseCase) describeItem(item domain.MediaItem, tmpl *template.Template, opts DescribeOptions) DescribeResult {
+	result := DescribeResult{MediaItemID: item.ID, Filename: item.Filename, Previous: item.Description}
+	if opts.OnlyEmpty && item.Description != "" {
+		result.Description, result.Status = item.Description, "skipped"
+		return result
+	}
+
+	var b strings.Builder
+	err := tmpl.Execute(&b, descriptionData(item, opts.TimeZone))
+	if err == nil {
+		result.Description = strings.TrimSpace(b.String())
+		err = validateDescription(result.Description)
+	}
+	switch {
+	case err != nil:
+	case result.Description == item.Description:
+		result.Status = "unchanged"
+		return result
+	case opts.DryRun:
+		result.Status = "planned"
+		return result
+	default:
+		_, err = uc.mediaRepo.UpdateMediaItemDescription(item.ID, result.Description)
+	}
+	if err != nil {
+		uc.log().Warn("Failed to describe media item", "media_item_id", item.ID, "error", err)
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+	result.Status = "updated"
+	return result
+}
+
+// descriptionData collects what description templates see of item
+func descriptionData(item domain.MediaItem, loc *time.Location) DescriptionData {
+	data := DescriptionData{
+		Filename:    item.Filename,
+		Name:        strings.TrimSuffix(item.Filename, path.Ext(item.Filename)),
+		Created:     creationTimeIn(item, loc),
+		Description: item.Description,
+	}
+	if item.MediaMetadata != nil && item.MediaMetadata.Photo != nil {
+		photo := item.MediaMetadata.Photo
+		data.Camera = strings.TrimSpace(photo.CameraMake + " " + photo.CameraModel)
+	}
+	return data
+}
+
+// validateDescription rejects descriptions the API would refuse
+func validateDescription(description string) error {
+	if n := utf8.RuneCountInString(description); n > maxDescriptionLength {
+		return fmt.Errorf("%w: description is %d characters long, at most %d are allowed", domain.ErrInvalidArgument, n, maxDescriptionLength)
+	}
+	return nil
+}
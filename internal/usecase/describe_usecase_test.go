@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestDescribeUseCase_DescribeMediaItems(t *testing.T) {
+	taken := time.Date(2024, 7, 1, 23, 30, 0, 0, time.UTC)
+	items := []domain.MediaItem{
+		{ID: "m1", Filename: "IMG_0001.jpg", MediaMetadata: &domain.MediaMetadata{CreationTime: taken, Photo: &domain.PhotoMetadata{CameraMake: "Canon", CameraModel: "EOS R6"}}},
+		{ID: "m2", Filename: "IMG_0002.jpg", Description: "Sunset"},
+		{ID: "m3", Filename: "scan.png", Description: "scan"},
+	}
+	mediaRepo := &MockMediaItemRepository{items: items}
+	useCase := NewDescribeUseCase(mediaRepo)
+	tz, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	results, err := useCase.DescribeMediaItems(context.Background(), nil, "a1", DescribeOptions{
+		Template:  `{{.Name}}{{if not .Created.IsZero}} on {{.Created.Format "2006-01-02"}}{{end}}{{with .Camera}} ({{.}}){{end}}`,
+		OnlyEmpty: true,
+		TimeZone:  tz,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := map[string]string{"m1": "updated", "m2": "skipped", "m3": "skipped"}
+	for _, result := range results {
+		if result.Status != want[result.MediaItemID] {
+			t.Errorf("Expected %s to be %s, got %+v", result.MediaItemID, want[result.MediaItemID], result)
+		}
+	}
+	if got := mediaRepo.descriptions["m1"]; got != "IMG_0001 on 2024-07-02 (Canon EOS R6)" {
+		t.Errorf("Expected the capture date in the time zone, got %q", got)
+	}
+	if len(mediaRepo.descriptions) != 1 {
+		t.Errorf("Expected only m1 to be updated, got %v", mediaRepo.descriptions)
+	}
+
+	// A dry run by ID changes nothing, and descriptions that stay the same are not sent
+	results, err = useCase.DescribeMediaItems(context.Background(), []string{"m3", "m2"}, "", DescribeOptions{Template: "scan", DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 || results[0].Status != "unchanged" || results[1].Status != "planned" || results[1].Previous != "Sunset" {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if len(mediaRepo.descriptions) != 1 {
+		t.Errorf("Expected a dry run to change nothing, got %v", mediaRepo.descriptions)
+	}
+
+	results, err = useCase.DescribeMediaItems(context.Background(), []string{"m2"}, "", DescribeOptions{Template: strings.Repeat("x", 1001)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results[0].Status != "failed" {
+		t.Errorf("Expected a description over 1000 characters to fail, got %+v", results[0])
+	}
+
+	if _, err := useCase.DescribeMediaItems(context.Background(), []string{"missing"}, "", DescribeOptions{}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected an unknown media item to be reported, got %v", err)
+	}
+	if _, err := useCase.DescribeMediaItems(context.Background(), []string{"m1"}, "", DescribeOptions{Template: "{{.Nope"}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an invalid template to be rejected, got %v", err)
+	}
+}
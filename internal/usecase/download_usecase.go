@@ -0,0 +1,261 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// defaultDownloadWorkers is the number of concurrent downloads used when none is configured
+const defaultDownloadWorkers = 4
+
+// DownloadOptions configures where and how media items are downloaded
+type DownloadOptions struct {
+	// Dir is the directory files are written to; it is created when missing
+	Dir string
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// MaxWidth and MaxHeight scale photos down to fit; zero keeps the original size
+	MaxWidth  int
+	MaxHeight int
+}
+
+// DownloadResult is the outcome of downloading a single media item
+type DownloadResult struct {
+	MediaItemID string `json:"mediaItemId"`
+	Path        string `json:"path,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	// Exists is set when the target file was already present and left untouched
+	Exists bool   `json:"exists,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DownloadUseCase implements the business logic for downloading media items to disk
+type DownloadUseCase struct {
+	logging
+	tracing
+	cleanup
+
+	repo       domain.MediaItemRepository
+	albums     domain.AlbumRepository
+	throughput domain.ThroughputStore
+	progress   domain.Progress
+}
+
+// NewDownloadUseCase creates a new instance of DownloadUseCase
+func NewDownloadUseCase(repo domain.MediaItemRepository) *DownloadUseCase {
+	return &DownloadUseCase{
+		repo: repo,
+	}
+}
+
+// SetThroughputStore keeps the download speed across runs, so the remaining time of a resumed
+// download is estimated from the start; nil estimates every run from scratch
+func (uc *DownloadUseCase) SetThroughputStore(store domain.ThroughputStore) {
+	uc.throughput = store
+}
+
+// SetProgress reports the progress of downloads to progress; nil reports it nowhere
+func (uc *DownloadUseCase) SetProgress(progress domain.Progress) {
+	uc.progress = progress
+}
+
+// DownloadItem downloads a single media item into opts.Dir
+func (uc *DownloadUseCase) DownloadItem(ctx context.Context, mediaItemID string, opts DownloadOptions) (results []DownloadResult, err error) {
+	ctx, span := uc.trace(ctx, "download.item", "media_item_id", mediaItemID)
+	defer func() { span.End(err) }()
+
+	if mediaItemID == "" {
+		return nil, fmt.Errorf("media item id is required")
+	}
+
+	uc.log().Info("Fetching media item", "media_item_id", mediaItemID)
+
+	item, err := uc.repo.GetMediaItem(mediaItemID)
+	if err != nil {
+		uc.log().Error("Failed to fetch media item", "media_item_id", mediaItemID, "error", err)
+		return nil, err
+	}
+
+	return uc.download(ctx, []domain.MediaItem{*item}, opts)
+}
+
+// DownloadItems downloads the media items with the given IDs into opts.Dir, fetching them in as
+// few batch requests as possible. Items that cannot be fetched or downloaded are reported in their
+// result, which follow the order of ids.
+func (uc *DownloadUseCase) DownloadItems(ctx context.Context, ids []string, opts DownloadOptions) (results []DownloadResult, err error) {
+	ctx, span := uc.trace(ctx, "download.items", "media_items", len(ids))
+	defer func() { span.End(err) }()
+
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("media item ids are required")
+	}
+
+	uc.log().Info("Fetching media items", "media_items", len(ids))
+
+	fetched, err := uc.repo.GetMediaItems(ids)
+	if err != nil {
+		uc.log().Error("Failed to fetch media items", "error", err)
+		return nil, err
+	}
+
+	results = make([]DownloadResult, len(fetched))
+	var items []domain.MediaItem
+	var at []int
+	for i, result := range fetched {
+		if result.Err != nil {
+			uc.log().Warn("Failed to fetch media item", "media_item_id", result.ID, "error", result.Err)
+			results[i] = DownloadResult{MediaItemID: result.ID, Error: result.Err.Error()}
+			continue
+		}
+		items = append(items, *result.MediaItem)
+		at = append(at, i)
+	}
+
+	downloaded, err := uc.download(ctx, items, opts)
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range downloaded {
+		results[at[j]] = result
+	}
+	return results, nil
+}
+
+// DownloadAlbum downloads every media item of an album into opts.Dir. Failures of individual
+// items are reported in the results rather than aborting; cancelling ctx stops starting new downloads.
+func (uc *DownloadUseCase) DownloadAlbum(ctx context.Context, albumID string, opts DownloadOptions) (results []DownloadResult, err error) {
+	ctx, span := uc.trace(ctx, "download.album", "album_id", albumID)
+	defer func() { span.End(err) }()
+
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+
+	uc.log().Info("Fetching media items of album", "album_id", albumID)
+
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	items, err := collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.repo.SearchMediaItems(albumID, req)
+	}))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully fetched media items", "media_items", len(items))
+	return uc.download(ctx, items, opts)
+}
+
+// download writes items to opts.Dir under their original file names
+func (uc *DownloadUseCase) download(ctx context.Context, items []domain.MediaItem, opts DownloadOptions) ([]DownloadResult, error) {
+	return uc.downloadAs(ctx, items, downloadFileNames(items), opts)
+}
+
+// downloadAs writes each item to opts.Dir under the file name at the same index through a pool
+// of workers and reports progress and the remaining time as each one finishes
+func (uc *DownloadUseCase) downloadAs(ctx context.Context, items []domain.MediaItem, names []string, opts DownloadOptions) ([]DownloadResult, error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	results := make([]DownloadResult, len(items))
+	for i, item := range items {
+		results[i] = DownloadResult{MediaItemID: item.ID, Path: filepath.Join(opts.Dir, names[i])}
+	}
+
+	progress := newProgressTracker(uc.throughput, uc.progress, domain.JobDownload, len(items), uc.log())
+	defer progress.close()
+	runConcurrently(ctx, len(items), workers, func(i int) {
+		uc.downloadItem(ctx, items[i], domain.ImageSize{Width: opts.MaxWidth, Height: opts.MaxHeight}, &results[i])
+		if results[i].Error != "" {
+			uc.log().Warn("Failed to download", "media_item_id", items[i].ID, "path", results[i].Path, "error", results[i].Error)
+		}
+		progress.finish(results[i].Path, results[i].Bytes, results[i].Error != "", results[i].Exists)
+	}, func(i int, err error) {
+		results[i].Error = err.Error()
+	})
+
+	return results, nil
+}
+
+// downloadItem streams one media item scaled to size to result.Path. The file is written under a temporary
+// name first, so an interrupted download never leaves a truncated file that looks complete.
+func (uc *DownloadUseCase) downloadItem(ctx context.Context, item domain.MediaItem, size domain.ImageSize, result *DownloadResult) {
+	_, span := uc.trace(ctx, "download.file", "media_item_id", item.ID)
+	defer func() { span.End(resultError(result.Error)) }()
+
+	if _, err := os.Stat(result.Path); err == nil {
+		result.Exists = true
+		return
+	}
+
+	content, err := uc.repo.DownloadMediaItem(item, size)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	defer content.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(result.Path), ".download-*")
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create file: %v", err)
+		return
+	}
+	defer uc.onExit("remove "+tmp.Name(), removeAll(tmp.Name()))()
+
+	n, err := io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to write file: %v", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), result.Path); err != nil {
+		result.Error = fmt.Sprintf("failed to save file: %v", err)
+		return
+	}
+	result.Bytes = n
+}
+
+// downloadFileNames picks a file name for each item: its original file name, made unique with a
+// numeric suffix when several items share one. Names that could escape the directory fall back to the ID.
+func downloadFileNames(items []domain.MediaItem) []string {
+	return uniqueFileNames(items, make(map[string]bool, len(items)))
+}
+
+// uniqueFileNames works like downloadFileNames but also avoids the lower-cased names in used,
+// and adds the names it picks to used
+func uniqueFileNames(items []domain.MediaItem, used map[string]bool) []string {
+	names := make([]string, len(items))
+
+	for i, item := range items {
+		name := filepath.Base(item.Filename)
+		if item.Filename == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+			name = item.ID
+		}
+
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for n := 1; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		}
+
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
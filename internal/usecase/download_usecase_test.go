@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestDownloadUseCase_DownloadAlbum(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "existing.jpg"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			{ID: "1", Filename: "beach.jpg", BaseURL: "https://img/1", MimeType: "image/jpeg"},
+			{ID: "2", Filename: "beach.jpg", BaseURL: "https://img/2", MimeType: "image/jpeg"},
+			{ID: "3", Filename: "clip.mp4", BaseURL: "https://img/3", MimeType: "video/mp4"},
+			{ID: "4", Filename: "existing.jpg", BaseURL: "https://img/4"},
+			{ID: "5", Filename: "../escape.jpg", BaseURL: "https://img/5"},
+			{ID: "6", Filename: "gone.jpg", BaseURL: "https://img/6"},
+		},
+		files: map[string]string{
+			"https://img/1=d":  "one",
+			"https://img/2=d":  "two",
+			"https://img/3=dv": "video",
+			"https://img/5=d":  "five",
+		},
+	}
+	useCase := NewDownloadUseCase(repo)
+
+	results, err := useCase.DownloadAlbum(context.Background(), "album", DownloadOptions{Dir: dir, Workers: 3})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := map[string]string{
+		"beach.jpg":     "one",
+		"beach (1).jpg": "two",
+		"clip.mp4":      "video",
+		"existing.jpg":  "old",
+		"escape.jpg":    "five",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q (%v)", name, content, data, err)
+		}
+	}
+	if !results[3].Exists || slices.Contains(repo.downloads, "https://img/4=d") {
+		t.Errorf("Expected existing files to be skipped without downloading, got %+v", results[3])
+	}
+	if results[5].Error == "" {
+		t.Error("Expected the failed download to be reported")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file for the failed download, got %v", err)
+	}
+}
+
+func TestDownloadUseCase_DownloadItemScalesPhotos(t *testing.T) {
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{{ID: "1", Filename: "a.jpg", BaseURL: "https://img/1"}},
+		files: map[string]string{"https://img/1=w800-h600": "small"},
+	}
+	useCase := NewDownloadUseCase(repo)
+
+	results, err := useCase.DownloadItem(context.Background(), "1", DownloadOptions{Dir: t.TempDir(), MaxWidth: 800, MaxHeight: 600})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0].Error != "" || results[0].Bytes != 5 {
+		t.Errorf("Expected the scaled photo to be downloaded, got %+v", results)
+	}
+}
+
+func TestDownloadUseCase_DownloadItemsReportsMissingItems(t *testing.T) {
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			{ID: "1", Filename: "a.jpg", BaseURL: "https://img/1"},
+			{ID: "2", Filename: "b.jpg", BaseURL: "https://img/2"},
+		},
+		files: map[string]string{"https://img/1=d": "a", "https://img/2=d": "bb"},
+	}
+	useCase := NewDownloadUseCase(repo)
+
+	results, err := useCase.DownloadItems(context.Background(), []string{"2", "gone", "1"}, DownloadOptions{Dir: t.TempDir()})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", results)
+	}
+	if results[0].MediaItemID != "2" || results[0].Bytes != 2 || results[2].MediaItemID != "1" || results[2].Bytes != 1 {
+		t.Errorf("Expected the found items downloaded in the order asked for, got %+v", results)
+	}
+	if results[1].MediaItemID != "gone" || results[1].Error == "" {
+		t.Errorf("Expected the missing item to be reported, got %+v", results[1])
+	}
+}
@@ -0,0 +1,378 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// EXIF tags holding the date and time a photo was taken, digitized and last changed, and the UTC
+// offsets that go with them
+const (
+	exifTagDateTime          = 0x0132
+	exifTagExifIFD           = 0x8769
+	exifTagDateTimeOriginal  = 0x9003
+	exifTagDateTimeDigitized = 0x9004
+	exifTagOffsetTime        = 0x9010
+	exifTagOffsetOriginal    = 0x9011
+	exifTagOffsetDigitized   = 0x9012
+)
+
+// EXIF tags naming the camera, pointing to the GPS directory, and holding the position within it
+const (
+	exifTagMake        = 0x010F
+	exifTagModel       = 0x0110
+	exifTagGPSIFD      = 0x8825
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	exifKindASCII      = 2
+	exifKindRational   = 5
+)
+
+// exifReadLimit is how much of the start of a file is read for its EXIF data, which comes before
+// the image data in JPEG and in practice in TIFF based files too
+const exifReadLimit = 1 << 20
+
+// exifDateLayout is how EXIF writes dates, without a time zone
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// exifField is an ASCII EXIF value; offset is where its text starts in the file
+type exifField struct {
+	tag    uint16
+	offset int
+	length int
+}
+
+// DateFix corrects the EXIF timestamps of photos, for cameras whose clock was wrong. Timestamps
+// are shifted by Offset first and then moved from the From time zone to the To time zone.
+type DateFix struct {
+	// Offset is added to every timestamp
+	Offset time.Duration
+	// From is the time zone the camera clock was set to and To the one the photos were taken
+	// in; the zone is left alone unless both are set
+	From *time.Location
+	To   *time.Location
+	// Except holds path.Match patterns of files, relative to the upload directory or by base
+	// name, whose timestamps are left as they are
+	Except []string
+	// FileNames find the date of JPEG photos without EXIF data in their file names; an EXIF
+	// segment with that date is added before the other corrections apply
+	FileNames []domain.FilenameDateRule
+}
+
+// shifts reports whether the fix changes existing timestamps rather than only adding missing ones
+func (f DateFix) shifts() bool {
+	return f.Offset != 0 || (f.From != nil && f.To != nil)
+}
+
+// apply returns the corrected wall clock time of t, a time read from EXIF in UTC
+func (f DateFix) apply(t time.Time) time.Time {
+	t = t.Add(f.Offset)
+	if f.From == nil || f.To == nil {
+		return t
+	}
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, f.From)
+	moved := wall.In(f.To)
+	return time.Date(moved.Year(), moved.Month(), moved.Day(), moved.Hour(), moved.Minute(), moved.Second(), 0, time.UTC)
+}
+
+// fixExifDates rewrites the EXIF timestamps of a JPEG or TIFF based file in b, returning when
+// the photo was taken before and after. The dates have a fixed length, so they are replaced in
+// place and the rest of the file is untouched. With a time zone move, the offsets that are
+// present are set to those of the To zone. ok is false when b has no EXIF date.
+func fixExifDates(b []byte, fix DateFix) (taken, corrected time.Time, ok bool, err error) {
+	fields, err := findExifFields(b)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+
+	var offsets []exifField
+	for _, field := range fields {
+		switch field.tag {
+		case exifTagOffsetTime, exifTagOffsetOriginal, exifTagOffsetDigitized:
+			offsets = append(offsets, field)
+			continue
+		}
+
+		text := b[field.offset : field.offset+field.length]
+		t, err := time.Parse(exifDateLayout, string(bytes.TrimRight(text, "\x00 ")))
+		if err != nil {
+			// Unset dates are written as blanks or zeros
+			continue
+		}
+		fixed := fix.apply(t)
+		copy(text, fixed.Format(exifDateLayout))
+
+		// The original date is when the photo was taken; the others stand in when it is missing
+		if !ok || field.tag == exifTagDateTimeOriginal {
+			taken, corrected, ok = t, fixed, true
+		}
+	}
+
+	if ok && fix.From != nil && fix.To != nil {
+		wall := corrected
+		_, offset := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, fix.To).Zone()
+		for _, field := range offsets {
+			if field.length >= len("+00:00") {
+				copy(b[field.offset:], exifOffset(offset))
+			}
+		}
+	}
+	return taken, corrected, ok, nil
+}
+
+// addExifDate returns a copy of the JPEG in b with an EXIF segment holding t as the date the
+// photo was taken, digitized and changed. It returns nil when b is not a JPEG or already has
+// EXIF data, which is never rewritten so nothing in it is lost.
+func addExifDate(b []byte, t time.Time) []byte {
+	if start, err := domain.TIFFStart(b); err != nil || start >= 0 || len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil
+	}
+
+	// A little endian TIFF structure: IFD0 with the change date and a pointer to the EXIF IFD,
+	// which holds the original and digitized dates, each value following its directory
+	date := append([]byte(t.Format(exifDateLayout)), 0)
+	order := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = order.AppendUint32(tiff, 8)
+	entry := func(tag, kind uint16, count, value uint32) {
+		tiff = order.AppendUint16(tiff, tag)
+		tiff = order.AppendUint16(tiff, kind)
+		tiff = order.AppendUint32(tiff, count)
+		tiff = order.AppendUint32(tiff, value)
+	}
+	const ifd0, ifd0Size, exifSize = 8, 2 + 2*12 + 4, 2 + 2*12 + 4
+	exifIFD := ifd0 + ifd0Size + len(date)
+	tiff = order.AppendUint16(tiff, 2)
+	entry(exifTagDateTime, 2, uint32(len(date)), ifd0+ifd0Size)
+	entry(exifTagExifIFD, 4, 1, uint32(exifIFD))
+	tiff = order.AppendUint32(tiff, 0)
+	tiff = append(tiff, date...)
+	tiff = order.AppendUint16(tiff, 2)
+	entry(exifTagDateTimeOriginal, 2, uint32(len(date)), uint32(exifIFD+exifSize))
+	entry(exifTagDateTimeDigitized, 2, uint32(len(date)), uint32(exifIFD+exifSize+len(date)))
+	tiff = order.AppendUint32(tiff, 0)
+	tiff = append(tiff, date...)
+	tiff = append(tiff, date...)
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+6+len(tiff)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+
+	// The segment goes after the JFIF header when there is one, which must come first
+	at := 2
+	for at+4 <= len(b) && b[at] == 0xFF && b[at+1] == 0xE0 {
+		at += 2 + int(binary.BigEndian.Uint16(b[at+2:]))
+	}
+	if at > len(b) {
+		return nil
+	}
+	return slices.Concat(b[:at], segment, b[at:])
+}
+
+// exifOffset formats a UTC offset in seconds the way EXIF writes it, like +09:00
+func exifOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// findExifFields locates the date and offset fields in the EXIF data of a JPEG file or a TIFF
+// based file such as a DNG or most raw formats
+func findExifFields(b []byte) ([]exifField, error) {
+	start, err := domain.TIFFStart(b)
+	if err != nil || start < 0 {
+		return nil, err
+	}
+	tiff := b[start:]
+	order := domain.TIFFByteOrder(tiff)
+	if order == nil {
+		return nil, fmt.Errorf("malformed EXIF data: unknown byte order")
+	}
+
+	var fields []exifField
+	ifds := []uint32{order.Uint32(tiff[4:8])}
+	seen := make(map[uint32]bool)
+	for len(ifds) > 0 {
+		ifd := ifds[0]
+		ifds = ifds[1:]
+		if seen[ifd] {
+			continue
+		}
+		seen[ifd] = true
+
+		if uint64(ifd)+2 > uint64(len(tiff)) {
+			return nil, fmt.Errorf("malformed EXIF data: directory out of range")
+		}
+		count := int(order.Uint16(tiff[ifd:]))
+		if int(ifd)+2+12*count > len(tiff) {
+			return nil, fmt.Errorf("malformed EXIF data: directory out of range")
+		}
+		for i := range count {
+			at := int(ifd) + 2 + 12*i
+			entry := tiff[at:]
+			tag, kind, n := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+			switch tag {
+			case exifTagExifIFD:
+				ifds = append(ifds, order.Uint32(entry[8:]))
+			case exifTagDateTime, exifTagDateTimeOriginal, exifTagDateTimeDigitized,
+				exifTagOffsetTime, exifTagOffsetOriginal, exifTagOffsetDigitized:
+				// Only ASCII values; up to four bytes are stored in the entry itself
+				if kind != 2 {
+					continue
+				}
+				value := uint64(at + 8)
+				if n > 4 {
+					value = uint64(order.Uint32(entry[8:]))
+				}
+				if value+uint64(n) > uint64(len(tiff)) {
+					return nil, fmt.Errorf("malformed EXIF data: value out of range")
+				}
+				fields = append(fields, exifField{tag: tag, offset: start + int(value), length: int(n)})
+			}
+		}
+	}
+	return fields, nil
+}
+
+// readExif returns when, where and with which camera the JPEG or TIFF based photo in b was taken.
+// The result is zero when b has no EXIF data.
+func readExif(b []byte) (domain.ExifData, error) {
+	var data domain.ExifData
+	fields, err := findExifFields(b)
+	if err != nil {
+		return data, err
+	}
+	texts := make(map[uint16]string, len(fields))
+	for _, field := range fields {
+		texts[field.tag] = string(bytes.TrimRight(b[field.offset:field.offset+field.length], "\x00 "))
+	}
+	for _, field := range fields {
+		t, err := time.Parse(exifDateLayout, texts[field.tag])
+		if err != nil {
+			// Offsets, and unset dates written as blanks or zeros
+			continue
+		}
+		// The original date is when the photo was taken; the others stand in when it is missing
+		if data.Taken.IsZero() || field.tag == exifTagDateTimeOriginal {
+			data.Taken = t
+			if offset, err := time.Parse("-07:00", texts[exifOffsetTag(field.tag)]); err == nil {
+				data.Taken = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, offset.Location())
+			}
+		}
+	}
+
+	start, _ := domain.TIFFStart(b)
+	if start < 0 {
+		return data, nil
+	}
+	tiff := b[start:]
+	order := domain.TIFFByteOrder(tiff)
+	if order == nil {
+		return data, nil
+	}
+	ifd0 := exifDirectory(tiff, order, order.Uint32(tiff[4:8]))
+	data.CameraMake = exifString(tiff, order, ifd0[exifTagMake])
+	data.CameraModel = exifString(tiff, order, ifd0[exifTagModel])
+	if entry, ok := ifd0[exifTagGPSIFD]; ok {
+		gps := exifDirectory(tiff, order, order.Uint32(entry[8:]))
+		lat, latOK := exifDegrees(tiff, order, gps[gpsTagLatitude])
+		lng, lngOK := exifDegrees(tiff, order, gps[gpsTagLongitude])
+		if exifString(tiff, order, gps[gpsTagLatitudeRef]) == "S" {
+			lat = -lat
+		}
+		if exifString(tiff, order, gps[gpsTagLongitudeRef]) == "W" {
+			lng = -lng
+		}
+		point := domain.GeoPoint{Latitude: lat, Longitude: lng}
+		// Cameras without a fix write zeros, which is no position anyone took a photo at
+		if latOK && lngOK && point.Validate() == nil && (lat != 0 || lng != 0) {
+			data.Location = &point
+		}
+	}
+	return data, nil
+}
+
+// exifOffsetTag returns the tag of the UTC offset belonging to the date tag
+func exifOffsetTag(tag uint16) uint16 {
+	switch tag {
+	case exifTagDateTimeOriginal:
+		return exifTagOffsetOriginal
+	case exifTagDateTimeDigitized:
+		return exifTagOffsetDigitized
+	}
+	return exifTagOffsetTime
+}
+
+// exifDirectory returns the 12 byte entries of the directory at ifd by tag; a directory out of
+// range has none
+func exifDirectory(tiff []byte, order binary.ByteOrder, ifd uint32) map[uint16][]byte {
+	entries := make(map[uint16][]byte)
+	if uint64(ifd)+2 > uint64(len(tiff)) {
+		return entries
+	}
+	count := uint64(order.Uint16(tiff[ifd:]))
+	if uint64(ifd)+2+12*count > uint64(len(tiff)) {
+		return entries
+	}
+	for i := range count {
+		entry := tiff[uint64(ifd)+2+12*i:][:12]
+		entries[order.Uint16(entry)] = entry
+	}
+	return entries
+}
+
+// exifValue returns the bytes of the value of entry if it is of kind, with the size of each of
+// its components; up to four bytes are stored in the entry itself
+func exifValue(tiff []byte, order binary.ByteOrder, entry []byte, kind uint16, size uint64) ([]byte, bool) {
+	if entry == nil || order.Uint16(entry[2:]) != kind {
+		return nil, false
+	}
+	n := uint64(order.Uint32(entry[4:])) * size
+	if n <= 4 {
+		return entry[8 : 8+n], true
+	}
+	at := uint64(order.Uint32(entry[8:]))
+	if at+n > uint64(len(tiff)) {
+		return nil, false
+	}
+	return tiff[at : at+n], true
+}
+
+// exifString returns the ASCII value of entry, or "" when it has none
+func exifString(tiff []byte, order binary.ByteOrder, entry []byte) string {
+	value, ok := exifValue(tiff, order, entry, exifKindASCII, 1)
+	if !ok {
+		return ""
+	}
+	return string(bytes.TrimSpace(bytes.TrimRight(value, "\x00")))
+}
+
+// exifDegrees returns the degrees, minutes and seconds of a GPS coordinate entry in degrees
+func exifDegrees(tiff []byte, order binary.ByteOrder, entry []byte) (float64, bool) {
+	value, ok := exifValue(tiff, order, entry, exifKindRational, 8)
+	if !ok || len(value) != 24 {
+		return 0, false
+	}
+	degrees := 0.0
+	for i, unit := range []float64{1, 60, 3600} {
+		num, den := order.Uint32(value[8*i:]), order.Uint32(value[8*i+4:])
+		if den == 0 {
+			if num == 0 {
+				continue
+			}
+			return 0, false
+		}
+		degrees += float64(num) / float64(den) / unit
+	}
+	return degrees, true
+}
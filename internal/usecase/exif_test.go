@@ -0,0 +1,224 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// exifJPEG builds a minimal JPEG whose EXIF data holds DateTime, DateTimeOriginal and
+// OffsetTimeOriginal, all set from taken and offset
+func exifJPEG(taken, offset string) []byte {
+	var tiff bytes.Buffer
+	be := binary.BigEndian
+	write := func(v any) { _ = binary.Write(&tiff, be, v) }
+	entry := func(tag, kind uint16, count, value uint32) {
+		write(tag)
+		write(kind)
+		write(count)
+		write(value)
+	}
+
+	tiff.WriteString("MM\x00\x2a")
+	write(uint32(8))
+	// IFD0 at 8 with DateTime at 38 and the Exif IFD at 58
+	write(uint16(2))
+	entry(exifTagDateTime, 2, 20, 38)
+	entry(exifTagExifIFD, 4, 1, 58)
+	write(uint32(0))
+	tiff.WriteString(taken + "\x00")
+	// Exif IFD at 58 with DateTimeOriginal at 88 and OffsetTimeOriginal at 108
+	write(uint16(2))
+	entry(exifTagDateTimeOriginal, 2, 20, 88)
+	entry(exifTagOffsetOriginal, 2, 7, 108)
+	write(uint32(0))
+	tiff.WriteString(taken + "\x00")
+	tiff.WriteString(offset + "\x00")
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	_ = binary.Write(&jpeg, be, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+func TestFixExifDates(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		fix        DateFix
+		want       string
+		wantOffset string
+	}{
+		{name: "offset", fix: DateFix{Offset: -26 * time.Hour}, want: "2024:03:30 22:15:00", wantOffset: "+01:00"},
+		// Berlin is on summer time from 31 March, so 00:15 there is 07:15 in Tokyo
+		{name: "time zone", fix: DateFix{From: berlin, To: tokyo}, want: "2024:04:01 07:15:00", wantOffset: "+09:00"},
+		{name: "offset then time zone", fix: DateFix{Offset: time.Hour, From: tokyo, To: berlin}, want: "2024:03:31 18:15:00", wantOffset: "+02:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := exifJPEG("2024:04:01 00:15:00", "+01:00")
+
+			taken, corrected, ok, err := fixExifDates(b, tt.fix)
+
+			if err != nil || !ok {
+				t.Fatalf("Expected a fixed date, got %v (%v)", ok, err)
+			}
+			if got := taken.Format(exifDateLayout); got != "2024:04:01 00:15:00" {
+				t.Errorf("Expected the original date, got %s", got)
+			}
+			if got := corrected.Format(exifDateLayout); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if n := bytes.Count(b, []byte(tt.want)); n != 2 {
+				t.Errorf("Expected both dates rewritten, found %d", n)
+			}
+			if !bytes.Contains(b, []byte(tt.wantOffset+"\x00")) {
+				t.Errorf("Expected offset %s in %q", tt.wantOffset, b)
+			}
+		})
+	}
+}
+
+func TestFixExifDates_NoExif(t *testing.T) {
+	for _, b := range [][]byte{[]byte("not an image"), {0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}} {
+		if _, _, ok, err := fixExifDates(b, DateFix{Offset: time.Hour}); ok || err != nil {
+			t.Errorf("Expected no date and no error for %q, got %v (%v)", b, ok, err)
+		}
+	}
+
+	// A directory pointing past the end of the data is reported rather than read
+	b := exifJPEG("2024:04:01 00:15:00", "+01:00")
+	binary.BigEndian.PutUint32(b[4+2+6+4:], 1<<20)
+	if _, _, _, err := fixExifDates(b, DateFix{Offset: time.Hour}); err == nil {
+		t.Error("Expected an error for malformed EXIF data")
+	}
+}
+
+func TestAddExifDate(t *testing.T) {
+	taken := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	jfif := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 'J', 'F', 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}
+
+	b := addExifDate(jfif, taken)
+
+	if b == nil {
+		t.Fatal("Expected EXIF data to be added")
+	}
+	// The JFIF header stays first and the image data is kept
+	if !bytes.HasPrefix(b, jfif[:8]) || !bytes.HasSuffix(b, jfif[8:]) || !bytes.Equal(b[8:10], []byte{0xFF, 0xE1}) {
+		t.Errorf("Expected the EXIF segment after the JFIF header, got % X", b)
+	}
+	got, _, ok, err := fixExifDates(b, DateFix{})
+	if err != nil || !ok || !got.Equal(taken) {
+		t.Errorf("Expected %s to be read back, got %s (%v, %v)", taken, got, ok, err)
+	}
+
+	if addExifDate(exifJPEG("2024:04:01 00:15:00", "+01:00"), taken) != nil {
+		t.Error("Expected existing EXIF data to be left alone")
+	}
+	if addExifDate([]byte("not an image"), taken) != nil {
+		t.Error("Expected nothing to be added to other files")
+	}
+}
+
+// gpsJPEG returns a JPEG file with little-endian EXIF data naming the camera and the position
+// lat, lng in degrees, minutes and seconds, but no date
+func gpsJPEG(cameraMake, model string, lat, lng float64) []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	write := func(v any) { _ = binary.Write(&tiff, le, v) }
+	entry := func(tag, kind uint16, count, value uint32) {
+		write(tag)
+		write(kind)
+		write(count)
+		write(value)
+	}
+	ref := func(positive bool, yes, no byte) uint32 {
+		if positive {
+			return uint32(yes)
+		}
+		return uint32(no)
+	}
+
+	// IFD0 at 8 with Make, Model and the GPS IFD, followed by the strings
+	makeAt := uint32(8 + 2 + 3*12 + 4)
+	modelAt := makeAt + uint32(len(cameraMake)+1)
+	gpsAt := modelAt + uint32(len(model)+1)
+	tiff.WriteString("II\x2a\x00")
+	write(uint32(8))
+	write(uint16(3))
+	entry(exifTagMake, exifKindASCII, uint32(len(cameraMake)+1), makeAt)
+	entry(exifTagModel, exifKindASCII, uint32(len(model)+1), modelAt)
+	entry(exifTagGPSIFD, 4, 1, gpsAt)
+	write(uint32(0))
+	tiff.WriteString(cameraMake + "\x00" + model + "\x00")
+	// GPS IFD with the references in the entries and three rationals each for the coordinates
+	latAt := gpsAt + 2 + 4*12 + 4
+	write(uint16(4))
+	entry(gpsTagLatitudeRef, exifKindASCII, 2, ref(lat >= 0, 'N', 'S'))
+	entry(gpsTagLatitude, exifKindRational, 3, latAt)
+	entry(gpsTagLongitudeRef, exifKindASCII, 2, ref(lng >= 0, 'E', 'W'))
+	entry(gpsTagLongitude, exifKindRational, 3, latAt+24)
+	write(uint32(0))
+	for _, v := range []float64{lat, lng} {
+		v = math.Abs(v)
+		degrees, minutes := math.Floor(v), math.Floor(math.Mod(v*60, 60))
+		seconds := math.Round((v*3600 - degrees*3600 - minutes*60) * 1000)
+		write([]uint32{uint32(degrees), 1, uint32(minutes), 1, uint32(seconds), 1000})
+	}
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	_ = binary.Write(&jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+func TestReadExif(t *testing.T) {
+	data, err := readExif(gpsJPEG("Canon", "EOS R6", 48.8584, -2.2945))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data.CameraMake != "Canon" || data.CameraModel != "EOS R6" || !data.Taken.IsZero() {
+		t.Errorf("Expected the camera and no date, got %+v", data)
+	}
+	want := domain.GeoPoint{Latitude: 48.8584, Longitude: -2.2945}
+	if data.Location == nil || data.Location.DistanceKm(want) > 0.01 {
+		t.Errorf("Expected the location %s, got %v", want, data.Location)
+	}
+
+	// The original date wins over the others and carries its UTC offset
+	data, err = readExif(exifJPEG("2024:04:01 00:15:00", "+09:00"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if taken := time.Date(2024, 3, 31, 15, 15, 0, 0, time.UTC); !data.Taken.Equal(taken) || data.Location != nil {
+		t.Errorf("Expected %s without a location, got %+v", taken, data)
+	}
+
+	// Cameras without a GPS fix write zeros
+	if data, err := readExif(gpsJPEG("Canon", "EOS R6", 0, 0)); err != nil || data.Location != nil {
+		t.Errorf("Expected no location for 0,0, got %v (%v)", data.Location, err)
+	}
+	if data, err := readExif([]byte("not an image")); err != nil || !data.IsZero() {
+		t.Errorf("Expected nothing for other files, got %+v (%v)", data, err)
+	}
+}
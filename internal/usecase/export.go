@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// exportManifestVersion is the version of the manifest layout, raised when it changes incompatibly
+const exportManifestVersion = 1
+
+// Entries of an export archive
+const (
+	exportManifestName = "manifest.json"
+	exportMediaDir     = "media"
+)
+
+// ExportOptions configures archiving an album
+type ExportOptions struct {
+	// Out is the archive to write; its extension picks the format: .zip, .tar, .tar.gz or .tgz
+	Out string
+	// Originals adds the original bytes of every media item next to the manifest
+	Originals bool
+	// Workers is the number of originals downloaded at a time; values below 1 use the default
+	Workers int
+}
+
+// ExportManifest describes an exported album. It is written as manifest.json at the root of the
+// archive, so the album can be restored or migrated without Google Photos.
+type ExportManifest struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	Album      domain.Album `json:"album"`
+	// Description heads the album as a text entry when it is restored. The API returns neither
+	// album descriptions nor enrichments, so exports leave it empty; archives migrated from
+	// elsewhere may set it.
+	Description string         `json:"description,omitempty"`
+	MediaItems  []ExportedItem `json:"mediaItems"`
+}
+
+// ExportedItem is a media item of an exported album in album order
+type ExportedItem struct {
+	domain.MediaItem
+	// File is the path of the original inside the archive, empty when originals were not asked
+	// for or the download failed
+	File string `json:"file,omitempty"`
+}
+
+// ExportResult is the outcome of archiving an album
+type ExportResult struct {
+	Path       string       `json:"path"`
+	Album      domain.Album `json:"album"`
+	MediaItems int          `json:"mediaItems"`
+	// Originals counts the media items whose bytes are in the archive
+	Originals int `json:"originals"`
+	// Failed are the originals that could not be downloaded; their items are still in the manifest
+	Failed []DownloadResult `json:"failed,omitempty"`
+	// Bytes is the size of the archive
+	Bytes int64 `json:"bytes"`
+}
+
+// archiveWriter adds files to a zip or tar archive
+type archiveWriter interface {
+	add(name string, size int64, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+// SetAlbumRepository lets the use case read album metadata, which exporting albums needs
+func (uc *DownloadUseCase) SetAlbumRepository(albums domain.AlbumRepository) {
+	uc.albums = albums
+}
+
+// ExportAlbum writes the metadata of an album and its media items, and with opts.Originals their
+// original bytes, to a zip or tar archive at opts.Out. The API returns no enrichments, such as
+// text and map entries, so they cannot be exported. Originals that fail to download are reported
+// and left out; the archive is only written once everything else succeeded.
+func (uc *DownloadUseCase) ExportAlbum(ctx context.Context, albumID string, opts ExportOptions) (result *ExportResult, err error) {
+	ctx, span := uc.trace(ctx, "export.album", "album_id", albumID, "originals", opts.Originals)
+	defer func() { span.End(err) }()
+
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if uc.albums == nil {
+		return nil, errors.New("no album repository configured")
+	}
+	newArchive, err := archiveFormat(opts.Out)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Fetching album", "album_id", albumID)
+	album, err := uc.albums.GetAlbumByID(albumID)
+	if err != nil {
+		uc.log().Error("Failed to fetch album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+	items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.repo.SearchMediaItems(albumID, req)
+	}))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	manifest := ExportManifest{Version: exportManifestVersion, ExportedAt: time.Now().UTC(), Album: *album}
+	result = &ExportResult{Path: opts.Out, Album: *album, MediaItems: len(items)}
+	for _, item := range items {
+		// Base URLs expire within the hour, so they mean nothing in an archive
+		item.BaseURL = ""
+		manifest.MediaItems = append(manifest.MediaItems, ExportedItem{MediaItem: item})
+	}
+
+	var downloads []DownloadResult
+	if opts.Originals {
+		staging, err := os.MkdirTemp(filepath.Dir(opts.Out), ".export-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer uc.onExit("remove "+staging, removeAll(staging))()
+
+		uc.log().Info("Downloading originals", "media_items", len(items))
+		downloads, err = uc.download(ctx, items, DownloadOptions{Dir: staging, Workers: opts.Workers})
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for i, download := range downloads {
+			if download.Error != "" {
+				result.Failed = append(result.Failed, download)
+				continue
+			}
+			manifest.MediaItems[i].File = path.Join(exportMediaDir, filepath.Base(download.Path))
+			result.Originals++
+		}
+	}
+
+	err = writeFile(opts.Out, func(w io.Writer) error {
+		archive := newArchive(w)
+		if err := writeExportManifest(archive, manifest); err != nil {
+			archive.Close()
+			return err
+		}
+		for i, item := range manifest.MediaItems {
+			if item.File == "" {
+				continue
+			}
+			if err := addArchiveFile(archive, item.File, downloads[i].Path, creationTime(item.MediaItem)); err != nil {
+				archive.Close()
+				return err
+			}
+		}
+		return archive.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(opts.Out); err == nil {
+		result.Bytes = info.Size()
+	}
+	uc.log().Info("Exported album", "album_id", albumID, "path", opts.Out, "media_items", len(items), "originals", result.Originals)
+	return result, nil
+}
+
+// archiveFormat returns the archive writer matching the extension of name
+func archiveFormat(name string) (func(io.Writer) archiveWriter, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return func(w io.Writer) archiveWriter { return &zipArchive{zip.NewWriter(w)} }, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return func(w io.Writer) archiveWriter { return &tarArchive{tw: tar.NewWriter(w)} }, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return func(w io.Writer) archiveWriter {
+			gz := gzip.NewWriter(w)
+			return &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: archive %q must end in .zip, .tar, .tar.gz or .tgz", domain.ErrInvalidArgument, name)
+}
+
+// writeExportManifest adds manifest as indented JSON
+func writeExportManifest(archive archiveWriter, manifest ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return archive.add(exportManifestName, int64(len(data)), manifest.ExportedAt, bytes.NewReader(data))
+}
+
+// addArchiveFile adds the file at src as name, dated modTime unless it is unknown
+func addArchiveFile(archive archiveWriter, name, src string, modTime time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+	return archive.add(name, info.Size(), modTime, f)
+}
+
+// zipArchive writes a zip archive. Media files are already compressed, so they are stored as is.
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(name string, size int64, modTime time.Time, content io.Reader) error {
+	method := zip.Store
+	if name == exportManifestName {
+		method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// tarArchive writes a tar archive, gzip compressed when gz is set
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) add(name string, size int64, modTime time.Time, content io.Reader) error {
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Size: size, Mode: 0o644, ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, content)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	err := a.tw.Close()
+	if a.gz != nil {
+		if gzErr := a.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestDownloadUseCase_ExportAlbumZip(t *testing.T) {
+	taken := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			{ID: "1", Filename: "beach.jpg", BaseURL: "https://img/1", MediaMetadata: &domain.MediaMetadata{CreationTime: taken}},
+			{ID: "2", Filename: "beach.jpg", BaseURL: "https://img/2"},
+			{ID: "3", Filename: "gone.jpg", BaseURL: "https://img/3"},
+		},
+		files: map[string]string{"https://img/1=d": "first", "https://img/2=d": "second"},
+	}
+	useCase := NewDownloadUseCase(repo)
+	useCase.SetAlbumRepository(&MockAlbumRepository{albums: []domain.Album{{ID: "a1", Title: "Summer"}}})
+	out := filepath.Join(t.TempDir(), "summer.zip")
+
+	result, err := useCase.ExportAlbum(context.Background(), "a1", ExportOptions{Out: out, Originals: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.MediaItems != 3 || result.Originals != 2 || len(result.Failed) != 1 || result.Failed[0].MediaItemID != "3" {
+		t.Errorf("Expected 2 of 3 originals exported, got %+v", result)
+	}
+
+	archive, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got %v", err)
+	}
+	defer archive.Close()
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	if files["media/beach.jpg"] != "first" || files["media/beach (1).jpg"] != "second" || len(files) != 3 {
+		t.Errorf("Expected the manifest and two originals, got %v", files)
+	}
+
+	var manifest ExportManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("Expected a JSON manifest, got %v", err)
+	}
+	if manifest.Version != exportManifestVersion || manifest.Album.Title != "Summer" || len(manifest.MediaItems) != 3 {
+		t.Fatalf("Unexpected manifest %+v", manifest)
+	}
+	first := manifest.MediaItems[0]
+	if first.ID != "1" || first.File != "media/beach.jpg" || first.BaseURL != "" || !first.MediaMetadata.CreationTime.Equal(taken) {
+		t.Errorf("Expected the first item with its file and without its base URL, got %+v", first)
+	}
+	if manifest.MediaItems[2].File != "" {
+		t.Errorf("Expected no file for the failed original, got %q", manifest.MediaItems[2].File)
+	}
+
+	// The staging directory of the originals is gone
+	entries, _ := os.ReadDir(filepath.Dir(out))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the archive to be left, got %v", entries)
+	}
+}
+
+func TestDownloadUseCase_ExportAlbumTarGzWithoutOriginals(t *testing.T) {
+	repo := &MockMediaItemRepository{items: []domain.MediaItem{{ID: "1", Filename: "a.jpg", BaseURL: "https://img/1"}}}
+	useCase := NewDownloadUseCase(repo)
+	useCase.SetAlbumRepository(&MockAlbumRepository{albums: []domain.Album{{ID: "a1", Title: "Summer"}}})
+	out := filepath.Join(t.TempDir(), "summer.tar.gz")
+
+	if _, err := useCase.ExportAlbum(context.Background(), "a1", ExportOptions{Out: out}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.downloads) != 0 {
+		t.Errorf("Expected no downloads without originals, got %v", repo.downloads)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Expected a gzip stream, got %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected a tar archive, got %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if len(names) != 1 || names[0] != "manifest.json" {
+		t.Errorf("Expected only the manifest, got %v", names)
+	}
+
+	if _, err := useCase.ExportAlbum(context.Background(), "a1", ExportOptions{Out: "summer.rar"}); err == nil {
+		t.Error("Expected an unknown archive format to be rejected")
+	}
+}
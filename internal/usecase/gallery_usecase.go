@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"fmt"
+	"io"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MaxGalleryThumbnailSize caps the width and height of thumbnails served to the web gallery
+const MaxGalleryThumbnailSize = 1024
+
+// GalleryUseCase implements the business logic behind the web gallery: browsing the media
+// items of an album and serving their thumbnails
+type GalleryUseCase struct {
+	logging
+
+	mediaRepo domain.MediaItemRepository
+	thumbs    domain.ThumbnailCache
+	// prefetch is nil until StartPrefetch turns prefetching on
+	prefetch *prefetcher
+}
+
+// NewGalleryUseCase creates a new instance of GalleryUseCase
+func NewGalleryUseCase(mediaRepo domain.MediaItemRepository, thumbs domain.ThumbnailCache) *GalleryUseCase {
+	return &GalleryUseCase{
+		mediaRepo: mediaRepo,
+		thumbs:    thumbs,
+	}
+}
+
+// ListAlbumMediaItems retrieves a single page of the media items in an album, from what was
+// prefetched when it can
+func (uc *GalleryUseCase) ListAlbumMediaItems(albumID string, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if err := req.Validate(domain.MaxMediaItemPageSize); err != nil {
+		return nil, err
+	}
+
+	page := uc.prefetchedPage(albumID, req)
+	if page == nil {
+		var err error
+		if page, err = uc.mediaRepo.SearchMediaItems(albumID, req); err != nil {
+			uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+			return nil, err
+		}
+	}
+	uc.anticipatePage(albumID, req, page)
+	return page, nil
+}
+
+// Thumbnail returns a square thumbnail of a media item at size pixels, a still frame for videos.
+// Thumbnails are shared with contact sheets through the thumbnail cache, so the media item is
+// only looked up and downloaded when it is missing there.
+func (uc *GalleryUseCase) Thumbnail(mediaItemID string, size int) ([]byte, error) {
+	if mediaItemID == "" {
+		return nil, fmt.Errorf("media item id is required")
+	}
+	if size < 1 || size > MaxGalleryThumbnailSize {
+		return nil, fmt.Errorf("invalid thumbnail size %d: must be between 1 and %d", size, MaxGalleryThumbnailSize)
+	}
+
+	if uc.prefetch != nil {
+		uc.prefetch.claim(thumbnailKey(mediaItemID, size))
+		defer uc.anticipateThumbnails(mediaItemID, size)
+	}
+	data, err := uc.thumbs.LoadThumbnail(mediaItemID, size)
+	if err != nil {
+		uc.log().Warn("Failed to read cached thumbnail", "media_item_id", mediaItemID, "error", err)
+	}
+	if data != nil {
+		return data, nil
+	}
+
+	item, err := uc.mediaRepo.GetMediaItem(mediaItemID)
+	if err != nil {
+		uc.log().Error("Failed to fetch media item", "media_item_id", mediaItemID, "error", err)
+		return nil, err
+	}
+	content, err := uc.mediaRepo.DownloadMediaItem(*item, domain.ImageSize{Width: size, Height: size, Crop: true, Still: true})
+	if err != nil {
+		uc.log().Error("Failed to download thumbnail", "media_item_id", mediaItemID, "error", err)
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err = io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	if err := uc.thumbs.SaveThumbnail(mediaItemID, size, data); err != nil {
+		uc.log().Warn("Failed to cache thumbnail", "media_item_id", mediaItemID, "error", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestGalleryUseCase_Thumbnail(t *testing.T) {
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{sized("1", "beach.jpg", 4000, 3000)},
+		files: map[string]string{"https://img/1=w64-h64-c": "thumb"},
+	}
+	cache := &MockThumbnailCache{}
+	useCase := NewGalleryUseCase(repo, cache)
+
+	for range 2 {
+		data, err := useCase.Thumbnail("1", 64)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if string(data) != "thumb" {
+			t.Errorf("Expected the thumbnail, got %q", data)
+		}
+	}
+
+	// The second request is answered from the cache
+	if len(repo.downloads) != 1 {
+		t.Errorf("Expected 1 download, got %v", repo.downloads)
+	}
+	if _, err := useCase.Thumbnail("1", MaxGalleryThumbnailSize+1); err == nil {
+		t.Error("Expected an error for a thumbnail that is too large")
+	}
+	if _, err := useCase.Thumbnail("missing", 64); err == nil {
+		t.Error("Expected an error for an unknown media item")
+	}
+}
+
+func TestGalleryUseCase_ListAlbumMediaItems(t *testing.T) {
+	repo := &MockMediaItemRepository{
+		albumItems: map[string][]domain.MediaItem{"album": {{ID: "1"}, {ID: "2"}}},
+	}
+	useCase := NewGalleryUseCase(repo, &MockThumbnailCache{})
+
+	page, err := useCase.ListAlbumMediaItems("album", domain.PageRequest{PageSize: 10})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 2 || len(repo.searches) != 1 || repo.searches[0] != "album" {
+		t.Errorf("Expected the items of the album, got %+v after %v", page.Items, repo.searches)
+	}
+	if _, err := useCase.ListAlbumMediaItems("", domain.PageRequest{}); err == nil {
+		t.Error("Expected an error without an album id")
+	}
+}
@@ -0,0 +1,344 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Growth models of the library
+const (
+	// GrowthLinear extends the average growth of the last years
+	GrowthLinear = "linear"
+	// GrowthSeasonal repeats the monthly pattern of the last years, such as busy summers and
+	// holidays, at the pace of the last year
+	GrowthSeasonal = "seasonal"
+)
+
+const (
+	// defaultForecastMonths is how far ahead growth is forecast unless another horizon is asked for
+	defaultForecastMonths = 36
+	// defaultPhotoSize and defaultVideoSize are the average sizes a library is estimated with, since
+	// the API reports no file sizes: a phone photo and a short phone video in original quality
+	defaultPhotoSize = 4 << 20
+	defaultVideoSize = 80 << 20
+	// growthWindow is how many months of history the models are fit to; older growth says little
+	// about the next years
+	growthWindow = 36
+	// minSnapshotMonths is how many months the snapshot history of the index must cover before it
+	// is preferred over the capture times of the photos
+	minSnapshotMonths = 3
+	// minSeasonalMonths is how much history picks the seasonal model unless one is asked for; with
+	// less, a single odd month would pass for a season
+	minSeasonalMonths = 24
+)
+
+// StorageTier is a Google One plan by the storage it includes
+type StorageTier struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// storageTiers are the Google One plans, smallest first. Google counts their sizes in binary units.
+var storageTiers = []StorageTier{
+	{Name: "15 GB", Size: 15 << 30},
+	{Name: "100 GB", Size: 100 << 30},
+	{Name: "200 GB", Size: 200 << 30},
+	{Name: "2 TB", Size: 2 << 40},
+	{Name: "5 TB", Size: 5 << 40},
+	{Name: "10 TB", Size: 10 << 40},
+	{Name: "20 TB", Size: 20 << 40},
+	{Name: "30 TB", Size: 30 << 40},
+}
+
+// GrowthOptions configures the forecast of how the library grows
+type GrowthOptions struct {
+	// Months is how far ahead to forecast; values below 1 use the default of 36
+	Months int
+	// Model is GrowthLinear or GrowthSeasonal; empty picks the seasonal model when there are two
+	// years of history and the linear one otherwise
+	Model string
+	// PhotoSize and VideoSize are the average sizes of a photo and a video in bytes; values below 1
+	// use 4 MiB and 80 MiB
+	PhotoSize int64
+	VideoSize int64
+	// Used is the storage the rest of the Google account takes, such as Gmail and Drive, which
+	// counts against the same plan
+	Used int64
+}
+
+// GrowthMonth is the size of the library at the end of a month
+type GrowthMonth struct {
+	// Month is the first day of the month
+	Month  time.Time `json:"month"`
+	Photos int       `json:"photos"`
+	Videos int       `json:"videos"`
+	// Size is the estimated storage in bytes, including GrowthOptions.Used
+	Size int64 `json:"size"`
+}
+
+// TierForecast tells when the library outgrows a storage tier
+type TierForecast struct {
+	StorageTier
+	// Full is set when the library does not fit the tier now
+	Full bool `json:"full,omitempty"`
+	// Exceeded is the first month the forecast size passes the tier, or the zero time when it does
+	// not within the forecast
+	Exceeded time.Time `json:"exceeded,omitzero"`
+}
+
+// GrowthForecast is the expected growth of the library and when it outgrows each storage tier
+type GrowthForecast struct {
+	Model string `json:"model"`
+	// Source is snapshots when the growth was read from the history of the index, or captures when
+	// the history is too short and it was estimated from when the indexed photos were taken
+	Source string `json:"source"`
+	// Current is the library as indexed now
+	Current GrowthMonth `json:"current"`
+	// PhotosPerMonth and VideosPerMonth are the average growth over the next year
+	PhotosPerMonth float64       `json:"photosPerMonth"`
+	VideosPerMonth float64       `json:"videosPerMonth"`
+	Months         []GrowthMonth `json:"months"`
+	// Tiers are the storage tiers the library fills now or within the forecast, and the first one
+	// it does not
+	Tiers []TierForecast `json:"tiers"`
+}
+
+// monthCount is how many photos and videos the library held at the end of a month
+type monthCount struct {
+	month  time.Time
+	photos float64
+	videos float64
+}
+
+// ForecastGrowth forecasts how many photos and videos the library will hold in the coming months,
+// estimates the storage they take and tells when it exceeds each Google One tier. Growth is read
+// from the snapshots the index keeps of every day it was written, or from the capture times of the
+// indexed photos until those cover a few months.
+func (uc *IndexUseCase) ForecastGrowth(ctx context.Context, opts GrowthOptions) (*GrowthForecast, error) {
+	return uc.forecastGrowth(ctx, opts, time.Now())
+}
+
+// forecastGrowth is ForecastGrowth as seen at now
+func (uc *IndexUseCase) forecastGrowth(ctx context.Context, opts GrowthOptions, now time.Time) (forecast *GrowthForecast, err error) {
+	_, span := uc.trace(ctx, "index.forecast_growth", "model", opts.Model)
+	defer func() { span.End(err) }()
+
+	switch opts.Model {
+	case "", GrowthLinear, GrowthSeasonal:
+	default:
+		return nil, fmt.Errorf("%w: unknown growth model %q, want %s or %s", domain.ErrInvalidArgument, opts.Model, GrowthLinear, GrowthSeasonal)
+	}
+	horizon := cmp.Or(max(opts.Months, 0), defaultForecastMonths)
+	photoSize := cmp.Or(max(opts.PhotoSize, 0), defaultPhotoSize)
+	videoSize := cmp.Or(max(opts.VideoSize, 0), defaultVideoSize)
+	size := func(photos, videos int) int64 {
+		return opts.Used + int64(photos)*photoSize + int64(videos)*videoSize
+	}
+
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+	history, err := uc.index.History()
+	if err != nil {
+		return nil, err
+	}
+
+	series, source := snapshotSeries(history), "snapshots"
+	if len(series) < minSnapshotMonths {
+		uc.log().Info("Snapshot history is too short, estimating growth from capture times", "months", len(series))
+		series, source = captureSeries(snapshot.MediaItems, now), "captures"
+	}
+	if len(series) < 2 {
+		return nil, fmt.Errorf("not enough history to forecast growth, the library must span at least two months")
+	}
+	series = series[max(len(series)-growthWindow, 0):]
+
+	model := opts.Model
+	if model == "" {
+		model = GrowthLinear
+		if len(series) >= minSeasonalMonths {
+			model = GrowthSeasonal
+		}
+	}
+	if model == GrowthSeasonal && len(series) <= 12 {
+		return nil, fmt.Errorf("%w: the seasonal model needs more than a year of history, there are %d months", domain.ErrInvalidArgument, len(series))
+	}
+
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	forecast = &GrowthForecast{Model: model, Source: source, Current: GrowthMonth{Month: start}}
+	for _, item := range snapshot.MediaItems {
+		if item.IsVideo() {
+			forecast.Current.Videos++
+		} else {
+			forecast.Current.Photos++
+		}
+	}
+	forecast.Current.Size = size(forecast.Current.Photos, forecast.Current.Videos)
+
+	photoAdds := forecastAdditions(model, series, func(c monthCount) float64 { return c.photos }, start, horizon)
+	videoAdds := forecastAdditions(model, series, func(c monthCount) float64 { return c.videos }, start, horizon)
+	photos, videos := float64(forecast.Current.Photos), float64(forecast.Current.Videos)
+	for k := range horizon {
+		photos += photoAdds[k]
+		videos += videoAdds[k]
+		if k < 12 {
+			forecast.PhotosPerMonth += photoAdds[k] / float64(min(horizon, 12))
+			forecast.VideosPerMonth += videoAdds[k] / float64(min(horizon, 12))
+		}
+		month := GrowthMonth{Month: start.AddDate(0, k+1, 0), Photos: int(math.Round(photos)), Videos: int(math.Round(videos))}
+		month.Size = size(month.Photos, month.Videos)
+		forecast.Months = append(forecast.Months, month)
+	}
+
+	for _, tier := range storageTiers {
+		t := TierForecast{StorageTier: tier, Full: forecast.Current.Size > tier.Size}
+		for _, month := range forecast.Months {
+			if !t.Full && month.Size > tier.Size {
+				t.Exceeded = month.Month
+				break
+			}
+		}
+		forecast.Tiers = append(forecast.Tiers, t)
+		if !t.Full && t.Exceeded.IsZero() {
+			break
+		}
+	}
+
+	uc.log().Info("Forecast library growth", "model", model, "source", source, "history_months", len(series), "months", horizon)
+	return forecast, nil
+}
+
+// snapshotSeries turns the snapshot history of the index into the size of the library at the end
+// of every month it covers, the last snapshot of each month counting for it. Months without
+// snapshots are filled in linearly from their neighbours.
+func snapshotSeries(history []domain.LibrarySnapshot) []monthCount {
+	var series []monthCount
+	for _, entry := range history {
+		at := entry.At.UTC()
+		month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		count := monthCount{month: month, photos: float64(entry.Photos), videos: float64(entry.Videos)}
+		if n := len(series); n > 0 && series[n-1].month.Equal(month) {
+			series[n-1] = count
+			continue
+		}
+		if n := len(series); n > 0 {
+			last := series[n-1]
+			gap := monthsBetween(last.month, month)
+			for i := 1; i < gap; i++ {
+				f := float64(i) / float64(gap)
+				series = append(series, monthCount{
+					month:  last.month.AddDate(0, i, 0),
+					photos: last.photos + f*(count.photos-last.photos),
+					videos: last.videos + f*(count.videos-last.videos),
+				})
+			}
+		}
+		series = append(series, count)
+	}
+	return series
+}
+
+// captureSeries estimates the size of the library at the end of every past month from when its
+// media items were taken, which matches when they were added for libraries filled from a phone.
+// The running month is left out, since it is not over yet, and so are items without a capture time.
+func captureSeries(items []domain.MediaItem, now time.Time) []monthCount {
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	added := make(map[time.Time]*monthCount)
+	var first time.Time
+	for _, item := range items {
+		t := creationTime(item).UTC()
+		if t.IsZero() || !t.Before(current) {
+			continue
+		}
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if first.IsZero() || month.Before(first) {
+			first = month
+		}
+		count := added[month]
+		if count == nil {
+			count = &monthCount{month: month}
+			added[month] = count
+		}
+		if item.IsVideo() {
+			count.videos++
+		} else {
+			count.photos++
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+
+	var series []monthCount
+	var photos, videos float64
+	for month := first; month.Before(current); month = month.AddDate(0, 1, 0) {
+		if count := added[month]; count != nil {
+			photos += count.photos
+			videos += count.videos
+		}
+		series = append(series, monthCount{month: month, photos: photos, videos: videos})
+	}
+	return series
+}
+
+// forecastAdditions returns how much of what value reads the library gains in each of the months
+// after start.
+//
+// The linear model fits a line to the size at the end of every month of the series and takes its
+// slope. The seasonal model runs at the average pace of the last twelve months, scaled for every
+// calendar month by how its additions compare to those of an average month of the series.
+func forecastAdditions(model string, series []monthCount, value func(monthCount) float64, start time.Time, months int) []float64 {
+	adds := make([]float64, months)
+	if model == GrowthLinear {
+		// Least squares slope of value over the month number
+		n := float64(len(series))
+		var sumX, sumY, sumXY, sumXX float64
+		for i, c := range series {
+			x, y := float64(i), value(c)
+			sumX += x
+			sumY += y
+			sumXY += x * y
+			sumXX += x * x
+		}
+		slope := max((n*sumXY-sumX*sumY)/(n*sumXX-sumX*sumX), 0)
+		for k := range adds {
+			adds[k] = slope
+		}
+		return adds
+	}
+
+	var total float64
+	var byMonth, monthsSeen [12]float64
+	for i := 1; i < len(series); i++ {
+		a := max(value(series[i])-value(series[i-1]), 0)
+		total += a
+		m := series[i].month.Month() - 1
+		byMonth[m] += a
+		monthsSeen[m]++
+	}
+	average := total / float64(len(series)-1)
+
+	recent := series[max(len(series)-13, 0):]
+	pace := max(value(recent[len(recent)-1])-value(recent[0]), 0) / float64(len(recent)-1)
+
+	for k := range adds {
+		m := start.AddDate(0, k+1, 0).Month() - 1
+		season := 1.0
+		if monthsSeen[m] > 0 && average > 0 {
+			season = byMonth[m] / monthsSeen[m] / average
+		}
+		adds[k] = pace * season
+	}
+	return adds
+}
+
+// monthsBetween counts the months from the first day of one month to that of a later one
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+}
@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestIndexUseCase_ForecastGrowth(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{UpdatedAt: now}}
+	for i := range 66 {
+		item := domain.MediaItem{ID: fmt.Sprintf("m%d", i), MimeType: "image/jpeg"}
+		if i >= 60 {
+			item.MimeType = "video/mp4"
+		}
+		index.snapshot.MediaItems = append(index.snapshot.MediaItems, item)
+	}
+	// Six months of snapshots growing by 10 photos and a video a month, with August missing
+	for i := range 6 {
+		if i == 3 {
+			continue
+		}
+		index.history = append(index.history, domain.LibrarySnapshot{
+			At:     time.Date(2026, time.Month(5+i), 20, 0, 0, 0, 0, time.UTC),
+			Photos: 10 * (i + 1),
+			Videos: i + 1,
+		})
+	}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+
+	// With every item taking 10 GiB the library takes 660 GiB and grows by 110 GiB a month
+	forecast, err := uc.forecastGrowth(context.Background(), GrowthOptions{PhotoSize: 10 << 30, VideoSize: 10 << 30}, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if forecast.Model != GrowthLinear || forecast.Source != "snapshots" {
+		t.Errorf("Expected a linear forecast from snapshots, got %s from %s", forecast.Model, forecast.Source)
+	}
+	if math.Abs(forecast.PhotosPerMonth-10) > 1e-9 || math.Abs(forecast.VideosPerMonth-1) > 1e-9 {
+		t.Errorf("Expected 10 photos and 1 video a month, got %v and %v", forecast.PhotosPerMonth, forecast.VideosPerMonth)
+	}
+	if len(forecast.Months) != defaultForecastMonths {
+		t.Fatalf("Expected %d months, got %d", defaultForecastMonths, len(forecast.Months))
+	}
+	if m := forecast.Months[0]; m.Photos != 70 || m.Videos != 7 || !m.Month.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 70 photos and 7 videos in November, got %+v", m)
+	}
+
+	// 2 TiB is passed after 13 months; 5 TiB not within three years, which ends the tiers
+	var tiers []string
+	for _, tier := range forecast.Tiers {
+		tiers = append(tiers, fmt.Sprintf("%s full=%t exceeded=%s", tier.Name, tier.Full, tier.Exceeded.Format("2006-01")))
+	}
+	want := []string{
+		"15 GB full=true exceeded=0001-01",
+		"100 GB full=true exceeded=0001-01",
+		"200 GB full=true exceeded=0001-01",
+		"2 TB full=false exceeded=2027-11",
+		"5 TB full=false exceeded=0001-01",
+	}
+	if fmt.Sprint(tiers) != fmt.Sprint(want) {
+		t.Errorf("Expected tiers %v, got %v", want, tiers)
+	}
+
+	if _, err := uc.forecastGrowth(context.Background(), GrowthOptions{Model: GrowthSeasonal}, now); err == nil {
+		t.Error("Expected the seasonal model to need more than a year of history")
+	}
+	if _, err := uc.forecastGrowth(context.Background(), GrowthOptions{Model: "exponential"}, now); err == nil {
+		t.Error("Expected an unknown model to be rejected")
+	}
+}
+
+func TestIndexUseCase_ForecastGrowthSeasonalFromCaptures(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{UpdatedAt: now}}
+	// Two years of captures: 10 photos a month and 40 every December
+	for month := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC); month.Before(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)); month = month.AddDate(0, 1, 0) {
+		n := 10
+		if month.Month() == time.December {
+			n = 40
+		}
+		for i := range n {
+			index.snapshot.MediaItems = append(index.snapshot.MediaItems, domain.MediaItem{
+				ID:            fmt.Sprintf("%s-%d", month.Format("2006-01"), i),
+				MimeType:      "image/jpeg",
+				MediaMetadata: &domain.MediaMetadata{CreationTime: month.AddDate(0, 0, i%28)},
+			})
+		}
+	}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+
+	forecast, err := uc.forecastGrowth(context.Background(), GrowthOptions{Months: 12}, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if forecast.Model != GrowthSeasonal || forecast.Source != "captures" {
+		t.Errorf("Expected a seasonal forecast from capture times, got %s from %s", forecast.Model, forecast.Source)
+	}
+	// The last year added 150 photos, 12.5 a month, with December four times an average month
+	november := forecast.Months[0].Photos - forecast.Current.Photos
+	december := forecast.Months[1].Photos - forecast.Months[0].Photos
+	if november >= december || december < 3*november {
+		t.Errorf("Expected December to add far more photos than November, got %d and %d", december, november)
+	}
+	if math.Abs(forecast.PhotosPerMonth*12-150) > 3 {
+		t.Errorf("Expected about 150 photos over the next year, got %v", forecast.PhotosPerMonth*12)
+	}
+}
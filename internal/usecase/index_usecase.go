@@ -0,0 +1,315 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// IndexResult summarizes a build or update of the local index
+type IndexResult struct {
+	Albums     int `json:"albums"`
+	MediaItems int `json:"mediaItems"`
+	Added      int `json:"added"`
+	Removed    int `json:"removed"`
+	// AlbumsRefreshed counts the albums whose media items were listed again
+	AlbumsRefreshed int `json:"albumsRefreshed"`
+}
+
+// IndexFilter selects media items when searching the local index; empty fields match everything
+type IndexFilter struct {
+	AlbumID string
+	// Filename matches media items whose file name contains it, ignoring case
+	Filename  string
+	MediaType domain.MediaType
+	// Sort orders the matches; empty sorts them newest first
+	Sort IndexSort
+}
+
+// IndexSort is an order of the media items found in the local index
+type IndexSort string
+
+// Orders of index searches
+const (
+	SortNewest   IndexSort = "newest"
+	SortOldest   IndexSort = "oldest"
+	SortFilename IndexSort = "filename"
+)
+
+// Validate reports whether s is a known order; empty is the default order
+func (s IndexSort) Validate() error {
+	switch s {
+	case "", SortNewest, SortOldest, SortFilename:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown sort %q, expected newest, oldest or filename", domain.ErrInvalidArgument, s)
+}
+
+// IndexUseCase implements the business logic for the local metadata index, which serves
+// listing and searching without walking every page of the API on each invocation
+type IndexUseCase struct {
+	logging
+	tracing
+
+	albumRepo domain.AlbumRepository
+	mediaRepo domain.MediaItemRepository
+	index     domain.IndexRepository
+}
+
+// NewIndexUseCase creates a new instance of IndexUseCase
+func NewIndexUseCase(albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository, index domain.IndexRepository) *IndexUseCase {
+	return &IndexUseCase{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+		index:     index,
+	}
+}
+
+// Close releases the index
+func (uc *IndexUseCase) Close() error {
+	return uc.index.Close()
+}
+
+// Build fetches all album and media item metadata and replaces the index with it
+func (uc *IndexUseCase) Build(ctx context.Context) (result *IndexResult, err error) {
+	ctx, span := uc.trace(ctx, "index.build")
+	defer func() { span.End(err) }()
+
+	return uc.refresh(ctx, nil)
+}
+
+// Update brings the index up to date. Media items are listed again, but the contents of an album
+// are only fetched again when it is new or its item count changed since the last run.
+func (uc *IndexUseCase) Update(ctx context.Context) (result *IndexResult, err error) {
+	ctx, span := uc.trace(ctx, "index.update")
+	defer func() { span.End(err) }()
+
+	previous, err := uc.index.Load()
+	if err != nil {
+		return nil, err
+	}
+	if previous.UpdatedAt.IsZero() {
+		uc.log().Info("Index has not been built yet, building it")
+		previous = nil
+	}
+
+	return uc.refresh(ctx, previous)
+}
+
+// refresh fetches metadata from the API, reusing album contents from previous where they are
+// unchanged, and atomically replaces the index with the result
+func (uc *IndexUseCase) refresh(ctx context.Context, previous *domain.IndexSnapshot) (*IndexResult, error) {
+	snapshot, err := uc.fetchLibrary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &IndexResult{Albums: len(snapshot.Albums), MediaItems: len(snapshot.MediaItems)}
+
+	snapshot.AlbumItems, result.AlbumsRefreshed, err = fetchAlbumItems(ctx, uc.log(), uc.mediaRepo, snapshot.Albums, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Added, result.Removed = diffMediaItems(previous, snapshot.MediaItems)
+
+	if err := uc.index.Replace(*snapshot); err != nil {
+		uc.log().Error("Failed to save index", "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully indexed albums and media items", "albums", result.Albums, "media_items", result.MediaItems)
+	return result, nil
+}
+
+// fetchAlbumItems lists the media item IDs of every album. With a previous snapshot, albums whose
+// item count did not change reuse its IDs instead of being listed again; refreshed counts the rest.
+func fetchAlbumItems(ctx context.Context, logger *slog.Logger, repo domain.MediaItemRepository, albums []domain.Album, previous *domain.IndexSnapshot) (albumItems map[string][]string, refreshed int, err error) {
+	previousAlbums := make(map[string]domain.Album)
+	if previous != nil {
+		for _, album := range previous.Albums {
+			previousAlbums[album.ID] = album
+		}
+	}
+
+	albumItems = make(map[string][]string, len(albums))
+	for _, album := range albums {
+		if old, ok := previousAlbums[album.ID]; ok && old.MediaItemsCount == album.MediaItemsCount {
+			if ids, ok := previous.AlbumItems[album.ID]; ok {
+				albumItems[album.ID] = ids
+				continue
+			}
+		}
+
+		ids, err := albumItemIDs(ctx, repo, album.ID)
+		if err != nil {
+			logger.Error("Failed to fetch media items of album", "album_id", album.ID, "error", err)
+			return nil, 0, err
+		}
+		albumItems[album.ID] = ids
+		refreshed++
+	}
+	return albumItems, refreshed, nil
+}
+
+// albumItemIDs lists the IDs of the media items in an album, asking for nothing else of them
+func albumItemIDs(ctx context.Context, repo domain.MediaItemRepository, albumID string) ([]string, error) {
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize, Fields: "id"}
+	ids := []string{}
+	for item, err := range paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return repo.SearchMediaItems(albumID, req)
+	}) {
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, item.ID)
+	}
+	return ids, nil
+}
+
+// Status reports how much the index holds and when it was last updated
+func (uc *IndexUseCase) Status() (*domain.IndexStats, error) {
+	return uc.index.Stats()
+}
+
+// Albums lists the indexed albums ordered by title
+func (uc *IndexUseCase) Albums() ([]domain.Album, error) {
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(snapshot.Albums, func(a, b domain.Album) int {
+		return cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	})
+	return snapshot.Albums, nil
+}
+
+// SearchMediaItems lists the indexed media items matching filter, newest first unless
+// filter.Sort asks for another order
+func (uc *IndexUseCase) SearchMediaItems(ctx context.Context, filter IndexFilter) (matches []domain.MediaItem, err error) {
+	_, span := uc.trace(ctx, "media.search", "album_id", filter.AlbumID, "media_type", string(filter.MediaType))
+	defer func() { span.End(err) }()
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+	return filter.search(snapshot.MediaItems, snapshot.AlbumItems)
+}
+
+// validate reports a media type or order filter cannot search by
+func (filter IndexFilter) validate() error {
+	if filter.MediaType != "" {
+		if err := filter.MediaType.Validate(); err != nil {
+			return err
+		}
+	}
+	return filter.Sort.Validate()
+}
+
+// search returns the media items of items matching filter in its order, looking up the media
+// items of albums in albumItems
+func (filter IndexFilter) search(items []domain.MediaItem, albumItems map[string][]string) ([]domain.MediaItem, error) {
+	var inAlbum map[string]bool
+	if filter.AlbumID != "" {
+		ids, ok := albumItems[filter.AlbumID]
+		if !ok {
+			return nil, fmt.Errorf("album %s is not in the index", filter.AlbumID)
+		}
+		inAlbum = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			inAlbum[id] = true
+		}
+	}
+
+	var matches []domain.MediaItem
+	name := strings.ToLower(filter.Filename)
+	for _, item := range items {
+		switch {
+		case inAlbum != nil && !inAlbum[item.ID]:
+		case name != "" && !strings.Contains(strings.ToLower(item.Filename), name):
+		case filter.MediaType == domain.MediaTypePhoto && item.IsVideo():
+		case filter.MediaType == domain.MediaTypeVideo && !item.IsVideo():
+		default:
+			matches = append(matches, item)
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b domain.MediaItem) int {
+		switch filter.Sort {
+		case SortOldest:
+			return creationTime(a).Compare(creationTime(b))
+		case SortFilename:
+			return cmp.Compare(strings.ToLower(a.Filename), strings.ToLower(b.Filename))
+		}
+		return creationTime(b).Compare(creationTime(a))
+	})
+	return matches, nil
+}
+
+// loadBuiltIndex loads the index and fails with a hint when it has never been built
+func loadBuiltIndex(index domain.IndexRepository) (*domain.IndexSnapshot, error) {
+	snapshot, err := index.Load()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.UpdatedAt.IsZero() {
+		return nil, fmt.Errorf("index is empty, run 'index build' first")
+	}
+	return snapshot, nil
+}
+
+// diffMediaItems counts the media items added and removed since previous; without a previous
+// snapshot every item counts as added
+func diffMediaItems(previous *domain.IndexSnapshot, items []domain.MediaItem) (added, removed int) {
+	if previous == nil {
+		return len(items), 0
+	}
+
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		current[item.ID] = true
+	}
+
+	old := make(map[string]bool, len(previous.MediaItems))
+	for _, item := range previous.MediaItems {
+		old[item.ID] = true
+		if !current[item.ID] {
+			removed++
+		}
+	}
+	for id := range current {
+		if !old[id] {
+			added++
+		}
+	}
+	return added, removed
+}
+
+// creationTime returns when a media item was captured, or the zero time when unknown
+func creationTime(item domain.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime
+}
+
+// creationTimeIn returns when a media item was captured as seen in loc, or the zero time when
+// unknown; a nil loc keeps the UTC the API reports
+func creationTimeIn(item domain.MediaItem, loc *time.Location) time.Time {
+	t := creationTime(item)
+	if t.IsZero() || loc == nil {
+		return t
+	}
+	return t.In(loc)
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockIndexRepository is a mock implementation of IndexRepository that keeps the snapshot in memory
+type MockIndexRepository struct {
+	snapshot domain.IndexSnapshot
+	history  []domain.LibrarySnapshot
+	closed   bool
+}
+
+func (m *MockIndexRepository) Load() (*domain.IndexSnapshot, error) {
+	snapshot := m.snapshot
+	return &snapshot, nil
+}
+
+func (m *MockIndexRepository) Replace(snapshot domain.IndexSnapshot) error {
+	m.snapshot = snapshot
+	return nil
+}
+
+func (m *MockIndexRepository) Stats() (*domain.IndexStats, error) {
+	return &domain.IndexStats{
+		Albums:     len(m.snapshot.Albums),
+		MediaItems: len(m.snapshot.MediaItems),
+		UpdatedAt:  m.snapshot.UpdatedAt,
+	}, nil
+}
+
+func (m *MockIndexRepository) History() ([]domain.LibrarySnapshot, error) {
+	return m.history, nil
+}
+
+func (m *MockIndexRepository) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestIndexUseCase_BuildAndUpdate(t *testing.T) {
+	albumRepo := &MockAlbumRepository{albums: []domain.Album{
+		{ID: "a1", Title: "Trip", MediaItemsCount: 2},
+		{ID: "a2", Title: "Empty"},
+	}}
+	mediaRepo := &MockMediaItemRepository{
+		items: []domain.MediaItem{{ID: "m1"}, {ID: "m2"}, {ID: "m3"}},
+		albumItems: map[string][]domain.MediaItem{
+			"a1": {{ID: "m1"}, {ID: "m2"}},
+		},
+	}
+	index := &MockIndexRepository{}
+	uc := NewIndexUseCase(albumRepo, mediaRepo, index)
+
+	result, err := uc.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Albums != 2 || result.MediaItems != 3 || result.Added != 3 || result.AlbumsRefreshed != 2 {
+		t.Errorf("Unexpected build result: %+v", result)
+	}
+	if got := index.snapshot.AlbumItems["a1"]; len(got) != 2 {
+		t.Errorf("Expected 2 media items in album a1, got %v", got)
+	}
+	if index.snapshot.UpdatedAt.IsZero() {
+		t.Error("Expected the update time to be recorded")
+	}
+
+	// Only the album whose item count changed is listed again
+	albumRepo.albums[1].MediaItemsCount = 1
+	mediaRepo.albumItems["a2"] = []domain.MediaItem{{ID: "m4"}}
+	mediaRepo.items = []domain.MediaItem{{ID: "m1"}, {ID: "m2"}, {ID: "m4"}}
+	mediaRepo.searches = nil
+
+	result, err = uc.Update(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Added != 1 || result.Removed != 1 || result.AlbumsRefreshed != 1 {
+		t.Errorf("Unexpected update result: %+v", result)
+	}
+	if len(mediaRepo.searches) != 1 || mediaRepo.searches[0] != "a2" {
+		t.Errorf("Expected only album a2 to be searched, got %v", mediaRepo.searches)
+	}
+	if got := index.snapshot.AlbumItems["a1"]; len(got) != 2 {
+		t.Errorf("Expected album a1 to keep its media items, got %v", got)
+	}
+}
+
+func TestIndexUseCase_SearchMediaItems(t *testing.T) {
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{
+		MediaItems: []domain.MediaItem{
+			{ID: "m1", Filename: "IMG_0001.jpg", MimeType: "image/jpeg", MediaMetadata: &domain.MediaMetadata{CreationTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			{ID: "m2", Filename: "VID_0002.mp4", MimeType: "video/mp4"},
+			{ID: "m3", Filename: "img_0003.png", MimeType: "image/png", MediaMetadata: &domain.MediaMetadata{CreationTime: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+		AlbumItems: map[string][]string{"a1": {"m1", "m2"}},
+		UpdatedAt:  time.Now(),
+	}}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+
+	items, err := uc.SearchMediaItems(context.Background(), IndexFilter{Filename: "img", MediaType: domain.MediaTypePhoto})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(items) != 2 || items[0].ID != "m3" || items[1].ID != "m1" {
+		t.Errorf("Expected m3 and m1 newest first, got %+v", items)
+	}
+
+	items, err = uc.SearchMediaItems(context.Background(), IndexFilter{AlbumID: "a1", MediaType: domain.MediaTypeVideo})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "m2" {
+		t.Errorf("Expected only m2, got %+v", items)
+	}
+
+	if _, err := uc.SearchMediaItems(context.Background(), IndexFilter{AlbumID: "missing"}); err == nil {
+		t.Error("Expected an error for an album that is not indexed")
+	}
+}
+
+func TestIndexUseCase_SearchBeforeBuild(t *testing.T) {
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, &MockIndexRepository{})
+
+	if _, err := uc.SearchMediaItems(context.Background(), IndexFilter{}); err == nil {
+		t.Error("Expected an error when the index was never built")
+	}
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Page geometry of calendars and photo books, in inches unless noted
+const (
+	layoutMargin = 0.5
+	layoutGap    = 0.15
+	layoutFooter = 0.3
+	// calendarPhotoShare is the part of a calendar page above the days taken by the photo
+	calendarPhotoShare = 0.55
+	// calendarHeading and calendarWeekdays are the heights of the month name and weekday rows
+	calendarHeading  = 0.6
+	calendarWeekdays = 0.3
+)
+
+// Colors of calendar and photo book pages
+var (
+	layoutInk         = color.Gray{Y: 0x20}
+	layoutMutedInk    = color.Gray{Y: 0x70}
+	layoutSundayInk   = color.RGBA{R: 0xb0, G: 0x30, B: 0x30, A: 0xff}
+	layoutRule        = color.Gray{Y: 0xcc}
+	layoutPlaceholder = color.Gray{Y: 0xdd}
+)
+
+// layoutFaces are the type sizes used on pages
+type layoutFaces struct {
+	title, heading, body, small font.Face
+}
+
+// layoutRenderer draws pages of one paper size at one resolution
+type layoutRenderer struct {
+	dpi     int
+	bounds  image.Rectangle
+	content image.Rectangle
+	gap     int
+	faces   layoutFaces
+}
+
+// newLayoutRenderer prepares pages of paper size at dpi, with text set in the Go fonts
+func newLayoutRenderer(paper domain.PrintSize, dpi int) (*layoutRenderer, error) {
+	r := &layoutRenderer{dpi: dpi}
+	r.bounds = image.Rect(0, 0, r.px(paper.Width), r.px(paper.Height))
+	r.content = r.bounds.Inset(r.px(layoutMargin))
+	r.gap = r.px(layoutGap)
+
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font: %w", err)
+	}
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load font: %w", err)
+	}
+
+	sizes := []struct {
+		face   *font.Face
+		font   *opentype.Font
+		points float64
+	}{
+		{&r.faces.title, bold, 36},
+		{&r.faces.heading, bold, 24},
+		{&r.faces.body, regular, 11},
+		{&r.faces.small, regular, 9},
+	}
+	for _, s := range sizes {
+		face, err := opentype.NewFace(s.font, &opentype.FaceOptions{Size: s.points, DPI: float64(dpi), Hinting: font.HintingFull})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load font: %w", err)
+		}
+		*s.face = face
+	}
+	return r, nil
+}
+
+// px converts inches to pixels
+func (r *layoutRenderer) px(inches float64) int {
+	return int(math.Round(inches * float64(r.dpi)))
+}
+
+// newPage returns a blank white page
+func (r *layoutRenderer) newPage() *image.RGBA {
+	page := image.NewRGBA(r.bounds)
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+	return page
+}
+
+// split divides area into a top part taking share of its height and the rest, with a gap between
+func (r *layoutRenderer) split(area image.Rectangle, share float64) (image.Rectangle, image.Rectangle) {
+	y := area.Min.Y + int(share*float64(area.Dy()))
+	return image.Rect(area.Min.X, area.Min.Y, area.Max.X, y-r.gap/2), image.Rect(area.Min.X, y+r.gap/2, area.Max.X, area.Max.Y)
+}
+
+// splitFooter reserves a line for the page number at the bottom of area
+func (r *layoutRenderer) splitFooter(area image.Rectangle) (image.Rectangle, image.Rectangle) {
+	y := area.Max.Y - r.px(layoutFooter)
+	return image.Rect(area.Min.X, area.Min.Y, area.Max.X, y), image.Rect(area.Min.X, y, area.Max.X, area.Max.Y)
+}
+
+// place converts template slots into rectangles of area, leaving a gap between neighbouring slots
+// while the outer edges stay flush with area
+func (r *layoutRenderer) place(area image.Rectangle, slots []slot) []image.Rectangle {
+	outer := area.Inset(-r.gap / 2)
+	rects := make([]image.Rectangle, len(slots))
+	for i, s := range slots {
+		x0 := outer.Min.X + int(s.x*float64(outer.Dx()))
+		y0 := outer.Min.Y + int(s.y*float64(outer.Dy()))
+		x1 := outer.Min.X + int((s.x+s.w)*float64(outer.Dx()))
+		y1 := outer.Min.Y + int((s.y+s.h)*float64(outer.Dy()))
+		rects[i] = image.Rect(x0, y0, x1, y1).Inset(r.gap / 2)
+	}
+	return rects
+}
+
+// drawPhoto fills rect with a photo, scaling it when Google served it at another size (photos
+// are never enlarged by the server); nil draws a placeholder
+func (r *layoutRenderer) drawPhoto(page *image.RGBA, photo image.Image, rect image.Rectangle) {
+	switch {
+	case photo == nil:
+		draw.Draw(page, rect, image.NewUniform(layoutPlaceholder), image.Point{}, draw.Src)
+	case photo.Bounds().Size() == rect.Size():
+		draw.Draw(page, rect, photo, photo.Bounds().Min, draw.Src)
+	default:
+		xdraw.CatmullRom.Scale(page, rect, photo, photo.Bounds(), draw.Src, nil)
+	}
+}
+
+// drawTitle centers one line of text in area, shortening it when it is too wide
+func (r *layoutRenderer) drawTitle(page *image.RGBA, face font.Face, s string, area image.Rectangle) {
+	s = fitText(face, s, area.Dx())
+	m := face.Metrics()
+	x := area.Min.X + (area.Dx()-font.MeasureString(face, s).Ceil())/2
+	y := area.Min.Y + (area.Dy()+m.Ascent.Ceil()-m.Descent.Ceil())/2
+	drawText(page, face, s, x, y, layoutInk)
+}
+
+// drawMonth draws the name of a month and its days in a grid of weeks filling area
+func (r *layoutRenderer) drawMonth(page *image.RGBA, area image.Rectangle, year int, month time.Month, sundayFirst bool) {
+	heading := image.Rect(area.Min.X, area.Min.Y, area.Max.X, area.Min.Y+r.px(calendarHeading))
+	r.drawTitle(page, r.faces.heading, fmt.Sprintf("%s %d", month, year), heading)
+
+	firstDay := time.Monday
+	if sundayFirst {
+		firstDay = time.Sunday
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(first.Weekday()) - int(firstDay) + 7) % 7
+	days := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	weeks := (offset + days + 6) / 7
+
+	cellW := area.Dx() / 7
+	weekdays := heading.Max.Y + r.px(calendarWeekdays)
+	cellH := (area.Max.Y - weekdays) / weeks
+
+	for col := range 7 {
+		weekday := time.Weekday((int(firstDay) + col) % 7)
+		label := image.Rect(area.Min.X+col*cellW, heading.Max.Y, area.Min.X+(col+1)*cellW, weekdays)
+		r.drawTitle(page, r.faces.small, weekday.String()[:3], label)
+	}
+
+	line := max(1, r.dpi/150)
+	rule := image.NewUniform(layoutRule)
+	for row := range weeks + 1 {
+		y := weekdays + row*cellH
+		draw.Draw(page, image.Rect(area.Min.X, y, area.Min.X+7*cellW, y+line), rule, image.Point{}, draw.Src)
+	}
+	for col := range 8 {
+		x := area.Min.X + col*cellW
+		draw.Draw(page, image.Rect(x, weekdays, x+line, weekdays+weeks*cellH), rule, image.Point{}, draw.Src)
+	}
+
+	pad := r.px(0.06)
+	ascent := r.faces.body.Metrics().Ascent.Ceil()
+	for day := 1; day <= days; day++ {
+		cell := offset + day - 1
+		x := area.Min.X + (cell%7)*cellW + pad
+		y := weekdays + (cell/7)*cellH + pad + ascent
+		ink := color.Color(layoutInk)
+		if time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() == time.Sunday {
+			ink = layoutSundayInk
+		}
+		drawText(page, r.faces.body, fmt.Sprint(day), x, y, ink)
+	}
+}
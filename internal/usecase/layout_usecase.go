@@ -0,0 +1,410 @@
+package usecase
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultLayoutDPI renders calendars and photo books at print resolution
+const DefaultLayoutDPI = 300
+
+// PhotoBookLayout names a page template of a photo book
+type PhotoBookLayout string
+
+// Photo book page templates
+const (
+	LayoutSingle PhotoBookLayout = "single"
+	LayoutTwo    PhotoBookLayout = "two"
+	LayoutGrid   PhotoBookLayout = "grid"
+)
+
+// slot is an area of a page as fractions of the space inside the margins
+type slot struct {
+	x, y, w, h float64
+}
+
+// bookTemplates place the photos of a photo book page, in reading order
+var bookTemplates = map[PhotoBookLayout][]slot{
+	LayoutSingle: {{0, 0, 1, 1}},
+	LayoutTwo:    {{0, 0, 1, 0.5}, {0, 0.5, 1, 0.5}},
+	LayoutGrid:   {{0, 0, 0.5, 0.5}, {0.5, 0, 0.5, 0.5}, {0, 0.5, 0.5, 0.5}, {0.5, 0.5, 0.5, 0.5}},
+}
+
+// CalendarOptions configures a year calendar
+type CalendarOptions struct {
+	// AlbumIDs are the albums photos are picked from
+	AlbumIDs []string
+	Year     int
+	// Title is printed on the cover; it defaults to the year
+	Title string
+	Paper domain.PrintSize
+	// SundayFirst starts weeks on Sunday instead of Monday
+	SundayFirst bool
+	// Output is the PDF file to write
+	Output string
+	// DPI is the resolution pages are rendered at; values below 1 use DefaultLayoutDPI
+	DPI int
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// TimeZone decides which month photos were taken in; nil uses UTC
+	TimeZone *time.Location
+}
+
+// PhotoBookOptions configures a photo book
+type PhotoBookOptions struct {
+	// AlbumIDs are the albums whose photos fill the book, in album order
+	AlbumIDs []string
+	// Months keeps only photos taken in these months, given by any time within them; empty keeps all
+	Months []time.Time
+	Layout PhotoBookLayout
+	// Title is printed on the cover; it defaults to the album titles
+	Title string
+	Paper domain.PrintSize
+	// Output is the PDF file to write
+	Output string
+	// DPI is the resolution pages are rendered at; values below 1 use DefaultLayoutDPI
+	DPI int
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// TimeZone decides which month photos were taken in for Months; nil uses UTC
+	TimeZone *time.Location
+}
+
+// LayoutResult describes a rendered calendar or photo book
+type LayoutResult struct {
+	Path   string `json:"path"`
+	Pages  int    `json:"pages"`
+	Photos int    `json:"photos"`
+	// Missing counts the photos that could not be downloaded and show a placeholder instead
+	Missing int `json:"missing"`
+}
+
+// LayoutUseCase implements the business logic for laying out photos from albums as print-ready
+// PDFs: a year calendar or a simple photo book. Google crops and scales each photo to its slot.
+type LayoutUseCase struct {
+	logging
+
+	albumRepo domain.AlbumRepository
+	mediaRepo domain.MediaItemRepository
+}
+
+// NewLayoutUseCase creates a new instance of LayoutUseCase
+func NewLayoutUseCase(albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository) *LayoutUseCase {
+	return &LayoutUseCase{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+	}
+}
+
+// RenderCalendar writes a PDF with a cover and one page per month of opts.Year, each with a photo
+// above the month's days. A month gets a photo taken in that month of the year if there is one,
+// else one taken in that month of another year, else the next photo not used yet.
+func (uc *LayoutUseCase) RenderCalendar(ctx context.Context, opts CalendarOptions) (*LayoutResult, error) {
+	if opts.Year < 1 || opts.Year > 9999 {
+		return nil, fmt.Errorf("invalid calendar year %d", opts.Year)
+	}
+
+	photos, _, err := uc.albumPhotos(ctx, opts.AlbumIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := uc.newDocument(opts.Paper, opts.DPI, opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+	r := doc.r
+
+	cover, months := pickCalendarPhotos(photos, opts.Year, opts.TimeZone)
+	uc.log().Info("Rendering calendar from photos", "year", opts.Year, "photos", len(photos))
+
+	title := cmp.Or(opts.Title, strconv.Itoa(opts.Year))
+	photoArea, titleArea := r.split(r.content, 0.8)
+	if err := doc.addPage(ctx, []domain.MediaItem{cover}, r.place(photoArea, bookTemplates[LayoutSingle]), func(page *image.RGBA) {
+		r.drawTitle(page, r.faces.title, title, titleArea)
+	}); err != nil {
+		return nil, err
+	}
+
+	for month := time.January; month <= time.December; month++ {
+		photoArea, monthArea := r.split(r.content, calendarPhotoShare)
+		if err := doc.addPage(ctx, []domain.MediaItem{months[month-1]}, r.place(photoArea, bookTemplates[LayoutSingle]), func(page *image.RGBA) {
+			r.drawMonth(page, monthArea, opts.Year, month, opts.SundayFirst)
+		}); err != nil {
+			return nil, err
+		}
+		uc.log().Info("Rendered calendar month", "month", month)
+	}
+
+	return doc.write(opts.Output)
+}
+
+// RenderPhotoBook writes a PDF with a cover followed by the photos of the albums, placed on pages
+// by the opts.Layout template and numbered
+func (uc *LayoutUseCase) RenderPhotoBook(ctx context.Context, opts PhotoBookOptions) (*LayoutResult, error) {
+	template, ok := bookTemplates[opts.Layout]
+	if !ok {
+		return nil, fmt.Errorf("unknown photo book layout %q, expected %s, %s or %s", opts.Layout, LayoutSingle, LayoutTwo, LayoutGrid)
+	}
+
+	photos, titles, err := uc.albumPhotos(ctx, opts.AlbumIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Months) > 0 {
+		photos = photosInMonths(photos, opts.Months, opts.TimeZone)
+		if len(photos) == 0 {
+			return nil, fmt.Errorf("the albums have no photos taken in the selected months")
+		}
+	}
+
+	doc, err := uc.newDocument(opts.Paper, opts.DPI, opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+	r := doc.r
+
+	total := (len(photos) + len(template) - 1) / len(template)
+	uc.log().Info("Rendering photo book", "photos", len(photos), "pages", total)
+
+	title := cmp.Or(opts.Title, strings.Join(titles, ", "))
+	photoArea, titleArea := r.split(r.content, 0.8)
+	if err := doc.addPage(ctx, photos[:1], r.place(photoArea, bookTemplates[LayoutSingle]), func(page *image.RGBA) {
+		r.drawTitle(page, r.faces.title, title, titleArea)
+	}); err != nil {
+		return nil, err
+	}
+
+	photoArea, footer := r.splitFooter(r.content)
+	for start := 0; start < len(photos); start += len(template) {
+		pageNumber := start/len(template) + 1
+		pagePhotos := photos[start:min(start+len(template), len(photos))]
+		slots := r.place(photoArea, template)[:len(pagePhotos)]
+		if err := doc.addPage(ctx, pagePhotos, slots, func(page *image.RGBA) {
+			r.drawTitle(page, r.faces.small, strconv.Itoa(pageNumber), footer)
+		}); err != nil {
+			return nil, err
+		}
+		uc.log().Info("Rendered photo book page", "page", pageNumber, "pages", total)
+	}
+
+	return doc.write(opts.Output)
+}
+
+// albumPhotos returns the photos of the albums in album order, each once, and the album titles.
+// Videos are left out.
+func (uc *LayoutUseCase) albumPhotos(ctx context.Context, albumIDs []string) ([]domain.MediaItem, []string, error) {
+	if len(albumIDs) == 0 {
+		return nil, nil, fmt.Errorf("at least one album id is required")
+	}
+
+	var photos []domain.MediaItem
+	var titles []string
+	seen := make(map[string]bool)
+	for _, albumID := range albumIDs {
+		uc.log().Info("Fetching media items of album", "album_id", albumID)
+
+		album, err := uc.albumRepo.GetAlbumByID(albumID)
+		if err != nil {
+			uc.log().Error("Failed to fetch album", "album_id", albumID, "error", err)
+			return nil, nil, err
+		}
+		titles = append(titles, album.Title)
+
+		req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+		items, err := collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItems(albumID, req)
+		}))
+		if err != nil {
+			uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+			return nil, nil, err
+		}
+		for _, item := range items {
+			if !item.IsVideo() && !seen[item.ID] {
+				seen[item.ID] = true
+				photos = append(photos, item)
+			}
+		}
+	}
+
+	if len(photos) == 0 {
+		return nil, nil, fmt.Errorf("the albums have no photos")
+	}
+	return photos, titles, nil
+}
+
+// pickCalendarPhotos chooses the cover photo and the photo of each month, preferring photos taken
+// in that month of year, then in that month of any year, then any photo not used yet. Photos are
+// reused only when there are fewer than months. Months are those of the creation time in loc.
+func pickCalendarPhotos(photos []domain.MediaItem, year int, loc *time.Location) (domain.MediaItem, [12]domain.MediaItem) {
+	var months [12]domain.MediaItem
+	filled := make([]bool, 12)
+	used := make(map[string]bool)
+
+	pick := func(match func(taken time.Time, month time.Month) bool) {
+		for m := range months {
+			if filled[m] {
+				continue
+			}
+			for _, photo := range photos {
+				taken := creationTimeIn(photo, loc)
+				if used[photo.ID] || taken.IsZero() {
+					continue
+				}
+				if match(taken, time.Month(m+1)) {
+					months[m], filled[m], used[photo.ID] = photo, true, true
+					break
+				}
+			}
+		}
+	}
+	pick(func(taken time.Time, month time.Month) bool { return taken.Year() == year && taken.Month() == month })
+	pick(func(taken time.Time, month time.Month) bool { return taken.Month() == month })
+
+	var unused []domain.MediaItem
+	for _, photo := range photos {
+		if !used[photo.ID] {
+			unused = append(unused, photo)
+		}
+	}
+	next := 0
+	for m := range months {
+		if !filled[m] {
+			if next < len(unused) {
+				months[m] = unused[next]
+			} else {
+				months[m] = photos[(next-len(unused))%len(photos)]
+			}
+			next++
+		}
+	}
+
+	if next < len(unused) {
+		return unused[next], months
+	}
+	return photos[0], months
+}
+
+// photosInMonths keeps the photos taken in any of the months as seen in loc, keeping their order
+func photosInMonths(photos []domain.MediaItem, months []time.Time, loc *time.Location) []domain.MediaItem {
+	var kept []domain.MediaItem
+	for _, photo := range photos {
+		taken := creationTimeIn(photo, loc)
+		if taken.IsZero() {
+			continue
+		}
+		for _, month := range months {
+			if taken.Year() == month.Year() && taken.Month() == month.Month() {
+				kept = append(kept, photo)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// layoutDocument collects the pages of a calendar or photo book as they are rendered
+type layoutDocument struct {
+	uc      *LayoutUseCase
+	r       *layoutRenderer
+	workers int
+	pages   []pdfPage
+	result  LayoutResult
+}
+
+// newDocument starts a document of paper size rendered at dpi
+func (uc *LayoutUseCase) newDocument(paper domain.PrintSize, dpi, workers int) (*layoutDocument, error) {
+	if paper.Width <= 0 || paper.Height <= 0 {
+		return nil, fmt.Errorf("a paper size is required")
+	}
+	if dpi < 1 {
+		dpi = DefaultLayoutDPI
+	}
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	r, err := newLayoutRenderer(paper, dpi)
+	if err != nil {
+		return nil, err
+	}
+	return &layoutDocument{uc: uc, r: r, workers: workers}, nil
+}
+
+// addPage downloads the photos of a page cropped to their slots, draws them and lets decorate
+// add the rest of the page, then keeps the page as a JPEG
+func (d *layoutDocument) addPage(ctx context.Context, photos []domain.MediaItem, slots []image.Rectangle, decorate func(page *image.RGBA)) error {
+	images := make([]image.Image, len(photos))
+	runConcurrently(ctx, len(photos), d.workers, func(i int) {
+		img, err := d.uc.photo(photos[i], slots[i])
+		if err != nil {
+			d.uc.log().Warn("Failed to download photo", "media_item_id", photos[i].ID, "error", err)
+			return
+		}
+		images[i] = img
+	}, func(int, error) {})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	page := d.r.newPage()
+	for i, img := range images {
+		if img == nil {
+			d.result.Missing++
+		}
+		d.r.drawPhoto(page, img, slots[i])
+	}
+	decorate(page)
+	d.result.Photos += len(photos)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, page, &jpeg.Options{Quality: sheetJPEGQuality}); err != nil {
+		return fmt.Errorf("failed to encode page: %w", err)
+	}
+	d.pages = append(d.pages, pdfPage{jpeg: buf.Bytes(), width: page.Bounds().Dx(), height: page.Bounds().Dy(), dpi: d.r.dpi})
+	return nil
+}
+
+// write saves the document as a PDF at path
+func (d *layoutDocument) write(path string) (*LayoutResult, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := writeFile(path, func(w io.Writer) error {
+		return writePDF(w, d.pages)
+	}); err != nil {
+		return nil, err
+	}
+
+	d.result.Path = path
+	d.result.Pages = len(d.pages)
+	d.uc.log().Info("Successfully rendered pages", "pages", d.result.Pages, "path", path)
+	return &d.result, nil
+}
+
+// photo downloads a photo cropped and scaled by Google to fill rect
+func (uc *LayoutUseCase) photo(item domain.MediaItem, rect image.Rectangle) (image.Image, error) {
+	content, err := uc.mediaRepo.DownloadMediaItem(item, domain.ImageSize{Width: rect.Dx(), Height: rect.Dy(), Crop: true})
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	img, _, err := image.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode photo: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func takenOn(item domain.MediaItem, year int, month time.Month) domain.MediaItem {
+	item.MediaMetadata.CreationTime = time.Date(year, month, 10, 12, 0, 0, 0, time.UTC)
+	return item
+}
+
+func TestPickCalendarPhotos(t *testing.T) {
+	photos := []domain.MediaItem{
+		takenOn(sized("march-2023", "a.jpg", 4000, 3000), 2023, time.March),
+		takenOn(sized("march-2024", "b.jpg", 4000, 3000), 2024, time.March),
+		takenOn(sized("july-2022", "c.jpg", 4000, 3000), 2022, time.July),
+		sized("undated", "d.jpg", 4000, 3000),
+	}
+
+	cover, months := pickCalendarPhotos(photos, 2024, nil)
+
+	if months[time.March-1].ID != "march-2024" {
+		t.Errorf("Expected March to prefer the photo of the calendar year, got %s", months[time.March-1].ID)
+	}
+	if months[time.July-1].ID != "july-2022" {
+		t.Errorf("Expected July to use a July photo of another year, got %s", months[time.July-1].ID)
+	}
+	// The remaining photos fill January and February before photos are reused
+	if months[time.January-1].ID != "march-2023" || months[time.February-1].ID != "undated" {
+		t.Errorf("Expected unused photos to fill the first months, got %s and %s", months[0].ID, months[1].ID)
+	}
+	if months[time.April-1].ID == "" || cover.ID == "" {
+		t.Errorf("Expected every month and the cover to get a photo, got %+v", months)
+	}
+}
+
+func TestLayoutUseCase_RenderCalendar(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out", "calendar.pdf")
+	letter, _ := domain.ParsePaperSize("letter")
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			takenOn(sized("1", "a.jpg", 4000, 3000), 2025, time.May),
+			{ID: "2", Filename: "clip.mp4", BaseURL: "https://img/2", MimeType: "video/mp4"},
+		},
+	}
+	albums := &MockAlbumRepository{albums: []domain.Album{{ID: "album", Title: "Family"}}}
+	useCase := NewLayoutUseCase(albums, repo)
+
+	// Serve the cover photo smaller than its slot, as Google does for small originals
+	r, err := newLayoutRenderer(letter, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photoArea, _ := r.split(r.content, 0.8)
+	cover := r.place(photoArea, bookTemplates[LayoutSingle])[0]
+	repo.files = map[string]string{
+		fmt.Sprintf("https://img/1=w%d-h%d-c", cover.Dx(), cover.Dy()): pngThumbnail(t, 10),
+	}
+
+	result, err := useCase.RenderCalendar(context.Background(), CalendarOptions{
+		AlbumIDs: []string{"album"}, Year: 2025, Paper: letter, Output: out, DPI: 20,
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Only the cover size is served; the month pages show placeholders
+	want := LayoutResult{Path: out, Pages: 13, Photos: 13, Missing: 12}
+	if *result != want {
+		t.Errorf("Expected %+v, got %+v", want, *result)
+	}
+	for _, url := range repo.downloads {
+		if !strings.HasPrefix(url, "https://img/1=w") || !strings.HasSuffix(url, "-c") {
+			t.Errorf("Expected only the photo to be downloaded cropped, got %s", url)
+		}
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Letter at 20 DPI is 170x220 pixels, placed as 612x792 points
+	if !strings.Contains(string(data), "/Count 13") || !strings.Contains(string(data), "/MediaBox [0 0 612.00 792.00]") {
+		t.Errorf("Expected 13 letter pages in the PDF")
+	}
+}
+
+func TestLayoutUseCase_RenderPhotoBook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "book.pdf")
+	a4, _ := domain.ParsePaperSize("a4")
+	var items []domain.MediaItem
+	for i := range 6 {
+		items = append(items, takenOn(sized(fmt.Sprint(i), fmt.Sprintf("%d.jpg", i), 4000, 3000), 2024, time.Month(1+i%2)))
+	}
+	repo := &MockMediaItemRepository{
+		albumItems: map[string][]domain.MediaItem{"a": items[:4], "b": items[2:]},
+	}
+	albums := &MockAlbumRepository{albums: []domain.Album{{ID: "a", Title: "Spring"}, {ID: "b", Title: "Summer"}}}
+	useCase := NewLayoutUseCase(albums, repo)
+
+	result, err := useCase.RenderPhotoBook(context.Background(), PhotoBookOptions{
+		AlbumIDs: []string{"a", "b"}, Layout: LayoutGrid, Paper: a4, Output: out, DPI: 20,
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 6 distinct photos on a cover and two grid pages
+	if result.Pages != 3 || result.Photos != 7 {
+		t.Errorf("Expected 3 pages holding the cover and 6 photos, got %+v", result)
+	}
+
+	january, _ := time.Parse("2006-01", "2024-01")
+	result, err = useCase.RenderPhotoBook(context.Background(), PhotoBookOptions{
+		AlbumIDs: []string{"a", "b"}, Months: []time.Time{january}, Layout: LayoutTwo, Paper: a4, Output: out, DPI: 20,
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Photos 0, 2 and 4 were taken in January: a cover and two pages of two
+	if result.Pages != 3 || result.Photos != 4 {
+		t.Errorf("Expected only January photos, got %+v", result)
+	}
+}
+
+func TestLayoutUseCase_RenderPhotoBookInvalid(t *testing.T) {
+	a4, _ := domain.ParsePaperSize("a4")
+	useCase := NewLayoutUseCase(&MockAlbumRepository{albums: []domain.Album{{ID: "a"}}}, &MockMediaItemRepository{})
+
+	if _, err := useCase.RenderPhotoBook(context.Background(), PhotoBookOptions{AlbumIDs: []string{"a"}, Layout: "spread", Paper: a4}); err == nil || !strings.Contains(err.Error(), "unknown photo book layout") {
+		t.Errorf("Expected an unknown layout error, got %v", err)
+	}
+	if _, err := useCase.RenderPhotoBook(context.Background(), PhotoBookOptions{AlbumIDs: []string{"a"}, Layout: LayoutSingle, Paper: a4}); err == nil || !strings.Contains(err.Error(), "no photos") {
+		t.Errorf("Expected an error for an album without photos, got %v", err)
+	}
+}
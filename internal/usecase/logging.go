@@ -0,0 +1,22 @@
+package usecase
+
+import "log/slog"
+
+// logging gives a use case the logger it reports progress and failures to. Every use case
+// embeds it; the zero value reports to slog.Default().
+type logging struct {
+	logger *slog.Logger
+}
+
+// SetLogger replaces the logger the use case reports to; nil restores slog.Default()
+func (l *logging) SetLogger(logger *slog.Logger) {
+	l.logger = logger
+}
+
+// log returns the logger to report to
+func (l *logging) log() *slog.Logger {
+	if l.logger == nil {
+		return slog.Default()
+	}
+	return l.logger
+}
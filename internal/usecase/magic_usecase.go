@@ -0,0 +1,258 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MagicOptions configures how magic rules are applied
+type MagicOptions struct {
+	// DryRun reports what would change without creating albums or adding media items
+	DryRun bool
+	// TimeZone decides which day media items were taken on for rules without a time zone of
+	// their own; nil uses UTC
+	TimeZone *time.Location
+}
+
+// MagicResult is the outcome of applying one rule
+type MagicResult struct {
+	Album   string `json:"album"`
+	AlbumID string `json:"albumId,omitempty"`
+	// Created is set when the album did not exist yet; in a dry run it would be created
+	Created bool   `json:"created"`
+	Matched int    `json:"matched"`
+	Added   int    `json:"added"`
+	Error   string `json:"error,omitempty"`
+}
+
+// MagicUseCase implements the business logic for magic albums: app-owned albums kept populated
+// with the media items that match a rule. Applying the rules again only adds what is missing.
+type MagicUseCase struct {
+	logging
+
+	rules     domain.MagicRuleRepository
+	mediaRepo domain.MediaItemRepository
+	albums    *AlbumUseCase
+	exif      domain.ExifRepository
+}
+
+// NewMagicUseCase creates a new instance of MagicUseCase
+func NewMagicUseCase(rules domain.MagicRuleRepository, albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository) *MagicUseCase {
+	return &MagicUseCase{
+		rules:     rules,
+		mediaRepo: mediaRepo,
+		albums:    NewAlbumUseCase(albumRepo),
+	}
+}
+
+// SetLogger replaces the logger the use case and the use case it builds on report to
+func (uc *MagicUseCase) SetLogger(logger *slog.Logger) {
+	uc.logging.SetLogger(logger)
+	uc.albums.SetLogger(logger)
+}
+
+// SetExifRepository provides the EXIF data recorded while uploading, which location rules match
+// against; without it they fail
+func (uc *MagicUseCase) SetExifRepository(exif domain.ExifRepository) {
+	uc.exif = exif
+}
+
+// Apply creates the album of every rule that has none yet and adds the matching media items it
+// does not contain. Albums are matched to rules by title among the albums the app can write to.
+// A rule that fails is reported in its result without stopping the others.
+func (uc *MagicUseCase) Apply(ctx context.Context, opts MagicOptions) ([]MagicResult, error) {
+	rules, err := uc.rules.LoadMagicRules()
+	if err != nil {
+		uc.log().Error("Failed to load magic rules", "error", err)
+		return nil, err
+	}
+
+	albums, err := uc.albums.ListAllAlbums(ctx, domain.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]domain.Album)
+	for _, album := range albums {
+		if _, ok := owned[album.Title]; album.IsWriteable && !ok {
+			owned[album.Title] = album
+		}
+	}
+
+	places, err := uc.loadPlaces(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Applying magic rules", "rules", len(rules))
+
+	results := make([]MagicResult, 0, len(rules))
+	for _, rule := range rules {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := MagicResult{Album: rule.Album}
+		if err := uc.applyRule(ctx, rule, owned, places, &result, opts); err != nil {
+			uc.log().Error("Failed to apply magic rule", "album", rule.Album, "error", err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	uc.log().Info("Successfully applied magic rules", "rules", len(rules))
+	return results, nil
+}
+
+// loadPlaces returns where the uploaded photos were taken by media item ID, if any of rules has a
+// location
+func (uc *MagicUseCase) loadPlaces(rules []domain.MagicRule) (map[string]domain.GeoPoint, error) {
+	if !slices.ContainsFunc(rules, func(rule domain.MagicRule) bool { return rule.Location != nil }) {
+		return nil, nil
+	}
+	if uc.exif == nil {
+		return nil, fmt.Errorf("location rules need the EXIF data recorded while uploading")
+	}
+	exif, err := uc.exif.LoadExif()
+	if err != nil {
+		return nil, err
+	}
+	places := make(map[string]domain.GeoPoint)
+	for id, data := range exif {
+		if data.Location != nil {
+			places[id] = *data.Location
+		}
+	}
+	return places, nil
+}
+
+// applyRule brings the album of one rule up to date, recording what it did in result
+func (uc *MagicUseCase) applyRule(ctx context.Context, rule domain.MagicRule, owned map[string]domain.Album, places map[string]domain.GeoPoint, result *MagicResult, opts MagicOptions) error {
+	matched, err := uc.matchingMediaItems(ctx, rule, places, opts.TimeZone)
+	if err != nil {
+		return err
+	}
+	result.Matched = len(matched)
+
+	album, ok := owned[rule.Album]
+	members := make(map[string]bool)
+	switch {
+	case ok:
+		result.AlbumID = album.ID
+		items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItems(album.ID, req)
+		}))
+		if err != nil {
+			return fmt.Errorf("failed to list album media items: %w", err)
+		}
+		for _, item := range items {
+			members[item.ID] = true
+		}
+	case len(matched) == 0:
+		// An album is only worth creating once something belongs in it
+		return nil
+	case opts.DryRun:
+		result.Created = true
+	default:
+		created, err := uc.albums.CreateAlbum(ctx, rule.Album)
+		if err != nil {
+			return err
+		}
+		owned[rule.Album] = *created
+		result.AlbumID, result.Created = created.ID, true
+	}
+
+	var missing []string
+	for _, item := range matched {
+		if !members[item.ID] {
+			missing = append(missing, item.ID)
+		}
+	}
+	if len(missing) == 0 || opts.DryRun {
+		result.Added = len(missing)
+		return nil
+	}
+
+	if err := uc.albums.AddMediaItems(ctx, result.AlbumID, missing); err != nil {
+		return err
+	}
+	result.Added = len(missing)
+	return nil
+}
+
+// matchingMediaItems searches with the filters the API supports and checks the filename pattern
+// locally, since the API cannot filter by file name. Dates are checked again in the time zone of
+// the rule, or loc, since the API picks its own. Locations are looked up in places, and a rule
+// the API cannot filter for only fetches the media items found there rather than the library.
+func (uc *MagicUseCase) matchingMediaItems(ctx context.Context, rule domain.MagicRule, places map[string]domain.GeoPoint, loc *time.Location) ([]domain.MediaItem, error) {
+	uc.log().Info("Fetching media items for magic album", "album", rule.Album)
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	filters := rule.Filters()
+	unfiltered := len(filters.DateRanges) == 0 && len(filters.ContentCategories) == 0 && filters.MediaType == ""
+	if rule.Location != nil && unfiltered {
+		return uc.mediaItemsAt(ctx, rule, places)
+	}
+
+	fetch := func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.mediaRepo.SearchMediaItemsByFilters(filters, req)
+	}
+	if unfiltered {
+		fetch = uc.mediaRepo.ListMediaItems
+	}
+
+	var matched []domain.MediaItem
+	for item, err := range paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, fetch) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to search media items: %w", err)
+		}
+		if rule.MatchesFilename(item.Filename) && rule.MatchesDate(creationTime(item), loc) && rule.MatchesLocation(place(places, item.ID)) {
+			matched = append(matched, item)
+		}
+	}
+	return matched, nil
+}
+
+// mediaItemsAt fetches the media items in places that lie within the rule's location and match
+// its filename pattern. Media items deleted since they were uploaded are left out.
+func (uc *MagicUseCase) mediaItemsAt(ctx context.Context, rule domain.MagicRule, places map[string]domain.GeoPoint) ([]domain.MediaItem, error) {
+	var ids []string
+	for id, p := range places {
+		if rule.Location.Contains(p) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	var matched []domain.MediaItem
+	for batch := range slices.Chunk(ids, domain.MaxBatchMediaItems) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		items, err := uc.mediaRepo.BatchGetMediaItems(batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get media items: %w", err)
+		}
+		for _, item := range items {
+			if rule.MatchesFilename(item.Filename) {
+				matched = append(matched, item)
+			}
+		}
+	}
+	return matched, nil
+}
+
+// place returns where the media item id was taken according to places, or nil if unknown
+func place(places map[string]domain.GeoPoint, id string) *domain.GeoPoint {
+	p, ok := places[id]
+	if !ok {
+		return nil
+	}
+	return &p
+}
@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockMagicRuleRepository is a mock implementation for testing
+type MockMagicRuleRepository struct {
+	rules []domain.MagicRule
+}
+
+func (m *MockMagicRuleRepository) LoadMagicRules() ([]domain.MagicRule, error) {
+	return m.rules, nil
+}
+
+func TestMagicUseCase_Apply(t *testing.T) {
+	rules := &MockMagicRuleRepository{rules: []domain.MagicRule{
+		{Album: "Trip", ContentCategories: []domain.ContentCategory{domain.ContentCategoryTravel}, FilenamePattern: "img_*"},
+		{Album: "Camera", FilenamePattern: "DSC_*"},
+		{Album: "Nothing", FilenamePattern: "none_*"},
+	}}
+	albumRepo := &MockAlbumRepository{albums: []domain.Album{
+		{ID: "shared", Title: "Camera"},
+		{ID: "a1", Title: "Trip", IsWriteable: true},
+	}}
+	mediaRepo := &MockMediaItemRepository{
+		recent:     []domain.MediaItem{{ID: "m1", Filename: "IMG_1.jpg"}, {ID: "m2", Filename: "IMG_2.jpg"}, {ID: "m3", Filename: "DSC_3.jpg"}},
+		items:      []domain.MediaItem{{ID: "m3", Filename: "DSC_3.jpg"}, {ID: "m4", Filename: "DSC_4.jpg"}},
+		albumItems: map[string][]domain.MediaItem{"a1": {{ID: "m1"}}},
+	}
+	useCase := NewMagicUseCase(rules, albumRepo, mediaRepo)
+
+	results, err := useCase.Apply(context.Background(), MagicOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []MagicResult{
+		{Album: "Trip", AlbumID: "a1", Matched: 2, Added: 1},
+		// The shared album with the same title is not writeable, so a new one is created
+		{Album: "Camera", AlbumID: "test-id", Created: true, Matched: 2, Added: 2},
+		{Album: "Nothing"},
+	}
+	if !slices.Equal(results, want) {
+		t.Errorf("Expected %+v, got %+v", want, results)
+	}
+	if len(mediaRepo.filterSearches) != 1 || mediaRepo.filterSearches[0].ContentCategories[0] != domain.ContentCategoryTravel {
+		t.Errorf("Expected one search by content category, got %+v", mediaRepo.filterSearches)
+	}
+	if len(albumRepo.batches) != 2 || !slices.Equal(albumRepo.batches[0], []string{"m2"}) || !slices.Equal(albumRepo.batches[1], []string{"m3", "m4"}) {
+		t.Errorf("Expected only missing media items to be added, got %v", albumRepo.batches)
+	}
+}
+
+func TestMagicUseCase_ApplyDryRun(t *testing.T) {
+	rules := &MockMagicRuleRepository{rules: []domain.MagicRule{{Album: "Camera", FilenamePattern: "*.jpg"}}}
+	albumRepo := &MockAlbumRepository{}
+	mediaRepo := &MockMediaItemRepository{items: []domain.MediaItem{{ID: "m1", Filename: "a.jpg"}}}
+	useCase := NewMagicUseCase(rules, albumRepo, mediaRepo)
+
+	results, err := useCase.Apply(context.Background(), MagicOptions{DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 1 || results[0] != (MagicResult{Album: "Camera", Created: true, Matched: 1, Added: 1}) {
+		t.Errorf("Expected the album to be reported as created, got %+v", results)
+	}
+	if len(albumRepo.batches) != 0 {
+		t.Errorf("Expected no changes in a dry run, got %v", albumRepo.batches)
+	}
+}
+
+func TestMagicUseCase_ApplyLocation(t *testing.T) {
+	paris := &domain.GeoArea{Center: domain.GeoPoint{Latitude: 48.8566, Longitude: 2.3522}, RadiusKm: 10}
+	rules := &MockMagicRuleRepository{rules: []domain.MagicRule{
+		{Album: "Paris", Location: paris},
+		{Album: "Paris Videos", Location: paris, MediaType: domain.MediaTypeVideo},
+	}}
+	mediaRepo := &MockMediaItemRepository{
+		items:  []domain.MediaItem{{ID: "m1", Filename: "eiffel.jpg"}, {ID: "m2", Filename: "louvre.jpg"}, {ID: "m3", Filename: "nice.jpg"}},
+		recent: []domain.MediaItem{{ID: "m2", Filename: "louvre.mp4"}, {ID: "m3", Filename: "nice.mp4"}, {ID: "m4", Filename: "unknown.mp4"}},
+	}
+	exif := &MockExifRepository{exif: map[string]domain.ExifData{
+		"m1": {MediaItemID: "m1", Location: &domain.GeoPoint{Latitude: 48.8584, Longitude: 2.2945}},
+		"m2": {MediaItemID: "m2", Location: &domain.GeoPoint{Latitude: 48.8606, Longitude: 2.3376}},
+		"m3": {MediaItemID: "m3", Location: &domain.GeoPoint{Latitude: 43.7102, Longitude: 7.2620}},
+		// Deleted since it was uploaded
+		"m5": {MediaItemID: "m5", Location: &domain.GeoPoint{Latitude: 48.8566, Longitude: 2.3522}},
+	}}
+	useCase := NewMagicUseCase(rules, &MockAlbumRepository{}, mediaRepo)
+
+	if _, err := useCase.Apply(context.Background(), MagicOptions{DryRun: true}); err == nil {
+		t.Fatal("Expected location rules to fail without EXIF data")
+	}
+
+	useCase.SetExifRepository(exif)
+	results, err := useCase.Apply(context.Background(), MagicOptions{DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []MagicResult{
+		{Album: "Paris", Created: true, Matched: 2, Added: 2},
+		{Album: "Paris Videos", Created: true, Matched: 1, Added: 1},
+	}
+	if !slices.Equal(results, want) {
+		t.Errorf("Expected %+v, got %+v", want, results)
+	}
+	// The location alone is looked up by ID rather than by listing the library
+	if len(mediaRepo.filterSearches) != 1 || mediaRepo.filterSearches[0].MediaType != domain.MediaTypeVideo {
+		t.Errorf("Expected one search for videos, got %+v", mediaRepo.filterSearches)
+	}
+}
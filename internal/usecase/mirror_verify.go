@@ -0,0 +1,286 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// ManifestFile is the checksum manifest sync writes into the directory it mirrors originals to.
+// It is in the format of sha256sum, so copies of the mirror can be checked with sha256sum -c too.
+const ManifestFile = "SHA256SUMS"
+
+// MirrorFileStatus is what checking a file of a mirror found
+type MirrorFileStatus string
+
+// Outcomes of checking a file of a mirror
+const (
+	MirrorOK MirrorFileStatus = "ok"
+	// MirrorCorrupt marks a file whose content no longer has the checksum taken when it was downloaded
+	MirrorCorrupt MirrorFileStatus = "corrupt"
+	// MirrorMissing marks a file of the sync state or manifest that is gone from the directory
+	MirrorMissing MirrorFileStatus = "missing"
+	// MirrorUnreadable marks a file that could not be read
+	MirrorUnreadable MirrorFileStatus = "unreadable"
+	// MirrorRecorded marks a file without a checksum, such as one downloaded by an earlier
+	// version, whose checksum is now recorded for the next checks
+	MirrorRecorded MirrorFileStatus = "recorded"
+	// MirrorUntracked marks a file in the directory that sync did not download
+	MirrorUntracked MirrorFileStatus = "untracked"
+)
+
+// VerifyOptions configures a check of a mirror
+type VerifyOptions struct {
+	// Dir is the mirror to check; empty checks the directory of the last sync
+	Dir string
+	// Workers is the number of files hashed at a time; values below 1 use the default
+	Workers int
+}
+
+// MirrorFile is the outcome of checking one file of a mirror
+type MirrorFile struct {
+	Status      MirrorFileStatus `json:"status"`
+	Path        string           `json:"path"`
+	MediaItemID string           `json:"mediaItemId,omitempty"`
+	// Expected is the recorded SHA-256 of the file and Actual the one it has now
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MirrorReport is the outcome of checking a mirror
+type MirrorReport struct {
+	Dir   string       `json:"dir"`
+	Files []MirrorFile `json:"files"`
+}
+
+// Count returns the number of files with the given status
+func (r *MirrorReport) Count(status MirrorFileStatus) int {
+	n := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Problems returns the number of files that are corrupt, missing or unreadable
+func (r *MirrorReport) Problems() int {
+	return r.Count(MirrorCorrupt) + r.Count(MirrorMissing) + r.Count(MirrorUnreadable)
+}
+
+// VerifyMirror hashes every file of a mirror again, through a pool of workers, and compares it
+// with the checksum the sync state recorded when it was downloaded, or else with the manifest in
+// the directory, which is all a copy of the mirror elsewhere has. Files of the directory of the
+// last sync that have no checksum yet get the one they have now.
+func (uc *SyncUseCase) VerifyMirror(ctx context.Context, opts VerifyOptions) (*MirrorReport, error) {
+	state, err := uc.state.LoadSyncState()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = state.Dir
+	}
+	if dir == "" {
+		return nil, errors.New("no originals were synced yet; give the directory of a mirror")
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, fmt.Errorf("invalid mirror directory: %w", err)
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	tracked := state.Dir == dir
+	if !tracked && manifest == nil {
+		return nil, fmt.Errorf("%s is not a mirror: it has no %s and is not the directory of the last sync", dir, ManifestFile)
+	}
+
+	files := make(map[string]*MirrorFile)
+	if tracked {
+		for id, name := range state.Files {
+			files[name] = &MirrorFile{Path: filepath.Join(dir, name), MediaItemID: id, Expected: state.Checksums[id]}
+			if files[name].Expected == "" {
+				files[name].Expected = manifest[name]
+			}
+		}
+	}
+	for name, sum := range manifest {
+		if files[name] == nil {
+			files[name] = &MirrorFile{Path: filepath.Join(dir, name), Expected: sum}
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	uc.log().Info("Verifying mirror", "dir", dir, "files", len(names))
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+	runConcurrently(ctx, len(names), workers, func(i int) {
+		checkMirrorFile(files[names[i]])
+	}, func(i int, err error) {
+		files[names[i]].Status, files[names[i]].Error = MirrorUnreadable, err.Error()
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &MirrorReport{Dir: dir, Files: make([]MirrorFile, 0, len(names))}
+	recorded := false
+	for _, name := range names {
+		file := files[name]
+		report.Files = append(report.Files, *file)
+		// Checksums found only in the manifest are taken into the sync state once they match
+		if (file.Status == MirrorRecorded || file.Status == MirrorOK) && file.MediaItemID != "" && state.Checksums[file.MediaItemID] == "" {
+			if state.Checksums == nil {
+				state.Checksums = make(map[string]string)
+			}
+			state.Checksums[file.MediaItemID] = file.Actual
+			recorded = true
+		}
+		if file.Status == MirrorCorrupt || file.Status == MirrorMissing {
+			uc.log().Warn("Mirror file failed verification", "path", file.Path, "status", file.Status)
+		}
+	}
+
+	untracked, err := untrackedFiles(dir, files)
+	if err != nil {
+		return nil, err
+	}
+	report.Files = append(report.Files, untracked...)
+
+	if recorded {
+		if err := uc.state.SaveSyncState(*state); err != nil {
+			return nil, err
+		}
+		if err := writeManifest(dir, state); err != nil {
+			return nil, fmt.Errorf("failed to write the checksum manifest: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// checkMirrorFile hashes the file and sets its status
+func checkMirrorFile(file *MirrorFile) {
+	sum, err := fileChecksum(file.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		file.Status = MirrorMissing
+	case err != nil:
+		file.Status, file.Error = MirrorUnreadable, err.Error()
+	case file.Expected == "":
+		file.Status, file.Actual = MirrorRecorded, sum
+	case sum != file.Expected:
+		file.Status, file.Actual = MirrorCorrupt, sum
+	default:
+		file.Status, file.Actual = MirrorOK, sum
+	}
+}
+
+// untrackedFiles lists the files of dir that are not in files, leaving out the manifest and
+// hidden files such as unfinished downloads
+func untrackedFiles(dir string, files map[string]*MirrorFile) ([]MirrorFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mirror directory: %w", err)
+	}
+
+	var untracked []MirrorFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == ManifestFile || strings.HasPrefix(name, ".") || files[name] != nil {
+			continue
+		}
+		untracked = append(untracked, MirrorFile{Status: MirrorUntracked, Path: filepath.Join(dir, name)})
+	}
+	return untracked, nil
+}
+
+// fileChecksum returns the SHA-256 of the file at path in hex
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readManifest reads the manifest of dir into a map of file names to checksums; it returns nil
+// when dir has no manifest
+func readManifest(dir string) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checksum manifest: %w", err)
+	}
+	defer f.Close()
+
+	manifest := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		// sha256sum marks files hashed in binary mode with '*' instead of a second space
+		sum, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || len(sum) != sha256.Size*2 || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("%s:%d: invalid checksum line", filepath.Join(dir, ManifestFile), line)
+		}
+		manifest[name[1:]] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the checksum manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeManifest replaces the manifest of dir with the checksums in state, sorted by file name.
+// It is written to a temporary file and renamed, so a crash keeps the previous manifest.
+func writeManifest(dir string, state *domain.SyncState) error {
+	names := make([]string, 0, len(state.Files))
+	sums := make(map[string]string, len(state.Files))
+	for id, name := range state.Files {
+		// sha256sum escapes such names, which sync never picks anyway
+		if sum := state.Checksums[id]; sum != "" && !strings.ContainsAny(name, "\n\\") {
+			names = append(names, name)
+			sums[name] = sum
+		}
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+
+	path := filepath.Join(dir, ManifestFile)
+	tmp := filepath.Join(dir, "."+ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestSyncUseCase_VerifyMirror(t *testing.T) {
+	dir := t.TempDir()
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	mediaRepo := &MockMediaItemRepository{
+		items: []domain.MediaItem{createdAt("m1", "a.jpg", jan), createdAt("m2", "b.jpg", jan), createdAt("m3", "c.jpg", jan)},
+		files: map[string]string{
+			"https://photos.example/m1=d": "one",
+			"https://photos.example/m2=d": "two",
+			"https://photos.example/m3=d": "three",
+		},
+	}
+	state := &MockSyncStateStore{}
+	uc := NewSyncUseCase(&MockAlbumRepository{}, mediaRepo, &MockIndexRepository{}, state)
+	if _, err := uc.Sync(context.Background(), SyncOptions{Dir: dir, Workers: 2}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatalf("Expected the sync to write a manifest, got %v", err)
+	}
+	// sha256sum -c format: checksum, two spaces, file name
+	if !strings.Contains(string(manifest), "7692c3ad3540bb803c020b3aee66cd8887123234ea0c6e7143c0add73ff431ed  a.jpg\n") {
+		t.Errorf("Expected the checksum of a.jpg in the manifest, got:\n%s", manifest)
+	}
+
+	// A copy of the mirror is checked against its manifest alone
+	copyDir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", ManifestFile} {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		os.WriteFile(filepath.Join(copyDir, name), b, 0o644)
+	}
+	report, err := uc.VerifyMirror(context.Background(), VerifyOptions{Dir: copyDir})
+	if err != nil || report.Count(MirrorOK) != 3 || report.Problems() != 0 {
+		t.Errorf("Expected the copy to pass, got %+v (%v)", report, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("onE"), 0o644)
+	os.Remove(filepath.Join(dir, "b.jpg"))
+	os.WriteFile(filepath.Join(dir, "stray.jpg"), []byte("?"), 0o644)
+	delete(state.state.Checksums, "m3")
+
+	report, err = uc.VerifyMirror(context.Background(), VerifyOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got := make(map[string]MirrorFileStatus)
+	for _, file := range report.Files {
+		got[filepath.Base(file.Path)] = file.Status
+	}
+	want := map[string]MirrorFileStatus{"a.jpg": MirrorCorrupt, "b.jpg": MirrorMissing, "c.jpg": MirrorOK, "stray.jpg": MirrorUntracked}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("Expected %s to be %s, got %s", name, status, got[name])
+		}
+	}
+	if report.Problems() != 2 {
+		t.Errorf("Expected 2 problems, got %d", report.Problems())
+	}
+	// The checksum missing from the state is taken from the manifest
+	if state.state.Checksums["m3"] == "" {
+		t.Error("Expected the checksum of c.jpg to be recorded again")
+	}
+
+	if _, err := uc.VerifyMirror(context.Background(), VerifyOptions{Dir: t.TempDir()}); err == nil || !strings.Contains(err.Error(), "is not a mirror") {
+		t.Errorf("Expected an error for a directory that is not a mirror, got %v", err)
+	}
+}
@@ -1,81 +1,206 @@
 package usecase
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/oauth2"
 	"krupesh.faldu/internal/domain"
 )
 
+const (
+	defaultCallbackAddr = "localhost:8080"
+	defaultCallbackPath = "/oauth2callback"
+	defaultAuthTimeout  = 10 * time.Minute
+	stateLength         = 16
+	defaultSuccessHTML  = `
+					<html>
+						<body>
+							<h1>Authorization Successful!</h1>
+							<p>You can close this window now.</p>
+							<script>window.close();</script>
+						</body>
+					</html>
+				`
+)
+
+// CallbackServerConfig configures the local server that captures the OAuth2 callback
+type CallbackServerConfig struct {
+	// Addr is the listen address; if it is unavailable a free port on the same host is used
+	Addr string
+	// Path is the redirect path handled by the server
+	Path string
+	// SuccessHTML is the page shown in the browser after a successful authorization
+	SuccessHTML string
+	// Timeout bounds how long the server waits for the browser to return
+	Timeout time.Duration
+}
+
+// DefaultCallbackServerConfig returns the callback server configuration used when none is set
+func DefaultCallbackServerConfig() CallbackServerConfig {
+	return CallbackServerConfig{
+		Addr:        defaultCallbackAddr,
+		Path:        defaultCallbackPath,
+		SuccessHTML: defaultSuccessHTML,
+		Timeout:     defaultAuthTimeout,
+	}
+}
+
 // OAuthUseCase implements the business logic for OAuth operations
 type OAuthUseCase struct {
-	oauthService domain.OAuthService
+	logging
+	cleanup
+
+	oauthService   domain.OAuthService
+	callbackConfig CallbackServerConfig
+	random         io.Reader
+	presentURL     func(url string)
 }
 
 // NewOAuthUseCase creates a new instance of OAuthUseCase
 func NewOAuthUseCase(oauthService domain.OAuthService) *OAuthUseCase {
 	return &OAuthUseCase{
-		oauthService: oauthService,
+		oauthService:   oauthService,
+		callbackConfig: DefaultCallbackServerConfig(),
+		random:         rand.Reader,
 	}
 }
 
+// SetRandomSource replaces the source of randomness used for state values.
+// Tests and reproducibility-sensitive callers can pass a seeded reader; nil restores crypto/rand.
+func (uc *OAuthUseCase) SetRandomSource(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	uc.random = r
+}
+
+// SetURLPresenter registers fn to be called with every URL the user is asked to open on another
+// device, e.g. to show it as a QR code; nil only prints them
+func (uc *OAuthUseCase) SetURLPresenter(fn func(url string)) {
+	uc.presentURL = fn
+}
+
+// SetCallbackServerConfig overrides the local callback server settings; empty fields keep their defaults
+func (uc *OAuthUseCase) SetCallbackServerConfig(cfg CallbackServerConfig) {
+	defaults := DefaultCallbackServerConfig()
+	if cfg.Addr == "" {
+		cfg.Addr = defaults.Addr
+	}
+	if cfg.Path == "" {
+		cfg.Path = defaults.Path
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		cfg.Path = "/" + cfg.Path
+	}
+	if cfg.SuccessHTML == "" {
+		cfg.SuccessHTML = defaults.SuccessHTML
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	uc.callbackConfig = cfg
+}
+
 // AuthenticateClient handles the OAuth2 authentication flow
 func (uc *OAuthUseCase) AuthenticateClient() (*oauth2.Config, error) {
-	log.Printf("Starting OAuth2 authentication...")
+	uc.log().Info("Starting OAuth2 authentication...")
 
 	config, err := uc.oauthService.GetClient()
 	if err != nil {
-		log.Printf("Failed to get OAuth config: %v", err)
+		uc.log().Error("Failed to get OAuth config", "error", err)
 		return nil, err
 	}
 
 	// Try to load existing token
 	token, err := uc.oauthService.LoadToken()
 	if err != nil {
-		log.Printf("No existing token found, starting OAuth flow...")
+		uc.log().Info("No existing token found, starting OAuth flow...")
 		return config, nil
 	}
 
 	// Validate token
 	if token.Valid() {
-		log.Printf("Valid token found, authentication successful")
+		uc.log().Info("Valid token found, authentication successful")
 		return config, nil
 	}
 
-	log.Printf("Token expired, starting OAuth flow...")
+	uc.log().Info("Token expired, starting OAuth flow...")
 	return config, nil
 }
 
 // CompleteAuthentication completes the OAuth2 flow with the authorization code
 func (uc *OAuthUseCase) CompleteAuthentication(code string) error {
-	log.Printf("Completing OAuth2 authentication with code...")
+	uc.log().Info("Completing OAuth2 authentication with code...")
 
 	token, err := uc.oauthService.ExchangeCode(code)
 	if err != nil {
-		log.Printf("Failed to exchange code for token: %v", err)
+		uc.log().Error("Failed to exchange code for token", "error", err)
 		return err
 	}
 
 	err = uc.oauthService.SaveToken(token)
 	if err != nil {
-		log.Printf("Failed to save token: %v", err)
+		uc.log().Error("Failed to save token", "error", err)
 		return err
 	}
 
-	log.Printf("Authentication completed successfully")
+	uc.log().Info("Authentication completed successfully")
 	return nil
 }
 
-// CompleteAuthenticationWithServer automatically completes OAuth2 flow using a local server
-func (uc *OAuthUseCase) CompleteAuthenticationWithServer() error {
-	log.Printf("Starting OAuth2 flow with local server...")
+// CompleteAuthenticationWithServer automatically completes OAuth2 flow using a local server.
+// The flow ends when a code is received, an error is reported, the configured timeout passes
+// or ctx is cancelled (e.g. on Ctrl-C). In every case the server is shut down and its port
+// released; unless authentication succeeds, the redirect URI is restored and no token is saved.
+func (uc *OAuthUseCase) CompleteAuthenticationWithServer(ctx context.Context) (err error) {
+	uc.log().Info("Starting OAuth2 flow with local server...")
+
+	cfg := uc.callbackConfig
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	// Bind the callback server first so the redirect URI reflects the actual port
+	listener, err := listenForCallback(cfg.Addr, uc.log())
+	if err != nil {
+		uc.log().Error("Failed to start local server", "error", err)
+		return err
+	}
+
+	previousRedirectURL := ""
+	if config, cfgErr := uc.oauthService.GetClient(); cfgErr == nil && config != nil {
+		previousRedirectURL = config.RedirectURL
+	}
+
+	redirectURL := callbackRedirectURL(listener.Addr(), cfg.Path)
+	uc.oauthService.SetRedirectURL(redirectURL)
+	defer func() {
+		// Do not leave the redirect URI pointing at a server that no longer exists
+		if err != nil && previousRedirectURL != "" {
+			uc.oauthService.SetRedirectURL(previousRedirectURL)
+		}
+	}()
 
 	// Generate a random state for security
-	state := "random-state-" + fmt.Sprintf("%d", time.Now().Unix())
+	state, err := uc.generateState()
+	if err != nil {
+		listener.Close()
+		uc.log().Error("Failed to generate state", "error", err)
+		return err
+	}
 
 	// Get the authorization URL with the state
 	authURL := uc.oauthService.GetAuthURLWithState(state)
@@ -84,48 +209,50 @@ func (uc *OAuthUseCase) CompleteAuthenticationWithServer() error {
 	codeChan := make(chan string, 1)
 	errChan := make(chan error, 1)
 
+	// Late or repeated callbacks must not block once the flow has finished
+	reportErr := func(err error) {
+		select {
+		case errChan <- err:
+		default:
+		}
+	}
+
 	// Start local server to capture the callback
 	server := &http.Server{
-		Addr: ":8080",
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Handle OAuth callback
-			if r.URL.Path == "/oauth2callback" {
+			if r.URL.Path == cfg.Path {
 				query := r.URL.Query()
 
 				// Check if there's an error
 				if err := query.Get("error"); err != "" {
-					errChan <- fmt.Errorf("OAuth error: %s", err)
+					reportErr(fmt.Errorf("OAuth error: %s", err))
 					return
 				}
 
 				// Verify state parameter
 				if receivedState := query.Get("state"); receivedState != state {
-					errChan <- fmt.Errorf("invalid state parameter")
+					reportErr(fmt.Errorf("invalid state parameter"))
 					return
 				}
 
 				// Get the authorization code
 				code := query.Get("code")
 				if code == "" {
-					errChan <- fmt.Errorf("no authorization code received")
+					reportErr(fmt.Errorf("no authorization code received"))
 					return
 				}
 
 				// Send success response to browser
 				w.Header().Set("Content-Type", "text/html")
 				w.WriteHeader(http.StatusOK)
-				w.Write([]byte(`
-					<html>
-						<body>
-							<h1>Authorization Successful!</h1>
-							<p>You can close this window now.</p>
-							<script>window.close();</script>
-						</body>
-					</html>
-				`))
+				w.Write([]byte(cfg.SuccessHTML))
 
 				// Send the code through the channel
-				codeChan <- code
+				select {
+				case codeChan <- code:
+				default:
+				}
 			} else {
 				http.NotFound(w, r)
 			}
@@ -134,39 +261,83 @@ func (uc *OAuthUseCase) CompleteAuthenticationWithServer() error {
 
 	// Start the server in a goroutine
 	go func() {
-		log.Printf("Starting local server on http://localhost:8080")
-		log.Printf("Visit this URL in your browser to authorize:")
-		log.Printf("%s", authURL)
+		uc.log().Info("Starting local server", "addr", strings.TrimSuffix(redirectURL, cfg.Path))
+		// Prompts the user has to act on are warnings so --quiet still shows them
+		uc.log().Warn("Visit this URL in your browser to authorize", "url", authURL)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errChan <- fmt.Errorf("server error: %v", err)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			reportErr(fmt.Errorf("server error: %w", err))
 		}
 	}()
 
-	// Wait for the authorization code or an error
+	// Shutdown closes the listener, which releases the port, whichever way the flow ends
+	defer uc.onExit("shut down the OAuth callback server", server.Shutdown)()
+
+	// Wait for the authorization code, an error, the timeout or cancellation
 	select {
 	case code := <-codeChan:
-		// Shutdown the server gracefully
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		server.Shutdown(ctx)
-
 		// Complete the authentication
 		return uc.CompleteAuthentication(code)
 
 	case err := <-errChan:
-		// Shutdown the server gracefully
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		server.Shutdown(ctx)
 		return err
 
-	case <-time.After(10 * time.Minute):
-		// Timeout after 10 minutes
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		server.Shutdown(ctx)
-		return fmt.Errorf("OAuth flow timed out")
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			uc.log().Error("OAuth flow timed out", "timeout", cfg.Timeout)
+			return fmt.Errorf("OAuth flow timed out after %s", cfg.Timeout)
+		}
+		uc.log().Info("OAuth flow cancelled")
+		return fmt.Errorf("OAuth flow cancelled: %w", ctx.Err())
+	}
+}
+
+// CompleteAuthenticationHeadless completes the OAuth2 flow without starting a local server.
+// The authorization URL is printed so it can be opened on any device; the user then pastes
+// either the authorization code or the full redirect URL from the browser's address bar.
+func (uc *OAuthUseCase) CompleteAuthenticationHeadless(input io.Reader) error {
+	uc.log().Info("Starting headless OAuth2 flow...")
+
+	state, err := uc.generateState()
+	if err != nil {
+		uc.log().Error("Failed to generate state", "error", err)
+		return err
+	}
+	authURL := uc.oauthService.GetAuthURLWithState(state)
+
+	// Prompts the user has to act on are warnings so --quiet still shows them
+	uc.log().Warn("Visit this URL on any device to authorize", "url", authURL)
+	uc.present(authURL)
+	uc.log().Warn("After approving access the browser is redirected to a localhost page that may fail to load.")
+	uc.log().Warn("Paste the authorization code or the full URL of that page here")
+
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return fmt.Errorf("failed to read authorization code: %w", err)
+	}
+
+	code, err := parseAuthorizationResponse(strings.TrimSpace(line), state)
+	if err != nil {
+		uc.log().Error("Invalid authorization response", "error", err)
+		return err
+	}
+
+	return uc.CompleteAuthentication(code)
+}
+
+// ResolveAuthFlow returns the flow to use. An explicit flow is kept as is; AuthFlowAuto picks the
+// browser flow on a local graphical session and the paste flow everywhere else, reading the
+// authorization response from stdin even when it is not a terminal.
+func ResolveAuthFlow(flow domain.AuthFlow, env domain.AuthEnvironment) domain.AuthFlow {
+	if flow != domain.AuthFlowAuto && flow != "" {
+		return flow
+	}
+
+	switch {
+	case env.Display && !env.SSH && !env.Container:
+		return domain.AuthFlowBrowser
+	default:
+		return domain.AuthFlowPaste
 	}
 }
 
@@ -179,3 +350,105 @@ func (uc *OAuthUseCase) GetAuthURL() string {
 func (uc *OAuthUseCase) LoadToken() (*oauth2.Token, error) {
 	return uc.oauthService.LoadToken()
 }
+
+// GrantedScopes returns the scopes the stored token was granted; it is empty when they are not
+// known, as for tokens saved before their scopes were recorded
+func (uc *OAuthUseCase) GrantedScopes() ([]string, error) {
+	token, err := uc.oauthService.LoadToken()
+	if err != nil {
+		return nil, err
+	}
+	scope, _ := token.Extra("scope").(string)
+	return strings.Fields(scope), nil
+}
+
+// listenForCallback binds the callback address, falling back to a free port on the same host when
+// another program holds the port. Other failures, such as a host that is not this machine's, are
+// returned, since a free port would fail the same way.
+func listenForCallback(addr string, logger *slog.Logger) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err == nil {
+		return listener, nil
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("failed to listen for OAuth callback on %s: %w", addr, err)
+	}
+
+	host, _, splitErr := net.SplitHostPort(addr)
+	if splitErr != nil {
+		return nil, fmt.Errorf("invalid callback address %s: %w", addr, splitErr)
+	}
+
+	logger.Warn("Callback address unavailable, selecting a free port...", "addr", addr, "error", err)
+	listener, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for OAuth callback: %w", err)
+	}
+	return listener, nil
+}
+
+// callbackRedirectURL builds the loopback redirect URI for the given listener address and path
+func callbackRedirectURL(addr net.Addr, path string) string {
+	host := "localhost"
+	port := ""
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		port = fmt.Sprintf("%d", tcpAddr.Port)
+		if ip := tcpAddr.IP; ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+			host = ip.String()
+		}
+	}
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), path)
+}
+
+// present passes a URL to open on another device to the registered presenter, if any
+func (uc *OAuthUseCase) present(url string) {
+	if uc.presentURL != nil {
+		uc.presentURL(url)
+	}
+}
+
+// generateState returns a random state value used to protect the OAuth2 flow against CSRF
+func (uc *OAuthUseCase) generateState() (string, error) {
+	b := make([]byte, stateLength)
+	if _, err := io.ReadFull(uc.random, b); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return "state-" + hex.EncodeToString(b), nil
+}
+
+// parseAuthorizationResponse extracts the authorization code from user input.
+// The input may be a bare code or a redirect URL carrying code and state query parameters.
+func parseAuthorizationResponse(input, expectedState string) (string, error) {
+	if input == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+
+	if !strings.Contains(input, "code=") && !strings.Contains(input, "error=") {
+		return input, nil
+	}
+
+	query := input
+	if u, err := url.Parse(input); err == nil && u.RawQuery != "" {
+		query = u.RawQuery
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse redirect URL: %w", err)
+	}
+
+	if oauthErr := values.Get("error"); oauthErr != "" {
+		return "", fmt.Errorf("OAuth error: %s", oauthErr)
+	}
+
+	if receivedState := values.Get("state"); receivedState != expectedState {
+		return "", fmt.Errorf("invalid state parameter")
+	}
+
+	code := values.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+
+	return code, nil
+}
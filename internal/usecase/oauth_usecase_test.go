@@ -1,19 +1,29 @@
 package usecase
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/oauth2"
+	"krupesh.faldu/internal/domain"
 )
 
 // MockOAuthService is a mock implementation for testing
 type MockOAuthService struct {
-	config     *oauth2.Config
-	token      *oauth2.Token
-	err        error
-	authURL    string
-	stateValue string
+	config      *oauth2.Config
+	token       *oauth2.Token
+	err         error
+	authURL     string
+	stateValue  string
+	redirectURL string
+	// onAuthURL is called when the flow asks for the authorization URL, once its server listens
+	onAuthURL func()
 }
 
 func (m *MockOAuthService) GetClient() (*oauth2.Config, error) {
@@ -55,9 +65,16 @@ func (m *MockOAuthService) GetAuthURL() string {
 
 func (m *MockOAuthService) GetAuthURLWithState(state string) string {
 	m.stateValue = state
+	if m.onAuthURL != nil {
+		m.onAuthURL()
+	}
 	return m.authURL + "?state=" + state
 }
 
+func (m *MockOAuthService) SetRedirectURL(redirectURL string) {
+	m.redirectURL = redirectURL
+}
+
 func TestOAuthUseCase_CompleteAuthentication(t *testing.T) {
 	// Arrange
 	mockService := &MockOAuthService{}
@@ -115,6 +132,29 @@ func TestOAuthUseCase_LoadToken(t *testing.T) {
 	}
 }
 
+func TestOAuthUseCase_GrantedScopes(t *testing.T) {
+	// Arrange
+	token := (&oauth2.Token{AccessToken: "test-token"}).WithExtra(map[string]any{"scope": domain.ScopeReadAppCreated + " " + domain.ScopeUserInfoEmail})
+	useCase := NewOAuthUseCase(&MockOAuthService{token: token})
+
+	// Act
+	scopes, err := useCase.GrantedScopes()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != domain.ScopeReadAppCreated || scopes[1] != domain.ScopeUserInfoEmail {
+		t.Errorf("Expected the scopes of the token, got %v", scopes)
+	}
+
+	// Tokens saved before scopes were recorded do not say
+	useCase = NewOAuthUseCase(&MockOAuthService{token: &oauth2.Token{AccessToken: "test-token"}})
+	if scopes, err := useCase.GrantedScopes(); err != nil || len(scopes) != 0 {
+		t.Errorf("Expected no scopes, got %v (%v)", scopes, err)
+	}
+}
+
 func TestOAuthUseCase_AuthenticateClient_WithValidToken(t *testing.T) {
 	// Arrange
 	config := &oauth2.Config{
@@ -190,3 +230,273 @@ func TestOAuthUseCase_AuthenticateClient_WithExpiredToken(t *testing.T) {
 		t.Errorf("Expected config %v, got %v", config, resultConfig)
 	}
 }
+
+func TestOAuthUseCase_CompleteAuthenticationHeadless_WithCode(t *testing.T) {
+	// Arrange
+	mockService := &MockOAuthService{authURL: "https://accounts.google.com/oauth/authorize"}
+	useCase := NewOAuthUseCase(mockService)
+
+	// Act
+	err := useCase.CompleteAuthenticationHeadless(strings.NewReader("pasted-auth-code\n"))
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if mockService.token == nil || mockService.token.AccessToken != "mock-access-token" {
+		t.Error("Expected token to be exchanged and saved")
+	}
+
+	if mockService.stateValue == "" {
+		t.Error("Expected auth URL to be generated with a state")
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthenticationHeadless_PresentsURL(t *testing.T) {
+	// Arrange
+	mockService := &MockOAuthService{authURL: "https://accounts.google.com/oauth/authorize"}
+	useCase := NewOAuthUseCase(mockService)
+	var presented []string
+	useCase.SetURLPresenter(func(url string) { presented = append(presented, url) })
+
+	// Act
+	err := useCase.CompleteAuthenticationHeadless(strings.NewReader("pasted-auth-code\n"))
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if len(presented) != 1 || !strings.HasPrefix(presented[0], "https://accounts.google.com/oauth/authorize") {
+		t.Errorf("Expected the auth URL to be presented once, got %v", presented)
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthenticationHeadless_EmptyInput(t *testing.T) {
+	// Arrange
+	mockService := &MockOAuthService{}
+	useCase := NewOAuthUseCase(mockService)
+
+	// Act
+	err := useCase.CompleteAuthenticationHeadless(strings.NewReader(""))
+
+	// Assert
+	if err == nil {
+		t.Error("Expected error for empty input, got nil")
+	}
+
+	if mockService.token != nil {
+		t.Error("Expected no token to be saved")
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthenticationHeadless_WithRedirectURL(t *testing.T) {
+	// Arrange
+	seed := [32]byte{1, 2, 3}
+	expected := NewOAuthUseCase(&MockOAuthService{})
+	expected.SetRandomSource(rand.NewChaCha8(seed))
+	state, err := expected.generateState()
+	if err != nil {
+		t.Fatalf("Failed to generate state: %v", err)
+	}
+
+	mockService := &MockOAuthService{}
+	useCase := NewOAuthUseCase(mockService)
+	useCase.SetRandomSource(rand.NewChaCha8(seed))
+	input := "http://localhost:8080/oauth2callback?state=" + state + "&code=pasted-code\n"
+
+	// Act
+	err = useCase.CompleteAuthenticationHeadless(strings.NewReader(input))
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if mockService.stateValue != state {
+		t.Errorf("Expected state '%s', got '%s'", state, mockService.stateValue)
+	}
+
+	if mockService.token == nil {
+		t.Error("Expected token to be saved")
+	}
+}
+
+func TestOAuthUseCase_GenerateState_Deterministic(t *testing.T) {
+	seed := [32]byte{42}
+	first := NewOAuthUseCase(&MockOAuthService{})
+	first.SetRandomSource(rand.NewChaCha8(seed))
+	second := NewOAuthUseCase(&MockOAuthService{})
+	second.SetRandomSource(rand.NewChaCha8(seed))
+
+	a, _ := first.generateState()
+	b, _ := second.generateState()
+
+	if a != b {
+		t.Errorf("Expected identical states for identical seeds, got '%s' and '%s'", a, b)
+	}
+
+	c, _ := first.generateState()
+	if c == a {
+		t.Error("Expected consecutive states to differ")
+	}
+}
+
+func TestParseAuthorizationResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		state    string
+		wantCode string
+		wantErr  bool
+	}{
+		{name: "bare code", input: "4/0Abc", state: "s1", wantCode: "4/0Abc"},
+		{name: "redirect URL", input: "http://localhost:8080/oauth2callback?state=s1&code=4%2F0Abc", state: "s1", wantCode: "4/0Abc"},
+		{name: "query string only", input: "state=s1&code=xyz", state: "s1", wantCode: "xyz"},
+		{name: "state mismatch", input: "http://localhost:8080/oauth2callback?state=other&code=xyz", state: "s1", wantErr: true},
+		{name: "oauth error", input: "http://localhost:8080/oauth2callback?error=access_denied&state=s1", state: "s1", wantErr: true},
+		{name: "empty", input: "", state: "s1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := parseAuthorizationResponse(tt.input, tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestListenForCallback_FallsBackToFreePort(t *testing.T) {
+	// Arrange
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	defer busy.Close()
+
+	// Act
+	listener, err := listenForCallback(busy.Addr().String(), slog.Default())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected fallback listener, got %v", err)
+	}
+	defer listener.Close()
+
+	if listener.Addr().String() == busy.Addr().String() {
+		t.Errorf("Expected a different port than %s", busy.Addr())
+	}
+}
+
+func TestListenForCallback_FailsWhenTheHostCannotBeBound(t *testing.T) {
+	// 203.0.113.0/24 is reserved for documentation, so no interface has it
+	listener, err := listenForCallback("203.0.113.1:8080", slog.Default())
+
+	if err == nil {
+		listener.Close()
+		t.Fatalf("Expected an error instead of a fallback on %s", listener.Addr())
+	}
+}
+
+func TestCallbackRedirectURL(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9123}
+
+	url := callbackRedirectURL(addr, "/callback")
+
+	if url != "http://localhost:9123/callback" {
+		t.Errorf("Expected redirect URL 'http://localhost:9123/callback', got '%s'", url)
+	}
+}
+
+func TestOAuthUseCase_SetCallbackServerConfig_KeepsDefaults(t *testing.T) {
+	useCase := NewOAuthUseCase(&MockOAuthService{})
+
+	useCase.SetCallbackServerConfig(CallbackServerConfig{Path: "auth/done"})
+
+	if useCase.callbackConfig.Path != "/auth/done" {
+		t.Errorf("Expected path '/auth/done', got '%s'", useCase.callbackConfig.Path)
+	}
+	if useCase.callbackConfig.Addr != defaultCallbackAddr {
+		t.Errorf("Expected default addr '%s', got '%s'", defaultCallbackAddr, useCase.callbackConfig.Addr)
+	}
+	if useCase.callbackConfig.SuccessHTML == "" {
+		t.Error("Expected default success HTML to be kept")
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthenticationWithServer_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// Cancel once the server listens, as Ctrl-C while waiting for the browser does
+	mockService := &MockOAuthService{config: &oauth2.Config{RedirectURL: "http://localhost:8080/oauth2callback"}, onAuthURL: cancel}
+	useCase := NewOAuthUseCase(mockService)
+	useCase.SetCallbackServerConfig(CallbackServerConfig{Addr: "127.0.0.1:0"})
+
+	done := make(chan error, 1)
+	go func() { done <- useCase.CompleteAuthenticationWithServer(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cancellation to end the flow")
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if mockService.redirectURL != "http://localhost:8080/oauth2callback" {
+		t.Errorf("Expected redirect URL to be restored, got %s", mockService.redirectURL)
+	}
+	if mockService.token != nil {
+		t.Error("Expected no token to be saved")
+	}
+}
+
+func TestOAuthUseCase_CompleteAuthenticationWithServer_TimeoutReleasesPort(t *testing.T) {
+	mockService := &MockOAuthService{}
+	useCase := NewOAuthUseCase(mockService)
+	useCase.SetCallbackServerConfig(CallbackServerConfig{Addr: "127.0.0.1:0", Timeout: 50 * time.Millisecond})
+
+	err := useCase.CompleteAuthenticationWithServer(context.Background())
+
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+
+	addr := strings.TrimSuffix(strings.TrimPrefix(mockService.redirectURL, "http://"), defaultCallbackPath)
+	listener, err := net.Listen("tcp", strings.Replace(addr, "localhost", "127.0.0.1", 1))
+	if err != nil {
+		t.Fatalf("Expected port %s to be released, got %v", addr, err)
+	}
+	listener.Close()
+}
+
+func TestResolveAuthFlow(t *testing.T) {
+	tests := []struct {
+		name string
+		flow domain.AuthFlow
+		env  domain.AuthEnvironment
+		want domain.AuthFlow
+	}{
+		{name: "desktop", flow: domain.AuthFlowAuto, env: domain.AuthEnvironment{Display: true, InteractiveInput: true}, want: domain.AuthFlowBrowser},
+		{name: "ssh with forwarded display", flow: domain.AuthFlowAuto, env: domain.AuthEnvironment{SSH: true, Display: true, InteractiveInput: true}, want: domain.AuthFlowPaste},
+		{name: "container", flow: domain.AuthFlowAuto, env: domain.AuthEnvironment{Container: true, Display: true, InteractiveInput: true}, want: domain.AuthFlowPaste},
+		{name: "no terminal", flow: domain.AuthFlowAuto, env: domain.AuthEnvironment{SSH: true}, want: domain.AuthFlowPaste},
+		{name: "no display or terminal", flow: domain.AuthFlowAuto, env: domain.AuthEnvironment{}, want: domain.AuthFlowPaste},
+		{name: "explicit override", flow: domain.AuthFlowBrowser, env: domain.AuthEnvironment{SSH: true}, want: domain.AuthFlowBrowser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveAuthFlow(tt.flow, tt.env); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// snippetRunes is about how much text around the first matching word a text search shows
+const snippetRunes = 80
+
+// OCROptions configures reading the text of local photos
+type OCROptions struct {
+	// Root is the directory the files are in; it is stored with their paths so texts of several
+	// directories can be told apart
+	Root string
+	// Workers is the number of files read at a time; values below 1 use the default
+	Workers int
+}
+
+// OCRResult is the outcome of reading the text of one file
+type OCRResult struct {
+	Path string `json:"path"`
+	// Words counts the distinct words found
+	Words int `json:"words"`
+	// Current is set when the file did not change since its text was read
+	Current bool `json:"current,omitempty"`
+	// Unsupported is set for videos and images the recognizer cannot read
+	Unsupported bool   `json:"unsupported,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// TextMatch is a file whose text holds every word searched for
+type TextMatch struct {
+	Path string `json:"path"`
+	// Snippet is the text around the first word found, on one line
+	Snippet string `json:"snippet"`
+}
+
+// OCRUseCase reads the text in local photos, such as exported screenshots, receipts and
+// whiteboards, into the local index so they can be found by what they say
+type OCRUseCase struct {
+	logging
+
+	recognizer domain.TextRecognizer
+	texts      domain.TextIndexRepository
+}
+
+// NewOCRUseCase creates a new instance of OCRUseCase; the recognizer may be nil when only searching
+func NewOCRUseCase(recognizer domain.TextRecognizer, texts domain.TextIndexRepository) *OCRUseCase {
+	return &OCRUseCase{
+		recognizer: recognizer,
+		texts:      texts,
+	}
+}
+
+// Close releases the index
+func (uc *OCRUseCase) Close() error {
+	return uc.texts.Close()
+}
+
+// IndexText reads the text of every photo below the root of fsys and stores it in the index.
+// Files that did not change since their text was read are skipped, so a second run only reads new
+// and edited ones. Failures of single files are reported in their result.
+func (uc *OCRUseCase) IndexText(ctx context.Context, fsys fs.FS, opts OCROptions) ([]OCRResult, error) {
+	if uc.recognizer == nil {
+		return nil, errors.New("no text recognizer configured")
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultUploadWorkers
+	}
+
+	files, _, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	uc.log().Info("Reading text", "files", len(files))
+
+	results := make([]OCRResult, len(files))
+	runConcurrently(ctx, len(files), workers, func(i int) {
+		results[i] = uc.indexFile(ctx, fsys, files[i], opts.Root)
+	}, func(i int, err error) {
+		results[i] = OCRResult{Path: files[i], Error: err.Error()}
+	})
+	// Texts stored so far are kept, so the next run picks up where this one stopped
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// indexFile reads and stores the text of the file name of fsys unless it is stored already
+func (uc *OCRUseCase) indexFile(ctx context.Context, fsys fs.FS, name, root string) OCRResult {
+	result := OCRResult{Path: name}
+	if strings.HasPrefix(mediaMimeType(name), "video/") {
+		result.Unsupported = true
+		return result
+	}
+
+	stored := filepath.Join(root, filepath.FromSlash(name))
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if doc, err := uc.texts.LoadText(stored); err == nil && doc != nil && doc.ModTime.Equal(info.ModTime()) {
+		result.Words, result.Current = len(domain.TextTerms(doc.Text)), true
+		return result
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer f.Close()
+
+	text, err := uc.recognizer.RecognizeText(ctx, path.Base(name), f)
+	if errors.Is(err, domain.ErrUnsupportedFormat) {
+		result.Unsupported = true
+		return result
+	}
+	if err == nil {
+		err = uc.texts.SaveText(domain.DocumentText{Path: stored, Text: text, ModTime: info.ModTime(), IndexedAt: time.Now()})
+	}
+	if err != nil {
+		uc.log().Warn("Failed to read text", "path", name, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Words = len(domain.TextTerms(text))
+	return result
+}
+
+// SearchText returns the files whose text holds a word starting with each word of query, ignoring
+// case, sorted by path
+func (uc *OCRUseCase) SearchText(query string) ([]TextMatch, error) {
+	terms := domain.TextTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: no words to search for in %q", domain.ErrInvalidArgument, query)
+	}
+
+	docs, err := uc.texts.SearchText(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]TextMatch, len(docs))
+	for i, doc := range docs {
+		matches[i] = TextMatch{Path: doc.Path, Snippet: snippet(doc.Text, terms[0])}
+	}
+	uc.log().Info("Found texts", "matches", len(matches))
+	return matches, nil
+}
+
+// snippet returns the text around the first word starting with term on one line, marking cut ends
+// with an ellipsis
+func snippet(text, term string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	at := max(strings.Index(strings.ToLower(text), term), 0)
+
+	start := at
+	for n := 0; start > 0 && n < snippetRunes/4; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; end < len(text) && n < snippetRunes; n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	s := text[start:end]
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
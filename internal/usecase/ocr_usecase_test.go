@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockTextRecognizer returns the content of files as their text
+type MockTextRecognizer struct {
+	mu    sync.Mutex
+	reads []string
+}
+
+func (m *MockTextRecognizer) RecognizeText(ctx context.Context, name string, content io.Reader) (string, error) {
+	m.mu.Lock()
+	m.reads = append(m.reads, name)
+	m.mu.Unlock()
+	if strings.HasSuffix(name, ".heic") {
+		return "", domain.ErrUnsupportedFormat
+	}
+	b, err := io.ReadAll(content)
+	return string(b), err
+}
+
+// MockTextIndexRepository keeps texts in memory and matches words by prefix
+type MockTextIndexRepository struct {
+	mu   sync.Mutex
+	docs map[string]domain.DocumentText
+}
+
+func (m *MockTextIndexRepository) LoadText(path string) (*domain.DocumentText, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.docs[path]
+	if !ok {
+		return nil, nil
+	}
+	return &doc, nil
+}
+
+func (m *MockTextIndexRepository) SaveText(doc domain.DocumentText) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.docs == nil {
+		m.docs = make(map[string]domain.DocumentText)
+	}
+	m.docs[doc.Path] = doc
+	return nil
+}
+
+func (m *MockTextIndexRepository) SearchText(terms []string) ([]domain.DocumentText, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var docs []domain.DocumentText
+	for _, doc := range m.docs {
+		words := domain.TextTerms(doc.Text)
+		if !slices.ContainsFunc(terms, func(term string) bool {
+			return !slices.ContainsFunc(words, func(word string) bool { return strings.HasPrefix(word, term) })
+		}) {
+			docs = append(docs, doc)
+		}
+	}
+	slices.SortFunc(docs, func(a, b domain.DocumentText) int { return strings.Compare(a.Path, b.Path) })
+	return docs, nil
+}
+
+func (m *MockTextIndexRepository) Close() error {
+	return nil
+}
+
+func TestOCRUseCase_IndexText(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour)
+	fsys := fstest.MapFS{
+		"screens/receipt.png": {Data: []byte("Cafe Roma total 12.50"), ModTime: modTime},
+		"board.jpg":           {Data: []byte("Sprint goals"), ModTime: modTime},
+		"phone.heic":          {Data: []byte("no text"), ModTime: modTime},
+		"clip.mp4":            {Data: []byte("video"), ModTime: modTime},
+	}
+	recognizer := &MockTextRecognizer{}
+	texts := &MockTextIndexRepository{}
+	useCase := NewOCRUseCase(recognizer, texts)
+
+	results, err := useCase.IndexText(context.Background(), fsys, OCROptions{Root: "/export", Workers: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	byPath := make(map[string]OCRResult)
+	for _, result := range results {
+		byPath[result.Path] = result
+	}
+	if r := byPath["screens/receipt.png"]; r.Words != 5 || r.Error != "" {
+		t.Errorf("Expected 5 words from the receipt, got %+v", r)
+	}
+	if r := byPath["phone.heic"]; !r.Unsupported {
+		t.Errorf("Expected HEIC to be unsupported, got %+v", r)
+	}
+	if r := byPath["clip.mp4"]; !r.Unsupported {
+		t.Errorf("Expected the video to be unsupported, got %+v", r)
+	}
+	if _, ok := texts.docs[filepath.Join("/export", "screens", "receipt.png")]; !ok {
+		t.Errorf("Expected the text to be stored under the root, got %v", texts.docs)
+	}
+
+	// Unchanged files are not read again
+	recognizer.reads = nil
+	results, err = useCase.IndexText(context.Background(), fsys, OCROptions{Root: "/export"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(recognizer.reads) != 1 || recognizer.reads[0] != "phone.heic" {
+		t.Errorf("Expected only the unsupported file to be tried again, got %v", recognizer.reads)
+	}
+	for _, result := range results {
+		if result.Words > 0 && !result.Current {
+			t.Errorf("Expected %s to be current, got %+v", result.Path, result)
+		}
+	}
+}
+
+func TestOCRUseCase_SearchText(t *testing.T) {
+	texts := &MockTextIndexRepository{docs: map[string]domain.DocumentText{
+		"/a.png": {Path: "/a.png", Text: "Cafe Roma\n\ntotal 12.50 EUR"},
+		"/b.png": {Path: "/b.png", Text: strings.Repeat("lorem ", 20) + "Invoice 42 " + strings.Repeat("ipsum ", 30)},
+	}}
+	useCase := NewOCRUseCase(nil, texts)
+
+	matches, err := useCase.SearchText("TOTAL eur")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(matches) != 1 || matches[0].Path != "/a.png" || matches[0].Snippet != "Cafe Roma total 12.50 EUR" {
+		t.Errorf("Expected /a.png with its text on one line, got %+v", matches)
+	}
+
+	matches, err = useCase.SearchText("invoice")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(matches) != 1 || !strings.HasPrefix(matches[0].Snippet, "…") || !strings.HasSuffix(matches[0].Snippet, "…") || !strings.Contains(matches[0].Snippet, "Invoice 42") {
+		t.Errorf("Expected a snippet cut around the word, got %+v", matches)
+	}
+
+	if _, err := useCase.SearchText("- !"); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected a query without words to be rejected, got %v", err)
+	}
+}
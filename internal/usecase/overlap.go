@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// defaultOverlapAlbums is how many albums the overlap matrix holds unless another limit is asked for
+const defaultOverlapAlbums = 20
+
+// Layout of the overlap heatmap, in SVG user units
+const (
+	heatmapCell  = 28
+	heatmapLabel = 220
+	heatmapFont  = 11
+)
+
+// OverlapOptions configures the report of media items albums have in common
+type OverlapOptions struct {
+	// MinShared leaves out pairs of albums sharing fewer media items; values below 1 use 1
+	MinShared int
+	// MaxAlbums limits the matrix to the albums sharing the most media items with others; values
+	// below 1 use the default of 20
+	MaxAlbums int
+	// Heatmap is the path to write the matrix to as an SVG heatmap, if any
+	Heatmap string
+}
+
+// AlbumOverlap is a pair of albums with media items in common
+type AlbumOverlap struct {
+	A      domain.Album `json:"albumA"`
+	B      domain.Album `json:"albumB"`
+	Shared int          `json:"shared"`
+	// Jaccard is the shared media items divided by those in either album; 1 means the albums hold
+	// the same media items
+	Jaccard float64 `json:"jaccard"`
+	// Contained is the shared media items divided by those of the smaller album; 1 means the larger
+	// album holds all of the smaller one
+	Contained float64 `json:"contained"`
+}
+
+// OverlapReport shows which albums hold the same media items, to find redundant ones
+type OverlapReport struct {
+	// Pairs are the albums sharing media items, the most shared first
+	Pairs []AlbumOverlap `json:"pairs"`
+	// Albums are the rows and columns of Matrix, ordered by title
+	Albums []domain.Album `json:"albums"`
+	// Matrix counts the media items each two Albums share; the diagonal holds the size of each album
+	Matrix [][]int `json:"matrix"`
+}
+
+// AlbumOverlap compares the contents of every two indexed albums
+func (uc *IndexUseCase) AlbumOverlap(ctx context.Context, opts OverlapOptions) (report *OverlapReport, err error) {
+	_, span := uc.trace(ctx, "index.album_overlap")
+	defer func() { span.End(err) }()
+
+	minShared := max(opts.MinShared, 1)
+	maxAlbums := opts.MaxAlbums
+	if maxAlbums < 1 {
+		maxAlbums = defaultOverlapAlbums
+	}
+
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+	albums := make(map[string]domain.Album, len(snapshot.Albums))
+	for _, album := range snapshot.Albums {
+		albums[album.ID] = album
+	}
+
+	// Pairs are counted per media item, so albums without anything in common cost nothing
+	sizes := make(map[string]int)
+	itemAlbums := make(map[string][]string)
+	for albumID, ids := range snapshot.AlbumItems {
+		if _, ok := albums[albumID]; !ok {
+			continue
+		}
+		for _, id := range uniqueIDs(ids) {
+			itemAlbums[id] = append(itemAlbums[id], albumID)
+		}
+		sizes[albumID] = len(uniqueIDs(ids))
+	}
+	shared := make(map[[2]string]int)
+	for _, albumIDs := range itemAlbums {
+		slices.Sort(albumIDs)
+		for i, a := range albumIDs {
+			for _, b := range albumIDs[i+1:] {
+				shared[[2]string{a, b}]++
+			}
+		}
+	}
+
+	report = &OverlapReport{}
+	totals := make(map[string]int)
+	for pair, n := range shared {
+		if n < minShared {
+			continue
+		}
+		a, b := pair[0], pair[1]
+		report.Pairs = append(report.Pairs, AlbumOverlap{
+			A:         albums[a],
+			B:         albums[b],
+			Shared:    n,
+			Jaccard:   float64(n) / float64(sizes[a]+sizes[b]-n),
+			Contained: float64(n) / float64(min(sizes[a], sizes[b])),
+		})
+		totals[a] += n
+		totals[b] += n
+	}
+	slices.SortFunc(report.Pairs, func(x, y AlbumOverlap) int {
+		return cmp.Or(
+			cmp.Compare(y.Shared, x.Shared),
+			cmp.Compare(y.Jaccard, x.Jaccard),
+			cmp.Compare(x.A.Title+"\x00"+x.B.Title, y.A.Title+"\x00"+y.B.Title),
+		)
+	})
+
+	ids := make([]string, 0, len(totals))
+	for id := range totals {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int { return cmp.Or(cmp.Compare(totals[b], totals[a]), cmp.Compare(a, b)) })
+	if len(ids) > maxAlbums {
+		ids = ids[:maxAlbums]
+	}
+	slices.SortStableFunc(ids, func(a, b string) int {
+		return cmp.Compare(strings.ToLower(albums[a].Title), strings.ToLower(albums[b].Title))
+	})
+	report.Matrix = make([][]int, len(ids))
+	for i, a := range ids {
+		report.Albums = append(report.Albums, albums[a])
+		report.Matrix[i] = make([]int, len(ids))
+		for j, b := range ids {
+			switch {
+			case i == j:
+				report.Matrix[i][j] = sizes[a]
+			case a < b:
+				report.Matrix[i][j] = shared[[2]string{a, b}]
+			default:
+				report.Matrix[i][j] = shared[[2]string{b, a}]
+			}
+		}
+	}
+
+	uc.log().Info("Compared albums", "albums", len(sizes), "overlapping_pairs", len(report.Pairs))
+
+	if opts.Heatmap != "" {
+		if err := writeFile(opts.Heatmap, func(w io.Writer) error { return writeOverlapHeatmap(w, report) }); err != nil {
+			return nil, err
+		}
+		uc.log().Info("Wrote overlap heatmap", "path", opts.Heatmap)
+	}
+	return report, nil
+}
+
+// writeOverlapHeatmap draws the matrix of report as an SVG grid with album titles along the top
+// and left. Cells are shaded by how much of the smaller album is shared, so a dark cell marks an
+// album the other one nearly holds.
+func writeOverlapHeatmap(w io.Writer, report *OverlapReport) error {
+	n := len(report.Albums)
+	size := heatmapLabel + n*heatmapCell
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="%d">`+"\n", size, size, heatmapFont)
+	b.WriteString(`<rect width="100%" height="100%" fill="white"/>` + "\n")
+
+	for i, album := range report.Albums {
+		title := html.EscapeString(truncateTitle(album.Title))
+		offset := heatmapLabel + i*heatmapCell + heatmapCell/2
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", heatmapLabel-6, offset, title)
+		fmt.Fprintf(&b, `<text transform="translate(%d %d) rotate(-90)" dominant-baseline="middle">%s</text>`+"\n", offset, heatmapLabel-6, title)
+	}
+
+	for i, row := range report.Matrix {
+		for j, count := range row {
+			x, y := heatmapLabel+j*heatmapCell, heatmapLabel+i*heatmapCell
+			smaller := min(report.Matrix[i][i], report.Matrix[j][j])
+			shade := 0.0
+			if i != j && smaller > 0 {
+				shade = float64(count) / float64(smaller)
+			}
+			fill := fmt.Sprintf("rgb(%d,%d,%d)", 255-int(shade*255), 255-int(shade*155), 255-int(shade*55))
+			if i == j {
+				fill = "#eeeeee"
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#cccccc"><title>%s / %s: %d</title></rect>`+"\n",
+				x, y, heatmapCell, heatmapCell, fill, html.EscapeString(report.Albums[i].Title), html.EscapeString(report.Albums[j].Title), count)
+			if count > 0 {
+				color := "black"
+				if shade > 0.6 {
+					color = "white"
+				}
+				fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="middle" fill="%s">%d</text>`+"\n", x+heatmapCell/2, y+heatmapCell/2, color, count)
+			}
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// truncateTitle shortens a title to fit the labels of the heatmap
+func truncateTitle(title string) string {
+	const maxRunes = 32
+	runes := []rune(title)
+	if len(runes) <= maxRunes {
+		return title
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
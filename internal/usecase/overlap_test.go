@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestIndexUseCase_AlbumOverlap(t *testing.T) {
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{
+		Albums: []domain.Album{
+			{ID: "a1", Title: "Trip"},
+			{ID: "a2", Title: "Trip best"},
+			{ID: "a3", Title: "Home"},
+			{ID: "a4", Title: "Beach"},
+		},
+		AlbumItems: map[string][]string{
+			"a1": {"m1", "m2", "m3", "m4"},
+			"a2": {"m1", "m2"},
+			"a3": {"m4", "m5", "m6"},
+			"a4": {"m7"},
+		},
+		UpdatedAt: time.Now(),
+	}}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+	heatmap := filepath.Join(t.TempDir(), "overlap.svg")
+
+	report, err := uc.AlbumOverlap(context.Background(), OverlapOptions{Heatmap: heatmap})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(report.Pairs) != 2 {
+		t.Fatalf("Expected 2 overlapping pairs, got %+v", report.Pairs)
+	}
+	top := report.Pairs[0]
+	if top.A.ID != "a1" || top.B.ID != "a2" || top.Shared != 2 || top.Jaccard != 0.5 || top.Contained != 1 {
+		t.Errorf("Expected Trip best to lie within Trip, got %+v", top)
+	}
+	if p := report.Pairs[1]; p.A.ID != "a1" || p.B.ID != "a3" || p.Shared != 1 {
+		t.Errorf("Expected Trip and Home to share one item, got %+v", p)
+	}
+
+	// Beach overlaps nothing, so the matrix leaves it out
+	var titles []string
+	for _, album := range report.Albums {
+		titles = append(titles, album.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Home,Trip,Trip best" {
+		t.Errorf("Expected the overlapping albums by title, got %s", got)
+	}
+	want := [][]int{{3, 1, 0}, {1, 4, 2}, {0, 2, 2}}
+	for i := range want {
+		for j := range want[i] {
+			if report.Matrix[i][j] != want[i][j] {
+				t.Fatalf("Expected matrix %v, got %v", want, report.Matrix)
+			}
+		}
+	}
+
+	svg, err := os.ReadFile(heatmap)
+	if err != nil {
+		t.Fatalf("Expected the heatmap to be written, got %v", err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg") || !strings.Contains(string(svg), "Trip best / Trip: 2") {
+		t.Errorf("Unexpected heatmap %s", svg)
+	}
+
+	report, err = uc.AlbumOverlap(context.Background(), OverlapOptions{MinShared: 2, MaxAlbums: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(report.Pairs) != 1 || len(report.Albums) != 1 {
+		t.Errorf("Expected one pair and one album, got %+v", report)
+	}
+}
@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// fetchPageFunc retrieves a single page of a list
+type fetchPageFunc[T any] func(req domain.PageRequest) (*domain.Page[T], error)
+
+// paginate turns a page fetcher into a lazy iterator that starts at req and follows page tokens
+// until the last page. Errors, including context cancellation and page tokens that repeat,
+// are yielded once and end iteration.
+func paginate[T any](ctx context.Context, req domain.PageRequest, fetch fetchPageFunc[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		seen := make(map[string]bool)
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			page, err := fetch(req)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if !page.HasNext() {
+				return
+			}
+
+			// A token that comes back twice would otherwise loop forever
+			if seen[page.NextPageToken] {
+				yield(zero, fmt.Errorf("page token %q returned twice", page.NextPageToken))
+				return
+			}
+			seen[page.NextPageToken] = true
+			req = req.Next(page.NextPageToken)
+		}
+	}
+}
+
+// prefetch is paginate with the request of each next page sent in the background while the items
+// of the current one are yielded, so a slow caller and the API overlap. At most one page is fetched
+// ahead; when the caller stops early, the page in flight is waited for and dropped.
+func prefetch[T any](ctx context.Context, req domain.PageRequest, fetch fetchPageFunc[T]) iter.Seq2[T, error] {
+	type result struct {
+		page *domain.Page[T]
+		err  error
+	}
+	start := func(req domain.PageRequest) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			page, err := fetch(req)
+			ch <- result{page, err}
+		}()
+		return ch
+	}
+
+	return func(yield func(T, error) bool) {
+		var zero T
+		if err := ctx.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		seen := make(map[string]bool)
+		pending := start(req)
+		for pending != nil {
+			r := <-pending
+			if r.err != nil {
+				yield(zero, r.err)
+				return
+			}
+
+			// The next page is requested before the items of this one are handed out
+			pending = nil
+			var stop error
+			if r.page.HasNext() {
+				switch {
+				case seen[r.page.NextPageToken]:
+					stop = fmt.Errorf("page token %q returned twice", r.page.NextPageToken)
+				case ctx.Err() != nil:
+					stop = ctx.Err()
+				default:
+					seen[r.page.NextPageToken] = true
+					req = req.Next(r.page.NextPageToken)
+					pending = start(req)
+				}
+			}
+
+			for _, item := range r.page.Items {
+				if !yield(item, nil) {
+					if pending != nil {
+						<-pending
+					}
+					return
+				}
+			}
+			if stop == nil {
+				stop = ctx.Err()
+			}
+			if stop != nil {
+				if pending != nil {
+					<-pending
+				}
+				yield(zero, stop)
+				return
+			}
+		}
+	}
+}
+
+// listPages iterates over every item of a list as opts asks, in pages of maxPageSize unless opts
+// sets a smaller size
+func listPages[T any](ctx context.Context, opts domain.ListOptions, maxPageSize int, fetch fetchPageFunc[T]) iter.Seq2[T, error] {
+	req := domain.PageRequest{PageSize: opts.PageSize, Fields: opts.Fields}
+	if err := req.Validate(maxPageSize); err != nil {
+		return func(yield func(T, error) bool) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+	if req.PageSize == 0 {
+		req.PageSize = maxPageSize
+	}
+	if opts.Prefetch {
+		return prefetch(ctx, req, fetch)
+	}
+	return paginate(ctx, req, fetch)
+}
+
+// collect drains a paginated iterator into a slice
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var items []T
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
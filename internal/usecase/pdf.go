@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// pdfPage is a page image encoded as JPEG, with its size in pixels. The resolution it is placed
+// at sets the physical page size.
+type pdfPage struct {
+	jpeg   []byte
+	width  int
+	height int
+	dpi    int
+}
+
+// writePDF writes a PDF document with one full-page image per page. JPEG data is embedded as is
+// (DCTDecode), which keeps the writer small enough that no PDF library is needed.
+func writePDF(w io.Writer, pages []pdfPage) error {
+	pw := &pdfWriter{w: bufio.NewWriter(w)}
+
+	// Objects 1 and 2 are the catalog and page tree; every page then takes three objects:
+	// the page itself, its content stream and its image
+	pw.object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := ""
+	for i := range pages {
+		kids += fmt.Sprintf("%d 0 R ", 3+3*i)
+	}
+	pw.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(pages)))
+
+	for i, page := range pages {
+		id := 3 + 3*i
+		width := float64(page.width) * 72 / float64(page.dpi)
+		height := float64(page.height) * 72 / float64(page.dpi)
+
+		pw.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			width, height, id+2, id+1))
+		content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", width, height)
+		pw.stream("", []byte(content))
+		pw.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode ",
+			page.width, page.height), page.jpeg)
+	}
+
+	pw.trailer()
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+// pdfWriter numbers objects and records their offsets for the cross-reference table. The first
+// write error is kept and later writes are skipped.
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets []int
+	err     error
+}
+
+// printf writes formatted output, tracking the offset
+func (pw *pdfWriter) printf(format string, args ...any) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.offset += n
+	pw.err = err
+}
+
+// write writes raw bytes, tracking the offset
+func (pw *pdfWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += n
+	pw.err = err
+}
+
+// object writes the next numbered object
+func (pw *pdfWriter) object(body string) {
+	pw.begin()
+	pw.printf("%s\nendobj\n", body)
+}
+
+// stream writes the next numbered object as a stream with the given dictionary entries
+func (pw *pdfWriter) stream(dict string, data []byte) {
+	pw.begin()
+	pw.printf("<< %s/Length %d >>\nstream\n", dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// begin starts the next object, writing the file header before the first one
+func (pw *pdfWriter) begin() {
+	if len(pw.offsets) == 0 {
+		pw.printf("%%PDF-1.4\n")
+	}
+	pw.offsets = append(pw.offsets, pw.offset)
+	pw.printf("%d 0 obj\n", len(pw.offsets))
+}
+
+// trailer writes the cross-reference table and the trailer that points at the catalog
+func (pw *pdfWriter) trailer() {
+	xref := pw.offset
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, offset := range pw.offsets {
+		pw.printf("%010d 00000 n \n", offset)
+	}
+	pw.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, xref)
+}
@@ -0,0 +1,357 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultPrefetchBudget is how many requests a minute the gallery may spend on prefetching
+const DefaultPrefetchBudget = 60
+
+// DefaultPrefetchThumbnails is how many thumbnails after the one asked for are fetched ahead
+const DefaultPrefetchThumbnails = 12
+
+const (
+	// prefetchWindow is the time the prefetch budget applies to
+	prefetchWindow = time.Minute
+	// prefetchQueueSize is how many tasks wait at most; the oldest are dropped first, as the user
+	// has moved on from what they anticipated
+	prefetchQueueSize = 32
+	// prefetchPageTTL is how long a prefetched page is served before it is fetched again
+	prefetchPageTTL = time.Minute
+	// prefetchBaseURLTTL is how long the base URLs of listed media items are downloaded from; they
+	// expire after an hour
+	prefetchBaseURLTTL = 50 * time.Minute
+	// maxListedItems bounds the listed media items remembered for finding the ones shown next
+	maxListedItems = 10000
+)
+
+// PrefetchOptions configures what the gallery fetches ahead of the user
+type PrefetchOptions struct {
+	// Budget is the most requests prefetching may make a minute; what goes over it is skipped
+	// rather than delayed, so requests of the user never wait for the quota of prefetching
+	Budget int
+	// Thumbnails is how many thumbnails following the one asked for are fetched ahead; zero uses
+	// DefaultPrefetchThumbnails
+	Thumbnails int
+}
+
+// prefetchTask is a page of an album or a thumbnail of a media item to fetch ahead
+type prefetchTask struct {
+	key string
+	// albumID and req name the page
+	albumID string
+	req     domain.PageRequest
+	// item and size name the thumbnail, when item is set
+	item *domain.MediaItem
+	size int
+}
+
+// prefetchedPage is a page fetched ahead, waiting for the user to ask for it
+type prefetchedPage struct {
+	page    *domain.Page[domain.MediaItem]
+	fetched time.Time
+}
+
+// listedItem is a media item of a listed page with the ID of the one after it
+type listedItem struct {
+	item   domain.MediaItem
+	next   string
+	listed time.Time
+}
+
+// prefetcher queues the tasks anticipating what the user views next and keeps their results
+type prefetcher struct {
+	opts PrefetchOptions
+	now  func() time.Time
+	wake chan struct{}
+
+	mu     sync.Mutex
+	queue  []prefetchTask
+	queued map[string]bool
+	// running holds the running tasks by key, closed when they are done
+	running map[string]chan struct{}
+	spent   []time.Time
+	pages   map[string]prefetchedPage
+	listed  map[string]listedItem
+}
+
+// newPrefetcher creates a prefetcher with opts, filling in the defaults
+func newPrefetcher(opts PrefetchOptions) *prefetcher {
+	if opts.Thumbnails == 0 {
+		opts.Thumbnails = DefaultPrefetchThumbnails
+	}
+	return &prefetcher{
+		opts:    opts,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+		queued:  make(map[string]bool),
+		running: make(map[string]chan struct{}),
+		pages:   make(map[string]prefetchedPage),
+		listed:  make(map[string]listedItem),
+	}
+}
+
+// pageKey identifies a page of the media items of an album
+func pageKey(albumID string, req domain.PageRequest) string {
+	return fmt.Sprintf("page\x00%s\x00%d\x00%s", albumID, req.PageSize, req.PageToken)
+}
+
+// thumbnailKey identifies a thumbnail of a media item
+func thumbnailKey(mediaItemID string, size int) string {
+	return fmt.Sprintf("thumbnail\x00%s\x00%d", mediaItemID, size)
+}
+
+// push queues task unless it is queued or running already, dropping the oldest task when the
+// queue is full
+func (p *prefetcher) push(task prefetchTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.running[task.key]; ok || p.queued[task.key] {
+		return
+	}
+	if len(p.queue) == prefetchQueueSize {
+		p.cancel(0)
+	}
+	p.queue = append(p.queue, task)
+	p.queued[task.key] = true
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancel drops the queued task at i; p.mu must be held
+func (p *prefetcher) cancel(i int) {
+	delete(p.queued, p.queue[i].key)
+	p.queue = slices.Delete(p.queue, i, i+1)
+}
+
+// pop takes the oldest queued task and marks it running
+func (p *prefetcher) pop() (prefetchTask, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 {
+		return prefetchTask{}, false
+	}
+	task := p.queue[0]
+	p.cancel(0)
+	p.running[task.key] = make(chan struct{})
+	return task, true
+}
+
+// done marks task as finished, releasing the requests waiting for it
+func (p *prefetcher) done(task prefetchTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.running[task.key])
+	delete(p.running, task.key)
+}
+
+// claim takes the task of key over for a request of the user: a queued task is dropped, as the
+// request fetches it itself, and a running one is waited for, so the request shares its result
+// rather than fetching the same thing alongside
+func (p *prefetcher) claim(key string) {
+	p.mu.Lock()
+	if i := slices.IndexFunc(p.queue, func(task prefetchTask) bool { return task.key == key }); i >= 0 {
+		p.cancel(i)
+	}
+	ch, ok := p.running[key]
+	p.mu.Unlock()
+	if ok {
+		<-ch
+	}
+}
+
+// spend takes one request from the budget of the current window, reporting false when it is spent
+func (p *prefetcher) spend() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.spent = slices.DeleteFunc(p.spent, func(t time.Time) bool { return now.Sub(t) >= prefetchWindow })
+	if len(p.spent) >= p.opts.Budget {
+		return false
+	}
+	p.spent = append(p.spent, now)
+	return true
+}
+
+// takePage returns the prefetched page of key if it is still fresh; a page is only served once
+func (p *prefetcher) takePage(key string) *domain.Page[domain.MediaItem] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cached, ok := p.pages[key]
+	delete(p.pages, key)
+	if !ok || p.now().Sub(cached.fetched) > prefetchPageTTL {
+		return nil
+	}
+	return cached.page
+}
+
+// remember records the media items of a listed page in their order
+func (p *prefetcher) remember(items []domain.MediaItem) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.listed)+len(items) > maxListedItems {
+		clear(p.listed)
+	}
+	now := p.now()
+	for i, item := range items {
+		listed := listedItem{item: item, listed: now}
+		if i+1 < len(items) {
+			listed.next = items[i+1].ID
+		}
+		p.listed[item.ID] = listed
+	}
+}
+
+// following returns up to n listed media items after mediaItemID whose base URLs are still valid
+func (p *prefetcher) following(mediaItemID string, n int) []domain.MediaItem {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var items []domain.MediaItem
+	for id := p.listed[mediaItemID].next; id != "" && len(items) < n; {
+		listed, ok := p.listed[id]
+		if !ok || p.now().Sub(listed.listed) > prefetchBaseURLTTL {
+			break
+		}
+		items = append(items, listed.item)
+		id = listed.next
+	}
+	return items
+}
+
+// StartPrefetch fetches the next page of listed albums and the thumbnails after the ones asked
+// for in the background until ctx is cancelled, within opts.Budget requests a minute. Prefetched
+// pages are served once within a minute, so the album contents shown are never older than that.
+// A budget that is not positive leaves prefetching off.
+func (uc *GalleryUseCase) StartPrefetch(ctx context.Context, opts PrefetchOptions) {
+	if opts.Budget <= 0 {
+		return
+	}
+	uc.prefetch = newPrefetcher(opts)
+	go func() {
+		for {
+			uc.runPrefetch(ctx)
+			select {
+			case <-uc.prefetch.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// PrefetchAlbum fetches the first page of an album ahead, such as the album selected but not yet
+// opened. It replaces the album queued before, which the user has moved past.
+func (uc *GalleryUseCase) PrefetchAlbum(albumID string) {
+	p := uc.prefetch
+	if p == nil || albumID == "" {
+		return
+	}
+	p.mu.Lock()
+	if i := slices.IndexFunc(p.queue, func(task prefetchTask) bool { return task.item == nil && task.req.PageToken == "" }); i >= 0 {
+		p.cancel(i)
+	}
+	p.mu.Unlock()
+
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	p.push(prefetchTask{key: pageKey(albumID, req), albumID: albumID, req: req})
+}
+
+// runPrefetch runs the queued tasks one at a time until the queue is empty or ctx is cancelled.
+// Tasks over the budget are skipped.
+func (uc *GalleryUseCase) runPrefetch(ctx context.Context) {
+	p := uc.prefetch
+	for ctx.Err() == nil {
+		task, ok := p.pop()
+		if !ok {
+			return
+		}
+		if task.item != nil {
+			if data, _ := uc.thumbs.LoadThumbnail(task.item.ID, task.size); data != nil {
+				p.done(task)
+				continue
+			}
+		}
+		if p.spend() {
+			uc.prefetchTask(task)
+		} else {
+			uc.log().Debug("Prefetch budget spent, skipping", "album_id", task.albumID, "size", task.size)
+		}
+		p.done(task)
+	}
+}
+
+// prefetchTask fetches a page or a thumbnail ahead; failures are left for the request of the user
+// to report
+func (uc *GalleryUseCase) prefetchTask(task prefetchTask) {
+	p := uc.prefetch
+	if task.item == nil {
+		page, err := uc.mediaRepo.SearchMediaItems(task.albumID, task.req)
+		if err != nil {
+			uc.log().Debug("Failed to prefetch media items", "album_id", task.albumID, "error", err)
+			return
+		}
+		p.mu.Lock()
+		p.pages[task.key] = prefetchedPage{page: page, fetched: p.now()}
+		p.mu.Unlock()
+		return
+	}
+
+	content, err := uc.mediaRepo.DownloadMediaItem(*task.item, domain.ImageSize{Width: task.size, Height: task.size, Crop: true, Still: true})
+	if err != nil {
+		uc.log().Debug("Failed to prefetch thumbnail", "media_item_id", task.item.ID, "error", err)
+		return
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return
+	}
+	if err := uc.thumbs.SaveThumbnail(task.item.ID, task.size, data); err != nil {
+		uc.log().Warn("Failed to cache thumbnail", "media_item_id", task.item.ID, "error", err)
+	}
+}
+
+// prefetchedPage returns the page of req if it was fetched ahead, waiting for it when it is
+// being fetched; nil when it was not
+func (uc *GalleryUseCase) prefetchedPage(albumID string, req domain.PageRequest) *domain.Page[domain.MediaItem] {
+	p := uc.prefetch
+	if p == nil {
+		return nil
+	}
+	key := pageKey(albumID, req)
+	p.claim(key)
+	return p.takePage(key)
+}
+
+// anticipatePage remembers the order of a page the user sees and queues the page after it
+func (uc *GalleryUseCase) anticipatePage(albumID string, req domain.PageRequest, page *domain.Page[domain.MediaItem]) {
+	p := uc.prefetch
+	if p == nil {
+		return
+	}
+	p.remember(page.Items)
+	if page.HasNext() {
+		next := domain.PageRequest{PageSize: req.PageSize, PageToken: page.NextPageToken}
+		p.push(prefetchTask{key: pageKey(albumID, next), albumID: albumID, req: next})
+	}
+}
+
+// anticipateThumbnails queues the thumbnails of the media items listed after mediaItemID
+func (uc *GalleryUseCase) anticipateThumbnails(mediaItemID string, size int) {
+	p := uc.prefetch
+	if p == nil {
+		return
+	}
+	for _, item := range p.following(mediaItemID, p.opts.Thumbnails) {
+		p.push(prefetchTask{key: thumbnailKey(item.ID, size), item: &item, size: size})
+	}
+}
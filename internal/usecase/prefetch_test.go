@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// pagedMediaItemRepository serves the media items of an album a page at a time, with the index
+// of the first item of the next page as the page token
+type pagedMediaItemRepository struct {
+	*MockMediaItemRepository
+}
+
+func (r pagedMediaItemRepository) SearchMediaItems(albumID string, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	all, err := r.MockMediaItemRepository.SearchMediaItems(albumID, req)
+	if err != nil {
+		return nil, err
+	}
+	start, _ := strconv.Atoi(req.PageToken)
+	end := min(start+req.PageSize, len(all.Items))
+	page := &domain.Page[domain.MediaItem]{Items: all.Items[start:end]}
+	if end < len(all.Items) {
+		page.NextPageToken = strconv.Itoa(end)
+	}
+	return page, nil
+}
+
+func TestGalleryUseCase_PrefetchPages(t *testing.T) {
+	repo := &MockMediaItemRepository{albumItems: map[string][]domain.MediaItem{
+		"album": {{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}, {ID: "5"}},
+		"other": {{ID: "6"}},
+	}}
+	useCase := NewGalleryUseCase(pagedMediaItemRepository{repo}, &MockThumbnailCache{})
+	useCase.prefetch = newPrefetcher(PrefetchOptions{Budget: 2})
+	now := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	useCase.prefetch.now = func() time.Time { return now }
+	ctx := context.Background()
+	list := func(token string) []string {
+		t.Helper()
+		page, err := useCase.ListAlbumMediaItems("album", domain.PageRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var ids []string
+		for _, item := range page.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	list("")
+	useCase.runPrefetch(ctx)
+	if len(repo.searches) != 2 {
+		t.Fatalf("Expected the second page to be fetched ahead, got %d searches", len(repo.searches))
+	}
+	// The prefetched page is served without a request, and the third page is queued in turn
+	if ids := list("2"); !slices.Equal(ids, []string{"3", "4"}) || len(repo.searches) != 2 {
+		t.Errorf("Expected the second page from the prefetch, got %v after %d searches", ids, len(repo.searches))
+	}
+
+	useCase.runPrefetch(ctx)
+	if len(repo.searches) != 3 {
+		t.Fatalf("Expected the third page to be fetched ahead, got %d searches", len(repo.searches))
+	}
+
+	// The budget is spent, so the album selected next is skipped until the next minute
+	useCase.PrefetchAlbum("other")
+	useCase.runPrefetch(ctx)
+	if ids := list("4"); !slices.Equal(ids, []string{"5"}) || len(repo.searches) != 3 {
+		t.Errorf("Expected the third page from the prefetch and no more searches, got %v after %v", ids, repo.searches)
+	}
+	now = now.Add(prefetchWindow)
+	useCase.PrefetchAlbum("other")
+	useCase.runPrefetch(ctx)
+	if len(repo.searches) != 4 || repo.searches[3] != "other" {
+		t.Errorf("Expected the selected album to be fetched with the new budget, got %v", repo.searches)
+	}
+
+	// Prefetched pages go stale
+	now = now.Add(prefetchPageTTL + time.Second)
+	if _, err := useCase.ListAlbumMediaItems("other", domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.searches) != 5 {
+		t.Errorf("Expected a stale page to be fetched again, got %d searches", len(repo.searches))
+	}
+}
+
+func TestGalleryUseCase_PrefetchThumbnails(t *testing.T) {
+	items := []domain.MediaItem{sized("1", "a.jpg", 10, 10), sized("2", "b.jpg", 10, 10), sized("3", "c.jpg", 10, 10), sized("4", "d.jpg", 10, 10)}
+	repo := &MockMediaItemRepository{
+		items: items,
+		files: map[string]string{"https://img/1=w64-h64-c": "1", "https://img/2=w64-h64-c": "2", "https://img/3=w64-h64-c": "3", "https://img/4=w64-h64-c": "4"},
+	}
+	cache := &MockThumbnailCache{}
+	useCase := NewGalleryUseCase(repo, cache)
+	useCase.prefetch = newPrefetcher(PrefetchOptions{Budget: 10, Thumbnails: 2})
+	ctx := context.Background()
+
+	if _, err := useCase.ListAlbumMediaItems("album", domain.PageRequest{PageSize: 10}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := useCase.Thumbnail("1", 64); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	useCase.runPrefetch(ctx)
+	if !slices.Equal(repo.downloads, []string{"https://img/1=w64-h64-c", "https://img/2=w64-h64-c", "https://img/3=w64-h64-c"}) {
+		t.Errorf("Expected the next two thumbnails to be fetched ahead, got %v", repo.downloads)
+	}
+
+	data, err := useCase.Thumbnail("2", 64)
+	if err != nil || string(data) != "2" {
+		t.Fatalf("Expected the prefetched thumbnail, got %q (%v)", data, err)
+	}
+	// 3 is cached already, so only 4 is fetched
+	useCase.runPrefetch(ctx)
+	if len(repo.downloads) != 4 || repo.downloads[3] != "https://img/4=w64-h64-c" {
+		t.Errorf("Expected only the thumbnail of 4 to be fetched, got %v", repo.downloads)
+	}
+}
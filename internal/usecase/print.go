@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Print preparation defaults
+const (
+	// DefaultMinPrintDPI is the resolution below which prints start to look soft
+	DefaultMinPrintDPI = 200
+	// printOutputDPI is the resolution prints are prepared at; sharper sources are scaled down to it
+	printOutputDPI = 300
+)
+
+// PrintStatus tells whether a photo could be prepared for a print size
+type PrintStatus string
+
+// Outcomes of preparing a photo for print
+const (
+	PrintReady  PrintStatus = "ready"
+	PrintLowRes PrintStatus = "low-res"
+	PrintFailed PrintStatus = "failed"
+)
+
+// PrintOptions configures how an album is prepared for a print service
+type PrintOptions struct {
+	// Dir receives one folder per print size
+	Dir   string
+	Sizes []domain.PrintSize
+	// MinDPI is the lowest resolution a photo may have after cropping to a print size
+	MinDPI int
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+}
+
+// PrintResult is the outcome of preparing one photo for one print size
+type PrintResult struct {
+	MediaItemID string      `json:"mediaItemId"`
+	Filename    string      `json:"filename,omitempty"`
+	Size        string      `json:"size"`
+	Status      PrintStatus `json:"status"`
+	// DPI is the resolution the photo has once cropped to the size
+	DPI int `json:"dpi"`
+	// Width and Height are the pixel dimensions of the prepared file
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// printJob is a photo to download cropped for one print size
+type printJob struct {
+	item domain.MediaItem
+	size domain.ImageSize
+	// index is the position of the photo's result
+	index int
+}
+
+// PrepareAlbumForPrint crops every photo of an album to each print size and saves the ones with enough
+// resolution under opts.Dir/<size>. Cropping and scaling are done by Google when serving the
+// photo. Photos below opts.MinDPI are reported as low-res and not saved; videos are left out.
+func (uc *DownloadUseCase) PrepareAlbumForPrint(ctx context.Context, albumID string, opts PrintOptions) ([]PrintResult, error) {
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if len(opts.Sizes) == 0 {
+		return nil, fmt.Errorf("at least one print size is required")
+	}
+
+	uc.log().Info("Fetching media items of album", "album_id", albumID)
+
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	items, err := collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.repo.SearchMediaItems(albumID, req)
+	}))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items of album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	var photos []domain.MediaItem
+	for _, item := range items {
+		if !item.IsVideo() {
+			photos = append(photos, item)
+		}
+	}
+	uc.log().Info("Preparing photos for print sizes", "photos", len(photos), "sizes", len(opts.Sizes))
+
+	results := make([]PrintResult, 0, len(photos)*len(opts.Sizes))
+	var jobs []printJob
+	for _, size := range opts.Sizes {
+		var ready []printJob
+		var readyItems []domain.MediaItem
+		for _, photo := range photos {
+			result, imageSize := planPrint(photo, size, opts.MinDPI)
+			results = append(results, result)
+			if result.Status == PrintReady {
+				ready = append(ready, printJob{item: photo, size: imageSize, index: len(results) - 1})
+				readyItems = append(readyItems, photo)
+			}
+		}
+		if len(ready) == 0 {
+			continue
+		}
+
+		dir := filepath.Join(opts.Dir, size.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create print directory: %w", err)
+		}
+		for i, name := range downloadFileNames(readyItems) {
+			results[ready[i].index].Path = filepath.Join(dir, name)
+		}
+		jobs = append(jobs, ready...)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	var done atomic.Int64
+	runConcurrently(ctx, len(jobs), workers, func(i int) {
+		job, result := jobs[i], &results[jobs[i].index]
+		download := DownloadResult{MediaItemID: job.item.ID, Path: result.Path}
+		uc.downloadItem(ctx, job.item, job.size, &download)
+		if download.Error != "" {
+			result.Status, result.Error = PrintFailed, download.Error
+		}
+		uc.log().Info("Prepared print", "done", done.Add(1), "prints", len(jobs), "path", result.Path)
+	}, func(i int, err error) {
+		result := &results[jobs[i].index]
+		result.Status, result.Error = PrintFailed, err.Error()
+	})
+
+	return results, nil
+}
+
+// planPrint works out the resolution of a photo cropped to a print size and, when it is high enough,
+// the pixel size to download it at
+func planPrint(item domain.MediaItem, size domain.PrintSize, minDPI int) (PrintResult, domain.ImageSize) {
+	result := PrintResult{MediaItemID: item.ID, Filename: item.Filename, Size: size.Name}
+
+	m := item.MediaMetadata
+	if m == nil || m.Width <= 0 || m.Height <= 0 {
+		result.Status, result.Error = PrintFailed, "photo has no dimensions"
+		return result, domain.ImageSize{}
+	}
+
+	// The crop keeps the full width or the full height, whichever limits the aspect ratio
+	printW, printH := size.Oriented(m.Width, m.Height)
+	dpi := min(float64(m.Width)/printW, float64(m.Height)/printH)
+	result.DPI = int(dpi)
+	if result.DPI < minDPI {
+		result.Status = PrintLowRes
+		return result, domain.ImageSize{}
+	}
+
+	outDPI := min(dpi, printOutputDPI)
+	result.Status = PrintReady
+	result.Width = int(math.Round(printW * outDPI))
+	result.Height = int(math.Round(printH * outDPI))
+	return result, domain.ImageSize{Width: result.Width, Height: result.Height, Crop: true}
+}
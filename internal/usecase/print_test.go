@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func sized(id, filename string, width, height int64) domain.MediaItem {
+	return domain.MediaItem{
+		ID:            id,
+		Filename:      filename,
+		BaseURL:       "https://img/" + id,
+		MimeType:      "image/jpeg",
+		MediaMetadata: &domain.MediaMetadata{Width: width, Height: height},
+	}
+}
+
+func TestDownloadUseCase_PrepareAlbumForPrint(t *testing.T) {
+	dir := t.TempDir()
+	repo := &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			sized("1", "wide.jpg", 6000, 4000),
+			sized("2", "tall.jpg", 1200, 1800),
+			sized("3", "small.jpg", 800, 600),
+			{ID: "4", Filename: "clip.mp4", BaseURL: "https://img/4", MimeType: "video/mp4"},
+		},
+		files: map[string]string{
+			"https://img/1=w1800-h1200-c": "wide 4x6",
+			"https://img/2=w1200-h1800-c": "tall 4x6",
+			"https://img/1=w2100-h1500-c": "wide 5x7",
+			"https://img/2=w1200-h1680-c": "tall 5x7",
+		},
+	}
+	useCase := NewDownloadUseCase(repo)
+	four, _ := domain.ParsePrintSize("4x6")
+	five, _ := domain.ParsePrintSize("5x7")
+
+	results, err := useCase.PrepareAlbumForPrint(context.Background(), "album", PrintOptions{
+		Dir: dir, Sizes: []domain.PrintSize{four, five}, MinDPI: 200, Workers: 2,
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []PrintResult{
+		{MediaItemID: "1", Filename: "wide.jpg", Size: "4x6", Status: PrintReady, DPI: 1000, Width: 1800, Height: 1200, Path: filepath.Join(dir, "4x6", "wide.jpg")},
+		{MediaItemID: "2", Filename: "tall.jpg", Size: "4x6", Status: PrintReady, DPI: 300, Width: 1200, Height: 1800, Path: filepath.Join(dir, "4x6", "tall.jpg")},
+		{MediaItemID: "3", Filename: "small.jpg", Size: "4x6", Status: PrintLowRes, DPI: 133},
+		{MediaItemID: "1", Filename: "wide.jpg", Size: "5x7", Status: PrintReady, DPI: 800, Width: 2100, Height: 1500, Path: filepath.Join(dir, "5x7", "wide.jpg")},
+		// The tall photo is cropped to 5x7 keeping its full width: 1200 pixels over 5 inches
+		{MediaItemID: "2", Filename: "tall.jpg", Size: "5x7", Status: PrintReady, DPI: 240, Width: 1200, Height: 1680, Path: filepath.Join(dir, "5x7", "tall.jpg")},
+		{MediaItemID: "3", Filename: "small.jpg", Size: "5x7", Status: PrintLowRes, DPI: 114},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %+v", len(want), results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], results[i])
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "5x7", "tall.jpg")); string(data) != "tall 5x7" {
+		t.Errorf("Expected the cropped photo to be saved, got %q", data)
+	}
+}
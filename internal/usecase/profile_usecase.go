@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+
+	"krupesh.faldu/internal/domain"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ProfileUseCase implements the business logic for profile operations
+type ProfileUseCase struct {
+	logging
+
+	repo domain.ProfileRepository
+}
+
+// NewProfileUseCase creates a new instance of ProfileUseCase
+func NewProfileUseCase(repo domain.ProfileRepository) *ProfileUseCase {
+	return &ProfileUseCase{
+		repo: repo,
+	}
+}
+
+// ListProfiles retrieves all configured profiles
+func (uc *ProfileUseCase) ListProfiles() ([]domain.Profile, error) {
+	profiles, err := uc.repo.ListProfiles()
+	if err != nil {
+		uc.log().Error("Failed to list profiles", "error", err)
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// AddProfile creates a new named profile
+func (uc *ProfileUseCase) AddProfile(name string) (*domain.Profile, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Creating profile", "name", name)
+
+	profile, err := uc.repo.CreateProfile(name)
+	if err != nil {
+		uc.log().Error("Failed to create profile", "name", name, "error", err)
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// SwitchProfile makes the given profile the active one
+func (uc *ProfileUseCase) SwitchProfile(name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	if _, err := uc.repo.GetProfile(name); err != nil {
+		uc.log().Error("Failed to switch profile", "error", err)
+		return err
+	}
+
+	if err := uc.repo.SetActiveProfile(name); err != nil {
+		uc.log().Error("Failed to switch profile", "error", err)
+		return err
+	}
+
+	uc.log().Info("Switched to profile", "name", name)
+	return nil
+}
+
+// RemoveProfile deletes a profile; the active profile must be switched away from first
+func (uc *ProfileUseCase) RemoveProfile(name string) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+
+	active, err := uc.repo.GetActiveProfile()
+	if err != nil {
+		return err
+	}
+
+	if name == active {
+		return fmt.Errorf("profile %s is active, switch to another profile before removing it", name)
+	}
+
+	if err := uc.repo.DeleteProfile(name); err != nil {
+		uc.log().Error("Failed to remove profile", "name", name, "error", err)
+		return err
+	}
+
+	uc.log().Info("Removed profile", "name", name)
+	return nil
+}
+
+// ResolveProfile returns the named profile, or the active profile when name is empty
+func (uc *ProfileUseCase) ResolveProfile(name string) (*domain.Profile, error) {
+	if name == "" {
+		active, err := uc.repo.GetActiveProfile()
+		if err != nil {
+			return nil, err
+		}
+		name = active
+	}
+	if err := validateProfileName(name); err != nil {
+		return nil, err
+	}
+
+	return uc.repo.GetProfile(name)
+}
+
+// validateProfileName ensures a profile name is safe to use as a directory name
+func validateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"fmt"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockProfileRepository is a mock implementation for testing
+type MockProfileRepository struct {
+	profiles map[string]domain.Profile
+	active   string
+}
+
+func newMockProfileRepository(names ...string) *MockProfileRepository {
+	m := &MockProfileRepository{
+		profiles: map[string]domain.Profile{
+			domain.DefaultProfileName: {Name: domain.DefaultProfileName},
+		},
+		active: domain.DefaultProfileName,
+	}
+	for _, name := range names {
+		m.profiles[name] = domain.Profile{Name: name}
+	}
+	return m
+}
+
+func (m *MockProfileRepository) ListProfiles() ([]domain.Profile, error) {
+	var profiles []domain.Profile
+	for _, p := range m.profiles {
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func (m *MockProfileRepository) GetProfile(name string) (*domain.Profile, error) {
+	p, ok := m.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s does not exist", name)
+	}
+	p.Active = name == m.active
+	return &p, nil
+}
+
+func (m *MockProfileRepository) CreateProfile(name string) (*domain.Profile, error) {
+	if _, ok := m.profiles[name]; ok {
+		return nil, fmt.Errorf("profile %s already exists", name)
+	}
+	p := domain.Profile{Name: name}
+	m.profiles[name] = p
+	return &p, nil
+}
+
+func (m *MockProfileRepository) DeleteProfile(name string) error {
+	if _, ok := m.profiles[name]; !ok {
+		return fmt.Errorf("profile %s does not exist", name)
+	}
+	delete(m.profiles, name)
+	return nil
+}
+
+func (m *MockProfileRepository) GetActiveProfile() (string, error) {
+	return m.active, nil
+}
+
+func (m *MockProfileRepository) SetActiveProfile(name string) error {
+	m.active = name
+	return nil
+}
+
+func TestProfileUseCase_AddProfile(t *testing.T) {
+	// Arrange
+	mockRepo := newMockProfileRepository()
+	useCase := NewProfileUseCase(mockRepo)
+
+	// Act
+	profile, err := useCase.AddProfile("work")
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if profile.Name != "work" {
+		t.Errorf("Expected profile name 'work', got '%s'", profile.Name)
+	}
+
+	if _, err := useCase.AddProfile("../escape"); err == nil {
+		t.Error("Expected error for invalid profile name, got nil")
+	}
+}
+
+func TestProfileUseCase_SwitchAndResolve(t *testing.T) {
+	// Arrange
+	mockRepo := newMockProfileRepository("work")
+	useCase := NewProfileUseCase(mockRepo)
+
+	// Act
+	err := useCase.SwitchProfile("work")
+	profile, resolveErr := useCase.ResolveProfile("")
+
+	// Assert
+	if err != nil || resolveErr != nil {
+		t.Fatalf("Expected no error, got %v / %v", err, resolveErr)
+	}
+
+	if profile.Name != "work" || !profile.Active {
+		t.Errorf("Expected active profile 'work', got %+v", profile)
+	}
+
+	if err := useCase.SwitchProfile("missing"); err == nil {
+		t.Error("Expected error switching to missing profile, got nil")
+	}
+}
+
+func TestProfileUseCase_RemoveProfile(t *testing.T) {
+	// Arrange
+	mockRepo := newMockProfileRepository("work", "family")
+	mockRepo.active = "work"
+	useCase := NewProfileUseCase(mockRepo)
+
+	// Act & Assert
+	if err := useCase.RemoveProfile("work"); err == nil {
+		t.Error("Expected error removing active profile, got nil")
+	}
+
+	if err := useCase.RemoveProfile("family"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if _, ok := mockRepo.profiles["family"]; ok {
+		t.Error("Expected profile 'family' to be removed")
+	}
+}
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	// throughputTimeConstant sets how quickly the smoothed throughput follows a change of speed:
+	// a sample weighs about a third as much once this much time has passed after it
+	throughputTimeConstant = 10 * time.Minute
+	// throughputSampleInterval is the shortest time throughput is measured over, so items that
+	// finish together do not read as an endless speed
+	throughputSampleInterval = 10 * time.Second
+	// throughputSaveInterval bounds how often the throughput is persisted while a job runs
+	throughputSaveInterval = time.Minute
+)
+
+// progressTracker reports the progress of a job as its items finish, estimating the remaining
+// time from its throughput, smoothed exponentially over time so that single slow items or bursts
+// do not make the estimate jump. The throughput is loaded from a store when the job starts and
+// saved while it runs, so a resumed job estimates from the speed it had reached instead of
+// starting without one.
+type progressTracker struct {
+	mu       sync.Mutex
+	store    domain.ThroughputStore
+	progress domain.Progress
+	job      string
+	logger   *slog.Logger
+	now      func() time.Time
+
+	total    int
+	done     int
+	failures int
+	bytes    int64
+	// rate is the smoothed number of items per second, zero while unknown
+	rate float64
+	// sampleStart and sampleItems measure the items worked on since the last sample
+	sampleStart time.Time
+	sampleItems int
+	savedAt     time.Time
+	unsaved     bool
+}
+
+// newProgressTracker starts tracking a job of total items that reports to progress, continuing
+// from the throughput saved for its kind of job; store and progress may be nil
+func newProgressTracker(store domain.ThroughputStore, progress domain.Progress, job string, total int, logger *slog.Logger) *progressTracker {
+	p := &progressTracker{store: store, progress: progress, job: job, logger: logger, now: time.Now, total: total}
+	p.start()
+	return p
+}
+
+// start loads the saved throughput and begins the first sample
+func (p *progressTracker) start() {
+	p.sampleStart, p.savedAt = p.now(), p.now()
+	if p.progress == nil {
+		p.progress = domain.NopProgress{}
+	}
+	if p.store == nil {
+		return
+	}
+	throughput, err := p.store.LoadThroughput(p.job)
+	if err != nil {
+		p.logger.Warn("Failed to read saved throughput, estimating from scratch", "job", p.job, "error", err)
+		return
+	}
+	if throughput != nil {
+		p.rate = throughput.ItemsPerSecond
+	}
+}
+
+// finish records that item is done after it sent or wrote bytes and reports the progress of
+// the job. Skipped items, such as files that were already downloaded, shorten the job but say
+// nothing about its speed.
+func (p *progressTracker) finish(item string, bytes int64, failed, skipped bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	p.bytes += bytes
+	if failed {
+		p.failures++
+	}
+	now := p.now()
+	if !skipped {
+		p.sampleItems++
+		if elapsed := now.Sub(p.sampleStart); elapsed >= throughputSampleInterval {
+			p.addSample(float64(p.sampleItems)/elapsed.Seconds(), elapsed)
+			p.sampleStart, p.sampleItems = now, 0
+		}
+	}
+	if p.unsaved && now.Sub(p.savedAt) >= throughputSaveInterval {
+		p.save(now)
+	}
+
+	p.progress.Update(domain.ProgressUpdate{
+		Job:      p.job,
+		Item:     item,
+		Failed:   failed,
+		Skipped:  skipped,
+		Done:     p.done,
+		Total:    p.total,
+		Failures: p.failures,
+		Bytes:    p.bytes,
+		ETA:      p.eta(),
+	})
+}
+
+// eta estimates the remaining time from the smoothed throughput; it is negative while unknown
+func (p *progressTracker) eta() time.Duration {
+	remaining := p.total - p.done
+	switch {
+	case remaining <= 0:
+		return 0
+	case p.rate <= 0:
+		return -1
+	}
+	return time.Duration(float64(remaining) / p.rate * float64(time.Second)).Round(time.Second)
+}
+
+// addSample blends the throughput measured over elapsed into the smoothed one; the longer the
+// sample, the more it counts
+func (p *progressTracker) addSample(rate float64, elapsed time.Duration) {
+	if p.rate <= 0 {
+		p.rate = rate
+	} else {
+		weight := 1 - math.Exp(-elapsed.Seconds()/throughputTimeConstant.Seconds())
+		p.rate += weight * (rate - p.rate)
+	}
+	p.unsaved = true
+}
+
+// close saves the throughput reached and reports the end of the job, also when it was interrupted
+func (p *progressTracker) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unsaved {
+		p.save(p.now())
+	}
+	p.progress.Finish(p.job)
+}
+
+// save persists the throughput; failures only cost the estimate of the next run
+func (p *progressTracker) save(now time.Time) {
+	p.savedAt, p.unsaved = now, false
+	if p.store == nil {
+		return
+	}
+	if err := p.store.SaveThroughput(p.job, domain.Throughput{ItemsPerSecond: p.rate, UpdatedAt: now}); err != nil {
+		p.logger.Warn("Failed to save throughput", "job", p.job, "error", err)
+	}
+}
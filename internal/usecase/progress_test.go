@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockThroughputStore keeps throughputs in memory
+type MockThroughputStore struct {
+	throughputs map[string]domain.Throughput
+	saves       int
+}
+
+func (m *MockThroughputStore) LoadThroughput(job string) (*domain.Throughput, error) {
+	throughput, ok := m.throughputs[job]
+	if !ok {
+		return nil, nil
+	}
+	return &throughput, nil
+}
+
+func (m *MockThroughputStore) SaveThroughput(job string, throughput domain.Throughput) error {
+	if m.throughputs == nil {
+		m.throughputs = make(map[string]domain.Throughput)
+	}
+	m.throughputs[job] = throughput
+	m.saves++
+	return nil
+}
+
+// MockProgress records the progress reported to it
+type MockProgress struct {
+	updates  []domain.ProgressUpdate
+	finished []string
+}
+
+func (m *MockProgress) Update(update domain.ProgressUpdate) {
+	m.updates = append(m.updates, update)
+}
+
+func (m *MockProgress) Finish(job string) {
+	m.finished = append(m.finished, job)
+}
+
+// last returns the latest update
+func (m *MockProgress) last() domain.ProgressUpdate {
+	return m.updates[len(m.updates)-1]
+}
+
+// newTestProgressTracker tracks a job of total items on a clock the test moves forward
+func newTestProgressTracker(store domain.ThroughputStore, total int) (*progressTracker, *MockProgress, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	progress := &MockProgress{}
+	p := &progressTracker{
+		store:    store,
+		progress: progress,
+		job:      domain.JobDownload,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:      func() time.Time { return now },
+		total:    total,
+	}
+	p.start()
+	return p, progress, &now
+}
+
+func TestProgressTracker_ResumesFromSavedThroughput(t *testing.T) {
+	store := &MockThroughputStore{throughputs: map[string]domain.Throughput{domain.JobDownload: {ItemsPerSecond: 0.5}}}
+	p, progress, now := newTestProgressTracker(store, 100)
+
+	// The first item already gets an estimate from the speed of the previous run
+	p.finish("a.jpg", 100, false, false)
+	if update := progress.last(); update.Done != 1 || update.Total != 100 || update.ETA != 198*time.Second {
+		t.Errorf("Expected 198s for 99 items at 0.5/s, got %+v", update)
+	}
+
+	// A slower sample of 2 items in 10s pulls the rate down only a little
+	*now = now.Add(10 * time.Second)
+	p.finish("b.jpg", 50, true, false)
+	want := 0.5 + (1-math.Exp(-10.0/600))*(0.2-0.5)
+	if math.Abs(p.rate-want) > 1e-9 {
+		t.Errorf("Expected a smoothed rate of %v, got %v", want, p.rate)
+	}
+	update := progress.last()
+	if got, want := update.ETA, time.Duration(98/want*float64(time.Second)).Round(time.Second); got != want {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if update.Item != "b.jpg" || !update.Failed || update.Failures != 1 || update.Bytes != 150 {
+		t.Errorf("Expected the failed b.jpg after 150 bytes, got %+v", update)
+	}
+
+	// Skipped items shorten the job without changing the rate
+	*now = now.Add(time.Hour)
+	rate := p.rate
+	p.finish("c.jpg", 0, false, true)
+	if p.rate != rate || !progress.last().Skipped {
+		t.Errorf("Expected skipped items to keep the rate, got %v", p.rate)
+	}
+
+	p.close()
+	if saved := store.throughputs[domain.JobDownload]; saved.ItemsPerSecond != p.rate || !saved.UpdatedAt.Equal(*now) {
+		t.Errorf("Expected the rate to be saved, got %+v", saved)
+	}
+	if len(progress.finished) != 1 || progress.finished[0] != domain.JobDownload {
+		t.Errorf("Expected the end of the download to be reported, got %v", progress.finished)
+	}
+}
+
+func TestProgressTracker_UnknownUntilFirstSample(t *testing.T) {
+	store := &MockThroughputStore{}
+	p, progress, now := newTestProgressTracker(store, 10)
+
+	if p.finish("a.jpg", 0, false, false); progress.last().ETA >= 0 {
+		t.Errorf("Expected an unknown estimate before the first sample, got %v", progress.last().ETA)
+	}
+
+	*now = now.Add(10 * time.Second)
+	if p.finish("b.jpg", 0, false, false); progress.last().ETA != 40*time.Second {
+		t.Errorf("Expected 40s for 8 items at 0.2/s, got %v", progress.last().ETA)
+	}
+
+	// Without a new sample there is nothing to save
+	p.close()
+	p.close()
+	if store.saves != 1 {
+		t.Errorf("Expected 1 save, got %d", store.saves)
+	}
+}
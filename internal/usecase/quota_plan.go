@@ -0,0 +1,241 @@
+package usecase
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Pipelines a quota plan can be made for
+const (
+	// PlanExport is export album --originals: the album is listed and every original downloaded
+	PlanExport = "export"
+	// PlanDownload is download album, which calls the API like PlanExport
+	PlanDownload = "download"
+	// PlanBackup is backup run: the library is listed and every original downloaded
+	PlanBackup = "backup"
+	// PlanIndex is index build: the albums, their media items and the library are listed
+	PlanIndex = "index"
+	// PlanUpload is media upload: every file is uploaded and created in batches, in a new album
+	// when there is one
+	PlanUpload = "upload"
+	// PlanImport is import takeout: the albums are created with their descriptions, then every
+	// file is uploaded and created album by album
+	PlanImport = "import"
+)
+
+// planPipelines are the pipelines PlanQuota knows, in the order they are listed in errors
+var planPipelines = []string{PlanExport, PlanDownload, PlanBackup, PlanIndex, PlanUpload, PlanImport}
+
+// PlanPipelines returns the pipelines PlanQuota knows
+func PlanPipelines() []string {
+	return slices.Clone(planPipelines)
+}
+
+const (
+	// DefaultDailyQuota is how many requests to the Library API a project may send a day; uploads
+	// count against it
+	DefaultDailyQuota = 10000
+	// DefaultMediaQuota is how many requests for the bytes of media items a project may send a
+	// day, the base URL downloads of originals and thumbnails
+	DefaultMediaQuota = 75000
+	// defaultPlanLatency is how long a request is assumed to take unless another latency is given
+	defaultPlanLatency = 300 * time.Millisecond
+	// defaultPlanItemSize is the average size of a file unless another is given, a phone photo in
+	// original quality as in the growth forecast
+	defaultPlanItemSize = defaultPhotoSize
+)
+
+// QuotaPlanOptions describes a pending pipeline and the limits it runs under
+type QuotaPlanOptions struct {
+	// Pipeline is one of PlanExport, PlanDownload, PlanBackup, PlanIndex, PlanUpload or PlanImport
+	Pipeline string
+	// Items is how many media items or files the pipeline handles
+	Items int
+	// Albums is how many albums it lists or creates; upload creates one album at most
+	Albums int
+	// Workers is how many uploads or downloads run at once; values below 1 use one
+	Workers int
+	// MaxRPS bounds the requests a second as api.max_rps does; 0 means no limit
+	MaxRPS float64
+	// Latency is how long a request takes; values below 1 use 300ms
+	Latency time.Duration
+	// ItemSize is the average size of a file in bytes; values below 1 use 4 MiB
+	ItemSize int64
+	// Bandwidth is how many bytes a second the connection carries; 0 leaves transfers out of
+	// the duration
+	Bandwidth int64
+	// DailyQuota and MediaQuota are the daily quotas of the project; values below 1 use
+	// DefaultDailyQuota and DefaultMediaQuota
+	DailyQuota int
+	MediaQuota int
+	// Pricing is what the storage provider of the backup target charges; with it a backup plan
+	// estimates what the copies cost
+	Pricing *domain.BackupPricing
+}
+
+// QuotaStep is a part of a pipeline with the requests it sends
+type QuotaStep struct {
+	Name  string `json:"name"`
+	Calls int    `json:"calls"`
+	// Media is set for requests for the bytes of media items, which count against the media quota
+	// instead of the daily one
+	Media bool `json:"media,omitempty"`
+	// Seconds is how long the requests of the step take, at the rate limit or the pace the
+	// workers reach, and without waiting for a quota to reset
+	Seconds int64 `json:"seconds"`
+}
+
+// QuotaPlan is what a pipeline costs in requests and time
+type QuotaPlan struct {
+	Pipeline string      `json:"pipeline"`
+	Items    int         `json:"items"`
+	Albums   int         `json:"albums"`
+	Steps    []QuotaStep `json:"steps"`
+	// APICalls and MediaCalls are the requests counting against the daily and the media quota
+	APICalls   int `json:"apiCalls"`
+	MediaCalls int `json:"mediaCalls"`
+	// Seconds is how long all requests take when no quota runs out
+	Seconds int64 `json:"seconds"`
+	// Days is how many days the pipeline needs, counting the day it starts
+	Days int `json:"days"`
+	// QuotaBound is set when the quotas rather than the time the requests take set Days, so a
+	// higher rate limit would not finish sooner
+	QuotaBound bool `json:"quotaBound,omitempty"`
+	// Cost is what a backup costs at the storage provider; nil without pricing
+	Cost *BackupCost `json:"cost,omitempty"`
+}
+
+// BackupCost is what the copies of a backup cost at the storage provider of its target, in dollars
+type BackupCost struct {
+	// StorageGB is how many GiB the copies take
+	StorageGB float64 `json:"storageGB"`
+	// Storage is charged every month the copies are kept
+	Storage float64 `json:"storagePerMonth"`
+	// Upload is charged once for storing the copies
+	Upload float64 `json:"upload"`
+	// Egress is charged every time the copies are downloaded in full, as a restore does
+	Egress float64 `json:"egress"`
+}
+
+// planStep is a step before its duration is known
+type planStep struct {
+	name  string
+	calls int
+	media bool
+	// concurrent is set for steps spread over the workers, such as uploads; listing pages follow
+	// their page tokens one after another
+	concurrent bool
+	// bytes is how much the step transfers
+	bytes int64
+}
+
+// PlanQuota simulates a pipeline without calling the API: it counts the requests every step sends
+// the way the commands send them, such as pages of 100 media items and batches of 50, and tells
+// how long they take under the rate limit and how many days the quotas stretch them over.
+// Counts are upper bounds where the library decides, such as listing every album in a page of
+// its own on top of the pages of all media items.
+func PlanQuota(opts QuotaPlanOptions) (*QuotaPlan, error) {
+	if !slices.Contains(planPipelines, opts.Pipeline) {
+		return nil, fmt.Errorf("%w: unknown pipeline %q, want one of %v", domain.ErrInvalidArgument, opts.Pipeline, planPipelines)
+	}
+	if opts.Items < 0 || opts.Albums < 0 || opts.MaxRPS < 0 || opts.Bandwidth < 0 {
+		return nil, fmt.Errorf("%w: items, albums, max RPS and bandwidth must not be negative", domain.ErrInvalidArgument)
+	}
+	workers := max(opts.Workers, 1)
+	latency := cmp.Or(max(opts.Latency, 0), defaultPlanLatency)
+	itemSize := cmp.Or(max(opts.ItemSize, 0), defaultPlanItemSize)
+	dailyQuota := cmp.Or(max(opts.DailyQuota, 0), DefaultDailyQuota)
+	mediaQuota := cmp.Or(max(opts.MediaQuota, 0), DefaultMediaQuota)
+
+	items, albums := opts.Items, opts.Albums
+	mediaPages := ceilDiv(items, domain.MaxMediaItemPageSize)
+	transfer := int64(items) * itemSize
+	var steps []planStep
+	switch opts.Pipeline {
+	case PlanExport, PlanDownload:
+		steps = []planStep{
+			{name: "list album", calls: max(mediaPages, 1)},
+			{name: "download originals", calls: items, media: true, concurrent: true, bytes: transfer},
+		}
+	case PlanBackup:
+		steps = []planStep{
+			{name: "list library", calls: max(mediaPages, 1)},
+			{name: "download originals", calls: items, media: true, concurrent: true, bytes: transfer},
+		}
+	case PlanIndex:
+		steps = []planStep{
+			{name: "list albums", calls: max(ceilDiv(albums, domain.MaxAlbumPageSize), 1)},
+			{name: "list album items", calls: albums + mediaPages},
+			{name: "list library", calls: max(mediaPages, 1)},
+		}
+	case PlanUpload:
+		steps = []planStep{
+			{name: "create album", calls: min(albums, 1)},
+			{name: "upload files", calls: items, concurrent: true, bytes: transfer},
+			{name: "create media items", calls: ceilDiv(items, domain.MaxBatchMediaItems)},
+		}
+	case PlanImport:
+		steps = []planStep{
+			{name: "create albums", calls: albums},
+			{name: "add descriptions", calls: albums},
+			{name: "upload files", calls: items, concurrent: true, bytes: transfer},
+			// Every album ends in a batch of its own, however few media items are left for it
+			{name: "create media items", calls: ceilDiv(items, domain.MaxBatchMediaItems) + albums},
+		}
+	}
+
+	plan := &QuotaPlan{Pipeline: opts.Pipeline, Items: items, Albums: albums}
+	for _, s := range steps {
+		if s.calls == 0 {
+			continue
+		}
+		rate := 1 / latency.Seconds()
+		if s.concurrent {
+			rate *= float64(workers)
+		}
+		if opts.MaxRPS > 0 {
+			rate = min(rate, opts.MaxRPS)
+		}
+		seconds := float64(s.calls) / rate
+		if opts.Bandwidth > 0 {
+			// Transfers overlap the requests, so the slower of the two sets the pace
+			seconds = max(seconds, float64(s.bytes)/float64(opts.Bandwidth))
+		}
+		step := QuotaStep{Name: s.name, Calls: s.calls, Media: s.media, Seconds: int64(math.Ceil(seconds))}
+		plan.Steps = append(plan.Steps, step)
+		plan.Seconds += step.Seconds
+		if s.media {
+			plan.MediaCalls += s.calls
+		} else {
+			plan.APICalls += s.calls
+		}
+	}
+
+	quotaDays := max(ceilDiv(plan.APICalls, dailyQuota), ceilDiv(plan.MediaCalls, mediaQuota))
+	timeDays := int(math.Ceil(float64(plan.Seconds) / (24 * 60 * 60)))
+	plan.Days = max(quotaDays, timeDays, 1)
+	plan.QuotaBound = quotaDays > timeDays
+	if opts.Pipeline == PlanBackup && opts.Pricing != nil {
+		if err := opts.Pricing.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidArgument, err)
+		}
+		gb := float64(transfer) / (1 << 30)
+		plan.Cost = &BackupCost{
+			StorageGB: gb,
+			Storage:   gb * opts.Pricing.StoragePerGBMonth,
+			Upload:    float64(items) / 1000 * opts.Pricing.PutPer1000,
+			Egress:    gb * opts.Pricing.EgressPerGB,
+		}
+	}
+	return plan, nil
+}
+
+// ceilDiv divides n by d, rounding up
+func ceilDiv(n, d int) int {
+	return (n + d - 1) / d
+}
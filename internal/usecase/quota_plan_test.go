@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestPlanQuota_Export(t *testing.T) {
+	// 800 pages at 300ms, then 80k downloads over 4 workers
+	plan, err := PlanQuota(QuotaPlanOptions{Pipeline: PlanExport, Items: 80000, Workers: 4})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, fmt.Sprintf("%s calls=%d media=%t seconds=%d", step.Name, step.Calls, step.Media, step.Seconds))
+	}
+	want := []string{
+		"list album calls=800 media=false seconds=240",
+		"download originals calls=80000 media=true seconds=6000",
+	}
+	if fmt.Sprint(steps) != fmt.Sprint(want) {
+		t.Errorf("Expected steps %v, got %v", want, steps)
+	}
+	if plan.APICalls != 800 || plan.MediaCalls != 80000 || plan.Seconds != 6240 {
+		t.Errorf("Expected 800 API and 80000 media calls over 1h44m, got %+v", plan)
+	}
+	// The downloads take under two hours but pass the media quota of 75000 a day
+	if plan.Days != 2 || !plan.QuotaBound {
+		t.Errorf("Expected two days set by the quota, got %d days, quota bound %t", plan.Days, plan.QuotaBound)
+	}
+}
+
+func TestPlanQuota_UploadUnderRateLimit(t *testing.T) {
+	plan, err := PlanQuota(QuotaPlanOptions{Pipeline: PlanUpload, Items: 25000, Albums: 3, Workers: 8, MaxRPS: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// One album, 25000 uploads and 500 batches, all at one request a second
+	if plan.APICalls != 25501 || plan.MediaCalls != 0 || plan.Seconds != 25501 {
+		t.Errorf("Expected 25501 API calls at 1 RPS, got %+v", plan)
+	}
+	if plan.Days != 3 || !plan.QuotaBound {
+		t.Errorf("Expected three days of the daily quota, got %d days, quota bound %t", plan.Days, plan.QuotaBound)
+	}
+
+	// A slow connection paces the uploads instead of the rate limit
+	plan, err = PlanQuota(QuotaPlanOptions{Pipeline: PlanUpload, Items: 100, Workers: 4, ItemSize: 4 << 20, Bandwidth: 1 << 20})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(plan.Steps) != 2 || plan.Steps[0].Seconds != 400 {
+		t.Errorf("Expected the uploads to take 400s and no album to be created, got %+v", plan.Steps)
+	}
+	if plan.Days != 1 || plan.QuotaBound {
+		t.Errorf("Expected a single day, got %d days, quota bound %t", plan.Days, plan.QuotaBound)
+	}
+}
+
+func TestPlanQuota_IndexAndImport(t *testing.T) {
+	plan, err := PlanQuota(QuotaPlanOptions{Pipeline: PlanIndex, Items: 5000, Albums: 120})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 3 pages of albums, 120 albums plus 50 pages of their items at most, 50 pages of the library
+	if plan.APICalls != 223 || plan.MediaCalls != 0 {
+		t.Errorf("Expected 223 API calls, got %+v", plan)
+	}
+
+	plan, err = PlanQuota(QuotaPlanOptions{Pipeline: PlanImport, Items: 120, Albums: 2, Workers: 4})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 2 albums with descriptions, 120 uploads and 3 batches plus one ending each album
+	if plan.APICalls != 129 {
+		t.Errorf("Expected 129 API calls, got %+v", plan)
+	}
+
+	if _, err := PlanQuota(QuotaPlanOptions{Pipeline: "sync"}); err == nil {
+		t.Error("Expected an unknown pipeline to be rejected")
+	}
+	if _, err := PlanQuota(QuotaPlanOptions{Pipeline: PlanBackup, Items: -1}); err == nil {
+		t.Error("Expected a negative item count to be rejected")
+	}
+}
+
+func TestPlanQuota_BackupCost(t *testing.T) {
+	pricing := &domain.BackupPricing{StoragePerGBMonth: 0.02, EgressPerGB: 0.09, PutPer1000: 0.005}
+	// 20000 originals of 4 MiB are 78.125 GiB
+	plan, err := PlanQuota(QuotaPlanOptions{Pipeline: PlanBackup, Items: 20000, Workers: 4, Pricing: pricing})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got := fmt.Sprintf("%.3f %.4f %.4f %.4f", plan.Cost.StorageGB, plan.Cost.Storage, plan.Cost.Upload, plan.Cost.Egress)
+	if want := "78.125 1.5625 0.1000 7.0312"; got != want {
+		t.Errorf("Expected GiB, storage, upload and egress %s, got %s", want, got)
+	}
+
+	// Only backups are stored at a provider
+	plan, err = PlanQuota(QuotaPlanOptions{Pipeline: PlanExport, Items: 20000, Pricing: pricing})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if plan.Cost != nil {
+		t.Errorf("Expected no cost for an export, got %+v", plan.Cost)
+	}
+
+	_, err = PlanQuota(QuotaPlanOptions{Pipeline: PlanBackup, Items: 1, Pricing: &domain.BackupPricing{EgressPerGB: -1}})
+	if !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected a negative price to be rejected, got %v", err)
+	}
+}
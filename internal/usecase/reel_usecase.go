@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// Defaults of highlight reels
+const (
+	defaultReelItems         = 20
+	defaultReelPhotoDuration = 3 * time.Second
+	defaultReelClipDuration  = 5 * time.Second
+	defaultReelWidth         = 1920
+	defaultReelHeight        = 1080
+	reelFPS                  = 30
+)
+
+// ReelOptions configures a highlight reel
+type ReelOptions struct {
+	// AlbumID is the album the reel is made of; without it the library is searched by Dates
+	AlbumID string
+	// Dates keeps media items taken within the range; it is required without AlbumID
+	Dates domain.DateRange
+	// MaxItems caps the number of scenes, picked evenly over time; values below 1 use 20
+	MaxItems int
+	// PhotoDuration is how long each photo is shown; zero uses 3 seconds
+	PhotoDuration time.Duration
+	// ClipDuration is where videos are cut off; zero uses 5 seconds
+	ClipDuration time.Duration
+	// Width and Height are the frame size; zero values use 1920x1080
+	Width  int
+	Height int
+	// Output is the video file to write
+	Output string
+	// Upload adds the finished reel to the library
+	Upload bool
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// TimeZone decides which day media items were taken on for Dates; nil uses UTC
+	TimeZone *time.Location
+}
+
+// ReelResult describes a highlight reel that was assembled
+type ReelResult struct {
+	Path   string
+	Photos int
+	Videos int
+	// Missing counts picked media items that could not be downloaded and were left out
+	Missing int
+	// MediaItemID is set when the reel was uploaded
+	MediaItemID string
+}
+
+// ReelUseCase assembles photos and videos of an album or a date range into a highlight reel
+type ReelUseCase struct {
+	logging
+	cleanup
+
+	mediaRepo domain.MediaItemRepository
+	assembler domain.ReelAssembler
+	downloads *DownloadUseCase
+	uploads   *UploadUseCase
+}
+
+// NewReelUseCase creates a new instance of ReelUseCase
+func NewReelUseCase(mediaRepo domain.MediaItemRepository, albumRepo domain.AlbumRepository, assembler domain.ReelAssembler) *ReelUseCase {
+	return &ReelUseCase{
+		mediaRepo: mediaRepo,
+		assembler: assembler,
+		downloads: NewDownloadUseCase(mediaRepo),
+		uploads:   NewUploadUseCase(mediaRepo, albumRepo),
+	}
+}
+
+// SetLogger replaces the logger the use case and the use cases it builds on report to
+func (uc *ReelUseCase) SetLogger(logger *slog.Logger) {
+	uc.logging.SetLogger(logger)
+	uc.downloads.SetLogger(logger)
+	uc.uploads.SetLogger(logger)
+}
+
+// SetExitHooks registers the cleanup of the use case and the use cases it builds on with hooks
+func (uc *ReelUseCase) SetExitHooks(hooks domain.ExitHooks) {
+	uc.cleanup.SetExitHooks(hooks)
+	uc.downloads.SetExitHooks(hooks)
+	uc.uploads.SetExitHooks(hooks)
+}
+
+// RenderReel picks media items in the order they were taken, downloads them to a temporary
+// directory and hands them to the assembler; with opts.Upload the reel is uploaded afterwards.
+// Items that fail to download are left out rather than failing the reel.
+func (uc *ReelUseCase) RenderReel(ctx context.Context, opts ReelOptions) (*ReelResult, error) {
+	if opts.Output == "" {
+		return nil, fmt.Errorf("an output file is required")
+	}
+	if opts.AlbumID == "" && opts.Dates.Start.IsZero() {
+		return nil, fmt.Errorf("an album or a date range is required")
+	}
+
+	items, err := uc.reelItems(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items = pickEvenly(items, cmp.Or(max(opts.MaxItems, 0), defaultReelItems))
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no photos or playable videos found")
+	}
+
+	dir, err := os.MkdirTemp("", "reel-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer uc.onExit("remove "+dir, removeAll(dir))()
+
+	spec := domain.ReelSpec{
+		Width:  cmp.Or(opts.Width, defaultReelWidth),
+		Height: cmp.Or(opts.Height, defaultReelHeight),
+		FPS:    reelFPS,
+		Output: opts.Output,
+	}
+	result := &ReelResult{Path: opts.Output}
+	for _, clip := range uc.downloadClips(ctx, items, dir, spec, opts) {
+		switch {
+		case clip.Path == "":
+			result.Missing++
+			continue
+		case clip.Video:
+			result.Videos++
+		default:
+			result.Photos++
+		}
+		spec.Clips = append(spec.Clips, clip)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(spec.Clips) == 0 {
+		return nil, fmt.Errorf("none of the %d media items could be downloaded", len(items))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Output), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	uc.log().Info("Assembling highlight reel", "scenes", len(spec.Clips), "path", opts.Output)
+	if err := uc.assembler.Assemble(ctx, spec); err != nil {
+		uc.log().Error("Failed to assemble highlight reel", "error", err)
+		return nil, err
+	}
+	uc.log().Info("Successfully assembled highlight reel", "photos", result.Photos, "videos", result.Videos, "path", opts.Output)
+
+	if opts.Upload {
+		if result.MediaItemID, err = uc.upload(ctx, opts.Output); err != nil {
+			return result, fmt.Errorf("the reel was saved to %s but could not be uploaded: %w", opts.Output, err)
+		}
+	}
+	return result, nil
+}
+
+// reelItems lists the photos and playable videos of the album or date range, oldest first
+func (uc *ReelUseCase) reelItems(ctx context.Context, opts ReelOptions) ([]domain.MediaItem, error) {
+	fetch := func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.mediaRepo.SearchMediaItems(opts.AlbumID, req)
+	}
+	if opts.AlbumID != "" {
+		uc.log().Info("Fetching media items of album", "album_id", opts.AlbumID)
+	} else {
+		uc.log().Info("Searching media items taken in date range", "from", opts.Dates.Start.Format(time.DateOnly), "to", opts.Dates.End.Format(time.DateOnly))
+		filters := domain.SearchFilters{DateRanges: []domain.DateRange{opts.Dates}}.Widen()
+		fetch = func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItemsByFilters(filters, req)
+		}
+	}
+
+	items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, fetch))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items", "error", err)
+		return nil, err
+	}
+
+	// Videos Google has not finished processing cannot be downloaded yet, and the search is a
+	// day wider than the range since the API picks its own time zone
+	loc := cmp.Or(opts.TimeZone, time.UTC)
+	items = slices.DeleteFunc(items, func(item domain.MediaItem) bool {
+		video := item.MediaMetadata != nil && item.MediaMetadata.Video != nil
+		if video && item.MediaMetadata.Video.Status != "" && item.MediaMetadata.Video.Status != domain.VideoProcessingReady {
+			return true
+		}
+		return opts.AlbumID == "" && !opts.Dates.Contains(creationTime(item), loc)
+	})
+	slices.SortStableFunc(items, func(a, b domain.MediaItem) int {
+		return creationTime(a).Compare(creationTime(b))
+	})
+	return items, nil
+}
+
+// downloadClips saves every item in dir: photos scaled to fit the frame, videos as video files.
+// Clips of items that failed to download have no path.
+func (uc *ReelUseCase) downloadClips(ctx context.Context, items []domain.MediaItem, dir string, spec domain.ReelSpec, opts ReelOptions) []domain.ReelClip {
+	uc.log().Info("Downloading media items for highlight reel", "media_items", len(items))
+
+	clips := make([]domain.ReelClip, len(items))
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+	runConcurrently(ctx, len(items), workers, func(i int) {
+		item := items[i]
+		clip := domain.ReelClip{Video: item.IsVideo(), Duration: cmp.Or(opts.PhotoDuration, defaultReelPhotoDuration)}
+		size := domain.ImageSize{Width: spec.Width, Height: spec.Height}
+		ext := ".jpg"
+		if clip.Video {
+			clip.Duration = cmp.Or(opts.ClipDuration, defaultReelClipDuration)
+			size = domain.ImageSize{}
+			ext = cmp.Or(strings.ToLower(filepath.Ext(item.Filename)), ".mp4")
+		}
+
+		result := DownloadResult{MediaItemID: item.ID, Path: filepath.Join(dir, fmt.Sprintf("%04d%s", i, ext))}
+		uc.downloads.downloadItem(ctx, item, size, &result)
+		if result.Error != "" {
+			uc.log().Warn("Failed to download media item, leaving it out", "media_item_id", item.ID, "error", result.Error)
+			return
+		}
+		clip.Path = result.Path
+		clips[i] = clip
+	}, func(int, error) {})
+	return clips
+}
+
+// upload adds the reel at path to the library and returns its media item ID
+func (uc *ReelUseCase) upload(ctx context.Context, path string) (string, error) {
+	uc.log().Info("Uploading highlight reel", "path", path)
+
+	name := filepath.Base(path)
+	if mediaMimeType(name) == "" {
+		return "", fmt.Errorf("%s is not a video format Google Photos accepts", name)
+	}
+	token, _, err := uc.uploads.uploadFile(ctx, os.DirFS(filepath.Dir(path)), name)
+	if err != nil {
+		uc.log().Error("Failed to upload highlight reel", "error", err)
+		return "", err
+	}
+
+	results := []UploadResult{{Path: path}}
+	uc.uploads.createMediaItems("", []string{name}, []string{token}, nil, results)
+	if results[0].Error != "" {
+		return "", fmt.Errorf("%s", results[0].Error)
+	}
+	uc.log().Info("Successfully uploaded highlight reel", "media_item_id", results[0].MediaItemID)
+	return results[0].MediaItemID, nil
+}
+
+// pickEvenly keeps n items spread evenly over items, including the first one
+func pickEvenly(items []domain.MediaItem, n int) []domain.MediaItem {
+	if len(items) <= n {
+		return items
+	}
+	picked := make([]domain.MediaItem, n)
+	for i := range picked {
+		picked[i] = items[i*len(items)/n]
+	}
+	return picked
+}
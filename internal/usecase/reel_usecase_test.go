@@ -0,0 +1,155 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockReelAssembler records the spec it was given and writes a placeholder video
+type MockReelAssembler struct {
+	spec    domain.ReelSpec
+	content []string
+}
+
+func (m *MockReelAssembler) Assemble(ctx context.Context, spec domain.ReelSpec) error {
+	m.spec = spec
+	for _, clip := range spec.Clips {
+		b, err := os.ReadFile(clip.Path)
+		if err != nil {
+			return err
+		}
+		m.content = append(m.content, string(b))
+	}
+	return os.WriteFile(spec.Output, []byte("reel"), 0o644)
+}
+
+func reelFixture() *MockMediaItemRepository {
+	video := domain.MediaItem{ID: "v", Filename: "clip.MOV", BaseURL: "https://img/v", MimeType: "video/quicktime",
+		MediaMetadata: &domain.MediaMetadata{Video: &domain.VideoMetadata{Status: domain.VideoProcessingReady}}}
+	processing := domain.MediaItem{ID: "p", Filename: "new.mp4", BaseURL: "https://img/p", MimeType: "video/mp4",
+		MediaMetadata: &domain.MediaMetadata{Video: &domain.VideoMetadata{Status: domain.VideoProcessingProcessing}}}
+	return &MockMediaItemRepository{
+		items: []domain.MediaItem{
+			takenOn(sized("late", "b.jpg", 4000, 3000), 2024, time.May),
+			takenOn(video, 2024, time.March),
+			takenOn(processing, 2024, time.April),
+			takenOn(sized("early", "a.jpg", 4000, 3000), 2024, time.January),
+			takenOn(sized("gone", "c.jpg", 4000, 3000), 2024, time.February),
+		},
+		// gone has no file and is left out
+		files: map[string]string{
+			"https://img/early=w640-h360": "early",
+			"https://img/v=dv":            "video",
+			"https://img/late=w640-h360":  "late",
+		},
+	}
+}
+
+func TestReelUseCase_RenderReel(t *testing.T) {
+	repo := reelFixture()
+	assembler := &MockReelAssembler{}
+	useCase := NewReelUseCase(repo, &MockAlbumRepository{}, assembler)
+	out := filepath.Join(t.TempDir(), "reels", "holiday.mp4")
+
+	result, err := useCase.RenderReel(context.Background(), ReelOptions{AlbumID: "album", Width: 640, Height: 360, Output: out, ClipDuration: 2 * time.Second})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Photos != 2 || result.Videos != 1 || result.Missing != 1 || result.MediaItemID != "" {
+		t.Errorf("Expected 2 photos, 1 video and 1 missing, got %+v", result)
+	}
+	// Scenes are in the order the items were taken, the unprocessed video is skipped
+	if got := strings.Join(assembler.content, ","); got != "early,video,late" {
+		t.Errorf("Expected scenes early,video,late, got %s", got)
+	}
+	spec := assembler.spec
+	if spec.Width != 640 || spec.Height != 360 || spec.Output != out {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+	if !spec.Clips[1].Video || spec.Clips[1].Duration != 2*time.Second || filepath.Ext(spec.Clips[1].Path) != ".mov" {
+		t.Errorf("Expected a 2s .mov video clip, got %+v", spec.Clips[1])
+	}
+	if spec.Clips[0].Video || spec.Clips[0].Duration != defaultReelPhotoDuration {
+		t.Errorf("Expected a photo shown for the default duration, got %+v", spec.Clips[0])
+	}
+	// The downloaded clips are removed once the reel is assembled
+	if _, err := os.Stat(spec.Clips[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary clips to be removed, got %v", err)
+	}
+}
+
+func TestReelUseCase_RenderReel_DatesAndUpload(t *testing.T) {
+	repo := reelFixture()
+	// New Year's Eve in UTC is already 2024 in Tokyo, New Year's Day in UTC is still 2024 there
+	eve := sized("eve", "eve.jpg", 4000, 3000)
+	eve.MediaMetadata.CreationTime = time.Date(2023, 12, 31, 20, 0, 0, 0, time.UTC)
+	late := sized("late-night", "late.jpg", 4000, 3000)
+	late.MediaMetadata.CreationTime = time.Date(2024, 12, 31, 20, 0, 0, 0, time.UTC)
+	repo.recent = append(repo.items, eve, late)
+	repo.files["https://img/eve=w640-h360"] = "eve"
+	repo.files["https://img/late-night=w640-h360"] = "late-night"
+	assembler := &MockReelAssembler{}
+	useCase := NewReelUseCase(repo, &MockAlbumRepository{}, assembler)
+	dates := domain.DateRange{Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)}
+	out := filepath.Join(t.TempDir(), "2024.mp4")
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	result, err := useCase.RenderReel(context.Background(), ReelOptions{Dates: dates, TimeZone: tokyo, Width: 640, Height: 360, Output: out, Upload: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The API is asked for a day more on both sides
+	if len(repo.filterSearches) != 1 || repo.filterSearches[0].DateRanges[0] != dates.Widen() {
+		t.Errorf("Expected one search by the widened date range, got %+v", repo.filterSearches)
+	}
+	if got := strings.Join(assembler.content, ","); got != "eve,early,video,late" {
+		t.Errorf("Expected the days of 2024 in Tokyo, got %s", got)
+	}
+	if result.MediaItemID != "id-2024.mp4" || repo.albumID != "" {
+		t.Errorf("Expected the reel uploaded to the library, got %q in album %q", result.MediaItemID, repo.albumID)
+	}
+}
+
+func TestReelUseCase_RenderReel_UploadFails(t *testing.T) {
+	repo := reelFixture()
+	repo.failCreate = map[string]bool{"holiday.mp4": true}
+	useCase := NewReelUseCase(repo, &MockAlbumRepository{}, &MockReelAssembler{})
+	out := filepath.Join(t.TempDir(), "holiday.mp4")
+
+	result, err := useCase.RenderReel(context.Background(), ReelOptions{AlbumID: "album", Width: 640, Height: 360, Output: out, Upload: true})
+
+	// The reel is kept and reported even though it could not be uploaded
+	if err == nil || !strings.Contains(err.Error(), "saved to "+out) {
+		t.Errorf("Expected an upload error naming the saved reel, got %v", err)
+	}
+	if result == nil || result.Path != out {
+		t.Errorf("Expected the result of the saved reel, got %+v", result)
+	}
+}
+
+func TestPickEvenly(t *testing.T) {
+	var items []domain.MediaItem
+	for _, id := range strings.Split("abcdefghij", "") {
+		items = append(items, domain.MediaItem{ID: id})
+	}
+
+	var ids []string
+	for _, item := range pickEvenly(items, 4) {
+		ids = append(ids, item.ID)
+	}
+
+	if got := strings.Join(ids, ""); got != "acfh" {
+		t.Errorf("Expected acfh, got %s", got)
+	}
+	if got := pickEvenly(items, 20); len(got) != 10 {
+		t.Errorf("Expected all 10 items when fewer than the cap, got %d", len(got))
+	}
+}
@@ -0,0 +1,223 @@
+package usecase
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// RestoreAlbum rebuilds an album from an archive written by ExportAlbum with originals. Like a
+// Takeout import, the album is created first, headed by the description the manifest records, and
+// an app-created album of the same title is reused so an interrupted restore can be run again:
+// the originals it already holds, by file name, are left out. The others are then uploaded with at
+// most opts.Workers at a time and created in it with their descriptions, in album order. Items
+// whose original is not in the archive are reported as failed.
+func (uc *UploadUseCase) RestoreAlbum(ctx context.Context, archive string, opts TakeoutOptions) (result *TakeoutImport, err error) {
+	ctx, span := uc.trace(ctx, "upload.restore", "archive", archive, "dry_run", opts.DryRun)
+	defer func() { span.End(err) }()
+
+	fsys, closeArchive, err := openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer uc.onExit("close "+archive, func(context.Context) error { return closeArchive() })()
+
+	manifest, err := readExportManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+	result, albumItems := restorePlan(manifest)
+	uc.log().Info("Read export archive", "album_title", manifest.Album.Title, "media_items", len(result.Items), "originals", len(albumItems[manifest.Album.Title]))
+	if len(albumItems[manifest.Album.Title]) == 0 {
+		return nil, fmt.Errorf("%w: archive %s holds no originals; export the album with --originals", domain.ErrInvalidArgument, archive)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	uc.createTakeoutAlbums(ctx, result)
+	if album := result.Albums[0]; album.Reused {
+		if err := uc.skipRestored(ctx, result, albumItems); err != nil {
+			return result, err
+		}
+		if len(albumItems[album.Title]) == 0 {
+			result.Albums[0].MediaItems = 0
+			uc.log().Info("Album was restored before", "album_title", album.Title, "album_id", album.AlbumID, "media_items", result.Existing)
+			return result, nil
+		}
+	}
+	batches := takeoutBatches(result, albumItems)
+	for n, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		uc.importTakeoutBatch(ctx, fsys, result, batch, opts.Workers, n+1, len(batches))
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	uc.log().Info("Restored album", "album_title", manifest.Album.Title, "album_id", result.Albums[0].AlbumID, "media_items", result.Albums[0].MediaItems)
+	return result, nil
+}
+
+// restorePlan turns a manifest into the import of a single album. Items without an original are
+// failed up front and left out of the album, so no batch uploads them.
+func restorePlan(manifest *ExportManifest) (*TakeoutImport, map[string][]int) {
+	title := manifest.Album.Title
+	result := &TakeoutImport{Albums: []TakeoutAlbum{{Title: title, Description: manifest.Description}}}
+	albumItems := make(map[string][]int)
+	for _, item := range manifest.MediaItems {
+		restored := TakeoutItem{Path: item.File, Description: item.Description, Taken: creationTime(item.MediaItem), Albums: []string{title}}
+		if item.File == "" {
+			restored.Path, restored.Error = item.Filename, "the archive holds no original"
+		} else {
+			albumItems[title] = append(albumItems[title], len(result.Items))
+		}
+		result.Items = append(result.Items, restored)
+	}
+	result.Albums[0].MediaItems = len(albumItems[title])
+	return result, albumItems
+}
+
+// skipRestored leaves the items the reused album of result already holds out of albumItems. They
+// are matched by the file name they are uploaded with, each media item of the album once, and
+// take its ID.
+func (uc *UploadUseCase) skipRestored(ctx context.Context, result *TakeoutImport, albumItems map[string][]int) error {
+	album := result.Albums[0]
+	held, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.mediaRepo.SearchMediaItems(album.AlbumID, req)
+	}))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items of album", "album_id", album.AlbumID, "error", err)
+		return err
+	}
+	byName := make(map[string][]string)
+	for _, item := range held {
+		byName[item.Filename] = append(byName[item.Filename], item.ID)
+	}
+
+	var rest []int
+	for _, i := range albumItems[album.Title] {
+		name := path.Base(result.Items[i].Path)
+		if ids := byName[name]; len(ids) > 0 {
+			result.Items[i].MediaItemID, byName[name] = ids[0], ids[1:]
+			result.Existing++
+			continue
+		}
+		rest = append(rest, i)
+	}
+	albumItems[album.Title] = rest
+	return nil
+}
+
+// readExportManifest reads the manifest at the root of an export archive
+func readExportManifest(fsys fs.FS) (*ExportManifest, error) {
+	data, err := fs.ReadFile(fsys, exportManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an export archive: %v", domain.ErrInvalidArgument, err)
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid %s: %v", domain.ErrInvalidArgument, exportManifestName, err)
+	}
+	if manifest.Version > exportManifestVersion {
+		return nil, fmt.Errorf("%w: manifest version %d is newer than this tool supports (%d)", domain.ErrInvalidArgument, manifest.Version, exportManifestVersion)
+	}
+	if manifest.Album.Title == "" {
+		return nil, fmt.Errorf("%w: the manifest records no album title", domain.ErrInvalidArgument)
+	}
+	return &manifest, nil
+}
+
+// openArchive opens the zip or tar archive at name, picked by its extension as archiveFormat does.
+// Zip archives are read in place; tar archives cannot be read out of order, so they are extracted
+// to a staging directory that close removes.
+func openArchive(name string) (fs.FS, func() error, error) {
+	if _, err := archiveFormat(name); err != nil {
+		return nil, nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		return zr, zr.Close, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(name), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	staging, err := os.MkdirTemp("", ".restore-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := extractTar(tar.NewReader(r), staging); err != nil {
+		os.RemoveAll(staging)
+		return nil, nil, err
+	}
+	return os.DirFS(staging), func() error { return os.RemoveAll(staging) }, nil
+}
+
+// extractTar writes the regular files of tr below dir. Entries reaching outside dir are refused.
+func extractTar(tr *tar.Reader, dir string) error {
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%w: archive entry %q is outside the archive", domain.ErrInvalidArgument, header.Name)
+		}
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return fmt.Errorf("failed to extract archive: %w", err)
+		}
+		if err := extractFile(tr, dst); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+}
+
+// extractFile copies r to a new file at dst
+func extractFile(r io.Reader, dst string) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
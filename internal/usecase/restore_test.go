@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// writeTestArchive writes manifest and files to an archive at name, in the format of its extension
+func writeTestArchive(t *testing.T, name string, manifest ExportManifest, files map[string]string) {
+	t.Helper()
+	newArchive, err := archiveFormat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	archive := newArchive(f)
+	if err := writeExportManifest(archive, manifest); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		if err := archive.add(file, int64(len(content)), time.Now(), bytes.NewReader([]byte(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadUseCase_RestoreAlbum(t *testing.T) {
+	manifest := ExportManifest{
+		Version:     exportManifestVersion,
+		Album:       domain.Album{ID: "old-id", Title: "Trip"},
+		Description: "Road trip",
+		MediaItems: []ExportedItem{
+			{MediaItem: domain.MediaItem{ID: "m1", Filename: "a.jpg", Description: "Start"}, File: "media/a.jpg"},
+			{MediaItem: domain.MediaItem{ID: "m2", Filename: "b.jpg"}},
+			{MediaItem: domain.MediaItem{ID: "m3", Filename: "c.jpg"}, File: "media/c.jpg"},
+		},
+	}
+	files := map[string]string{"media/a.jpg": "a", "media/c.jpg": "c"}
+
+	for _, name := range []string{"trip.zip", "trip.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), name)
+			writeTestArchive(t, archive, manifest, files)
+			mediaRepo := &MockMediaItemRepository{}
+			albumRepo := &MockAlbumRepository{}
+			useCase := NewUploadUseCase(mediaRepo, albumRepo)
+
+			result, err := useCase.RestoreAlbum(context.Background(), archive, TakeoutOptions{Workers: 2})
+
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(albumRepo.enrichments) != 1 || albumRepo.enrichments[0] != [2]string{"test-id", "Road trip"} {
+				t.Errorf("Expected the description to head the new album, got %v", albumRepo.enrichments)
+			}
+			if len(mediaRepo.batches) != 1 || len(mediaRepo.batches[0]) != 2 {
+				t.Fatalf("Expected the two originals created in one batch, got %v", mediaRepo.batches)
+			}
+			if first := mediaRepo.batches[0][0]; first.FileName != "a.jpg" || first.Description != "Start" {
+				t.Errorf("Expected the first item created in album order with its description, got %+v", first)
+			}
+			album := result.Albums[0]
+			if album.AlbumID != "test-id" || !album.Header || album.MediaItems != 2 {
+				t.Errorf("Expected the album rebuilt with two media items, got %+v", album)
+			}
+			if result.Items[1].Error == "" || result.Failed() != 1 {
+				t.Errorf("Expected only the item without an original to fail, got %+v", result.Items)
+			}
+		})
+	}
+}
+
+func TestUploadUseCase_RestoreAlbumLeavesOutWhatTheAlbumHolds(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "trip.zip")
+	writeTestArchive(t, archive, ExportManifest{
+		Version: exportManifestVersion,
+		Album:   domain.Album{ID: "old-id", Title: "Trip"},
+		MediaItems: []ExportedItem{
+			{MediaItem: domain.MediaItem{ID: "m1", Filename: "a.jpg"}, File: "media/a.jpg"},
+			{MediaItem: domain.MediaItem{ID: "m2", Filename: "b.jpg"}, File: "media/b.jpg"},
+		},
+	}, map[string]string{"media/a.jpg": "a", "media/b.jpg": "b"})
+	// An interrupted restore created the album and a.jpg in it
+	mediaRepo := &MockMediaItemRepository{albumItems: map[string][]domain.MediaItem{"new-id": {{ID: "n1", Filename: "a.jpg"}}}}
+	albumRepo := &MockAlbumRepository{albums: []domain.Album{{ID: "new-id", Title: "Trip", IsWriteable: true}}}
+	useCase := NewUploadUseCase(mediaRepo, albumRepo)
+
+	result, err := useCase.RestoreAlbum(context.Background(), archive, TakeoutOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(mediaRepo.batches) != 1 || len(mediaRepo.batches[0]) != 1 || mediaRepo.batches[0][0].FileName != "b.jpg" {
+		t.Fatalf("Expected only b.jpg created, got %v", mediaRepo.batches)
+	}
+	if result.Existing != 1 || result.Items[0].MediaItemID != "n1" || result.Albums[0].MediaItems != 1 {
+		t.Errorf("Expected a.jpg left out with the ID it has in the album, got %+v", result)
+	}
+
+	// Once the album holds everything, a run uploads nothing
+	mediaRepo.albumItems["new-id"] = append(mediaRepo.albumItems["new-id"], domain.MediaItem{ID: "n2", Filename: "b.jpg"})
+	mediaRepo.batches = nil
+	result, err = useCase.RestoreAlbum(context.Background(), archive, TakeoutOptions{})
+	if err != nil || len(mediaRepo.batches) != 0 || result.Existing != 2 || result.Failed() != 0 {
+		t.Errorf("Expected the restored album left alone, got %+v, %v", result, err)
+	}
+}
+
+func TestUploadUseCase_RestoreAlbumRefusesArchivesWithoutOriginals(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "trip.tar")
+	writeTestArchive(t, archive, ExportManifest{
+		Version:    exportManifestVersion,
+		Album:      domain.Album{Title: "Trip"},
+		MediaItems: []ExportedItem{{MediaItem: domain.MediaItem{ID: "m1", Filename: "a.jpg"}}},
+	}, nil)
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+
+	_, err := useCase.RestoreAlbum(context.Background(), archive, TakeoutOptions{})
+
+	if !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an invalid argument error, got %v", err)
+	}
+	if len(mediaRepo.uploaded) != 0 || len(mediaRepo.batches) != 0 {
+		t.Error("Expected nothing to be uploaded")
+	}
+}
+
+func TestExtractTarRefusesEntriesOutsideTheArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.tar")
+	writeTestArchive(t, archive, ExportManifest{}, map[string]string{"../escape.jpg": "x"})
+
+	if _, _, err := openArchive(archive); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected the entry outside the archive to be refused, got %v", err)
+	}
+}
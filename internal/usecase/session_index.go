@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// SessionIndex is the local index held in memory for an interactive session such as tui or
+// serve, so filtering and sorting answer every keystroke without reading the database. It is
+// safe for concurrent use.
+type SessionIndex struct {
+	logging
+
+	mu     sync.RWMutex
+	albums map[string]domain.Album
+	items  []domain.MediaItem
+	// positions holds the index of every media item in items by ID
+	positions  map[string]int
+	albumItems map[string][]string
+	updatedAt  time.Time
+}
+
+// NewSessionIndex copies snapshot into a SessionIndex
+func NewSessionIndex(snapshot *domain.IndexSnapshot) *SessionIndex {
+	s := &SessionIndex{
+		albums:     make(map[string]domain.Album, len(snapshot.Albums)),
+		items:      slices.Clone(snapshot.MediaItems),
+		positions:  make(map[string]int, len(snapshot.MediaItems)),
+		albumItems: make(map[string][]string, len(snapshot.AlbumItems)),
+		updatedAt:  snapshot.UpdatedAt,
+	}
+	for _, album := range snapshot.Albums {
+		s.albums[album.ID] = album
+	}
+	for i, item := range s.items {
+		s.positions[item.ID] = i
+	}
+	for albumID, ids := range snapshot.AlbumItems {
+		s.albumItems[albumID] = slices.Clone(ids)
+	}
+	return s
+}
+
+// Session loads the local index into memory for an interactive session. With an interval, the
+// albums and the media items added to the library are polled for as by SubscriptionUseCase.Watch
+// until ctx is cancelled, and the changes are applied to the session index; changes to the
+// contents of albums wait for the next index update. The use case may be closed once it returns.
+func (uc *IndexUseCase) Session(ctx context.Context, interval time.Duration) (*SessionIndex, error) {
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSessionIndex(snapshot)
+	s.SetLogger(uc.log())
+	if interval == 0 {
+		return s, nil
+	}
+
+	subscription := NewSubscriptionUseCase(uc.albumRepo, uc.mediaRepo)
+	subscription.SetLogger(uc.log())
+	events, err := subscription.Watch(ctx, WatchSpec{Albums: true, Library: true, Interval: interval})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for event := range events {
+			s.Apply(event)
+		}
+	}()
+	return s, nil
+}
+
+// Albums returns the albums whose title contains title, ignoring case, ordered by title
+func (s *SessionIndex) Albums(title string) []domain.Album {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	title = strings.ToLower(title)
+	var albums []domain.Album
+	for _, album := range s.albums {
+		if strings.Contains(strings.ToLower(album.Title), title) {
+			albums = append(albums, album)
+		}
+	}
+	slices.SortFunc(albums, func(a, b domain.Album) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)), cmp.Compare(a.ID, b.ID))
+	})
+	return albums
+}
+
+// SearchMediaItems lists the media items matching filter like IndexUseCase.SearchMediaItems
+func (s *SessionIndex) SearchMediaItems(filter IndexFilter) ([]domain.MediaItem, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return filter.search(s.items, s.albumItems)
+}
+
+// UpdatedAt returns when the session index last changed
+func (s *SessionIndex) UpdatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.updatedAt
+}
+
+// Apply brings the session index up to date with a change a subscription found. Media items
+// added to an album that is not indexed yet are only added to the library, as the rest of the
+// album is unknown.
+func (s *SessionIndex) Apply(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch e := event.(type) {
+	case AlbumAdded:
+		s.albums[e.Album.ID] = e.Album
+	case AlbumRenamed:
+		s.albums[e.Album.ID] = e.Album
+	case AlbumRemoved:
+		delete(s.albums, e.Album.ID)
+		delete(s.albumItems, e.Album.ID)
+	case ItemAdded:
+		if i, ok := s.positions[e.Item.ID]; ok {
+			s.items[i] = e.Item
+		} else {
+			s.positions[e.Item.ID] = len(s.items)
+			s.items = append(s.items, e.Item)
+		}
+		if ids, ok := s.albumItems[e.AlbumID]; ok && !slices.Contains(ids, e.Item.ID) {
+			s.albumItems[e.AlbumID] = append(ids, e.Item.ID)
+		}
+	case ItemRemoved:
+		if e.AlbumID != "" {
+			if ids, ok := s.albumItems[e.AlbumID]; ok {
+				s.albumItems[e.AlbumID] = slices.DeleteFunc(ids, func(id string) bool { return id == e.Item.ID })
+			}
+			break
+		}
+		if i, ok := s.positions[e.Item.ID]; ok {
+			last := len(s.items) - 1
+			s.items[i] = s.items[last]
+			s.positions[s.items[i].ID] = i
+			s.items = s.items[:last]
+			delete(s.positions, e.Item.ID)
+		}
+	case WatchError:
+		s.log().Warn("Failed to refresh the session index", "error", e.Err)
+		return
+	}
+	s.updatedAt = time.Now()
+}
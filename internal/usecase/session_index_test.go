@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestSessionIndex_SearchAndApply(t *testing.T) {
+	taken := func(id, filename string, day int) domain.MediaItem {
+		return domain.MediaItem{ID: id, Filename: filename, MediaMetadata: &domain.MediaMetadata{CreationTime: time.Date(2026, 5, day, 12, 0, 0, 0, time.UTC)}}
+	}
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{
+		Albums:     []domain.Album{{ID: "a1", Title: "Trip"}, {ID: "a2", Title: "home"}, {ID: "a3", Title: "Trip best"}},
+		MediaItems: []domain.MediaItem{taken("m1", "b.jpg", 1), taken("m2", "c.jpg", 3), taken("m3", "a.jpg", 2)},
+		AlbumItems: map[string][]string{"a1": {"m1", "m2"}, "a2": {"m3"}, "a3": {}},
+		UpdatedAt:  time.Now(),
+	}}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+	session, err := uc.Session(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ids := func(filter IndexFilter) []string {
+		t.Helper()
+		items, err := session.SearchMediaItems(filter)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+	titles := func(title string) []string {
+		var titles []string
+		for _, album := range session.Albums(title) {
+			titles = append(titles, album.Title)
+		}
+		return titles
+	}
+
+	if got := titles("TRIP"); !slices.Equal(got, []string{"Trip", "Trip best"}) {
+		t.Errorf("Expected the albums with trip in the title, got %v", got)
+	}
+	if got := ids(IndexFilter{}); !slices.Equal(got, []string{"m2", "m3", "m1"}) {
+		t.Errorf("Expected the newest first, got %v", got)
+	}
+	if got := ids(IndexFilter{AlbumID: "a1", Sort: SortOldest}); !slices.Equal(got, []string{"m1", "m2"}) {
+		t.Errorf("Expected the album oldest first, got %v", got)
+	}
+	if got := ids(IndexFilter{Sort: SortFilename}); !slices.Equal(got, []string{"m3", "m1", "m2"}) {
+		t.Errorf("Expected the items by file name, got %v", got)
+	}
+	if _, err := session.SearchMediaItems(IndexFilter{Sort: "size"}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an unknown sort to be rejected, got %v", err)
+	}
+
+	session.Apply(AlbumRenamed{Album: domain.Album{ID: "a2", Title: "Trip home"}})
+	session.Apply(AlbumRemoved{Album: domain.Album{ID: "a3", Title: "Trip best"}})
+	session.Apply(AlbumAdded{Album: domain.Album{ID: "a4", Title: "New"}})
+	if got := titles("trip"); !slices.Equal(got, []string{"Trip", "Trip home"}) {
+		t.Errorf("Expected the renamed album and not the removed one, got %v", got)
+	}
+
+	session.Apply(ItemAdded{Item: taken("m4", "d.jpg", 4)})
+	session.Apply(ItemAdded{AlbumID: "a1", Item: taken("m3", "a.jpg", 2)})
+	session.Apply(ItemRemoved{AlbumID: "a1", Item: taken("m1", "b.jpg", 1)})
+	session.Apply(ItemAdded{AlbumID: "a4", Item: taken("m5", "e.jpg", 5)})
+	session.Apply(WatchError{Err: errors.New("offline")})
+	if got := ids(IndexFilter{AlbumID: "a1"}); !slices.Equal(got, []string{"m2", "m3"}) {
+		t.Errorf("Expected m3 added to and m1 removed from the album, got %v", got)
+	}
+	if got := ids(IndexFilter{Filename: "JPG"}); !slices.Equal(got, []string{"m5", "m4", "m2", "m3", "m1"}) {
+		t.Errorf("Expected the new media items in the library, got %v", got)
+	}
+	// The contents of a4 are unknown beyond what was added since the index was loaded
+	if _, err := session.SearchMediaItems(IndexFilter{AlbumID: "a4"}); err == nil {
+		t.Error("Expected an album added during the session not to be searchable")
+	}
+}
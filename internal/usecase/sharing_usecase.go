@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// SharingUseCase implements the business logic for album sharing operations
+type SharingUseCase struct {
+	logging
+
+	repo      domain.SharingRepository
+	shortener domain.URLShortener
+}
+
+// NewSharingUseCase creates a new instance of SharingUseCase
+func NewSharingUseCase(repo domain.SharingRepository) *SharingUseCase {
+	return &SharingUseCase{
+		repo: repo,
+	}
+}
+
+// SetURLShortener makes shared album links come with a short link; nil disables shortening
+func (uc *SharingUseCase) SetURLShortener(shortener domain.URLShortener) {
+	uc.shortener = shortener
+}
+
+// ShareAlbum shares an app-created album and returns its shareable URL and token
+func (uc *SharingUseCase) ShareAlbum(albumID string, options domain.SharedAlbumOptions) (*domain.ShareInfo, error) {
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+
+	uc.log().Info("Sharing album", "album_id", albumID)
+
+	shareInfo, err := uc.repo.ShareAlbum(albumID, options)
+	if err != nil {
+		uc.log().Error("Failed to share album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully shared album", "album_id", albumID, "shareable_url", shareInfo.ShareableURL)
+	return uc.shorten(shareInfo), nil
+}
+
+// UpdateShareOptions changes the options of an app-created album that is already shared, keeping
+// its link. Options left unset in update keep their current value.
+func (uc *SharingUseCase) UpdateShareOptions(ctx context.Context, albumID string, update domain.SharedAlbumOptionsUpdate) (*domain.ShareInfo, error) {
+	if albumID == "" {
+		return nil, fmt.Errorf("album id is required")
+	}
+	if update.IsEmpty() {
+		return nil, fmt.Errorf("no share option to change")
+	}
+
+	uc.log().Info("Looking up share options of album", "album_id", albumID)
+
+	current, err := uc.findOwnedShare(ctx, albumID)
+	if err != nil {
+		uc.log().Error("Failed to look up album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	options := update.Apply(current.SharedAlbumOptions)
+	if options == current.SharedAlbumOptions {
+		uc.log().Info("Album already has these share options", "album_id", albumID)
+		return uc.shorten(current), nil
+	}
+
+	shareInfo, err := uc.repo.ShareAlbum(albumID, options)
+	if err != nil {
+		uc.log().Error("Failed to update share options of album", "album_id", albumID, "error", err)
+		return nil, err
+	}
+
+	// Sharing again is the only way to set options; make sure the API did not silently keep the old ones
+	if shareInfo.SharedAlbumOptions != options {
+		return nil, fmt.Errorf("the API kept the previous share options of album %s; unshare and share it again to change them, which creates a new link", albumID)
+	}
+
+	uc.log().Info("Successfully updated share options of album", "album_id", albumID)
+	return uc.shorten(shareInfo), nil
+}
+
+// shorten adds a short link to shareInfo when a shortener is configured. The album is shared
+// either way, so a failing shortener only loses the short link.
+func (uc *SharingUseCase) shorten(shareInfo *domain.ShareInfo) *domain.ShareInfo {
+	if uc.shortener == nil || shareInfo.ShareableURL == "" {
+		return shareInfo
+	}
+
+	short, err := uc.shortener.Shorten(shareInfo.ShareableURL)
+	if err != nil {
+		uc.log().Warn("Failed to shorten share link, keeping the full link", "error", err)
+		return shareInfo
+	}
+
+	shareInfo.ShortURL = short
+	return shareInfo
+}
+
+// findOwnedShare returns the share information of a shared album owned by the account
+func (uc *SharingUseCase) findOwnedShare(ctx context.Context, albumID string) (*domain.ShareInfo, error) {
+	for album, err := range uc.SharedAlbums(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if album.ID != albumID || album.ShareInfo == nil {
+			continue
+		}
+		if !album.ShareInfo.IsOwned {
+			return nil, fmt.Errorf("album %s is shared with you but not owned by you", albumID)
+		}
+		return album.ShareInfo, nil
+	}
+	return nil, fmt.Errorf("album %s is not shared, use 'albums share' first", albumID)
+}
+
+// UnshareAlbum makes a shared album private again
+func (uc *SharingUseCase) UnshareAlbum(albumID string) error {
+	if albumID == "" {
+		return fmt.Errorf("album id is required")
+	}
+
+	uc.log().Info("Unsharing album", "album_id", albumID)
+
+	if err := uc.repo.UnshareAlbum(albumID); err != nil {
+		uc.log().Error("Failed to unshare album", "album_id", albumID, "error", err)
+		return err
+	}
+
+	uc.log().Info("Successfully unshared album", "album_id", albumID)
+	return nil
+}
+
+// ListSharedAlbums retrieves a single page of shared albums
+func (uc *SharingUseCase) ListSharedAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	if err := req.Validate(domain.MaxAlbumPageSize); err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Fetching shared albums...")
+
+	page, err := uc.repo.ListSharedAlbums(req)
+	if err != nil {
+		uc.log().Error("Failed to fetch shared albums", "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully fetched shared albums", "albums", len(page.Items))
+	return page, nil
+}
+
+// ListAllSharedAlbums retrieves every shared album, transparently following page tokens
+func (uc *SharingUseCase) ListAllSharedAlbums(ctx context.Context) ([]domain.Album, error) {
+	albums, err := collect(uc.SharedAlbums(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Successfully fetched shared albums in total", "albums", len(albums))
+	return albums, nil
+}
+
+// SharedAlbums returns an iterator over all shared albums that fetches pages lazily
+func (uc *SharingUseCase) SharedAlbums(ctx context.Context) iter.Seq2[domain.Album, error] {
+	req := domain.PageRequest{PageSize: domain.MaxAlbumPageSize}
+	return paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+		page, err := uc.repo.ListSharedAlbums(req)
+		if err != nil {
+			uc.log().Error("Failed to fetch shared albums", "error", err)
+			return nil, err
+		}
+		return page, nil
+	})
+}
+
+// ListOwnedSharedAlbums retrieves every shared album owned by the account, for auditing what is shared
+func (uc *SharingUseCase) ListOwnedSharedAlbums(ctx context.Context) ([]domain.Album, error) {
+	var owned []domain.Album
+	for album, err := range uc.SharedAlbums(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if album.ShareInfo != nil && album.ShareInfo.IsOwned {
+			owned = append(owned, album)
+		}
+	}
+
+	uc.log().Info("Successfully fetched shared albums owned by the account", "albums", len(owned))
+	return owned, nil
+}
+
+// JoinSharedAlbum joins a shared album using the share token from its owner
+func (uc *SharingUseCase) JoinSharedAlbum(shareToken string) (*domain.Album, error) {
+	if shareToken == "" {
+		return nil, fmt.Errorf("share token is required")
+	}
+
+	uc.log().Info("Joining shared album...")
+
+	album, err := uc.repo.JoinSharedAlbum(shareToken)
+	if err != nil {
+		uc.log().Error("Failed to join shared album", "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully joined shared album", "title", album.Title)
+	return album, nil
+}
+
+// LeaveSharedAlbum leaves a previously joined shared album
+func (uc *SharingUseCase) LeaveSharedAlbum(shareToken string) error {
+	if shareToken == "" {
+		return fmt.Errorf("share token is required")
+	}
+
+	uc.log().Info("Leaving shared album...")
+
+	if err := uc.repo.LeaveSharedAlbum(shareToken); err != nil {
+		uc.log().Error("Failed to leave shared album", "error", err)
+		return err
+	}
+
+	uc.log().Info("Successfully left shared album")
+	return nil
+}
@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockSharingRepository is a mock implementation for testing
+type MockSharingRepository struct {
+	pages    map[string]domain.Page[domain.Album]
+	shared   map[string]domain.SharedAlbumOptions
+	left     []string
+	err      error
+	requests int
+}
+
+func (m *MockSharingRepository) ShareAlbum(albumID string, options domain.SharedAlbumOptions) (*domain.ShareInfo, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.shared == nil {
+		m.shared = make(map[string]domain.SharedAlbumOptions)
+	}
+	m.shared[albumID] = options
+	return &domain.ShareInfo{
+		SharedAlbumOptions: options,
+		ShareableURL:       "https://photos.app.goo.gl/" + albumID,
+		ShareToken:         "token-" + albumID,
+		IsOwned:            true,
+	}, nil
+}
+
+func (m *MockSharingRepository) UnshareAlbum(albumID string) error {
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.shared, albumID)
+	return nil
+}
+
+func (m *MockSharingRepository) ListSharedAlbums(req domain.PageRequest) (*domain.Page[domain.Album], error) {
+	m.requests++
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := m.pages[req.PageToken]
+	return &page, nil
+}
+
+func (m *MockSharingRepository) JoinSharedAlbum(shareToken string) (*domain.Album, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &domain.Album{ID: "joined", Title: "Joined", ShareInfo: &domain.ShareInfo{ShareToken: shareToken, IsJoined: true}}, nil
+}
+
+func (m *MockSharingRepository) LeaveSharedAlbum(shareToken string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.left = append(m.left, shareToken)
+	return nil
+}
+
+func TestSharingUseCase_ShareAlbum(t *testing.T) {
+	repo := &MockSharingRepository{}
+	useCase := NewSharingUseCase(repo)
+
+	shareInfo, err := useCase.ShareAlbum("a1", domain.SharedAlbumOptions{IsCollaborative: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if shareInfo.ShareableURL != "https://photos.app.goo.gl/a1" {
+		t.Errorf("Expected shareable URL for a1, got %q", shareInfo.ShareableURL)
+	}
+	if !repo.shared["a1"].IsCollaborative {
+		t.Error("Expected share options to be passed to the repository")
+	}
+
+	if _, err := useCase.ShareAlbum("", domain.SharedAlbumOptions{}); err == nil {
+		t.Error("Expected an empty album id to be rejected")
+	}
+}
+
+// MockURLShortener is a mock implementation for testing
+type MockURLShortener struct {
+	err error
+}
+
+func (m *MockURLShortener) Shorten(longURL string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return "https://s.example/" + longURL[len(longURL)-2:], nil
+}
+
+func TestSharingUseCase_ShareAlbumShortensLink(t *testing.T) {
+	shortener := &MockURLShortener{}
+	useCase := NewSharingUseCase(&MockSharingRepository{})
+	useCase.SetURLShortener(shortener)
+
+	shareInfo, err := useCase.ShareAlbum("a1", domain.SharedAlbumOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if shareInfo.ShortURL != "https://s.example/a1" || shareInfo.ShareableURL != "https://photos.app.goo.gl/a1" {
+		t.Errorf("Expected a short link next to the shareable URL, got %+v", shareInfo)
+	}
+
+	// The album is shared either way, so a failing shortener only drops the short link
+	shortener.err = errors.New("shortener down")
+	shareInfo, err = useCase.ShareAlbum("a2", domain.SharedAlbumOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if shareInfo.ShortURL != "" || shareInfo.ShareableURL == "" {
+		t.Errorf("Expected only the shareable URL, got %+v", shareInfo)
+	}
+}
+
+func TestSharingUseCase_UpdateShareOptions(t *testing.T) {
+	repo := &MockSharingRepository{pages: map[string]domain.Page[domain.Album]{
+		"": {Items: []domain.Album{
+			{ID: "mine", ShareInfo: &domain.ShareInfo{IsOwned: true, SharedAlbumOptions: domain.SharedAlbumOptions{IsCollaborative: true}}},
+			{ID: "theirs", ShareInfo: &domain.ShareInfo{IsJoined: true}},
+		}},
+	}}
+	useCase := NewSharingUseCase(repo)
+	on := true
+
+	shareInfo, err := useCase.UpdateShareOptions(context.Background(), "mine", domain.SharedAlbumOptionsUpdate{IsCommentable: &on})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := domain.SharedAlbumOptions{IsCollaborative: true, IsCommentable: true}
+	if shareInfo.SharedAlbumOptions != want || repo.shared["mine"] != want {
+		t.Errorf("Expected options %+v keeping collaboration on, got %+v", want, repo.shared["mine"])
+	}
+
+	// Options that already match do not share the album again
+	delete(repo.shared, "mine")
+	if _, err := useCase.UpdateShareOptions(context.Background(), "mine", domain.SharedAlbumOptionsUpdate{IsCollaborative: &on}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := repo.shared["mine"]; ok {
+		t.Error("Expected no share request when nothing changes")
+	}
+
+	for _, albumID := range []string{"theirs", "private"} {
+		if _, err := useCase.UpdateShareOptions(context.Background(), albumID, domain.SharedAlbumOptionsUpdate{IsCommentable: &on}); err == nil {
+			t.Errorf("Expected an error for album %s", albumID)
+		}
+	}
+}
+
+func TestSharingUseCase_ListAllSharedAlbums(t *testing.T) {
+	repo := &MockSharingRepository{pages: map[string]domain.Page[domain.Album]{
+		"":   {Items: []domain.Album{{ID: "1"}}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "2"}}},
+	}}
+	useCase := NewSharingUseCase(repo)
+
+	albums, err := useCase.ListAllSharedAlbums(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 2 || repo.requests != 2 {
+		t.Errorf("Expected 2 albums from 2 pages, got %d albums from %d requests", len(albums), repo.requests)
+	}
+}
+
+func TestSharingUseCase_ListOwnedSharedAlbums(t *testing.T) {
+	repo := &MockSharingRepository{pages: map[string]domain.Page[domain.Album]{
+		"": {Items: []domain.Album{
+			{ID: "mine", ShareInfo: &domain.ShareInfo{IsOwned: true}},
+			{ID: "theirs", ShareInfo: &domain.ShareInfo{IsJoined: true}},
+		}, NextPageToken: "p2"},
+		"p2": {Items: []domain.Album{{ID: "no-share-info"}, {ID: "also-mine", ShareInfo: &domain.ShareInfo{IsOwned: true}}}},
+	}}
+	useCase := NewSharingUseCase(repo)
+
+	albums, err := useCase.ListOwnedSharedAlbums(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 2 || albums[0].ID != "mine" || albums[1].ID != "also-mine" {
+		t.Errorf("Expected only owned albums from both pages, got %+v", albums)
+	}
+}
+
+func TestSharingUseCase_JoinAndLeave(t *testing.T) {
+	repo := &MockSharingRepository{}
+	useCase := NewSharingUseCase(repo)
+
+	album, err := useCase.JoinSharedAlbum("tok")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if album.ShareInfo == nil || !album.ShareInfo.IsJoined {
+		t.Errorf("Expected joined album, got %+v", album)
+	}
+
+	if err := useCase.LeaveSharedAlbum("tok"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(repo.left) != 1 || repo.left[0] != "tok" {
+		t.Errorf("Expected to leave album with token tok, got %v", repo.left)
+	}
+
+	if err := useCase.LeaveSharedAlbum(""); err == nil {
+		t.Error("Expected an empty share token to be rejected")
+	}
+
+	repo.err = errors.New("boom")
+	if _, err := useCase.JoinSharedAlbum("tok"); err == nil {
+		t.Error("Expected repository errors to be returned")
+	}
+}
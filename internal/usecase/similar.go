@@ -0,0 +1,370 @@
+package usecase
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"io/fs"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	xdraw "golang.org/x/image/draw"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	// defaultSimilarLimit is the number of matches of a similarity search unless another is asked for
+	defaultSimilarLimit = 10
+	// defaultSimilarDistance is how many of the 64 bits of two perceptual hashes may differ for
+	// the photos to count as alike unless another limit is asked for
+	defaultSimilarDistance = 10
+	// hashImageSize is the longer side of the thumbnails indexed photos are hashed from, and of
+	// what other photos are shrunk to before they are hashed
+	hashImageSize = 128
+)
+
+// hashScales are the sides of the square regions of a photo that are hashed, relative to its
+// shorter side, each a fifth smaller than the one before
+var hashScales = []float64{1, 0.8, 0.64, 0.51, 0.41}
+
+// queryScales are the sides of the squares of the query image that are hashed, relative to its
+// center square. A crop of a photo holds a region hashed of the photo a fifth to a third smaller
+// than itself, and one of these squares is within a few percent of that region.
+var queryScales = []float64{1, 0.8, 0.76, 0.72, 0.68, 0.64}
+
+// SimilarOptions configures a search for photos that look like a query image
+type SimilarOptions struct {
+	// Files is a directory of exported photos to search instead of the local index
+	Files fs.FS
+	// Limit is the most matches returned; values below 1 use the default of 10
+	Limit int
+	// MaxDistance leaves out photos whose perceptual hash differs from the query's in more bits;
+	// values below 1 use the default of 10 of 64
+	MaxDistance int
+	// Workers is the number of photos hashed at a time; values below 1 use the default
+	Workers int
+}
+
+// SimilarMatch is a photo that looks like the query image of a similarity search
+type SimilarMatch struct {
+	// Distance is how many bits of the perceptual hashes differ; 0 is the same picture
+	Distance int `json:"distance"`
+	// MediaItem is the matching item of the index, or Path the matching file of SimilarOptions.Files
+	MediaItem *domain.MediaItem `json:"mediaItem,omitempty"`
+	Path      string            `json:"path,omitempty"`
+}
+
+// SetImageHashRepository keeps the hashes of indexed photos in hashes, so later similarity searches
+// only download the thumbnails of photos indexed since; nil hashes every photo every time
+func (uc *DedupeUseCase) SetImageHashRepository(hashes domain.ImageHashRepository) {
+	uc.hashes = hashes
+}
+
+// FindSimilar returns the indexed photos, or those of opts.Files, that look most like the image
+// in query, closest first. The center square of the query is compared by its perceptual hash to
+// square regions of every photo at several sizes and places, so copies that were scaled,
+// recompressed, slightly edited or cropped to a part of the photo are found. Photos that cannot
+// be hashed are left out.
+func (uc *DedupeUseCase) FindSimilar(ctx context.Context, query io.Reader, opts SimilarOptions) ([]SimilarMatch, error) {
+	b, err := io.ReadAll(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query image: %w", err)
+	}
+	want, err := queryHashes(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query image: %w", err)
+	}
+	if len(want) == 0 {
+		return nil, fmt.Errorf("%w: the query image is too plain to compare", domain.ErrInvalidArgument)
+	}
+
+	limit := cmp.Or(max(opts.Limit, 0), defaultSimilarLimit)
+	maxDistance := cmp.Or(max(opts.MaxDistance, 0), defaultSimilarDistance)
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultDownloadWorkers
+	}
+
+	var matches []SimilarMatch
+	if opts.Files != nil {
+		matches, err = uc.similarFiles(ctx, opts.Files, want, maxDistance, workers)
+	} else {
+		matches, err = uc.similarItems(ctx, want, maxDistance, workers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(matches, func(a, b SimilarMatch) int { return a.Distance - b.Distance })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	uc.log().Info("Found similar photos", "matches", len(matches))
+	return matches, nil
+}
+
+// similarItems compares the hashes of every indexed photo to want and keeps those within
+// maxDistance. Photos without recorded hashes are hashed from their thumbnail, and their hashes
+// recorded even when the search is cancelled, so the next search goes on from there.
+func (uc *DedupeUseCase) similarItems(ctx context.Context, want []uint64, maxDistance, workers int) ([]SimilarMatch, error) {
+	snapshot, err := loadBuiltIndex(uc.index)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]domain.ImageHashes)
+	if uc.hashes != nil {
+		if stored, err = uc.hashes.LoadImageHashes(); err != nil {
+			return nil, err
+		}
+	}
+	var photos []domain.MediaItem
+	var missing []int
+	for _, item := range snapshot.MediaItems {
+		if strings.HasPrefix(item.MimeType, "video/") {
+			continue
+		}
+		if _, ok := stored[item.ID]; !ok {
+			missing = append(missing, len(photos))
+		}
+		photos = append(photos, item)
+	}
+
+	uc.log().Info("Comparing indexed photos", "photos", len(photos), "to_hash", len(missing))
+	hashed := make([]*domain.ImageHashes, len(missing))
+	var done atomic.Int64
+	runConcurrently(ctx, len(missing), workers, func(i int) {
+		item := photos[missing[i]]
+		data, err := uc.hashThumbnail(item)
+		if err == nil {
+			var hashes []uint64
+			if hashes, err = regionHashes(data); err == nil {
+				hashed[i] = &domain.ImageHashes{MediaItemID: item.ID, Hashes: hashes}
+			}
+		}
+		if err != nil {
+			uc.log().Warn("Failed to hash media item", "media_item_id", item.ID, "error", err)
+		}
+		if n := done.Add(1); n%500 == 0 {
+			uc.log().Info("Hashed photos", "done", n, "photos", len(missing))
+		}
+	}, func(int, error) {})
+
+	var fresh []domain.ImageHashes
+	for _, h := range hashed {
+		if h != nil {
+			stored[h.MediaItemID] = *h
+			fresh = append(fresh, *h)
+		}
+	}
+	if uc.hashes != nil && len(fresh) > 0 {
+		if err := uc.hashes.SaveImageHashes(fresh); err != nil {
+			uc.log().Warn("Failed to record image hashes", "error", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var matches []SimilarMatch
+	for i, item := range photos {
+		h, ok := stored[item.ID]
+		if !ok {
+			continue
+		}
+		if distance := closestDistance(h.Hashes, want); distance <= maxDistance {
+			matches = append(matches, SimilarMatch{Distance: distance, MediaItem: &photos[i]})
+		}
+	}
+	return matches, nil
+}
+
+// hashThumbnail downloads the thumbnail of an item that indexed photos are hashed from: the whole
+// picture, not cropped to a square, so its edges can be matched too
+func (uc *DedupeUseCase) hashThumbnail(item domain.MediaItem) ([]byte, error) {
+	content, err := uc.mediaRepo.DownloadMediaItem(item, domain.ImageSize{Width: hashImageSize, Height: hashImageSize, Still: true})
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	return data, nil
+}
+
+// similarFiles hashes every photo below the root of fsys and keeps those within maxDistance of want.
+// Formats Go cannot decode, such as HEIC, are skipped.
+func (uc *DedupeUseCase) similarFiles(ctx context.Context, fsys fs.FS, want []uint64, maxDistance, workers int) ([]SimilarMatch, error) {
+	files, _, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	files = slices.DeleteFunc(files, func(name string) bool { return strings.HasPrefix(mediaMimeType(name), "video/") })
+
+	uc.log().Info("Comparing photos", "photos", len(files))
+	distances := make([]int, len(files))
+	var unsupported atomic.Int64
+	runConcurrently(ctx, len(files), workers, func(i int) {
+		distances[i] = -1
+		data, err := fs.ReadFile(fsys, files[i])
+		if err != nil {
+			uc.log().Warn("Failed to read photo", "path", files[i], "error", err)
+			return
+		}
+		hashes, err := regionHashes(data)
+		if errors.Is(err, image.ErrFormat) {
+			unsupported.Add(1)
+			return
+		}
+		if err != nil {
+			uc.log().Warn("Failed to hash photo", "path", files[i], "error", err)
+			return
+		}
+		distances[i] = closestDistance(hashes, want)
+	}, func(int, error) {})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if n := unsupported.Load(); n > 0 {
+		uc.log().Warn("Skipped photos in formats that cannot be decoded", "photos", n)
+	}
+
+	var matches []SimilarMatch
+	for i, distance := range distances {
+		if distance >= 0 && distance <= maxDistance {
+			matches = append(matches, SimilarMatch{Distance: distance, Path: files[i]})
+		}
+	}
+	return matches, nil
+}
+
+// closestDistance returns how many bits differ between the closest pair of hashes and want
+func closestDistance(hashes, want []uint64) int {
+	closest := 65
+	for _, hash := range hashes {
+		for _, w := range want {
+			closest = min(closest, bits.OnesCount64(hash^w))
+		}
+	}
+	return closest
+}
+
+// queryHashes returns the difference hashes of the query image in b: those of its center square
+// and of the smaller squares within it at each of queryScales, a sixteenth of the center square
+// apart. Matching them against the regionHashes of a photo finds the photo the query was cut from.
+func queryHashes(b []byte) ([]uint64, error) {
+	img, err := decodeHashImage(b)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	center := bounds.Min.Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+	step := max(side/16, 1)
+	var hashes []uint64
+	for _, scale := range queryScales {
+		sub := max(int(float64(side)*scale), 1)
+		for y := 0; y <= side-sub; y += step {
+			for x := 0; x <= side-sub; x += step {
+				corner := center.Add(image.Pt(x, y))
+				if hash, ok := differenceHash(img, image.Rectangle{Min: corner, Max: corner.Add(image.Pt(sub, sub))}); ok {
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// regionHashes returns the difference hashes of square regions of the photo in b: at each of
+// hashScales, squares spread evenly over the photo at most a quarter of their side apart, the
+// middle one centered. A crop of the photo hashes like the region it was cut from.
+func regionHashes(b []byte) ([]uint64, error) {
+	img, err := decodeHashImage(b)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	var hashes []uint64
+	for _, scale := range hashScales {
+		side := max(int(float64(min(bounds.Dx(), bounds.Dy()))*scale), 1)
+		for _, y := range regionOffsets(bounds.Dy(), side) {
+			for _, x := range regionOffsets(bounds.Dx(), side) {
+				corner := bounds.Min.Add(image.Pt(x, y))
+				if hash, ok := differenceHash(img, image.Rectangle{Min: corner, Max: corner.Add(image.Pt(side, side))}); ok {
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// regionOffsets returns where squares of side start along length: an odd number of offsets from
+// one end to the other, at most a quarter of side apart
+func regionOffsets(length, side int) []int {
+	span := length - side
+	step := max(side/4, 1)
+	n := (span+step-1)/step + 1
+	if n%2 == 0 {
+		n++
+	}
+	offsets := make([]int, n)
+	for i := range offsets {
+		if n > 1 {
+			offsets[i] = span * i / (n - 1)
+		}
+	}
+	return offsets
+}
+
+// decodeHashImage decodes the photo in b, turned upright and shrunk so its longer side is at most
+// hashImageSize pixels
+func decodeHashImage(b []byte) (*image.RGBA, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("empty image")
+	}
+	scale := min(1, float64(hashImageSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	small := image.NewRGBA(image.Rect(0, 0, max(int(float64(bounds.Dx())*scale), 1), max(int(float64(bounds.Dy())*scale), 1)))
+	xdraw.CatmullRom.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+	return domain.Orient(small, domain.ExifOrientation(b)), nil
+}
+
+// differenceHash returns the difference hash of region r of img: r shrunk to 9 by 8 gray pixels,
+// with one bit per pair of neighbours telling whether the left one is brighter. Copies that were
+// scaled, recompressed or slightly recolored keep most bits. It reports false for regions too plain
+// to tell apart, such as a clear sky, where fewer than half of the neighbours differ by 3 levels.
+func differenceHash(img image.Image, r image.Rectangle) (uint64, bool) {
+	gray := image.NewGray(image.Rect(0, 0, 9, 8))
+	xdraw.CatmullRom.Scale(gray, gray.Bounds(), img, r, draw.Src, nil)
+
+	var hash uint64
+	var distinct int
+	for y := range 8 {
+		for x := range 8 {
+			left, right := int(gray.GrayAt(x, y).Y), int(gray.GrayAt(x+1, y).Y)
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+			if d := left - right; d >= 3 || d <= -3 {
+				distinct++
+			}
+		}
+	}
+	return hash, distinct >= 32
+}
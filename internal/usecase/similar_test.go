@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"maps"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// patternPNG encodes a size by size PNG of gray blocks, mirrored left to right when flip is set
+func patternPNG(t *testing.T, size int, flip bool) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			bx, by := x*8/size, y*8/size
+			if flip {
+				bx = 7 - bx
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8((bx*37 + by*91) % 256)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// noiseImage returns a width by height picture of gray shades blending smoothly between random
+// values 32 pixels apart, in a pattern that does not repeat and differs for every seed
+func noiseImage(width, height int, seed uint32) *image.Gray {
+	lattice := func(x, y int) float64 {
+		h := uint32(x)*73856093 ^ uint32(y)*19349663 ^ seed*83492791
+		h ^= h >> 13
+		h *= 0x5bd1e995
+		h ^= h >> 15
+		return float64(uint8(h))
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			fx, fy := float64(x%32)/32, float64(y%32)/32
+			top := lattice(x/32, y/32)*(1-fx) + lattice(x/32+1, y/32)*fx
+			bottom := lattice(x/32, y/32+1)*(1-fx) + lattice(x/32+1, y/32+1)*fx
+			img.SetGray(x, y, color.Gray{Y: uint8(top*(1-fy) + bottom*fy)})
+		}
+	}
+	return img
+}
+
+// encodePNG encodes img as a PNG
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// MockImageHashRepository is a mock implementation for testing
+type MockImageHashRepository struct {
+	hashes map[string]domain.ImageHashes
+}
+
+func (m *MockImageHashRepository) SaveImageHashes(hashes []domain.ImageHashes) error {
+	for _, h := range hashes {
+		m.hashes[h.MediaItemID] = h
+	}
+	return nil
+}
+
+func (m *MockImageHashRepository) LoadImageHashes() (map[string]domain.ImageHashes, error) {
+	return maps.Clone(m.hashes), nil
+}
+
+func TestDedupeUseCase_FindSimilar(t *testing.T) {
+	taken := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	clip := photo("m4", "clip.mp4", taken, 64, 64)
+	clip.MimeType = "video/mp4"
+	items := []domain.MediaItem{
+		photo("m1", "same.jpg", taken, 64, 64),
+		photo("m2", "mirrored.jpg", taken, 64, 64),
+		photo("m3", "cached.jpg", taken, 64, 64),
+		clip,
+	}
+	mediaRepo := &MockMediaItemRepository{
+		items: items,
+		files: map[string]string{
+			"https://photos.example/m1=w128-h128": string(patternPNG(t, 128, false)),
+			"https://photos.example/m2=w128-h128": string(patternPNG(t, 128, true)),
+		},
+	}
+	cached, err := regionHashes(patternPNG(t, 128, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := &MockImageHashRepository{hashes: map[string]domain.ImageHashes{"m3": {MediaItemID: "m3", Hashes: cached}}}
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{MediaItems: items, UpdatedAt: time.Now()}}
+	uc := NewDedupeUseCase(index, mediaRepo, &MockAlbumRepository{})
+	uc.SetImageHashRepository(hashes)
+
+	matches, err := uc.FindSimilar(context.Background(), bytes.NewReader(patternPNG(t, 400, false)), SimilarOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(matches) != 2 || matches[0].MediaItem.ID != "m1" || matches[1].MediaItem.ID != "m3" {
+		t.Fatalf("Expected m1 and m3 to match, got %+v", matches)
+	}
+	if len(mediaRepo.downloads) != 2 {
+		t.Errorf("Expected the photo hashed before and the video not to be downloaded, got %v", mediaRepo.downloads)
+	}
+	if len(hashes.hashes["m1"].Hashes) == 0 || len(hashes.hashes["m2"].Hashes) == 0 {
+		t.Errorf("Expected the hashes of the downloaded thumbnails recorded, got %+v", hashes.hashes)
+	}
+
+	// A second search hashes nothing
+	mediaRepo.downloads = nil
+	if _, err := uc.FindSimilar(context.Background(), bytes.NewReader(patternPNG(t, 400, false)), SimilarOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(mediaRepo.downloads) != 0 {
+		t.Errorf("Expected the recorded hashes used, got downloads %v", mediaRepo.downloads)
+	}
+
+	// Searching exported files instead of the index
+	fsys := fstest.MapFS{
+		"a/copy.png":   {Data: patternPNG(t, 120, false)},
+		"mirrored.png": {Data: patternPNG(t, 120, true)},
+		"phone.heic":   {Data: []byte("not decodable by Go")},
+	}
+	matches, err = uc.FindSimilar(context.Background(), bytes.NewReader(patternPNG(t, 400, false)), SimilarOptions{Files: fsys, Limit: 5})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(matches) != 1 || matches[0].Path != "a/copy.png" {
+		t.Fatalf("Expected a/copy.png to match, got %+v", matches)
+	}
+}
+
+func TestRegionHashes(t *testing.T) {
+	photo, err := regionHashes(patternPNG(t, 128, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaled, _ := queryHashes(patternPNG(t, 500, false))
+	mirrored, _ := queryHashes(patternPNG(t, 500, true))
+
+	if d := closestDistance(photo, scaled); d > 4 {
+		t.Errorf("Expected scaled copies to hash alike, %d bits differ", d)
+	}
+	if d := closestDistance(photo, mirrored); d <= defaultSimilarDistance {
+		t.Errorf("Expected a mirrored photo to hash differently, only %d bits differ", d)
+	}
+	if _, err := regionHashes([]byte("not an image")); err == nil {
+		t.Error("Expected an error for data that is no image")
+	}
+	if plain, _ := queryHashes(encodePNG(t, image.NewGray(image.Rect(0, 0, 64, 64)))); len(plain) != 0 {
+		t.Errorf("Expected a plain image to have no hashes, got %d", len(plain))
+	}
+}
+
+func TestRegionHashes_MatchCrops(t *testing.T) {
+	original := noiseImage(640, 480, 1)
+	hashes, err := regionHashes(encodePNG(t, original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := regionHashes(encodePNG(t, noiseImage(640, 480, 2)))
+
+	// Crops of two thirds and of half the height, off center and of other shapes than the photo
+	for _, r := range []image.Rectangle{image.Rect(300, 120, 620, 440), image.Rect(40, 200, 400, 440)} {
+		query, err := queryHashes(encodePNG(t, original.SubImage(r)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := closestDistance(hashes, query); d > defaultSimilarDistance {
+			t.Errorf("Expected the crop %v to match a region of the photo, %d bits differ", r, d)
+		}
+		if d := closestDistance(other, query); d <= defaultSimilarDistance {
+			t.Errorf("Expected the crop %v not to match another photo, only %d bits differ", r, d)
+		}
+	}
+}
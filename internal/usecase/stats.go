@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// defaultStatsTop is how many albums, cameras and videos the statistics list unless another limit
+// is asked for
+const defaultStatsTop = 10
+
+// Sources of the library statistics
+const (
+	StatsFromIndex = "index"
+	StatsFromAPI   = "api"
+)
+
+// StatsOptions configures the statistics of the library
+type StatsOptions struct {
+	// Live reads the library from the API instead of the local index
+	Live bool
+	// Top limits the albums, cameras and largest videos listed; values below 1 use the default of 10
+	Top int
+}
+
+// LibraryStats is a health report of the library
+type LibraryStats struct {
+	// Source is index or api
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Items     int       `json:"items"`
+	Photos    int       `json:"photos"`
+	Videos    int       `json:"videos"`
+	// EstimatedSize is the storage the library takes at the average sizes of report growth, since
+	// the API reports no file sizes
+	EstimatedSize int64 `json:"estimatedSize"`
+	// Years count the media items by the year they were taken, oldest first; 0 holds those
+	// without a capture time
+	Years []YearCount `json:"years"`
+	// Albums are the largest albums, largest first
+	Albums []AlbumCount `json:"albums"`
+	// Cameras are the cameras that took the most media items, most first
+	Cameras []CameraCount `json:"cameras"`
+	// LargestVideos are the videos with the highest resolution, which take the most storage
+	// among videos of the same length
+	LargestVideos []domain.MediaItem `json:"largestVideos"`
+}
+
+// YearCount is how many photos and videos were taken in a year
+type YearCount struct {
+	Year   int `json:"year"`
+	Photos int `json:"photos"`
+	Videos int `json:"videos"`
+}
+
+// AlbumCount is how many media items an album holds
+type AlbumCount struct {
+	Album domain.Album `json:"album"`
+	Items int          `json:"items"`
+}
+
+// CameraCount is how many media items a camera took; Camera is empty for media items without
+// camera details, such as screenshots and downloads
+type CameraCount struct {
+	Camera string `json:"camera"`
+	Items  int    `json:"items"`
+}
+
+// Stats aggregates the media items of the library by type, year, album and camera. The local index
+// is read unless opts.Live asks for the API, which lists the whole library.
+func (uc *IndexUseCase) Stats(ctx context.Context, opts StatsOptions) (stats *LibraryStats, err error) {
+	ctx, span := uc.trace(ctx, "index.stats")
+	defer func() { span.End(err) }()
+
+	top := opts.Top
+	if top < 1 {
+		top = defaultStatsTop
+	}
+
+	var snapshot *domain.IndexSnapshot
+	if opts.Live {
+		if snapshot, err = uc.fetchLibrary(ctx); err != nil {
+			return nil, err
+		}
+	} else if snapshot, err = loadBuiltIndex(uc.index); err != nil {
+		return nil, err
+	}
+
+	stats = &LibraryStats{Source: StatsFromIndex, UpdatedAt: snapshot.UpdatedAt, Items: len(snapshot.MediaItems)}
+	if opts.Live {
+		stats.Source = StatsFromAPI
+	}
+
+	years := make(map[int]*YearCount)
+	cameras := make(map[string]int)
+	var videos []domain.MediaItem
+	for _, item := range snapshot.MediaItems {
+		year := 0
+		if item.MediaMetadata != nil && !item.MediaMetadata.CreationTime.IsZero() {
+			year = item.MediaMetadata.CreationTime.Year()
+		}
+		if years[year] == nil {
+			years[year] = &YearCount{Year: year}
+		}
+		if item.IsVideo() {
+			stats.Videos++
+			years[year].Videos++
+			videos = append(videos, item)
+		} else {
+			stats.Photos++
+			years[year].Photos++
+		}
+		cameras[cameraName(item)]++
+	}
+	stats.EstimatedSize = int64(stats.Photos)*defaultPhotoSize + int64(stats.Videos)*defaultVideoSize
+
+	stats.Years = []YearCount{}
+	for _, count := range years {
+		stats.Years = append(stats.Years, *count)
+	}
+	slices.SortFunc(stats.Years, func(a, b YearCount) int { return cmp.Compare(a.Year, b.Year) })
+
+	stats.Albums = []AlbumCount{}
+	for _, album := range snapshot.Albums {
+		stats.Albums = append(stats.Albums, AlbumCount{Album: album, Items: int(album.MediaItemsCount)})
+	}
+	slices.SortFunc(stats.Albums, func(a, b AlbumCount) int {
+		return cmp.Or(cmp.Compare(b.Items, a.Items), cmp.Compare(a.Album.Title, b.Album.Title))
+	})
+	stats.Albums = stats.Albums[:min(top, len(stats.Albums))]
+
+	stats.Cameras = []CameraCount{}
+	for camera, n := range cameras {
+		stats.Cameras = append(stats.Cameras, CameraCount{Camera: camera, Items: n})
+	}
+	slices.SortFunc(stats.Cameras, func(a, b CameraCount) int {
+		return cmp.Or(cmp.Compare(b.Items, a.Items), cmp.Compare(a.Camera, b.Camera))
+	})
+	stats.Cameras = stats.Cameras[:min(top, len(stats.Cameras))]
+
+	slices.SortStableFunc(videos, func(a, b domain.MediaItem) int { return cmp.Compare(pixels(b), pixels(a)) })
+	stats.LargestVideos = videos[:min(top, len(videos))]
+	if stats.LargestVideos == nil {
+		stats.LargestVideos = []domain.MediaItem{}
+	}
+	return stats, nil
+}
+
+// fetchLibrary lists the albums and media items of the library from the API, without the contents
+// of the albums
+func (uc *IndexUseCase) fetchLibrary(ctx context.Context) (*domain.IndexSnapshot, error) {
+	uc.log().Info("Fetching albums...")
+	albums, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxAlbumPageSize}, uc.albumRepo.ListAlbums))
+	if err != nil {
+		uc.log().Error("Failed to fetch albums", "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Fetching media items...")
+	items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, uc.mediaRepo.ListMediaItems))
+	if err != nil {
+		uc.log().Error("Failed to fetch media items", "error", err)
+		return nil, err
+	}
+	return &domain.IndexSnapshot{Albums: albums, MediaItems: items, UpdatedAt: time.Now()}, nil
+}
+
+// cameraName returns the make and model of the camera that took item, or an empty string when
+// its metadata names none
+func cameraName(item domain.MediaItem) string {
+	if item.MediaMetadata == nil {
+		return ""
+	}
+	var cameraMake, model string
+	switch {
+	case item.MediaMetadata.Photo != nil:
+		cameraMake, model = item.MediaMetadata.Photo.CameraMake, item.MediaMetadata.Photo.CameraModel
+	case item.MediaMetadata.Video != nil:
+		cameraMake, model = item.MediaMetadata.Video.CameraMake, item.MediaMetadata.Video.CameraModel
+	}
+	// Models often repeat the make, as in "Apple iPhone 15" or "Canon EOS R6"
+	if cameraMake == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(cameraMake)) {
+		return model
+	}
+	return strings.TrimSpace(cameraMake + " " + model)
+}
+
+// pixels returns the resolution of item, or 0 when its metadata does not say
+func pixels(item domain.MediaItem) int64 {
+	if item.MediaMetadata == nil {
+		return 0
+	}
+	return item.MediaMetadata.Width * item.MediaMetadata.Height
+}
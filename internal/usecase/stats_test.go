@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestIndexUseCase_Stats(t *testing.T) {
+	taken := func(year int) time.Time { return time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC) }
+	photo := func(id string, year int, cameraMake, model string) domain.MediaItem {
+		return domain.MediaItem{ID: id, MediaMetadata: &domain.MediaMetadata{CreationTime: taken(year), Photo: &domain.PhotoMetadata{CameraMake: cameraMake, CameraModel: model}}}
+	}
+	video := func(id string, year int, width, height int64) domain.MediaItem {
+		return domain.MediaItem{ID: id, MediaMetadata: &domain.MediaMetadata{CreationTime: taken(year), Width: width, Height: height, Video: &domain.VideoMetadata{CameraMake: "Sony", CameraModel: "A7"}}}
+	}
+	items := []domain.MediaItem{
+		photo("p1", 2023, "Apple", "Apple iPhone 15"),
+		photo("p2", 2024, "Apple", "iPhone 15"),
+		photo("p3", 2024, "Apple", "iPhone 15"),
+		video("v1", 2024, 1920, 1080),
+		{ID: "v3", MimeType: "video/mp4"},
+		video("v2", 2023, 3840, 2160),
+		{ID: "x1"},
+	}
+	albums := []domain.Album{{ID: "a1", Title: "Small", MediaItemsCount: 1}, {ID: "a2", Title: "Big", MediaItemsCount: 4}}
+
+	index := &MockIndexRepository{snapshot: domain.IndexSnapshot{Albums: albums, MediaItems: items, UpdatedAt: time.Now()}}
+	uc := NewIndexUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{}, index)
+	stats, err := uc.Stats(context.Background(), StatsOptions{Top: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Source != StatsFromIndex || stats.Items != 7 || stats.Photos != 4 || stats.Videos != 3 {
+		t.Errorf("Unexpected totals: %+v", stats)
+	}
+	if len(stats.Years) != 3 || stats.Years[0].Year != 0 || stats.Years[2] != (YearCount{Year: 2024, Photos: 2, Videos: 1}) {
+		t.Errorf("Expected counts for an unknown year, 2023 and 2024, got %+v", stats.Years)
+	}
+	if len(stats.Albums) != 1 || stats.Albums[0].Album.ID != "a2" {
+		t.Errorf("Expected only the biggest album, got %+v", stats.Albums)
+	}
+	if len(stats.Cameras) != 1 || stats.Cameras[0] != (CameraCount{Camera: "Apple iPhone 15", Items: 3}) {
+		t.Errorf("Expected the iPhone counted once per make and model, got %+v", stats.Cameras)
+	}
+	if len(stats.LargestVideos) != 1 || stats.LargestVideos[0].ID != "v2" {
+		t.Errorf("Expected the 4K video, got %+v", stats.LargestVideos)
+	}
+
+	// Live statistics list the library from the API, even without an index
+	uc = NewIndexUseCase(&MockAlbumRepository{albums: albums}, &MockMediaItemRepository{items: items}, &MockIndexRepository{})
+	stats, err = uc.Stats(context.Background(), StatsOptions{Live: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats.Source != StatsFromAPI || stats.Items != 7 || len(stats.Albums) != 2 || len(stats.Cameras) != 3 {
+		t.Errorf("Unexpected live statistics: %+v", stats)
+	}
+}
@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultWatchInterval is how often a subscription polls when WatchSpec leaves the interval out
+const DefaultWatchInterval = time.Minute
+
+// MinWatchInterval keeps subscriptions from spending the API quota on polling
+const MinWatchInterval = 10 * time.Second
+
+// WatchSpec says which changes a subscription reports
+type WatchSpec struct {
+	// Albums reports albums that are added, removed or renamed
+	Albums bool
+	// AlbumIDs reports media items added to and removed from these albums
+	AlbumIDs []string
+	// Library reports media items added to the library. The API finds new items by capture date, so
+	// only those captured after the newest item seen so far, give or take a day, are reported.
+	Library bool
+	// Interval is the time between polls; zero uses DefaultWatchInterval
+	Interval time.Duration
+}
+
+// Event is a change a subscription found. It is one of AlbumAdded, AlbumRemoved, AlbumRenamed,
+// ItemAdded, ItemRemoved and WatchError.
+type Event interface {
+	event()
+}
+
+// AlbumAdded is an album that appeared
+type AlbumAdded struct {
+	Album domain.Album
+}
+
+// AlbumRemoved is an album that is gone, as it was last seen
+type AlbumRemoved struct {
+	Album domain.Album
+}
+
+// AlbumRenamed is an album whose title changed from PreviousTitle
+type AlbumRenamed struct {
+	Album         domain.Album
+	PreviousTitle string
+}
+
+// ItemAdded is a media item added to the album AlbumID, or to the library when it is empty
+type ItemAdded struct {
+	AlbumID string
+	Item    domain.MediaItem
+}
+
+// ItemRemoved is a media item removed from the album AlbumID, as it was last seen
+type ItemRemoved struct {
+	AlbumID string
+	Item    domain.MediaItem
+}
+
+// WatchError is a poll that failed; the subscription tries again at the next interval
+type WatchError struct {
+	Err error
+}
+
+func (AlbumAdded) event()   {}
+func (AlbumRemoved) event() {}
+func (AlbumRenamed) event() {}
+func (ItemAdded) event()    {}
+func (ItemRemoved) event()  {}
+func (WatchError) event()   {}
+
+// SubscriptionUseCase polls the library for changes and reports them as events, so programs can
+// react to them without diffing listings themselves
+type SubscriptionUseCase struct {
+	logging
+
+	albumRepo domain.AlbumRepository
+	mediaRepo domain.MediaItemRepository
+	now       func() time.Time
+	// wait sleeps for d and reports false when ctx was cancelled first
+	wait func(ctx context.Context, d time.Duration) bool
+}
+
+// NewSubscriptionUseCase creates a new instance of SubscriptionUseCase
+func NewSubscriptionUseCase(albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository) *SubscriptionUseCase {
+	return &SubscriptionUseCase{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+		now:       time.Now,
+		wait:      sleepContext,
+	}
+}
+
+// watchState is what a subscription saw at its last poll
+type watchState struct {
+	// albums holds every album when album changes are reported
+	albums []domain.Album
+	// counts and items hold the item count and media items of every watched album by album ID
+	counts map[string]int64
+	items  map[string][]domain.MediaItem
+	// recent holds the media items of the library captured near the start of the watch or later
+	recent []domain.MediaItem
+	// since is the newest capture time seen in the library, from which new media items are looked
+	// for
+	since time.Time
+}
+
+// Watch polls for the changes spec asks for until ctx is cancelled, sending them on the returned
+// channel, which is closed when the watch ends. The first poll takes stock and reports nothing.
+// Album items are only listed again when the item count of the album changes, so each poll
+// costs an album lookup per watched album plus, with spec.Albums, the album list; an item added
+// and another removed between two polls go unnoticed until the count changes. A failed poll is
+// sent as a WatchError and the next poll compares with the last one that worked. The caller must
+// receive the events, as polling waits for them.
+func (uc *SubscriptionUseCase) Watch(ctx context.Context, spec WatchSpec) (<-chan Event, error) {
+	if !spec.Albums && !spec.Library && len(spec.AlbumIDs) == 0 {
+		return nil, fmt.Errorf("%w: nothing to watch", domain.ErrInvalidArgument)
+	}
+	if spec.Interval == 0 {
+		spec.Interval = DefaultWatchInterval
+	}
+	if spec.Interval < MinWatchInterval {
+		return nil, fmt.Errorf("%w: watch interval must be at least %s", domain.ErrInvalidArgument, MinWatchInterval)
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		send := func(event Event) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var state *watchState
+		for {
+			next, changes, err := uc.poll(ctx, spec, state)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				uc.log().Warn("Failed to poll for changes", "error", err)
+				if !send(WatchError{Err: err}) {
+					return
+				}
+			} else {
+				state = next
+				for _, change := range changes {
+					if !send(change) {
+						return
+					}
+				}
+			}
+			if !uc.wait(ctx, spec.Interval) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// poll takes stock of what spec watches and returns it with the changes since previous; a nil
+// previous reports no changes
+func (uc *SubscriptionUseCase) poll(ctx context.Context, spec WatchSpec, previous *watchState) (*watchState, []Event, error) {
+	state := &watchState{counts: make(map[string]int64), items: make(map[string][]domain.MediaItem)}
+	var events []Event
+
+	if spec.Albums {
+		albums, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxAlbumPageSize}, uc.albumRepo.ListAlbums))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list albums: %w", err)
+		}
+		state.albums = albums
+		if previous != nil {
+			events = append(events, diffAlbums(previous.albums, albums)...)
+		}
+	}
+
+	for _, albumID := range spec.AlbumIDs {
+		// The count tells whether the album changed, so nothing else of it is fetched
+		album, err := uc.albumRepo.GetAlbumFields(albumID, "id,mediaItemsCount")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get album %s: %w", albumID, err)
+		}
+		state.counts[albumID] = album.MediaItemsCount
+		if previous != nil && previous.counts[albumID] == album.MediaItemsCount {
+			state.items[albumID] = previous.items[albumID]
+			continue
+		}
+
+		items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItems(albumID, req)
+		}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list media items of album %s: %w", albumID, err)
+		}
+		state.items[albumID] = items
+		if previous != nil {
+			events = append(events, diffItems(albumID, previous.items[albumID], items)...)
+		}
+	}
+
+	if spec.Library {
+		now := uc.now()
+		state.since = now
+		if previous != nil {
+			state.since = previous.since
+		}
+		// The date filter works on calendar days in an unspecified time zone, hence the day of
+		// overlap on either side
+		filters := domain.SearchFilters{DateRanges: []domain.DateRange{{Start: state.since.AddDate(0, 0, -1), End: now.AddDate(0, 0, 1)}}}
+		items, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+			return uc.mediaRepo.SearchMediaItemsByFilters(filters, req)
+		}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list new media items: %w", err)
+		}
+		state.recent = items
+		for _, item := range items {
+			if t := creationTime(item); t.After(state.since) {
+				state.since = t
+			}
+		}
+		if previous != nil {
+			for _, change := range diffItems("", previous.recent, items) {
+				// Items leave the window as it moves on, which is no removal
+				if _, added := change.(ItemAdded); added {
+					events = append(events, change)
+				}
+			}
+		}
+	}
+	return state, events, nil
+}
+
+// diffAlbums lists the albums added to, removed from and renamed in albums compared to previous
+func diffAlbums(previous, albums []domain.Album) []Event {
+	old := make(map[string]domain.Album, len(previous))
+	for _, album := range previous {
+		old[album.ID] = album
+	}
+
+	var events []Event
+	current := make(map[string]bool, len(albums))
+	for _, album := range albums {
+		current[album.ID] = true
+		before, ok := old[album.ID]
+		switch {
+		case !ok:
+			events = append(events, AlbumAdded{Album: album})
+		case before.Title != album.Title:
+			events = append(events, AlbumRenamed{Album: album, PreviousTitle: before.Title})
+		}
+	}
+	for _, album := range previous {
+		if !current[album.ID] {
+			events = append(events, AlbumRemoved{Album: album})
+		}
+	}
+	return events
+}
+
+// diffItems lists the media items added to and removed from the album albumID
+func diffItems(albumID string, previous, items []domain.MediaItem) []Event {
+	old := make(map[string]bool, len(previous))
+	for _, item := range previous {
+		old[item.ID] = true
+	}
+
+	var events []Event
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		current[item.ID] = true
+		if !old[item.ID] {
+			events = append(events, ItemAdded{AlbumID: albumID, Item: item})
+		}
+	}
+	for _, item := range previous {
+		if !current[item.ID] {
+			events = append(events, ItemRemoved{AlbumID: albumID, Item: item})
+		}
+	}
+	return events
+}
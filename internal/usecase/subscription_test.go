@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestSubscriptionUseCase_Watch(t *testing.T) {
+	albums := &MockAlbumRepository{albums: []domain.Album{
+		{ID: "a1", Title: "Trip", MediaItemsCount: 2},
+		{ID: "a2", Title: "Home", MediaItemsCount: 1},
+	}}
+	media := &MockMediaItemRepository{
+		albumItems: map[string][]domain.MediaItem{"a1": {{ID: "m1"}, {ID: "m2"}}},
+		recent:     []domain.MediaItem{{ID: "n1"}},
+	}
+	useCase := NewSubscriptionUseCase(albums, media)
+	polls := 0
+	useCase.wait = func(ctx context.Context, d time.Duration) bool {
+		// Between the polls, the library changes
+		if polls++; polls > 1 {
+			return false
+		}
+		albums.albums = []domain.Album{
+			{ID: "a1", Title: "Summer Trip", MediaItemsCount: 2},
+			{ID: "a3", Title: "New"},
+		}
+		media.albumItems["a1"] = []domain.MediaItem{{ID: "m2"}, {ID: "m3"}}
+		media.recent = []domain.MediaItem{{ID: "n1"}, {ID: "n2"}}
+		return true
+	}
+
+	events, err := useCase.Watch(context.Background(), WatchSpec{Albums: true, AlbumIDs: []string{"a1"}, Library: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var got []Event
+	for event := range events {
+		got = append(got, event)
+	}
+
+	want := []Event{
+		AlbumRenamed{Album: domain.Album{ID: "a1", Title: "Summer Trip", MediaItemsCount: 2}, PreviousTitle: "Trip"},
+		AlbumAdded{Album: domain.Album{ID: "a3", Title: "New"}},
+		AlbumRemoved{Album: domain.Album{ID: "a2", Title: "Home", MediaItemsCount: 1}},
+		ItemAdded{Item: domain.MediaItem{ID: "n2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	// The album kept its item count, so its items were not listed again
+	if len(media.searches) != 1 {
+		t.Errorf("Expected the album items to be listed once, got %v", media.searches)
+	}
+}
+
+func TestSubscriptionUseCase_WatchAlbumItems(t *testing.T) {
+	albums := &MockAlbumRepository{albums: []domain.Album{{ID: "a1", MediaItemsCount: 2}}}
+	media := &MockMediaItemRepository{albumItems: map[string][]domain.MediaItem{"a1": {{ID: "m1"}, {ID: "m2"}}}}
+	useCase := NewSubscriptionUseCase(albums, media)
+	polls := 0
+	useCase.wait = func(ctx context.Context, d time.Duration) bool {
+		switch polls++; polls {
+		case 1:
+			albums.err = errors.New("unavailable")
+		case 2:
+			albums.err = nil
+			albums.albums[0].MediaItemsCount = 3
+			media.albumItems["a1"] = []domain.MediaItem{{ID: "m2"}, {ID: "m3"}, {ID: "m4"}}
+		default:
+			return false
+		}
+		return true
+	}
+
+	events, err := useCase.Watch(context.Background(), WatchSpec{AlbumIDs: []string{"a1"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var got []Event
+	for event := range events {
+		got = append(got, event)
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("Expected an error and 3 changes, got %+v", got)
+	}
+	if _, ok := got[0].(WatchError); !ok {
+		t.Errorf("Expected the failed poll to be reported, got %+v", got[0])
+	}
+	want := []Event{
+		ItemAdded{AlbumID: "a1", Item: domain.MediaItem{ID: "m3"}},
+		ItemAdded{AlbumID: "a1", Item: domain.MediaItem{ID: "m4"}},
+		ItemRemoved{AlbumID: "a1", Item: domain.MediaItem{ID: "m1"}},
+	}
+	if !reflect.DeepEqual(got[1:], want) {
+		t.Errorf("Expected %+v after the failed poll, got %+v", want, got[1:])
+	}
+}
+
+func TestSubscriptionUseCase_WatchInvalid(t *testing.T) {
+	useCase := NewSubscriptionUseCase(&MockAlbumRepository{}, &MockMediaItemRepository{})
+
+	if _, err := useCase.Watch(context.Background(), WatchSpec{}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an empty spec to be rejected, got %v", err)
+	}
+	if _, err := useCase.Watch(context.Background(), WatchSpec{Albums: true, Interval: time.Second}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected a too short interval to be rejected, got %v", err)
+	}
+}
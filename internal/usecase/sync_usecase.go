@@ -0,0 +1,511 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultFullSyncInterval is how often a sync lists the whole library to pick up deletions and
+// renames of media items older than the watermark
+const DefaultFullSyncInterval = 7 * 24 * time.Hour
+
+// SyncChangeKind is the kind of change a sync found for a media item
+type SyncChangeKind string
+
+// Changes reported by a sync
+const (
+	SyncAdded   SyncChangeKind = "added"
+	SyncRemoved SyncChangeKind = "removed"
+	SyncRenamed SyncChangeKind = "renamed"
+	// SyncDownloaded marks an original fetched again, e.g. after a failed download or a deleted file
+	SyncDownloaded SyncChangeKind = "downloaded"
+)
+
+// SyncOptions configures a sync run
+type SyncOptions struct {
+	// Full lists the whole library instead of only the media items newer than the watermark
+	Full bool
+	// FullEvery turns a run into a full sync when the last one is at least this old; zero never does
+	FullEvery time.Duration
+	// Dir mirrors originals into this directory; empty syncs metadata only
+	Dir string
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// Prune deletes the originals of media items that were removed from the library
+	Prune bool
+	// RemapRoot names where the directory of the last sync is now, such as a mirror started on
+	// a laptop and continued on a NAS; the originals recorded there are taken as they are
+	RemapRoot RootRemap
+}
+
+// RootRemap moves the paths below From to below To; the zero value moves nothing
+type RootRemap struct {
+	From string
+	To   string
+}
+
+// apply returns p moved below To, and false when p is not below From
+func (r RootRemap) apply(p string) (string, bool) {
+	if r.From == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Clean(r.From), filepath.Clean(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	to, err := filepath.Abs(filepath.Join(r.To, rel))
+	if err != nil {
+		return "", false
+	}
+	return to, true
+}
+
+// SyncChange is one difference between the library and the previous sync
+type SyncChange struct {
+	Kind             SyncChangeKind `json:"kind"`
+	MediaItemID      string         `json:"mediaItemId"`
+	Filename         string         `json:"filename,omitempty"`
+	PreviousFilename string         `json:"previousFilename,omitempty"`
+	// Path is the local original the change applied to, if any
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SyncSummary is the outcome of a sync run
+type SyncSummary struct {
+	Full       bool         `json:"full"`
+	Albums     int          `json:"albums"`
+	MediaItems int          `json:"mediaItems"`
+	Changes    []SyncChange `json:"changes"`
+}
+
+// Count returns the number of changes of the given kind
+func (s *SyncSummary) Count(kind SyncChangeKind) int {
+	n := 0
+	for _, change := range s.Changes {
+		if change.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the number of changes whose local original could not be updated
+func (s *SyncSummary) Failed() int {
+	failed := 0
+	for _, change := range s.Changes {
+		if change.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// SyncStatus describes the persisted state of a profile's sync
+type SyncStatus struct {
+	Watermark      time.Time `json:"watermark"`
+	LastSyncAt     time.Time `json:"lastSyncAt"`
+	LastFullSyncAt time.Time `json:"lastFullSyncAt"`
+	Dir            string    `json:"dir,omitempty"`
+	Files          int       `json:"files"`
+}
+
+// SyncUseCase implements the business logic for keeping the local index, and optionally a
+// directory of originals, in step with the library across runs
+type SyncUseCase struct {
+	logging
+	tracing
+
+	albumRepo domain.AlbumRepository
+	mediaRepo domain.MediaItemRepository
+	index     domain.IndexRepository
+	state     domain.SyncStateStore
+	downloads *DownloadUseCase
+}
+
+// NewSyncUseCase creates a new instance of SyncUseCase
+func NewSyncUseCase(albumRepo domain.AlbumRepository, mediaRepo domain.MediaItemRepository, index domain.IndexRepository, state domain.SyncStateStore) *SyncUseCase {
+	return &SyncUseCase{
+		albumRepo: albumRepo,
+		mediaRepo: mediaRepo,
+		index:     index,
+		state:     state,
+		downloads: NewDownloadUseCase(mediaRepo),
+	}
+}
+
+// SetLogger replaces the logger the use case and the use case it builds on report to
+func (uc *SyncUseCase) SetLogger(logger *slog.Logger) {
+	uc.logging.SetLogger(logger)
+	uc.downloads.SetLogger(logger)
+}
+
+// SetTracer replaces the tracer the use case and the use case it builds on record their
+// operations with
+func (uc *SyncUseCase) SetTracer(tracer domain.Tracer) {
+	uc.tracing.SetTracer(tracer)
+	uc.downloads.SetTracer(tracer)
+}
+
+// SetThroughputStore keeps the download speed of originals across runs, see
+// DownloadUseCase.SetThroughputStore
+func (uc *SyncUseCase) SetThroughputStore(store domain.ThroughputStore) {
+	uc.downloads.SetThroughputStore(store)
+}
+
+// SetProgress reports the progress of downloading originals to progress, see
+// DownloadUseCase.SetProgress
+func (uc *SyncUseCase) SetProgress(progress domain.Progress) {
+	uc.downloads.SetProgress(progress)
+}
+
+// Close releases the index
+func (uc *SyncUseCase) Close() error {
+	return uc.index.Close()
+}
+
+// Status returns the persisted sync state
+func (uc *SyncUseCase) Status() (*SyncStatus, error) {
+	state, err := uc.state.LoadSyncState()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyncStatus{
+		Watermark:      state.Watermark,
+		LastSyncAt:     state.LastSyncAt,
+		LastFullSyncAt: state.LastFullSyncAt,
+		Dir:            state.Dir,
+		Files:          len(state.Files),
+	}, nil
+}
+
+// Sync brings the index up to date and reports what changed since the previous run. The first run
+// and runs with opts.Full list the whole library; other runs only fetch media items created since
+// the watermark, so deletions and renames of older items are found by the next full sync.
+func (uc *SyncUseCase) Sync(ctx context.Context, opts SyncOptions) (summary *SyncSummary, err error) {
+	ctx, span := uc.trace(ctx, "sync.run", "full", opts.Full)
+	defer func() { span.End(err) }()
+
+	state, err := uc.state.LoadSyncState()
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := uc.index.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summary = &SyncSummary{
+		Full: opts.Full || previous.UpdatedAt.IsZero() || state.LastFullSyncAt.IsZero() ||
+			(opts.FullEvery > 0 && now.Sub(state.LastFullSyncAt) >= opts.FullEvery),
+	}
+
+	uc.log().Info("Fetching albums...")
+	albums, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxAlbumPageSize}, uc.albumRepo.ListAlbums))
+	if err != nil {
+		uc.log().Error("Failed to fetch albums", "error", err)
+		return nil, err
+	}
+
+	fetched, err := uc.fetchMediaItems(ctx, summary.Full, state.Watermark, now)
+	if err != nil {
+		uc.log().Error("Failed to fetch media items", "error", err)
+		return nil, err
+	}
+
+	items := fetched
+	reuse := previous
+	if summary.Full {
+		reuse = nil
+	} else {
+		items = mergeMediaItems(previous.MediaItems, fetched)
+	}
+
+	albumItems, _, err := fetchAlbumItems(ctx, uc.log(), uc.mediaRepo, albums, reuse)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Albums, summary.MediaItems = len(albums), len(items)
+	summary.Changes = diffSync(previous.MediaItems, items)
+
+	err = uc.index.Replace(domain.IndexSnapshot{
+		Albums:     albums,
+		MediaItems: items,
+		AlbumItems: albumItems,
+		UpdatedAt:  now,
+	})
+	if err != nil {
+		uc.log().Error("Failed to save index", "error", err)
+		return nil, err
+	}
+
+	if opts.Dir != "" {
+		if err := uc.syncOriginals(ctx, state, items, summary, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range items {
+		if t := creationTime(item); t.After(state.Watermark) {
+			state.Watermark = t
+		}
+	}
+	state.LastSyncAt = now
+	if summary.Full {
+		state.LastFullSyncAt = now
+	}
+	if err := uc.state.SaveSyncState(*state); err != nil {
+		uc.log().Error("Failed to save sync state", "error", err)
+		return nil, err
+	}
+
+	uc.log().Info("Successfully synced albums and media items", "albums", summary.Albums, "media_items", summary.MediaItems)
+	return summary, nil
+}
+
+// fetchMediaItems lists the whole library for a full sync, or the media items created since the
+// watermark otherwise. The date filter works on calendar days in an unspecified time zone, so a
+// day of overlap on either side makes sure nothing near the watermark is missed.
+func (uc *SyncUseCase) fetchMediaItems(ctx context.Context, full bool, watermark, now time.Time) ([]domain.MediaItem, error) {
+	req := domain.PageRequest{PageSize: domain.MaxMediaItemPageSize}
+	if full {
+		uc.log().Info("Fetching all media items...")
+		return collect(paginate(ctx, req, uc.mediaRepo.ListMediaItems))
+	}
+
+	start, end := watermark.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	uc.log().Info("Fetching media items created since last sync", "since", start.Format(time.DateOnly))
+	return collect(paginate(ctx, req, func(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+		return uc.mediaRepo.SearchMediaItemsByFilters(domain.SearchFilters{DateRanges: []domain.DateRange{{Start: start, End: end}}}, req)
+	}))
+}
+
+// anchorOriginals keeps the originals recorded for another directory that dir holds with the
+// checksum taken when they were downloaded, as a copy or a mount of the same mirror does. The rest
+// are forgotten, to be downloaded again or adopted like any untracked file. Names are relative to
+// the mirror, so they carry over as they are.
+func (uc *SyncUseCase) anchorOriginals(ctx context.Context, dir string, state *domain.SyncState) error {
+	recorded := len(state.Files)
+	for id, name := range state.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if sum, err := fileChecksum(filepath.Join(dir, name)); err != nil || sum != state.Checksums[id] {
+			delete(state.Files, id)
+			delete(state.Checksums, id)
+		}
+	}
+	if recorded > 0 {
+		uc.log().Info("Checked the originals recorded for another directory", "previous_dir", state.Dir, "dir", dir, "recorded", recorded, "kept", len(state.Files))
+	}
+	return nil
+}
+
+// syncOriginals mirrors the changes in summary into opts.Dir and downloads every media item that
+// has no local original yet, recording the outcome on the changes and the file names in state.
+func (uc *SyncUseCase) syncOriginals(ctx context.Context, state *domain.SyncState, items []domain.MediaItem, summary *SyncSummary, opts SyncOptions) error {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("invalid sync directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create sync directory: %w", err)
+	}
+
+	if state.Files == nil {
+		state.Files, state.Checksums = make(map[string]string), nil
+	}
+	if state.Checksums == nil {
+		state.Checksums = make(map[string]string)
+	}
+	if state.Dir != dir {
+		if moved, ok := opts.RemapRoot.apply(state.Dir); ok && moved == dir {
+			uc.log().Info("Resuming the mirror at its new root", "previous_dir", state.Dir, "dir", dir)
+		} else if err := uc.anchorOriginals(ctx, dir, state); err != nil {
+			return err
+		}
+		state.Dir = dir
+	}
+	// The manifest follows the files, even when the run stops early
+	defer func() {
+		if err := writeManifest(dir, state); err != nil {
+			uc.log().Warn("Failed to write the checksum manifest", "dir", dir, "error", err)
+		}
+	}()
+
+	// Originals deleted by hand are downloaded again
+	for id, name := range state.Files {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			delete(state.Files, id)
+			delete(state.Checksums, id)
+		}
+	}
+
+	used := make(map[string]bool, len(state.Files))
+	for _, name := range state.Files {
+		used[strings.ToLower(name)] = true
+	}
+
+	changes := make(map[string]*SyncChange, len(summary.Changes))
+	for i := range summary.Changes {
+		change := &summary.Changes[i]
+		changes[change.MediaItemID] = change
+
+		name, ok := state.Files[change.MediaItemID]
+		if !ok {
+			continue
+		}
+		change.Path = filepath.Join(dir, name)
+
+		switch change.Kind {
+		case SyncRemoved:
+			delete(state.Files, change.MediaItemID)
+			delete(state.Checksums, change.MediaItemID)
+			if opts.Prune {
+				if err := os.Remove(change.Path); err != nil && !os.IsNotExist(err) {
+					change.Error = fmt.Sprintf("failed to delete file: %v", err)
+				}
+			}
+		case SyncRenamed:
+			renamed := claimFileName(dir, domain.MediaItem{ID: change.MediaItemID, Filename: change.Filename}, used)
+			if err := os.Rename(change.Path, filepath.Join(dir, renamed)); err != nil {
+				change.Error = fmt.Sprintf("failed to rename file: %v", err)
+				continue
+			}
+			state.Files[change.MediaItemID] = renamed
+			change.Path = filepath.Join(dir, renamed)
+		}
+	}
+
+	var pending []domain.MediaItem
+	for _, item := range items {
+		if _, ok := state.Files[item.ID]; !ok {
+			pending = append(pending, item)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	uc.log().Info("Downloading originals", "media_items", len(pending), "dir", dir)
+	names := uniqueFileNames(pending, used)
+	results, err := uc.downloads.downloadAs(ctx, pending, names, DownloadOptions{Dir: dir, Workers: opts.Workers})
+	if err != nil {
+		return err
+	}
+
+	var saved []int
+	for i, result := range results {
+		if result.Error == "" {
+			state.Files[pending[i].ID] = names[i]
+			saved = append(saved, i)
+		}
+		// Untracked files that were already present are adopted without reporting a change
+		if !result.Exists || changes[pending[i].ID] != nil {
+			recordDownload(summary, changes, pending[i], result.Path, result.Error)
+		}
+	}
+
+	// Adopted files are trusted as they are, like the ones just downloaded
+	sums := make([]string, len(saved))
+	runConcurrently(ctx, len(saved), max(opts.Workers, 1), func(i int) {
+		sum, err := fileChecksum(results[saved[i]].Path)
+		if err != nil {
+			uc.log().Warn("Failed to checksum original", "path", results[saved[i]].Path, "error", err)
+		}
+		sums[i] = sum
+	}, func(int, error) {})
+	for i, sum := range sums {
+		if sum != "" {
+			state.Checksums[pending[saved[i]].ID] = sum
+		}
+	}
+	return nil
+}
+
+// recordDownload notes the outcome of downloading item on its change, or reports a download
+// of its own when the item did not change otherwise
+func recordDownload(summary *SyncSummary, changes map[string]*SyncChange, item domain.MediaItem, path, errMsg string) {
+	if change, ok := changes[item.ID]; ok {
+		change.Path, change.Error = path, errMsg
+		return
+	}
+
+	summary.Changes = append(summary.Changes, SyncChange{
+		Kind:        SyncDownloaded,
+		MediaItemID: item.ID,
+		Filename:    item.Filename,
+		Path:        path,
+		Error:       errMsg,
+	})
+}
+
+// claimFileName picks a file name for item that is neither in used nor present in dir
+func claimFileName(dir string, item domain.MediaItem, used map[string]bool) string {
+	for {
+		name := uniqueFileNames([]domain.MediaItem{item}, used)[0]
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			return name
+		}
+	}
+}
+
+// mergeMediaItems returns previous with the media items in newer replacing those with the same ID
+// and the rest appended
+func mergeMediaItems(previous, newer []domain.MediaItem) []domain.MediaItem {
+	byID := make(map[string]int, len(previous))
+	merged := make([]domain.MediaItem, len(previous), len(previous)+len(newer))
+	for i, item := range previous {
+		merged[i] = item
+		byID[item.ID] = i
+	}
+
+	for _, item := range newer {
+		if i, ok := byID[item.ID]; ok {
+			merged[i] = item
+			continue
+		}
+		byID[item.ID] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// diffSync lists the media items added to, removed from and renamed in items compared to previous
+func diffSync(previous, items []domain.MediaItem) []SyncChange {
+	old := make(map[string]domain.MediaItem, len(previous))
+	for _, item := range previous {
+		old[item.ID] = item
+	}
+
+	changes := []SyncChange{}
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		current[item.ID] = true
+		before, ok := old[item.ID]
+		switch {
+		case !ok:
+			changes = append(changes, SyncChange{Kind: SyncAdded, MediaItemID: item.ID, Filename: item.Filename})
+		case before.Filename != item.Filename:
+			changes = append(changes, SyncChange{Kind: SyncRenamed, MediaItemID: item.ID, Filename: item.Filename, PreviousFilename: before.Filename})
+		}
+	}
+
+	for _, item := range previous {
+		if !current[item.ID] {
+			changes = append(changes, SyncChange{Kind: SyncRemoved, MediaItemID: item.ID, Filename: item.Filename})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockSyncStateStore is a mock implementation of SyncStateStore that keeps the state in memory
+type MockSyncStateStore struct {
+	state domain.SyncState
+}
+
+func (m *MockSyncStateStore) LoadSyncState() (*domain.SyncState, error) {
+	state := m.state
+	return &state, nil
+}
+
+func (m *MockSyncStateStore) SaveSyncState(state domain.SyncState) error {
+	m.state = state
+	return nil
+}
+
+func createdAt(id, filename string, t time.Time) domain.MediaItem {
+	return domain.MediaItem{
+		ID:            id,
+		Filename:      filename,
+		BaseURL:       "https://photos.example/" + id,
+		MediaMetadata: &domain.MediaMetadata{CreationTime: t},
+	}
+}
+
+func TestSyncUseCase_FullThenIncremental(t *testing.T) {
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	mediaRepo := &MockMediaItemRepository{items: []domain.MediaItem{
+		createdAt("m1", "a.jpg", jan),
+		createdAt("m2", "b.jpg", feb),
+	}}
+	state := &MockSyncStateStore{}
+	uc := NewSyncUseCase(&MockAlbumRepository{}, mediaRepo, &MockIndexRepository{}, state)
+
+	summary, err := uc.Sync(context.Background(), SyncOptions{FullEvery: DefaultFullSyncInterval})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !summary.Full || summary.Count(SyncAdded) != 2 {
+		t.Errorf("Expected a full sync adding 2 items, got %+v", summary)
+	}
+	if !state.state.Watermark.Equal(feb) {
+		t.Errorf("Expected watermark %v, got %v", feb, state.state.Watermark)
+	}
+
+	// The next run only asks for items since the watermark and keeps the rest of the index
+	mediaRepo.recent = []domain.MediaItem{createdAt("m2", "b-edited.jpg", feb), createdAt("m3", "c.jpg", feb.Add(time.Hour))}
+	summary, err = uc.Sync(context.Background(), SyncOptions{FullEvery: DefaultFullSyncInterval})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Full {
+		t.Error("Expected an incremental sync")
+	}
+	if len(mediaRepo.filterSearches) != 1 || !mediaRepo.filterSearches[0].DateRanges[0].Start.Before(feb) {
+		t.Errorf("Expected one date search starting before the watermark, got %v", mediaRepo.filterSearches)
+	}
+	if summary.MediaItems != 3 || summary.Count(SyncAdded) != 1 || summary.Count(SyncRenamed) != 1 || summary.Count(SyncRemoved) != 0 {
+		t.Errorf("Unexpected incremental summary: %+v", summary)
+	}
+
+	// A full sync finds items deleted from the library
+	mediaRepo.items = []domain.MediaItem{createdAt("m2", "b-edited.jpg", feb), createdAt("m3", "c.jpg", feb.Add(time.Hour))}
+	summary, err = uc.Sync(context.Background(), SyncOptions{Full: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(summary.Changes) != 1 || summary.Changes[0].Kind != SyncRemoved || summary.Changes[0].MediaItemID != "m1" {
+		t.Errorf("Expected m1 to be removed, got %+v", summary.Changes)
+	}
+}
+
+func TestSyncUseCase_Originals(t *testing.T) {
+	dir := t.TempDir()
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	mediaRepo := &MockMediaItemRepository{
+		items: []domain.MediaItem{createdAt("m1", "a.jpg", jan), createdAt("m2", "b.jpg", jan)},
+		files: map[string]string{
+			"https://photos.example/m1=d": "one",
+			"https://photos.example/m2=d": "two",
+		},
+	}
+	uc := NewSyncUseCase(&MockAlbumRepository{}, mediaRepo, &MockIndexRepository{}, &MockSyncStateStore{})
+	opts := SyncOptions{Dir: dir, Workers: 2, Prune: true}
+
+	summary, err := uc.Sync(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Failed() != 0 {
+		t.Fatalf("Expected no failures, got %+v", summary.Changes)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.jpg")); string(data) != "one" {
+		t.Errorf("Expected a.jpg to be downloaded, got %q", data)
+	}
+
+	// m1 is renamed and m2 deleted in the library
+	mediaRepo.items = []domain.MediaItem{createdAt("m1", "renamed.jpg", jan)}
+	opts.Full = true
+	summary, err = uc.Sync(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Failed() != 0 || summary.Count(SyncRenamed) != 1 || summary.Count(SyncRemoved) != 1 {
+		t.Fatalf("Unexpected summary: %+v", summary.Changes)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "renamed.jpg")); string(data) != "one" {
+		t.Errorf("Expected a.jpg to be renamed to renamed.jpg, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Expected b.jpg to be pruned, got %v", err)
+	}
+
+	// An original deleted by hand is downloaded again
+	os.Remove(filepath.Join(dir, "renamed.jpg"))
+	summary, err = uc.Sync(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(summary.Changes) != 1 || summary.Changes[0].Kind != SyncDownloaded {
+		t.Errorf("Expected m1 to be downloaded again, got %+v", summary.Changes)
+	}
+}
+
+func TestSyncUseCase_OriginalsMoved(t *testing.T) {
+	laptop := t.TempDir()
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	mediaRepo := &MockMediaItemRepository{
+		items: []domain.MediaItem{createdAt("m1", "a.jpg", jan), createdAt("m2", "b.jpg", jan)},
+		files: map[string]string{
+			"https://photos.example/m1=d": "one",
+			"https://photos.example/m2=d": "two",
+		},
+	}
+	store := &MockSyncStateStore{}
+	uc := NewSyncUseCase(&MockAlbumRepository{}, mediaRepo, &MockIndexRepository{}, store)
+	if _, err := uc.Sync(context.Background(), SyncOptions{Dir: laptop}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	copyMirror := func(t *testing.T, dir string, names ...string) {
+		t.Helper()
+		for _, name := range names {
+			data, _ := os.ReadFile(filepath.Join(laptop, name))
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Remapped, the recorded originals are taken as they are, without reading them
+	nas := t.TempDir()
+	copyMirror(t, nas, "a.jpg")
+	os.WriteFile(filepath.Join(nas, "b.jpg"), []byte("edited"), 0o644)
+	sum := store.state.Checksums["m2"]
+	summary, err := uc.Sync(context.Background(), SyncOptions{Dir: nas, Full: true, RemapRoot: RootRemap{From: laptop, To: nas}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(summary.Changes) != 0 || store.state.Checksums["m2"] != sum || store.state.Dir != nas {
+		t.Errorf("Expected the mirror to resume at %s, got %+v and %+v", nas, summary.Changes, store.state)
+	}
+
+	// Otherwise the originals whose checksum matches are kept and the missing ones downloaded
+	store.state.Dir = laptop
+	moved := t.TempDir()
+	copyMirror(t, moved, "a.jpg")
+	summary, err = uc.Sync(context.Background(), SyncOptions{Dir: moved, Full: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(summary.Changes) != 1 || summary.Changes[0].MediaItemID != "m2" || summary.Changes[0].Kind != SyncDownloaded {
+		t.Errorf("Expected only m2 to be downloaded, got %+v", summary.Changes)
+	}
+	if data, _ := os.ReadFile(filepath.Join(moved, "b.jpg")); string(data) != "two" {
+		t.Errorf("Expected b.jpg to be downloaded, got %q", data)
+	}
+}
@@ -0,0 +1,446 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// takeoutAlbumMetadata is the file Takeout writes into every album folder
+const takeoutAlbumMetadata = "metadata.json"
+
+// takeoutYearFolder matches the folders Takeout sorts the whole library into by year; they are
+// not albums even though newer exports give them a metadata file too
+var takeoutYearFolder = regexp.MustCompile(`^Photos from \d{4}$`)
+
+// takeoutTrashFolders hold deleted items, which are not imported
+var takeoutTrashFolders = map[string]bool{"Trash": true, "Bin": true}
+
+// takeoutDuplicateSuffix matches the counter Takeout adds to files of the same name in a folder,
+// as in IMG_1(1).jpg, whose metadata file is IMG_1.jpg(1).json
+var takeoutDuplicateSuffix = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+
+// TakeoutOptions configures importing a Google Takeout export of Google Photos
+type TakeoutOptions struct {
+	// Workers is the number of concurrent uploads; values below 1 use the default
+	Workers int
+	// DryRun reports what would be imported without uploading anything or creating albums
+	DryRun bool
+}
+
+// TakeoutItem is a photo or video of a Takeout export, uploaded once however many folders hold it
+type TakeoutItem struct {
+	Path string `json:"path"`
+	// Description and Taken come from the metadata file next to the photo, when there is one
+	Description string    `json:"description,omitempty"`
+	Taken       time.Time `json:"taken,omitzero"`
+	// Albums are the titles of the albums holding the photo
+	Albums      []string `json:"albums,omitempty"`
+	MediaItemID string   `json:"mediaItemId,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// TakeoutAlbum is an album of a Takeout export
+type TakeoutAlbum struct {
+	Title string `json:"title"`
+	// Description is what the album metadata holds. The API cannot set album descriptions, so it
+	// heads an album created by the import as a text entry instead.
+	Description string `json:"description,omitempty"`
+	// Header reports whether the description was added to the top of the album
+	Header bool `json:"header,omitempty"`
+	// Reused reports whether an app-created album of the same title was filled instead of a new one
+	Reused  bool   `json:"reused,omitempty"`
+	AlbumID string `json:"albumId,omitempty"`
+	// MediaItems counts the photos added to the album, or to be added on a dry run
+	MediaItems int    `json:"mediaItems"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TakeoutImport is the outcome of importing a Takeout export
+type TakeoutImport struct {
+	Items  []TakeoutItem  `json:"items"`
+	Albums []TakeoutAlbum `json:"albums"`
+	// Duplicates counts the files left out as copies of others, such as the photos of an album that
+	// are in their year folder as well
+	Duplicates int `json:"duplicates"`
+	// Existing counts the items left out because the album already holds them, as after an
+	// interrupted restore
+	Existing int `json:"existing,omitempty"`
+	// Skipped lists files that are neither photos, videos nor metadata
+	Skipped []string `json:"skipped"`
+}
+
+// Failed returns the number of photos and albums that could not be imported
+func (t *TakeoutImport) Failed() int {
+	failed := 0
+	for _, item := range t.Items {
+		if item.Error != "" {
+			failed++
+		}
+	}
+	for _, album := range t.Albums {
+		if album.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// takeoutSidecar is the metadata file Takeout writes next to every photo
+type takeoutSidecar struct {
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+}
+
+// ImportTakeout uploads the photos and videos of an extracted Google Takeout export below the root
+// of fsys and rebuilds its albums. Takeout puts a copy of every photo into its year folder and one
+// into each album holding it, so copies are recognized by their metadata and uploaded once. The
+// descriptions in the metadata files are set on the new media items; capture times come from the
+// files themselves, as the API cannot set them. Albums reuse an app-created album of the same
+// title, so an interrupted import can be run again.
+//
+// The albums are created first, headed by their description, and then filled one after another:
+// the photos of an album are uploaded concurrently and created in it, and those uploaded with an
+// earlier album are added to it afterwards. Photos outside any album come last.
+func (uc *UploadUseCase) ImportTakeout(ctx context.Context, fsys fs.FS, opts TakeoutOptions) (result *TakeoutImport, err error) {
+	ctx, span := uc.trace(ctx, "upload.takeout", "dry_run", opts.DryRun)
+	defer func() { span.End(err) }()
+
+	result, albumItems, err := scanTakeout(fsys)
+	if err != nil {
+		return nil, err
+	}
+	uc.log().Info("Read Takeout export", "media_files", len(result.Items), "albums", len(result.Albums), "duplicates", result.Duplicates, "skipped", len(result.Skipped))
+	if opts.DryRun || len(result.Items) == 0 {
+		return result, nil
+	}
+
+	if len(result.Albums) > 0 {
+		uc.createTakeoutAlbums(ctx, result)
+	}
+	batches := takeoutBatches(result, albumItems)
+	for n, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		uc.importTakeoutBatch(ctx, fsys, result, batch, opts.Workers, n+1, len(batches))
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	uc.log().Info("Imported Takeout export", "media_items", len(result.Items)-result.Failed(), "albums", len(result.Albums))
+	return result, nil
+}
+
+// createTakeoutAlbums creates the albums of result, or finds the app-created ones of the same
+// title, and sets their IDs. Albums created here get their description as a text entry at the
+// top; reused ones already have it from the run that created them.
+func (uc *UploadUseCase) createTakeoutAlbums(ctx context.Context, result *TakeoutImport) {
+	existing := make(map[string]domain.Album)
+	albums, err := collect(paginate(ctx, domain.PageRequest{PageSize: domain.MaxAlbumPageSize}, uc.albumRepo.ListAlbums))
+	if err != nil {
+		uc.log().Warn("Failed to list albums, creating all of them", "error", err)
+	}
+	for _, album := range albums {
+		if _, ok := existing[album.Title]; !ok && album.IsWriteable {
+			existing[album.Title] = album
+		}
+	}
+
+	for i := range result.Albums {
+		album := &result.Albums[i]
+		if target, ok := existing[album.Title]; ok {
+			album.AlbumID, album.Reused = target.ID, true
+			continue
+		}
+		created, err := uc.albumRepo.CreateAlbum(album.Title)
+		if err != nil {
+			uc.log().Warn("Failed to create album", "album_title", album.Title, "error", err)
+			album.Error = err.Error()
+			continue
+		}
+		album.AlbumID = created.ID
+
+		if album.Description == "" {
+			continue
+		}
+		if _, err := uc.albumRepo.AddTextEnrichment(created.ID, album.Description, domain.PositionFirstInAlbum); err != nil {
+			uc.log().Warn("Failed to add the album description", "album_id", created.ID, "error", err)
+			continue
+		}
+		album.Header = true
+	}
+}
+
+// takeoutBatch is the share of a Takeout import done for one album: the items uploaded and created
+// in it, and the items uploaded with an earlier album that are added to it afterwards
+type takeoutBatch struct {
+	// album is the index of the album in the import, or -1 for the items outside any album
+	album  int
+	upload []int
+	add    []int
+}
+
+// takeoutBatches orders the work of an import by album, in the order of result.Albums. Every item
+// is uploaded with the first album holding it that could be created, or in a last batch without
+// an album, so the media item exists before a later album adds it. Items that failed or have a
+// media item already are left out.
+func takeoutBatches(result *TakeoutImport, albumItems map[string][]int) []takeoutBatch {
+	uploaded := make([]bool, len(result.Items))
+	var batches []takeoutBatch
+	for i, album := range result.Albums {
+		if album.AlbumID == "" {
+			continue
+		}
+		batch := takeoutBatch{album: i}
+		for _, item := range albumItems[album.Title] {
+			if uploaded[item] {
+				batch.add = append(batch.add, item)
+			} else {
+				uploaded[item] = true
+				batch.upload = append(batch.upload, item)
+			}
+		}
+		batches = append(batches, batch)
+	}
+
+	rest := takeoutBatch{album: -1}
+	for i, item := range result.Items {
+		if !uploaded[i] && item.Error == "" && item.MediaItemID == "" {
+			rest.upload = append(rest.upload, i)
+		}
+	}
+	if len(rest.upload) > 0 {
+		batches = append(batches, rest)
+	}
+	return batches
+}
+
+// importTakeoutBatch uploads the items of batch with at most workers at a time, creates them in
+// its album with their descriptions, then adds the items uploaded before. Progress is reported
+// per batch, as the n-th of total.
+func (uc *UploadUseCase) importTakeoutBatch(ctx context.Context, fsys fs.FS, result *TakeoutImport, batch takeoutBatch, workers, n, total int) {
+	var album *TakeoutAlbum
+	albumID := ""
+	if batch.album >= 0 {
+		album = &result.Albums[batch.album]
+		albumID = album.AlbumID
+		// Count what is actually added from here on, not what the export held
+		album.MediaItems = 0
+		uc.log().Info("Importing album", "album_title", album.Title, "album", n, "albums", total, "media_files", len(batch.upload), "uploaded_before", len(batch.add))
+	} else {
+		uc.log().Info("Importing media files outside albums", "media_files", len(batch.upload))
+	}
+
+	files := make([]string, len(batch.upload))
+	descriptions := make([]string, len(batch.upload))
+	for j, i := range batch.upload {
+		files[j], descriptions[j] = result.Items[i].Path, result.Items[i].Description
+	}
+	uploads := make([]UploadResult, len(files))
+	if len(files) > 0 {
+		tokens, exif := uc.uploadFiles(ctx, fsys, files, UploadOptions{Workers: workers}, uploads, false)
+		uc.createMediaItems(albumID, files, tokens, descriptions, uploads)
+		uc.recordExif(files, exif, uploads)
+		uc.cacheThumbnails(ctx, fsys, workers, uploads)
+	}
+	for j, i := range batch.upload {
+		result.Items[i].MediaItemID, result.Items[i].Error = uploads[j].MediaItemID, uploads[j].Error
+		if album != nil && uploads[j].MediaItemID != "" {
+			album.MediaItems++
+		}
+	}
+	if album == nil {
+		return
+	}
+
+	var ids []string
+	for _, i := range batch.add {
+		if id := result.Items[i].MediaItemID; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	want := album.MediaItems + len(ids)
+	for chunk := range slices.Chunk(ids, domain.MaxBatchMediaItems) {
+		if err := uc.albumRepo.BatchAddMediaItems(albumID, chunk); err != nil {
+			uc.log().Warn("Failed to add media items to album", "album_id", albumID, "error", err)
+			album.Error = fmt.Sprintf("failed to add media items after %d of %d: %v", album.MediaItems, want, err)
+			return
+		}
+		album.MediaItems += len(chunk)
+	}
+	if album.MediaItems == 0 {
+		album.Error = "no media items were uploaded"
+	}
+}
+
+// scanTakeout reads the folders of a Takeout export. It returns every photo and video once, with
+// the albums holding it, the albums with the indexes of their items, and what was skipped.
+func scanTakeout(fsys fs.FS) (*TakeoutImport, map[string][]int, error) {
+	files, others, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &TakeoutImport{}
+	metadata := make(map[string][]string)
+	for _, name := range others {
+		if strings.EqualFold(path.Ext(name), ".json") {
+			metadata[path.Dir(name)] = append(metadata[path.Dir(name)], path.Base(name))
+		} else {
+			result.Skipped = append(result.Skipped, name)
+		}
+	}
+
+	albums := make(map[string]*TakeoutAlbum)
+	albumOf := make(map[string]string)
+	for dir := range metadata {
+		if title, description, ok := readTakeoutAlbum(fsys, dir); ok {
+			albumOf[dir] = title
+			if albums[title] == nil {
+				albums[title] = &TakeoutAlbum{Title: title, Description: description}
+			}
+		}
+	}
+
+	albumItems := make(map[string][]int)
+	seen := make(map[string]int)
+	for _, name := range files {
+		dir := path.Dir(name)
+		if takeoutTrashFolders[path.Base(dir)] {
+			continue
+		}
+
+		item := TakeoutItem{Path: name}
+		key := path.Base(name)
+		if sidecar := findTakeoutSidecar(name, metadata[dir]); sidecar != "" {
+			if meta, err := readTakeoutSidecar(fsys, path.Join(dir, sidecar)); err == nil {
+				item.Description, item.Taken = meta.description, meta.taken
+				key = cmp.Or(meta.title, key)
+			}
+		}
+		if info, err := fs.Stat(fsys, name); err == nil {
+			key += "\x00" + strconv.FormatInt(info.Size(), 10)
+		}
+		key += "\x00" + item.Taken.String()
+
+		i, ok := seen[key]
+		if ok {
+			result.Duplicates++
+			result.Items[i].Description = cmp.Or(result.Items[i].Description, item.Description)
+		} else {
+			i = len(result.Items)
+			seen[key] = i
+			result.Items = append(result.Items, item)
+		}
+		if title, ok := albumOf[dir]; ok && !slices.Contains(result.Items[i].Albums, title) {
+			result.Items[i].Albums = append(result.Items[i].Albums, title)
+			albumItems[title] = append(albumItems[title], i)
+			albums[title].MediaItems++
+		}
+	}
+
+	for _, album := range albums {
+		if album.MediaItems > 0 {
+			result.Albums = append(result.Albums, *album)
+		}
+	}
+	slices.SortFunc(result.Albums, func(a, b TakeoutAlbum) int { return cmp.Compare(a.Title, b.Title) })
+	return result, albumItems, nil
+}
+
+// readTakeoutAlbum reads the title and description of the album in dir; ok is false for year
+// folders, the trash and folders without album metadata
+func readTakeoutAlbum(fsys fs.FS, dir string) (title, description string, ok bool) {
+	base := path.Base(dir)
+	if takeoutYearFolder.MatchString(base) || takeoutTrashFolders[base] {
+		return "", "", false
+	}
+	data, err := fs.ReadFile(fsys, path.Join(dir, takeoutAlbumMetadata))
+	if err != nil {
+		return "", "", false
+	}
+	var meta struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Title == "" {
+		return "", "", false
+	}
+	return meta.Title, meta.Description, true
+}
+
+// takeoutMetadata is what is kept of a photo's metadata file
+type takeoutMetadata struct {
+	title       string
+	description string
+	taken       time.Time
+}
+
+// readTakeoutSidecar reads the metadata file of a photo
+func readTakeoutSidecar(fsys fs.FS, name string) (takeoutMetadata, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return takeoutMetadata{}, err
+	}
+	var sidecar takeoutSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return takeoutMetadata{}, err
+	}
+	meta := takeoutMetadata{title: sidecar.Title, description: strings.TrimSpace(sidecar.Description)}
+	if seconds, err := strconv.ParseInt(sidecar.PhotoTakenTime.Timestamp, 10, 64); err == nil && seconds > 0 {
+		meta.taken = time.Unix(seconds, 0).UTC()
+	}
+	return meta, nil
+}
+
+// findTakeoutSidecar returns which of the JSON files of a folder holds the metadata of the media
+// file name, or "" if none does. Takeout names it after the file with .json or
+// .supplemental-metadata.json appended, moves the counter of a repeated name behind the
+// extension, shares it between a photo and its -edited copy, and cuts long names short.
+func findTakeoutSidecar(name string, candidates []string) string {
+	base := path.Base(name)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	stem = strings.TrimSuffix(stem, "-edited")
+
+	counter := ""
+	if m := takeoutDuplicateSuffix.FindStringSubmatch(stem); m != nil {
+		stem, counter = m[1], m[2]
+	}
+	original := stem + ext
+
+	for _, want := range []string{
+		original + counter + ".json",
+		original + ".supplemental-metadata" + counter + ".json",
+	} {
+		if slices.Contains(candidates, want) {
+			return want
+		}
+	}
+
+	// Names cut short keep a prefix of the full name of the metadata file
+	if counter == "" {
+		full := original + ".supplemental-metadata"
+		for _, candidate := range candidates {
+			prefix := strings.TrimSuffix(candidate, ".json")
+			if candidate != takeoutAlbumMetadata && len(prefix) >= len(stem) && strings.HasPrefix(full, prefix) {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"krupesh.faldu/internal/domain"
+)
+
+func TestUploadUseCase_ImportTakeout(t *testing.T) {
+	sidecar := func(title, description string, taken int) *fstest.MapFile {
+		return &fstest.MapFile{Data: fmt.Appendf(nil, `{"title":%q,"description":%q,"photoTakenTime":{"timestamp":"%d"}}`, title, description, taken)}
+	}
+	fsys := fstest.MapFS{
+		"Takeout/Google Photos/Photos from 2024/beach.jpg":                            {Data: []byte("beach")},
+		"Takeout/Google Photos/Photos from 2024/beach.jpg.supplemental-metadata.json": sidecar("beach.jpg", "", 1700000000),
+		"Takeout/Google Photos/Photos from 2024/metadata.json":                        {Data: []byte(`{"title":"Photos from 2024"}`)},
+		"Takeout/Google Photos/Photos from 2024/cake.jpg":                             {Data: []byte("cake")},
+		"Takeout/Google Photos/Photos from 2024/cake.jpg.json":                        sidecar("cake.jpg", "", 1710000000),
+		"Takeout/Google Photos/Summer/beach.jpg":                                      {Data: []byte("beach")},
+		"Takeout/Google Photos/Summer/beach.jpg.supplemental-metadata.json":           sidecar("beach.jpg", "At the beach", 1700000000),
+		"Takeout/Google Photos/Summer/metadata.json":                                  {Data: []byte(`{"title":"Summer","description":"Two weeks off"}`)},
+		"Takeout/Google Photos/Party/cake.jpg":                                        {Data: []byte("cake")},
+		"Takeout/Google Photos/Party/cake.jpg.json":                                   sidecar("cake.jpg", "", 1710000000),
+		"Takeout/Google Photos/Party/metadata.json":                                   {Data: []byte(`{"title":"Party"}`)},
+		"Takeout/Google Photos/Trash/old.jpg":                                         {Data: []byte("old")},
+		"Takeout/archive_browser.html":                                                {Data: []byte("<html>")},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	albumRepo := &MockAlbumRepository{albums: []domain.Album{{ID: "summer-id", Title: "Summer", IsWriteable: true}}}
+	useCase := NewUploadUseCase(mediaRepo, albumRepo)
+
+	result, err := useCase.ImportTakeout(context.Background(), fsys, TakeoutOptions{Workers: 2})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result.Items) != 2 || result.Duplicates != 2 {
+		t.Fatalf("Expected 2 photos and 2 duplicates, got %d and %d", len(result.Items), result.Duplicates)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "Takeout/archive_browser.html" {
+		t.Errorf("Expected the archive browser to be skipped, got %v", result.Skipped)
+	}
+	if len(mediaRepo.uploaded) != 2 {
+		t.Errorf("Expected each photo to be uploaded once, got %v", mediaRepo.uploaded)
+	}
+	descriptions := make(map[string]string)
+	for _, batch := range mediaRepo.batches {
+		for _, item := range batch {
+			descriptions[item.FileName] = item.Description
+		}
+	}
+	if descriptions["beach.jpg"] != "At the beach" || descriptions["cake.jpg"] != "" {
+		t.Errorf("Expected the description of the album copy to be kept, got %v", descriptions)
+	}
+
+	if len(result.Albums) != 2 {
+		t.Fatalf("Expected 2 albums, got %+v", result.Albums)
+	}
+	party, summer := result.Albums[0], result.Albums[1]
+	if party.Title != "Party" || party.AlbumID != "test-id" || party.MediaItems != 1 {
+		t.Errorf("Expected Party to be created with one media item, got %+v", party)
+	}
+	if summer.AlbumID != "summer-id" || summer.Description != "Two weeks off" || summer.MediaItems != 1 {
+		t.Errorf("Expected the existing Summer album to be reused, got %+v", summer)
+	}
+	if result.Failed() != 0 {
+		t.Errorf("Expected nothing to fail, got %d", result.Failed())
+	}
+}
+
+func TestUploadUseCase_ImportTakeoutAlbumsFirst(t *testing.T) {
+	fsys := fstest.MapFS{
+		"A Trip/metadata.json":   {Data: []byte(`{"title":"A Trip","description":"Road trip"}`)},
+		"A Trip/x.jpg":           {Data: []byte("x")},
+		"A Trip/y.jpg":           {Data: []byte("y")},
+		"B Best/metadata.json":   {Data: []byte(`{"title":"B Best"}`)},
+		"B Best/y.jpg":           {Data: []byte("y")},
+		"Photos from 2024/z.jpg": {Data: []byte("z")},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	albumRepo := &MockAlbumRepository{}
+	useCase := NewUploadUseCase(mediaRepo, albumRepo)
+
+	result, err := useCase.ImportTakeout(context.Background(), fsys, TakeoutOptions{Workers: 2})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albumRepo.enrichments) != 1 || albumRepo.enrichments[0] != [2]string{"test-id", "Road trip"} {
+		t.Errorf("Expected the album description to head the new album, got %v", albumRepo.enrichments)
+	}
+	var created [][]string
+	for _, batch := range mediaRepo.batches {
+		var names []string
+		for _, item := range batch {
+			names = append(names, item.FileName)
+		}
+		created = append(created, names)
+	}
+	if fmt.Sprint(created) != "[[x.jpg y.jpg] [z.jpg]]" {
+		t.Errorf("Expected the photos of the first album, then those outside albums, got %v", created)
+	}
+	if len(albumRepo.batches) != 1 || fmt.Sprint(albumRepo.batches[0]) != "[id-y.jpg]" {
+		t.Errorf("Expected the photo shared with the first album to be added to the second, got %v", albumRepo.batches)
+	}
+	trip, best := result.Albums[0], result.Albums[1]
+	if !trip.Header || trip.MediaItems != 2 || best.Header || best.MediaItems != 1 {
+		t.Errorf("Expected both albums rebuilt and only the first headed, got %+v", result.Albums)
+	}
+	if result.Failed() != 0 {
+		t.Errorf("Expected nothing to fail, got %d", result.Failed())
+	}
+}
+
+func TestUploadUseCase_ImportTakeoutDryRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Trip/a.jpg":         {Data: []byte("a")},
+		"Trip/metadata.json": {Data: []byte(`{"title":"Trip"}`)},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	albumRepo := &MockAlbumRepository{}
+	useCase := NewUploadUseCase(mediaRepo, albumRepo)
+
+	result, err := useCase.ImportTakeout(context.Background(), fsys, TakeoutOptions{DryRun: true})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result.Items) != 1 || len(result.Albums) != 1 || result.Albums[0].MediaItems != 1 {
+		t.Errorf("Expected one photo in one album, got %+v", result)
+	}
+	if len(mediaRepo.uploaded) != 0 || len(albumRepo.batches) != 0 {
+		t.Error("Expected a dry run to change nothing")
+	}
+}
+
+func TestFindTakeoutSidecar(t *testing.T) {
+	candidates := []string{
+		"metadata.json",
+		"IMG_1.jpg.json",
+		"IMG_1.jpg(1).json",
+		"IMG_2.HEIC.supplemental-metadata.json",
+		"PXL_20240101_123456789.MP.jpg.supplemental-met.json",
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"IMG_1.jpg", "IMG_1.jpg.json"},
+		{"IMG_1(1).jpg", "IMG_1.jpg(1).json"},
+		{"IMG_1-edited.jpg", "IMG_1.jpg.json"},
+		{"IMG_2.HEIC", "IMG_2.HEIC.supplemental-metadata.json"},
+		{"PXL_20240101_123456789.MP.jpg", "PXL_20240101_123456789.MP.jpg.supplemental-met.json"},
+		{"IMG_3.jpg", ""},
+	}
+	for _, tt := range tests {
+		if got := findTakeoutSidecar("Album/"+tt.name, candidates); got != tt.want {
+			t.Errorf("findTakeoutSidecar(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// DefaultThumbnailSize is the longest side of thumbnails of local files, in pixels, unless
+// another one is asked for
+const DefaultThumbnailSize = 256
+
+// ThumbnailOptions configures making thumbnails of the photos of a directory
+type ThumbnailOptions struct {
+	// Out is the directory the thumbnails are written to, in the same tree as the photos
+	Out string
+	// Size is the longest side of a thumbnail in pixels; 0 uses DefaultThumbnailSize
+	Size int
+	// Workers is the number of photos read at a time; values below 1 use the default
+	Workers int
+}
+
+// ThumbnailResult is the outcome of making the thumbnail of one file
+type ThumbnailResult struct {
+	Path string `json:"path"`
+	// Thumbnail is the file written, or kept when it is Current
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Current is set when the thumbnail was newer than the photo and kept as it is
+	Current bool `json:"current,omitempty"`
+	// Unsupported is set for videos and photos the thumbnailer cannot read
+	Unsupported bool   `json:"unsupported,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ThumbnailUseCase makes thumbnails of local photos, such as those about to be uploaded
+type ThumbnailUseCase struct {
+	logging
+
+	thumbnailer domain.Thumbnailer
+}
+
+// NewThumbnailUseCase creates a new instance of ThumbnailUseCase
+func NewThumbnailUseCase(thumbnailer domain.Thumbnailer) *ThumbnailUseCase {
+	return &ThumbnailUseCase{
+		thumbnailer: thumbnailer,
+	}
+}
+
+// MakeThumbnails writes a JPEG thumbnail of every photo below the root of fsys to opts.Out, as
+// the file name with .jpg added, so photos can be previewed before they are uploaded without
+// asking Google for anything. Thumbnails newer than their photo are kept, so a second run only
+// makes the missing ones. Failures of single files are reported in their result.
+func (uc *ThumbnailUseCase) MakeThumbnails(ctx context.Context, fsys fs.FS, opts ThumbnailOptions) ([]ThumbnailResult, error) {
+	if opts.Out == "" {
+		return nil, errors.New("no directory for the thumbnails given")
+	}
+	if opts.Size == 0 {
+		opts.Size = DefaultThumbnailSize
+	}
+	if opts.Size < 0 {
+		return nil, fmt.Errorf("invalid thumbnail size %d", opts.Size)
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultUploadWorkers
+	}
+
+	files, _, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	uc.log().Info("Making thumbnails", "files", len(files), "size", opts.Size)
+
+	results := make([]ThumbnailResult, len(files))
+	runConcurrently(ctx, len(files), workers, func(i int) {
+		results[i] = uc.makeThumbnail(ctx, fsys, files[i], opts)
+	}, func(i int, err error) {
+		results[i] = ThumbnailResult{Path: files[i], Error: err.Error()}
+	})
+	// Thumbnails written so far are kept, so the next run picks up where this one stopped
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// makeThumbnail writes the thumbnail of the file name of fsys unless a newer one exists
+func (uc *ThumbnailUseCase) makeThumbnail(ctx context.Context, fsys fs.FS, name string, opts ThumbnailOptions) ThumbnailResult {
+	result := ThumbnailResult{Path: name}
+	if strings.HasPrefix(mediaMimeType(name), "video/") {
+		result.Unsupported = true
+		return result
+	}
+
+	target := filepath.Join(opts.Out, filepath.FromSlash(name)+".jpg")
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if thumb, err := os.Stat(target); err == nil && thumb.ModTime().After(info.ModTime()) {
+		result.Thumbnail, result.Current = target, true
+		return result
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer f.Close()
+
+	data, err := uc.thumbnailer.Thumbnail(ctx, path.Base(name), f, opts.Size)
+	if errors.Is(err, domain.ErrUnsupportedFormat) {
+		result.Unsupported = true
+		return result
+	}
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+			err = writeFile(target, func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			})
+		}
+	}
+	if err != nil {
+		uc.log().Warn("Failed to make thumbnail", "path", name, "error", err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Thumbnail = target
+	return result
+}
@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// stubThumbnailer answers with the size and content of the photo, cannot read HEIC and fails
+// on files named broken
+type stubThumbnailer struct{}
+
+func (stubThumbnailer) Thumbnail(ctx context.Context, name string, content io.Reader, size int) ([]byte, error) {
+	b, err := io.ReadAll(content)
+	switch {
+	case err != nil:
+		return nil, err
+	case strings.HasSuffix(name, ".heic"):
+		return nil, domain.ErrUnsupportedFormat
+	case strings.HasPrefix(name, "broken"):
+		return nil, errors.New("failed to decode " + name)
+	}
+	return []byte(fmt.Sprintf("%d:%s", size, b)), nil
+}
+
+func TestThumbnailUseCase_MakeThumbnails(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour)
+	fsys := fstest.MapFS{
+		"trip/beach.png": {Data: []byte("beach"), ModTime: modTime},
+		"clip.mp4":       {Data: []byte("video"), ModTime: modTime},
+		"phone.heic":     {Data: []byte("phone"), ModTime: modTime},
+		"broken.jpg":     {Data: []byte("broken"), ModTime: modTime},
+		"notes.txt":      {Data: []byte("skipped"), ModTime: modTime},
+	}
+	out := t.TempDir()
+	useCase := NewThumbnailUseCase(stubThumbnailer{})
+
+	results, err := useCase.MakeThumbnails(context.Background(), fsys, ThumbnailOptions{Out: out})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	byPath := make(map[string]ThumbnailResult)
+	for _, result := range results {
+		byPath[result.Path] = result
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected a result for every photo and video, got %+v", results)
+	}
+	if r := byPath["clip.mp4"]; !r.Unsupported {
+		t.Errorf("Expected the video to be unsupported, got %+v", r)
+	}
+	if r := byPath["phone.heic"]; !r.Unsupported {
+		t.Errorf("Expected HEIC to be unsupported by the thumbnailer, got %+v", r)
+	}
+	if r := byPath["broken.jpg"]; r.Error == "" {
+		t.Errorf("Expected a failed thumbnail to be reported, got %+v", r)
+	}
+
+	want := filepath.Join(out, "trip", "beach.png.jpg")
+	if r := byPath["trip/beach.png"]; r.Thumbnail != want || r.Error != "" {
+		t.Fatalf("Expected %s, got %+v", want, r)
+	}
+	if b, err := os.ReadFile(want); err != nil || string(b) != "256:beach" {
+		t.Errorf("Expected the thumbnail at the default size, got %q (%v)", b, err)
+	}
+
+	// Thumbnails newer than their photo are kept
+	results, err = useCase.MakeThumbnails(context.Background(), fsys, ThumbnailOptions{Out: out})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, result := range results {
+		if result.Thumbnail != "" && !result.Current {
+			t.Errorf("Expected %s to be kept, got %+v", result.Path, result)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// tracing gives a use case the tracer its operations are recorded with. Use cases whose
+// operations are worth following in a trace embed it; the zero value records nothing.
+type tracing struct {
+	tracer domain.Tracer
+}
+
+// SetTracer replaces the tracer the use case records its operations with; nil records nothing
+func (t *tracing) SetTracer(tracer domain.Tracer) {
+	t.tracer = tracer
+}
+
+// trace begins a span of the operation name with attributes as alternating keys and values,
+// beneath the span ctx carries. The operations it runs are passed the returned context.
+func (t *tracing) trace(ctx context.Context, name string, attrs ...any) (context.Context, domain.Span) {
+	if t.tracer == nil {
+		return ctx, domain.NopTracer{}
+	}
+	return t.tracer.Start(ctx, name, attrs...)
+}
+
+// resultError turns the error message of a result, empty on success, back into an error for
+// ending its span
+func resultError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,584 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	// defaultUploadWorkers is the number of concurrent uploads used when none is configured
+	defaultUploadWorkers = 4
+	// resumableUploadThreshold is the file size from which uploads use the resumable protocol,
+	// so a dropped connection does not restart large videos from zero
+	resumableUploadThreshold = 32 << 20
+)
+
+// mediaMimeTypes maps the file extensions accepted by Google Photos to their MIME types
+var mediaMimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".avif": "image/avif",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".ico":  "image/x-icon",
+	".dng":  "image/x-adobe-dng",
+	".cr2":  "image/x-canon-cr2",
+	".nef":  "image/x-nikon-nef",
+	".arw":  "image/x-sony-arw",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	".3gp":  "video/3gpp",
+	".mkv":  "video/x-matroska",
+	".mpg":  "video/mpeg",
+	".mpeg": "video/mpeg",
+	".mts":  "video/mp2t",
+	".m2ts": "video/mp2t",
+	".wmv":  "video/x-ms-wmv",
+	".webm": "video/webm",
+}
+
+// exifExtensions are the file types whose EXIF dates DateFix can correct: JPEG and TIFF based
+// formats, including the raw formats built on TIFF
+var exifExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true,
+	".dng": true, ".cr2": true, ".nef": true, ".arw": true,
+}
+
+// UploadOptions configures a directory upload
+type UploadOptions struct {
+	// AlbumID adds the uploaded items to an existing app-created album
+	AlbumID string
+	// AlbumTitle creates a new album for the uploaded items; ignored when AlbumID is set
+	AlbumTitle string
+	// Workers is the number of concurrent uploads; values below 1 use the default
+	Workers int
+	// FixDates corrects EXIF timestamps, or adds them from file names, in what is uploaded; the
+	// files themselves are left as they are
+	FixDates *DateFix
+	// Description is a text/template executed for every file with DescriptionData from its EXIF
+	// data, whose result becomes the description of its media item; empty leaves them without
+	Description string
+}
+
+// UploadResult is the outcome of uploading a single file
+type UploadResult struct {
+	Path        string `json:"path"`
+	MediaItemID string `json:"mediaItemId,omitempty"`
+	// DatesFixed is set when the EXIF timestamps were corrected before uploading, and
+	// DateInferred when the date was taken from the file name
+	DatesFixed   bool   `json:"datesFixed,omitempty"`
+	DateInferred bool   `json:"dateInferred,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// DateFixResult shows how DateFix changes when one file was taken
+type DateFixResult struct {
+	Path string `json:"path"`
+	// Taken and Corrected are the EXIF time before and after, as wall clock times in UTC; both are
+	// zero when the file has no EXIF date
+	Taken     time.Time `json:"taken"`
+	Corrected time.Time `json:"corrected"`
+	// Inferred is set when the file had no EXIF date and Taken comes from its file name
+	Inferred bool `json:"inferred,omitempty"`
+	// Excepted is set when the file matches one of the exceptions and is left as it is
+	Excepted bool   `json:"excepted,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// UploadSummary collects the per-file results of a directory upload
+type UploadSummary struct {
+	AlbumID string         `json:"albumId,omitempty"`
+	Results []UploadResult `json:"results"`
+	// Skipped lists files that were not uploaded because they are not photos or videos
+	Skipped []string `json:"skipped"`
+}
+
+// Failed returns the number of files that could not be uploaded
+func (s *UploadSummary) Failed() int {
+	failed := 0
+	for _, result := range s.Results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// UploadUseCase implements the business logic for uploading local files to Google Photos
+type UploadUseCase struct {
+	logging
+	tracing
+	cleanup
+
+	mediaRepo  domain.MediaItemRepository
+	albumRepo  domain.AlbumRepository
+	throughput domain.ThroughputStore
+	progress   domain.Progress
+	uploaded   domain.UploadedFileRepository
+	exif       domain.ExifRepository
+	// thumbnailer makes the thumbnails of uploaded photos kept in thumbs
+	thumbnailer domain.Thumbnailer
+	thumbs      domain.ThumbnailCache
+	albums      *AlbumUseCase
+}
+
+// NewUploadUseCase creates a new instance of UploadUseCase
+func NewUploadUseCase(mediaRepo domain.MediaItemRepository, albumRepo domain.AlbumRepository) *UploadUseCase {
+	return &UploadUseCase{
+		mediaRepo: mediaRepo,
+		albumRepo: albumRepo,
+		albums:    NewAlbumUseCase(albumRepo),
+	}
+}
+
+// SetLogger replaces the logger the use case and the use case it builds on report to
+func (uc *UploadUseCase) SetLogger(logger *slog.Logger) {
+	uc.logging.SetLogger(logger)
+	uc.albums.SetLogger(logger)
+}
+
+// SetThroughputStore keeps the upload speed across runs, so the remaining time of a resumed
+// upload is estimated from the start; nil estimates every run from scratch
+func (uc *UploadUseCase) SetThroughputStore(store domain.ThroughputStore) {
+	uc.throughput = store
+}
+
+// SetProgress reports the progress of uploads to progress; nil reports it nowhere
+func (uc *UploadUseCase) SetProgress(progress domain.Progress) {
+	uc.progress = progress
+}
+
+// SetExifRepository records the capture time, camera and location in the EXIF data of uploaded
+// photos, which the API does not return for the location; nil records nothing
+func (uc *UploadUseCase) SetExifRepository(exif domain.ExifRepository) {
+	uc.exif = exif
+}
+
+// SetThumbnails makes thumbnails of uploaded photos from the local files with thumbnailer and
+// keeps them in thumbs at DefaultThumbnailSize, the size the web gallery shows, so previews of
+// new media items are not downloaded from Google; a nil thumbnailer makes none
+func (uc *UploadUseCase) SetThumbnails(thumbnailer domain.Thumbnailer, thumbs domain.ThumbnailCache) {
+	uc.thumbnailer, uc.thumbs = thumbnailer, thumbs
+}
+
+// UploadDirectory walks fsys, uploads every photo and video through a pool of workers and then
+// creates the media items in batches. Failures of individual files are reported in the summary
+// rather than aborting the upload; cancelling ctx stops starting new uploads.
+func (uc *UploadUseCase) UploadDirectory(ctx context.Context, fsys fs.FS, opts UploadOptions) (summary *UploadSummary, err error) {
+	ctx, span := uc.trace(ctx, "upload.directory", "album_id", opts.AlbumID)
+	defer func() { span.End(err) }()
+
+	var describe *template.Template
+	if opts.Description != "" {
+		describe, err = template.New("description").Option("missingkey=error").Parse(opts.Description)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid description template: %v", domain.ErrInvalidArgument, err)
+		}
+	}
+	files, skipped, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	summary = &UploadSummary{AlbumID: opts.AlbumID, Skipped: skipped}
+	uc.log().Info("Found media files, skipping other files", "files", len(files), "skipped", len(skipped))
+	if len(files) == 0 {
+		return summary, nil
+	}
+
+	if summary.AlbumID == "" && opts.AlbumTitle != "" {
+		album, err := uc.albumRepo.CreateAlbum(opts.AlbumTitle)
+		if err != nil {
+			uc.log().Error("Failed to create album", "album_title", opts.AlbumTitle, "error", err)
+			return nil, err
+		}
+		uc.log().Info("Created album", "title", album.Title, "album_id", album.ID)
+		summary.AlbumID = album.ID
+	}
+
+	summary.Results = make([]UploadResult, len(files))
+	tokens, exif := uc.uploadFiles(ctx, fsys, files, opts, summary.Results, describe != nil)
+	var descriptions []string
+	if describe != nil {
+		descriptions = uc.uploadDescriptions(describe, files, tokens, exif, summary.Results)
+	}
+	uc.createMediaItems(summary.AlbumID, files, tokens, descriptions, summary.Results)
+	uc.recordExif(files, exif, summary.Results)
+	uc.cacheThumbnails(ctx, fsys, opts.Workers, summary.Results)
+
+	uc.log().Info("Uploaded files", "uploaded", len(files)-summary.Failed(), "files", len(files))
+	return summary, nil
+}
+
+// PreviewDateFix reports for every photo and video below the root of fsys how fix would change
+// when it was taken, without uploading anything
+func (uc *UploadUseCase) PreviewDateFix(fsys fs.FS, fix DateFix) ([]DateFixResult, error) {
+	files, _, err := findMediaFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.log().Info("Previewing date corrections", "files", len(files))
+	results := make([]DateFixResult, len(files))
+	for i, name := range files {
+		_, results[i] = readFixedFile(fsys, name, fix)
+	}
+	return results, nil
+}
+
+// uploadFiles uploads files concurrently, reporting progress and the remaining time, and returns
+// their upload tokens by index; failures are recorded in results and leave the token empty. The
+// EXIF data of the files is read too when it is recorded or readExif is set.
+func (uc *UploadUseCase) uploadFiles(ctx context.Context, fsys fs.FS, files []string, opts UploadOptions, results []UploadResult, readExif bool) ([]string, []domain.ExifData) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = defaultUploadWorkers
+	}
+
+	for i, name := range files {
+		results[i].Path = name
+	}
+
+	tokens := make([]string, len(files))
+	exif := make([]domain.ExifData, len(files))
+	readExif = readExif || uc.exif != nil
+	progress := newProgressTracker(uc.throughput, uc.progress, domain.JobUpload, len(files), uc.log())
+	defer progress.close()
+	runConcurrently(ctx, len(files), workers, func(i int) {
+		var size int64
+		_, span := uc.trace(ctx, "upload.file", "file", files[i])
+		defer func() {
+			span.End(resultError(results[i].Error))
+			progress.finish(files[i], size, results[i].Error != "", false)
+		}()
+
+		if opts.FixDates != nil {
+			content, fixed := readFixedFile(fsys, files[i], *opts.FixDates)
+			if fixed.Error != "" {
+				uc.log().Warn("Failed to correct dates", "file", files[i], "error", fixed.Error)
+				results[i].Error = fixed.Error
+				return
+			}
+			if content != nil {
+				if readExif {
+					exif[i] = uc.parseExif(files[i], content)
+				}
+				uc.log().Debug("Corrected dates", "file", files[i], "taken", fixed.Taken.Format(time.DateTime), "corrected", fixed.Corrected.Format(time.DateTime), "inferred", fixed.Inferred)
+				// Corrected files are small photos held in memory, so they are sent in one request
+				token, err := uc.mediaRepo.Upload(path.Base(files[i]), mediaMimeType(files[i]), bytes.NewReader(content), int64(len(content)))
+				if err != nil {
+					uc.log().Warn("Failed to upload", "file", files[i], "error", err)
+					results[i].Error = err.Error()
+					return
+				}
+				tokens[i], results[i].DatesFixed, results[i].DateInferred = token, true, fixed.Inferred
+				size = int64(len(content))
+				return
+			}
+		}
+
+		if readExif && exifExtensions[strings.ToLower(path.Ext(files[i]))] {
+			exif[i] = uc.readExifFile(fsys, files[i])
+		}
+		token, n, err := uc.uploadFile(ctx, fsys, files[i])
+		if err != nil {
+			uc.log().Warn("Failed to upload", "file", files[i], "error", err)
+			results[i].Error = err.Error()
+			return
+		}
+		tokens[i], size = token, n
+	}, func(i int, err error) {
+		results[i].Error = err.Error()
+	})
+
+	for i := range exif {
+		exif[i].Path = files[i]
+	}
+	return tokens, exif
+}
+
+// readExifFile reads the EXIF data at the start of the file name; a file whose EXIF data cannot
+// be read is uploaded without it
+func (uc *UploadUseCase) readExifFile(fsys fs.FS, name string) domain.ExifData {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return domain.ExifData{}
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, exifReadLimit))
+	if err != nil {
+		return domain.ExifData{}
+	}
+	return uc.parseExif(name, head)
+}
+
+// parseExif returns the EXIF data of the file name with content b
+func (uc *UploadUseCase) parseExif(name string, b []byte) domain.ExifData {
+	data, err := readExif(b)
+	if err != nil {
+		uc.log().Debug("Failed to read EXIF data", "file", name, "error", err)
+	}
+	return data
+}
+
+// uploadDescriptions renders the description of every uploaded file from its EXIF data; files
+// whose description cannot be rendered fail rather than being created without it
+func (uc *UploadUseCase) uploadDescriptions(tmpl *template.Template, files, tokens []string, exif []domain.ExifData, results []UploadResult) []string {
+	descriptions := make([]string, len(files))
+	for i, name := range files {
+		if tokens[i] == "" {
+			continue
+		}
+		base := path.Base(name)
+		data := DescriptionData{
+			Filename: base,
+			Name:     strings.TrimSuffix(base, path.Ext(base)),
+			Created:  exif[i].Taken,
+			Camera:   strings.TrimSpace(exif[i].CameraMake + " " + exif[i].CameraModel),
+			Location: exif[i].Location,
+		}
+		var b strings.Builder
+		err := tmpl.Execute(&b, data)
+		if err == nil {
+			descriptions[i] = strings.TrimSpace(b.String())
+			err = validateDescription(descriptions[i])
+		}
+		if err != nil {
+			uc.log().Warn("Failed to render description", "file", name, "error", err)
+			results[i].Error = fmt.Sprintf("cannot render description: %v", err)
+			tokens[i] = ""
+		}
+	}
+	return descriptions
+}
+
+// recordExif records the EXIF data of the files that became media items, if it is recorded
+func (uc *UploadUseCase) recordExif(files []string, exif []domain.ExifData, results []UploadResult) {
+	if uc.exif == nil {
+		return
+	}
+	var records []domain.ExifData
+	for i, result := range results {
+		if result.MediaItemID != "" && !exif[i].IsZero() {
+			exif[i].MediaItemID = result.MediaItemID
+			records = append(records, exif[i])
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	if err := uc.exif.SaveExif(records); err != nil {
+		uc.log().Warn("Failed to record EXIF data", "media_items", len(records), "error", err)
+	}
+}
+
+// cacheThumbnails keeps the thumbnails of the photos that became media items, if they are kept.
+// Files the thumbnailer cannot read are left to be downloaded when they are shown.
+func (uc *UploadUseCase) cacheThumbnails(ctx context.Context, fsys fs.FS, workers int, results []UploadResult) {
+	if uc.thumbnailer == nil {
+		return
+	}
+	if workers < 1 {
+		workers = defaultUploadWorkers
+	}
+	runConcurrently(ctx, len(results), workers, func(i int) {
+		result := results[i]
+		if result.MediaItemID == "" || !strings.HasPrefix(mediaMimeType(result.Path), "image/") {
+			return
+		}
+		f, err := fsys.Open(result.Path)
+		if err != nil {
+			uc.log().Warn("Failed to make thumbnail", "file", result.Path, "error", err)
+			return
+		}
+		data, err := uc.thumbnailer.Thumbnail(ctx, path.Base(result.Path), f, DefaultThumbnailSize)
+		f.Close()
+		if errors.Is(err, domain.ErrUnsupportedFormat) {
+			return
+		}
+		if err == nil {
+			err = uc.thumbs.SaveThumbnail(result.MediaItemID, DefaultThumbnailSize, data)
+		}
+		if err != nil {
+			uc.log().Warn("Failed to make thumbnail", "file", result.Path, "error", err)
+		}
+	}, func(int, error) {})
+}
+
+// uploadFile sends the bytes of one file and returns its upload token and size; large files use
+// resumable uploads
+func (uc *UploadUseCase) uploadFile(ctx context.Context, fsys fs.FS, name string) (string, int64, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var token string
+	if content, ok := f.(io.ReaderAt); ok && info.Size() >= resumableUploadThreshold {
+		// Size and modification time tell a changed file apart from the one a saved session belongs to
+		key := fmt.Sprintf("%s:%d:%d", name, info.Size(), info.ModTime().UnixNano())
+		token, err = uc.mediaRepo.UploadResumable(ctx, key, path.Base(name), mediaMimeType(name), content, info.Size())
+	} else {
+		token, err = uc.mediaRepo.Upload(path.Base(name), mediaMimeType(name), f, info.Size())
+	}
+	return token, info.Size(), err
+}
+
+// readFixedFile applies fix to the EXIF dates of name, first adding the date in its file name
+// to a JPEG without EXIF data. The corrected content is returned only when there was something
+// to correct; files of other types are not read.
+func readFixedFile(fsys fs.FS, name string, fix DateFix) ([]byte, DateFixResult) {
+	result := DateFixResult{Path: name}
+	for _, pattern := range fix.Except {
+		if ok, _ := path.Match(pattern, name); ok {
+			result.Excepted = true
+		} else if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			result.Excepted = true
+		}
+	}
+	if result.Excepted || !exifExtensions[strings.ToLower(path.Ext(name))] {
+		return nil, result
+	}
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		result.Error = err.Error()
+		return nil, result
+	}
+	taken, corrected, ok, err := fixExifDates(content, fix)
+	if err == nil && !ok {
+		if inferred, found := domain.InferFilenameDate(fix.FileNames, path.Base(name)); found {
+			if with := addExifDate(content, inferred); with != nil {
+				content, result.Inferred = with, true
+				taken, corrected, ok, err = fixExifDates(content, fix)
+			}
+		}
+	}
+	switch {
+	case err != nil:
+		result.Error = fmt.Sprintf("cannot correct dates: %v", err)
+		return nil, result
+	case !ok:
+		return nil, result
+	}
+	result.Taken, result.Corrected = taken, corrected
+	if !result.Inferred && !fix.shifts() {
+		// Dates from file names are only added, so those already there stay as they are
+		return nil, result
+	}
+	return content, result
+}
+
+// createMediaItems turns upload tokens into media items in batches of domain.MaxBatchMediaItems,
+// with the descriptions at the same index if any, and records the created media item IDs or
+// per-item errors in results
+func (uc *UploadUseCase) createMediaItems(albumID string, files, tokens, descriptions []string, results []UploadResult) {
+	var pending []int
+	for i, token := range tokens {
+		if token != "" {
+			pending = append(pending, i)
+		}
+	}
+
+	for batch := range slices.Chunk(pending, domain.MaxBatchMediaItems) {
+		items := make([]domain.NewMediaItem, len(batch))
+		byToken := make(map[string]int, len(batch))
+		for j, i := range batch {
+			items[j] = domain.NewMediaItem{UploadToken: tokens[i], FileName: path.Base(files[i])}
+			if descriptions != nil {
+				items[j].Description = descriptions[i]
+			}
+			byToken[tokens[i]] = i
+		}
+
+		created, err := uc.mediaRepo.BatchCreateMediaItems(albumID, items)
+		if err != nil {
+			uc.log().Error("Failed to create media items", "media_items", len(batch), "error", err)
+			for _, i := range batch {
+				results[i].Error = err.Error()
+			}
+			continue
+		}
+
+		for _, result := range created {
+			i, ok := byToken[result.UploadToken]
+			if !ok {
+				continue
+			}
+			delete(byToken, result.UploadToken)
+			switch {
+			case !result.Status.OK():
+				results[i].Error = fmt.Sprintf("create media item failed: %s (code %d)", result.Status.Message, result.Status.Code)
+			case result.MediaItem == nil:
+				results[i].Error = "create media item failed: no media item returned"
+			default:
+				results[i].MediaItemID = result.MediaItem.ID
+			}
+		}
+
+		// Tokens the API did not report on cannot be assumed to have worked
+		for _, i := range byToken {
+			results[i].Error = "create media item failed: no result returned"
+		}
+	}
+}
+
+// findMediaFiles lists the photos and videos below the root of fsys in lexical order,
+// together with the other regular files that are skipped. Hidden files and directories are ignored.
+func findMediaFiles(fsys fs.FS) (files, skipped []string, err error) {
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if mediaMimeType(name) == "" {
+			skipped = append(skipped, name)
+			return nil
+		}
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+	return files, skipped, nil
+}
+
+// mediaMimeType returns the MIME type for a photo or video file name, or "" for other files
+func mediaMimeType(name string) string {
+	return mediaMimeTypes[strings.ToLower(path.Ext(name))]
+}
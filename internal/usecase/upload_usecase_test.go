@@ -0,0 +1,454 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockMediaItemRepository is a mock implementation for testing
+type MockMediaItemRepository struct {
+	mu       sync.Mutex
+	uploaded []string
+	// contents holds the uploaded bytes by file name
+	contents map[string]string
+	batches  [][]domain.NewMediaItem
+	albumID  string
+	// failUpload and failCreate name files whose upload or media item creation fails
+	failUpload map[string]bool
+	failCreate map[string]bool
+	// items are returned by GetMediaItem and SearchMediaItems; downloads serve files by URL
+	items     []domain.MediaItem
+	files     map[string]string
+	downloads []string
+	// albumItems overrides the search results per album when set
+	albumItems map[string][]domain.MediaItem
+	searches   []string
+	// recent is returned by SearchMediaItemsByFilters, whose filters are recorded in filterSearches
+	recent         []domain.MediaItem
+	filterSearches []domain.SearchFilters
+	// descriptions records the descriptions set by media item ID
+	descriptions map[string]string
+}
+
+func (m *MockMediaItemRepository) Upload(fileName, mimeType string, content io.Reader, size int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failUpload[fileName] {
+		return "", errors.New("upload rejected")
+	}
+	m.uploaded = append(m.uploaded, fileName)
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	if m.contents == nil {
+		m.contents = make(map[string]string)
+	}
+	m.contents[fileName] = string(b)
+	return "token-" + fileName, nil
+}
+
+func (m *MockMediaItemRepository) UploadResumable(ctx context.Context, key, fileName, mimeType string, content io.ReaderAt, size int64) (string, error) {
+	return m.Upload(fileName, mimeType, io.NewSectionReader(content, 0, size), size)
+}
+
+func (m *MockMediaItemRepository) GetMediaItem(id string) (*domain.MediaItem, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return &item, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *MockMediaItemRepository) UpdateMediaItemDescription(id, description string) (*domain.MediaItem, error) {
+	item, err := m.GetMediaItem(id)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.descriptions == nil {
+		m.descriptions = make(map[string]string)
+	}
+	m.descriptions[id] = description
+	item.Description = description
+	return item, nil
+}
+
+func (m *MockMediaItemRepository) ListMediaItems(req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	return &domain.Page[domain.MediaItem]{Items: m.items}, nil
+}
+
+func (m *MockMediaItemRepository) SearchMediaItems(albumID string, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searches = append(m.searches, albumID)
+	if m.albumItems != nil {
+		return &domain.Page[domain.MediaItem]{Items: m.albumItems[albumID]}, nil
+	}
+	return &domain.Page[domain.MediaItem]{Items: m.items}, nil
+}
+
+func (m *MockMediaItemRepository) SearchMediaItemsByFilters(filters domain.SearchFilters, req domain.PageRequest) (*domain.Page[domain.MediaItem], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filterSearches = append(m.filterSearches, filters)
+	return &domain.Page[domain.MediaItem]{Items: m.recent}, nil
+}
+
+func (m *MockMediaItemRepository) BatchGetMediaItems(ids []string) ([]domain.MediaItem, error) {
+	var found []domain.MediaItem
+	for _, id := range ids {
+		if item, err := m.GetMediaItem(id); err == nil {
+			found = append(found, *item)
+		}
+	}
+	return found, nil
+}
+
+func (m *MockMediaItemRepository) GetMediaItems(ids []string) ([]domain.MediaItemResult, error) {
+	results := make([]domain.MediaItemResult, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		if item, err := m.GetMediaItem(id); err == nil {
+			results[i].MediaItem = item
+		} else {
+			results[i].Err = &domain.APIError{Status: "NOT_FOUND", Message: "media item not found"}
+		}
+	}
+	return results, nil
+}
+
+// DownloadMediaItem serves files by the download URL of the item as listed in items, like the
+// repository refreshing base URLs, falling back to the base URL of the item passed in
+func (m *MockMediaItemRepository) DownloadMediaItem(item domain.MediaItem, size domain.ImageSize) (io.ReadCloser, error) {
+	if current, err := m.GetMediaItem(item.ID); err == nil {
+		item.BaseURL = current.BaseURL
+	}
+	url := item.DownloadURL(size)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.downloads = append(m.downloads, url)
+	content, ok := m.files[url]
+	if !ok {
+		return nil, errors.New("API error: 404 Not Found")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (m *MockMediaItemRepository) BatchCreateMediaItems(albumID string, items []domain.NewMediaItem) ([]domain.NewMediaItemResult, error) {
+	m.albumID = albumID
+	m.batches = append(m.batches, items)
+
+	results := make([]domain.NewMediaItemResult, len(items))
+	for i, item := range items {
+		results[i].UploadToken = item.UploadToken
+		if m.failCreate[item.FileName] {
+			results[i].Status = domain.Status{Code: 3, Message: "invalid media"}
+			continue
+		}
+		results[i].MediaItem = &domain.MediaItem{ID: "id-" + item.FileName}
+	}
+	return results, nil
+}
+
+func TestUploadUseCase_UploadDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.jpg":           {Data: []byte("a")},
+		"notes.txt":       {Data: []byte("n")},
+		"trip/b.MOV":      {Data: []byte("b")},
+		"trip/broken.png": {Data: []byte("c")},
+		"trip/bad.heic":   {Data: []byte("d")},
+		".hidden.jpg":     {Data: []byte("h")},
+		".thumbs/x.jpg":   {Data: []byte("x")},
+	}
+	mediaRepo := &MockMediaItemRepository{
+		failUpload: map[string]bool{"broken.png": true},
+		failCreate: map[string]bool{"bad.heic": true},
+	}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+
+	summary, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{AlbumTitle: "Vacation", Workers: 2})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.AlbumID != "test-id" || mediaRepo.albumID != "test-id" {
+		t.Errorf("Expected items to be added to the created album, got %q and %q", summary.AlbumID, mediaRepo.albumID)
+	}
+	if len(summary.Skipped) != 1 || summary.Skipped[0] != "notes.txt" {
+		t.Errorf("Expected notes.txt to be skipped, got %v", summary.Skipped)
+	}
+	if len(summary.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(summary.Results))
+	}
+
+	want := map[string]UploadResult{
+		"a.jpg":           {Path: "a.jpg", MediaItemID: "id-a.jpg"},
+		"trip/b.MOV":      {Path: "trip/b.MOV", MediaItemID: "id-b.MOV"},
+		"trip/broken.png": {Path: "trip/broken.png", Error: "upload rejected"},
+		"trip/bad.heic":   {Path: "trip/bad.heic", Error: "create media item failed: invalid media (code 3)"},
+	}
+	for _, result := range summary.Results {
+		if result != want[result.Path] {
+			t.Errorf("Expected %+v, got %+v", want[result.Path], result)
+		}
+	}
+	if summary.Failed() != 2 {
+		t.Errorf("Expected 2 failures, got %d", summary.Failed())
+	}
+}
+
+func TestUploadUseCase_UploadDirectoryBatches(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := range 120 {
+		fsys[fmt.Sprintf("%03d.jpg", i)] = &fstest.MapFile{Data: []byte("x")}
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+
+	summary, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{AlbumID: "existing"})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(mediaRepo.batches) != 3 || len(mediaRepo.batches[0]) != 50 || len(mediaRepo.batches[2]) != 20 {
+		t.Errorf("Expected batches of 50, 50 and 20, got %d batches", len(mediaRepo.batches))
+	}
+	if mediaRepo.albumID != "existing" || summary.Failed() != 0 {
+		t.Errorf("Expected all items in album existing, got album %q with %d failures", mediaRepo.albumID, summary.Failed())
+	}
+}
+
+func TestUploadUseCase_UploadDirectoryCancelled(t *testing.T) {
+	fsys := fstest.MapFS{"a.jpg": {Data: []byte("a")}}
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err := useCase.UploadDirectory(ctx, fsys, UploadOptions{})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(mediaRepo.uploaded) != 0 || summary.Failed() != 1 {
+		t.Errorf("Expected no uploads after cancellation, got %v", mediaRepo.uploaded)
+	}
+}
+
+func TestUploadUseCase_UploadDirectoryFixDates(t *testing.T) {
+	original := exifJPEG("2024:04:01 00:15:00", "+01:00")
+	fsys := fstest.MapFS{
+		"a.jpg":          {Data: original},
+		"phone/b.jpg":    {Data: exifJPEG("2024:04:01 00:15:00", "+01:00")},
+		"clip.mp4":       {Data: []byte("video")},
+		"no-exif.jpeg":   {Data: []byte{0xFF, 0xD8, 0xFF, 0xD9}},
+		"broken.jpg":     {Data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}},
+		"screenshot.png": {Data: []byte("png")},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	fix := &DateFix{Offset: time.Hour, Except: []string{"phone/*"}}
+
+	summary, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{FixDates: fix})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fixed := map[string]bool{}
+	for _, result := range summary.Results {
+		fixed[result.Path] = result.DatesFixed
+		if result.Error != "" && result.Path != "broken.jpg" {
+			t.Errorf("Expected %s to be uploaded, got %s", result.Path, result.Error)
+		}
+	}
+	if !fixed["a.jpg"] || fixed["phone/b.jpg"] || fixed["clip.mp4"] || fixed["no-exif.jpeg"] {
+		t.Errorf("Expected only a.jpg to have fixed dates, got %v", fixed)
+	}
+	if !strings.Contains(mediaRepo.contents["a.jpg"], "2024:04:01 01:15:00") || strings.Contains(mediaRepo.contents["b.jpg"], "01:15:00") {
+		t.Errorf("Expected the corrected date in a.jpg only")
+	}
+	// The local file is left as it is
+	if !bytes.Equal(fsys["a.jpg"].Data, original) || bytes.Contains(original, []byte("01:15:00")) {
+		t.Error("Expected the local file to be unchanged")
+	}
+	if summary.Failed() != 1 {
+		t.Errorf("Expected broken.jpg to fail, got %d failures", summary.Failed())
+	}
+}
+
+func TestUploadUseCase_PreviewDateFix(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.jpg":    {Data: exifJPEG("2024:04:01 00:15:00", "+01:00")},
+		"skip.jpg": {Data: exifJPEG("2024:04:01 00:15:00", "+01:00")},
+		"clip.mp4": {Data: []byte("video")},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+
+	results, err := useCase.PreviewDateFix(fsys, DateFix{Offset: -48 * time.Hour, Except: []string{"skip.*"}})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 3 || len(mediaRepo.uploaded) != 0 {
+		t.Fatalf("Expected 3 results and no uploads, got %d and %v", len(results), mediaRepo.uploaded)
+	}
+	byPath := map[string]DateFixResult{}
+	for _, result := range results {
+		byPath[result.Path] = result
+	}
+	if got := byPath["a.jpg"].Corrected.Format(time.DateTime); got != "2024-03-30 00:15:00" {
+		t.Errorf("Expected a.jpg corrected to 2024-03-30 00:15:00, got %s", got)
+	}
+	if !byPath["skip.jpg"].Excepted || !byPath["skip.jpg"].Taken.IsZero() || !byPath["clip.mp4"].Taken.IsZero() {
+		t.Errorf("Expected skip.jpg excepted and clip.mp4 without a date, got %+v", results)
+	}
+}
+
+func TestUploadUseCase_UploadDirectoryInferDates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"IMG_20240115_103000.jpg":    {Data: []byte{0xFF, 0xD8, 0xFF, 0xD9}},
+		"IMG_20240116_090000.jpg":    {Data: exifJPEG("2024:04:01 00:15:00", "+01:00")},
+		"VID_20240115_103000.mp4":    {Data: []byte("video")},
+		"skip/IMG_20240115_1030.jpg": {Data: []byte{0xFF, 0xD8, 0xFF, 0xD9}},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	fix := &DateFix{Offset: time.Hour, Except: []string{"skip/*"}, FileNames: domain.DefaultFilenameDateRules()}
+
+	summary, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{FixDates: fix})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	inferred := map[string]bool{}
+	for _, result := range summary.Results {
+		inferred[result.Path] = result.DateInferred
+	}
+	if !inferred["IMG_20240115_103000.jpg"] || inferred["IMG_20240116_090000.jpg"] || inferred["VID_20240115_103000.mp4"] || inferred["skip/IMG_20240115_1030.jpg"] {
+		t.Errorf("Expected only IMG_20240115_103000.jpg to get its date from the file name, got %v", inferred)
+	}
+	// The offset applies to dates from file names too, and EXIF dates win over file names
+	if !strings.Contains(mediaRepo.contents["IMG_20240115_103000.jpg"], "2024:01:15 11:30:00") {
+		t.Error("Expected the corrected date from the file name in the upload")
+	}
+	if !strings.Contains(mediaRepo.contents["IMG_20240116_090000.jpg"], "2024:04:01 01:15:00") {
+		t.Error("Expected the corrected EXIF date in the upload")
+	}
+
+	// Without an offset, photos that have an EXIF date are uploaded as they are
+	results, err := useCase.PreviewDateFix(fsys, DateFix{FileNames: domain.DefaultFilenameDateRules()})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, result := range results {
+		if result.Path == "IMG_20240116_090000.jpg" && (result.Inferred || !result.Taken.Equal(result.Corrected)) {
+			t.Errorf("Expected the EXIF date of %s unchanged, got %+v", result.Path, result)
+		}
+	}
+}
+
+// MockExifRepository is a mock implementation for testing
+type MockExifRepository struct {
+	exif map[string]domain.ExifData
+}
+
+func (m *MockExifRepository) SaveExif(data []domain.ExifData) error {
+	if m.exif == nil {
+		m.exif = make(map[string]domain.ExifData)
+	}
+	for _, exif := range data {
+		m.exif[exif.MediaItemID] = exif
+	}
+	return nil
+}
+
+func (m *MockExifRepository) LoadExif() (map[string]domain.ExifData, error) {
+	return m.exif, nil
+}
+
+func TestUploadUseCase_UploadDirectoryExif(t *testing.T) {
+	fsys := fstest.MapFS{
+		"paris.jpg":  {Data: gpsJPEG("Canon", "EOS R6", 48.8584, 2.2945)},
+		"dated.jpg":  {Data: exifJPEG("2024:04:01 00:15:00", "+01:00")},
+		"clip.mp4":   {Data: []byte("video")},
+		"broken.jpg": {Data: gpsJPEG("Canon", "EOS R6", 48.8584, 2.2945)},
+	}
+	mediaRepo := &MockMediaItemRepository{failUpload: map[string]bool{"broken.jpg": true}}
+	exif := &MockExifRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	useCase.SetExifRepository(exif)
+	opts := UploadOptions{Description: `{{.Name}}{{with .Camera}} by {{.}}{{end}}{{with .Location}} at {{.}}{{end}}`}
+
+	summary, err := useCase.UploadDirectory(context.Background(), fsys, opts)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Failed() != 1 {
+		t.Errorf("Expected broken.jpg to fail, got %d failures", summary.Failed())
+	}
+	// Only uploaded media items with EXIF data are recorded
+	if len(exif.exif) != 2 {
+		t.Fatalf("Expected EXIF data of 2 media items, got %+v", exif.exif)
+	}
+	paris := exif.exif["id-paris.jpg"]
+	if paris.Path != "paris.jpg" || paris.CameraModel != "EOS R6" || paris.Location == nil {
+		t.Errorf("Expected the camera and location of paris.jpg, got %+v", paris)
+	}
+	if taken := exif.exif["id-dated.jpg"].Taken; !taken.Equal(time.Date(2024, 3, 31, 23, 15, 0, 0, time.UTC)) {
+		t.Errorf("Expected the capture time of dated.jpg, got %s", taken)
+	}
+
+	descriptions := map[string]string{}
+	for _, batch := range mediaRepo.batches {
+		for _, item := range batch {
+			descriptions[item.FileName] = item.Description
+		}
+	}
+	want := map[string]string{"paris.jpg": "paris by Canon EOS R6 at 48.85840,2.29450", "dated.jpg": "dated", "clip.mp4": "clip"}
+	if !maps.Equal(descriptions, want) {
+		t.Errorf("Expected descriptions %v, got %v", want, descriptions)
+	}
+
+	if _, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{Description: "{{.Name"}); !errors.Is(err, domain.ErrInvalidArgument) {
+		t.Errorf("Expected an invalid template to be rejected, got %v", err)
+	}
+}
+
+func TestUploadUseCase_UploadDirectoryThumbnails(t *testing.T) {
+	fsys := fstest.MapFS{
+		"beach.jpg":  {Data: []byte("beach")},
+		"clip.mp4":   {Data: []byte("video")},
+		"phone.heic": {Data: []byte("phone")},
+		"failed.jpg": {Data: []byte("failed")},
+	}
+	mediaRepo := &MockMediaItemRepository{failUpload: map[string]bool{"failed.jpg": true}}
+	thumbs := &MockThumbnailCache{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	useCase.SetThumbnails(stubThumbnailer{}, thumbs)
+
+	if _, err := useCase.UploadDirectory(context.Background(), fsys, UploadOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Videos, files the thumbnailer cannot read and failed uploads have no thumbnail
+	if len(thumbs.thumbs) != 1 || string(thumbs.thumbs["id-beach.jpg"]) != "256:beach" {
+		t.Errorf("Expected only the thumbnail of beach.jpg at the gallery size, got %q", thumbs.thumbs)
+	}
+}
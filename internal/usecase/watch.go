@@ -0,0 +1,321 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+const (
+	// defaultWatchInterval is how often a watched folder is scanned when no interval is given
+	defaultWatchInterval = 5 * time.Second
+	// defaultWatchSettle is how long a file must stay unchanged before it is taken as completely
+	// written; cameras and sync tools take several seconds to copy a large video
+	defaultWatchSettle = 10 * time.Second
+	// maxWatchAttempts bounds the uploads of a file that keeps failing, until it changes
+	maxWatchAttempts = 3
+)
+
+// WatchOptions configures watching a folder for new photos and videos
+type WatchOptions struct {
+	// AlbumID adds the uploaded items to an existing app-created album
+	AlbumID string
+	// AlbumTitle adds the uploaded items to the app-created album of this title, which is created
+	// if there is none; ignored when AlbumID is set
+	AlbumTitle string
+	// Workers is the number of concurrent uploads; values below 1 use the default
+	Workers int
+	// Notifier reports changes below the folder, which is then only scanned after one and when a
+	// changed file may have settled; without it the folder is scanned every Interval
+	Notifier domain.FolderNotifier
+	// Interval is how often the folder is scanned without a Notifier; values below 1 use the default
+	Interval time.Duration
+	// Settle is how long the size and modification time of a file must stay the same before it
+	// is uploaded, so files still being written are left alone; values below 1 use the default
+	Settle time.Duration
+}
+
+// fileState is the size and modification time of a file when it was scanned
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+// changingFile is a file that has not been unchanged for long enough yet
+type changingFile struct {
+	fileState
+	since time.Time
+	// attempts counts the failed uploads of this state of the file
+	attempts int
+}
+
+// folderWatch is what watching a folder remembers between scans
+type folderWatch struct {
+	// changing holds the files waiting to settle, and failed ones waiting to be tried again
+	changing map[string]changingFile
+	// handled holds the state of files that were uploaded, skipped as uploaded before or gave up
+	// on; they are only looked at again once they change
+	handled map[string]fileState
+}
+
+func newFolderWatch() *folderWatch {
+	return &folderWatch{changing: make(map[string]changingFile), handled: make(map[string]fileState)}
+}
+
+// SetUploadedFiles records the files Watch uploads, so they are not uploaded again after a restart
+func (uc *UploadUseCase) SetUploadedFiles(uploaded domain.UploadedFileRepository) {
+	uc.uploaded = uploaded
+}
+
+// Close releases the record of uploaded files, if there is one
+func (uc *UploadUseCase) Close() error {
+	if uc.uploaded == nil {
+		return nil
+	}
+	return uc.uploaded.Close()
+}
+
+// Watch uploads the photos and videos that appear below the root of fsys until ctx is cancelled.
+// The folder is scanned when opts.Notifier reports a change, or every opts.Interval without one,
+// and a file is uploaded once it stayed unchanged for opts.Settle, so partial writes are never sent. Uploaded files are recorded by the checksum of
+// their content, which makes a restart skip them even when they were renamed or moved. The
+// outcome of every upload is passed to report; failed uploads are tried again a few times.
+func (uc *UploadUseCase) Watch(ctx context.Context, fsys fs.FS, opts WatchOptions, report func(UploadResult)) error {
+	if uc.uploaded == nil {
+		return errors.New("no record of uploaded files configured")
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	settle := opts.Settle
+	if settle <= 0 {
+		settle = defaultWatchSettle
+	}
+
+	albumID, err := uc.watchAlbum(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	var changes <-chan struct{}
+	if opts.Notifier != nil {
+		changes = opts.Notifier.Changes()
+		uc.log().Info("Watching folder for new photos and videos", "album_id", albumID)
+	} else {
+		uc.log().Info("Watching folder for new photos and videos", "album_id", albumID, "interval", interval)
+	}
+	watch := newFolderWatch()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		case <-timer.C:
+		}
+
+		// A folder that is gone for a while, such as an unmounted memory card, is scanned again later
+		now := time.Now()
+		if err := uc.scanWatched(ctx, fsys, watch, albumID, opts, now, report); err != nil {
+			uc.log().Warn("Failed to scan watched folder", "error", err)
+		}
+		timer.Stop()
+		timer.Reset(nextWatchScan(watch, opts.Notifier != nil, interval, settle, now))
+	}
+}
+
+// nextWatchScan returns how long after now the folder is scanned again without a change being
+// reported: after interval when polling, or when the first changing file may have settled
+func nextWatchScan(watch *folderWatch, notified bool, interval, settle time.Duration, now time.Time) time.Duration {
+	if !notified {
+		return interval
+	}
+	next := time.Duration(-1)
+	for _, file := range watch.changing {
+		if wait := max(file.since.Add(settle).Sub(now), 0); next < 0 || wait < next {
+			next = wait
+		}
+	}
+	if next < 0 {
+		// Nothing is waiting to settle, so only a change needs a scan; a day keeps the timer armed
+		return 24 * time.Hour
+	}
+	return next
+}
+
+// watchAlbum returns the ID of the album uploads go to: opts.AlbumID, the app-created album titled
+// opts.AlbumTitle, which is created if needed, or "" for none
+func (uc *UploadUseCase) watchAlbum(ctx context.Context, opts WatchOptions) (string, error) {
+	if opts.AlbumID != "" || opts.AlbumTitle == "" {
+		return opts.AlbumID, nil
+	}
+	album, _, err := uc.albums.CreateAlbumIfNotExists(ctx, opts.AlbumTitle, true)
+	if err != nil {
+		return "", err
+	}
+	return album.ID, nil
+}
+
+// scanWatched looks at the files below the root of fsys at time now and uploads those that have
+// settled since earlier scans
+func (uc *UploadUseCase) scanWatched(ctx context.Context, fsys fs.FS, watch *folderWatch, albumID string, opts WatchOptions, now time.Time, report func(UploadResult)) error {
+	settle := opts.Settle
+	if settle <= 0 {
+		settle = defaultWatchSettle
+	}
+
+	files, _, err := findMediaFiles(fsys)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(files))
+	settled := make(map[string]changingFile)
+	var names []string
+	for _, name := range files {
+		present[name] = true
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			// Removed since the folder was listed
+			continue
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if handled, ok := watch.handled[name]; ok && handled.equal(state) {
+			continue
+		}
+		changing, ok := watch.changing[name]
+		if !ok || !changing.equal(state) {
+			watch.changing[name] = changingFile{fileState: state, since: now}
+			continue
+		}
+		if now.Sub(changing.since) < settle {
+			continue
+		}
+		settled[name] = changing
+		names = append(names, name)
+	}
+
+	// A file that was deleted is looked at afresh when one of the same name appears
+	for name := range watch.changing {
+		if !present[name] {
+			delete(watch.changing, name)
+		}
+	}
+	for name := range watch.handled {
+		if !present[name] {
+			delete(watch.handled, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+	return uc.uploadSettled(ctx, fsys, watch, names, settled, albumID, opts, now, report)
+}
+
+// uploadSettled uploads the settled files names that were not uploaded before and records them
+func (uc *UploadUseCase) uploadSettled(ctx context.Context, fsys fs.FS, watch *folderWatch, names []string, settled map[string]changingFile, albumID string, opts WatchOptions, now time.Time, report func(UploadResult)) error {
+	var files, sums []string
+	batch := make(map[string]bool)
+	for _, name := range names {
+		sum, err := fsChecksum(fsys, name)
+		if err != nil {
+			uc.log().Warn("Failed to read file", "file", name, "error", err)
+			uc.retryWatched(watch, name, settled[name], now)
+			report(UploadResult{Path: name, Error: err.Error()})
+			continue
+		}
+		previous, err := uc.uploaded.LoadUploaded(sum)
+		if err != nil {
+			return err
+		}
+		if previous != nil || batch[sum] {
+			uc.log().Debug("Skipping file that was uploaded before", "file", name)
+			delete(watch.changing, name)
+			watch.handled[name] = settled[name].fileState
+			continue
+		}
+		batch[sum] = true
+		files, sums = append(files, name), append(sums, sum)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	uc.log().Info("Uploading new files", "files", len(files))
+	results := make([]UploadResult, len(files))
+	tokens, exif := uc.uploadFiles(ctx, fsys, files, UploadOptions{Workers: opts.Workers}, results, false)
+	uc.createMediaItems(albumID, files, tokens, nil, results)
+	uc.recordExif(files, exif, results)
+	uc.cacheThumbnails(ctx, fsys, opts.Workers, results)
+
+	// Every media item created is recorded, even once ctx is cancelled, so the next run does not
+	// upload it again
+	for i, result := range results {
+		name := files[i]
+		if result.Error != "" {
+			if ctx.Err() != nil {
+				// Files that were not sent are picked up by the next run
+				continue
+			}
+			uc.retryWatched(watch, name, settled[name], now)
+			report(result)
+			continue
+		}
+		delete(watch.changing, name)
+		watch.handled[name] = settled[name].fileState
+		err := uc.uploaded.SaveUploaded(domain.UploadedFile{
+			SHA256:      sums[i],
+			Path:        name,
+			Size:        settled[name].size,
+			MediaItemID: result.MediaItemID,
+			UploadedAt:  now.UTC(),
+		})
+		if err != nil {
+			uc.log().Warn("Failed to record uploaded file, it may be uploaded again after a restart", "file", name, "error", err)
+		}
+		report(result)
+	}
+	return nil
+}
+
+// retryWatched lets a file that failed be tried again after it settles once more, until it has
+// failed maxWatchAttempts times
+func (uc *UploadUseCase) retryWatched(watch *folderWatch, name string, file changingFile, now time.Time) {
+	file.attempts++
+	if file.attempts >= maxWatchAttempts {
+		uc.log().Warn("Giving up on file until it changes", "file", name, "attempts", file.attempts)
+		delete(watch.changing, name)
+		watch.handled[name] = file.fileState
+		return
+	}
+	file.since = now
+	watch.changing[name] = file
+}
+
+// fsChecksum returns the SHA-256 of the file name in fsys in hex
+func fsChecksum(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+)
+
+// MockUploadedFileRepository is a mock implementation for testing
+type MockUploadedFileRepository struct {
+	files map[string]domain.UploadedFile
+}
+
+func (m *MockUploadedFileRepository) LoadUploaded(sha256 string) (*domain.UploadedFile, error) {
+	if file, ok := m.files[sha256]; ok {
+		return &file, nil
+	}
+	return nil, nil
+}
+
+func (m *MockUploadedFileRepository) SaveUploaded(file domain.UploadedFile) error {
+	if m.files == nil {
+		m.files = make(map[string]domain.UploadedFile)
+	}
+	m.files[file.SHA256] = file
+	return nil
+}
+
+func (m *MockUploadedFileRepository) Close() error {
+	return nil
+}
+
+func TestUploadUseCase_ScanWatched(t *testing.T) {
+	start := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"DCIM/a.jpg":  {Data: []byte("a"), ModTime: start},
+		"DCIM/b.mov":  {Data: []byte("b"), ModTime: start},
+		"DCIM/notes":  {Data: []byte("n"), ModTime: start},
+		"DCIM/.a.tmp": {Data: []byte("t"), ModTime: start},
+	}
+	mediaRepo := &MockMediaItemRepository{}
+	uploaded := &MockUploadedFileRepository{}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	useCase.SetUploadedFiles(uploaded)
+	opts := WatchOptions{Settle: 10 * time.Second}
+
+	var reported []UploadResult
+	report := func(result UploadResult) { reported = append(reported, result) }
+	scan := func(watch *folderWatch, at time.Time) {
+		t.Helper()
+		if err := useCase.scanWatched(context.Background(), fsys, watch, "album-1", opts, at, report); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// New files are only seen on the first scan; the video is still being written on the second
+	watch := newFolderWatch()
+	scan(watch, start)
+	fsys["DCIM/b.mov"] = &fstest.MapFile{Data: []byte("bb"), ModTime: start.Add(5 * time.Second)}
+	scan(watch, start.Add(10*time.Second))
+	if len(reported) != 1 || reported[0].Path != "DCIM/a.jpg" || reported[0].MediaItemID != "id-a.jpg" {
+		t.Fatalf("Expected only the settled photo to be uploaded, got %+v", reported)
+	}
+	if mediaRepo.albumID != "album-1" {
+		t.Errorf("Expected the photo to be added to the album, got %q", mediaRepo.albumID)
+	}
+
+	scan(watch, start.Add(20*time.Second))
+	if len(reported) != 2 || reported[1].Path != "DCIM/b.mov" {
+		t.Fatalf("Expected the video to be uploaded once it settled, got %+v", reported)
+	}
+	scan(watch, start.Add(30*time.Second))
+	if len(mediaRepo.uploaded) != 2 || len(uploaded.files) != 2 {
+		t.Errorf("Expected each file to be uploaded and recorded once, got %v and %d records", mediaRepo.uploaded, len(uploaded.files))
+	}
+
+	// After a restart the files, even renamed, are recognized by their content
+	delete(fsys, "DCIM/a.jpg")
+	fsys["DCIM/renamed.jpg"] = &fstest.MapFile{Data: []byte("a"), ModTime: start}
+	restarted := newFolderWatch()
+	scan(restarted, start.Add(time.Minute))
+	scan(restarted, start.Add(2*time.Minute))
+	if len(mediaRepo.uploaded) != 2 || len(reported) != 2 {
+		t.Errorf("Expected nothing to be uploaded again after a restart, got %v", mediaRepo.uploaded)
+	}
+}
+
+func TestUploadUseCase_ScanWatchedRetries(t *testing.T) {
+	start := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"bad.jpg": {Data: []byte("x"), ModTime: start}}
+	mediaRepo := &MockMediaItemRepository{failUpload: map[string]bool{"bad.jpg": true}}
+	useCase := NewUploadUseCase(mediaRepo, &MockAlbumRepository{})
+	useCase.SetUploadedFiles(&MockUploadedFileRepository{})
+
+	failures := 0
+	watch := newFolderWatch()
+	for i := range 10 {
+		err := useCase.scanWatched(context.Background(), fsys, watch, "", WatchOptions{}, start.Add(time.Duration(i)*defaultWatchSettle), func(result UploadResult) {
+			if result.Error != "" {
+				failures++
+			}
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if failures != maxWatchAttempts {
+		t.Errorf("Expected %d attempts before giving up, got %d", maxWatchAttempts, failures)
+	}
+}
+
+func TestUploadUseCase_WatchAlbumReusesTitle(t *testing.T) {
+	albums := &MockAlbumRepository{albums: []domain.Album{
+		{ID: "shared", Title: "Phone"},
+		{ID: "own", Title: "Phone", IsWriteable: true},
+	}}
+	useCase := NewUploadUseCase(&MockMediaItemRepository{}, albums)
+
+	albumID, err := useCase.watchAlbum(context.Background(), WatchOptions{AlbumTitle: "Phone"})
+	if err != nil || albumID != "own" {
+		t.Errorf("Expected the app-created album to be reused, got %q (%v)", albumID, err)
+	}
+	albumID, err = useCase.watchAlbum(context.Background(), WatchOptions{AlbumTitle: "Tablet"})
+	if err != nil || albumID != "test-id" {
+		t.Errorf("Expected a missing album to be created, got %q (%v)", albumID, err)
+	}
+}
+
+// cancellingMediaRepository cancels the watch once media items are created, as Ctrl-C right then
+type cancellingMediaRepository struct {
+	*MockMediaItemRepository
+	cancel context.CancelFunc
+}
+
+func (m *cancellingMediaRepository) BatchCreateMediaItems(albumID string, items []domain.NewMediaItem) ([]domain.NewMediaItemResult, error) {
+	defer m.cancel()
+	return m.MockMediaItemRepository.BatchCreateMediaItems(albumID, items)
+}
+
+func TestUploadUseCase_ScanWatchedRecordsUploadsWhenCancelled(t *testing.T) {
+	start := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"a.jpg": {Data: []byte("a"), ModTime: start}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	uploaded := &MockUploadedFileRepository{}
+	useCase := NewUploadUseCase(&cancellingMediaRepository{MockMediaItemRepository: &MockMediaItemRepository{}, cancel: cancel}, &MockAlbumRepository{})
+	useCase.SetUploadedFiles(uploaded)
+
+	watch := newFolderWatch()
+	for _, at := range []time.Time{start, start.Add(defaultWatchSettle)} {
+		if err := useCase.scanWatched(ctx, fsys, watch, "", WatchOptions{}, at, func(UploadResult) {}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if ctx.Err() == nil {
+		t.Fatal("Expected the watch to be cancelled while creating media items")
+	}
+	if len(uploaded.files) != 1 {
+		t.Errorf("Expected the media item created before the cancellation to be recorded, got %v", uploaded.files)
+	}
+}
+
+func TestNextWatchScan(t *testing.T) {
+	now := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	watch := newFolderWatch()
+
+	if got := nextWatchScan(watch, false, time.Second, time.Minute, now); got != time.Second {
+		t.Errorf("Expected polling every interval, got %v", got)
+	}
+	if got := nextWatchScan(watch, true, time.Second, time.Minute, now); got < time.Hour {
+		t.Errorf("Expected no scan without changes or files settling, got %v", got)
+	}
+
+	watch.changing["a.jpg"] = changingFile{since: now.Add(-40 * time.Second)}
+	watch.changing["b.jpg"] = changingFile{since: now.Add(-10 * time.Second)}
+	if got := nextWatchScan(watch, true, time.Second, time.Minute, now); got != 20*time.Second {
+		t.Errorf("Expected a scan once the first file may have settled, got %v", got)
+	}
+}
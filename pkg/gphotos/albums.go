@@ -0,0 +1,87 @@
+package gphotos
+
+import (
+	"context"
+	"iter"
+
+	"krupesh.faldu/internal/usecase"
+)
+
+// AlbumsService lists, creates and changes the albums of the account
+type AlbumsService struct {
+	albums *usecase.AlbumUseCase
+}
+
+// All iterates over every album, fetching pages as iteration goes on. An error ends iteration.
+func (s *AlbumsService) All(ctx context.Context) iter.Seq2[Album, error] {
+	return s.albums.Albums(ctx, ListOptions{})
+}
+
+// AllWithOptions is All with pages of opts.PageSize, at most MaxAlbumPageSize, with
+// opts.Prefetch the next page fetched while the caller handles the current one, and with
+// opts.Fields only those fields of every album fetched
+func (s *AlbumsService) AllWithOptions(ctx context.Context, opts ListOptions) iter.Seq2[Album, error] {
+	return s.albums.Albums(ctx, opts)
+}
+
+// List returns every album
+func (s *AlbumsService) List(ctx context.Context) ([]Album, error) {
+	return s.albums.ListAllAlbums(ctx, ListOptions{})
+}
+
+// ListWithOptions is List walking the pages as opts asks, like AllWithOptions
+func (s *AlbumsService) ListWithOptions(ctx context.Context, opts ListOptions) ([]Album, error) {
+	return s.albums.ListAllAlbums(ctx, opts)
+}
+
+// Find returns the albums whose title matches pattern, a regular expression unless filter.Match
+// says otherwise, leaving out those filter excludes
+func (s *AlbumsService) Find(ctx context.Context, pattern string, filter AlbumFilter) ([]Album, error) {
+	return s.albums.FindAlbums(ctx, pattern, filter)
+}
+
+// ListPage returns a single page of albums; req.PageSize may be at most MaxAlbumPageSize. With
+// req.Fields only those fields of every album are fetched, such as "id,title,mediaItemsCount".
+func (s *AlbumsService) ListPage(ctx context.Context, req PageRequest) (*Page[Album], error) {
+	return s.albums.ListAlbums(ctx, req)
+}
+
+// Get returns the album with the given ID
+func (s *AlbumsService) Get(ctx context.Context, id string) (*Album, error) {
+	return s.albums.GetAlbumByID(ctx, id)
+}
+
+// GetFields returns only the given fields of the album with the given ID, such as
+// "id,mediaItemsCount", leaving the others zero
+func (s *AlbumsService) GetFields(ctx context.Context, id, fields string) (*Album, error) {
+	return s.albums.GetAlbumFields(ctx, id, fields)
+}
+
+// Create creates an album owned by this app
+func (s *AlbumsService) Create(ctx context.Context, title string) (*Album, error) {
+	return s.albums.CreateAlbum(ctx, title)
+}
+
+// CreateIfNotExists returns the album titled exactly title, creating it only when there is none;
+// with appCreatedOnly, albums this app cannot change do not count. The result reports whether the
+// album was created.
+func (s *AlbumsService) CreateIfNotExists(ctx context.Context, title string, appCreatedOnly bool) (*Album, bool, error) {
+	return s.albums.CreateAlbumIfNotExists(ctx, title, appCreatedOnly)
+}
+
+// Update changes the title and cover photo of an album created by this app; empty values are left
+// unchanged
+func (s *AlbumsService) Update(ctx context.Context, id, title, coverPhotoMediaItemID string) (*Album, error) {
+	return s.albums.UpdateAlbum(ctx, id, title, coverPhotoMediaItemID)
+}
+
+// AddMediaItems adds media items to an album created by this app, in as many requests as needed
+func (s *AlbumsService) AddMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return s.albums.AddMediaItems(ctx, albumID, mediaItemIDs)
+}
+
+// RemoveMediaItems removes media items from an album created by this app, in as many requests as
+// needed
+func (s *AlbumsService) RemoveMediaItems(ctx context.Context, albumID string, mediaItemIDs []string) error {
+	return s.albums.RemoveMediaItems(ctx, albumID, mediaItemIDs)
+}
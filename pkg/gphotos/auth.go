@@ -0,0 +1,163 @@
+package gphotos
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/repository"
+	"krupesh.faldu/internal/usecase"
+)
+
+// DefaultScopes are the OAuth scopes requested when AuthOptions has none
+var DefaultScopes = domain.DefaultScopes
+
+// Access is a kind of operation on the library; pass ScopesFor the ones in use as
+// AuthOptions.Scopes so the token grants no more
+type Access = domain.Access
+
+// Kinds of access to the library
+const (
+	AccessRead   = domain.AccessRead
+	AccessUpload = domain.AccessUpload
+	AccessEdit   = domain.AccessEdit
+	AccessShare  = domain.AccessShare
+)
+
+// ScopesFor returns the scopes needed for accesses
+func ScopesFor(accesses []Access) []string {
+	return domain.ScopesFor(accesses)
+}
+
+// ErrNotLoggedIn is returned by Auth.HTTPClient when no token has been saved yet
+var ErrNotLoggedIn = domain.ErrNotLoggedIn
+
+// AuthOptions configures Auth
+type AuthOptions struct {
+	// Scopes are requested at login; when empty, DefaultScopes are requested
+	Scopes []string
+	// CallbackAddr is where Login listens for the browser to return; when it is empty or taken,
+	// localhost:8080 or a free port on the same host is used
+	CallbackAddr string
+	// Timeout bounds how long Login waits for the browser; zero uses ten minutes
+	Timeout time.Duration
+	// HTTPTimeout bounds each API request made with the client from HTTPClient; zero means none
+	HTTPTimeout time.Duration
+	// DialTimeout and TLSHandshakeTimeout bound connecting to the API; zero keeps the defaults of
+	// net/http
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	// Proxy is the URL of the http, https or socks5 proxy API requests go through; when empty,
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY decide
+	Proxy string
+	// Transport sends the requests of the client from HTTPClient, including token refreshes,
+	// beneath the OAuth token; when set, DialTimeout, TLSHandshakeTimeout and Proxy are ignored
+	Transport http.RoundTripper
+	// Logger receives the login progress and the URLs to open; when nil, slog.Default() is used
+	Logger *slog.Logger
+}
+
+// Auth logs in to a Google account with the OAuth client in a credentials file and keeps the
+// token in a token file, refreshing it as needed
+type Auth struct {
+	service     domain.OAuthService
+	oauth       *usecase.OAuthUseCase
+	httpTimeout time.Duration
+	transport   http.RoundTripper
+}
+
+// NewAuth creates a new Auth for the OAuth client in credentialsPath, a client secrets file
+// downloaded from the Google Cloud console, saving the token to tokenPath
+func NewAuth(credentialsPath, tokenPath string, opts AuthOptions) (*Auth, error) {
+	transport := opts.Transport
+	if transport == nil {
+		var err error
+		if transport, err = repository.NewHTTPTransport(repository.TransportOptions{
+			DialTimeout:         opts.DialTimeout,
+			TLSHandshakeTimeout: opts.TLSHandshakeTimeout,
+			Proxy:               opts.Proxy,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	service, err := repository.NewOAuthRepositoryWithOptions(domain.Profile{
+		CredentialsPath: credentialsPath,
+		TokenPath:       tokenPath,
+	}, repository.OAuthOptions{
+		Scopes:       opts.Scopes,
+		CallbackAddr: opts.CallbackAddr,
+		Transport:    transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuth(service, transport, opts), nil
+}
+
+// NewAuthWithService creates a new Auth keeping the OAuth client and token with service instead
+// of in files, such as the fake of package gphotostest in tests. The client from HTTPClient sends
+// its requests with opts.Transport, or http.DefaultTransport when it is nil.
+func NewAuthWithService(service OAuthService, opts AuthOptions) *Auth {
+	return newAuth(service, cmp.Or[http.RoundTripper](opts.Transport, http.DefaultTransport), opts)
+}
+
+// newAuth builds an Auth on service sending requests with transport
+func newAuth(service OAuthService, transport http.RoundTripper, opts AuthOptions) *Auth {
+	oauth := usecase.NewOAuthUseCase(service)
+	oauth.SetLogger(opts.Logger)
+	oauth.SetCallbackServerConfig(usecase.CallbackServerConfig{Addr: opts.CallbackAddr, Timeout: opts.Timeout})
+	return &Auth{
+		service:     service,
+		oauth:       oauth,
+		httpTimeout: opts.HTTPTimeout,
+		transport:   transport,
+	}
+}
+
+// SetURLPresenter registers fn to be called with every URL the user is asked to open, e.g. to
+// show it as a QR code; nil only logs them
+func (a *Auth) SetURLPresenter(fn func(url string)) {
+	a.oauth.SetURLPresenter(fn)
+}
+
+// Login asks the user to open the consent page in a browser and waits for it to return to a
+// local server, then saves the token
+func (a *Auth) Login(ctx context.Context) error {
+	return a.oauth.CompleteAuthenticationWithServer(ctx)
+}
+
+// LoginHeadless asks the user to open the consent page on any device and to paste the code, or
+// the address the browser was sent back to, into input; for machines that cannot receive the
+// redirect
+func (a *Auth) LoginHeadless(input io.Reader) error {
+	return a.oauth.CompleteAuthenticationHeadless(input)
+}
+
+// HTTPClient returns a client that adds the saved token to every request and refreshes it when
+// it expires; pass it to NewClient. It fails with ErrNotLoggedIn before the first login.
+func (a *Auth) HTTPClient(ctx context.Context) (*http.Client, error) {
+	config, err := a.service.GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := a.service.LoadToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotLoggedIn, err)
+	}
+
+	// Token refreshes go through the same transport and timeout as API requests
+	base := &http.Client{Transport: a.transport, Timeout: a.httpTimeout}
+	client := config.Client(context.WithValue(ctx, oauth2.HTTPClient, base), token)
+	client.Timeout = a.httpTimeout
+	return client, nil
+}
@@ -0,0 +1,202 @@
+// Package gphotos is a Google Photos Library API client for Go programs. It is what the gpm
+// command line tool is built on: Auth logs in and keeps the token of a Google account, and Client
+// works with albums, media items and uploads with the same retries, pagination and batching.
+//
+//	auth, err := gphotos.NewAuth("credentials.json", "token.json", gphotos.AuthOptions{})
+//	...
+//	httpClient, err := auth.HTTPClient(ctx)
+//	...
+//	client := gphotos.NewClient(httpClient, gphotos.Options{})
+//	for album, err := range client.Albums.All(ctx) {
+//		...
+//	}
+//
+// The entities and errors are aliases of those the CLI uses, so values pass between both without
+// conversion. The options, results and events of operations are types of this package, so changes
+// to the CLI do not change them.
+package gphotos
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/repository"
+	"krupesh.faldu/internal/usecase"
+)
+
+// Entities of the Google Photos Library API
+type (
+	Album              = domain.Album
+	MediaItem          = domain.MediaItem
+	MediaMetadata      = domain.MediaMetadata
+	PhotoMetadata      = domain.PhotoMetadata
+	VideoMetadata      = domain.VideoMetadata
+	MediaType          = domain.MediaType
+	Status             = domain.Status
+	NewMediaItem       = domain.NewMediaItem
+	NewMediaItemResult = domain.NewMediaItemResult
+	MediaItemResult    = domain.MediaItemResult
+	SearchFilters      = domain.SearchFilters
+	DateRange          = domain.DateRange
+	ImageSize          = domain.ImageSize
+	PageRequest        = domain.PageRequest
+	ListOptions        = domain.ListOptions
+	AlbumFilter        = domain.AlbumFilter
+	TitleMatch         = domain.TitleMatch
+	APIError           = domain.APIError
+	// Progress receives ProgressUpdates of jobs such as JobUpload; NopProgress ignores them
+	Progress       = domain.Progress
+	ProgressUpdate = domain.ProgressUpdate
+	NopProgress    = domain.NopProgress
+	// Tracer records operations such as "album.list" and "upload.file" as spans of a trace,
+	// e.g. through an adapter to an OpenTelemetry tracer
+	Tracer = domain.Tracer
+	Span   = domain.Span
+)
+
+// Interfaces a Client and Auth are built on; NewClientWithRepositories and NewAuthWithService
+// take other implementations of them, such as the in-memory fakes of package gphotostest
+type (
+	AlbumRepository     = domain.AlbumRepository
+	MediaItemRepository = domain.MediaItemRepository
+	OAuthService        = domain.OAuthService
+	PositionType        = domain.PositionType
+)
+
+// Album positions of new enrichments, as in AlbumRepository.AddTextEnrichment
+const (
+	PositionFirstInAlbum = domain.PositionFirstInAlbum
+	PositionLastInAlbum  = domain.PositionLastInAlbum
+)
+
+// Ways AlbumFilter compares album titles with the pattern of Albums.Find
+const (
+	TitleExact     = domain.TitleExact
+	TitleSubstring = domain.TitleSubstring
+	TitleRegex     = domain.TitleRegex
+)
+
+// Kinds of media items SearchFilters.MediaType selects
+const (
+	MediaTypeAll   = domain.MediaTypeAll
+	MediaTypePhoto = domain.MediaTypePhoto
+	MediaTypeVideo = domain.MediaTypeVideo
+)
+
+// Kinds of jobs reporting progress
+const (
+	JobUpload   = domain.JobUpload
+	JobDownload = domain.JobDownload
+)
+
+// Page is a single page of a list together with the token of the following page
+type Page[T any] = domain.Page[T]
+
+// Maximum page sizes accepted by the list endpoints, and number of media items per batch request
+const (
+	MaxAlbumPageSize     = domain.MaxAlbumPageSize
+	MaxMediaItemPageSize = domain.MaxMediaItemPageSize
+	MaxBatchMediaItems   = domain.MaxBatchMediaItems
+)
+
+// Kinds of API failures. Calls return *APIError, which matches the kinds that apply to it with
+// errors.Is, e.g. errors.Is(err, gphotos.ErrNotFound).
+var (
+	ErrNotFound          = domain.ErrNotFound
+	ErrRateLimited       = domain.ErrRateLimited
+	ErrInsufficientScope = domain.ErrInsufficientScope
+	ErrPermissionDenied  = domain.ErrPermissionDenied
+	ErrUnauthenticated   = domain.ErrUnauthenticated
+	ErrInvalidArgument   = domain.ErrInvalidArgument
+)
+
+// Options configures a Client
+type Options struct {
+	// StrictDecoding fails responses containing fields this package does not know about
+	StrictDecoding bool
+	// UploadSessionDir keeps resumable upload sessions so an interrupted upload can continue in
+	// a later run; when empty, they are only resumed within the same run
+	UploadSessionDir string
+	// Logger receives retries, skipped items and failures; when nil, slog.Default() is used
+	Logger *slog.Logger
+	// Progress receives the progress of uploads and downloads as their files finish; when nil,
+	// progress is not reported
+	Progress Progress
+	// MaxRPS bounds the requests a second of the client to stay within the API quotas; 0 means
+	// no limit
+	MaxRPS float64
+	// Burst is how many requests may go at once after a pause before MaxRPS paces them; it is at
+	// least 1
+	Burst int
+	// Tracer records the album, upload and download operations of the client; when nil, nothing
+	// is traced
+	Tracer Tracer
+}
+
+// Client calls the Google Photos Library API through an authorized HTTP client
+type Client struct {
+	Albums     *AlbumsService
+	MediaItems *MediaItemsService
+	Uploads    *UploadsService
+
+	subscriptions *usecase.SubscriptionUseCase
+}
+
+// NewClient creates a new Client sending requests with httpClient, which must add the OAuth token
+// of the account, such as the one returned by Auth.HTTPClient
+func NewClient(httpClient *http.Client, opts Options) *Client {
+	if limiter := repository.NewRateLimiter(opts.MaxRPS, opts.Burst); limiter != nil {
+		limited := *httpClient
+		limited.Transport = repository.NewRateLimitTransport(httpClient.Transport, limiter, cmp.Or(opts.Logger, slog.Default()))
+		httpClient = &limited
+	}
+	repoOpts := repository.GooglePhotosOptions{
+		StrictDecoding: opts.StrictDecoding,
+		Logger:         opts.Logger,
+	}
+	albumRepo := repository.NewGooglePhotosRepositoryWithOptions(httpClient, repoOpts)
+	mediaRepo := repository.NewGooglePhotosMediaItemRepository(httpClient, repoOpts)
+
+	uploadOpts := repoOpts
+	if opts.UploadSessionDir != "" {
+		uploadOpts.UploadSessions = repository.NewFileUploadSessionStore(opts.UploadSessionDir)
+	}
+	uploadRepo := repository.NewGooglePhotosMediaItemRepository(httpClient, uploadOpts)
+	return newClient(albumRepo, mediaRepo, uploadRepo, opts)
+}
+
+// NewClientWithRepositories creates a new Client working with albums and mediaItems instead of
+// the API, such as the fakes of package gphotostest in tests. Of opts, StrictDecoding,
+// UploadSessionDir, MaxRPS and Burst concern requests to the API and are ignored.
+func NewClientWithRepositories(albums AlbumRepository, mediaItems MediaItemRepository, opts Options) *Client {
+	return newClient(albums, mediaItems, mediaItems, opts)
+}
+
+// newClient builds the services of a Client; uploadRepo is mediaRepo keeping resumable upload
+// sessions as opts asks
+func newClient(albumRepo AlbumRepository, mediaRepo, uploadRepo MediaItemRepository, opts Options) *Client {
+	albums := usecase.NewAlbumUseCase(albumRepo)
+	downloads := usecase.NewDownloadUseCase(mediaRepo)
+	downloads.SetAlbumRepository(albumRepo)
+	uploads := usecase.NewUploadUseCase(uploadRepo, albumRepo)
+	subscriptions := usecase.NewSubscriptionUseCase(albumRepo, mediaRepo)
+	albums.SetLogger(opts.Logger)
+	downloads.SetLogger(opts.Logger)
+	uploads.SetLogger(opts.Logger)
+	subscriptions.SetLogger(opts.Logger)
+	albums.SetTracer(opts.Tracer)
+	downloads.SetTracer(opts.Tracer)
+	uploads.SetTracer(opts.Tracer)
+	downloads.SetProgress(opts.Progress)
+	uploads.SetProgress(opts.Progress)
+
+	return &Client{
+		Albums:     &AlbumsService{albums: albums},
+		MediaItems: &MediaItemsService{repo: mediaRepo, downloads: downloads},
+		Uploads:    &UploadsService{repo: uploadRepo, uploads: uploads},
+
+		subscriptions: subscriptions,
+	}
+}
@@ -0,0 +1,144 @@
+package gphotos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc lets tests answer requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubClient returns an HTTP client that records each request and answers with what respond returns
+func stubClient(requests *[]*http.Request, respond func(*http.Request) (int, string)) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*requests = append(*requests, req)
+		code, body := respond(req)
+		return &http.Response{
+			StatusCode: code,
+			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{"Content-Type": {"application/json"}},
+		}, nil
+	})}
+}
+
+func TestClient_Albums(t *testing.T) {
+	var requests []*http.Request
+	client := NewClient(stubClient(&requests, func(req *http.Request) (int, string) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/albums/missing"):
+			return http.StatusNotFound, `{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND"}}`
+		case req.URL.Query().Get("pageToken") == "":
+			return http.StatusOK, `{"albums":[{"id":"a1","title":"Trip"}],"nextPageToken":"p2"}`
+		default:
+			return http.StatusOK, `{"albums":[{"id":"a2","title":"Home"}]}`
+		}
+	}), Options{})
+
+	albums, err := client.Albums.List(context.Background())
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(albums) != 2 || albums[0].ID != "a1" || albums[1].ID != "a2" {
+		t.Errorf("Expected the albums of both pages, got %+v", albums)
+	}
+	if _, err := client.Albums.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClient_MediaItemsBatchGet(t *testing.T) {
+	var requests []*http.Request
+	client := NewClient(stubClient(&requests, func(req *http.Request) (int, string) {
+		ids := req.URL.Query()["mediaItemIds"]
+		results := make([]string, len(ids))
+		for i, id := range ids {
+			results[i] = fmt.Sprintf(`{"mediaItem":{"id":%q}}`, id)
+		}
+		return http.StatusOK, `{"mediaItemResults":[` + strings.Join(results, ",") + `]}`
+	}), Options{})
+	ids := make([]string, MaxBatchMediaItems+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("m%d", i)
+	}
+
+	items, err := client.MediaItems.BatchGet(ids)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(requests))
+	}
+	if len(items) != len(ids) || items[len(ids)-1].ID != ids[len(ids)-1] {
+		t.Errorf("Expected %d media items in order, got %d", len(ids), len(items))
+	}
+}
+
+func TestAuth_HTTPClientNotLoggedIn(t *testing.T) {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials.json")
+	secrets := `{"installed":{"client_id":"id","client_secret":"secret","auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`
+	if err := os.WriteFile(credentials, []byte(secrets), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuth(credentials, filepath.Join(dir, "token.json"), AuthOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := auth.HTTPClient(context.Background()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+	if _, err := NewAuth(filepath.Join(dir, "missing.json"), "token.json", AuthOptions{}); err == nil {
+		t.Error("Expected an error for a missing credentials file")
+	}
+}
+
+func TestClient_Watch(t *testing.T) {
+	var requests []*http.Request
+	client := NewClient(stubClient(&requests, func(req *http.Request) (int, string) {
+		return http.StatusOK, `{"albums":[{"id":"a1","title":"Trip"}]}`
+	}), Options{})
+
+	if _, err := client.Watch(context.Background(), WatchSpec{}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected an empty spec to be rejected, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := client.Watch(ctx, WatchSpec{Albums: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cancel()
+	for event := range events {
+		t.Errorf("Expected no event before anything changed, got %+v", event)
+	}
+}
+
+func TestUploadsService_InvalidDatePattern(t *testing.T) {
+	var requests []*http.Request
+	client := NewClient(stubClient(&requests, func(*http.Request) (int, string) {
+		return http.StatusOK, `{}`
+	}), Options{})
+	fix := &DateFix{FileNamePatterns: []string{`IMG_(?P<year>\d{4})`}}
+
+	_, err := client.Uploads.UploadDirectory(context.Background(), os.DirFS(t.TempDir()), UploadOptions{FixDates: fix})
+
+	if !errors.Is(err, ErrInvalidArgument) || len(requests) != 0 {
+		t.Errorf("Expected ErrInvalidArgument before any request, got %v after %d requests", err, len(requests))
+	}
+}
@@ -0,0 +1,206 @@
+package gphotostest
+
+import (
+	"net/http"
+	"slices"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// AlbumRepository is the gphotos.AlbumRepository of a Library. Like the API, it only changes
+// albums that are writeable, which albums it creates are. Partial responses are not applied:
+// albums come whole whatever fields are asked for.
+type AlbumRepository struct {
+	lib *Library
+}
+
+var _ gphotos.AlbumRepository = (*AlbumRepository)(nil)
+
+// ListAlbums returns a page of the albums, oldest first
+func (r *AlbumRepository) ListAlbums(req gphotos.PageRequest) (*gphotos.Page[gphotos.Album], error) {
+	l := r.lib
+	err := l.call("ListAlbums")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, next, err := page(len(l.albums), req, defaultAlbumPageSize, gphotos.MaxAlbumPageSize)
+	if err != nil {
+		return nil, err
+	}
+	albums := make([]gphotos.Album, 0, end-start)
+	for i := start; i < end; i++ {
+		albums = append(albums, l.albumWithCount(i))
+	}
+	return &gphotos.Page[gphotos.Album]{Items: albums, NextPageToken: next}, nil
+}
+
+// GetAlbumByID returns one album
+func (r *AlbumRepository) GetAlbumByID(id string) (*gphotos.Album, error) {
+	l := r.lib
+	err := l.call("GetAlbumByID")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	i := l.albumIndex(id)
+	if i < 0 {
+		return nil, errNotFound()
+	}
+	album := l.albumWithCount(i)
+	return &album, nil
+}
+
+// GetAlbumFields returns one album like GetAlbumByID; the whole album is returned whatever
+// fields select
+func (r *AlbumRepository) GetAlbumFields(id, fields string) (*gphotos.Album, error) {
+	l := r.lib
+	err := l.call("GetAlbumFields")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	i := l.albumIndex(id)
+	if i < 0 {
+		return nil, errNotFound()
+	}
+	album := l.albumWithCount(i)
+	return &album, nil
+}
+
+// CreateAlbum creates a writeable album
+func (r *AlbumRepository) CreateAlbum(title string) (*gphotos.Album, error) {
+	l := r.lib
+	err := l.call("CreateAlbum")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if title == "" {
+		return nil, apiError(http.StatusBadRequest, "Request must contain an album with a title.")
+	}
+	album := l.addAlbum(gphotos.Album{Title: title, IsWriteable: true}, nil)
+	return &album, nil
+}
+
+// UpdateAlbum changes the title and/or cover photo of a writeable album; empty values are left
+// unchanged
+func (r *AlbumRepository) UpdateAlbum(id, title, coverPhotoMediaItemID string) (*gphotos.Album, error) {
+	l := r.lib
+	err := l.call("UpdateAlbum")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := l.writeableAlbum(id)
+	if err != nil {
+		return nil, err
+	}
+	if coverPhotoMediaItemID != "" && !slices.Contains(l.albumItems[id], coverPhotoMediaItemID) {
+		return nil, apiError(http.StatusBadRequest, "The cover photo must be in the album.")
+	}
+	if title != "" {
+		l.albums[i].Title = title
+	}
+	if coverPhotoMediaItemID != "" {
+		l.albums[i].CoverPhotoMediaItemID = coverPhotoMediaItemID
+	}
+	album := l.albumWithCount(i)
+	return &album, nil
+}
+
+// BatchAddMediaItems adds up to gphotos.MaxBatchMediaItems media items of the library to a
+// writeable album; those already in it stay where they are
+func (r *AlbumRepository) BatchAddMediaItems(albumID string, mediaItemIDs []string) error {
+	l := r.lib
+	err := l.call("BatchAddMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := l.checkBatch(albumID, mediaItemIDs); err != nil {
+		return err
+	}
+	for _, id := range mediaItemIDs {
+		if !slices.Contains(l.albumItems[albumID], id) {
+			l.albumItems[albumID] = append(l.albumItems[albumID], id)
+		}
+	}
+	return nil
+}
+
+// BatchRemoveMediaItems removes up to gphotos.MaxBatchMediaItems media items from a writeable
+// album
+func (r *AlbumRepository) BatchRemoveMediaItems(albumID string, mediaItemIDs []string) error {
+	l := r.lib
+	err := l.call("BatchRemoveMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := l.checkBatch(albumID, mediaItemIDs); err != nil {
+		return err
+	}
+	l.albumItems[albumID] = slices.DeleteFunc(l.albumItems[albumID], func(id string) bool {
+		return slices.Contains(mediaItemIDs, id)
+	})
+	return nil
+}
+
+// AddTextEnrichment adds a text entry at the start or the end of a writeable album
+func (r *AlbumRepository) AddTextEnrichment(albumID, text string, position gphotos.PositionType) (string, error) {
+	l := r.lib
+	err := l.call("AddTextEnrichment")
+	defer l.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := l.writeableAlbum(albumID); err != nil {
+		return "", err
+	}
+	switch position {
+	case gphotos.PositionFirstInAlbum:
+		l.enrichments[albumID] = append([]string{text}, l.enrichments[albumID]...)
+	case gphotos.PositionLastInAlbum:
+		l.enrichments[albumID] = append(l.enrichments[albumID], text)
+	default:
+		return "", apiError(http.StatusBadRequest, "Invalid album position.")
+	}
+	return l.newID("enrichment"), nil
+}
+
+// writeableAlbum returns the position of an album the app may change; l.mu must be held
+func (l *Library) writeableAlbum(id string) (int, error) {
+	i := l.albumIndex(id)
+	if i < 0 {
+		return -1, errNotFound()
+	}
+	if !l.albums[i].IsWriteable {
+		return -1, apiError(http.StatusForbidden, "No permission to change this album.")
+	}
+	return i, nil
+}
+
+// checkBatch checks a request to add media items to an album or remove them; l.mu must be held
+func (l *Library) checkBatch(albumID string, mediaItemIDs []string) error {
+	if len(mediaItemIDs) == 0 || len(mediaItemIDs) > gphotos.MaxBatchMediaItems {
+		return apiError(http.StatusBadRequest, "Request must contain between 1 and 50 media item IDs.")
+	}
+	if _, err := l.writeableAlbum(albumID); err != nil {
+		return err
+	}
+	for _, id := range mediaItemIDs {
+		if l.itemIndex(id) < 0 {
+			return apiError(http.StatusBadRequest, "Invalid media item ID.")
+		}
+	}
+	return nil
+}
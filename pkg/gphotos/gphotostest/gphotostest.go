@@ -0,0 +1,269 @@
+// Package gphotostest provides in-memory fakes of the interfaces package gphotos is built on, so
+// programs using it can be tested without a Google account or a network:
+//
+//	lib := gphotostest.NewLibrary()
+//	lib.AddAlbum(gphotos.Album{Title: "Trip"})
+//	client := gphotos.NewClientWithRepositories(lib.Albums(), lib.MediaItems(), gphotos.Options{})
+//
+// The fakes are deterministic: IDs are numbered in the order things are created, media items
+// created from uploads are taken one second apart from the start of 2024, and pages are cut the
+// way the API cuts them. Failures are *gphotos.APIError values matching the same kinds as those
+// of the API, such as gphotos.ErrNotFound.
+package gphotostest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// Page sizes the API uses when a request asks for none
+const (
+	defaultAlbumPageSize     = 20
+	defaultMediaItemPageSize = 25
+)
+
+// Codes of the per-item statuses, as in google.rpc.Code
+const (
+	codeInvalidArgument = 3
+)
+
+// epoch is when the first media item created from an upload was taken
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Library is an in-memory Google Photos library, shared by the repositories it returns. It is
+// safe for concurrent use.
+type Library struct {
+	mu          sync.Mutex
+	albums      []gphotos.Album
+	albumItems  map[string][]string
+	enrichments map[string][]string
+	items       []gphotos.MediaItem
+	contents    map[string][]byte
+	uploads     map[string]upload
+	failures    map[string]error
+	calls       []string
+	nextID      int
+	created     int
+}
+
+// upload is a file received and not yet turned into a media item
+type upload struct {
+	fileName string
+	mimeType string
+	data     []byte
+}
+
+// NewLibrary creates an empty Library
+func NewLibrary() *Library {
+	return &Library{
+		albumItems:  make(map[string][]string),
+		enrichments: make(map[string][]string),
+		contents:    make(map[string][]byte),
+		uploads:     make(map[string]upload),
+		failures:    make(map[string]error),
+	}
+}
+
+// Albums returns the albums of the library as a gphotos.AlbumRepository
+func (l *Library) Albums() *AlbumRepository {
+	return &AlbumRepository{lib: l}
+}
+
+// MediaItems returns the media items of the library as a gphotos.MediaItemRepository
+func (l *Library) MediaItems() *MediaItemRepository {
+	return &MediaItemRepository{lib: l}
+}
+
+// AddAlbum adds an album holding the media items itemIDs, giving it an ID unless it has one.
+// Albums added this way are only writeable when album.IsWriteable says so, like albums the app
+// did not create.
+func (l *Library) AddAlbum(album gphotos.Album, itemIDs ...string) gphotos.Album {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addAlbum(album, itemIDs)
+}
+
+// addAlbum adds an album; l.mu must be held
+func (l *Library) addAlbum(album gphotos.Album, itemIDs []string) gphotos.Album {
+	if album.ID == "" {
+		album.ID = l.newID("album")
+	}
+	album.ProductURL = "https://photos.google.com/lr/album/" + album.ID
+	l.albums = append(l.albums, album)
+	l.albumItems[album.ID] = append([]string(nil), itemIDs...)
+	return l.albumWithCount(len(l.albums) - 1)
+}
+
+// AddMediaItem adds a media item with content as its bytes, giving it an ID and a base URL unless
+// it has them
+func (l *Library) AddMediaItem(item gphotos.MediaItem, content []byte) gphotos.MediaItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addMediaItem(item, content)
+}
+
+// addMediaItem adds a media item; l.mu must be held
+func (l *Library) addMediaItem(item gphotos.MediaItem, content []byte) gphotos.MediaItem {
+	if item.ID == "" {
+		item.ID = l.newID("item")
+	}
+	if item.BaseURL == "" {
+		item.BaseURL = "https://photos.example/media/" + item.ID
+	}
+	item.ProductURL = "https://photos.google.com/lr/photo/" + item.ID
+	l.items = append(l.items, item)
+	l.contents[item.ID] = content
+	return item
+}
+
+// Album returns the album with the given ID as the API would
+func (l *Library) Album(id string) (gphotos.Album, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := l.albumIndex(id)
+	if i < 0 {
+		return gphotos.Album{}, false
+	}
+	return l.albumWithCount(i), true
+}
+
+// AlbumItems returns the IDs of the media items in an album, in album order
+func (l *Library) AlbumItems(id string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.albumItems[id]...)
+}
+
+// Enrichments returns the texts added to an album, in album order
+func (l *Library) Enrichments(id string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.enrichments[id]...)
+}
+
+// MediaItem returns the media item with the given ID
+func (l *Library) MediaItem(id string) (gphotos.MediaItem, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := l.itemIndex(id)
+	if i < 0 {
+		return gphotos.MediaItem{}, false
+	}
+	return l.items[i], true
+}
+
+// Fail makes every call to the repository method named method, such as "CreateAlbum", return err
+// until Fail is called for it with nil
+func (l *Library) Fail(method string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		delete(l.failures, method)
+		return
+	}
+	l.failures[method] = err
+}
+
+// Calls returns the names of the repository methods called so far, in order
+func (l *Library) Calls() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+// call records a call to method and locks the library for it, returning the error it was made to
+// fail with. The caller unlocks l.mu.
+func (l *Library) call(method string) error {
+	l.mu.Lock()
+	l.calls = append(l.calls, method)
+	return l.failures[method]
+}
+
+// newID returns a new ID starting with prefix; l.mu must be held
+func (l *Library) newID(prefix string) string {
+	l.nextID++
+	return fmt.Sprintf("%s-%d", prefix, l.nextID)
+}
+
+// albumIndex returns the position of an album in l.albums, or -1; l.mu must be held
+func (l *Library) albumIndex(id string) int {
+	for i, album := range l.albums {
+		if album.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemIndex returns the position of a media item in l.items, or -1; l.mu must be held
+func (l *Library) itemIndex(id string) int {
+	for i, item := range l.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// albumWithCount returns the album at position i with its media item count; l.mu must be held
+func (l *Library) albumWithCount(i int) gphotos.Album {
+	album := l.albums[i]
+	album.MediaItemsCount = int64(len(l.albumItems[album.ID]))
+	return album
+}
+
+// page returns the page req asks for of n results as start and end positions and the token of
+// the next page. Tokens are the position of the next page.
+func page(n int, req gphotos.PageRequest, defaultSize, maxSize int) (start, end int, next string, err error) {
+	size := req.PageSize
+	if size <= 0 {
+		size = defaultSize
+	}
+	size = min(size, maxSize)
+	if req.PageToken != "" {
+		if start, err = strconv.Atoi(req.PageToken); err != nil || start < 0 || start > n {
+			return 0, 0, "", apiError(http.StatusBadRequest, fmt.Sprintf("invalid page token %q", req.PageToken))
+		}
+	}
+	end = min(start+size, n)
+	if end < n {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next, nil
+}
+
+// apiError returns the failure the API answers with status
+func apiError(status int, message string) error {
+	return &gphotos.APIError{
+		StatusCode: status,
+		HTTPStatus: fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Code:       status,
+		Status:     statusName(status),
+		Message:    message,
+	}
+}
+
+// errNotFound is the failure for an album or media item that does not exist
+func errNotFound() error {
+	return apiError(http.StatusNotFound, "Requested entity was not found.")
+}
+
+// statusName returns the name Google APIs give an HTTP status in error bodies
+func statusName(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	default:
+		return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+}
@@ -0,0 +1,160 @@
+package gphotostest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+func TestLibrary_ClientUploadsIntoAlbum(t *testing.T) {
+	lib := NewLibrary()
+	client := gphotos.NewClientWithRepositories(lib.Albums(), lib.MediaItems(), gphotos.Options{})
+	fsys := fstest.MapFS{
+		"a.jpg": {Data: []byte("photo")},
+		"b.mp4": {Data: []byte("video")},
+	}
+
+	summary, err := client.Uploads.UploadDirectory(context.Background(), fsys, gphotos.UploadOptions{AlbumTitle: "Trip"})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Failed() != 0 || len(summary.Results) != 2 {
+		t.Fatalf("Expected both files to be uploaded, got %+v", summary)
+	}
+	album, ok := lib.Album(summary.AlbumID)
+	if !ok || album.Title != "Trip" || !album.IsWriteable || album.MediaItemsCount != 2 {
+		t.Errorf("Expected a writeable album holding both files, got %+v", album)
+	}
+
+	var videos []string
+	for item, err := range client.MediaItems.Search(context.Background(), gphotos.SearchFilters{MediaType: gphotos.MediaTypeVideo}) {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		videos = append(videos, item.Filename)
+	}
+	if !slices.Equal(videos, []string{"b.mp4"}) {
+		t.Errorf("Expected only the video, got %v", videos)
+	}
+
+	i := slices.IndexFunc(summary.Results, func(r gphotos.UploadResult) bool { return r.Path == "a.jpg" })
+	item, _ := lib.MediaItem(summary.Results[i].MediaItemID)
+	content, err := client.MediaItems.Open(item, gphotos.ImageSize{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "photo" {
+		t.Errorf("Expected the uploaded bytes, got %q", data)
+	}
+}
+
+func TestLibrary_AlbumsLikeTheAPI(t *testing.T) {
+	lib := NewLibrary()
+	shared := lib.AddAlbum(gphotos.Album{Title: "Shared"})
+	item := lib.AddMediaItem(gphotos.MediaItem{Filename: "a.jpg", MimeType: "image/jpeg"}, []byte("a"))
+	repo := lib.Albums()
+
+	created, err := repo.CreateAlbum("Holiday")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.AddTextEnrichment(created.ID, "Two weeks off", gphotos.PositionFirstInAlbum); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.BatchAddMediaItems(created.ID, []string{item.ID, item.ID}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ids := lib.AlbumItems(created.ID); !slices.Equal(ids, []string{item.ID}) {
+		t.Errorf("Expected the media item once, got %v", ids)
+	}
+	if texts := lib.Enrichments(created.ID); !slices.Equal(texts, []string{"Two weeks off"}) {
+		t.Errorf("Expected the text in the album, got %v", texts)
+	}
+
+	page, err := repo.ListAlbums(gphotos.PageRequest{PageSize: 1})
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != shared.ID || page.NextPageToken == "" {
+		t.Fatalf("Expected the first album and a next page, got %+v, %v", page, err)
+	}
+	page, err = repo.ListAlbums(gphotos.PageRequest{PageSize: 1, PageToken: page.NextPageToken})
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != created.ID || page.NextPageToken != "" {
+		t.Errorf("Expected the last album, got %+v, %v", page, err)
+	}
+
+	if err := repo.BatchAddMediaItems(shared.ID, []string{item.ID}); !errors.Is(err, gphotos.ErrPermissionDenied) {
+		t.Errorf("Expected albums not created by the app to be read-only, got %v", err)
+	}
+	if _, err := repo.GetAlbumByID("missing"); !errors.Is(err, gphotos.ErrNotFound) {
+		t.Errorf("Expected an unknown album not to be found, got %v", err)
+	}
+}
+
+func TestLibrary_FailAndCalls(t *testing.T) {
+	lib := NewLibrary()
+	repo := lib.Albums()
+	failure := errors.New("boom")
+	lib.Fail("CreateAlbum", failure)
+
+	if _, err := repo.CreateAlbum("Trip"); !errors.Is(err, failure) {
+		t.Errorf("Expected the injected failure, got %v", err)
+	}
+	lib.Fail("CreateAlbum", nil)
+	if _, err := repo.CreateAlbum("Trip"); err != nil {
+		t.Errorf("Expected the failure to be cleared, got %v", err)
+	}
+	if calls := lib.Calls(); !slices.Equal(calls, []string{"CreateAlbum", "CreateAlbum"}) {
+		t.Errorf("Expected both calls to be recorded, got %v", calls)
+	}
+}
+
+func TestOAuthService_Login(t *testing.T) {
+	scopes := gphotos.ScopesFor([]gphotos.Access{gphotos.AccessRead})
+	service := NewOAuthService(scopes...)
+	var authorization string
+	auth := gphotos.NewAuthWithService(service, gphotos.AuthOptions{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			authorization = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody, Request: req}, nil
+		}),
+	})
+
+	if _, err := auth.HTTPClient(context.Background()); !errors.Is(err, gphotos.ErrNotLoggedIn) {
+		t.Errorf("Expected ErrNotLoggedIn before the login, got %v", err)
+	}
+
+	if err := auth.LoginHeadless(strings.NewReader("code\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	token := service.Token()
+	if token == nil || token.Extra("scope") != strings.Join(scopes, " ") {
+		t.Fatalf("Expected a token granting the read scope, got %+v", token)
+	}
+
+	client, err := auth.HTTPClient(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp, err := client.Get("https://photoslibrary.example/v1/albums")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+	if authorization != "Bearer "+token.AccessToken {
+		t.Errorf("Expected the saved token on requests, got %q", authorization)
+	}
+}
+
+// roundTripFunc lets tests answer requests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
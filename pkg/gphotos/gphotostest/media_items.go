@@ -0,0 +1,304 @@
+package gphotostest
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// MediaItemRepository is the gphotos.MediaItemRepository of a Library. Uploads become media
+// items once created with BatchCreateMediaItems; searches filter by date and media type only, as
+// the library knows nothing of content categories, favorites or archiving. Like albums, media
+// items come whole whatever fields are asked for.
+type MediaItemRepository struct {
+	lib *Library
+}
+
+var _ gphotos.MediaItemRepository = (*MediaItemRepository)(nil)
+
+// Upload keeps the bytes of a file and returns its upload token
+func (r *MediaItemRepository) Upload(fileName, mimeType string, content io.Reader, size int64) (string, error) {
+	// Reading comes first, so a slow reader does not hold the library
+	data, readErr := io.ReadAll(content)
+
+	l := r.lib
+	err := l.call("Upload")
+	defer l.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+	return l.addUpload(fileName, mimeType, data)
+}
+
+// UploadResumable keeps the bytes of a file like Upload; it is never interrupted, so ctx and key
+// are not used
+func (r *MediaItemRepository) UploadResumable(ctx context.Context, key, fileName, mimeType string, content io.ReaderAt, size int64) (string, error) {
+	data, readErr := io.ReadAll(io.NewSectionReader(content, 0, size))
+
+	l := r.lib
+	err := l.call("UploadResumable")
+	defer l.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+	return l.addUpload(fileName, mimeType, data)
+}
+
+// addUpload keeps an uploaded file under a new token; l.mu must be held
+func (l *Library) addUpload(fileName, mimeType string, data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", apiError(http.StatusBadRequest, "Upload must contain the bytes of the file.")
+	}
+	token := l.newID("upload")
+	l.uploads[token] = upload{fileName: fileName, mimeType: mimeType, data: data}
+	return token, nil
+}
+
+// GetMediaItem returns one media item
+func (r *MediaItemRepository) GetMediaItem(id string) (*gphotos.MediaItem, error) {
+	l := r.lib
+	err := l.call("GetMediaItem")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	i := l.itemIndex(id)
+	if i < 0 {
+		return nil, errNotFound()
+	}
+	item := l.items[i]
+	return &item, nil
+}
+
+// UpdateMediaItemDescription replaces the description of a media item
+func (r *MediaItemRepository) UpdateMediaItemDescription(id, description string) (*gphotos.MediaItem, error) {
+	l := r.lib
+	err := l.call("UpdateMediaItemDescription")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	i := l.itemIndex(id)
+	if i < 0 {
+		return nil, errNotFound()
+	}
+	l.items[i].Description = description
+	item := l.items[i]
+	return &item, nil
+}
+
+// BatchGetMediaItems returns up to gphotos.MaxBatchMediaItems media items, leaving out those
+// that do not exist
+func (r *MediaItemRepository) BatchGetMediaItems(ids []string) ([]gphotos.MediaItem, error) {
+	l := r.lib
+	err := l.call("BatchGetMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 || len(ids) > gphotos.MaxBatchMediaItems {
+		return nil, apiError(http.StatusBadRequest, "Request must contain between 1 and 50 media item IDs.")
+	}
+	var items []gphotos.MediaItem
+	for _, id := range ids {
+		if i := l.itemIndex(id); i >= 0 {
+			items = append(items, l.items[i])
+		}
+	}
+	return items, nil
+}
+
+// GetMediaItems returns one result per ID in the order given, failing with an error matching
+// gphotos.ErrNotFound for media items that do not exist
+func (r *MediaItemRepository) GetMediaItems(ids []string) ([]gphotos.MediaItemResult, error) {
+	l := r.lib
+	err := l.call("GetMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]gphotos.MediaItemResult, len(ids))
+	for n, id := range ids {
+		results[n].ID = id
+		if i := l.itemIndex(id); i >= 0 {
+			item := l.items[i]
+			results[n].MediaItem = &item
+		} else {
+			results[n].Err = errNotFound()
+		}
+	}
+	return results, nil
+}
+
+// ListMediaItems returns a page of the library, in the order the media items were added
+func (r *MediaItemRepository) ListMediaItems(req gphotos.PageRequest) (*gphotos.Page[gphotos.MediaItem], error) {
+	l := r.lib
+	err := l.call("ListMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return itemsPage(l.items, req)
+}
+
+// SearchMediaItems returns a page of the media items in an album, in album order
+func (r *MediaItemRepository) SearchMediaItems(albumID string, req gphotos.PageRequest) (*gphotos.Page[gphotos.MediaItem], error) {
+	l := r.lib
+	err := l.call("SearchMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if l.albumIndex(albumID) < 0 {
+		return nil, apiError(http.StatusBadRequest, "Invalid album ID.")
+	}
+	var items []gphotos.MediaItem
+	for _, id := range l.albumItems[albumID] {
+		if i := l.itemIndex(id); i >= 0 {
+			items = append(items, l.items[i])
+		}
+	}
+	return itemsPage(items, req)
+}
+
+// SearchMediaItemsByFilters returns a page of the media items of the type and within the date
+// ranges of filters, newest first when filtered by date
+func (r *MediaItemRepository) SearchMediaItemsByFilters(filters gphotos.SearchFilters, req gphotos.PageRequest) (*gphotos.Page[gphotos.MediaItem], error) {
+	l := r.lib
+	err := l.call("SearchMediaItemsByFilters")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	items := slices.DeleteFunc(slices.Clone(l.items), func(item gphotos.MediaItem) bool { return !matches(filters, item) })
+	if len(filters.DateRanges) > 0 {
+		slices.SortStableFunc(items, func(a, b gphotos.MediaItem) int { return creationTime(b).Compare(creationTime(a)) })
+	}
+	return itemsPage(items, req)
+}
+
+// DownloadMediaItem opens the bytes of a media item at any size
+func (r *MediaItemRepository) DownloadMediaItem(item gphotos.MediaItem, size gphotos.ImageSize) (io.ReadCloser, error) {
+	l := r.lib
+	err := l.call("DownloadMediaItem")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := l.contents[item.ID]
+	if !ok {
+		return nil, errNotFound()
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// BatchCreateMediaItems turns up to gphotos.MaxBatchMediaItems uploads into media items, adding
+// them to a writeable album when albumID is set. Unknown upload tokens fail their item alone.
+func (r *MediaItemRepository) BatchCreateMediaItems(albumID string, newItems []gphotos.NewMediaItem) ([]gphotos.NewMediaItemResult, error) {
+	l := r.lib
+	err := l.call("BatchCreateMediaItems")
+	defer l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(newItems) == 0 || len(newItems) > gphotos.MaxBatchMediaItems {
+		return nil, apiError(http.StatusBadRequest, "Request must contain between 1 and 50 new media items.")
+	}
+	if albumID != "" {
+		if _, err := l.writeableAlbum(albumID); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]gphotos.NewMediaItemResult, len(newItems))
+	for n, newItem := range newItems {
+		results[n].UploadToken = newItem.UploadToken
+		up, ok := l.uploads[newItem.UploadToken]
+		if !ok {
+			results[n].Status = gphotos.Status{Code: codeInvalidArgument, Message: "Failed: There was an error while trying to create this media item."}
+			continue
+		}
+		delete(l.uploads, newItem.UploadToken)
+
+		metadata := &gphotos.MediaMetadata{CreationTime: epoch.Add(time.Duration(l.created) * time.Second)}
+		l.created++
+		if strings.HasPrefix(up.mimeType, "video/") {
+			metadata.Video = &gphotos.VideoMetadata{}
+		} else {
+			metadata.Photo = &gphotos.PhotoMetadata{}
+		}
+		item := l.addMediaItem(gphotos.MediaItem{
+			Description:   newItem.Description,
+			MimeType:      up.mimeType,
+			Filename:      cmp.Or(newItem.FileName, up.fileName),
+			MediaMetadata: metadata,
+		}, up.data)
+		if albumID != "" {
+			l.albumItems[albumID] = append(l.albumItems[albumID], item.ID)
+		}
+		results[n].Status = gphotos.Status{Message: "Success"}
+		results[n].MediaItem = &item
+	}
+	return results, nil
+}
+
+// itemsPage returns the page req asks for of items
+func itemsPage(items []gphotos.MediaItem, req gphotos.PageRequest) (*gphotos.Page[gphotos.MediaItem], error) {
+	start, end, next, err := page(len(items), req, defaultMediaItemPageSize, gphotos.MaxMediaItemPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &gphotos.Page[gphotos.MediaItem]{Items: slices.Clone(items[start:end]), NextPageToken: next}, nil
+}
+
+// matches reports whether item is of the media type and within the date ranges of filters
+func matches(filters gphotos.SearchFilters, item gphotos.MediaItem) bool {
+	switch filters.MediaType {
+	case gphotos.MediaTypePhoto:
+		if item.IsVideo() {
+			return false
+		}
+	case gphotos.MediaTypeVideo:
+		if !item.IsVideo() {
+			return false
+		}
+	}
+	if len(filters.DateRanges) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(filters.DateRanges, func(dr gphotos.DateRange) bool {
+		return dr.Contains(creationTime(item), time.UTC)
+	})
+}
+
+// creationTime returns when item was taken, or the zero time
+func creationTime(item gphotos.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime
+}
@@ -0,0 +1,125 @@
+package gphotostest
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// tokenExpiry is when the tokens of OAuthService expire, late enough that they are never refreshed
+var tokenExpiry = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// OAuthService is an in-memory gphotos.OAuthService that approves every login at once. Its
+// tokens are granted the scopes it was created with and never expire; they are kept in memory
+// instead of a token file.
+type OAuthService struct {
+	mu          sync.Mutex
+	scopes      []string
+	redirectURL string
+	token       *oauth2.Token
+}
+
+var _ gphotos.OAuthService = (*OAuthService)(nil)
+
+// NewOAuthService creates an OAuthService with no saved token whose logins grant scopes, or
+// gphotos.DefaultScopes when there are none
+func NewOAuthService(scopes ...string) *OAuthService {
+	if len(scopes) == 0 {
+		scopes = gphotos.DefaultScopes
+	}
+	return &OAuthService{scopes: append([]string(nil), scopes...)}
+}
+
+// Token returns the saved token, or nil before the first login
+func (s *OAuthService) Token() *oauth2.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// GetClient returns the OAuth client, with endpoints that are never contacted
+func (s *OAuthService) GetClient() (*oauth2.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &oauth2.Config{
+		ClientID:     "gphotostest",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://accounts.example/auth",
+			TokenURL: "https://accounts.example/token",
+		},
+		RedirectURL: s.redirectURL,
+		Scopes:      append([]string(nil), s.scopes...),
+	}, nil
+}
+
+// LoadToken returns the saved token, failing before the first login
+func (s *OAuthService) LoadToken() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, errors.New("no token saved")
+	}
+	return s.token, nil
+}
+
+// SaveToken keeps tok as the saved token
+func (s *OAuthService) SaveToken(tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = tok
+	return nil
+}
+
+// ExchangeCode returns a token for any code, named after it
+func (s *OAuthService) ExchangeCode(code string) (*oauth2.Token, error) {
+	if code == "" {
+		return nil, errors.New("empty authorization code")
+	}
+	return s.newToken("access-" + code), nil
+}
+
+// GetAuthURL returns the consent page URL
+func (s *OAuthService) GetAuthURL() string {
+	return s.GetAuthURLWithState("")
+}
+
+// GetAuthURLWithState returns the consent page URL carrying state
+func (s *OAuthService) GetAuthURLWithState(state string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := url.Values{"scope": {strings.Join(s.scopes, " ")}}
+	if state != "" {
+		q.Set("state", state)
+	}
+	if s.redirectURL != "" {
+		q.Set("redirect_uri", s.redirectURL)
+	}
+	return "https://accounts.example/auth?" + q.Encode()
+}
+
+// SetRedirectURL sets where the consent page sends the browser back to
+func (s *OAuthService) SetRedirectURL(redirectURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.redirectURL = redirectURL
+}
+
+// newToken returns a token granting the scopes of s
+func (s *OAuthService) newToken(accessToken string) *oauth2.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := &oauth2.Token{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		RefreshToken: "refresh-" + accessToken,
+		Expiry:       tokenExpiry,
+	}
+	return token.WithExtra(map[string]any{"scope": strings.Join(s.scopes, " ")})
+}
@@ -0,0 +1,228 @@
+package gphotos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+// DownloadOptions configures the downloads of MediaItemsService
+type DownloadOptions struct {
+	// Dir is the directory files are written to; it is created when missing
+	Dir string
+	// Workers is the number of concurrent downloads; values below 1 use the default
+	Workers int
+	// MaxWidth and MaxHeight scale photos down to fit; zero keeps the original size
+	MaxWidth  int
+	MaxHeight int
+}
+
+// DownloadResult is the outcome of downloading one media item
+type DownloadResult struct {
+	MediaItemID string `json:"mediaItemId"`
+	Path        string `json:"path,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	// Exists is set when the target file was already present and left untouched
+	Exists bool   `json:"exists,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ExportOptions configures MediaItemsService.ExportAlbum
+type ExportOptions struct {
+	// Out is the archive to write; its extension picks the format: .zip, .tar, .tar.gz or .tgz
+	Out string
+	// Originals adds the original bytes of every media item next to the manifest
+	Originals bool
+	// Workers is the number of originals downloaded at a time; values below 1 use the default
+	Workers int
+}
+
+// ExportResult is the outcome of MediaItemsService.ExportAlbum
+type ExportResult struct {
+	Path       string `json:"path"`
+	Album      Album  `json:"album"`
+	MediaItems int    `json:"mediaItems"`
+	// Originals counts the media items whose bytes are in the archive
+	Originals int `json:"originals"`
+	// Failed are the originals that could not be downloaded; their items are still in the manifest
+	Failed []DownloadResult `json:"failed,omitempty"`
+	// Bytes is the size of the archive
+	Bytes int64 `json:"bytes"`
+}
+
+// ExportManifest is the manifest.json of an archive written by MediaItemsService.ExportAlbum
+type ExportManifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Album      Album     `json:"album"`
+	// Description heads the album as a text entry when it is restored; exports leave it empty
+	Description string         `json:"description,omitempty"`
+	MediaItems  []ExportedItem `json:"mediaItems"`
+}
+
+// ExportedItem is a media item of an ExportManifest
+type ExportedItem struct {
+	MediaItem
+	// File is the path of the original inside the archive, empty when originals were not asked
+	// for or the download failed
+	File string `json:"file,omitempty"`
+}
+
+// MediaItemsService looks up, searches and downloads the photos and videos of the account
+type MediaItemsService struct {
+	repo      domain.MediaItemRepository
+	downloads *usecase.DownloadUseCase
+}
+
+// Get returns the media item with the given ID
+func (s *MediaItemsService) Get(id string) (*MediaItem, error) {
+	return s.repo.GetMediaItem(id)
+}
+
+// SetDescription replaces the description of a media item created by this app; an empty
+// description clears it
+func (s *MediaItemsService) SetDescription(id, description string) (*MediaItem, error) {
+	return s.repo.UpdateMediaItemDescription(id, description)
+}
+
+// BatchGet returns the media items with the given IDs in as many requests as needed, leaving out
+// those the API cannot return, e.g. because they were deleted
+func (s *MediaItemsService) BatchGet(ids []string) ([]MediaItem, error) {
+	var items []MediaItem
+	for batch := range slices.Chunk(ids, domain.MaxBatchMediaItems) {
+		found, err := s.repo.BatchGetMediaItems(batch)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, found...)
+	}
+	return items, nil
+}
+
+// GetMany returns one result per ID in the order given, fetched in as many requests as needed.
+// Items the API cannot return carry the reason in their Err, which errors.Is matches with
+// ErrNotFound or ErrPermissionDenied.
+func (s *MediaItemsService) GetMany(ids []string) ([]MediaItemResult, error) {
+	return s.repo.GetMediaItems(ids)
+}
+
+// All iterates over the media items in the library that the app can see
+func (s *MediaItemsService) All(ctx context.Context) iter.Seq2[MediaItem, error] {
+	return pages(ctx, domain.MaxMediaItemPageSize, s.repo.ListMediaItems)
+}
+
+// InAlbum iterates over the media items of an album in album order
+func (s *MediaItemsService) InAlbum(ctx context.Context, albumID string) iter.Seq2[MediaItem, error] {
+	return pages(ctx, domain.MaxMediaItemPageSize, func(req PageRequest) (*Page[MediaItem], error) {
+		return s.repo.SearchMediaItems(albumID, req)
+	})
+}
+
+// Search iterates over the media items matching filters; items filtered by date come newest first
+func (s *MediaItemsService) Search(ctx context.Context, filters SearchFilters) iter.Seq2[MediaItem, error] {
+	return pages(ctx, domain.MaxMediaItemPageSize, func(req PageRequest) (*Page[MediaItem], error) {
+		return s.repo.SearchMediaItemsByFilters(filters, req)
+	})
+}
+
+// ListPage returns a single page of the library; req.PageSize may be at most MaxMediaItemPageSize
+func (s *MediaItemsService) ListPage(req PageRequest) (*Page[MediaItem], error) {
+	return s.repo.ListMediaItems(req)
+}
+
+// Open opens the bytes of a media item, photos scaled to fit size unless it is zero; the caller
+// must close it. Expired base URLs are refreshed first.
+func (s *MediaItemsService) Open(item MediaItem, size ImageSize) (io.ReadCloser, error) {
+	return s.repo.DownloadMediaItem(item, size)
+}
+
+// Download saves a single media item into opts.Dir under its file name
+func (s *MediaItemsService) Download(ctx context.Context, mediaItemID string, opts DownloadOptions) ([]DownloadResult, error) {
+	return downloadResults(s.downloads.DownloadItem(ctx, mediaItemID, usecase.DownloadOptions(opts)))
+}
+
+// DownloadMany saves the media items with the given IDs into opts.Dir. Items that cannot be
+// fetched or downloaded are reported in the results rather than ending the download.
+func (s *MediaItemsService) DownloadMany(ctx context.Context, ids []string, opts DownloadOptions) ([]DownloadResult, error) {
+	return downloadResults(s.downloads.DownloadItems(ctx, ids, usecase.DownloadOptions(opts)))
+}
+
+// DownloadAlbum saves every media item of an album into opts.Dir. Failures of individual items are
+// reported in the results rather than ending the download.
+func (s *MediaItemsService) DownloadAlbum(ctx context.Context, albumID string, opts DownloadOptions) ([]DownloadResult, error) {
+	return downloadResults(s.downloads.DownloadAlbum(ctx, albumID, usecase.DownloadOptions(opts)))
+}
+
+// ExportAlbum writes the metadata of an album and its media items, and with opts.Originals their
+// original bytes, to the zip or tar archive opts.Out, so the album can be kept or moved elsewhere
+func (s *MediaItemsService) ExportAlbum(ctx context.Context, albumID string, opts ExportOptions) (*ExportResult, error) {
+	result, err := s.downloads.ExportAlbum(ctx, albumID, usecase.ExportOptions(opts))
+	if result == nil {
+		return nil, err
+	}
+	failed, _ := downloadResults(result.Failed, nil)
+	return &ExportResult{
+		Path:       result.Path,
+		Album:      result.Album,
+		MediaItems: result.MediaItems,
+		Originals:  result.Originals,
+		Failed:     failed,
+		Bytes:      result.Bytes,
+	}, err
+}
+
+// downloadResults converts the results of the download use case
+func downloadResults(results []usecase.DownloadResult, err error) ([]DownloadResult, error) {
+	if results == nil {
+		return nil, err
+	}
+	converted := make([]DownloadResult, len(results))
+	for i, result := range results {
+		converted[i] = DownloadResult(result)
+	}
+	return converted, err
+}
+
+// pages iterates over the items of a list, fetching pages of pageSize items as iteration goes
+// on. Errors, including context cancellation and page tokens that repeat, are yielded once and
+// end iteration.
+func pages[T any](ctx context.Context, pageSize int, fetch func(PageRequest) (*Page[T], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		req := PageRequest{PageSize: pageSize}
+		seen := make(map[string]bool)
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			page, err := fetch(req)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if !page.HasNext() {
+				return
+			}
+			if seen[page.NextPageToken] {
+				yield(zero, fmt.Errorf("page token %q returned twice", page.NextPageToken))
+				return
+			}
+			seen[page.NextPageToken] = true
+			req = req.Next(page.NextPageToken)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package search builds the filters of a media item search one option at a time and checks them
+// before they are sent, so mistakes such as asking for photos and videos only fail without a
+// request:
+//
+//	filters, err := search.NewFilter().
+//		DateRange(start, end).
+//		Categories(search.Landscapes).
+//		VideosOnly().
+//		Favorites().
+//		Build()
+//	...
+//	for item, err := range client.MediaItems.Search(ctx, filters) {
+//		...
+//	}
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/repository"
+	"krupesh.faldu/pkg/gphotos"
+)
+
+// Category is a category Google Photos assigns to media items based on their content
+type Category = domain.ContentCategory
+
+// Content categories to include or exclude
+const (
+	None         = domain.ContentCategoryNone
+	Landscapes   = domain.ContentCategoryLandscapes
+	Receipts     = domain.ContentCategoryReceipts
+	Cityscapes   = domain.ContentCategoryCityscapes
+	Landmarks    = domain.ContentCategoryLandmarks
+	Selfies      = domain.ContentCategorySelfies
+	People       = domain.ContentCategoryPeople
+	Pets         = domain.ContentCategoryPets
+	Weddings     = domain.ContentCategoryWeddings
+	Birthdays    = domain.ContentCategoryBirthdays
+	Documents    = domain.ContentCategoryDocuments
+	Travel       = domain.ContentCategoryTravel
+	Animals      = domain.ContentCategoryAnimals
+	Food         = domain.ContentCategoryFood
+	Sport        = domain.ContentCategorySport
+	Night        = domain.ContentCategoryNight
+	Performances = domain.ContentCategoryPerformances
+	Whiteboards  = domain.ContentCategoryWhiteboards
+	Screenshots  = domain.ContentCategoryScreenshots
+	Utility      = domain.ContentCategoryUtility
+	Arts         = domain.ContentCategoryArts
+	Crafts       = domain.ContentCategoryCrafts
+	Fashion      = domain.ContentCategoryFashion
+	Houses       = domain.ContentCategoryHouses
+	Gardens      = domain.ContentCategoryGardens
+	Flowers      = domain.ContentCategoryFlowers
+	Holidays     = domain.ContentCategoryHolidays
+)
+
+// Filter collects search options; its methods return the filter so calls can be chained. Options
+// that contradict each other are remembered and reported by Build, so a chain never has to stop
+// for errors.
+type Filter struct {
+	filters gphotos.SearchFilters
+	err     error
+}
+
+// NewFilter returns a filter matching every media item
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// DateRange matches media items taken from the day of start to the day of end, both included.
+// Media items in any of up to five ranges or dates match.
+func (f *Filter) DateRange(start, end time.Time) *Filter {
+	f.filters.DateRanges = append(f.filters.DateRanges, domain.DateRange{Start: start, End: end})
+	return f
+}
+
+// Date matches media items taken on the day of day
+func (f *Filter) Date(day time.Time) *Filter {
+	return f.DateRange(day, day)
+}
+
+// Categories matches media items in any of categories
+func (f *Filter) Categories(categories ...Category) *Filter {
+	f.filters.ContentCategories = append(f.filters.ContentCategories, categories...)
+	return f
+}
+
+// ExcludeCategories leaves out media items in any of categories
+func (f *Filter) ExcludeCategories(categories ...Category) *Filter {
+	f.filters.ExcludedContentCategories = append(f.filters.ExcludedContentCategories, categories...)
+	return f
+}
+
+// PhotosOnly matches photos; it cannot be combined with VideosOnly
+func (f *Filter) PhotosOnly() *Filter {
+	return f.mediaType(domain.MediaTypePhoto)
+}
+
+// VideosOnly matches videos; it cannot be combined with PhotosOnly
+func (f *Filter) VideosOnly() *Filter {
+	return f.mediaType(domain.MediaTypeVideo)
+}
+
+// mediaType restricts the filter to t, remembering a conflict with a type set before
+func (f *Filter) mediaType(t domain.MediaType) *Filter {
+	if f.filters.MediaType != "" && f.filters.MediaType != t && f.err == nil {
+		f.err = fmt.Errorf("%w: PhotosOnly and VideosOnly cannot be combined", domain.ErrInvalidArgument)
+	}
+	f.filters.MediaType = t
+	return f
+}
+
+// Favorites matches media items marked as favorite
+func (f *Filter) Favorites() *Filter {
+	f.filters.Favorites = true
+	return f
+}
+
+// IncludeArchived also matches archived media items, which are left out otherwise
+func (f *Filter) IncludeArchived() *Filter {
+	f.filters.IncludeArchived = true
+	return f
+}
+
+// AppCreatedOnly matches the media items uploaded by this app
+func (f *Filter) AppCreatedOnly() *Filter {
+	f.filters.AppCreatedOnly = true
+	return f
+}
+
+// Build returns the filters for MediaItemsService.Search, or an error matching
+// gphotos.ErrInvalidArgument if options contradict each other or go over the limits of the API
+func (f *Filter) Build() (gphotos.SearchFilters, error) {
+	if f.err != nil {
+		return gphotos.SearchFilters{}, f.err
+	}
+	if err := f.filters.Validate(); err != nil {
+		return gphotos.SearchFilters{}, err
+	}
+	return f.filters, nil
+}
+
+// MarshalJSON returns the filters object of a search request as the API expects it
+func (f *Filter) MarshalJSON() ([]byte, error) {
+	filters, err := f.Build()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(repository.SearchFiltersBody(filters))
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"krupesh.faldu/pkg/gphotos"
+)
+
+func TestFilter_MarshalJSON(t *testing.T) {
+	start := time.Date(2024, 2, 9, 0, 0, 0, 0, time.UTC)
+	filter := NewFilter().DateRange(start, start.AddDate(0, 1, 0)).Categories(Landscapes).ExcludeCategories(Selfies).VideosOnly().Favorites().IncludeArchived().AppCreatedOnly()
+
+	b, err := filter.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := `{"contentFilter":{"excludedContentCategories":["SELFIES"],"includedContentCategories":["LANDSCAPES"]},"dateFilter":{"ranges":[{"endDate":{"day":9,"month":3,"year":2024},"startDate":{"day":9,"month":2,"year":2024}}]},"excludeNonAppCreatedData":true,"featureFilter":{"includedFeatures":["FAVORITES"]},"includeArchivedMedia":true,"mediaTypeFilter":{"mediaTypes":["VIDEO"]}}`
+	if string(b) != want {
+		t.Errorf("Expected %s, got %s", want, b)
+	}
+
+	if b, err := NewFilter().MarshalJSON(); err != nil || string(b) != `{}` {
+		t.Errorf("Expected an empty filter to match everything, got %s (%v)", b, err)
+	}
+}
+
+func TestFilter_Build(t *testing.T) {
+	day := time.Date(2024, 2, 9, 0, 0, 0, 0, time.UTC)
+	filters, err := NewFilter().Date(day).PhotosOnly().PhotosOnly().Build()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(filters.DateRanges) != 1 || !filters.DateRanges[0].End.Equal(day) || filters.MediaType != "PHOTO" {
+		t.Errorf("Expected photos of one day, got %+v", filters)
+	}
+
+	tests := []struct {
+		name   string
+		filter *Filter
+	}{
+		{"photos and videos", NewFilter().PhotosOnly().Categories(Travel).VideosOnly()},
+		{"included and excluded", NewFilter().Categories(Pets, Food).ExcludeCategories(Food)},
+		{"range ends first", NewFilter().DateRange(day, day.AddDate(0, 0, -1))},
+		{"too many ranges", NewFilter().Date(day).Date(day).Date(day).Date(day).Date(day).Date(day)},
+		{"unknown category", NewFilter().Categories("SUNSETS")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.filter.Build(); !errors.Is(err, gphotos.ErrInvalidArgument) {
+				t.Errorf("Expected ErrInvalidArgument, got %v", err)
+			}
+			if _, err := tt.filter.MarshalJSON(); err == nil {
+				t.Error("Expected MarshalJSON to fail too")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package gphotos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"time"
+
+	"krupesh.faldu/internal/domain"
+	"krupesh.faldu/internal/usecase"
+)
+
+// UploadOptions configures UploadsService.UploadDirectory
+type UploadOptions struct {
+	// AlbumID adds the uploaded items to an existing app-created album
+	AlbumID string
+	// AlbumTitle creates a new album for the uploaded items; ignored when AlbumID is set
+	AlbumTitle string
+	// Workers is the number of concurrent uploads; values below 1 use the default
+	Workers int
+	// FixDates corrects EXIF timestamps, or adds them from file names, in what is uploaded; the
+	// files themselves are left as they are
+	FixDates *DateFix
+	// Description is a text/template executed for every file with its Filename, Name, Created,
+	// Camera and Location, whose result becomes the description of its media item; empty leaves
+	// them without
+	Description string
+}
+
+// DateFix corrects the EXIF timestamps of photos as they are uploaded, such as after the camera
+// clock was set wrong
+type DateFix struct {
+	// Offset is added to every timestamp
+	Offset time.Duration
+	// From is the time zone the camera clock was set to and To the one the photos were taken
+	// in; the zone is left alone unless both are set
+	From *time.Location
+	To   *time.Location
+	// Except holds path.Match patterns of files, relative to the upload directory or by base
+	// name, whose timestamps are left as they are
+	Except []string
+	// FileNamePatterns are regular expressions finding the date of JPEG photos without EXIF data
+	// in their file names, with the named groups year, month and day and optionally hour, minute,
+	// second and ampm; an EXIF segment with that date is added before the other corrections apply
+	FileNamePatterns []string
+}
+
+// UploadSummary is the outcome of UploadsService.UploadDirectory
+type UploadSummary struct {
+	AlbumID string         `json:"albumId,omitempty"`
+	Results []UploadResult `json:"results"`
+	// Skipped lists files that were not uploaded because they are not photos or videos
+	Skipped []string `json:"skipped"`
+}
+
+// Failed returns the number of files that could not be uploaded
+func (s *UploadSummary) Failed() int {
+	failed := 0
+	for _, result := range s.Results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// UploadResult is the outcome of uploading one file
+type UploadResult struct {
+	Path        string `json:"path"`
+	MediaItemID string `json:"mediaItemId,omitempty"`
+	// DatesFixed is set when the EXIF timestamps were corrected before uploading, and
+	// DateInferred when the date was taken from the file name
+	DatesFixed   bool   `json:"datesFixed,omitempty"`
+	DateInferred bool   `json:"dateInferred,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// UploadsService adds local photos and videos to the library
+type UploadsService struct {
+	repo    domain.MediaItemRepository
+	uploads *usecase.UploadUseCase
+}
+
+// UploadDirectory uploads every photo and video below the root of fsys and creates their media
+// items, optionally in an album. Failures of individual files are reported in the summary rather
+// than ending the upload; cancelling ctx stops starting new uploads.
+func (s *UploadsService) UploadDirectory(ctx context.Context, fsys fs.FS, opts UploadOptions) (*UploadSummary, error) {
+	uploadOpts := usecase.UploadOptions{
+		AlbumID:     opts.AlbumID,
+		AlbumTitle:  opts.AlbumTitle,
+		Workers:     opts.Workers,
+		Description: opts.Description,
+	}
+	if fix := opts.FixDates; fix != nil {
+		uploadOpts.FixDates = &usecase.DateFix{Offset: fix.Offset, From: fix.From, To: fix.To, Except: fix.Except}
+		for _, pattern := range fix.FileNamePatterns {
+			rule, err := domain.NewFilenameDateRule(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+			}
+			uploadOpts.FixDates.FileNames = append(uploadOpts.FixDates.FileNames, rule)
+		}
+	}
+
+	summary, err := s.uploads.UploadDirectory(ctx, fsys, uploadOpts)
+	if summary == nil {
+		return nil, err
+	}
+	results := make([]UploadResult, len(summary.Results))
+	for i, result := range summary.Results {
+		results[i] = UploadResult(result)
+	}
+	return &UploadSummary{AlbumID: summary.AlbumID, Results: results, Skipped: summary.Skipped}, err
+}
+
+// Upload sends the bytes of a single file and returns an upload token, valid for one day, to pass
+// to Create
+func (s *UploadsService) Upload(fileName, mimeType string, content io.Reader, size int64) (string, error) {
+	return s.repo.Upload(fileName, mimeType, content, size)
+}
+
+// Create turns upload tokens into media items in as many requests as needed, adding them to an
+// album created by this app unless albumID is empty. Each result reports its own status.
+func (s *UploadsService) Create(albumID string, items []NewMediaItem) ([]NewMediaItemResult, error) {
+	var results []NewMediaItemResult
+	for batch := range slices.Chunk(items, domain.MaxBatchMediaItems) {
+		created, err := s.repo.BatchCreateMediaItems(albumID, batch)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, created...)
+	}
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package gphotos
+
+import (
+	"context"
+	"time"
+
+	"krupesh.faldu/internal/usecase"
+)
+
+// WatchSpec says which changes Client.Watch reports
+type WatchSpec struct {
+	// Albums reports albums that are added, removed or renamed
+	Albums bool
+	// AlbumIDs reports media items added to and removed from these albums
+	AlbumIDs []string
+	// Library reports media items added to the library. The API finds new items by capture date, so
+	// only those captured after the newest item seen so far, give or take a day, are reported.
+	Library bool
+	// Interval is the time between polls; zero uses DefaultWatchInterval
+	Interval time.Duration
+}
+
+// Event is a change Client.Watch found. It is one of the event types below, told apart with a
+// type switch:
+//
+//	for event := range events {
+//		switch e := event.(type) {
+//		case gphotos.ItemAdded:
+//			...
+//		case gphotos.AlbumRenamed:
+//			...
+//		case gphotos.WatchError:
+//			...
+//		}
+//	}
+type Event interface {
+	event()
+}
+
+// AlbumAdded is an album that appeared
+type AlbumAdded struct {
+	Album Album
+}
+
+// AlbumRemoved is an album that is gone, as it was last seen
+type AlbumRemoved struct {
+	Album Album
+}
+
+// AlbumRenamed is an album whose title changed from PreviousTitle
+type AlbumRenamed struct {
+	Album         Album
+	PreviousTitle string
+}
+
+// ItemAdded is a media item added to the album AlbumID, or to the library when it is empty
+type ItemAdded struct {
+	AlbumID string
+	Item    MediaItem
+}
+
+// ItemRemoved is a media item removed from the album AlbumID, as it was last seen
+type ItemRemoved struct {
+	AlbumID string
+	Item    MediaItem
+}
+
+// WatchError is a poll that failed; Client.Watch tries again at the next interval
+type WatchError struct {
+	Err error
+}
+
+func (AlbumAdded) event()   {}
+func (AlbumRemoved) event() {}
+func (AlbumRenamed) event() {}
+func (ItemAdded) event()    {}
+func (ItemRemoved) event()  {}
+func (WatchError) event()   {}
+
+// Polling intervals of Client.Watch
+const (
+	DefaultWatchInterval = time.Minute
+	MinWatchInterval     = 10 * time.Second
+)
+
+// Watch polls every spec.Interval for the changes spec asks for and sends them on the returned
+// channel until ctx is cancelled, when the channel is closed. The first poll takes stock, so only
+// changes made after Watch was called are sent. Album items are listed again only when the item
+// count of an album changes, which keeps polls cheap. A failed poll is sent as a WatchError and
+// polling goes on. The channel is unbuffered: polling waits for the caller to receive.
+func (c *Client) Watch(ctx context.Context, spec WatchSpec) (<-chan Event, error) {
+	events, err := c.subscriptions.Watch(ctx, usecase.WatchSpec(spec))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		for event := range events {
+			select {
+			case out <- watchEvent(event):
+			case <-ctx.Done():
+				// The subscription closes its channel once it sees ctx is done
+				for range events {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// watchEvent converts an event of the subscription use case
+func watchEvent(event usecase.Event) Event {
+	switch e := event.(type) {
+	case usecase.AlbumAdded:
+		return AlbumAdded(e)
+	case usecase.AlbumRemoved:
+		return AlbumRemoved(e)
+	case usecase.AlbumRenamed:
+		return AlbumRenamed(e)
+	case usecase.ItemAdded:
+		return ItemAdded(e)
+	case usecase.ItemRemoved:
+		return ItemRemoved(e)
+	default:
+		return WatchError{Err: event.(usecase.WatchError).Err}
+	}
+}